@@ -0,0 +1,97 @@
+package cache
+
+import "math/bits"
+
+// Filter sizing: ~8 bits per trigram keeps the false-positive rate near 3%
+// with filterHashes probes. Small files get minFilterBits; files large enough
+// to exceed maxFilterBits are capped and usually saturate.
+const (
+	minFilterBits = 512
+	maxFilterBits = 1 << 20
+	filterHashes  = 3
+
+	// maxFillRatio is the share of set bits above which a filter rejects
+	// too little to be worth storing.
+	maxFillRatio = 0.5
+)
+
+// Filter is a Bloom filter over the byte trigrams of a file, ASCII-folded to
+// lowercase so one filter answers both case-sensitive and -i queries.
+type Filter struct {
+	words []uint64 // bit set; len is a power of two
+}
+
+// BuildFilter returns the trigram filter for data, or ok=false if the filter
+// would be too full to ever rule the file out.
+func BuildFilter(data []byte) (Filter, bool) {
+	nbits := minFilterBits
+	for nbits < maxFilterBits && nbits < len(data)*8 {
+		nbits <<= 1
+	}
+	f := Filter{words: make([]uint64, nbits/64)}
+	for i := 0; i+3 <= len(data); i++ {
+		f.add(trigram(data[i], data[i+1], data[i+2]))
+	}
+	if f.fillRatio() > maxFillRatio {
+		return Filter{}, false
+	}
+	return f, true
+}
+
+// MayContain reports whether the file the filter was built from can contain
+// lit. Literals shorter than a trigram always may.
+func (f Filter) MayContain(lit []byte) bool {
+	for i := 0; i+3 <= len(lit); i++ {
+		if !f.has(trigram(lit[i], lit[i+1], lit[i+2])) {
+			return false
+		}
+	}
+	return true
+}
+
+// trigram packs three ASCII-lowercased bytes into one key.
+func trigram(a, b, c byte) uint32 {
+	return uint32(lower(a))<<16 | uint32(lower(b))<<8 | uint32(lower(c))
+}
+
+func lower(b byte) byte {
+	if 'A' <= b && b <= 'Z' {
+		return b + 'a' - 'A'
+	}
+	return b
+}
+
+// probes derives filterHashes bit indexes from t by double hashing.
+func (f Filter) probes(t uint32) (h1, h2, mask uint32) {
+	h1 = t * 0x9E3779B1
+	h2 = (t*0x85EBCA77)>>7 | 1
+	mask = uint32(len(f.words)*64 - 1)
+	return h1, h2, mask
+}
+
+func (f Filter) add(t uint32) {
+	h1, h2, mask := f.probes(t)
+	for i := uint32(0); i < filterHashes; i++ {
+		b := (h1 + i*h2) & mask
+		f.words[b/64] |= 1 << (b % 64)
+	}
+}
+
+func (f Filter) has(t uint32) bool {
+	h1, h2, mask := f.probes(t)
+	for i := uint32(0); i < filterHashes; i++ {
+		b := (h1 + i*h2) & mask
+		if f.words[b/64]&(1<<(b%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (f Filter) fillRatio() float64 {
+	set := 0
+	for _, w := range f.words {
+		set += bits.OnesCount64(w)
+	}
+	return float64(set) / float64(len(f.words)*64)
+}
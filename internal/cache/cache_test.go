@@ -0,0 +1,111 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dl/gogrep/internal/input"
+)
+
+func TestFilter_MayContain(t *testing.T) {
+	f, ok := BuildFilter([]byte("func main() {\n\tfmt.Println(\"Hello\")\n}\n"))
+	if !ok {
+		t.Fatal("BuildFilter rejected a small file")
+	}
+	for _, lit := range []string{"Println", "println", "hello", "main", "ab"} {
+		if !f.MayContain([]byte(lit)) {
+			t.Errorf("MayContain(%q) = false, want true", lit)
+		}
+	}
+	if f.MayContain([]byte("password")) {
+		t.Error("MayContain(password) = true, want false")
+	}
+}
+
+func TestStore_RoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a.txt")
+	if err := os.WriteFile(file, []byte("alpha beta gamma\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	storePath := filepath.Join(dir, "cache", "trigrams")
+
+	store, err := Open(storePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewReader(input.NewBufferedReader(), store, nil)
+	if res, err := r.Read(file); err != nil || res.Data == nil {
+		t.Fatalf("first read = %v, %v; want data", res.Data, err)
+	}
+	if err := store.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err = Open(storePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(store.entries) != 1 {
+		t.Fatalf("reloaded %d entries, want 1", len(store.entries))
+	}
+
+	skip := NewReader(input.NewBufferedReader(), store, []string{"delta", "epsilon"})
+	if res, _ := skip.Read(file); res.Data != nil {
+		t.Error("file without any literal was read")
+	}
+	hit := NewReader(input.NewBufferedReader(), store, []string{"delta", "Gamma"})
+	if res, _ := hit.Read(file); res.Data == nil {
+		t.Error("file containing a literal was skipped")
+	}
+
+	// A modified file must be re-read and re-indexed, not skipped.
+	if err := os.WriteFile(file, []byte("alpha delta\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if res, _ := skip.Read(file); res.Data == nil {
+		t.Error("modified file was skipped using its stale filter")
+	}
+}
+
+func TestOpen_Corrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trigrams")
+	if err := os.WriteFile(path, []byte("garbage"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	store, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(store.entries) != 0 {
+		t.Errorf("corrupt store loaded %d entries", len(store.entries))
+	}
+}
+
+func TestStore_Evict(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a", "b", "trigrams")
+	store, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, _ := BuildFilter([]byte("alpha beta gamma\n"))
+	for key, age := range map[string]int64{"/old": 30, "/new": 0, "/mid": 2} {
+		e := &entry{filter: f}
+		store.put(key, e)
+		e.used = store.today - age
+	}
+	// Room for two entries.
+	store.maxSize = int64(len(storeMagic)) + 2*store.entries["/old"].encodedSize("/old")
+	if err := store.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.entries["/old"]; ok || len(store.entries) != 2 {
+		t.Errorf("kept %d entries, with /old %v; want /new and /mid", len(store.entries), ok)
+	}
+}
@@ -0,0 +1,88 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/dl/gogrep/internal/input"
+	"golang.org/x/sys/unix"
+)
+
+// Reader wraps an input.Reader with a trigram pre-screen. Files whose cached
+// filter rules out every required literal come back empty without being
+// opened; other files are read normally, and a filter is built for any file
+// the store has no fresh entry for.
+type Reader struct {
+	inner    input.Reader
+	store    *Store
+	literals [][]byte // a file may match only if it may contain one of these
+	cwd      string
+}
+
+// NewReader returns a screening Reader. literals are the required literals
+// of the search patterns (see matcher.RequiredLiterals); with none, files
+// are never skipped but filters are still recorded for later searches.
+func NewReader(inner input.Reader, store *Store, literals []string) *Reader {
+	r := &Reader{inner: inner, store: store}
+	for _, lit := range literals {
+		r.literals = append(r.literals, []byte(lit))
+	}
+	r.cwd, _ = os.Getwd()
+	return r
+}
+
+func (r *Reader) Read(path string) (input.ReadResult, error) {
+	key := path
+	if !filepath.IsAbs(key) {
+		if r.cwd == "" {
+			return r.inner.Read(path)
+		}
+		key = filepath.Join(r.cwd, key)
+	}
+
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil || st.Size == 0 {
+		return r.inner.Read(path)
+	}
+
+	if e, ok := r.store.lookup(key, &st); ok {
+		if !r.mayMatch(e.filter) {
+			return input.ReadResult{}, nil
+		}
+		return r.inner.Read(path)
+	}
+
+	// Stat before reading: if the file changes in between, the entry
+	// carries the old mtime and is rebuilt next time.
+	res, err := r.inner.Read(path)
+	if err != nil || len(res.Data) == 0 {
+		return res, err
+	}
+	e := &entry{
+		dev:   uint64(st.Dev),
+		ino:   st.Ino,
+		size:  st.Size,
+		mtime: st.Mtim.Nano(),
+	}
+	if res.Prefetch != nil {
+		res.Prefetch(len(res.Data))
+	}
+	if f, ok := BuildFilter(res.Data); ok {
+		e.filter = f
+	}
+	r.store.put(key, e)
+	return res, nil
+}
+
+// mayMatch reports whether a file with filter f can contain a literal.
+func (r *Reader) mayMatch(f Filter) bool {
+	if f.words == nil || len(r.literals) == 0 {
+		return true
+	}
+	for _, lit := range r.literals {
+		if f.MayContain(lit) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,287 @@
+// Package cache persists per-file trigram Bloom filters between runs so that
+// repeated searches can skip files that cannot contain a pattern's required
+// literal without reading them.
+package cache
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"maps"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// storeMagic starts every cache file; the trailing byte is the format version.
+const storeMagic = "gogrep-trigrams\x02"
+
+// maxStoreSize bounds the cache file. Past it, Save drops the entries
+// used longest ago, which also clears out files deleted since they were
+// cached.
+const maxStoreSize = 64 << 20
+
+// entry is the cached filter of one file, valid while the file's identity
+// and modification time are unchanged. A nil filter records a file whose
+// filter was too full to keep, so it is not rebuilt on every run.
+type entry struct {
+	dev, ino uint64
+	size     int64
+	mtime    int64 // nanoseconds
+	used     int64 // day, counted from the Unix epoch, of the last lookup
+	filter   Filter
+}
+
+func (e *entry) fresh(st *unix.Stat_t) bool {
+	return e.dev == uint64(st.Dev) && e.ino == st.Ino && e.size == st.Size &&
+		e.mtime == st.Mtim.Nano()
+}
+
+// Store holds the filters of every file seen so far, keyed by absolute path.
+// It is safe for concurrent use by scheduler workers.
+type Store struct {
+	path string
+
+	maxSize int64 // bytes the file may take (maxStoreSize)
+	today   int64 // day stamped on entries used in this run
+
+	mu      sync.Mutex
+	entries map[string]*entry
+	dirty   bool
+}
+
+// DefaultPath returns the cache file location: $XDG_CACHE_HOME/gogrep/trigrams,
+// falling back to ~/.cache/gogrep/trigrams.
+func DefaultPath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "gogrep", "trigrams"), nil
+}
+
+// Open loads the store at path. A missing file yields an empty store; so
+// does a corrupt or outdated one, which the next Save overwrites.
+func Open(path string) (*Store, error) {
+	s := &Store{
+		path:    path,
+		maxSize: maxStoreSize,
+		today:   time.Now().Unix() / 86400,
+		entries: make(map[string]*entry),
+	}
+	fd, err := unix.Open(path, unix.O_RDONLY|unix.O_CLOEXEC|unix.O_NOATIME, 0)
+	if err == unix.EPERM {
+		// O_NOATIME needs the file's owner, as a shared cache may not be.
+		fd, err = unix.Open(path, unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	}
+	if err == unix.ENOENT {
+		return s, nil
+	}
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	f := os.NewFile(uintptr(fd), path)
+	defer f.Close()
+
+	if err := s.load(bufio.NewReader(f)); err != nil {
+		s.entries = make(map[string]*entry)
+		s.dirty = true
+	}
+	return s, nil
+}
+
+// lookup returns the cached entry for key if it matches st.
+func (s *Store) lookup(key string, st *unix.Stat_t) (*entry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok || !e.fresh(st) {
+		return nil, false
+	}
+	if e.used != s.today {
+		// Stamped by the day, so that runs which only read the cache
+		// rewrite it at most daily.
+		e.used = s.today
+		s.dirty = true
+	}
+	return e, true
+}
+
+func (s *Store) put(key string, e *entry) {
+	s.mu.Lock()
+	e.used = s.today
+	s.entries[key] = e
+	s.dirty = true
+	s.mu.Unlock()
+}
+
+// Save writes the store back to its file if anything changed, first
+// evicting entries to keep it within maxSize. The file is replaced
+// atomically so a concurrent run never reads a partial store.
+func (s *Store) Save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.dirty {
+		return nil
+	}
+	s.evict()
+
+	dir := filepath.Dir(s.path)
+	if err := mkdirAll(dir); err != nil {
+		return &os.PathError{Op: "mkdir", Path: dir, Err: err}
+	}
+	tmp := filepath.Join(dir, fmt.Sprintf(".trigrams-%d-%x", os.Getpid(), rand.Uint64()))
+	fd, err := unix.Open(tmp, unix.O_WRONLY|unix.O_CREAT|unix.O_EXCL|unix.O_CLOEXEC|unix.O_NOATIME, 0o644)
+	if err != nil {
+		return &os.PathError{Op: "create", Path: tmp, Err: err}
+	}
+	f := os.NewFile(uintptr(fd), tmp)
+	w := bufio.NewWriter(f)
+	err = s.write(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		if err = unix.Rename(tmp, s.path); err != nil {
+			err = &os.LinkError{Op: "rename", Old: tmp, New: s.path, Err: err}
+		}
+	}
+	if err != nil {
+		unix.Unlink(tmp)
+		return err
+	}
+	s.dirty = false
+	return nil
+}
+
+// evict drops the entries used longest ago until the encoded store fits
+// in maxSize.
+func (s *Store) evict() {
+	size := int64(len(storeMagic))
+	for key, e := range s.entries {
+		size += e.encodedSize(key)
+	}
+	if size <= s.maxSize {
+		return
+	}
+	keys := slices.Collect(maps.Keys(s.entries))
+	slices.SortFunc(keys, func(a, b string) int {
+		return cmp.Compare(s.entries[a].used, s.entries[b].used)
+	})
+	for _, key := range keys {
+		if size <= s.maxSize {
+			break
+		}
+		size -= s.entries[key].encodedSize(key)
+		delete(s.entries, key)
+	}
+}
+
+// encodedSize returns the most bytes write takes for e under key.
+func (e *entry) encodedSize(key string) int64 {
+	return int64(len(key) + 7*binary.MaxVarintLen64 + 8*len(e.filter.words))
+}
+
+// mkdirAll creates dir and any missing parents, as os.MkdirAll does.
+func mkdirAll(dir string) error {
+	err := unix.Mkdir(dir, 0o755)
+	if err == unix.ENOENT {
+		if err = mkdirAll(filepath.Dir(dir)); err == nil {
+			err = unix.Mkdir(dir, 0o755)
+		}
+	}
+	if err == unix.EEXIST {
+		return nil
+	}
+	return err
+}
+
+// write encodes the store: storeMagic, then per entry the path and the
+// stat fields and the day last used as varints followed by the filter words in little endian.
+func (s *Store) write(w *bufio.Writer) error {
+	if _, err := w.WriteString(storeMagic); err != nil {
+		return err
+	}
+	var buf []byte
+	for key, e := range s.entries {
+		buf = binary.AppendUvarint(buf[:0], uint64(len(key)))
+		buf = append(buf, key...)
+		buf = binary.AppendUvarint(buf, e.dev)
+		buf = binary.AppendUvarint(buf, e.ino)
+		buf = binary.AppendVarint(buf, e.size)
+		buf = binary.AppendVarint(buf, e.mtime)
+		buf = binary.AppendVarint(buf, e.used)
+		buf = binary.AppendUvarint(buf, uint64(len(e.filter.words)))
+		for _, word := range e.filter.words {
+			buf = binary.LittleEndian.AppendUint64(buf, word)
+		}
+		if _, err := w.Write(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) load(r *bufio.Reader) error {
+	magic := make([]byte, len(storeMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != storeMagic {
+		return fmt.Errorf("not a trigram cache")
+	}
+	for {
+		n, err := binary.ReadUvarint(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if n > unix.PathMax {
+			return fmt.Errorf("bad path length %d", n)
+		}
+		key := make([]byte, n)
+		if _, err := io.ReadFull(r, key); err != nil {
+			return err
+		}
+
+		e := &entry{}
+		if e.dev, err = binary.ReadUvarint(r); err != nil {
+			return err
+		}
+		if e.ino, err = binary.ReadUvarint(r); err != nil {
+			return err
+		}
+		if e.size, err = binary.ReadVarint(r); err != nil {
+			return err
+		}
+		if e.mtime, err = binary.ReadVarint(r); err != nil {
+			return err
+		}
+		if e.used, err = binary.ReadVarint(r); err != nil {
+			return err
+		}
+		nwords, err := binary.ReadUvarint(r)
+		if err != nil {
+			return err
+		}
+		if nwords > maxFilterBits/64 || nwords&(nwords-1) != 0 {
+			return fmt.Errorf("bad filter size %d", nwords)
+		}
+		if nwords > 0 {
+			e.filter.words = make([]uint64, nwords)
+			if err := binary.Read(r, binary.LittleEndian, e.filter.words); err != nil {
+				return err
+			}
+		}
+		s.entries[string(key)] = e
+	}
+}
@@ -0,0 +1,364 @@
+// Package calibrate measures the local machine with small benchmarks and
+// suggests the settings that suit it: the mmap threshold, the number of
+// search workers, and the density at which a short pattern is searched with
+// Shift-Or instead of SIMD.
+package calibrate
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/dl/gogrep/internal/input"
+	"github.com/dl/gogrep/internal/matcher"
+	"github.com/dl/gogrep/internal/output"
+	"github.com/dl/gogrep/internal/scheduler"
+	"github.com/dl/gogrep/internal/simd"
+	"github.com/dl/gogrep/internal/walker"
+)
+
+// Bounds of the suggested mmap threshold, the range --mmap-threshold auto
+// moves in: below 1 MiB per-file costs dominate either way.
+const (
+	minThreshold = 1 << 20
+	maxThreshold = 64 << 20
+)
+
+// workerSlack is how much slower than the best a worker count may be and
+// still be suggested: the smallest count within it wins, since more
+// workers only add memory and contention.
+const workerSlack = 1.05
+
+// Options sizes the benchmarks. The zero value of a field picks the default.
+type Options struct {
+	// Dir is where the test files are written: the storage to measure.
+	// Default: the current directory.
+	Dir string
+	// Sizes are the file sizes compared for mmap against buffered reads.
+	// Default: 1 MiB to 32 MiB, doubling.
+	Sizes []int64
+	// Files and FileSize shape the corpus searched at each worker count.
+	// Default: 1024 files of 16 KiB.
+	Files    int
+	FileSize int
+	// Workers are the worker counts tried. Default: 1, 2, 4, ... up to
+	// 4 * NumCPU.
+	Workers []int
+	// Gaps are the occurrence gaps tried for the Shift-Or crossover.
+	// Default: 1 to 64.
+	Gaps []int
+	// Reps is how many times each measurement is repeated; the fastest
+	// run counts. Default 5.
+	Reps int
+	// Progress, if set, is called before each benchmark with its name.
+	Progress func(string)
+}
+
+func (o *Options) setDefaults() {
+	if o.Dir == "" {
+		o.Dir = "."
+	}
+	if len(o.Sizes) == 0 {
+		for s := int64(minThreshold); s <= 32<<20; s *= 2 {
+			o.Sizes = append(o.Sizes, s)
+		}
+	}
+	if o.Files == 0 {
+		o.Files = 1024
+	}
+	if o.FileSize == 0 {
+		o.FileSize = 16 << 10
+	}
+	if len(o.Workers) == 0 {
+		for w := 1; w <= 4*runtime.NumCPU(); w *= 2 {
+			o.Workers = append(o.Workers, w)
+		}
+	}
+	if len(o.Gaps) == 0 {
+		o.Gaps = []int{1, 2, 3, 4, 6, 8, 12, 16, 24, 32, 48, 64}
+	}
+	if o.Reps == 0 {
+		o.Reps = 5
+	}
+}
+
+// Timing is one measurement: a parameter and the fastest time of each
+// contender.
+type Timing struct {
+	Param int64
+	A, B  time.Duration
+}
+
+// Result holds the measurements and the settings suggested from them.
+type Result struct {
+	Reads   []Timing // Param = file size; A = buffered, B = mmap
+	Scaling []Timing // Param = workers; A = time to search the corpus
+	Gaps    []Timing // Param = gap; A = SIMD, B = Shift-Or
+
+	MmapThreshold int64
+	Workers       int
+	DenseGap      int
+}
+
+// Run runs the benchmarks. The test files are written to a temporary
+// directory under opts.Dir and removed before returning.
+func Run(opts Options) (Result, error) {
+	opts.setDefaults()
+	dir, err := os.MkdirTemp(opts.Dir, ".gogrep-calibrate-")
+	if err != nil {
+		return Result{}, err
+	}
+	defer os.RemoveAll(dir)
+
+	var r Result
+	if opts.Progress != nil {
+		opts.Progress("mmap vs read")
+	}
+	if r.Reads, err = measureReads(dir, opts); err != nil {
+		return Result{}, err
+	}
+	r.MmapThreshold = readCrossover(r.Reads)
+
+	if opts.Progress != nil {
+		opts.Progress("workers")
+	}
+	if r.Scaling, err = measureWorkers(dir, opts); err != nil {
+		return Result{}, err
+	}
+	r.Workers = workerSaturation(r.Scaling)
+
+	if opts.Progress != nil {
+		opts.Progress("SIMD vs Shift-Or")
+	}
+	r.Gaps = measureGaps(opts)
+	r.DenseGap = gapCrossover(r.Gaps)
+	return r, nil
+}
+
+// Args returns the suggested settings as config file lines, one argument
+// per line.
+func (r Result) Args() []string {
+	return []string{
+		"--mmap-threshold", strconv.FormatInt(r.MmapThreshold, 10),
+		"--threads", strconv.Itoa(r.Workers),
+		"--dense-gap", strconv.Itoa(r.DenseGap),
+	}
+}
+
+// fastest returns the shortest of reps runs of f.
+func fastest(reps int, f func() error) (time.Duration, error) {
+	best := time.Duration(1<<63 - 1)
+	for range reps {
+		start := time.Now()
+		if err := f(); err != nil {
+			return 0, err
+		}
+		best = min(best, time.Since(start))
+	}
+	return best, nil
+}
+
+// measureReads times reading files of each size, buffered and mapped, with
+// every byte touched as a search would.
+func measureReads(dir string, opts Options) ([]Timing, error) {
+	read := func(r input.Reader, path string) func() error {
+		return func() error {
+			res, err := r.Read(path)
+			if err != nil {
+				return err
+			}
+			simd.Count(res.Data, '\n')
+			return res.Closer()
+		}
+	}
+
+	var timings []Timing
+	for _, size := range opts.Sizes {
+		path := filepath.Join(dir, "read-"+strconv.FormatInt(size, 10))
+		if err := os.WriteFile(path, textData(int(size)), 0o600); err != nil {
+			return nil, err
+		}
+		buffered, err := fastest(opts.Reps, read(input.NewBufferedReader(), path))
+		if err != nil {
+			return nil, err
+		}
+		mapped, err := fastest(opts.Reps, read(input.NewMmapReader(), path))
+		if err != nil {
+			return nil, err
+		}
+		os.Remove(path)
+		timings = append(timings, Timing{Param: size, A: buffered, B: mapped})
+	}
+	return timings, nil
+}
+
+// readCrossover is the smallest size from which mapping is at least as
+// fast as buffered reads for every larger size measured, within
+// [minThreshold, maxThreshold].
+func readCrossover(reads []Timing) int64 {
+	threshold := int64(maxThreshold)
+	for i := len(reads) - 1; i >= 0 && reads[i].B <= reads[i].A; i-- {
+		threshold = reads[i].Param
+	}
+	return min(max(threshold, minThreshold), maxThreshold)
+}
+
+// measureWorkers times a count-only search of a corpus of small files with
+// the scheduler at each worker count.
+func measureWorkers(dir string, opts Options) ([]Timing, error) {
+	data := textData(opts.FileSize)
+	paths := make([]string, opts.Files)
+	for i := range paths {
+		paths[i] = filepath.Join(dir, "file-"+strconv.Itoa(i))
+		if err := os.WriteFile(paths[i], data, 0o600); err != nil {
+			return nil, err
+		}
+	}
+	m, err := matcher.NewMatcher([]string{"calibrat[e]"}, false, false, false, false, matcher.MatcherOpts{})
+	if err != nil {
+		return nil, err
+	}
+
+	var timings []Timing
+	for _, workers := range opts.Workers {
+		d, err := fastest(opts.Reps, func() error {
+			files := make(chan walker.FileEntry)
+			results := scheduler.New(workers, m, input.NewBufferedReader(), false, true, false).Run(files)
+			go func() {
+				for _, p := range paths {
+					files <- walker.FileEntry{Path: p}
+				}
+				close(files)
+			}()
+			return drain(results)
+		})
+		if err != nil {
+			return nil, err
+		}
+		timings = append(timings, Timing{Param: int64(workers), A: d})
+	}
+	return timings, nil
+}
+
+// drain consumes results, releasing their buffers, and returns the first
+// error.
+func drain(results <-chan output.Result) error {
+	var first error
+	for res := range results {
+		if res.Err != nil && first == nil {
+			first = res.Err
+		}
+		if res.Closer != nil {
+			res.Closer()
+		}
+	}
+	return first
+}
+
+// workerSaturation is the smallest worker count within workerSlack of the
+// fastest.
+func workerSaturation(timings []Timing) int {
+	if len(timings) == 0 {
+		return runtime.NumCPU() * 2
+	}
+	best := timings[0].A
+	for _, t := range timings {
+		best = min(best, t.A)
+	}
+	for _, t := range timings {
+		if float64(t.A) <= float64(best)*workerSlack {
+			return int(t.Param)
+		}
+	}
+	return int(timings[len(timings)-1].Param)
+}
+
+// gapPattern is the short pattern timed for the Shift-Or crossover.
+const gapPattern = "ab"
+
+// measureGaps times SIMD search against Shift-Or on 256 KiB of data with an
+// occurrence of gapPattern every gap bytes beyond the pattern.
+func measureGaps(opts Options) []Timing {
+	bm := matcher.NewBoyerMooreMatcher(gapPattern, false, false)
+	so := matcher.NewShiftOrMatcher(gapPattern, false, false)
+
+	var timings []Timing
+	for _, gap := range opts.Gaps {
+		data := gapData(256<<10, gap)
+		search := func(m matcher.Matcher) func() error {
+			return func() error {
+				m.FindAll(data)
+				return nil
+			}
+		}
+		a, _ := fastest(opts.Reps, search(bm))
+		b, _ := fastest(opts.Reps, search(so))
+		timings = append(timings, Timing{Param: int64(gap), A: a, B: b})
+	}
+	return timings
+}
+
+// gapCrossover is the gap setting that sends data to Shift-Or exactly when
+// it won: one more than the largest gap at which it was faster. At least 1.
+func gapCrossover(gaps []Timing) int {
+	n := 0
+	for _, t := range gaps {
+		if t.B < t.A {
+			n = int(t.Param)
+		}
+	}
+	return n + 1
+}
+
+// textData returns n bytes of lines of ordinary text.
+func textData(n int) []byte {
+	line := []byte("the quick brown fox jumps over the lazy dog while searching for nothing\n")
+	data := bytes.Repeat(line, n/len(line)+1)
+	return data[:n]
+}
+
+// gapData returns n bytes with gapPattern followed by gap filler bytes,
+// repeated, and a newline in place of a filler byte about every 80 bytes.
+func gapData(n, gap int) []byte {
+	unit := append([]byte(gapPattern), bytes.Repeat([]byte{'x'}, gap)...)
+	data := bytes.Repeat(unit, n/len(unit)+1)[:n]
+	for i := 79; i < len(data); i += 80 {
+		if data[i] == 'x' {
+			data[i] = '\n'
+		}
+	}
+	return data
+}
+
+// Report formats the measurements and the suggestions for the terminal.
+func (r Result) Report() string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "mmap vs read (file size: buffered / mmap)\n")
+	for _, t := range r.Reads {
+		fmt.Fprintf(&b, "  %8s  %10v / %v\n", sizeString(t.Param), t.A, t.B)
+	}
+	fmt.Fprintf(&b, "  suggested --mmap-threshold %d (%s)\n", r.MmapThreshold, sizeString(r.MmapThreshold))
+	fmt.Fprintf(&b, "workers (count: corpus search time)\n")
+	for _, t := range r.Scaling {
+		fmt.Fprintf(&b, "  %8d  %v\n", t.Param, t.A)
+	}
+	fmt.Fprintf(&b, "  suggested --threads %d\n", r.Workers)
+	fmt.Fprintf(&b, "short pattern (gap: SIMD / Shift-Or)\n")
+	for _, t := range r.Gaps {
+		fmt.Fprintf(&b, "  %8d  %10v / %v\n", t.Param, t.A, t.B)
+	}
+	fmt.Fprintf(&b, "  suggested --dense-gap %d\n", r.DenseGap)
+	return b.String()
+}
+
+// sizeString formats a byte count in KiB or MiB.
+func sizeString(n int64) string {
+	if n >= 1<<20 && n%(1<<20) == 0 {
+		return strconv.FormatInt(n>>20, 10) + " MiB"
+	}
+	return strconv.FormatInt(n>>10, 10) + " KiB"
+}
@@ -0,0 +1,80 @@
+package calibrate
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestReadCrossover(t *testing.T) {
+	ms := time.Millisecond
+	for _, tc := range []struct {
+		name  string
+		reads []Timing
+		want  int64
+	}{
+		{"mmap never wins", []Timing{{1 << 20, ms, 2 * ms}, {2 << 20, ms, 2 * ms}}, maxThreshold},
+		{"mmap wins from 4 MiB", []Timing{{1 << 20, ms, 2 * ms}, {2 << 20, ms, 2 * ms}, {4 << 20, 2 * ms, ms}, {8 << 20, 2 * ms, ms}}, 4 << 20},
+		{"noise below the crossover", []Timing{{1 << 20, 2 * ms, ms}, {2 << 20, ms, 2 * ms}, {4 << 20, 2 * ms, ms}}, 4 << 20},
+		{"mmap always wins", []Timing{{256 << 10, 2 * ms, ms}, {1 << 20, 2 * ms, ms}}, minThreshold},
+		{"loses at the largest size", []Timing{{1 << 20, 2 * ms, ms}, {2 << 20, ms, 2 * ms}}, maxThreshold},
+	} {
+		if got := readCrossover(tc.reads); got != tc.want {
+			t.Errorf("%s: readCrossover = %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestWorkerSaturation(t *testing.T) {
+	timings := []Timing{{1, 800, 0}, {2, 410, 0}, {4, 210, 0}, {8, 204, 0}, {16, 200, 0}}
+	if got := workerSaturation(timings); got != 4 {
+		t.Errorf("workerSaturation = %d, want 4", got)
+	}
+}
+
+func TestGapCrossover(t *testing.T) {
+	gaps := []Timing{{1, 10, 5}, {2, 10, 8}, {4, 10, 12}, {8, 10, 20}}
+	if got := gapCrossover(gaps); got != 3 {
+		t.Errorf("gapCrossover = %d, want 3", got)
+	}
+	if got := gapCrossover([]Timing{{1, 5, 10}}); got != 1 {
+		t.Errorf("gapCrossover with no Shift-Or win = %d, want 1", got)
+	}
+}
+
+func TestGapData(t *testing.T) {
+	data := gapData(1000, 6)
+	if len(data) != 1000 || string(data[:16]) != "abxxxxxxabxxxxxx" || data[79] != '\n' {
+		t.Errorf("gapData = %q...", data[:100])
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	var progress []string
+	res, err := Run(Options{
+		Dir:      dir,
+		Sizes:    []int64{64 << 10, 128 << 10},
+		Files:    16,
+		FileSize: 4 << 10,
+		Workers:  []int{1, 2},
+		Gaps:     []int{1, 16},
+		Reps:     1,
+		Progress: func(name string) { progress = append(progress, name) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Reads) != 2 || len(res.Scaling) != 2 || len(res.Gaps) != 2 || len(progress) != 3 {
+		t.Errorf("measurements = %d reads, %d worker counts, %d gaps, %d progress calls", len(res.Reads), len(res.Scaling), len(res.Gaps), len(progress))
+	}
+	if res.MmapThreshold < minThreshold || res.MmapThreshold > maxThreshold || res.Workers < 1 || res.DenseGap < 1 {
+		t.Errorf("suggestions = %+v", res)
+	}
+	if len(res.Args()) != 6 {
+		t.Errorf("Args = %q", res.Args())
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("test files left behind: %v", entries)
+	}
+}
@@ -0,0 +1,159 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// defaultFlagsEnv names the environment variable holding default flags.
+const defaultFlagsEnv = "GOGREP_DEFAULT_FLAGS"
+
+// debugPoisonEnv, when non-empty, poisons read buffers as they are released
+// so use-after-release bugs in formatters show up as garbage output.
+const debugPoisonEnv = "GOGREP_DEBUG_POISON"
+
+// MergeArgs builds the argument list that flag parsing runs over:
+// config file defaults, then GOGREP_DEFAULT_FLAGS, then argv (without the
+// program name), with presets expanded. Later arguments win, so the
+// command line overrides the environment, which overrides the config file.
+func MergeArgs(argv []string) ([]string, error) {
+	cf := LoadConfigFile()
+
+	envArgs, err := LoadEnvArgs()
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, 0, len(cf.Args)+len(envArgs)+len(argv))
+	args = append(args, cf.Args...)
+	args = append(args, envArgs...)
+
+	// Subcommand-style presets are only recognized at the start of argv.
+	userArgs, err := cf.ExpandPresets(argv)
+	if err != nil {
+		return nil, err
+	}
+	defaults, err := cf.expand(args, nil)
+	if err != nil {
+		return nil, err
+	}
+	return append(defaults, userArgs...), nil
+}
+
+// LoadEnvArgs splits GOGREP_DEFAULT_FLAGS into arguments using shell-like
+// quoting. Returns nil if the variable is unset or empty.
+func LoadEnvArgs() ([]string, error) {
+	v := os.Getenv(defaultFlagsEnv)
+	if strings.TrimSpace(v) == "" {
+		return nil, nil
+	}
+	args, err := splitShellWords(v)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", defaultFlagsEnv, err)
+	}
+	return args, nil
+}
+
+// splitShellWords splits s into words the way a POSIX shell would, without
+// expansion: whitespace separates words, single quotes preserve everything
+// literally, double quotes allow \" \\ \$ \` escapes, and an unquoted
+// backslash escapes the next character.
+func splitShellWords(s string) ([]string, error) {
+	var words []string
+	var cur strings.Builder
+	inWord := false
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			if inWord {
+				words = append(words, cur.String())
+				cur.Reset()
+				inWord = false
+			}
+
+		case c == '\\':
+			inWord = true
+			if i+1 >= len(s) {
+				return nil, fmt.Errorf("trailing backslash")
+			}
+			i++
+			if s[i] != '\n' {
+				cur.WriteByte(s[i])
+			}
+
+		case c == '\'':
+			inWord = true
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated single quote")
+			}
+			cur.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+
+		case c == '"':
+			inWord = true
+			i++
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) && strings.IndexByte("\"\\$`", s[i+1]) >= 0 {
+					i++
+				}
+				cur.WriteByte(s[i])
+			}
+			if i >= len(s) {
+				return nil, fmt.Errorf("unterminated double quote")
+			}
+
+		default:
+			inWord = true
+			cur.WriteByte(c)
+		}
+	}
+	if inWord {
+		words = append(words, cur.String())
+	}
+	return words, nil
+}
+
+// unescapeSeparator decodes the escapes \t, \n, \r, \\ and \xHH in a
+// --context-separator, for separators a shell makes awkward to type. Any
+// other backslash is kept as it is.
+func unescapeSeparator(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			out = append(out, s[i])
+			continue
+		}
+		switch s[i+1] {
+		case 't':
+			out = append(out, '\t')
+		case 'n':
+			out = append(out, '\n')
+		case 'r':
+			out = append(out, '\r')
+		case '\\':
+			out = append(out, '\\')
+		case 'x':
+			if i+4 > len(s) {
+				out = append(out, s[i])
+				continue
+			}
+			b, err := strconv.ParseUint(s[i+2:i+4], 16, 8)
+			if err != nil {
+				out = append(out, s[i])
+				continue
+			}
+			out = append(out, byte(b))
+			i += 2
+		default:
+			out = append(out, s[i])
+			continue
+		}
+		i++
+	}
+	return out
+}
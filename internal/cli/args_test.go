@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSplitShellWords(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"-n -e foo", []string{"-n", "-e", "foo"}},
+		{"  a \t b\n c  ", []string{"a", "b", "c"}},
+		{`'a b' "c d"`, []string{"a b", "c d"}},
+		{`'it''s' x"y"z`, []string{"its", "xyz"}},
+		{`'' ""`, []string{"", ""}},
+		// Single quotes keep backslashes; double quotes only escape \ " $ `.
+		{`'\n $x'`, []string{`\n $x`}},
+		{`"say \"hi\" \$x \\ \n"`, []string{`say "hi" $x \ \n`}},
+		{`a\ b \'c`, []string{"a b", "'c"}},
+		{"a\\\nb", []string{"ab"}},
+	}
+	for _, tt := range tests {
+		got, err := splitShellWords(tt.in)
+		if err != nil {
+			t.Errorf("splitShellWords(%q): %v", tt.in, err)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("splitShellWords(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+
+	for _, in := range []string{`'abc`, `a "b c`, `"abc\"`, `abc\`} {
+		if got, err := splitShellWords(in); err == nil {
+			t.Errorf("splitShellWords(%q) = %q, want an error", in, got)
+		}
+	}
+}
+
+func TestUnescapeSeparator(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"--", "--"},
+		{`\t|\t`, "\t|\t"},
+		{`a\nb\r\\`, "a\nb\r\\"},
+		{`\x1b[2m--\x1B[0m`, "\x1b[2m--\x1b[0m"},
+		{`\x00`, "\x00"},
+		// Not an escape: kept as typed.
+		{`\xZZ`, `\xZZ`},
+		{`\x4`, `\x4`},
+		{`\q`, `\q`},
+		{`end\`, `end\`},
+	}
+	for _, tt := range tests {
+		if got := unescapeSeparator(tt.in); string(got) != tt.want {
+			t.Errorf("unescapeSeparator(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
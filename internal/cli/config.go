@@ -1,6 +1,14 @@
 package cli
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dl/gogrep/internal/output"
+	"github.com/dl/gogrep/internal/scheduler"
+	"github.com/dl/gogrep/internal/walker"
+)
 
 // ColorMode controls when colored output is used.
 type ColorMode int
@@ -11,49 +19,428 @@ const (
 	ColorNever                   // never use color
 )
 
+// OutputFormat selects a line format other than grep's and --json's.
+type OutputFormat int
+
+const (
+	FormatText  OutputFormat = iota // grep-style text, or JSON with JSONOutput
+	FormatEmacs                     // FILE:LINE:COL:TEXT for Emacs compilation-mode and grep-mode
+	FormatJUnit                     // a JUnit XML report, each file a test case failed by its matches
+)
+
+// DirectoriesMode selects how path arguments that are directories are
+// handled without -r, like grep's -d/--directories.
+type DirectoriesMode int
+
+const (
+	DirectoriesWarn    DirectoriesMode = iota // report an error for each directory
+	DirectoriesRead                           // search the files directly inside
+	DirectoriesSkip                           // skip directories silently
+	DirectoriesRecurse                        // same as -r
+)
+
 // Config holds all configuration for a gogrep search.
 type Config struct {
 	Patterns      []string
+	FixedPatterns []string // searched as fixed strings alongside Patterns, whatever the dialect
+	PatternFiles  []string // -f: read further patterns from these files, one per line; reloaded in watch mode
+	IgnoreLines   []string // drop matching lines that also match any of these
 	Fixed         bool
 	PCRE          bool
+	BasicRegexp   bool // -G: POSIX basic regular expressions
+	ExtendedRegexp bool // -E: POSIX extended regular expressions
 	IgnoreCase    bool
+	LineRegexp    bool // -x: select only lines that a pattern matches whole
+	Multiline     bool // -U: let matches span lines
+	Symbol        bool // --symbol: match patterns only as whole identifiers
 	Recursive     bool
+	Directories   DirectoriesMode // directory arguments without -r
 	LineNumbers   bool
+	PrintPositions bool // end each matching text line with its matches' byte ranges
+	ByteOffset     bool // -b: print each line's byte offset in the file, or each match's with -o
+	NullNames      bool // -0/--null: end file names with NUL instead of ':', '-' or a newline
+	JoinAdjacent   int  // collapse runs of at least this many consecutive matching lines into one record (0 = off)
+	OnlyMatching  bool // print each match on its own line instead of the matching lines
 	CountOnly     bool
+	WordCount     bool // wc-style lines/words/bytes of matching lines
+	GroupByDir    bool // aggregate match counts per directory
+	GroupFiles    bool // with GroupByDir, list matching files under each directory
+	MaxPerDir     int  // print at most this many matching files per directory (0 = no limit)
 	Invert        bool
 	FileNamesOnly bool
+	CountFiles    bool // print only the number of files -l would list
+	PrintHash     bool // with -l, print each file's SHA-256 before its name
+	WholeFile     bool // match against each file as one string and list matching files
+	Near          []string // two patterns that must occur within Within lines of each other
+	Within        int      // with Near, the most lines between the two hits
+	First         bool // only the first matching line per file
+	MaxCount      int  // select at most this many lines per file, then print their trailing context (0 = no limit)
 	ContextBefore int
 	ContextAfter  int
+	ContextBytes  int // bytes of context around each match, for single-line files
+	ContextJoin   int // merge context groups at most this many lines apart
+	GroupSeparator   string // --context-separator: replaces "--" between context groups ("" = default)
+	NoGroupSeparator bool   // print nothing between context groups
 	WatchMode     bool
+	StateFile     string // watch mode: persist per-file read offsets here
+	Replay        bool   // watch mode: search existing content before new data
+	WatchQueue    int    // watch mode: results queued for a slow consumer (0 = write synchronously)
+	WatchDrop     bool   // with WatchQueue, drop the oldest queued result when full instead of pausing
+	SummaryInterval time.Duration // watch mode: print match counts this often instead of matching lines (0 = off)
+	WatchOnce     bool          // poll Paths every Interval and exit after the first new match
+	Interval      time.Duration // WatchOnce polling interval (0 = defaultPollInterval)
 	JSONOutput    bool
+	ContextWindow int // with JSONOutput, lines of context embedded in each match record
+	JSONStat      bool // with JSONOutput, add each file's device, inode, size, mtime and mode
+	FilterCmd     string // pipe output through this shell command
+	CRLFOutput    bool   // end output lines with \r\n
+	PathStyle     output.PathStyle // how result paths are printed
+	PathStrip     []string // directory prefixes removed from printed paths
+	PathAdd       string   // prefix joined to printed relative paths
+	Redact        output.RedactScope // replace matched text or whole lines with salted hashes
+	RedactSalt    string             // --redact key ("" = random per run)
+	Replace       string             // print each match as this template, with $1/${name} group references ("" = off)
 	Color         ColorMode
+	Format        OutputFormat // --format: emacs or junit instead of text
 	Workers       int
+	Sequential    bool // walk and search depth-first on one goroutine
+	Priority      walker.Priority // order in which walked files are searched
+	Sort          output.SortKey  // --sort/--sortr: order in which results are printed (SortNone = as searched)
+	SortReverse   bool            // --sortr: sort in descending order
+	MaxInFlight   int // with -r, files found but not yet printed before the walk pauses (0 = walker.DefaultMaxInFlight)
+	MaxDuration   time.Duration // stop walking and searching after this long (0 = no limit)
+	Nice          int                  // add this to the process's niceness before searching (0 = unchanged)
+	IONice        scheduler.IOPriority // I/O class and level for the search (zero = unchanged)
 	NoIgnore       bool
 	Hidden         bool
+	HiddenFiles    bool     // include dot-files but not dot-directories
+	HiddenDirs     bool     // descend into dot-directories
+	HiddenGlobs    []string // re-include hidden names matching these globs
 	FollowSymlinks bool
+	StopAtRepo     bool // with -r, don't descend into nested git repositories or submodules
+	SkipSubmodules bool // with -r, don't descend into submodules (directories with a .git file)
+	CanonicalPaths bool // print real paths, and search a file reached under several paths once
+	VirtualFS      bool // descend into virtual filesystems such as /proc and /sys below a root
 	SmartCase      bool
 	Globs          []string
+	Types          []string // -t: search only files of these built-in types
+	TypesNot       []string // -T: skip files of these built-in types
+	TextGlobs      []string // always treat matching files as text
+	BinaryGlobs    []string // always treat matching files as binary
+	AddBinaryExts    []string // extensions added to the table of binary ones
+	RemoveBinaryExts []string // extensions taken off the table of binary ones
+	Stats          bool // print search totals, walker counters and per-pattern totals to stderr
+	Serve          string // answer JSON search requests on this unix socket until interrupted
+	Explain        string // report which walker rule includes or excludes this path, then exit
+	Calibrate      bool   // benchmark this machine, write suggested settings to the config file, then exit
+	SelfTest       bool   // check the SIMD functions against plain ones on this CPU, print a report, then exit
+	Hints          bool // print pattern advice to stderr before searching
 	MaxColumns     int
+	DisplayWidth   bool // measure MaxColumns in terminal columns, not bytes
 	MmapThreshold  int64
+	MmapAuto       bool // --mmap-threshold auto: tune the threshold at runtime
+	DenseGap       int  // occurrence gap below which a short pattern uses Shift-Or (0 = default)
+	Debug          bool // print how each file was read to stderr
+	NoSkipHoles    bool // read holes of sparse files instead of skipping them
+	MaxReadMBps    float64 // cap file reads at this many MiB/s (0 = no limit)
+	Cache          bool // skip files ruled out by the persistent trigram cache
+	Text           bool // search binary files as text (-a)
+	BinaryMaxCount int  // max matches per binary file with -a (0 = default, -1 = no limit)
+	BinaryRaw      bool // disable -a safeguards: no match cap, NUL replacement, or column cap
+	FromLine       int   // first line to search (0 = start of file)
+	ToLine         int   // last line to search, inclusive (0 = end of file)
+	FromByte       int64 // first byte to search; negative counts from the end
+	ToByte         int64 // stop searching at this byte offset (0 = end of file)
+	LineNumberStart int   // --line-number-start: number each input's first line this (0 = 1)
+	ByteOffsetStart int64 // --line-number-start LINE:BYTE: each input's first byte offset
+	GitBlobs       string // search the files of this git revision instead of the worktree
+	DiffInput      bool   // read the input as a unified diff and search only the lines it adds
 	Paths          []string
+	Roots          []walker.RootSpec // further recursive roots, each with its own filtering options
+	RootLabels     bool              // name the walk root of each result in its output
 }
 
 // Validate checks that the config is valid and returns an error if not.
 func (c *Config) Validate() error {
-	if len(c.Patterns) == 0 {
+	if c.SelfTest {
+		if len(c.Patterns)+len(c.FixedPatterns)+len(c.PatternFiles) > 0 || len(c.Near) > 0 || c.Explain != "" || c.Calibrate || len(c.Paths) > 0 {
+			return fmt.Errorf("--self-test takes no pattern or path")
+		}
+		return nil
+	}
+	if c.Calibrate {
+		if len(c.Patterns)+len(c.FixedPatterns)+len(c.PatternFiles) > 0 || len(c.Near) > 0 || c.Explain != "" || len(c.Paths) > 1 {
+			return fmt.Errorf("--calibrate takes no pattern and at most one directory")
+		}
+		return nil
+	}
+	if c.Serve != "" && (len(c.Patterns)+len(c.FixedPatterns)+len(c.PatternFiles)+len(c.Near) > 0 || len(c.Paths) > 0 || len(c.Roots) > 0 ||
+		c.WatchMode || c.WatchOnce || c.Explain != "") {
+		return fmt.Errorf("--serve takes its patterns and roots from requests, and cannot be used with --watch, --watch-once or --explain")
+	}
+	if len(c.Patterns)+len(c.FixedPatterns)+len(c.PatternFiles) == 0 && c.Explain == "" && len(c.Near) == 0 && c.Serve == "" {
 		return fmt.Errorf("no pattern specified")
 	}
 	if c.Fixed && c.PCRE {
 		return fmt.Errorf("cannot use -F (fixed) and -P (pcre) together")
 	}
+	dialects := 0
+	for _, set := range []bool{c.Fixed, c.PCRE, c.BasicRegexp, c.ExtendedRegexp} {
+		if set {
+			dialects++
+		}
+	}
+	if dialects > 1 {
+		return fmt.Errorf("conflicting matchers specified: use only one of -F, -G, -E, -P")
+	}
+	if c.MaxCount < 0 {
+		return fmt.Errorf("invalid max count: %d", c.MaxCount)
+	}
 	if c.ContextBefore < 0 {
 		return fmt.Errorf("invalid context before: %d", c.ContextBefore)
 	}
 	if c.ContextAfter < 0 {
 		return fmt.Errorf("invalid context after: %d", c.ContextAfter)
 	}
+	if c.FromLine < 0 || c.ToLine < 0 {
+		return fmt.Errorf("invalid line range: %d-%d", c.FromLine, c.ToLine)
+	}
+	if c.ToLine > 0 && c.FromLine > c.ToLine {
+		return fmt.Errorf("--from-line %d is after --to-line %d", c.FromLine, c.ToLine)
+	}
+	if c.ToByte < 0 {
+		return fmt.Errorf("invalid --to-byte: %d", c.ToByte)
+	}
+	if c.LineNumberStart < 0 || c.ByteOffsetStart < 0 {
+		return fmt.Errorf("invalid --line-number-start: %d:%d", c.LineNumberStart, c.ByteOffsetStart)
+	}
 	if c.CountOnly && c.FileNamesOnly {
 		return fmt.Errorf("cannot use -c (count) and -l (files-with-matches) together")
 	}
+	if c.Format != FormatText && (c.JSONOutput || c.CountOnly || c.FileNamesOnly || c.CountFiles || c.WholeFile || c.GroupByDir ||
+		c.WordCount || c.SummaryInterval > 0 || c.PrintPositions || c.ByteOffset || c.RootLabels) {
+		return fmt.Errorf("cannot use --format with --json, -c, -l, --count-files, --whole-file, --group-by-dir, --count-words, --summary-interval, --print-positions, -b or --root-label")
+	}
+	if c.Format == FormatJUnit && (c.WatchMode || c.WatchOnce) {
+		return fmt.Errorf("cannot use --format=junit with --watch or --watch-once")
+	}
+	if c.CountFiles && (c.CountOnly || c.JSONOutput || c.OnlyMatching || c.GroupByDir || c.WordCount || c.PrintHash || c.WatchMode || c.WatchOnce) {
+		return fmt.Errorf("cannot use --count-files with -c, --json, -o, --group-by-dir, --count-words, --print-hash, --watch or --watch-once")
+	}
+	if c.PrintHash && (!(c.FileNamesOnly || c.WholeFile) || c.JSONOutput || c.WatchMode) {
+		return fmt.Errorf("--print-hash requires -l or --whole-file, and cannot be used with --json or --watch")
+	}
+	if c.WatchOnce {
+		if c.WatchMode || c.Recursive || len(c.Roots) > 0 {
+			return fmt.Errorf("cannot use --watch-once with --watch, -r or per-root options")
+		}
+		if len(c.Paths) == 0 {
+			return fmt.Errorf("--watch-once needs files to poll")
+		}
+	}
+	if c.Interval < 0 || (c.Interval > 0 && !c.WatchOnce) {
+		return fmt.Errorf("--interval must be positive and requires --watch-once")
+	}
+	if c.WatchQueue < 0 || (c.WatchQueue > 0 && !c.WatchMode) || (c.WatchDrop && c.WatchQueue == 0) {
+		return fmt.Errorf("--watch-queue must be positive and requires --watch; --watch-drop requires --watch-queue")
+	}
+	if c.WatchQueue > 0 && c.StateFile != "" {
+		// Offsets are saved once output is written; a queue would save
+		// them ahead of it.
+		return fmt.Errorf("cannot use --watch-queue with --state-file")
+	}
+	if c.SummaryInterval < 0 || (c.SummaryInterval > 0 && !c.WatchMode) {
+		return fmt.Errorf("--summary-interval must be positive and requires --watch")
+	}
+	if c.SummaryInterval > 0 && (c.JSONOutput || c.CountOnly || c.FileNamesOnly || c.OnlyMatching || c.GroupByDir || c.WordCount || c.PrintPositions || c.ByteOffset) {
+		return fmt.Errorf("cannot use --summary-interval with --json, -c, -l, -o, --group-by-dir, --count-words or --print-positions")
+	}
+	if (c.StateFile != "" || c.Replay) && !c.WatchMode {
+		return fmt.Errorf("--state-file and --replay require --watch")
+	}
+	if c.DenseGap < 0 {
+		return fmt.Errorf("--dense-gap must be non-negative")
+	}
+	if c.MaxDuration < 0 {
+		return fmt.Errorf("invalid --max-duration: %v", c.MaxDuration)
+	}
+	if c.ContextJoin < 0 {
+		return fmt.Errorf("--context-join must be non-negative")
+	}
+	if c.ContextBytes < 0 {
+		return fmt.Errorf("--context-bytes must be non-negative")
+	}
+	if c.ContextBytes > 0 && (c.ContextBefore > 0 || c.ContextAfter > 0) {
+		return fmt.Errorf("cannot use --context-bytes with -A, -B or -C")
+	}
+	if c.Symbol && (c.LineRegexp || c.Multiline || c.WholeFile || len(c.Near) > 0 || c.Replace != "") {
+		return fmt.Errorf("cannot use --symbol with -x, -U, --whole-file, --near or --replace")
+	}
+	if c.LineRegexp && c.WholeFile {
+		return fmt.Errorf("cannot use -x with --whole-file")
+	}
+	if c.Multiline && (c.Invert || c.LineRegexp || c.WholeFile || len(c.Near) > 0 || c.WatchMode || c.WatchOnce ||
+		len(c.IgnoreLines) > 0 || c.Replace != "" || c.Redact != output.RedactNone || c.ContextWindow > 0 ||
+		c.ContextBefore > 0 || c.ContextAfter > 0 || c.ContextBytes > 0) {
+		return fmt.Errorf("cannot use -U with -v, -x, --whole-file, --near, --watch, --watch-once, --ignore-line, --replace, --redact or context options")
+	}
+	if c.WholeFile && (c.PCRE || c.CountOnly || c.GroupByDir || c.WatchMode || len(c.IgnoreLines) > 0 ||
+		c.ContextBefore > 0 || c.ContextAfter > 0 || c.ContextBytes > 0) {
+		return fmt.Errorf("cannot use --whole-file with -P, -c, --group-by-dir, --watch, --ignore-line or context options")
+	}
+	if len(c.Near) > 0 {
+		if len(c.Near) != 2 {
+			return fmt.Errorf("--near takes exactly two patterns, got %d", len(c.Near))
+		}
+		if c.Within < 0 {
+			return fmt.Errorf("--within must be >= 0")
+		}
+		if len(c.Patterns)+len(c.FixedPatterns)+len(c.PatternFiles) > 0 {
+			return fmt.Errorf("cannot give a pattern with --near")
+		}
+		if c.Invert || c.WholeFile || c.WatchMode || c.ContextBefore > 0 || c.ContextAfter > 0 || c.ContextBytes > 0 {
+			return fmt.Errorf("cannot use --near with -v, --whole-file, --watch or context options")
+		}
+	}
+	if c.ContextWindow < 0 {
+		return fmt.Errorf("--with-context-window must be non-negative")
+	}
+	if c.ContextWindow > 0 && (!c.JSONOutput || c.FileNamesOnly || c.CountOnly || c.WatchMode) {
+		return fmt.Errorf("--with-context-window requires --json, and cannot be used with -l, -c or --watch")
+	}
+	if c.JSONStat && (!c.JSONOutput || c.WatchMode) {
+		return fmt.Errorf("--stat requires --json and cannot be used with --watch")
+	}
+	if c.RedactSalt != "" && c.Redact == output.RedactNone {
+		return fmt.Errorf("--redact-salt requires --redact")
+	}
+	if c.Replace != "" && c.Redact != output.RedactNone {
+		return fmt.Errorf("cannot use --replace with --redact")
+	}
+	if c.Redact == output.RedactLine && c.ContextWindow > 0 {
+		return fmt.Errorf("cannot use --redact line with --with-context-window")
+	}
+	if c.PathStyle == output.PathBasename && (len(c.PathStrip) > 0 || c.PathAdd != "") {
+		return fmt.Errorf("cannot use --path-prefix-strip or --path-prefix-add with --path-style=basename")
+	}
+	for _, p := range c.PathStrip {
+		if p == "" {
+			return fmt.Errorf("--path-prefix-strip must not be empty")
+		}
+	}
+	if c.PathStyle == output.PathBasename && c.GroupByDir {
+		return fmt.Errorf("cannot use --path-style=basename with --group-by-dir")
+	}
+	if c.GroupByDir && (c.FileNamesOnly || c.WordCount || c.JSONOutput) {
+		return fmt.Errorf("cannot use --group-by-dir with -l, --count-words or --json")
+	}
+	if c.OnlyMatching && (c.Invert || c.CountOnly || c.FileNamesOnly || c.GroupByDir || c.WordCount || c.WholeFile ||
+		c.ContextBefore > 0 || c.ContextAfter > 0 || c.ContextBytes > 0) {
+		return fmt.Errorf("cannot use -o with -v, -c, -l, --group-by-dir, --count-words, --whole-file or context options")
+	}
+	if c.PrintPositions && (c.JSONOutput || c.CountOnly || c.FileNamesOnly || c.GroupByDir || c.WordCount) {
+		return fmt.Errorf("--print-positions prints with matching lines, not with --json, -c, -l, --group-by-dir or --count-words")
+	}
+	if c.ByteOffset && (c.JSONOutput || c.CountOnly || c.FileNamesOnly || c.GroupByDir || c.WordCount) {
+		return fmt.Errorf("-b prints with matching lines, not with --json, -c, -l, --group-by-dir or --count-words")
+	}
+	if c.NullNames && (c.JSONOutput || c.Format != FormatText || c.CountFiles || c.GroupByDir || c.WordCount || c.SummaryInterval > 0) {
+		return fmt.Errorf("--null applies to text output, not --json, --format, --count-files, --group-by-dir, --count-words or --summary-interval")
+	}
+	if c.JoinAdjacent < 0 || c.JoinAdjacent == 1 {
+		return fmt.Errorf("--join-adjacent must be at least 2")
+	}
+	if c.JoinAdjacent > 0 && (c.JSONOutput || c.Format != FormatText || c.CountFiles || c.GroupByDir || c.WordCount || c.SummaryInterval > 0 ||
+		c.CountOnly || c.FileNamesOnly || c.WholeFile || c.OnlyMatching || c.Multiline) {
+		return fmt.Errorf("--join-adjacent applies to text output of lines, not --json, --format, --count-files, --group-by-dir, --count-words, --summary-interval, -c, -l, --whole-file, -o or -U")
+	}
+	if c.MaxPerDir < 0 {
+		return fmt.Errorf("--max-per-dir must be positive")
+	}
+	if c.MaxPerDir > 0 && (c.JSONOutput || c.Format == FormatJUnit || c.CountFiles || c.GroupByDir || c.WordCount || c.SummaryInterval > 0 ||
+		c.WatchMode || c.WatchOnce) {
+		return fmt.Errorf("cannot use --max-per-dir with --json, --format junit, --count-files, --group-by-dir, --count-words, --summary-interval, --watch or --watch-once")
+	}
+	if c.WordCount && (c.CountOnly || c.FileNamesOnly) {
+		return fmt.Errorf("cannot use --count-lines/--count-words with -c or -l")
+	}
+	if c.Sort != output.SortNone && (c.Sequential || c.WatchMode || c.WatchOnce || c.Priority != walker.PriorityWalk) {
+		return fmt.Errorf("cannot use --sort or --sortr with --sequential, --watch, --watch-once or --priority")
+	}
+	if c.SortReverse && c.Sort == output.SortNone {
+		return fmt.Errorf("--sortr needs a sort key")
+	}
+	if c.Priority != walker.PriorityWalk && (c.Sequential || c.WatchMode) {
+		return fmt.Errorf("cannot use --priority with --sequential or --watch")
+	}
+	if c.MaxInFlight < 0 {
+		return fmt.Errorf("--max-inflight must be >= 0")
+	}
+	if io := c.IONice; io.Class < scheduler.IOClassNone || io.Class > scheduler.IOClassIdle || io.Level < 0 || io.Level > 7 {
+		return fmt.Errorf("invalid --ionice: class %d, level %d", io.Class, io.Level)
+	}
+	if c.MaxReadMBps < 0 {
+		return fmt.Errorf("--max-read-mbps must be non-negative")
+	}
+	if c.MaxInFlight > 0 && (c.Sequential || c.WatchMode) {
+		return fmt.Errorf("cannot use --max-inflight with --sequential or --watch")
+	}
+	if c.GitBlobs != "" && (c.WatchMode || c.WatchOnce || c.Recursive || c.Sequential || c.Cache || len(c.Roots) > 0) {
+		return fmt.Errorf("cannot use --git-blobs with --watch, --watch-once, -r, --sequential, --cache or per-root options")
+	}
+	if c.DiffInput && (c.ContextBefore > 0 || c.ContextAfter > 0 || c.ContextBytes > 0 || c.ContextWindow > 0 ||
+		c.Multiline || c.WholeFile || len(c.Near) > 0 || c.PrintHash || c.Recursive || len(c.Roots) > 0 || c.GitBlobs != "" ||
+		c.WatchMode || c.WatchOnce || c.Serve != "" || c.Sort != output.SortNone) {
+		return fmt.Errorf("cannot use --diff-input with context options, -U, --whole-file, --near, --print-hash, -r, --git-blobs, --watch, --watch-once, --serve or --sort")
+	}
+	if c.CanonicalPaths && (c.WatchMode || c.WatchOnce || c.GitBlobs != "") {
+		return fmt.Errorf("cannot use --canonical-paths with --watch, --watch-once or --git-blobs")
+	}
+	if len(c.Roots) > 0 && c.WatchMode {
+		return fmt.Errorf("cannot use per-root options with --watch")
+	}
+	if c.RootLabels && (!(c.Recursive || c.Directories == DirectoriesRecurse || len(c.Roots) > 0) ||
+		c.WatchMode || c.GroupByDir || c.WordCount) {
+		return fmt.Errorf("--root-label requires -r, and cannot be used with --watch, --group-by-dir or --count-words")
+	}
+	if _, err := walker.TypeFilterGlobs(c.Types, c.TypesNot); err != nil {
+		return err
+	}
+	if err := validateGlobs(c.Globs, c.HiddenGlobs, c.TextGlobs, c.BinaryGlobs); err != nil {
+		return err
+	}
+	for _, spec := range c.Roots {
+		o := spec.Options
+		var text, binary []string
+		if o.Binary != nil {
+			text, binary = o.Binary.TextGlobs, o.Binary.BinaryGlobs
+		}
+		if err := validateGlobs(o.Globs, o.HiddenGlobs, text, binary); err != nil {
+			return fmt.Errorf("%s: %w", spec.Path, err)
+		}
+	}
+	return nil
+}
+
+// validateGlobs checks the patterns of each glob option.
+func validateGlobs(globs, hidden, text, binary []string) error {
+	for _, set := range []struct {
+		flag  string
+		globs []string
+	}{
+		{"--glob", globs},
+		{"--hidden-glob", hidden},
+		{"--text-glob", text},
+		{"--binary-glob", binary},
+	} {
+		for _, g := range set.globs {
+			if set.flag == "--glob" {
+				g = strings.TrimPrefix(g, "!")
+			}
+			if err := walker.ValidateGlob(g); err != nil {
+				return fmt.Errorf("invalid %s %q: %v", set.flag, g, err)
+			}
+		}
+	}
 	return nil
 }
@@ -2,39 +2,247 @@ package cli
 
 import (
 	"bufio"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
-// LoadConfigArgs reads the gogrep config file and returns parsed arguments.
-// Config file location: GOGREP_CONFIG_PATH env var, or ~/.gogrep.
-// Format: one flag per line, # comments, empty lines ignored.
-// Returns nil if no config file found.
-func LoadConfigArgs() []string {
-	path := os.Getenv("GOGREP_CONFIG_PATH")
+// ConfigFile holds the parsed contents of the gogrep config file.
+type ConfigFile struct {
+	// Args are the global default arguments (lines before any preset header).
+	Args []string
+	// Presets maps a preset name to its arguments (patterns and flags).
+	Presets map[string][]string
+}
+
+// ConfigPath returns the config file location: GOGREP_CONFIG_PATH env var,
+// or ~/.gogrep. Returns "" if neither is known.
+func ConfigPath() string {
+	if path := os.Getenv("GOGREP_CONFIG_PATH"); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".gogrep")
+}
+
+// LoadConfigFile reads and parses the gogrep config file.
+// Config file location: see ConfigPath.
+// Returns an empty ConfigFile if no config file is found.
+func LoadConfigFile() ConfigFile {
+	path := ConfigPath()
 	if path == "" {
-		home, err := os.UserHomeDir()
-		if err != nil {
-			return nil
-		}
-		path = filepath.Join(home, ".gogrep")
+		return ConfigFile{}
 	}
 
 	f, err := os.Open(path)
 	if err != nil {
-		return nil
+		return ConfigFile{}
 	}
 	defer f.Close()
 
-	var args []string
-	scanner := bufio.NewScanner(f)
+	return parseConfigFile(f)
+}
+
+// LoadConfigArgs reads the gogrep config file and returns parsed arguments.
+// Format: one flag per line, # comments, empty lines ignored.
+// Returns nil if no config file found.
+func LoadConfigArgs() []string {
+	return LoadConfigFile().Args
+}
+
+// parseConfigFile parses the config format: one argument per line, # comments
+// and empty lines ignored. A "[NAME]" line starts a preset; the lines that
+// follow (until the next header) are that preset's arguments:
+//
+//	--smart-case
+//
+//	[todo]
+//	-n
+//	-e
+//	TODO|FIXME|XXX
+func parseConfigFile(r io.Reader) ConfigFile {
+	var cf ConfigFile
+	var preset string
+
+	scanner := bufio.NewScanner(r)
 	for scanner.Scan() {
 		line := strings.TrimSpace(scanner.Text())
 		if line == "" || strings.HasPrefix(line, "#") {
 			continue
 		}
-		args = append(args, line)
+		if len(line) > 2 && line[0] == '[' && line[len(line)-1] == ']' {
+			preset = strings.TrimSpace(line[1 : len(line)-1])
+			if cf.Presets == nil {
+				cf.Presets = make(map[string][]string)
+			}
+			if _, ok := cf.Presets[preset]; !ok {
+				cf.Presets[preset] = []string{}
+			}
+			continue
+		}
+		if preset == "" {
+			cf.Args = append(cf.Args, line)
+		} else {
+			cf.Presets[preset] = append(cf.Presets[preset], line)
+		}
+	}
+	return cf
+}
+
+// valueFlags maps each option that takes its value as the next argument
+// to the number of arguments it takes. An "@NAME" in one of those slots is
+// the option's value, as in -e @todo, and is not expanded.
+var valueFlags = map[string]int{
+	"-e": 1, "--regexp": 1, "-f": 1, "--file": 1, "--fixed-pattern": 1,
+	"--ignore-line": 1, "--near": 2, "--within": 1, "--join-adjacent": 1,
+	"--path-style": 1, "--path-prefix-strip": 1, "--path-prefix-add": 1,
+	"--redact": 1, "--redact-salt": 1, "--replace": 1, "--max-per-dir": 1,
+	"-m": 1, "--max-count": 1, "--color": 1, "--colour": 1,
+	"-M": 1, "--max-columns": 1, "--format": 1, "--mmap-threshold": 1,
+	"--dense-gap": 1, "--with-context-window": 1,
+	"-B": 1, "--before-context": 1, "-A": 1, "--after-context": 1,
+	"-C": 1, "--context": 1, "--context-separator": 1, "--context-join": 1,
+	"--context-bytes": 1, "--from-line": 1, "--to-line": 1,
+	"--from-byte": 1, "--to-byte": 1, "--line-number-start": 1,
+	"-d": 1, "--directories": 1, "-g": 1, "--glob": 1,
+	"-t": 1, "--type": 1, "-T": 1, "--type-not": 1, "--hidden-glob": 1,
+	"--binary-max-count": 1, "--text-glob": 1, "--binary-glob": 1,
+	"--add-binary-ext": 1, "--remove-binary-ext": 1, "--priority": 1,
+	"--sort": 1, "--sortr": 1, "--max-inflight": 1, "--git-blobs": 1,
+	"-j": 1, "--threads": 1, "--nice": 1, "--ionice": 1,
+	"--max-read-mbps": 1, "--max-duration": 1, "--explain": 1,
+	"--filter-cmd": 1, "--interval": 1, "--watch-queue": 1,
+	"--state-file": 1, "--summary-interval": 1, "--serve": 1,
+}
+
+// ExpandPresets replaces preset references in args with the preset's
+// arguments. A preset is referenced as "@NAME" anywhere before "--" except
+// as an option's value (see valueFlags), or subcommand-style as the first
+// argument when it names a defined preset (gogrep todo ./src). Presets may
+// reference other presets. An "@NAME" that names no preset, such as the
+// pattern @Override, is kept as it is. Returns an error for a preset
+// cycle.
+func (cf ConfigFile) ExpandPresets(args []string) ([]string, error) {
+	if len(args) > 0 {
+		if _, ok := cf.Presets[args[0]]; ok {
+			args = append([]string{"@" + args[0]}, args[1:]...)
+		}
+	}
+	return cf.expand(args, nil)
+}
+
+func (cf ConfigFile) expand(args []string, active []string) ([]string, error) {
+	out := make([]string, 0, len(args))
+	values := 0 // arguments left that are an option's value
+	for i, arg := range args {
+		if values > 0 {
+			values--
+			out = append(out, arg)
+			continue
+		}
+		if arg == "--" {
+			return append(out, args[i:]...), nil
+		}
+		if len(arg) < 2 || arg[0] != '@' {
+			values = valueFlags[arg]
+			out = append(out, arg)
+			continue
+		}
+
+		name := arg[1:]
+		preset, ok := cf.Presets[name]
+		if !ok {
+			out = append(out, arg)
+			continue
+		}
+		for _, a := range active {
+			if a == name {
+				return nil, fmt.Errorf("preset cycle: %s -> %s", strings.Join(active, " -> "), name)
+			}
+		}
+		expanded, err := cf.expand(preset, append(active, name))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, expanded...)
+	}
+	return out, nil
+}
+
+// Markers around the settings written by --calibrate, so a new calibration
+// replaces the last one and leaves the rest of the file alone.
+const (
+	calibrateBegin = "# --calibrate begin"
+	calibrateEnd   = "# --calibrate end"
+)
+
+// WriteCalibration writes args, one per line, to the config file as its
+// calibration block, replacing an earlier one. The block goes at the top,
+// among the global defaults; arguments further down, and on the command
+// line, still override it. Returns the path written.
+func WriteCalibration(args []string, when time.Time) (string, error) {
+	path := ConfigPath()
+	if path == "" {
+		return "", fmt.Errorf("no config file location: set GOGREP_CONFIG_PATH or HOME")
+	}
+	old, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	content := replaceCalibration(string(old), args, when)
+
+	// Write a sibling and rename it over the file, so an interrupted write
+	// never leaves a truncated config behind.
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".gogrep-config-")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(content); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if fi, err := os.Stat(path); err == nil {
+		os.Chmod(tmp.Name(), fi.Mode().Perm())
+	} else {
+		os.Chmod(tmp.Name(), 0o644)
+	}
+	return path, os.Rename(tmp.Name(), path)
+}
+
+// replaceCalibration returns content with its calibration block, if any,
+// removed and a new one holding args put first.
+func replaceCalibration(content string, args []string, when time.Time) string {
+	var b strings.Builder
+	b.WriteString(calibrateBegin + "\n")
+	fmt.Fprintf(&b, "# measured on %s; edit or remove freely\n", when.Format(time.DateOnly))
+	for _, a := range args {
+		b.WriteString(a + "\n")
+	}
+	b.WriteString(calibrateEnd + "\n")
+
+	inBlock := false
+	for _, line := range strings.SplitAfter(content, "\n") {
+		switch strings.TrimSpace(line) {
+		case calibrateBegin:
+			inBlock = true
+			continue
+		case calibrateEnd:
+			inBlock = false
+			continue
+		}
+		if !inBlock {
+			b.WriteString(line)
+		}
 	}
-	return args
+	return b.String()
 }
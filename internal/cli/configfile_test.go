@@ -0,0 +1,57 @@
+package cli
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+const testConfig = `--smart-case
+
+[todo]
+-n
+-e
+TODO|FIXME
+@loud
+
+[loud]
+--color=always
+
+[loop]
+@loop
+`
+
+func TestExpandPresets(t *testing.T) {
+	cf := parseConfigFile(strings.NewReader(testConfig))
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"@todo", "src"}, []string{"-n", "-e", "TODO|FIXME", "--color=always", "src"}},
+		{[]string{"todo", "src"}, []string{"-n", "-e", "TODO|FIXME", "--color=always", "src"}},
+		// Not a preset: a pattern like a Java annotation.
+		{[]string{"@Override", "src"}, []string{"@Override", "src"}},
+		// An option's value is never a preset reference.
+		{[]string{"-e", "@todo", "src"}, []string{"-e", "@todo", "src"}},
+		{[]string{"--glob", "@todo", "@todo"}, []string{"--glob", "@todo", "-n", "-e", "TODO|FIXME", "--color=always"}},
+		{[]string{"--near", "@todo", "@loud", "src"}, []string{"--near", "@todo", "@loud", "src"}},
+		// "--" as -e's value is the pattern, not the end of options.
+		{[]string{"-e", "--", "@loud"}, []string{"-e", "--", "--color=always"}},
+		{[]string{"-n", "--", "@todo"}, []string{"-n", "--", "@todo"}},
+		{[]string{"@"}, []string{"@"}},
+	}
+	for _, tt := range tests {
+		got, err := cf.ExpandPresets(tt.args)
+		if err != nil {
+			t.Errorf("ExpandPresets(%q): %v", tt.args, err)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("ExpandPresets(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+
+	if _, err := cf.ExpandPresets([]string{"@loop"}); err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Errorf("ExpandPresets(@loop) error = %v, want a cycle", err)
+	}
+}
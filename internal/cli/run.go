@@ -1,15 +1,28 @@
 package cli
 
 import (
+	"crypto/rand"
 	"fmt"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
 	"sync/atomic"
+	"syscall"
+	"time"
 	"unicode"
+	"unicode/utf8"
 
+	"github.com/dl/gogrep/internal/cache"
+	"github.com/dl/gogrep/internal/calibrate"
+	"github.com/dl/gogrep/internal/gitblob"
 	"github.com/dl/gogrep/internal/input"
 	"github.com/dl/gogrep/internal/matcher"
 	"github.com/dl/gogrep/internal/output"
 	"github.com/dl/gogrep/internal/scheduler"
+	"github.com/dl/gogrep/internal/simd"
 	"github.com/dl/gogrep/internal/walker"
 	"github.com/dl/gogrep/internal/watch"
 )
@@ -19,35 +32,216 @@ func logWarn(format string, args ...any) {
 	fmt.Fprintf(os.Stderr, "gogrep: "+format+"\n", args...)
 }
 
+// lowerPriority applies --nice and --ionice to the whole process, before
+// any worker starts. A setting that is not permitted, or not supported, is
+// reported and the search goes on.
+func lowerPriority(cfg Config) {
+	if cfg.Nice != 0 {
+		if err := scheduler.SetNice(cfg.Nice); err != nil {
+			logWarn("--nice: %v", err)
+		}
+	}
+	if cfg.IONice.Class != scheduler.IOClassNone {
+		if err := scheduler.SetIOPriority(cfg.IONice); err != nil {
+			logWarn("--ionice: %v", err)
+		}
+	}
+}
+
 // searchMode determines the fast path in searchReader.
 type searchMode int
 
 const (
 	searchFull      searchMode = iota // full match extraction
 	searchFilesOnly                   // just check if any match exists
+	searchFilesHash                   // searchFilesOnly, plus the content hash of matching files
 	searchCountOnly                   // count matching lines, skip line extraction
+	searchFirst                       // stop at the first matching line
 )
 
-// Run executes the search with the given config.
-// Returns exit code: 0 = match found, 1 = no match, 2 = error.
-func Run(cfg Config) int {
-	// Smart case: if enabled and all patterns are lowercase, enable case-insensitive
-	if cfg.SmartCase && !cfg.IgnoreCase {
-		allLower := true
-		for _, p := range cfg.Patterns {
-			for _, r := range p {
-				if unicode.IsUpper(r) {
-					allLower = false
-					break
-				}
-			}
-			if !allLower {
-				break
-			}
+// binaryPolicy controls how files detected as binary are handled.
+type binaryPolicy struct {
+	search     bool                 // search binary files instead of skipping them (-a)
+	maxMatches int                  // cap on matches kept per binary file (0 = no cap)
+	paths      *walker.BinaryPolicy // --text-glob/--binary-glob overrides (nil = none)
+}
+
+// repoBoundary returns where a recursive walk stops for nested
+// repositories.
+func repoBoundary(cfg Config) walker.RepoBoundary {
+	switch {
+	case cfg.StopAtRepo:
+		return walker.StopAtRepos
+	case cfg.SkipSubmodules:
+		return walker.StopAtSubmodules
+	}
+	return walker.DescendRepos
+}
+
+// canonical returns the resolver for --canonical-paths, or nil.
+func canonical(cfg Config) *walker.Canonical {
+	if !cfg.CanonicalPaths {
+		return nil
+	}
+	return walker.NewCanonical()
+}
+
+// canonicalPaths replaces each of paths by its real path and drops those
+// that resolve to a file listed before them.
+func canonicalPaths(paths []string) []string {
+	c := walker.NewCanonical()
+	out := paths[:0:0]
+	for _, p := range paths {
+		if real, first := c.Resolve(p); first {
+			out = append(out, real)
 		}
-		if allLower {
-			cfg.IgnoreCase = true
+	}
+	return out
+}
+
+// dropOutput removes from paths, with a warning, the file output goes to:
+// searching it would read back the results.
+func dropOutput(paths []string, out walker.FileID) []string {
+	kept := paths[:0:0]
+	for _, p := range paths {
+		if out.Matches(p) {
+			logWarn("%s: input file is also the output", p)
+			continue
 		}
+		kept = append(kept, p)
+	}
+	return kept
+}
+
+// binaryOverrides returns the --text-glob/--binary-glob policy, or nil.
+func binaryOverrides(cfg Config) *walker.BinaryPolicy {
+	if len(cfg.TextGlobs) == 0 && len(cfg.BinaryGlobs) == 0 {
+		return nil
+	}
+	return &walker.BinaryPolicy{TextGlobs: cfg.TextGlobs, BinaryGlobs: cfg.BinaryGlobs}
+}
+
+// filesOnlyBatch is the output chunk size for -l in recursive searches:
+// one pipe buffer's worth of paths per writev.
+const filesOnlyBatch = 64 << 10
+
+// defaultBinaryMaxMatches is the per-file match cap for -a on binary files.
+const defaultBinaryMaxMatches = 100
+
+// defaultPollInterval is how often --watch-once re-reads its files.
+const defaultPollInterval = time.Second
+
+// exitBudget is the exit code when --max-duration cut the search short.
+const exitBudget = 3
+
+// exitBrokenPipe is the exit code when stdout was closed under the search,
+// as by `| head`: 128+SIGPIPE, the status a shell shows for a grep killed
+// by the signal.
+const exitBrokenPipe = 141
+
+// searchBudget is the --max-duration deadline and how far the search got
+// before it expired.
+type searchBudget struct {
+	done     <-chan struct{} // closed when time is up (nil = no budget)
+	stop     <-chan struct{} // closed when time is up or the output is closed
+	searched int             // files searched
+	dropped  int             // files found but not searched
+}
+
+func (b *searchBudget) expired() bool {
+	select {
+	case <-b.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// stopped reports whether the search should take no more files.
+func (b *searchBudget) stopped() bool {
+	select {
+	case <-b.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// stdoutClosed reports whether the search ended because nothing reads its
+// output any more. A --filter command that exits early is not counted:
+// its exit status is reported instead.
+func stdoutClosed(w *output.Writer, cfg Config) bool {
+	return cfg.FilterCmd == "" && w.IsClosed()
+}
+
+// Run executes the search with the given config.
+// Returns exit code: 0 = match found, 1 = no match, 2 = error,
+// 3 = --max-duration expired (output is partial), 141 = stdout was closed.
+func Run(cfg Config) (exit int) {
+	start := time.Now()
+	if os.Getenv(debugPoisonEnv) != "" {
+		input.SetPoison(true)
+	}
+	if cfg.SelfTest {
+		return runSelfTest()
+	}
+	if cfg.Calibrate {
+		return runCalibrate(cfg)
+	}
+	matcher.SetDenseGap(cfg.DenseGap)
+	if err := walker.SetBinaryExtensions(cfg.AddBinaryExts, cfg.RemoveBinaryExts); err != nil {
+		logWarn("%v", err)
+		return 2
+	}
+	if cfg.Directories == DirectoriesRecurse || len(cfg.Roots) > 0 {
+		cfg.Recursive = true
+	}
+	if cfg.Serve != "" {
+		// Each request brings its own patterns, root and types.
+		return runServe(cfg)
+	}
+	if len(cfg.Types)+len(cfg.TypesNot) > 0 {
+		// A file type is a named set of --glob patterns.
+		globs, err := walker.TypeFilterGlobs(cfg.Types, cfg.TypesNot)
+		if err != nil {
+			logWarn("%v", err)
+			return 2
+		}
+		cfg.Globs = append(globs, cfg.Globs...)
+	}
+	if cfg.Format != FormatText {
+		// Both formats locate matches by line number.
+		cfg.LineNumbers = true
+	}
+	if cfg.DiffInput {
+		// Matches are reported at their line in the new file.
+		cfg.LineNumbers = true
+	}
+	if cfg.WholeFile || cfg.CountFiles {
+		// A file matches as a whole, or is only counted; there are no
+		// lines to print.
+		cfg.FileNamesOnly = true
+	}
+	if cfg.Explain != "" {
+		return runExplain(cfg)
+	}
+	lowerPriority(cfg)
+	if len(cfg.Near) > 0 {
+		// Prefilters, hints and --stats see the two patterns as usual.
+		cfg.Patterns = cfg.Near
+	}
+
+	dialect := matcher.DialectDefault
+	switch {
+	case cfg.BasicRegexp:
+		dialect = matcher.DialectBasic
+	case cfg.ExtendedRegexp:
+		dialect = matcher.DialectExtended
+	}
+	base := cfg // patterns as given, for watch mode to reload -f files
+	if err := resolvePatterns(&cfg, dialect); err != nil {
+		logWarn("%v", err)
+		return 2
 	}
 
 	// Resolve maxCols for matcher
@@ -55,23 +249,61 @@ func Run(cfg Config) int {
 	if maxCols == 0 {
 		maxCols = 75
 	}
-	if maxCols < 0 {
-		maxCols = 0 // -1 from CLI means no limit
+	if maxCols < 0 || cfg.WordCount || cfg.ContextBytes > 0 || (cfg.JSONOutput && cfg.MaxColumns == 0) {
+		// -1 from CLI means no limit; wc counts need full lines; byte
+		// context windows are already the requested size; JSON records
+		// carry whole lines unless -M asks for less.
+		maxCols = 0
+	}
+
+	// Matchers cut snippets by bytes. In display-width mode a column can take
+	// up to utf8.UTFMax bytes, so widen the snippet window accordingly.
+	snippetCols := maxCols
+	if cfg.DisplayWidth {
+		snippetCols = maxCols * utf8.UTFMax
+	}
+	if cfg.ContextBytes > 0 {
+		snippetCols = cfg.ContextBytes + matcher.ByteContextSlack
 	}
 
 	// Create matcher
-	m, err := matcher.NewMatcher(cfg.Patterns, cfg.Fixed, cfg.PCRE, cfg.IgnoreCase, cfg.Invert, matcher.MatcherOpts{
-		MaxCols:      maxCols,
-		NeedLineNums: cfg.LineNumbers,
-	})
+	var m matcher.Matcher
+	var err error
+	switch {
+	case cfg.WholeFile:
+		m, err = matcher.NewWholeFileMatcher(cfg.Patterns, cfg.Fixed, cfg.IgnoreCase, cfg.Invert, dialect)
+	case len(cfg.Near) > 0:
+		m, err = newNearMatcher(cfg, dialect, !cfg.NoGroupSeparator || cfg.JSONOutput)
+	default:
+		m, err = newLineMatcher(cfg, dialect, snippetCols)
+	}
 	if err != nil {
 		logWarn("invalid pattern: %v", err)
 		return 2
 	}
+	ign, err := newIgnoreMatcher(cfg, dialect)
+	if err != nil {
+		logWarn("invalid --ignore-line pattern: %v", err)
+		return 2
+	}
+	if ign != nil {
+		m = matcher.NewIgnoreLineMatcher(m, ign)
+	}
 
-	// Wrap with context if needed (not for watch mode — watch handles context via streaming)
-	if !cfg.WatchMode {
-		m = matcher.NewContextMatcher(m, cfg.ContextBefore, cfg.ContextAfter)
+	// Per-pattern totals for --stats: only meaningful with several
+	// patterns, and not with -v, where lines match none of them.
+	var pstats *matcher.PatternStats
+	if cfg.Stats && !cfg.WatchMode && !cfg.WholeFile {
+		if pstats, err = newPatternStats(cfg, dialect, ign); err != nil {
+			logWarn("invalid pattern: %v", err)
+			return 2
+		}
+		m = matcher.NewPatternStatsMatcher(m, pstats)
+	}
+	if cfg.Hints {
+		for _, h := range matcher.PatternHints(cfg.Patterns, cfg.Fixed, cfg.PCRE, dialect) {
+			logWarn("hint: %s", h)
+		}
 	}
 
 	// Determine color mode
@@ -82,50 +314,434 @@ func Run(cfg Config) int {
 	case ColorNever:
 		useColor = false
 	case ColorAuto:
-		useColor = output.StdoutIsTerminal()
+		// A filter command reads from a pipe, not the terminal.
+		useColor = cfg.FilterCmd == "" && output.StdoutIsTerminal()
+	}
+
+	// Wrap with context if needed. Watch mode searches appended chunks
+	// through a ContextMatcher's Stream, which carries context lines, line
+	// numbers and byte offsets from one chunk to the next.
+	m = matcher.NewByteContextMatcher(m, cfg.ContextBytes)
+
+	var watchCtx *matcher.ContextMatcher
+	configureContext := func(cm *matcher.ContextMatcher) {
+		cm.SetHighlightContext(useColor)
+		cm.SetJoinGap(cfg.ContextJoin)
+		// JSON derives its block records from the separators.
+		cm.SetSeparators(!cfg.NoGroupSeparator || cfg.JSONOutput)
+		// The last line -m allows keeps its trailing context, matching
+		// lines printed as context, so context applies the limit.
+		cm.SetMaxCount(cfg.MaxCount)
+	}
+	if cfg.WatchMode {
+		watchCtx = matcher.NewStreamContextMatcher(m, cfg.ContextBefore, cfg.ContextAfter)
+		configureContext(watchCtx)
+	} else {
+		m = matcher.NewContextMatcher(m, cfg.ContextBefore, cfg.ContextAfter)
+		if cm, ok := m.(*matcher.ContextMatcher); ok {
+			configureContext(cm)
+		} else {
+			m = matcher.NewMaxCountMatcher(m, cfg.MaxCount)
+		}
+		m = matcher.NewRangeMatcher(m, matcher.Range{
+			FromLine: cfg.FromLine,
+			ToLine:   cfg.ToLine,
+			FromByte: cfg.FromByte,
+			ToByte:   cfg.ToByte,
+		}, cfg.LineNumbers || cfg.JSONOutput || cfg.JoinAdjacent > 0)
 	}
 
 	// Create formatter and writer
 	w := output.NewWriter()
+	var filterDone <-chan struct{}
+	if cfg.FilterCmd != "" {
+		filter, err := output.StartFilter(cfg.FilterCmd)
+		if err != nil {
+			logWarn("filter command: %v", err)
+			return 2
+		}
+		w = filter.Writer()
+		filterDone = filter.Done()
+		defer func() {
+			if err := filter.Close(); err != nil {
+				logWarn("filter command: %v", err)
+				exit = 2
+			}
+		}()
+	}
+	w.SetCRLF(cfg.CRLFOutput)
 	var formatter output.Formatter
-	if cfg.JSONOutput {
-		formatter = output.NewJSONFormatter()
+	var jf *output.JSONFormatter
+	var sf *output.WatchSummaryFormatter
+	if cfg.SummaryInterval > 0 {
+		// The summary counts what the matcher selected; it takes per-pattern
+		// counts itself rather than from the matcher, since watch mode
+		// swaps matchers on reload.
+		ps, err := newPatternStats(cfg, dialect, ign)
+		if err != nil {
+			logWarn("invalid pattern: %v", err)
+			return 2
+		}
+		sf = output.NewWatchSummaryFormatter(ps)
+		formatter = sf
+	} else if cfg.GroupByDir {
+		formatter = output.NewGroupFormatter(cfg.GroupFiles)
+	} else if cfg.WordCount {
+		formatter = output.NewWCFormatter()
+	} else if cfg.CountFiles {
+		formatter = output.NewFileCountFormatter()
+	} else if cfg.Format == FormatEmacs {
+		ef := output.NewEmacsFormatter()
+		if cfg.GroupSeparator != "" {
+			ef.SetSeparator(unescapeSeparator(cfg.GroupSeparator))
+		}
+		formatter = ef
+	} else if cfg.Format == FormatJUnit {
+		formatter = output.NewJUnitFormatter()
+	} else if cfg.JSONOutput {
+		jf = output.NewJSONFormatter()
+		if pstats != nil {
+			jf.SetPatternStats(pstats)
+		}
+		jf.SetContextWindow(cfg.ContextWindow)
+		jf.SetStat(cfg.JSONStat)
+		jf.SetRoots(cfg.RootLabels)
+		jf.SetMaxColumns(maxCols)
+		// Named groups become "captures"; -v selects lines without a match
+		// to capture from, --redact or --replace would leave nothing to
+		// capture, -o records would each repeat the line's first match, and
+		// --symbol matches are not where a plain search would capture.
+		if !cfg.Invert && len(cfg.Near) == 0 && cfg.Redact == output.RedactNone && cfg.Replace == "" && !cfg.OnlyMatching && !cfg.Symbol {
+			sm, err := matcher.NewSubmatcher(cfg.Patterns, cfg.Fixed, cfg.PCRE, cfg.IgnoreCase, dialect, cfg.LineRegexp)
+			if err != nil {
+				logWarn("invalid pattern: %v", err)
+				return 2
+			}
+			jf.SetCaptures(sm)
+		}
+		formatter = jf
 	} else {
-		formatter = output.NewTextFormatter(cfg.LineNumbers, cfg.CountOnly, cfg.FileNamesOnly, useColor, maxCols)
+		tf := output.NewTextFormatter(cfg.LineNumbers, cfg.CountOnly, cfg.FileNamesOnly, useColor, maxCols)
+		opts := output.TextOpts{
+			DisplayWidth:   cfg.DisplayWidth,
+			BinaryRaw:      cfg.BinaryRaw,
+			ClipMarkers:    cfg.ContextBytes > 0,
+			PrintPositions: cfg.PrintPositions,
+			RootLabels:     cfg.RootLabels,
+			ByteOffset:     cfg.ByteOffset,
+			NullNames:      cfg.NullNames,
+		}
+		if cfg.GroupSeparator != "" {
+			opts.GroupSeparator = unescapeSeparator(cfg.GroupSeparator)
+		}
+		tf.SetOptions(opts)
+		formatter = tf
+		if cfg.JoinAdjacent > 0 {
+			// Innermost, so that path and numbering wrappers have
+			// rewritten the result before runs are printed.
+			formatter = output.NewJoinFormatter(tf, cfg.JoinAdjacent)
+		}
+	}
+	if cfg.MaxPerDir > 0 {
+		// Inside the path wrapper, so that directories are counted and
+		// named as printed.
+		formatter = output.NewDirLimitFormatter(formatter, cfg.MaxPerDir)
+	}
+	if cfg.PathStyle != output.PathAsFound || len(cfg.PathStrip) > 0 || cfg.PathAdd != "" {
+		cwd, err := os.Getwd()
+		if err != nil {
+			logWarn("--path-style: %v", err)
+			return 2
+		}
+		formatter = output.NewPathFormatterOpts(formatter, output.PathOpts{
+			Style:         cfg.PathStyle,
+			StripPrefixes: cfg.PathStrip,
+			AddPrefix:     cfg.PathAdd,
+		}, cwd)
+	}
+	if cfg.Multiline && !cfg.JSONOutput {
+		// JSON records keep a match whole; text prints it line by line,
+		// split before -o so that each line's part prints on its own.
+		formatter = output.NewMultilineFormatter(formatter)
+	}
+	if cfg.OnlyMatching {
+		// Innermost of the rewriting wrappers, so that --replace and
+		// --redact rewrite the spans it then splits off.
+		formatter = output.NewOnlyMatchingFormatter(formatter)
+	}
+	var rf *output.ReplaceFormatter
+	if cfg.Replace != "" {
+		rep, err := matcher.NewReplacer(cfg.Replace, cfg.Patterns, cfg.Fixed, cfg.PCRE, cfg.IgnoreCase, dialect, cfg.LineRegexp)
+		if err != nil {
+			logWarn("invalid pattern: %v", err)
+			return 2
+		}
+		rf = output.NewReplaceFormatter(formatter, rep)
+		formatter = rf
+	}
+	if cfg.Redact != output.RedactNone {
+		salt := []byte(cfg.RedactSalt)
+		if len(salt) == 0 {
+			// A random salt keeps tokens from being matched against hashes
+			// of guessed secrets; --redact-salt trades that for tokens that
+			// compare across runs.
+			salt = make([]byte, 32)
+			if _, err := rand.Read(salt); err != nil {
+				logWarn("--redact: %v", err)
+				return 2
+			}
+		}
+		formatter = output.NewRedactFormatter(formatter, cfg.Redact, salt)
+	}
+	if cfg.LineNumberStart > 1 || cfg.ByteOffsetStart > 0 {
+		// Outermost, so that -o, -U and the rewriting wrappers all work
+		// from the renumbered matches.
+		formatter = output.NewNumberingFormatter(formatter, max(cfg.LineNumberStart, 1), cfg.ByteOffsetStart)
 	}
 
-	reader := input.NewAdaptiveReader(cfg.MmapThreshold)
+	readOpts := input.AdaptiveOptions{
+		MmapThreshold: cfg.MmapThreshold,
+		AutoThreshold: cfg.MmapAuto,
+		SkipHoles:     !cfg.NoSkipHoles,
+	}
+	if cfg.Debug {
+		readOpts.Trace = logReadTrace
+	}
+	if cfg.MaxReadMBps > 0 {
+		readOpts.Throttle = input.NewThrottle(max(1, int64(cfg.MaxReadMBps*(1<<20))))
+		// -l stops reading a throttled mapping at its first match when
+		// the file can be searched a window of lines at a time.
+		readOpts.LazyPrefetch = !cfg.WholeFile && len(cfg.Near) == 0 && !cfg.Multiline &&
+			matcher.Range{FromLine: cfg.FromLine, ToLine: cfg.ToLine, FromByte: cfg.FromByte, ToByte: cfg.ToByte}.IsZero()
+	}
+	var reader input.Reader = input.NewAdaptiveReaderOptions(readOpts)
+	if cfg.Cache && !cfg.WatchMode && len(cfg.Paths)+len(cfg.Roots) > 0 {
+		if store := openCache(); store != nil {
+			var lits []string
+			if !cfg.Invert {
+				lits, _ = matcher.RequiredLiterals(cfg.Patterns, cfg.Fixed, cfg.PCRE, cfg.IgnoreCase, dialect)
+			}
+			reader = cache.NewReader(reader, store, lits)
+			defer func() {
+				if err := store.Save(); err != nil {
+					logWarn("cache: %v", err)
+				}
+			}()
+		}
+	}
 	stdinReader := input.NewStdinReader()
 
 	// Determine search mode
 	mode := searchFull
-	if cfg.FileNamesOnly {
+	if cfg.FileNamesOnly && cfg.PrintHash {
+		mode = searchFilesHash
+	} else if cfg.FileNamesOnly {
 		mode = searchFilesOnly
-	} else if cfg.CountOnly {
+	} else if cfg.CountOnly || cfg.GroupByDir {
 		mode = searchCountOnly
+	} else if cfg.First {
+		mode = searchFirst
+	}
+
+	bin := binaryPolicy{search: cfg.Text}
+	bin.paths = binaryOverrides(cfg)
+	if cfg.Text && !cfg.BinaryRaw {
+		bin.maxMatches = cfg.BinaryMaxCount
+		if bin.maxMatches == 0 {
+			bin.maxMatches = defaultBinaryMaxMatches
+		} else if bin.maxMatches < 0 {
+			bin.maxMatches = 0
+		}
+	}
+
+	// The budget starts after setup so it bounds walking and searching.
+	// Searches stop taking new files when it expires, or when a write
+	// finds stdout closed, and flush what they have; a single read of
+	// stdin is not interrupted.
+	stop := make(chan struct{})
+	var stopOnce sync.Once
+	halt := func() { stopOnce.Do(func() { close(stop) }) }
+	defer halt()
+	budget := &searchBudget{stop: stop}
+	if cfg.MaxDuration > 0 {
+		done := make(chan struct{})
+		timer := time.AfterFunc(cfg.MaxDuration, func() {
+			close(done)
+			halt()
+		})
+		defer timer.Stop()
+		budget.done = done
 	}
+	go func() {
+		select {
+		case <-w.Closed():
+			halt()
+		case <-stop:
+		}
+	}()
 
-	// Determine input sources
+	// Determine input sources. Output redirected to a file is not
+	// searched, whether named, walked over (WalkOptions.Output) or on stdin.
 	paths := cfg.Paths
-	readFromStdin := len(paths) == 0
+	readFromStdin := len(paths) == 0 && len(cfg.Roots) == 0 && cfg.GitBlobs == ""
+	out := walker.OutputFile(os.Stdout)
+	if readFromStdin && out != (walker.FileID{}) && walker.OutputFile(os.Stdin) == out {
+		logWarn("(standard input): input file is also the output")
+		return 2
+	}
+	if cfg.GitBlobs == "" {
+		paths = dropOutput(paths, out)
+	}
 
-	if cfg.WatchMode {
-		return runWatch(paths, m, formatter, w, cfg)
+	// Per-root totals for --stats, when a walk has several roots to
+	// tell apart.
+	var roots *output.RootCounter
+	if cfg.Stats && cfg.Recursive && !cfg.WatchMode && len(paths)+len(cfg.Roots) > 1 {
+		roots = output.NewRootCounter(formatter, rootLabels(paths, cfg.Roots))
+		formatter = roots
+	}
+	// Totals of the whole search for --stats.
+	var totals *output.SearchCounter
+	if cfg.Stats && !cfg.WatchMode && !cfg.WatchOnce {
+		totals = output.NewSearchCounter(formatter)
+		formatter = totals
 	}
 
-	if readFromStdin {
-		return runStdin(stdinReader, m, formatter, w)
+	if cfg.WatchMode {
+		var reload func() (*matcher.ContextMatcher, error)
+		if len(cfg.PatternFiles) > 0 {
+			// Rebuild the chain above from the files' current patterns.
+			reload = func() (*matcher.ContextMatcher, error) {
+				rc := base
+				if err := resolvePatterns(&rc, dialect); err != nil {
+					return nil, err
+				}
+				rm, err := newLineMatcher(rc, dialect, snippetCols)
+				if err != nil {
+					return nil, fmt.Errorf("invalid pattern: %w", err)
+				}
+				ign, err := newIgnoreMatcher(rc, dialect)
+				if err != nil {
+					return nil, fmt.Errorf("invalid --ignore-line pattern: %w", err)
+				}
+				if ign != nil {
+					rm = matcher.NewIgnoreLineMatcher(rm, ign)
+				}
+				var sm matcher.Submatcher
+				if jf != nil && !rc.Invert && rc.Redact == output.RedactNone && rc.Replace == "" && !rc.OnlyMatching && !rc.Symbol {
+					if sm, err = matcher.NewSubmatcher(rc.Patterns, rc.Fixed, rc.PCRE, rc.IgnoreCase, dialect, rc.LineRegexp); err != nil {
+						return nil, fmt.Errorf("invalid pattern: %w", err)
+					}
+				}
+				var rep *matcher.Replacer
+				if rf != nil {
+					if rep, err = matcher.NewReplacer(rc.Replace, rc.Patterns, rc.Fixed, rc.PCRE, rc.IgnoreCase, dialect, rc.LineRegexp); err != nil {
+						return nil, fmt.Errorf("invalid pattern: %w", err)
+					}
+				}
+				cm := matcher.NewStreamContextMatcher(matcher.NewByteContextMatcher(rm, cfg.ContextBytes), cfg.ContextBefore, cfg.ContextAfter)
+				configureContext(cm)
+				if jf != nil {
+					jf.SetCaptures(sm)
+				}
+				if rf != nil {
+					rf.SetReplacer(rep)
+				}
+				if sf != nil {
+					ps, err := newPatternStats(rc, dialect, ign)
+					if err != nil {
+						return nil, fmt.Errorf("invalid pattern: %w", err)
+					}
+					sf.SetPatternStats(ps)
+				}
+				return cm, nil
+			}
+		}
+		code := runWatch(paths, watchCtx, reload, formatter, w, cfg, filterDone, budget.stop)
+		if stdoutClosed(w, cfg) {
+			return exitBrokenPipe
+		}
+		if budget.expired() {
+			logWarn("--max-duration %v reached; stopped watching", cfg.MaxDuration)
+			return exitBudget
+		}
+		return code
+	}
+	if cfg.WatchOnce {
+		code := runWatchOnce(paths, m, formatter, w, cfg.Interval, filterDone, budget.stop)
+		if stdoutClosed(w, cfg) {
+			return exitBrokenPipe
+		}
+		if code != 0 && budget.expired() {
+			logWarn("--max-duration %v reached; no new match", cfg.MaxDuration)
+			return exitBudget
+		}
+		return code
 	}
 
-	if cfg.Recursive {
-		return runRecursive(paths, m, reader, formatter, w, cfg, mode)
+	var code int
+	multiFile := false
+	switch {
+	case cfg.GitBlobs != "":
+		multiFile = true
+		code = runGitBlobs(cfg.GitBlobs, paths, m, formatter, w, cfg, mode, bin, budget)
+	case cfg.DiffInput:
+		multiFile = true
+		code = runDiffInput(paths, readFromStdin, stdinReader, reader, m, formatter, w, mode)
+	case readFromStdin:
+		stdinMode := searchFull
+		if mode == searchFirst || mode == searchCountOnly {
+			stdinMode = mode
+		}
+		code = runStdin(stdinReader, m, formatter, w, stdinMode, bin)
+	case cfg.Recursive && cfg.Sequential:
+		multiFile = true
+		code = runSequential(paths, m, reader, formatter, w, cfg, mode, bin, budget)
+	case cfg.Recursive:
+		multiFile = true
+		code = runRecursive(paths, m, reader, formatter, w, cfg, mode, bin, budget)
+	default:
+		if cfg.Directories == DirectoriesRead || cfg.Directories == DirectoriesSkip {
+			paths = expandDirs(paths, cfg)
+		}
+		// A directory read with -d read names its files even if it holds one.
+		multiFile = len(paths) > 1 || len(cfg.Paths) > 1 ||
+			(len(paths) == 1 && paths[0] != cfg.Paths[0])
+		if cfg.CanonicalPaths {
+			paths = canonicalPaths(paths)
+		}
+		code = runFiles(paths, multiFile, m, reader, formatter, w, mode, bin, budget, cfg.Sort, cfg.SortReverse)
 	}
 
-	return runFiles(paths, m, reader, formatter, w, mode)
+	if s, ok := formatter.(output.Summarizer); ok {
+		w.Write(s.Summary(nil, multiFile))
+	}
+	if pstats != nil {
+		logPatternStats(pstats.Totals())
+	}
+	if roots != nil {
+		logRootStats(roots.Totals(), cfg.FileNamesOnly)
+	}
+	if totals != nil {
+		logSearchTotals(totals.Totals(), cfg.FileNamesOnly, time.Since(start))
+	}
+	if stdoutClosed(w, cfg) {
+		return exitBrokenPipe
+	}
+	if !readFromStdin && budget.expired() {
+		logWarn("--max-duration %v reached; output is partial (%d files searched, %d found but not searched)",
+			cfg.MaxDuration, budget.searched, budget.dropped)
+		return exitBudget
+	}
+	return code
 }
 
-func runStdin(reader input.Reader, m matcher.Matcher, formatter output.Formatter, w *output.Writer) int {
-	result := searchReader(reader, "", m, searchFull)
+func runStdin(reader input.Reader, m matcher.Matcher, formatter output.Formatter, w *output.Writer, mode searchMode, bin binaryPolicy) int {
+	result := scheduler.Guard("", func() output.Result { return searchReader(reader, "", m, mode, bin) })
+	if f, ok := result.Err.(*scheduler.Fault); ok {
+		logWarn("(standard input): %v", f)
+		return 2
+	}
 	if result.HasMatch() {
 		buf := formatter.Format(nil, result, false)
 		if result.Closer != nil {
@@ -134,32 +750,62 @@ func runStdin(reader input.Reader, m matcher.Matcher, formatter output.Formatter
 		w.Write(buf)
 		return 0
 	}
+	// Input without a match is not formatted, except for -c's count of 0,
+	// but --stats still counts it.
+	if result.Counted {
+		w.Write(formatter.Format(nil, result, false))
+	} else if c, ok := formatter.(*output.SearchCounter); ok {
+		c.Add(result)
+	}
 	if result.Closer != nil {
 		result.Closer()
 	}
 	return 1
 }
 
-func runFiles(paths []string, m matcher.Matcher, reader input.Reader, formatter output.Formatter, w *output.Writer, mode searchMode) int {
-	multiFile := len(paths) > 1
+// runFiles searches paths in order. multiFile prefixes results with their
+// file names; it is set by the caller from the paths as given, which
+// -d read and --canonical-paths may have turned into a single file. With
+// sortBy, results are held until all are searched and printed sorted.
+func runFiles(paths []string, multiFile bool, m matcher.Matcher, reader input.Reader, formatter output.Formatter, w *output.Writer, mode searchMode, bin binaryPolicy, budget *searchBudget, sortBy output.SortKey, reverse bool) int {
 	hasMatch := false
 	var buf []byte
+	var faults []*scheduler.Fault
+	defer func() { logFaults(faults) }()
 
-	for _, path := range paths {
-		result := searchReader(reader, path, m, mode)
+	var held []output.Result
+	for i, path := range paths {
+		if budget.stopped() {
+			budget.dropped = len(paths) - i
+			break
+		}
+		budget.searched++
+		result := guardedSearch(&faults, reader, path, m, mode, bin)
 		if result.Err != nil {
-			logWarn("%s: %v", path, result.Err)
+			if _, ok := result.Err.(*scheduler.Fault); !ok {
+				logWarn("%s: %v", path, result.Err)
+			}
 			continue
 		}
 		if result.HasMatch() {
 			hasMatch = true
 		}
+		if sortBy != output.SortNone {
+			result.Detach()
+			held = append(held, result)
+			continue
+		}
 		buf = formatter.Format(buf[:0], result, multiFile)
 		if result.Closer != nil {
 			result.Closer()
 		}
 		w.Write(buf)
 	}
+	output.SortResults(held, sortBy, reverse)
+	for _, result := range held {
+		buf = formatter.Format(buf[:0], result, multiFile)
+		w.Write(buf)
+	}
 
 	if hasMatch {
 		return 0
@@ -167,13 +813,40 @@ func runFiles(paths []string, m matcher.Matcher, reader input.Reader, formatter
 	return 1
 }
 
-func runRecursive(paths []string, m matcher.Matcher, reader input.Reader, formatter output.Formatter, w *output.Writer, cfg Config, mode searchMode) int {
+func runRecursive(paths []string, m matcher.Matcher, reader input.Reader, formatter output.Formatter, w *output.Writer, cfg Config, mode searchMode, bin binaryPolicy, budget *searchBudget) int {
+	var stats *walker.WalkStats
+	if cfg.Stats {
+		stats = &walker.WalkStats{}
+	}
+	limit := cfg.MaxInFlight
+	if limit == 0 {
+		limit = walker.DefaultMaxInFlight
+	}
+	var inFlight *walker.InFlight
+	if cfg.Sort == output.SortNone {
+		// Sorted results are all held until the walk ends, so the walk
+		// cannot wait for them to be written.
+		inFlight = walker.NewInFlight(limit)
+	}
 	fileCh, errCh := walker.Walk(paths, walker.WalkOptions{
 		Recursive:      true,
 		NoIgnore:       cfg.NoIgnore,
 		Hidden:         cfg.Hidden,
+		HiddenFiles:    cfg.HiddenFiles,
+		HiddenDirs:     cfg.HiddenDirs,
+		HiddenGlobs:    cfg.HiddenGlobs,
 		FollowSymlinks: cfg.FollowSymlinks,
+		IncludeBinary:  cfg.Text,
 		Globs:          cfg.Globs,
+		Binary:         bin.paths,
+		Roots:          cfg.Roots,
+		Stats:          stats,
+		Cancel:         budget.stop,
+		Repos:          repoBoundary(cfg),
+		Canonical:      canonical(cfg),
+		InFlight:       inFlight,
+		VirtualFS:      cfg.VirtualFS,
+		Output:         walker.OutputFile(os.Stdout),
 	})
 
 	// Log walk errors in background
@@ -182,17 +855,47 @@ func runRecursive(paths []string, m matcher.Matcher, reader input.Reader, format
 			logWarn("walk: %v", err)
 		}
 	}()
+	fileCh = walker.Prioritize(fileCh, cfg.Priority, walker.DefaultPriorityWindow)
 
-	// Create scheduler and run workers
-	sched := scheduler.New(cfg.Workers, m, reader, mode == searchFilesOnly, mode == searchCountOnly)
+	code := runScheduled(fileCh, m, reader, formatter, w, cfg, mode, bin, budget, inFlight)
+	if stats != nil {
+		logWalkStats(stats)
+	}
+	return code
+}
+
+// runScheduled searches the files from fileCh on the scheduler's workers
+// and writes the results in arrival order.
+func runScheduled(fileCh <-chan walker.FileEntry, m matcher.Matcher, reader input.Reader, formatter output.Formatter, w *output.Writer, cfg Config, mode searchMode, bin binaryPolicy, budget *searchBudget, inFlight *walker.InFlight) int {
+	filesOnly := mode == searchFilesOnly || mode == searchFilesHash
+	sched := scheduler.New(cfg.Workers, m, reader, filesOnly, mode == searchCountOnly, mode == searchFirst)
+	if mode == searchFilesHash {
+		sched.HashMatches()
+	}
+	if bin.search {
+		sched.SearchBinary(bin.maxMatches)
+	}
+	sched.OverrideBinary(bin.paths)
+	sched.Cancel(budget.stop)
 	resultCh := sched.Run(fileCh)
+	if cfg.Sort != output.SortNone {
+		resultCh = sortedResults(resultCh, cfg.Sort, cfg.SortReverse)
+	}
 
 	// Write results in order
 	var hasMatch atomic.Bool
 	ow := output.NewOrderedWriter(w, formatter, true)
+	if filesOnly {
+		ow.SetBatch(filesOnlyBatch)
+	}
+	if inFlight != nil {
+		ow.SetRelease(inFlight.Done)
+	}
 	ow.WriteOrdered(resultCh, func() {
 		hasMatch.Store(true)
 	})
+	budget.searched, budget.dropped = sched.Counts()
+	logFaults(sched.Faults())
 
 	if hasMatch.Load() {
 		return 0
@@ -200,7 +903,539 @@ func runRecursive(paths []string, m matcher.Matcher, reader input.Reader, format
 	return 1
 }
 
-func runWatch(paths []string, m matcher.Matcher, formatter output.Formatter, w *output.Writer, cfg Config) int {
+// sortedResults holds every result from in, detached from its buffer,
+// and sends them on sorted once in is closed, numbered in the new order
+// for the OrderedWriter.
+func sortedResults(in <-chan output.Result, key output.SortKey, reverse bool) <-chan output.Result {
+	out := make(chan output.Result, 256)
+	go func() {
+		defer close(out)
+		var held []output.Result
+		for r := range in {
+			r.Detach()
+			held = append(held, r)
+		}
+		output.SortResults(held, key, reverse)
+		for i, r := range held {
+			r.SeqNum = i + 1
+			out <- r
+		}
+	}()
+	return out
+}
+
+// runGitBlobs searches the files of a git revision without a checkout,
+// naming them "ref:path". paths are pathspecs limiting the search.
+func runGitBlobs(ref string, paths []string, m matcher.Matcher, formatter output.Formatter, w *output.Writer, cfg Config, mode searchMode, bin binaryPolicy, budget *searchBudget) int {
+	tree, err := gitblob.Open(ref, paths)
+	if err != nil {
+		logWarn("%v", err)
+		return 2
+	}
+	defer tree.Close()
+
+	fileCh := make(chan walker.FileEntry, 256)
+	go func() {
+		defer close(fileCh)
+		for _, p := range tree.Paths() {
+			select {
+			case fileCh <- walker.FileEntry{Path: p}:
+			case <-budget.stop:
+				return
+			}
+		}
+	}()
+	return runScheduled(fileCh, m, tree, formatter, w, cfg, mode, bin, budget, nil)
+}
+
+// runDiffInput reads each path, or stdin, as a unified diff and searches
+// the lines it adds to each file as that file, reporting matches at the
+// file's new name and line numbers.
+func runDiffInput(paths []string, stdin bool, stdinReader, reader input.Reader, m matcher.Matcher, formatter output.Formatter, w *output.Writer, mode searchMode) int {
+	if stdin {
+		paths, reader = []string{""}, stdinReader
+	}
+	hasMatch := false
+	var buf []byte
+	for _, path := range paths {
+		rr, err := reader.Read(path)
+		if err != nil {
+			if stdin {
+				path = "(standard input)"
+			}
+			logWarn("%s: %v", path, err)
+			continue
+		}
+		if rr.Prefetch != nil {
+			rr.Prefetch(len(rr.Data))
+		}
+		files := input.ParseDiff(rr.Data)
+		if rr.Closer != nil {
+			rr.Closer() // ParseDiff copied the added lines
+		}
+		for i := range files {
+			f := &files[i]
+			result := output.Result{FilePath: f.Path, Size: int64(len(f.Data))}
+			switch mode {
+			case searchFilesOnly:
+				if m.MatchExists(f.Data) {
+					result.MatchSet = matcher.MatchSet{Matches: []matcher.Match{{}}}
+				}
+			case searchCountOnly:
+				result.MatchCount = m.CountAll(f.Data)
+				result.Counted = true
+			case searchFirst:
+				result.MatchSet = matcher.FindFirst(m, f.Data)
+			default:
+				result.MatchSet = m.FindAll(f.Data)
+			}
+			for j := range result.MatchSet.Matches {
+				match := &result.MatchSet.Matches[j]
+				match.LineNum, match.ByteOffset = f.Position(match.LineNum, match.ByteOffset)
+			}
+			if result.HasMatch() {
+				hasMatch = true
+			}
+			buf = formatter.Format(buf[:0], result, true)
+			w.Write(buf)
+		}
+	}
+	if hasMatch {
+		return 0
+	}
+	return 1
+}
+
+// expandDirs applies -d read or -d skip to the path arguments using the
+// walker's non-recursive mode. Files keep their argument order; a directory
+// read in place is replaced by its files, filtered like a recursive walk.
+func expandDirs(paths []string, cfg Config) []string {
+	dirs := walker.DirSkip
+	if cfg.Directories == DirectoriesRead {
+		dirs = walker.DirRead
+	}
+	fileCh, errCh := walker.Walk(paths, walker.WalkOptions{
+		Directories:    dirs,
+		NoIgnore:       cfg.NoIgnore,
+		Hidden:         cfg.Hidden,
+		HiddenFiles:    cfg.HiddenFiles,
+		HiddenDirs:     cfg.HiddenDirs,
+		HiddenGlobs:    cfg.HiddenGlobs,
+		FollowSymlinks: cfg.FollowSymlinks,
+		IncludeBinary:  cfg.Text,
+		Globs:          cfg.Globs,
+		Binary:         binaryOverrides(cfg),
+		VirtualFS:      cfg.VirtualFS,
+		Output:         walker.OutputFile(os.Stdout),
+	})
+	errsDone := make(chan struct{})
+	go func() {
+		defer close(errsDone)
+		for err := range errCh {
+			logWarn("%v", err)
+		}
+	}()
+	files := make([]string, 0, len(paths))
+	for e := range fileCh {
+		files = append(files, e.Path)
+	}
+	<-errsDone
+	return files
+}
+
+// runSequential walks and searches one file at a time on the calling
+// goroutine, bypassing the scheduler. Output order is the walk order.
+func runSequential(paths []string, m matcher.Matcher, reader input.Reader, formatter output.Formatter, w *output.Writer, cfg Config, mode searchMode, bin binaryPolicy, budget *searchBudget) int {
+	var stats *walker.WalkStats
+	if cfg.Stats {
+		stats = &walker.WalkStats{}
+	}
+	hasMatch := false
+	var buf []byte
+	var faults []*scheduler.Fault
+
+	walker.WalkSequential(paths, walker.WalkOptions{
+		Recursive:      true,
+		NoIgnore:       cfg.NoIgnore,
+		Hidden:         cfg.Hidden,
+		HiddenFiles:    cfg.HiddenFiles,
+		HiddenDirs:     cfg.HiddenDirs,
+		HiddenGlobs:    cfg.HiddenGlobs,
+		FollowSymlinks: cfg.FollowSymlinks,
+		IncludeBinary:  cfg.Text,
+		Globs:          cfg.Globs,
+		Binary:         bin.paths,
+		Roots:          cfg.Roots,
+		Stats:          stats,
+		Cancel:         budget.stop,
+		Repos:          repoBoundary(cfg),
+		Canonical:      canonical(cfg),
+		VirtualFS:      cfg.VirtualFS,
+		Output:         walker.OutputFile(os.Stdout),
+	}, func(e walker.FileEntry) {
+		budget.searched++
+		result := guardedSearch(&faults, reader, e.Path, m, mode, bin)
+		if result.Err != nil {
+			if _, ok := result.Err.(*scheduler.Fault); !ok {
+				logWarn("%s: %v", e.Path, result.Err)
+			}
+			return
+		}
+		result.Root = e.Root
+		if result.HasMatch() {
+			hasMatch = true
+		}
+		buf = formatter.Format(buf[:0], result, true)
+		if result.Closer != nil {
+			result.Closer()
+		}
+		w.Write(buf)
+	}, func(err error) {
+		logWarn("walk: %v", err)
+	})
+
+	if stats != nil {
+		logWalkStats(stats)
+	}
+	logFaults(faults)
+	if hasMatch {
+		return 0
+	}
+	return 1
+}
+
+// openCache loads the trigram cache, or returns nil (after a warning) if it
+// cannot be opened; the search then runs uncached.
+func openCache() *cache.Store {
+	path, err := cache.DefaultPath()
+	if err != nil {
+		logWarn("cache: %v", err)
+		return nil
+	}
+	store, err := cache.Open(path)
+	if err != nil {
+		logWarn("cache: %v", err)
+		return nil
+	}
+	return store
+}
+
+// logWalkStats writes walker counters to stderr so users can see why a file
+// they expected was not searched.
+func logWalkStats(s *walker.WalkStats) {
+	fmt.Fprintf(os.Stderr, "gogrep: walked %d dirs, %d files searched\n", s.Dirs, s.Files)
+	if s.TypeStats > 0 {
+		fmt.Fprintf(os.Stderr, "gogrep: stat'ed %d entries the filesystem gave no type\n", s.TypeStats)
+	}
+	fmt.Fprintf(os.Stderr, "gogrep: skipped %d ignored, %d glob, %d hidden, %d binary-ext, %d vcs, %d symlinks, %d nested repos, %d duplicate paths, %d virtual filesystems, %d output file\n",
+		s.SkippedIgnore, s.SkippedGlob, s.SkippedHidden, s.SkippedBinary, s.SkippedVCS, s.SkippedLinks, s.SkippedRepos, s.SkippedDups, s.SkippedVirtual, s.SkippedOutput)
+	fmt.Fprintf(os.Stderr, "gogrep: peak %d dirs queued, %d walked depth-first; peak %d files in flight, paused %d times for %v\n",
+		s.PeakQueuedDirs, s.DepthFirstDirs, s.PeakInFlight, s.Paused, s.PausedFor.Round(time.Millisecond))
+}
+
+// rootLabels returns the labels a recursive walk of paths and specs gives
+// its roots, in walk order: see walker.FileEntry.Root.
+func rootLabels(paths []string, specs []walker.RootSpec) []string {
+	labels := append([]string(nil), paths...)
+	for _, spec := range specs {
+		if spec.Label != "" {
+			labels = append(labels, spec.Label)
+		} else {
+			labels = append(labels, spec.Path)
+		}
+	}
+	return labels
+}
+
+// logRootStats writes per-root totals to stderr for --stats. Under -l
+// there are no line counts.
+func logRootStats(totals []output.RootTotal, filesOnly bool) {
+	for _, t := range totals {
+		if filesOnly {
+			fmt.Fprintf(os.Stderr, "gogrep: root %q: %d files searched, %d matched\n", t.Root, t.Files, t.Matched)
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "gogrep: root %q: %d files searched, %d matched, %d lines\n", t.Root, t.Files, t.Matched, t.Lines)
+	}
+}
+
+// logSearchTotals writes the totals of the whole search to stderr for
+// --stats. Under -l there are no line counts.
+func logSearchTotals(t output.SearchTotals, filesOnly bool, elapsed time.Duration) {
+	if filesOnly {
+		fmt.Fprintf(os.Stderr, "gogrep: %d files searched, %d matched, %d bytes in %v\n",
+			t.Files, t.Matched, t.Bytes, elapsed.Round(time.Millisecond))
+		return
+	}
+	fmt.Fprintf(os.Stderr, "gogrep: %d files searched, %d matched, %d lines, %d bytes in %v\n",
+		t.Files, t.Matched, t.Lines, t.Bytes, elapsed.Round(time.Millisecond))
+}
+
+// logReadTrace writes how a file was read to stderr (--debug).
+func logReadTrace(t input.ReadTrace) {
+	mode := "fixed"
+	if t.Auto {
+		mode = "auto"
+	}
+	fmt.Fprintf(os.Stderr, "gogrep: debug: %s: %s, %d bytes, mmap threshold %d (%s)\n",
+		t.Path, t.Strategy, t.Size, t.Threshold, mode)
+}
+
+// runWatchOnce polls paths every interval and returns 0 once content
+// appended to one of them matches, after printing that file's matches. It
+// returns 1 if stop is closed first, and also when the time budget expires
+// or stdout is closed.
+func runWatchOnce(paths []string, m matcher.Matcher, formatter output.Formatter, w *output.Writer, interval time.Duration, stop, budget <-chan struct{}) int {
+	if interval == 0 {
+		interval = defaultPollInterval
+	}
+	poller := watch.NewPoller(paths)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return 1
+		case <-budget:
+			return 1
+		}
+		for _, path := range poller.Paths() {
+			data, err := poller.ReadNew(path)
+			if err != nil {
+				logWarn("%s: read: %v", path, err)
+				continue
+			}
+			if len(data) == 0 {
+				continue
+			}
+			ms := m.FindAll(data)
+			if ms.HasMatch() {
+				w.Write(formatter.Format(nil, output.Result{FilePath: path, MatchSet: ms}, len(paths) > 1))
+				return 0
+			}
+		}
+	}
+}
+
+// runExplain prints the walker's verdict on cfg.Explain, as if the path
+// arguments were walked with -r. Returns 0 if the path would be searched,
+// 1 if not, 2 on error.
+func runExplain(cfg Config) int {
+	e, err := walker.Explain(cfg.Explain, cfg.Paths, walker.WalkOptions{
+		Recursive:      true,
+		NoIgnore:       cfg.NoIgnore,
+		Hidden:         cfg.Hidden,
+		HiddenFiles:    cfg.HiddenFiles,
+		HiddenDirs:     cfg.HiddenDirs,
+		HiddenGlobs:    cfg.HiddenGlobs,
+		FollowSymlinks: cfg.FollowSymlinks,
+		IncludeBinary:  cfg.Text,
+		Globs:          cfg.Globs,
+		Binary:         binaryOverrides(cfg),
+		Roots:          cfg.Roots,
+		Repos:          repoBoundary(cfg),
+		VirtualFS:      cfg.VirtualFS,
+	})
+	if err != nil {
+		logWarn("explain: %v", err)
+		return 2
+	}
+	fmt.Println(e)
+	if e.Included {
+		return 0
+	}
+	return 1
+}
+
+// runCalibrate benchmarks this machine on the storage of the path argument
+// (default .), prints the measurements, and writes the suggested settings
+// to the config file. Returns 0, or 2 on error.
+func runCalibrate(cfg Config) int {
+	dir := "."
+	if len(cfg.Paths) > 0 {
+		dir = cfg.Paths[0]
+	}
+	res, err := calibrate.Run(calibrate.Options{
+		Dir:      dir,
+		Progress: func(name string) { logWarn("calibrating: %s", name) },
+	})
+	if err != nil {
+		logWarn("calibrate: %v", err)
+		return 2
+	}
+	fmt.Print(res.Report())
+	path, err := WriteCalibration(res.Args(), time.Now())
+	if err != nil {
+		logWarn("calibrate: %v", err)
+		return 2
+	}
+	fmt.Printf("wrote suggested settings to %s\n", path)
+	return 0
+}
+
+// selfTestRounds is how many random inputs --self-test gives each SIMD
+// function: enough to reach every tail length and alignment many times,
+// and still well under a second.
+const selfTestRounds = 20000
+
+// runSelfTest checks the SIMD functions against plain implementations on
+// this CPU and prints the report. Each run draws new inputs; the seed is
+// printed so that a failure can be replayed with simd.SelfTest. Returns 0
+// if every check passed, or 2.
+func runSelfTest() int {
+	seed := uint64(time.Now().UnixNano())
+	fmt.Printf("seed: %d\n", seed)
+	r := simd.SelfTest(selfTestRounds, seed)
+	fmt.Print(r)
+	if !r.OK() {
+		return 2
+	}
+	return 0
+}
+
+// resolvePatterns completes cfg.Patterns: the lines of the -f files and
+// the quoted --fixed-pattern strings are appended, and --smart-case turns
+// on -i if no pattern has an upper-case letter. Watch mode calls it again
+// on the config as given to reload the files.
+func resolvePatterns(cfg *Config, dialect matcher.Dialect) error {
+	patterns := slices.Clip(cfg.Patterns)
+	for _, path := range cfg.PatternFiles {
+		lines, err := readPatternFile(path)
+		if err != nil {
+			return err
+		}
+		patterns = append(patterns, lines...)
+	}
+	// Quoted, fixed strings are literals to every consumer of the
+	// patterns; the matcher gives them their own engine.
+	for _, p := range cfg.FixedPatterns {
+		patterns = append(patterns, matcher.QuotePattern(p, cfg.Fixed, dialect))
+	}
+	if len(patterns) == 0 {
+		return fmt.Errorf("no pattern specified: %s has none", strings.Join(cfg.PatternFiles, ", "))
+	}
+	cfg.Patterns = patterns
+
+	// Smart case: if enabled and all patterns are lowercase, enable case-insensitive
+	if cfg.SmartCase && !cfg.IgnoreCase {
+		allLower := true
+		for _, p := range cfg.Patterns {
+			for _, r := range p {
+				if unicode.IsUpper(r) {
+					allLower = false
+					break
+				}
+			}
+			if !allLower {
+				break
+			}
+		}
+		if allLower {
+			cfg.IgnoreCase = true
+		}
+	}
+	return nil
+}
+
+// readPatternFile returns the patterns of a -f file, one per line, as grep
+// reads them: an empty file has none, and an empty line matches every line.
+func readPatternFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n"), nil
+}
+
+// newLineMatcher builds the matcher for cfg.Patterns, outside --whole-file
+// and --near.
+func newLineMatcher(cfg Config, dialect matcher.Dialect, snippetCols int) (matcher.Matcher, error) {
+	return matcher.NewMatcher(cfg.Patterns, cfg.Fixed, cfg.PCRE, cfg.IgnoreCase, cfg.Invert, matcher.MatcherOpts{
+		MaxCols:      snippetCols,
+		NeedLineNums: cfg.LineNumbers || cfg.JoinAdjacent > 0,
+		Dialect:      dialect,
+		LineRegexp:   cfg.LineRegexp,
+		Multiline:    cfg.Multiline,
+		Symbol:       cfg.Symbol,
+	})
+}
+
+// newIgnoreMatcher builds the --ignore-line matcher, or returns nil without
+// --ignore-line.
+func newIgnoreMatcher(cfg Config, dialect matcher.Dialect) (matcher.Matcher, error) {
+	if len(cfg.IgnoreLines) == 0 {
+		return nil, nil
+	}
+	return matcher.NewMatcher(cfg.IgnoreLines, cfg.Fixed, cfg.PCRE, cfg.IgnoreCase, false, matcher.MatcherOpts{
+		Dialect: dialect,
+	})
+}
+
+// newNearMatcher builds the --near matcher from one matcher per pattern.
+// The pattern matchers keep full lines and line numbers, which the block
+// walk relies on.
+func newNearMatcher(cfg Config, dialect matcher.Dialect, separators bool) (matcher.Matcher, error) {
+	var pm [2]matcher.Matcher
+	for i, p := range cfg.Near {
+		m, err := matcher.NewMatcher([]string{p}, cfg.Fixed, cfg.PCRE, cfg.IgnoreCase, false, matcher.MatcherOpts{
+			NeedLineNums: true,
+			Dialect:      dialect,
+			LineRegexp:   cfg.LineRegexp,
+		})
+		if err != nil {
+			return nil, err
+		}
+		pm[i] = m
+	}
+	nm := matcher.NewNearMatcher(pm[0], pm[1], cfg.Within)
+	nm.SetSeparators(separators)
+	return nm, nil
+}
+
+// newPatternStats builds per-pattern counters for cfg's patterns, with
+// the main matcher's options and --ignore-line matcher ign. It returns nil
+// unless there are several patterns and lines are selected by matching
+// them: with -v, lines match none.
+func newPatternStats(cfg Config, dialect matcher.Dialect, ign matcher.Matcher) (*matcher.PatternStats, error) {
+	if len(cfg.Patterns) < 2 || cfg.Invert {
+		return nil, nil
+	}
+	return matcher.NewPatternStats(cfg.Patterns, func(p string) (matcher.Matcher, error) {
+		pm, err := matcher.NewMatcher([]string{p}, cfg.Fixed, cfg.PCRE, cfg.IgnoreCase, false, matcher.MatcherOpts{
+			Dialect:    dialect,
+			LineRegexp: cfg.LineRegexp,
+			Multiline:  cfg.Multiline,
+			Symbol:     cfg.Symbol,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return matcher.NewIgnoreLineMatcher(pm, ign), nil
+	})
+}
+
+// logPatternStats writes per-pattern totals to stderr for --stats.
+func logPatternStats(totals []matcher.PatternTotal) {
+	for _, t := range totals {
+		fmt.Fprintf(os.Stderr, "gogrep: pattern %q: %d lines in %d files\n", t.Pattern, t.Lines, t.Files)
+	}
+}
+
+// reloadSettle is how long the -f files must go unchanged before watch
+// mode reloads them, so a file being rewritten is not read half-way.
+const reloadSettle = 100 * time.Millisecond
+
+// runWatch searches new content of paths as it is appended. It returns when
+// the event stream ends, stop is closed (the filter command exited), or the
+// time budget expires or stdout is closed. If reload is set, it is called to rebuild the
+// matcher when the -f files change or on SIGHUP; a reload that fails keeps
+// the current matcher.
+func runWatch(paths []string, ctx *matcher.ContextMatcher, reload func() (*matcher.ContextMatcher, error), formatter output.Formatter, w *output.Writer, cfg Config, stop, budget <-chan struct{}) int {
 	watcher, err := watch.New()
 	if err != nil {
 		logWarn("failed to create watcher: %v", err)
@@ -208,6 +1443,18 @@ func runWatch(paths []string, m matcher.Matcher, formatter output.Formatter, w *
 	}
 	defer watcher.Close()
 
+	var state *watch.State
+	if cfg.StateFile != "" {
+		state, err = watch.LoadState(cfg.StateFile)
+		if err != nil {
+			logWarn("state file: %v", err)
+			return 2
+		}
+	}
+	if state != nil || cfg.Replay {
+		watcher.UseState(state, cfg.Replay)
+	}
+
 	// Add all paths to watch
 	for _, path := range paths {
 		if err := watcher.Add(path); err != nil {
@@ -217,36 +1464,183 @@ func runWatch(paths []string, m matcher.Matcher, formatter output.Formatter, w *
 	}
 
 	hasMatch := false
-	events := watcher.Events()
 
-	for evt := range events {
-		if evt.Err != nil {
-			logWarn("watch: %v", evt.Err)
-			continue
+	// With a queue, a slow consumer pauses reading (or loses the oldest
+	// results) at a bounded backlog rather than blocking each write.
+	emit := func(buf []byte) { w.Write(buf) }
+	if cfg.WatchQueue > 0 {
+		q := output.NewQueue(w, cfg.WatchQueue, cfg.WatchDrop)
+		emit = q.Write
+		defer func() {
+			if dropped := q.Close(); dropped > 0 {
+				logWarn("watch: dropped %d results while output was blocked", dropped)
+			}
+		}()
+	}
+
+	// Each file is searched as one stream, so line numbers, byte offsets
+	// and context lines match a search of the whole file. A stream starts
+	// over when the file is truncated and read from the start again.
+	type watchedFile struct {
+		stream *matcher.ContextStream
+		next   int64 // offset the next read continues from
+	}
+	files := make(map[string]*watchedFile)
+	needLines := cfg.LineNumbers || cfg.JSONOutput || cfg.JoinAdjacent > 0
+	display := watchDisplayPaths(paths)
+
+	// searchNew searches what was appended to path since the last read and
+	// records the new offset once the output is written.
+	searchNew := func(path string) {
+		data, off, err := watcher.ReadNewAt(path)
+		if err != nil {
+			logWarn("%s: read: %v", path, err)
+			return
+		}
+		if len(data) == 0 {
+			return
 		}
 
-		switch evt.Type {
-		case watch.EventModified:
-			data, err := watcher.ReadNew(evt.Path)
+		f := files[path]
+		if f == nil || f.next != off {
+			lines := 0
+			if off > 0 && needLines {
+				if lines, err = watch.CountLines(path, off); err != nil {
+					logWarn("%s: read: %v", path, err)
+				}
+			}
+			f = &watchedFile{stream: ctx.Stream(lines, off)}
+			files[path] = f
+		}
+		f.next = off + int64(len(data))
+
+		ms := f.stream.FindAll(data)
+		if ms.HasMatch() {
+			hasMatch = true
+			result := output.Result{
+				FilePath: display(path),
+				MatchSet: ms,
+			}
+			emit(formatter.Format(nil, result, true))
+		}
+		if state != nil {
+			if err := state.Save(); err != nil {
+				logWarn("state file: %v", err)
+			}
+		}
+	}
+
+	// Catch up on data appended while no watcher was running (or all of
+	// it with --replay) before waiting for changes.
+	if state != nil || cfg.Replay {
+		for _, path := range watcher.Files() {
+			searchNew(path)
+		}
+	}
+
+	// The -f files are watched through their directories, since editors
+	// replace a file rather than rewrite it. The new matcher takes over
+	// between two events, and open streams keep their place in each file.
+	var patternEvents <-chan watch.Event
+	var hup chan os.Signal
+	var settle *time.Timer
+	var settled <-chan time.Time
+	patternFiles := make(map[string]bool)
+	if reload != nil {
+		pw, err := watch.New()
+		if err != nil {
+			logWarn("failed to create watcher: %v", err)
+			return 2
+		}
+		defer pw.Close()
+		for _, p := range cfg.PatternFiles {
+			abs, err := filepath.Abs(p)
 			if err != nil {
-				logWarn("%s: read: %v", evt.Path, err)
-				continue
+				logWarn("failed to watch %s: %v", p, err)
+				return 2
 			}
-			if len(data) == 0 {
-				continue
+			patternFiles[abs] = true
+			if err := pw.Add(filepath.Dir(abs)); err != nil {
+				logWarn("failed to watch %s: %v", p, err)
+				return 2
 			}
+		}
+		patternEvents = pw.Events()
+		hup = make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		defer signal.Stop(hup)
+	}
+	reloadPatterns := func() {
+		cm, err := reload()
+		if err != nil {
+			logWarn("patterns not reloaded: %v", err)
+			return
+		}
+		ctx = cm
+		for _, f := range files {
+			f.stream.Swap(cm)
+		}
+		logWarn("patterns reloaded")
+	}
 
-			// Search the new content
-			ms := m.FindAll(data)
-			if ms.HasMatch() {
-				hasMatch = true
-				result := output.Result{
-					FilePath: evt.Path,
-					MatchSet: ms,
+	// --summary-interval prints the formatter's counts on a timer, and
+	// once more on the way out for the last, partial interval.
+	summary, _ := formatter.(output.Summarizer)
+	var summaryTick <-chan time.Time
+	if summary != nil && cfg.SummaryInterval > 0 {
+		t := time.NewTicker(cfg.SummaryInterval)
+		defer t.Stop()
+		summaryTick = t.C
+		defer func() { emit(summary.Summary(nil, true)) }()
+	}
+
+	events := watcher.Events()
+
+loop:
+	for {
+		var evt watch.Event
+		select {
+		case e, ok := <-events:
+			if !ok {
+				break loop
+			}
+			evt = e
+		case e, ok := <-patternEvents:
+			if !ok {
+				patternEvents = nil
+			} else if e.Err == nil && patternFiles[e.Path] && e.Type != watch.EventDeleted {
+				if settle == nil {
+					settle = time.NewTimer(reloadSettle)
+				} else {
+					settle.Reset(reloadSettle)
 				}
-				buf := formatter.Format(nil, result, true)
-				w.Write(buf)
+				settled = settle.C
 			}
+			continue
+		case <-settled:
+			settled = nil
+			reloadPatterns()
+			continue
+		case <-hup:
+			reloadPatterns()
+			continue
+		case <-summaryTick:
+			emit(summary.Summary(nil, true))
+			continue
+		case <-stop:
+			break loop
+		case <-budget:
+			break loop
+		}
+
+		if evt.Err != nil {
+			logWarn("watch: %v", evt.Err)
+			continue
+		}
+
+		switch evt.Type {
+		case watch.EventModified:
+			searchNew(evt.Path)
 
 		case watch.EventCreated:
 			// Add newly created files to the watch
@@ -265,7 +1659,51 @@ func runWatch(paths []string, m matcher.Matcher, formatter output.Formatter, w *
 	return 1
 }
 
-func searchReader(r input.Reader, path string, m matcher.Matcher, mode searchMode) output.Result {
+// watchDisplayPaths returns a function that maps the absolute paths the
+// watcher reports back to paths as given on the command line, so live
+// output names files as a batch search would.
+func watchDisplayPaths(paths []string) func(string) string {
+	given := make(map[string]string, len(paths))
+	for _, p := range paths {
+		if abs, err := filepath.Abs(p); err == nil {
+			given[abs] = p
+		}
+	}
+	return func(path string) string {
+		if p, ok := given[path]; ok {
+			return p
+		}
+		if dir, ok := given[filepath.Dir(path)]; ok {
+			return filepath.Join(dir, filepath.Base(path))
+		}
+		return path
+	}
+}
+
+// guardedSearch is searchReader with a panic turned into a faulted result,
+// which is also appended to faults. Faults are reported by logFaults once
+// the search ends, so callers log only the other errors.
+func guardedSearch(faults *[]*scheduler.Fault, r input.Reader, path string, m matcher.Matcher, mode searchMode, bin binaryPolicy) output.Result {
+	result := scheduler.Guard(path, func() output.Result { return searchReader(r, path, m, mode, bin) })
+	if f, ok := result.Err.(*scheduler.Fault); ok {
+		*faults = append(*faults, f)
+	}
+	return result
+}
+
+// logFaults summarizes the files whose search panicked and was skipped.
+func logFaults(faults []*scheduler.Fault) {
+	if len(faults) == 0 {
+		return
+	}
+	slices.SortFunc(faults, func(a, b *scheduler.Fault) int { return strings.Compare(a.Path, b.Path) })
+	logWarn("%d files could not be searched because the search panicked:", len(faults))
+	for _, f := range faults {
+		logWarn("  %s: %v", f.Path, f.Value)
+	}
+}
+
+func searchReader(r input.Reader, path string, m matcher.Matcher, mode searchMode, bin binaryPolicy) output.Result {
 	result := output.Result{FilePath: path}
 
 	readResult, err := r.Read(path)
@@ -273,36 +1711,61 @@ func searchReader(r input.Reader, path string, m matcher.Matcher, mode searchMod
 		result.Err = err
 		return result
 	}
+	result.Stat = readResult.Stat
 
 	closeReader := func() {
 		if readResult.Closer != nil {
 			readResult.Closer()
+			readResult.Closer = nil
 		}
 	}
+	defer scheduler.ReleaseOnPanic(closeReader)
 
-	if readResult.Data == nil {
+	// Empty input has no lines, so nothing can match, not even a
+	// pattern that matches the empty string, -v, or a whole-file match.
+	if len(readResult.Data) == 0 {
 		closeReader()
+		result.Counted = mode == searchCountOnly
 		return result
 	}
 
-	// Binary detection: skip binary files entirely (like ripgrep)
-	if walker.IsBinary(readResult.Data) {
-		closeReader()
-		return result
+	// Binary detection: skip binary files entirely (like ripgrep) unless -a
+	if bin.paths.IsBinary(path, readResult.Data) {
+		if !bin.search {
+			closeReader()
+			return result
+		}
+		result.Binary = true
 	}
+	result.Size = int64(len(readResult.Data))
 
+	if mode != searchFilesOnly && mode != searchFilesHash && readResult.Prefetch != nil {
+		readResult.Prefetch(len(readResult.Data))
+	}
 	switch mode {
-	case searchFilesOnly:
-		if m.MatchExists(readResult.Data) {
+	case searchFilesOnly, searchFilesHash:
+		if scheduler.MatchExists(m, &readResult) {
 			result.MatchSet = matcher.MatchSet{Matches: []matcher.Match{{}}}
+			if mode == searchFilesHash {
+				result.Hash = readResult.Digest()
+			}
 		}
 		closeReader()
 	case searchCountOnly:
 		count := m.CountAll(readResult.Data)
 		result.MatchCount = count
+		result.Counted = true
 		closeReader()
 	default:
-		result.MatchSet = m.FindAll(readResult.Data)
+		if mode == searchFirst {
+			result.MatchSet = matcher.FindFirst(m, readResult.Data)
+		} else {
+			result.MatchSet = m.FindAll(readResult.Data)
+		}
+		if result.Binary && bin.maxMatches > 0 && len(result.MatchSet.Matches) > bin.maxMatches {
+			result.MatchSet.Matches = result.MatchSet.Matches[:bin.maxMatches]
+		}
+		scheduler.RemapOffsets(&readResult, result.MatchSet.Matches)
 		// MatchSet.Data is the file buffer — pass Closer
 		// to the caller so the buffer stays alive until formatting is done.
 		if result.MatchSet.HasMatch() {
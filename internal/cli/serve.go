@@ -0,0 +1,314 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/dl/gogrep/internal/input"
+	"github.com/dl/gogrep/internal/matcher"
+	"github.com/dl/gogrep/internal/output"
+	"github.com/dl/gogrep/internal/scheduler"
+	"github.com/dl/gogrep/internal/walker"
+	"golang.org/x/sys/unix"
+)
+
+// serveMaxRequest bounds one request line, patterns and all.
+const serveMaxRequest = 1 << 20
+
+// serveCacheSize bounds the file lists and the matchers a server keeps;
+// when one cache is full it is emptied and fills up again.
+const serveCacheSize = 64
+
+// serveRequest is one search asked of a --serve server, a JSON object on
+// one line. Options not given here are those the server was started with.
+type serveRequest struct {
+	ID         string   `json:"id,omitempty"` // echoed in the done or error record
+	Pattern    string   `json:"pattern,omitempty"`
+	Patterns   []string `json:"patterns,omitempty"` // searched with Pattern, if both are given
+	Root       string   `json:"root"`
+	Fixed      bool     `json:"fixed_strings,omitempty"`
+	IgnoreCase bool     `json:"ignore_case,omitempty"`
+	SmartCase  bool     `json:"smart_case,omitempty"`
+	Symbol     bool     `json:"symbol,omitempty"`
+	MaxCount   int      `json:"max_count,omitempty"`
+	Globs      []string `json:"globs,omitempty"`
+	Types      []string `json:"types,omitempty"`
+	TypesNot   []string `json:"types_not,omitempty"`
+	Rescan     bool     `json:"rescan,omitempty"` // walk Root again rather than reuse its file list
+}
+
+// serveDone ends the records of a search.
+type serveDone struct {
+	Type      string `json:"type"`
+	ID        string `json:"id,omitempty"`
+	Files     int    `json:"files"`   // files searched
+	Matched   int    `json:"matched"` // files with a match
+	ElapsedMS int64  `json:"elapsed_ms"`
+}
+
+// serveError answers a request that could not be searched.
+type serveError struct {
+	Type    string `json:"type"`
+	ID      string `json:"id,omitempty"`
+	Message string `json:"message"`
+}
+
+// server answers search requests on a unix socket. What is expensive to
+// build is kept between requests: the file list of each root walked, by
+// the options that shape it, and each compiled matcher, by its patterns
+// and options. Files read stay in the page cache in any case.
+type server struct {
+	base   Config
+	reader input.Reader
+	bin    binaryPolicy
+
+	mu       sync.Mutex
+	files    map[string][]walker.FileEntry
+	matchers map[string]matcher.Matcher
+}
+
+// runServe listens on the unix socket cfg.Serve until SIGINT or SIGTERM,
+// answering each connection's requests in turn: the JSON records of the
+// matches, as --json prints them, then a "done" record, or an "error"
+// record instead.
+func runServe(cfg Config) int {
+	lowerPriority(cfg)
+	os.Remove(cfg.Serve) // a socket left by a server that did not exit cleanly
+	ln, err := net.Listen("unix", cfg.Serve)
+	if err != nil {
+		logWarn("--serve: %v", err)
+		return 2
+	}
+	s := &server{
+		base: cfg,
+		reader: input.NewAdaptiveReaderOptions(input.AdaptiveOptions{
+			MmapThreshold: cfg.MmapThreshold,
+			AutoThreshold: cfg.MmapAuto,
+			SkipHoles:     !cfg.NoSkipHoles,
+		}),
+		bin:      binaryPolicy{paths: binaryOverrides(cfg)},
+		files:    make(map[string][]walker.FileEntry),
+		matchers: make(map[string]matcher.Matcher),
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sig)
+	go func() {
+		<-sig
+		ln.Close() // also removes the socket file
+	}()
+
+	for {
+		conn, err := ln.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return 0
+		}
+		if err != nil {
+			logWarn("--serve: %v", err)
+			continue
+		}
+		go s.serveConn(conn.(*net.UnixConn))
+	}
+}
+
+// serveConn answers the requests read from conn until it is closed.
+func (s *server) serveConn(conn *net.UnixConn) {
+	defer conn.Close()
+	// The Writer writes with writev on a blocking descriptor of its own.
+	f, err := conn.File()
+	if err != nil {
+		logWarn("--serve: %v", err)
+		return
+	}
+	defer f.Close()
+	w := output.NewFileWriter(f)
+
+	sc := bufio.NewScanner(conn)
+	sc.Buffer(make([]byte, 0, 4096), serveMaxRequest)
+	for sc.Scan() && !w.IsClosed() {
+		var req serveRequest
+		if err := json.Unmarshal(sc.Bytes(), &req); err != nil {
+			s.writeRecord(w, serveError{Type: "error", Message: "invalid request: " + err.Error()})
+			continue
+		}
+		if err := s.search(w, req); err != nil {
+			s.writeRecord(w, serveError{Type: "error", ID: req.ID, Message: err.Error()})
+		}
+	}
+}
+
+func (s *server) writeRecord(w *output.Writer, v any) {
+	b, _ := json.Marshal(v)
+	w.Write(append(b, '\n'))
+}
+
+// search runs req and writes its records to w.
+func (s *server) search(w *output.Writer, req serveRequest) error {
+	start := time.Now()
+	cfg := s.base
+	cfg.Serve = ""
+	cfg.Patterns = req.Patterns
+	if req.Pattern != "" {
+		cfg.Patterns = append([]string{req.Pattern}, req.Patterns...)
+	}
+	cfg.Paths = []string{req.Root}
+	cfg.Recursive = true
+	cfg.JSONOutput = true
+	cfg.LineNumbers = true
+	cfg.Fixed = cfg.Fixed || req.Fixed
+	cfg.IgnoreCase = cfg.IgnoreCase || req.IgnoreCase
+	cfg.SmartCase = cfg.SmartCase || req.SmartCase
+	cfg.Symbol = cfg.Symbol || req.Symbol
+	if req.MaxCount > 0 {
+		cfg.MaxCount = req.MaxCount
+	}
+	cfg.Globs = append(cfg.Globs, req.Globs...)
+	cfg.Types = append(cfg.Types, req.Types...)
+	cfg.TypesNot = append(cfg.TypesNot, req.TypesNot...)
+	if len(cfg.Patterns) == 0 {
+		return errors.New("no pattern given")
+	}
+	if req.Root == "" {
+		return errors.New("no root given")
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	globs, err := walker.TypeFilterGlobs(cfg.Types, cfg.TypesNot)
+	if err != nil {
+		return err
+	}
+	cfg.Globs = append(globs, cfg.Globs...)
+
+	m, err := s.matcher(cfg)
+	if err != nil {
+		return err
+	}
+	files, err := s.fileList(cfg, req.Rescan)
+	if err != nil {
+		return err
+	}
+
+	fileCh := make(chan walker.FileEntry, 256)
+	go func() {
+		defer close(fileCh)
+		for _, e := range files {
+			fileCh <- e
+		}
+	}()
+	sched := scheduler.New(cfg.Workers, m, s.reader, false, false, false)
+	sched.OverrideBinary(s.bin.paths)
+	sched.Cancel(w.Closed())
+	matched := 0
+	ow := output.NewOrderedWriter(w, output.NewJSONFormatter(), true)
+	ow.WriteOrdered(sched.Run(fileCh), func() { matched++ })
+	searched, _ := sched.Counts()
+	s.writeRecord(w, serveDone{
+		Type:      "done",
+		ID:        req.ID,
+		Files:     searched,
+		Matched:   matched,
+		ElapsedMS: time.Since(start).Milliseconds(),
+	})
+	return nil
+}
+
+// matcher returns the matcher for cfg's patterns, compiled once for each
+// set of patterns and options.
+func (s *server) matcher(cfg Config) (matcher.Matcher, error) {
+	key := fmt.Sprintf("%q %v %v %v %v %d", cfg.Patterns, cfg.Fixed, cfg.IgnoreCase, cfg.SmartCase, cfg.Symbol, cfg.MaxCount)
+	s.mu.Lock()
+	m, ok := s.matchers[key]
+	s.mu.Unlock()
+	if ok {
+		return m, nil
+	}
+
+	dialect := matcher.DialectDefault
+	switch {
+	case cfg.BasicRegexp:
+		dialect = matcher.DialectBasic
+	case cfg.ExtendedRegexp:
+		dialect = matcher.DialectExtended
+	}
+	if err := resolvePatterns(&cfg, dialect); err != nil {
+		return nil, err
+	}
+	m, err := newLineMatcher(cfg, dialect, 0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %w", err)
+	}
+	m = matcher.NewMaxCountMatcher(m, cfg.MaxCount)
+
+	s.mu.Lock()
+	if len(s.matchers) >= serveCacheSize {
+		clear(s.matchers)
+	}
+	s.matchers[key] = m
+	s.mu.Unlock()
+	return m, nil
+}
+
+// fileList returns the files a recursive walk of cfg's root finds, walking
+// it only the first time for each set of filtering options, or when
+// rescan is set.
+func (s *server) fileList(cfg Config, rescan bool) ([]walker.FileEntry, error) {
+	root := cfg.Paths[0]
+	key := strconv.Quote(root) + " " + strings.Join(cfg.Globs, "\x00")
+	s.mu.Lock()
+	files, ok := s.files[key]
+	s.mu.Unlock()
+	if ok && !rescan {
+		return files, nil
+	}
+
+	var st unix.Stat_t
+	if err := unix.Stat(root, &st); err != nil {
+		return nil, &os.PathError{Op: "stat", Path: root, Err: err}
+	}
+	fileCh, errCh := walker.Walk(cfg.Paths, walker.WalkOptions{
+		Recursive:      true,
+		NoIgnore:       cfg.NoIgnore,
+		Hidden:         cfg.Hidden,
+		HiddenFiles:    cfg.HiddenFiles,
+		HiddenDirs:     cfg.HiddenDirs,
+		HiddenGlobs:    cfg.HiddenGlobs,
+		FollowSymlinks: cfg.FollowSymlinks,
+		IncludeBinary:  cfg.Text,
+		Globs:          cfg.Globs,
+		Binary:         s.bin.paths,
+		Repos:          repoBoundary(cfg),
+		VirtualFS:      cfg.VirtualFS,
+	})
+	errsDone := make(chan struct{})
+	go func() {
+		defer close(errsDone)
+		for err := range errCh {
+			logWarn("walk: %v", err)
+		}
+	}()
+	files = nil
+	for e := range fileCh {
+		files = append(files, e)
+	}
+	<-errsDone
+
+	s.mu.Lock()
+	if len(s.files) >= serveCacheSize {
+		clear(s.files)
+	}
+	s.files[key] = files
+	s.mu.Unlock()
+	return files, nil
+}
@@ -0,0 +1,122 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// serveRecord holds the fields of any record a server writes.
+type serveRecord struct {
+	Type    string `json:"type"`
+	ID      string `json:"id"`
+	File    string `json:"file"`
+	LineNum int    `json:"line_number"`
+	Files   int    `json:"files"`
+	Matched int    `json:"matched"`
+	Message string `json:"message"`
+}
+
+func TestRunServe(t *testing.T) {
+	root := t.TempDir()
+	writeFile := func(name, data string) {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile("a.txt", "hello world\nbye\nhello again\n")
+	writeFile("b.txt", "nothing\n")
+
+	sock := filepath.Join(t.TempDir(), "gogrep.sock")
+	code := make(chan int, 1)
+	go func() { code <- runServe(Config{Serve: sock, Workers: 2}) }()
+
+	var conn net.Conn
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		var err error
+		if conn, err = net.Dial("unix", sock); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	sc := bufio.NewScanner(conn)
+
+	// ask sends a request and returns the records up to its done or
+	// error record.
+	ask := func(req string) []serveRecord {
+		t.Helper()
+		if _, err := conn.Write([]byte(req + "\n")); err != nil {
+			t.Fatal(err)
+		}
+		var recs []serveRecord
+		for sc.Scan() {
+			var r serveRecord
+			if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+				t.Fatalf("record %q: %v", sc.Bytes(), err)
+			}
+			recs = append(recs, r)
+			if r.Type == "done" || r.Type == "error" {
+				return recs
+			}
+		}
+		t.Fatalf("connection ended: %v", sc.Err())
+		return nil
+	}
+
+	req := `{"id":"1","pattern":"hello","root":` + jsonString(root) + `}`
+	recs := ask(req)
+	if len(recs) != 3 {
+		t.Fatalf("records = %+v, want 2 matches and done", recs)
+	}
+	for i, line := range []int{1, 3} {
+		if r := recs[i]; r.Type != "match" || r.File != filepath.Join(root, "a.txt") || r.LineNum != line {
+			t.Errorf("record %d = %+v, want a match on a.txt:%d", i, r, line)
+		}
+	}
+	if done := recs[2]; done.Type != "done" || done.ID != "1" || done.Files != 2 || done.Matched != 1 {
+		t.Errorf("done = %+v, want id 1, 2 files, 1 matched", done)
+	}
+
+	if recs := ask(`{"id":"2","pattern":"hello"}`); len(recs) != 1 || recs[0].Type != "error" || recs[0].ID != "2" || recs[0].Message == "" {
+		t.Errorf("request without a root: %+v, want an error record", recs)
+	}
+	if recs := ask(`{"pattern":`); len(recs) != 1 || recs[0].Type != "error" {
+		t.Errorf("invalid JSON: %+v, want an error record", recs)
+	}
+
+	// A file added after the first walk is found only on a rescan.
+	writeFile("c.txt", "hello there\n")
+	if recs := ask(req); len(recs) != 3 || recs[2].Files != 2 {
+		t.Errorf("second search: %+v, want the cached list of 2 files", recs)
+	}
+	rescan := `{"id":"3","pattern":"hello","rescan":true,"root":` + jsonString(root) + `}`
+	if recs := ask(rescan); len(recs) != 4 || recs[3].Files != 3 || recs[3].Matched != 2 {
+		t.Errorf("rescan: %+v, want 3 files, 2 matched", recs)
+	}
+
+	// The server was accepting, so its signal handler is installed.
+	syscall.Kill(os.Getpid(), syscall.SIGTERM)
+	select {
+	case c := <-code:
+		if c != 0 {
+			t.Errorf("runServe = %d, want 0", c)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("runServe did not stop on SIGTERM")
+	}
+}
+
+func jsonString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
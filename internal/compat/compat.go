@@ -0,0 +1,192 @@
+// Package compat checks gogrep's output against GNU grep and ripgrep. It
+// generates a corpus, runs every tool over it for a matrix of flags and
+// patterns, and compares the normalized output and exit codes, so that a
+// matcher or formatter change that breaks grep compatibility fails a test.
+// The tools are run as binaries: gogrep from bin/gogrep or $GOGREP_BIN,
+// and the references from $PATH when they are installed.
+package compat
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+)
+
+// Tool is a grep-like program and how to call it so that its output is
+// comparable: no color, no config files, C locale.
+type Tool struct {
+	Name string
+	Path string
+	Args []string // before the case's flags
+	Env  []string // added to the environment
+}
+
+// Expect rewrites the output of a reference tool for c into what gogrep
+// prints where it departs from grep on purpose, as ripgrep does too:
+//
+//   - -c prints no count for a file without matches;
+//   - context groups of different files are not separated by "--".
+func Expect(c Case, out Output) Output {
+	lines := strings.SplitAfter(out.Stdout, "\n")
+	kept := lines[:0]
+	for i, l := range lines {
+		switch {
+		case slices.Contains(c.Flags, "-c") && (l == "0\n" || strings.HasSuffix(l, ":0\n")):
+			continue
+		case l == "--\n" && i > 0 && i+1 < len(lines) && fileOf(lines[i-1], c.Files) != fileOf(lines[i+1], c.Files):
+			continue
+		}
+		kept = append(kept, l)
+	}
+	out.Stdout = strings.Join(kept, "")
+	return out
+}
+
+// fileOf returns the name of the file line is from, when it starts with one
+// of files followed by a ':' or '-' separator, or "".
+func fileOf(line string, files []string) string {
+	for _, f := range files {
+		if rest, ok := strings.CutPrefix(line, f); ok && rest != "" && (rest[0] == ':' || rest[0] == '-') {
+			return f
+		}
+	}
+	return ""
+}
+
+// Output is what a tool printed to stdout, normalized, and its exit code.
+type Output struct {
+	Stdout string
+	Exit   int
+}
+
+// Gogrep returns the Tool for the gogrep binary at path, ignoring the
+// user's config file and default flags.
+func Gogrep(path string) Tool {
+	return Tool{
+		Name: "gogrep",
+		Path: path,
+		Env:  []string{"GOGREP_CONFIG_PATH=" + os.DevNull, "GOGREP_DEFAULT_FLAGS="},
+	}
+}
+
+// References returns the reference tools installed: GNU grep, with -E as
+// gogrep's syntax is extended, and ripgrep.
+func References() []Tool {
+	var tools []Tool
+	if path, err := exec.LookPath("grep"); err == nil {
+		// BSD and busybox grep differ in too many details to compare.
+		if out, err := exec.Command(path, "--version").Output(); err == nil && bytes.Contains(out, []byte("GNU grep")) {
+			tools = append(tools, Tool{
+				Name: "grep",
+				Path: path,
+				Args: []string{"-E", "--color=never"},
+				Env:  []string{"LC_ALL=C", "GREP_COLORS="},
+			})
+		}
+	}
+	if path, err := exec.LookPath("rg"); err == nil {
+		tools = append(tools, Tool{
+			Name: "rg",
+			Path: path,
+			Args: []string{"--no-config", "--color=never", "--no-heading"},
+			Env:  []string{"LC_ALL=C"},
+		})
+	}
+	return tools
+}
+
+// Run runs the tool for c in dir, where c's files are.
+func (t Tool) Run(dir string, c Case) (Output, error) {
+	args := append(slices.Clone(t.Args), c.Flags...)
+	args = append(args, "-e", c.Pattern, "--")
+	args = append(args, c.Files...)
+	cmd := exec.Command(t.Path, args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), t.Env...)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	err := cmd.Run()
+	var exit *exec.ExitError
+	if errors.As(err, &exit) {
+		return Output{Stdout: Normalize(stdout.Bytes()), Exit: exit.ExitCode()}, nil
+	}
+	if err != nil {
+		return Output{}, err
+	}
+	return Output{Stdout: Normalize(stdout.Bytes())}, nil
+}
+
+// Case is one search of the matrix.
+type Case struct {
+	Flags   []string
+	Pattern string
+	Files   []string
+}
+
+func (c Case) String() string {
+	var b strings.Builder
+	for _, f := range c.Flags {
+		b.WriteString(f)
+		b.WriteByte(' ')
+	}
+	b.WriteString("-e '")
+	b.WriteString(c.Pattern)
+	b.WriteString("' ")
+	b.WriteString(strings.Join(c.Files, " "))
+	return b.String()
+}
+
+// flagSets are the flags the matrix covers, alone and in the combinations
+// that exercise one formatter path with another.
+var flagSets = [][]string{
+	{},
+	{"-i"},
+	{"-v"},
+	{"-c"},
+	{"-l"},
+	{"-n"},
+	{"-o"},
+	{"-A", "1"},
+	{"-B", "2"},
+	{"-C", "1"},
+	{"-i", "-n"},
+	{"-v", "-n"},
+	{"-i", "-c"},
+	{"-v", "-c"},
+	{"-v", "-l"},
+	{"-i", "-o"},
+	{"-o", "-n"},
+	{"-n", "-C", "1"},
+	{"-i", "-n", "-A", "2"},
+}
+
+// patterns are written in the syntax gogrep, grep -E and ripgrep share:
+// literals, classes, anchors, dots and repetition.
+var patterns = []string{
+	"foo",
+	"ba[rz]",
+	"^qux",
+	"end$",
+	"a.c",
+	"o+ b",
+	"nomatch",
+}
+
+// Matrix returns every case: each flag set with each pattern, over all of
+// files, which prints file names, and over the second alone, which does
+// not.
+func Matrix(files []string) []Case {
+	var cases []Case
+	for _, flags := range flagSets {
+		for _, p := range patterns {
+			cases = append(cases, Case{Flags: flags, Pattern: p, Files: files})
+			if len(files) > 1 {
+				cases = append(cases, Case{Flags: flags, Pattern: p, Files: files[1:2]})
+			}
+		}
+	}
+	return cases
+}
@@ -0,0 +1,100 @@
+package compat
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestCompat runs the matrix with gogrep and every reference tool found.
+// It needs a gogrep binary: make build, or GOGREP_BIN.
+func TestCompat(t *testing.T) {
+	bin := os.Getenv("GOGREP_BIN")
+	if bin == "" {
+		bin = filepath.Join("..", "..", "bin", "gogrep")
+	}
+	bin, err := filepath.Abs(bin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(bin); err != nil {
+		t.Skipf("no gogrep binary at %s (make build, or set GOGREP_BIN)", bin)
+	}
+	refs := References()
+	if len(refs) == 0 {
+		t.Skip("neither GNU grep nor ripgrep is installed")
+	}
+
+	dir := t.TempDir()
+	files, err := Generate(dir, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gogrep := Gogrep(bin)
+	for _, c := range Matrix(files) {
+		got, err := gogrep.Run(dir, c)
+		if err != nil {
+			t.Fatalf("gogrep %v: %v", c, err)
+		}
+		for _, ref := range refs {
+			want, err := ref.Run(dir, c)
+			if err != nil {
+				t.Fatalf("%s %v: %v", ref.Name, c, err)
+			}
+			want = Expect(c, want)
+			if got.Exit != want.Exit {
+				t.Errorf("%v: exit %d, %s exits %d", c, got.Exit, ref.Name, want.Exit)
+			}
+			if d := Diff(got.Stdout, want.Stdout); d != "" {
+				t.Errorf("%v: differs from %s at %s", c, ref.Name, d)
+			}
+		}
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	a, b := t.TempDir(), t.TempDir()
+	names, err := Generate(a, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Generate(b, 7); err != nil {
+		t.Fatal(err)
+	}
+	for i, name := range names {
+		x, _ := os.ReadFile(filepath.Join(a, name))
+		y, _ := os.ReadFile(filepath.Join(b, name))
+		if string(x) != string(y) {
+			t.Errorf("%s differs between runs with the same seed", name)
+		}
+		switch {
+		case i == 0 && len(x) != 0:
+			t.Errorf("%s: %d bytes, want empty", name, len(x))
+		case i == len(names)-1 && (len(x) == 0 || x[len(x)-1] == '\n'):
+			t.Errorf("%s ends with a newline", name)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	out := []byte("\x1b[35m./a.txt\x1b[0m:\x1b[32m3\x1b[0m:\x1b[1;31mfoo\x1b[0m\r\n./b.txt:x ./y\n")
+	if got, want := Normalize(out), "a.txt:3:foo\nb.txt:x ./y\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if d := Diff("a\nb\n", "a\nc\n"); d != `line 2: got "b", want "c" (3 lines, want 3)` {
+		t.Errorf("Diff = %s", d)
+	}
+}
+
+func TestExpect(t *testing.T) {
+	c := Case{Flags: []string{"-c", "-A", "1"}, Files: []string{"a", "b"}}
+	out := Output{Stdout: "a:0\nb:2\n", Exit: 0}
+	if got := Expect(c, out); got.Stdout != "b:2\n" {
+		t.Errorf("-c: got %q", got.Stdout)
+	}
+	c.Flags = []string{"-A", "1"}
+	out.Stdout = "a:x\na-y\n--\na:x\n--\nb:x\n"
+	if got := Expect(c, out); got.Stdout != "a:x\na-y\n--\na:x\nb:x\n" {
+		t.Errorf("context: got %q", got.Stdout)
+	}
+}
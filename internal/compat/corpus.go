@@ -0,0 +1,56 @@
+package compat
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// words make up the corpus lines. The matrix patterns match some of them
+// in several cases and at line starts and ends, and "a-c" matches "a.c"
+// but not a literal search for it.
+var words = []string{
+	"foo", "Foo", "FOO", "bar", "baz", "BAR", "qux", "abc", "a-c", "end",
+	"lorem", "ipsum", "too", "x",
+}
+
+// corpusFiles is the number of files Generate writes.
+const corpusFiles = 8
+
+// Generate writes a corpus of small ASCII text files into dir and returns
+// their names, in the order to search them. The same seed writes the same
+// corpus. The first file is empty, the last lacks a final newline, and
+// some lines are empty, as those are where implementations tend to differ.
+func Generate(dir string, seed uint64) ([]string, error) {
+	rng := rand.New(rand.NewPCG(seed, seed^0x9e3779b97f4a7c15))
+	names := make([]string, 0, corpusFiles)
+	for i := range corpusFiles {
+		var b strings.Builder
+		if i > 0 {
+			for range 5 + rng.IntN(40) {
+				if rng.IntN(10) > 0 {
+					n := 1 + rng.IntN(6)
+					for w := range n {
+						if w > 0 {
+							b.WriteByte(' ')
+						}
+						b.WriteString(words[rng.IntN(len(words))])
+					}
+				}
+				b.WriteByte('\n')
+			}
+		}
+		text := b.String()
+		if i == corpusFiles-1 {
+			text = strings.TrimSuffix(text, "\n")
+		}
+		name := fmt.Sprintf("f%d.txt", i)
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0o644); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
@@ -0,0 +1,45 @@
+package compat
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ansiEscape matches the SGR sequences of colored output.
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+// Normalize returns out with what may differ between tools without being
+// a difference in results taken out: color escapes, CRLF line ends, and a
+// "./" before file names.
+func Normalize(out []byte) string {
+	s := ansiEscape.ReplaceAllString(string(out), "")
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	lines := strings.SplitAfter(s, "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimPrefix(l, "./")
+	}
+	return strings.Join(lines, "")
+}
+
+// Diff describes the first line where got and want differ, or returns ""
+// if they are equal.
+func Diff(got, want string) string {
+	if got == want {
+		return ""
+	}
+	g := strings.Split(got, "\n")
+	w := strings.Split(want, "\n")
+	for i := 0; ; i++ {
+		var gl, wl string
+		if i < len(g) {
+			gl = g[i]
+		}
+		if i < len(w) {
+			wl = w[i]
+		}
+		if gl != wl || i >= len(g) || i >= len(w) {
+			return fmt.Sprintf("line %d: got %q, want %q (%d lines, want %d)", i+1, gl, wl, len(g), len(w))
+		}
+	}
+}
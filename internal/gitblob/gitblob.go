@@ -0,0 +1,130 @@
+// Package gitblob reads the files of a git revision straight from the
+// object database, so a revision can be searched without checking it out.
+package gitblob
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/dl/gogrep/internal/input"
+)
+
+// Tree is the list of blobs of one revision, read on demand through a
+// single `git cat-file --batch` process. It implements input.Reader over
+// the display paths returned by Paths; reads are serialized on the one
+// process, matching runs in parallel on the callers' goroutines.
+type Tree struct {
+	ref   string
+	paths []string          // display paths, in tree order
+	blobs map[string]string // display path -> object id
+
+	mu    sync.Mutex
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	out   *bufio.Reader
+}
+
+// Open lists the regular files of ref below pathspecs (all files if none),
+// relative to the current directory as `git ls-tree` shows them, and
+// starts the reader process. Symlinks and submodules are skipped.
+func Open(ref string, pathspecs []string) (*Tree, error) {
+	args := append([]string{"ls-tree", "-r", "-z", ref, "--"}, pathspecs...)
+	list, err := exec.Command("git", args...).Output()
+	if err != nil {
+		return nil, gitError("ls-tree", err)
+	}
+
+	t := &Tree{ref: ref, blobs: make(map[string]string)}
+	for _, rec := range bytes.Split(list, []byte{0}) {
+		// <mode> SP <type> SP <object> TAB <path>
+		meta, path, ok := bytes.Cut(rec, []byte{'\t'})
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(string(meta))
+		if len(fields) != 3 || fields[1] != "blob" || fields[0] == "120000" {
+			continue
+		}
+		name := ref + ":" + string(path)
+		t.paths = append(t.paths, name)
+		t.blobs[name] = fields[2]
+	}
+
+	t.cmd = exec.Command("git", "cat-file", "--batch")
+	if t.stdin, err = t.cmd.StdinPipe(); err != nil {
+		return nil, err
+	}
+	stdout, err := t.cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := t.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("git cat-file: %w", err)
+	}
+	t.out = bufio.NewReaderSize(stdout, 64<<10)
+	return t, nil
+}
+
+// Paths returns the display paths, "ref:path", in tree order.
+func (t *Tree) Paths() []string {
+	return t.paths
+}
+
+// Read returns the content of the blob at a display path from Paths.
+func (t *Tree) Read(path string) (input.ReadResult, error) {
+	oid, ok := t.blobs[path]
+	if !ok {
+		return input.ReadResult{}, fmt.Errorf("%s: not in %s", path, t.ref)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, err := io.WriteString(t.stdin, oid+"\n"); err != nil {
+		return input.ReadResult{}, fmt.Errorf("git cat-file: %w", err)
+	}
+	// <object> SP <type> SP <size> LF <contents> LF
+	header, err := t.out.ReadString('\n')
+	if err != nil {
+		return input.ReadResult{}, fmt.Errorf("git cat-file: %w", err)
+	}
+	fields := strings.Fields(header)
+	if len(fields) != 3 {
+		return input.ReadResult{}, fmt.Errorf("git cat-file: %s: %s", path, strings.TrimSpace(header))
+	}
+	size, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return input.ReadResult{}, fmt.Errorf("git cat-file: bad header %q", header)
+	}
+	data := make([]byte, size+1)
+	if _, err := io.ReadFull(t.out, data); err != nil {
+		return input.ReadResult{}, fmt.Errorf("git cat-file: %w", err)
+	}
+	if size == 0 {
+		return input.ReadResult{Closer: noop}, nil
+	}
+	return input.ReadResult{Data: data[:size], Closer: noop}, nil
+}
+
+func noop() error { return nil }
+
+// Close stops the reader process.
+func (t *Tree) Close() error {
+	t.stdin.Close()
+	return t.cmd.Wait()
+}
+
+// gitError adds git's own message to a failed command's error.
+func gitError(cmd string, err error) error {
+	var exit *exec.ExitError
+	if errors.As(err, &exit) && len(exit.Stderr) > 0 {
+		return fmt.Errorf("git %s: %s", cmd, strings.TrimSpace(string(exit.Stderr)))
+	}
+	return fmt.Errorf("git %s: %w", cmd, err)
+}
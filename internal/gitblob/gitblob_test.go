@@ -0,0 +1,76 @@
+package gitblob
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func git(t *testing.T, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-c", "user.name=t", "-c", "user.email=t@example.com"}, args...)...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, out)
+	}
+}
+
+func TestTree(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	t.Chdir(dir)
+	git(t, "init", "-q")
+	os.MkdirAll(filepath.Join(dir, "src"), 0755)
+	os.WriteFile(filepath.Join(dir, "src", "a.go"), []byte("old text\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "README"), []byte("readme\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "empty"), nil, 0644)
+	os.Symlink("README", filepath.Join(dir, "link"))
+	git(t, "add", ".")
+	git(t, "commit", "-q", "-m", "first")
+	// The worktree moves on; the revision keeps the old content.
+	os.WriteFile(filepath.Join(dir, "src", "a.go"), []byte("new text\n"), 0644)
+
+	tree, err := Open("HEAD", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tree.Close()
+
+	want := []string{"HEAD:README", "HEAD:empty", "HEAD:src/a.go"}
+	if got := tree.Paths(); !slices.Equal(got, want) {
+		t.Fatalf("Paths() = %q, want %q", got, want)
+	}
+	for _, tt := range []struct{ path, want string }{
+		{"HEAD:src/a.go", "old text\n"},
+		{"HEAD:README", "readme\n"},
+		{"HEAD:empty", ""},
+		{"HEAD:src/a.go", "old text\n"},
+	} {
+		res, err := tree.Read(tt.path)
+		if err != nil {
+			t.Fatalf("Read(%s): %v", tt.path, err)
+		}
+		if string(res.Data) != tt.want {
+			t.Errorf("Read(%s) = %q, want %q", tt.path, res.Data, tt.want)
+		}
+	}
+	if _, err := tree.Read("HEAD:missing"); err == nil {
+		t.Error("Read of an unknown path succeeded")
+	}
+
+	sub, err := Open("HEAD", []string{"src"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+	if got := sub.Paths(); !slices.Equal(got, []string{"HEAD:src/a.go"}) {
+		t.Errorf("with pathspec: Paths() = %q", got)
+	}
+
+	if _, err := Open("no-such-ref", nil); err == nil {
+		t.Error("Open of a bad revision succeeded")
+	}
+}
@@ -0,0 +1,93 @@
+package input
+
+// Strategy is how a file was read.
+type Strategy int
+
+const (
+	StrategyBuffered Strategy = iota // pread into a pooled buffer
+	StrategyMmap                     // memory-mapped
+	StrategySparse                   // data extents only, holes skipped
+)
+
+func (s Strategy) String() string {
+	switch s {
+	case StrategyMmap:
+		return "mmap"
+	case StrategySparse:
+		return "sparse"
+	}
+	return "buffered"
+}
+
+// ReadTrace describes how one file was read, for --debug.
+type ReadTrace struct {
+	Path      string
+	Size      int64
+	Strategy  Strategy
+	Threshold int64 // the mmap threshold in effect for this file
+	Auto      bool  // Threshold was chosen by the auto tuner
+}
+
+// AdaptiveOptions configures NewAdaptiveReaderOptions.
+type AdaptiveOptions struct {
+	// MmapThreshold is the size from which files are memory-mapped.
+	// Ignored with AutoThreshold.
+	MmapThreshold int64
+	// AutoThreshold adapts the threshold at runtime from the observed
+	// throughput of buffered reads and the cost of mappings.
+	AutoThreshold bool
+	// SkipHoles skips holes in large sparse files rather than reading them
+	// as zero pages (see ReadResult.Extents).
+	SkipHoles bool
+	// Trace, if set, is called for every file read, from the reading
+	// goroutine.
+	Trace func(ReadTrace)
+	// Throttle, if set, caps the rate of reads. The auto tuner learns
+	// nothing from throttled reads, so AutoThreshold keeps its start.
+	Throttle *Throttle
+	// LazyPrefetch, with Throttle, leaves reading a mapped file ahead to
+	// the caller, through ReadResult.Prefetch, so that a search stopping
+	// at its first match reads no further.
+	LazyPrefetch bool
+}
+
+// NewAdaptiveReader returns a Reader that opens the file once, stats it via fstat
+// (no path-based stat), then selects between buffered and mmap based on size.
+// This eliminates the redundant unix.Stat + ByteSliceFromString allocation.
+// If skipHoles is true, holes in large sparse files are skipped rather than
+// read as zero pages (see ReadResult.Extents).
+func NewAdaptiveReader(mmapThreshold int64, skipHoles bool) Reader {
+	return NewAdaptiveReaderOptions(AdaptiveOptions{MmapThreshold: mmapThreshold, SkipHoles: skipHoles})
+}
+
+// NewAdaptiveReaderOptions is NewAdaptiveReader with the full set of options.
+func NewAdaptiveReaderOptions(opts AdaptiveOptions) Reader {
+	r := &adaptiveReader{
+		threshold: opts.MmapThreshold,
+		skipHoles: opts.SkipHoles,
+		trace:     opts.Trace,
+		throttle:  opts.Throttle,
+
+		lazyPrefetch: opts.LazyPrefetch,
+	}
+	if opts.AutoThreshold {
+		r.auto = newAutoTuner()
+	}
+	return r
+}
+
+type adaptiveReader struct {
+	threshold int64
+	skipHoles bool
+	auto      *autoTuner // nil = fixed threshold
+	trace     func(ReadTrace)
+	throttle  *Throttle // nil = no limit
+
+	lazyPrefetch bool // leave a throttled mapping's read-ahead to the caller
+}
+
+func (r *adaptiveReader) traceRead(path string, size int64, s Strategy, threshold int64) {
+	if r.trace != nil {
+		r.trace(ReadTrace{Path: path, Size: size, Strategy: s, Threshold: threshold, Auto: r.auto != nil})
+	}
+}
@@ -0,0 +1,102 @@
+package input
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The auto threshold weighs the two ways of reading a file. A buffered
+// read copies every page out of the page cache; a mapping avoids the copy
+// but pays a fixed cost per file (mmap, munmap and the TLB shootdown) and
+// then faults the pages in. The tuner measures buffered read throughput and
+// the fixed cost of mappings as the search runs, and puts the threshold
+// where the two break even.
+const (
+	autoStartThreshold = 8 << 20  // until autoWarmup reads have been observed
+	autoMinThreshold   = 1 << 20  // below this, per-file costs dominate either way
+	autoMaxThreshold   = 64 << 20 // when mapping does not pay off
+	autoMinSample      = 64 << 10 // smaller reads measure syscall overhead, not throughput
+	autoWarmup         = 8        // buffered reads observed before the first retune
+
+	// faultRate is the assumed rate, in bytes/ns, at which a mapping
+	// faults in pages that are already cached (with kernel fault-around).
+	faultRate = 10.0
+	// coldRate: buffered reads slower than this, in bytes/ns, are waiting
+	// on the disk. Faults on a mapping would wait just the same, so
+	// mapping saves nothing.
+	coldRate = 1.0
+
+	defaultMmapCost = 30 * time.Microsecond // until a mapping has been timed
+	ewmaWeight      = 0.125
+)
+
+// autoTuner adapts the mmap threshold to observed reads. It is shared by
+// all scheduler workers.
+type autoTuner struct {
+	threshold atomic.Int64
+
+	mu       sync.Mutex
+	readRate float64 // moving average of buffered read throughput, bytes/ns
+	mmapCost float64 // moving average of mmap plus munmap time, ns
+	samples  int     // buffered reads observed
+}
+
+func newAutoTuner() *autoTuner {
+	t := &autoTuner{mmapCost: float64(defaultMmapCost)}
+	t.threshold.Store(autoStartThreshold)
+	return t
+}
+
+// current returns the threshold to use for the next file.
+func (t *autoTuner) current() int64 {
+	return t.threshold.Load()
+}
+
+// observeRead records a buffered read of size bytes that took d.
+func (t *autoTuner) observeRead(size int64, d time.Duration) {
+	if size < autoMinSample || d <= 0 {
+		return
+	}
+	rate := float64(size) / float64(d)
+	t.mu.Lock()
+	if t.samples == 0 {
+		t.readRate = rate
+	} else {
+		t.readRate = ewma(t.readRate, rate)
+	}
+	t.samples++
+	t.retune()
+	t.mu.Unlock()
+}
+
+// observeMap records the fixed cost d of mapping and unmapping one file.
+func (t *autoTuner) observeMap(d time.Duration) {
+	t.mu.Lock()
+	t.mmapCost = ewma(t.mmapCost, float64(d))
+	t.retune()
+	t.mu.Unlock()
+}
+
+// retune updates the threshold once enough reads have been seen. t.mu
+// must be held.
+func (t *autoTuner) retune() {
+	if t.samples >= autoWarmup {
+		t.threshold.Store(breakEven(t.readRate, t.mmapCost))
+	}
+}
+
+func ewma(avg, x float64) float64 {
+	return avg + (x-avg)*ewmaWeight
+}
+
+// breakEven returns the file size at which mapping costs as much as a
+// buffered read: size/readRate = mmapCost + size/faultRate, clamped to
+// [autoMinThreshold, autoMaxThreshold].
+func breakEven(readRate, mmapCost float64) int64 {
+	if readRate < coldRate || readRate >= faultRate {
+		return autoMaxThreshold
+	}
+	size := mmapCost / (1/readRate - 1/faultRate)
+	return int64(min(max(size, autoMinThreshold), autoMaxThreshold))
+}
@@ -1,29 +1,24 @@
+//go:build linux
+
 package input
 
 import (
 	"fmt"
-	"sync"
 
 	"golang.org/x/sys/unix"
 )
 
-// bufPool pools read buffers to reduce per-file heap allocations.
-// Buffers are stored as *[]byte so the pool can reuse the backing array
-// even when the slice grows beyond its original capacity.
-var bufPool = sync.Pool{
-	New: func() any {
-		b := make([]byte, 0, 64*1024) // 64KB initial capacity
-		return &b
-	},
-}
-
 // BufferedReader reads files using unix.Open with O_NOATIME and unix.Pread.
 // Uses sync.Pool to reuse buffers across files, avoiding per-file heap allocation.
-type BufferedReader struct{}
+type BufferedReader struct {
+	// SkipHoles skips holes in large sparse files rather than reading them
+	// as zero pages (see ReadResult.Extents).
+	SkipHoles bool
+}
 
-// NewBufferedReader creates a new BufferedReader.
+// NewBufferedReader creates a new BufferedReader that skips holes.
 func NewBufferedReader() *BufferedReader {
-	return &BufferedReader{}
+	return &BufferedReader{SkipHoles: true}
 }
 
 func (r *BufferedReader) Read(path string) (ReadResult, error) {
@@ -39,16 +34,91 @@ func (r *BufferedReader) Read(path string) (ReadResult, error) {
 	}
 
 	if stat.Size == 0 {
-		unix.Close(fd)
-		return ReadResult{Data: nil, Closer: noopCloser}, nil
+		res, err := readUnsized(fd, nil)
+		if err != nil {
+			return ReadResult{}, fmt.Errorf("read %s: %w", path, err)
+		}
+		res.Stat = statOf(&stat)
+		return res, nil
+	}
+
+	if r.SkipHoles && hasHoles(&stat) {
+		if res, ok, err := readSparse(fd, stat.Size, nil); ok {
+			if err != nil {
+				return ReadResult{}, fmt.Errorf("read %s: %w", path, err)
+			}
+			res.Stat = statOf(&stat)
+			return res, nil
+		}
+	}
+
+	res, err := readBuffered(fd, stat.Size, nil)
+	res.Stat = statOf(&stat)
+	return res, err
+}
+
+// readUnsized reads a file whose stat reports size 0 from an already-open
+// fd until EOF. Most such files are empty, which costs one read and yields
+// nil Data, but procfs and sysfs files report 0 and still have content,
+// which grep searches like any other file's. Reading stops with
+// ErrUnsizedTooLarge past maxUnsizedRead bytes, so a file that never ends
+// does not take all memory. Reads wait on t, if not nil. Takes ownership
+// of fd.
+func readUnsized(fd int, t *Throttle) (ReadResult, error) {
+	bp := bufPool.Get().(*[]byte)
+	buf := (*bp)[:cap(*bp)]
+	total := 0
+	for {
+		if total == len(buf) {
+			if total >= maxUnsizedRead {
+				unix.Close(fd)
+				bufPool.Put(bp) // with its old buffer, not this one
+				return ReadResult{}, ErrUnsizedTooLarge
+			}
+			buf = append(buf, make([]byte, min(max(len(buf), 4096), maxUnsizedRead-total))...)
+			buf = buf[:cap(buf)]
+		}
+		n, err := unix.Read(fd, buf[total:total+t.take(len(buf)-total)])
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			unix.Close(fd)
+			*bp = buf
+			bufPool.Put(bp)
+			return ReadResult{}, err
+		}
+		if n == 0 {
+			break
+		}
+		total += n
 	}
+	unix.Close(fd)
 
-	return readBuffered(fd, stat.Size)
+	if total == 0 {
+		*bp = buf
+		bufPool.Put(bp)
+		return ReadResult{Closer: noopCloser}, nil
+	}
+	return ReadResult{
+		Data: buf[:total],
+		Closer: func() error {
+			if poison.Load() {
+				for i := range buf {
+					buf[i] = PoisonByte
+				}
+			}
+			*bp = buf
+			bufPool.Put(bp)
+			return nil
+		},
+	}, nil
 }
 
-// readBuffered reads a file from an already-open fd into a pooled buffer.
+// readBuffered reads a file from an already-open fd into a pooled buffer,
+// waiting on t, if not nil, before each piece.
 // Takes ownership of fd — caller must not close it.
-func readBuffered(fd int, size int64) (ReadResult, error) {
+func readBuffered(fd int, size int64, t *Throttle) (ReadResult, error) {
 	// Get a pooled buffer and grow it to fit the file
 	bp := bufPool.Get().(*[]byte)
 	buf := *bp
@@ -61,7 +131,7 @@ func readBuffered(fd int, size int64) (ReadResult, error) {
 	// Read the entire file using pread (no seek state)
 	var totalRead int
 	for totalRead < int(size) {
-		n, err := unix.Pread(fd, buf[totalRead:], int64(totalRead))
+		n, err := unix.Pread(fd, buf[totalRead:totalRead+t.take(int(size)-totalRead)], int64(totalRead))
 		if err != nil {
 			unix.Close(fd)
 			*bp = buf
@@ -79,6 +149,11 @@ func readBuffered(fd int, size int64) (ReadResult, error) {
 	return ReadResult{
 		Data: buf[:totalRead],
 		Closer: func() error {
+			if poison.Load() {
+				for i := range buf {
+					buf[i] = PoisonByte
+				}
+			}
 			*bp = buf
 			bufPool.Put(bp)
 			return nil
@@ -0,0 +1,155 @@
+package input
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+// DiffFile is what a unified diff adds to one file: the added lines,
+// gathered into a buffer to search as if it were the file, and where each
+// of them lands in the new version of the file.
+type DiffFile struct {
+	Path string // the file's new name, without git's "b/" prefix
+	Data []byte // the added lines without their '+', each ending in '\n'
+
+	lines []int   // new line number of each line of Data
+	shift []int64 // offset in the diff minus offset in Data, per line
+}
+
+// ParseDiff splits a unified diff, as git diff or diff -u print it, into
+// the files it changes, in order. A file the diff deletes is left out; a
+// file with no added lines is kept, with no Data. Lines that are not part
+// of a file header or a hunk, such as git's "diff --git" and "index"
+// lines or a mail around a patch, are skipped.
+func ParseDiff(data []byte) []DiffFile {
+	var files []DiffFile
+	cur := -1
+	var oldPath string
+	oldLeft, newLeft, line := 0, 0, 0
+	for off := 0; off < len(data); {
+		start := off
+		end := bytes.IndexByte(data[off:], '\n')
+		if end < 0 {
+			end = len(data)
+			off = end
+		} else {
+			end += off
+			off = end + 1
+		}
+		text := data[start:end]
+
+		if oldLeft > 0 || newLeft > 0 {
+			switch {
+			case len(text) == 0 || text[0] == ' ' || text[0] == '\r':
+				// Context; some tools strip the space of an empty one.
+				oldLeft--
+				newLeft--
+				line++
+			case text[0] == '+':
+				if cur >= 0 {
+					files[cur].add(text[1:], line, int64(start+1))
+				}
+				newLeft--
+				line++
+			case text[0] == '-':
+				oldLeft--
+			case text[0] == '\\':
+				// "\ No newline at end of file"
+			default:
+				// A hunk shorter than its header says: resync on headers.
+				oldLeft, newLeft = 0, 0
+			}
+			continue
+		}
+
+		switch {
+		case bytes.HasPrefix(text, []byte("--- ")):
+			oldPath = diffPath(text[4:])
+		case bytes.HasPrefix(text, []byte("+++ ")):
+			path := diffPath(text[4:])
+			cur = -1
+			if path == "/dev/null" {
+				break
+			}
+			if (strings.HasPrefix(oldPath, "a/") || oldPath == "/dev/null") && strings.HasPrefix(path, "b/") {
+				path = path[2:]
+			}
+			files = append(files, DiffFile{Path: path})
+			cur = len(files) - 1
+		case bytes.HasPrefix(text, []byte("@@ ")):
+			oldLeft, newLeft, line = parseHunk(text)
+		}
+	}
+	return files
+}
+
+// add appends an added line, found at diffOff in the diff, as line n of
+// the new file.
+func (f *DiffFile) add(text []byte, n int, diffOff int64) {
+	f.lines = append(f.lines, n)
+	f.shift = append(f.shift, diffOff-int64(len(f.Data)))
+	f.Data = append(f.Data, text...)
+	f.Data = append(f.Data, '\n')
+}
+
+// Position maps a line of f.Data, by its 1-based number, and a byte
+// offset in f.Data on that line to the file's coordinates: the line's
+// number in the new file, and the offset in the diff, as the file's own
+// offsets are not known from a diff. A line number out of range is
+// returned unchanged.
+func (f *DiffFile) Position(lineNum int, off int64) (int, int64) {
+	if lineNum < 1 || lineNum > len(f.lines) {
+		return lineNum, off
+	}
+	return f.lines[lineNum-1], off + f.shift[lineNum-1]
+}
+
+// diffPath returns the path of a "---" or "+++" header line: without the
+// timestamp diff -u appends after a tab, and unquoted if git quoted it.
+func diffPath(b []byte) string {
+	s := string(bytes.TrimRight(b, "\r"))
+	if i := strings.IndexByte(s, '\t'); i >= 0 {
+		s = s[:i]
+	}
+	if strings.HasPrefix(s, `"`) {
+		if u, err := strconv.Unquote(s); err == nil {
+			s = u
+		}
+	}
+	return s
+}
+
+// parseHunk returns the old and new line counts of a hunk header,
+// "@@ -l,s +c,d @@", and its first new line number c. A count left out is
+// 1. A malformed header gives an empty hunk.
+func parseHunk(text []byte) (oldCount, newCount, newStart int) {
+	fields := strings.Fields(string(text[3:]))
+	if len(fields) < 2 || fields[0][0] != '-' || fields[1][0] != '+' {
+		return 0, 0, 0
+	}
+	_, oldCount, ok1 := hunkRange(fields[0][1:])
+	newStart, newCount, ok2 := hunkRange(fields[1][1:])
+	if !ok1 || !ok2 {
+		return 0, 0, 0
+	}
+	return oldCount, newCount, newStart
+}
+
+// hunkRange parses "start,count" or "start".
+func hunkRange(s string) (start, count int, ok bool) {
+	count = 1
+	if i := strings.IndexByte(s, ','); i >= 0 {
+		c, err := strconv.Atoi(s[i+1:])
+		if err != nil || c < 0 {
+			return 0, 0, false
+		}
+		count = c
+		s = s[:i]
+	}
+	start, err := strconv.Atoi(s)
+	if err != nil || start < 0 {
+		return 0, 0, false
+	}
+	return start, count, true
+}
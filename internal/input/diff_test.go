@@ -0,0 +1,65 @@
+package input
+
+import "testing"
+
+const testDiff = `diff --git a/main.go b/main.go
+index 1111111..2222222 100644
+--- a/main.go
++++ b/main.go
+@@ -10,4 +10,5 @@ func main() {
+ 	a := 1
+-	b := 2
++	b := 3
++	c := 4
+
+ 	fmt.Println(a)
+@@ -40,2 +41,3 @@ func f() {
+ 	return
++	// TODO: more
+ }
+diff --git a/old.txt b/old.txt
+deleted file mode 100644
+--- a/old.txt
++++ /dev/null
+@@ -1,2 +0,0 @@
+-+++ not a header
+-gone
+--- /dev/null
++++ "b/with space.txt"	2026-10-16 12:00:00
+@@ -0,0 +1,2 @@
++first
++last
+\ No newline at end of file
+`
+
+func TestParseDiff(t *testing.T) {
+	files := ParseDiff([]byte(testDiff))
+	if len(files) != 2 {
+		t.Fatalf("got %d files, want 2: %+v", len(files), files)
+	}
+
+	f := files[0]
+	if f.Path != "main.go" {
+		t.Errorf("path = %q, want main.go", f.Path)
+	}
+	if want := "\tb := 3\n\tc := 4\n\t// TODO: more\n"; string(f.Data) != want {
+		t.Errorf("data = %q, want %q", f.Data, want)
+	}
+	for _, tt := range []struct {
+		line     int
+		off      int64
+		wantLine int
+	}{{1, 0, 11}, {3, 16, 42}} {
+		line, off := f.Position(tt.line, tt.off)
+		if line != tt.wantLine {
+			t.Errorf("line %d: new line number %d, want %d", tt.line, line, tt.wantLine)
+		}
+		if got := testDiff[off : off+3]; got != string(f.Data[tt.off:tt.off+3]) {
+			t.Errorf("line %d: offset %d is at %q in the diff", tt.line, off, got)
+		}
+	}
+
+	if f := files[1]; f.Path != "with space.txt" || string(f.Data) != "first\nlast\n" || f.lines[1] != 2 {
+		t.Errorf("new file = %q %q %v", f.Path, f.Data, f.lines)
+	}
+}
@@ -0,0 +1,40 @@
+package input
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+)
+
+// zeroPage feeds the zeros of expanded holes to the hash.
+var zeroPage [64 << 10]byte
+
+// Digest returns the hex SHA-256 of the file's content, as sha256sum would
+// print it. It hashes the buffer the search already read; holes collapsed
+// by a sparse read are expanded back to zeros.
+func (r *ReadResult) Digest() string {
+	if r.Prefetch != nil {
+		r.Prefetch(len(r.Data))
+	}
+	h := sha256.New()
+	if r.Extents == nil {
+		h.Write(r.Data)
+	} else {
+		var off int64
+		for _, e := range r.Extents {
+			writeZeros(h, e.FileOff-off)
+			h.Write(r.Data[e.DataOff : e.DataOff+e.Len])
+			off = e.FileOff + int64(e.Len)
+		}
+		writeZeros(h, r.Size-off)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func writeZeros(w io.Writer, n int64) {
+	for n > 0 {
+		chunk := min(n, int64(len(zeroPage)))
+		w.Write(zeroPage[:chunk])
+		n -= chunk
+	}
+}
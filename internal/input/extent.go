@@ -0,0 +1,29 @@
+package input
+
+import "sort"
+
+// Extent maps a run of ReadResult.Data back to its position in the file.
+type Extent struct {
+	FileOff int64 // offset of the run in the file
+	DataOff int   // offset of the run in Data
+	Len     int
+}
+
+// FileOffset maps an offset in r.Data back to the file. Offsets inside a
+// collapsed hole map to the hole's start. Without extents it is the identity.
+func (r *ReadResult) FileOffset(pos int64) int64 {
+	if r.Extents == nil {
+		return pos
+	}
+	// Last extent starting at or before pos.
+	i := sort.Search(len(r.Extents), func(i int) bool { return int64(r.Extents[i].DataOff) > pos }) - 1
+	if i < 0 {
+		return 0 // leading hole marker
+	}
+	e := r.Extents[i]
+	rel := pos - int64(e.DataOff)
+	if rel >= int64(e.Len) {
+		return e.FileOff + int64(e.Len) // marker of the hole after e
+	}
+	return e.FileOff + rel
+}
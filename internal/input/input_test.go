@@ -2,9 +2,12 @@ package input
 
 import (
 	"bytes"
+	"errors"
 	"os"
 	"path/filepath"
+	"runtime"
 	"testing"
+	"time"
 )
 
 func TestBufferedReader_Read(t *testing.T) {
@@ -28,6 +31,27 @@ func TestBufferedReader_Read(t *testing.T) {
 	}
 }
 
+func TestBufferedReader_PoisonOnClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.txt")
+	if err := os.WriteFile(path, []byte("secret line\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	SetPoison(true)
+	defer SetPoison(false)
+
+	result, err := NewBufferedReader().Read(path)
+	if err != nil {
+		t.Fatalf("Read() error: %v", err)
+	}
+	data := result.Data
+	result.Closer()
+
+	if !bytes.Equal(data, bytes.Repeat([]byte{PoisonByte}, len(data))) {
+		t.Errorf("released buffer = %q, want poisoned", data)
+	}
+}
+
 func TestBufferedReader_EmptyFile(t *testing.T) {
 	dir := t.TempDir()
 	path := filepath.Join(dir, "empty.txt")
@@ -47,6 +71,56 @@ func TestBufferedReader_EmptyFile(t *testing.T) {
 	}
 }
 
+// TestReader_ZeroSizePseudoFile reads a procfs file, whose stat size is 0
+// although it has content, with every reader.
+func TestReader_ZeroSizePseudoFile(t *testing.T) {
+	const path = "/proc/self/status"
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Skipf("%s: %v", path, err)
+	}
+	if st, err := os.Stat(path); err != nil || st.Size() != 0 {
+		t.Skipf("%s: stat size not 0", path)
+	}
+
+	for name, r := range map[string]Reader{
+		"buffered": NewBufferedReader(),
+		"mmap":     NewMmapReader(),
+		"adaptive": NewAdaptiveReader(8<<20, false),
+	} {
+		result, err := r.Read(path)
+		if err != nil {
+			t.Fatalf("%s: Read() error: %v", name, err)
+		}
+		// The status of this process: the first line names it and stays
+		// the same between reads.
+		line, _, _ := bytes.Cut(want, []byte{'\n'})
+		if !bytes.HasPrefix(result.Data, line) {
+			t.Errorf("%s: data = %.40q, want content starting %q", name, result.Data, line)
+		}
+		result.Closer()
+	}
+}
+
+func TestReader_EndlessUnsizedFile(t *testing.T) {
+	const path = "/dev/zero"
+	if _, err := os.Stat(path); err != nil {
+		t.Skipf("%s: %v", path, err)
+	}
+	defer func(n int) { maxUnsizedRead = n }(maxUnsizedRead)
+	maxUnsizedRead = 1 << 20
+
+	for name, r := range map[string]Reader{
+		"buffered": NewBufferedReader(),
+		"mmap":     NewMmapReader(),
+		"adaptive": NewAdaptiveReader(8<<20, false),
+	} {
+		if _, err := r.Read(path); !errors.Is(err, ErrUnsizedTooLarge) {
+			t.Errorf("%s: Read() error = %v, want ErrUnsizedTooLarge", name, err)
+		}
+	}
+}
+
 func TestBufferedReader_NonexistentFile(t *testing.T) {
 	r := NewBufferedReader()
 	_, err := r.Read("/nonexistent/path/file.txt")
@@ -132,7 +206,7 @@ func TestAdaptiveReader_SmallFile(t *testing.T) {
 	}
 
 	// Threshold of 1MB — small file should use buffered reader
-	r := NewAdaptiveReader(1024 * 1024)
+	r := NewAdaptiveReader(1024*1024, true)
 	result, err := r.Read(path)
 	if err != nil {
 		t.Fatalf("Read() error: %v", err)
@@ -155,7 +229,7 @@ func TestAdaptiveReader_LargeFile(t *testing.T) {
 	}
 
 	// Threshold of 1MB — large file should use mmap reader
-	r := NewAdaptiveReader(1024 * 1024)
+	r := NewAdaptiveReader(1024*1024, true)
 	result, err := r.Read(path)
 	if err != nil {
 		t.Fatalf("Read() error: %v", err)
@@ -171,7 +245,7 @@ func TestAdaptiveReader_LargeFile(t *testing.T) {
 }
 
 func TestAdaptiveReader_NonexistentFile(t *testing.T) {
-	r := NewAdaptiveReader(1024 * 1024)
+	r := NewAdaptiveReader(1024*1024, true)
 	_, err := r.Read("/nonexistent/path/file.txt")
 	if err == nil {
 		t.Error("expected error for nonexistent file")
@@ -244,3 +318,303 @@ func BenchmarkMmapReader_LargeFile(b *testing.B) {
 		result.Closer()
 	}
 }
+
+func TestAdaptiveReader_SparseFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sparse.img")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const size = 8 << 20
+	f.WriteAt([]byte("head\n"), 0)
+	f.WriteAt([]byte("mid\n"), 4<<20)
+	f.Truncate(size)
+	f.Close()
+
+	r := NewAdaptiveReader(1024*1024, true)
+	result, err := r.Read(path)
+	if err != nil {
+		t.Fatalf("Read() error: %v", err)
+	}
+	defer result.Closer()
+	if result.Extents == nil {
+		t.Skip("filesystem does not report holes")
+	}
+	if len(result.Data) >= size {
+		t.Fatalf("read %d bytes, holes not skipped", len(result.Data))
+	}
+	if bytes.Count(result.Data, []byte("\n")) != 2 {
+		t.Errorf("newlines not preserved: %q", bytes.Trim(result.Data, "\x00"))
+	}
+
+	mid := bytes.Index(result.Data, []byte("mid"))
+	if mid < 0 {
+		t.Fatal("data after hole missing")
+	}
+	if got := result.FileOffset(int64(mid)); got != 4<<20 {
+		t.Errorf("FileOffset(%d) = %d, want %d", mid, got, 4<<20)
+	}
+	if got := result.FileOffset(0); got != 0 {
+		t.Errorf("FileOffset(0) = %d, want 0", got)
+	}
+
+	// Disabled: the whole file is read.
+	full, err := NewAdaptiveReader(1024*1024, false).Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer full.Closer()
+	if len(full.Data) != size || full.Extents != nil {
+		t.Errorf("skipHoles=false: len = %d, extents = %v", len(full.Data), full.Extents)
+	}
+
+	// Holes are hashed as the zeros they read as.
+	if got, want := result.Digest(), full.Digest(); got != want {
+		t.Errorf("sparse Digest() = %s, want %s", got, want)
+	}
+}
+
+func TestSparseFile_Readers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sparse.img")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const size = 8 << 20
+	f.WriteAt([]byte("mid\n"), 4<<20)
+	f.Truncate(size)
+	f.Close()
+
+	// Poisoned pooled buffers must not leak into the hole markers.
+	SetPoison(true)
+	defer SetPoison(false)
+	for name, r := range map[string]Reader{
+		"buffered": NewBufferedReader(),
+		"mmap":     NewMmapReader(),
+	} {
+		for range 2 {
+			result, err := r.Read(path)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if result.Extents == nil {
+				result.Closer()
+				t.Skip("filesystem does not report holes")
+			}
+			if !bytes.HasPrefix(result.Data, []byte("\x00mid\n")) || bytes.IndexByte(result.Data, PoisonByte) >= 0 {
+				t.Errorf("%s: data = %q…, want a hole marker, mid and NULs", name, result.Data[:min(len(result.Data), 16)])
+			}
+			result.Closer()
+		}
+	}
+
+	for name, r := range map[string]Reader{
+		"buffered": &BufferedReader{},
+		"mmap":     &MmapReader{},
+	} {
+		result, err := r.Read(path)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(result.Data) != size || result.Extents != nil {
+			t.Errorf("%s without SkipHoles: len = %d, extents = %v", name, len(result.Data), result.Extents)
+		}
+		result.Closer()
+	}
+}
+
+func TestReadResult_Digest(t *testing.T) {
+	r := ReadResult{Data: []byte("abc")}
+	want := "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+	if got := r.Digest(); got != want {
+		t.Errorf("Digest() = %s, want %s", got, want)
+	}
+}
+
+func TestBreakEven(t *testing.T) {
+	cost := float64(30 * time.Microsecond)
+	if got := breakEven(0.3, cost); got != autoMaxThreshold {
+		t.Errorf("cold reads: threshold = %d, want max", got)
+	}
+	if got := breakEven(faultRate*2, cost); got != autoMaxThreshold {
+		t.Errorf("reads faster than faults: threshold = %d, want max", got)
+	}
+	// 9 bytes/ns against 10 for faults: 30µs / (1/9 - 1/10) ns/byte = 2.7 MB.
+	if got := breakEven(9, cost); got < 2_600_000 || got > 2_800_000 {
+		t.Errorf("hot reads: threshold = %d, want about 2.7 MB", got)
+	}
+	if got := breakEven(2, cost); got != autoMinThreshold {
+		t.Errorf("slow copies: threshold = %d, want min", got)
+	}
+}
+
+func TestAutoTuner(t *testing.T) {
+	tu := newAutoTuner()
+	for range autoWarmup - 1 {
+		tu.observeRead(1<<20, 100*time.Microsecond) // ~10 bytes/ns, cached
+	}
+	if got := tu.current(); got != autoStartThreshold {
+		t.Fatalf("before warmup: threshold = %d, want %d", got, autoStartThreshold)
+	}
+	tu.observeRead(1<<10, time.Nanosecond) // too small to count
+	if got := tu.current(); got != autoStartThreshold {
+		t.Fatalf("small read counted: threshold = %d", got)
+	}
+
+	// Reads from disk: mapping saves nothing.
+	for range 4 * autoWarmup {
+		tu.observeRead(1<<20, 5*time.Millisecond)
+	}
+	if got := tu.current(); got != autoMaxThreshold {
+		t.Errorf("cold reads: threshold = %d, want %d", got, autoMaxThreshold)
+	}
+}
+
+func TestAdaptiveReader_Trace(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("portable build reads every file buffered")
+	}
+	dir := t.TempDir()
+	small := filepath.Join(dir, "small")
+	big := filepath.Join(dir, "big")
+	os.WriteFile(small, []byte("x\n"), 0644)
+	os.WriteFile(big, bytes.Repeat([]byte("y\n"), 1024), 0644)
+
+	var traces []ReadTrace
+	r := NewAdaptiveReaderOptions(AdaptiveOptions{
+		MmapThreshold: 1024,
+		Trace:         func(tr ReadTrace) { traces = append(traces, tr) },
+	})
+	for _, p := range []string{small, big} {
+		res, err := r.Read(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Closer()
+	}
+	if len(traces) != 2 {
+		t.Fatalf("got %d traces, want 2", len(traces))
+	}
+	if traces[0].Strategy != StrategyBuffered || traces[1].Strategy != StrategyMmap {
+		t.Errorf("strategies = %v, %v; want buffered, mmap", traces[0].Strategy, traces[1].Strategy)
+	}
+	if traces[1].Size != 2048 || traces[1].Threshold != 1024 || traces[1].Auto {
+		t.Errorf("trace = %+v", traces[1])
+	}
+}
+
+func TestAdaptiveReader_Stat(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("portable build has no inode numbers")
+	}
+	path := filepath.Join(t.TempDir(), "f.txt")
+	os.WriteFile(path, []byte("hello\n"), 0640)
+	mtime := time.Unix(1_700_000_000, 0)
+	os.Chtimes(path, mtime, mtime)
+
+	res, err := NewAdaptiveReader(1<<20, true).Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Closer()
+	s := res.Stat
+	if !s.Known() || s.Size != 6 || s.Ino == 0 || s.Mode&0o777 != 0o640 || s.Mtime != mtime.UnixNano() {
+		t.Errorf("Stat = %+v", s)
+	}
+}
+
+// fakeThrottle returns a Throttle on a fake clock that sleeping advances,
+// and the total time slept.
+func fakeThrottle(bytesPerSec int64) (*Throttle, *time.Duration) {
+	clock := time.Unix(0, 0)
+	slept := new(time.Duration)
+	th := NewThrottle(bytesPerSec)
+	th.now = func() time.Time { return clock }
+	th.last = clock
+	th.sleep = func(d time.Duration) {
+		*slept += d
+		clock = clock.Add(d)
+	}
+	return th, slept
+}
+
+func TestThrottle(t *testing.T) {
+	th, slept := fakeThrottle(1000)
+	th.Wait(1000) // the first second's worth
+	if *slept != 0 {
+		t.Fatalf("slept %v on the burst, want 0", *slept)
+	}
+	th.Wait(500)
+	th.Wait(500)
+	if *slept != time.Second {
+		t.Errorf("slept %v, want 1s", *slept)
+	}
+
+	var none *Throttle
+	none.Wait(1 << 30)
+	if got := none.take(5 << 20); got != 5<<20 {
+		t.Errorf("nil take = %d, want all of it", got)
+	}
+}
+
+func TestAdaptiveReader_Throttle(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "big.txt")
+	content := bytes.Repeat([]byte("0123456789abcdef"), 3*throttleChunk/16)
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, threshold := range []int64{1 << 30, 1 << 20} { // buffered, then mmap
+		th, slept := fakeThrottle(throttleChunk)
+		r := NewAdaptiveReaderOptions(AdaptiveOptions{MmapThreshold: threshold, Throttle: th})
+		result, err := r.Read(path)
+		if err != nil {
+			t.Fatalf("threshold %d: Read() error: %v", threshold, err)
+		}
+		if !bytes.Equal(result.Data, content) {
+			t.Errorf("threshold %d: data differs", threshold)
+		}
+		result.Closer()
+		// One chunk comes out of the burst; the other two wait a second each.
+		if *slept != 2*time.Second {
+			t.Errorf("threshold %d: slept %v, want 2s", threshold, *slept)
+		}
+	}
+}
+
+func TestAdaptiveReader_LazyPrefetch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "big.txt")
+	content := bytes.Repeat([]byte("0123456789abcdef"), 3*throttleChunk/16)
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	th, slept := fakeThrottle(throttleChunk)
+	r := NewAdaptiveReaderOptions(AdaptiveOptions{MmapThreshold: 1 << 20, Throttle: th, LazyPrefetch: true})
+	result, err := r.Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer result.Closer()
+	if result.Prefetch == nil {
+		t.Fatal("Prefetch not set")
+	}
+	// The first chunk comes out of the burst; each further one waits.
+	result.Prefetch(10)
+	if *slept != 0 {
+		t.Errorf("first chunk: slept %v, want 0", *slept)
+	}
+	result.Prefetch(throttleChunk + 1)
+	if *slept != time.Second {
+		t.Errorf("second chunk: slept %v, want 1s", *slept)
+	}
+	result.Prefetch(len(content) + 1)
+	result.Prefetch(len(content))
+	if *slept != 2*time.Second {
+		t.Errorf("whole file: slept %v, want 2s", *slept)
+	}
+	if !bytes.Equal(result.Data, content) {
+		t.Error("data differs")
+	}
+}
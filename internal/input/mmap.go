@@ -1,23 +1,34 @@
+//go:build linux
+
 package input
 
 import (
 	"fmt"
 	"sync/atomic"
 	"syscall"
+	"time"
 
 	"golang.org/x/sys/unix"
 )
 
 // MmapReader reads files by memory-mapping them with aggressive Linux kernel hints.
-type MmapReader struct{}
+type MmapReader struct {
+	// SkipHoles reads only the data regions of large sparse files, into a
+	// buffer, rather than mapping their holes (see ReadResult.Extents).
+	SkipHoles bool
+}
 
-// NewMmapReader creates a new MmapReader.
+// NewMmapReader creates a new MmapReader that skips holes.
 func NewMmapReader() *MmapReader {
-	return &MmapReader{}
+	return &MmapReader{SkipHoles: true}
 }
 
-// readMmap memory-maps an already-opened fd of known size.
-func readMmap(fd int, size int64, path string) (ReadResult, error) {
+// readMmap memory-maps an already-opened fd of known size. If mapping
+// fails it falls back to a buffered read and reports mapped == false.
+// With a throttle t, the mapping is prefetched at its rate: all of it
+// before returning, or, if lazy, as far as the caller asks through
+// ReadResult.Prefetch.
+func readMmap(fd int, size int64, path string, t *Throttle, lazy bool) (res ReadResult, mapped bool, err error) {
 	// Hint kernel: sequential read pattern
 	unix.Fadvise(fd, 0, size, unix.FADV_SEQUENTIAL)
 
@@ -27,13 +38,14 @@ func readMmap(fd int, size int64, path string) (ReadResult, error) {
 	data, err := syscall.Mmap(fd, 0, int(size), syscall.PROT_READ, syscall.MAP_PRIVATE)
 	if err != nil {
 		// Fall back to buffered read from the already-open fd
-		return readBuffered(fd, size)
+		res, err := readBuffered(fd, size, t)
+		return res, false, err
 	}
 
 	// Additional hint: sequential access pattern
 	unix.Madvise(data, unix.MADV_SEQUENTIAL)
 
-	return ReadResult{
+	res = ReadResult{
 		Data: data,
 		Closer: func() error {
 			unix.Madvise(data, unix.MADV_DONTNEED)
@@ -41,7 +53,27 @@ func readMmap(fd int, size int64, path string) (ReadResult, error) {
 			unix.Close(fd)
 			return nil
 		},
-	}, nil
+	}
+
+	// Page faults cannot wait on a throttle, so with one the file is read
+	// ahead a window at a time at its rate, and the search then finds the
+	// pages in the page cache.
+	if t != nil {
+		ahead := 0
+		prefetch := func(end int) {
+			for end = min(end, len(data)); ahead < end; {
+				n := t.take(len(data) - ahead)
+				unix.Madvise(data[ahead:ahead+n], unix.MADV_WILLNEED)
+				ahead += n
+			}
+		}
+		if lazy {
+			res.Prefetch = prefetch
+		} else {
+			prefetch(len(data))
+		}
+	}
+	return res, true, nil
 }
 
 func (r *MmapReader) Read(path string) (ReadResult, error) {
@@ -57,24 +89,27 @@ func (r *MmapReader) Read(path string) (ReadResult, error) {
 	}
 
 	if stat.Size == 0 {
-		unix.Close(fd)
-		return ReadResult{Data: nil, Closer: noopCloser}, nil
+		res, err := readUnsized(fd, nil)
+		if err != nil {
+			return ReadResult{}, fmt.Errorf("read %s: %w", path, err)
+		}
+		res.Stat = statOf(&stat)
+		return res, nil
 	}
 
-	return readMmap(fd, stat.Size, path)
-}
-
-// NewAdaptiveReader returns a Reader that opens the file once, stats it via fstat
-// (no path-based stat), then selects between buffered and mmap based on size.
-// This eliminates the redundant unix.Stat + ByteSliceFromString allocation.
-func NewAdaptiveReader(mmapThreshold int64) Reader {
-	return &adaptiveReader{
-		threshold: mmapThreshold,
+	if r.SkipHoles && hasHoles(&stat) {
+		if res, ok, err := readSparse(fd, stat.Size, nil); ok {
+			if err != nil {
+				return ReadResult{}, fmt.Errorf("read %s: %w", path, err)
+			}
+			res.Stat = statOf(&stat)
+			return res, nil
+		}
 	}
-}
 
-type adaptiveReader struct {
-	threshold int64
+	res, _, err := readMmap(fd, stat.Size, path, nil, false)
+	res.Stat = statOf(&stat)
+	return res, err
 }
 
 func (r *adaptiveReader) Read(path string) (ReadResult, error) {
@@ -90,16 +125,77 @@ func (r *adaptiveReader) Read(path string) (ReadResult, error) {
 		return ReadResult{}, fmt.Errorf("stat %s: %w", path, err)
 	}
 
+	res, err := r.readFile(fd, &stat, path)
+	res.Stat = statOf(&stat)
+	return res, err
+}
+
+// readFile reads the open fd with the strategy its size calls for. Takes
+// ownership of fd.
+func (r *adaptiveReader) readFile(fd int, stat *unix.Stat_t, path string) (ReadResult, error) {
 	size := stat.Size
 	if size == 0 {
-		unix.Close(fd)
-		return ReadResult{Data: nil, Closer: noopCloser}, nil
+		res, err := readUnsized(fd, r.throttle)
+		if err != nil {
+			return ReadResult{}, fmt.Errorf("read %s: %w", path, err)
+		}
+		return res, nil
+	}
+
+	threshold := r.threshold
+	if r.auto != nil {
+		threshold = r.auto.current()
+	}
+	if r.skipHoles && hasHoles(stat) {
+		if res, ok, err := readSparse(fd, size, r.throttle); ok {
+			if err != nil {
+				return ReadResult{}, fmt.Errorf("read %s: %w", path, err)
+			}
+			r.traceRead(path, size, StrategySparse, threshold)
+			return res, nil
+		}
 	}
 
-	if size >= r.threshold {
-		return readMmap(fd, size, path)
+	if size >= threshold {
+		return r.readMapped(fd, size, path, threshold)
+	}
+	start := time.Now()
+	res, err := readBuffered(fd, size, r.throttle)
+	if err != nil {
+		return res, err
+	}
+	// A throttled read times the throttle, not the disk.
+	if r.auto != nil && r.throttle == nil {
+		r.auto.observeRead(size, time.Since(start))
+	}
+	r.traceRead(path, size, StrategyBuffered, threshold)
+	return res, nil
+}
+
+// readMapped maps the file and, in auto mode, times the mapping and its
+// release for the tuner.
+func (r *adaptiveReader) readMapped(fd int, size int64, path string, threshold int64) (ReadResult, error) {
+	start := time.Now()
+	res, mapped, err := readMmap(fd, size, path, r.throttle, r.lazyPrefetch)
+	if err != nil {
+		return res, err
+	}
+	strategy := StrategyBuffered
+	if mapped {
+		strategy = StrategyMmap
+		if r.auto != nil && r.throttle == nil {
+			mapTime := time.Since(start)
+			unmap := res.Closer
+			res.Closer = func() error {
+				start := time.Now()
+				err := unmap()
+				r.auto.observeMap(mapTime + time.Since(start))
+				return err
+			}
+		}
 	}
-	return readBuffered(fd, size)
+	r.traceRead(path, size, strategy, threshold)
+	return res, nil
 }
 
 // noatimeWorks tracks whether O_NOATIME is usable (requires file ownership or CAP_FOWNER).
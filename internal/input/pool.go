@@ -0,0 +1,30 @@
+package input
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// bufPool pools read buffers to reduce per-file heap allocations.
+// Buffers are stored as *[]byte so the pool can reuse the backing array
+// even when the slice grows beyond its original capacity.
+var bufPool = sync.Pool{
+	New: func() any {
+		b := make([]byte, 0, 64*1024) // 64KB initial capacity
+		return &b
+	},
+}
+
+// PoisonByte fills pooled buffers on release when poisoning is on.
+const PoisonByte = 0xDD
+
+// poison makes releasing a pooled buffer overwrite it with PoisonByte, so a
+// reader of MatchSet.Data after Result.Closer sees obvious garbage instead
+// of another file's plausible content. Mmap'd buffers need no poisoning:
+// they are unmapped on release and any later access faults.
+var poison atomic.Bool
+
+// SetPoison turns debug poisoning of released buffers on or off.
+func SetPoison(on bool) {
+	poison.Store(on)
+}
@@ -0,0 +1,152 @@
+//go:build !linux
+
+package input
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// Portable versions of the readers, for builds other than Linux (chiefly
+// wasip1). Every file is read with os.File into a pooled buffer: there is
+// no O_NOATIME, no mmap and no hole skipping, so MmapReader and the
+// adaptive reader's thresholds fall back to buffered reads and report
+// StrategyBuffered.
+
+// BufferedReader reads files into pooled buffers.
+type BufferedReader struct {
+	SkipHoles bool // ignored: holes are read
+}
+
+// NewBufferedReader creates a new BufferedReader.
+func NewBufferedReader() *BufferedReader {
+	return &BufferedReader{SkipHoles: true}
+}
+
+func (r *BufferedReader) Read(path string) (ReadResult, error) {
+	return readFile(path, nil)
+}
+
+// MmapReader reads files like BufferedReader: there is no mmap here.
+type MmapReader struct {
+	SkipHoles bool // ignored: holes are read
+}
+
+// NewMmapReader creates a new MmapReader.
+func NewMmapReader() *MmapReader {
+	return &MmapReader{SkipHoles: true}
+}
+
+func (r *MmapReader) Read(path string) (ReadResult, error) {
+	return readFile(path, nil)
+}
+
+func (r *adaptiveReader) Read(path string) (ReadResult, error) {
+	start := time.Now()
+	res, err := readFile(path, r.throttle)
+	if err != nil {
+		return res, err
+	}
+	if r.auto != nil && r.throttle == nil {
+		r.auto.observeRead(int64(len(res.Data)), time.Since(start))
+	}
+	threshold := r.threshold
+	if r.auto != nil {
+		threshold = r.auto.current()
+	}
+	r.traceRead(path, int64(len(res.Data)), StrategyBuffered, threshold)
+	return res, nil
+}
+
+// readFile reads the whole file at path into a pooled buffer. Files whose
+// size is unknown or 0 are read until EOF, up to maxUnsizedRead bytes, as
+// readUnsized does on Linux; an empty file yields nil Data. Reads wait on t, if not nil.
+func readFile(path string, t *Throttle) (ReadResult, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return ReadResult{}, fmt.Errorf("open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return ReadResult{}, fmt.Errorf("stat %s: %w", path, err)
+	}
+
+	bp := bufPool.Get().(*[]byte)
+	buf := (*bp)[:cap(*bp)]
+	if size := fi.Size(); int64(len(buf)) < size {
+		buf = make([]byte, size)
+	}
+	total := 0
+	for {
+		if total == len(buf) {
+			if fi.Size() == 0 && total >= maxUnsizedRead {
+				bufPool.Put(bp) // with its old buffer, not this one
+				return ReadResult{}, fmt.Errorf("read %s: %w", path, ErrUnsizedTooLarge)
+			}
+			buf = append(buf, make([]byte, max(len(buf), 4096))...)
+			buf = buf[:cap(buf)]
+		}
+		n, err := f.Read(buf[total : total+t.take(len(buf)-total)])
+		total += n
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			*bp = buf
+			bufPool.Put(bp)
+			return ReadResult{}, fmt.Errorf("read %s: %w", path, err)
+		}
+	}
+
+	if total == 0 {
+		*bp = buf
+		bufPool.Put(bp)
+		return ReadResult{Closer: noopCloser, Stat: statOf(fi)}, nil
+	}
+	return ReadResult{
+		Data: buf[:total],
+		Closer: func() error {
+			if poison.Load() {
+				for i := range buf {
+					buf[i] = PoisonByte
+				}
+			}
+			*bp = buf
+			bufPool.Put(bp)
+			return nil
+		},
+		Stat: statOf(fi),
+	}, nil
+}
+
+// statOf builds a FileStat from fi. Dev and Ino are not available
+// portably and stay zero; Mode gets the st_mode type bits of fi's type.
+func statOf(fi fs.FileInfo) FileStat {
+	mode := uint32(fi.Mode().Perm())
+	switch fi.Mode().Type() {
+	case 0:
+		mode |= 0o100000 // S_IFREG
+	case fs.ModeDir:
+		mode |= 0o040000 // S_IFDIR
+	case fs.ModeSymlink:
+		mode |= 0o120000 // S_IFLNK
+	case fs.ModeNamedPipe:
+		mode |= 0o010000 // S_IFIFO
+	case fs.ModeSocket:
+		mode |= 0o140000 // S_IFSOCK
+	case fs.ModeDevice:
+		mode |= 0o060000 // S_IFBLK
+	default:
+		mode |= 0o020000 // S_IFCHR
+	}
+	return FileStat{
+		Size:  fi.Size(),
+		Mtime: fi.ModTime().UnixNano(),
+		Mode:  mode,
+	}
+}
@@ -1,9 +1,50 @@
 package input
 
+import "errors"
+
+// maxUnsizedRead bounds a file that reports no size, such as a procfs file
+// or a device: one that keeps going, like /dev/zero, is not searched. A
+// variable for tests.
+var maxUnsizedRead = 256 << 20
+
+// ErrUnsizedTooLarge is returned for a file that reports no size and
+// yields more than maxUnsizedRead bytes.
+var ErrUnsizedTooLarge = errors.New("reports no size and has over 256 MiB: not read")
+
 // ReadResult holds the data read from a file and a cleanup function.
 type ReadResult struct {
 	Data   []byte
 	Closer func() error
+
+	// Extents is set when holes of a sparse file were skipped: Data holds
+	// only the data regions, with one NUL in place of each hole. Use
+	// FileOffset to map offsets in Data back to the file.
+	Extents []Extent
+	Size    int64 // with Extents, the file size, holes included
+
+	// Stat is the file's metadata from the fstat done for the read; zero
+	// for stdin.
+	Stat FileStat
+
+	// Prefetch, if set, reads Data[:end] ahead at the throttle's rate. It
+	// is set for a mapping read with AdaptiveOptions.LazyPrefetch, whose
+	// pages are otherwise read on demand, past the throttle. Call it
+	// before searching any part of Data.
+	Prefetch func(end int)
+}
+
+// FileStat is the metadata of a file as read.
+type FileStat struct {
+	Dev   uint64
+	Ino   uint64
+	Size  int64
+	Mtime int64  // nanoseconds since the Unix epoch
+	Mode  uint32 // st_mode: file type and permission bits
+}
+
+// Known reports whether s was captured; st_mode always has a type bit set.
+func (s FileStat) Known() bool {
+	return s.Mode != 0
 }
 
 // noopCloser is a package-level no-op closer to avoid allocating a func literal per file.
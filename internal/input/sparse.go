@@ -0,0 +1,115 @@
+//go:build linux
+
+package input
+
+import "golang.org/x/sys/unix"
+
+// minSparseSize is the smallest file worth probing for holes. Below this a
+// plain read is cheaper than the extra lseek calls.
+const minSparseSize = 1 << 20
+
+// hasHoles reports whether the file allocates fewer blocks than its size
+// implies, i.e. it is sparse and worth walking with SEEK_DATA/SEEK_HOLE.
+func hasHoles(stat *unix.Stat_t) bool {
+	return stat.Size >= minSparseSize && stat.Blocks*512 < stat.Size
+}
+
+// dataExtents lists the data regions of fd using SEEK_DATA/SEEK_HOLE.
+// Returns nil if the filesystem does not report holes, so the caller falls
+// back to reading the whole file.
+func dataExtents(fd int, size int64) []Extent {
+	var extents []Extent
+	var off int64
+	dataOff := 0
+	for off < size {
+		start, err := unix.Seek(fd, off, unix.SEEK_DATA)
+		if err != nil {
+			if err == unix.ENXIO {
+				break // only a hole remains
+			}
+			return nil
+		}
+		end, err := unix.Seek(fd, start, unix.SEEK_HOLE)
+		if err != nil {
+			return nil
+		}
+		if end > size {
+			end = size
+		}
+		if start > off || dataOff > 0 {
+			dataOff++ // leading hole, or the hole between extents
+		}
+		extents = append(extents, Extent{FileOff: start, DataOff: dataOff, Len: int(end - start)})
+		dataOff += int(end - start)
+		off = end
+	}
+	if len(extents) == 1 && extents[0].FileOff == 0 && int64(extents[0].Len) == size {
+		return nil // no holes after all
+	}
+	return extents
+}
+
+// readSparse reads only the data regions of fd into a pooled buffer. Each
+// hole is collapsed to a single NUL byte: holes contain no newlines, so
+// line numbers stay correct, and the NUL keeps binary detection and word
+// boundaries as they were. Reads wait on t, if not nil. Takes ownership of
+// fd. Returns ok=false (fd still open) if fd has no holes.
+func readSparse(fd int, size int64, t *Throttle) (ReadResult, bool, error) {
+	extents := dataExtents(fd, size)
+	if extents == nil {
+		return ReadResult{}, false, nil
+	}
+
+	last := extents[len(extents)-1]
+	n := last.DataOff + last.Len
+	if last.FileOff+int64(last.Len) < size {
+		n++ // trailing hole
+	}
+	bp := bufPool.Get().(*[]byte)
+	buf := *bp
+	if cap(buf) < n {
+		buf = make([]byte, n)
+	} else {
+		buf = buf[:n]
+	}
+	buf[n-1] = 0 // the trailing hole marker, if any; an extent overwrites it otherwise
+
+	for _, e := range extents {
+		if e.DataOff > 0 {
+			buf[e.DataOff-1] = 0 // marker of the hole before e
+		}
+		for done := 0; done < e.Len; {
+			n := t.take(e.Len - done)
+			r, err := unix.Pread(fd, buf[e.DataOff+done:e.DataOff+done+n], e.FileOff+int64(done))
+			if err != nil {
+				unix.Close(fd)
+				*bp = buf
+				bufPool.Put(bp)
+				return ReadResult{}, true, err
+			}
+			if r == 0 {
+				// The file shrank: what is left of e reads as a hole.
+				clear(buf[e.DataOff+done : e.DataOff+e.Len])
+				break
+			}
+			done += r
+		}
+	}
+	unix.Close(fd)
+
+	return ReadResult{
+		Data: buf,
+		Closer: func() error {
+			if poison.Load() {
+				for i := range buf {
+					buf[i] = PoisonByte
+				}
+			}
+			*bp = buf
+			bufPool.Put(bp)
+			return nil
+		},
+		Extents: extents,
+		Size:    size,
+	}, true, nil
+}
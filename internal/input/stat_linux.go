@@ -0,0 +1,13 @@
+package input
+
+import "golang.org/x/sys/unix"
+
+func statOf(st *unix.Stat_t) FileStat {
+	return FileStat{
+		Dev:   st.Dev,
+		Ino:   st.Ino,
+		Size:  st.Size,
+		Mtime: st.Mtim.Nano(),
+		Mode:  st.Mode,
+	}
+}
@@ -0,0 +1,68 @@
+package input
+
+import (
+	"sync"
+	"time"
+)
+
+// throttleChunk is the most a throttled reader reads, or prefetches into a
+// mapping, per wait, so that a large file is spread over the rate rather
+// than taken in one burst after a long sleep.
+const throttleChunk = 1 << 20
+
+// Throttle is a token bucket of bytes that caps the rate at which files are
+// read from disk. One Throttle is shared by every reader of a search, so
+// the cap holds for the whole process however many workers read at once.
+// A nil *Throttle lets everything through.
+type Throttle struct {
+	mu     sync.Mutex
+	rate   float64 // bytes per second
+	tokens float64 // bytes that may be read now; negative is a debt to wait out
+	last   time.Time
+
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+// NewThrottle returns a Throttle passing bytesPerSec bytes a second. It
+// starts with a second's worth of bytes, and saves up no more than that
+// while readers are idle.
+func NewThrottle(bytesPerSec int64) *Throttle {
+	t := &Throttle{rate: float64(bytesPerSec), now: time.Now, sleep: time.Sleep}
+	t.tokens = t.rate
+	t.last = t.now()
+	return t
+}
+
+// Wait blocks until n more bytes may be read. A caller takes its bytes
+// before sleeping, so concurrent callers queue up behind each other's debt
+// instead of all waking at once.
+func (t *Throttle) Wait(n int) {
+	if t == nil || n <= 0 {
+		return
+	}
+	t.mu.Lock()
+	now := t.now()
+	t.tokens = min(t.rate, t.tokens+now.Sub(t.last).Seconds()*t.rate)
+	t.last = now
+	t.tokens -= float64(n)
+	var d time.Duration
+	if t.tokens < 0 {
+		d = time.Duration(-t.tokens / t.rate * float64(time.Second))
+	}
+	t.mu.Unlock()
+	if d > 0 {
+		t.sleep(d)
+	}
+}
+
+// take waits for the next piece of an n-byte read and returns its length:
+// n itself without a throttle, at most throttleChunk with one.
+func (t *Throttle) take(n int) int {
+	if t == nil {
+		return n
+	}
+	n = min(n, throttleChunk)
+	t.Wait(n)
+	return n
+}
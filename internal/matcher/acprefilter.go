@@ -0,0 +1,103 @@
+package matcher
+
+// maxPrefilterBytes is the most candidate bytes the Aho-Corasick prefilter
+// looks for at once; simd.IndexAnyByte compares each 32-byte chunk against
+// every one of them.
+const maxPrefilterBytes = 8
+
+// commonByteRank is the rank from which a byte is too frequent in text to
+// be worth skipping to (space, newline, 'e', 't').
+const commonByteRank = 190
+
+// acPrefilter finds the places where an Aho-Corasick match can be. Every
+// pattern contains one byte of set, its rarest, at most back bytes from its
+// start, so the automaton only has to run from back bytes before each
+// occurrence of a set byte until it falls back to its root state.
+type acPrefilter struct {
+	set  []byte
+	back int
+}
+
+// newACPrefilter picks the rarest byte of each pattern. It returns nil,
+// leaving the automaton to scan every byte, when a pattern is empty, when
+// the rarest byte of some pattern is common anyway, or when the patterns
+// need more than maxPrefilterBytes distinct bytes. With ignoreCase the
+// patterns are lowercase and both cases of a letter join the set.
+func newACPrefilter(patterns [][]byte, ignoreCase bool) *acPrefilter {
+	pre := &acPrefilter{}
+	var seen [256]bool
+	add := func(b byte) {
+		if !seen[b] {
+			seen[b] = true
+			pre.set = append(pre.set, b)
+		}
+	}
+
+	for _, p := range patterns {
+		if len(p) == 0 {
+			return nil
+		}
+		best, off := 256, 0
+		for i, b := range p {
+			r := byteRank(b)
+			if ignoreCase && b >= 'a' && b <= 'z' {
+				r = min(r+byteRank(b-0x20), 255)
+			}
+			if r < best {
+				best, off = r, i
+			}
+		}
+		if best >= commonByteRank {
+			return nil
+		}
+		b := p[off]
+		add(b)
+		if ignoreCase && b >= 'a' && b <= 'z' {
+			add(b - 0x20)
+		}
+		pre.back = max(pre.back, off)
+		if len(pre.set) > maxPrefilterBytes {
+			return nil
+		}
+	}
+	return pre
+}
+
+// englishLetters lists the lowercase letters from most to least frequent.
+const englishLetters = "etaoinshrdlcumwfgypbvkjxqz"
+
+// byteRank estimates how often b occurs in source code and text, from 0
+// (rare) to 255 (very common). Only the order matters.
+func byteRank(b byte) int {
+	switch {
+	case b == ' ':
+		return 255
+	case b == '\n':
+		return 230
+	case b == '\t':
+		return 150
+	case b >= 'a' && b <= 'z':
+		for i := range len(englishLetters) {
+			if englishLetters[i] == b {
+				return 200 - 5*i
+			}
+		}
+	case b >= 'A' && b <= 'Z':
+		return byteRank(b+0x20) / 2
+	case b >= '0' && b <= '9':
+		return 90
+	case b < 0x20 || b == 0x7f:
+		return 5
+	case b >= 0x80:
+		return 30
+	}
+	for i := range len(commonPunct) {
+		if commonPunct[i] == b {
+			return 80
+		}
+	}
+	return 40
+}
+
+// commonPunct is the punctuation that is frequent in code and prose.
+const commonPunct = `.,_-/()=:;"'`
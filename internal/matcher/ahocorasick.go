@@ -1,6 +1,10 @@
 package matcher
 
-import "bytes"
+import (
+	"bytes"
+
+	"github.com/dl/gogrep/internal/simd"
+)
 
 // acNode is a node in the Aho-Corasick automaton.
 type acNode struct {
@@ -15,6 +19,7 @@ type acNode struct {
 type AhoCorasickMatcher struct {
 	root         *acNode
 	patterns     [][]byte // original patterns
+	pre          *acPrefilter
 	ignoreCase   bool
 	invert       bool
 	maxCols      int
@@ -41,6 +46,7 @@ func NewAhoCorasickMatcher(patterns []string, ignoreCase bool, invert bool) *Aho
 
 	// Build failure links via BFS
 	m.buildFailureLinks()
+	m.pre = newACPrefilter(m.patterns, ignoreCase)
 
 	return m
 }
@@ -101,15 +107,40 @@ func (m *AhoCorasickMatcher) buildFailureLinks() {
 	}
 }
 
-// searchLocs scans text for all pattern matches, returning [2]int{start, end} pairs.
+// skip is called while the automaton is in its root state at i, where no
+// partial match is pending. It returns the position to resume from without
+// missing a match and the prefilter candidate that justifies it, or -1 if
+// no match starts at or after i. Without a prefilter it returns i and a
+// candidate past the end, so it is not called again.
+func (m *AhoCorasickMatcher) skip(data []byte, i int) (int, int) {
+	if m.pre == nil {
+		return i, len(data)
+	}
+	c := simd.IndexAnyByte(data[i:], m.pre.set)
+	if c < 0 {
+		return -1, 0
+	}
+	c += i
+	return max(i, c-m.pre.back), c
+}
+
+// searchLocs scans text for all pattern matches, returning the
+// leftmost-longest non-overlapping ones as [2]int{start, end} pairs.
 // Uses a stack buffer for ≤16 matches to avoid heap allocation on sparse matches.
 func (m *AhoCorasickMatcher) searchLocs(text []byte) [][2]int {
 	var stackBuf [16][2]int
 	n := 0
 	var overflow [][2]int
 	node := m.root
+	cand := -1
 
-	for i, b := range text {
+	for i := 0; i < len(text); i++ {
+		if node == m.root && i > cand {
+			if i, cand = m.skip(text, i); i < 0 {
+				break
+			}
+		}
+		b := text[i]
 		if m.ignoreCase {
 			b = toLower(b)
 		}
@@ -143,17 +174,24 @@ func (m *AhoCorasickMatcher) searchLocs(text []byte) [][2]int {
 		return nil
 	}
 	if overflow != nil {
-		return overflow
+		return leftmostLocs(overflow)
 	}
 	result := make([][2]int, n)
 	copy(result, stackBuf[:n])
-	return result
+	return leftmostLocs(result)
 }
 
 // matchExists walks the automaton until the first match, zero allocations.
 func (m *AhoCorasickMatcher) matchExists(data []byte) bool {
 	node := m.root
-	for _, b := range data {
+	cand := -1
+	for i := 0; i < len(data); i++ {
+		if node == m.root && i > cand {
+			if i, cand = m.skip(data, i); i < 0 {
+				return false
+			}
+		}
+		b := data[i]
 		if m.ignoreCase {
 			b = toLower(b)
 		}
@@ -172,7 +210,9 @@ func (m *AhoCorasickMatcher) matchExists(data []byte) bool {
 
 func (m *AhoCorasickMatcher) MatchExists(data []byte) bool {
 	if m.invert {
-		return len(data) > 0
+		return existsInvert(data, func(line []byte) bool {
+			return !m.matchExists(line)
+		})
 	}
 	return m.matchExists(data)
 }
@@ -188,8 +228,15 @@ func (m *AhoCorasickMatcher) CountAll(data []byte) int {
 	node := m.root
 	count := 0
 	lineEnd := -1
+	cand := -1
 
-	for i, b := range data {
+	for i := 0; i < len(data); i++ {
+		if node == m.root && i > cand {
+			if i, cand = m.skip(data, i); i < 0 {
+				break
+			}
+		}
+		b := data[i]
 		if m.ignoreCase {
 			b = toLower(b)
 		}
@@ -214,6 +261,10 @@ func (m *AhoCorasickMatcher) CountAll(data []byte) int {
 }
 
 func (m *AhoCorasickMatcher) FindAll(data []byte) MatchSet {
+	return m.findAllArena(data, nil)
+}
+
+func (m *AhoCorasickMatcher) findAllArena(data []byte, a *Arena) MatchSet {
 	if m.invert {
 		return m.findAllInvert(data)
 	}
@@ -222,7 +273,7 @@ func (m *AhoCorasickMatcher) FindAll(data []byte) MatchSet {
 	if len(locs) == 0 {
 		return MatchSet{}
 	}
-	return matchSetFromLocs(data, locs, m.maxCols, m.needLineNums)
+	return matchSetFromLocsIn(data, locs, m.maxCols, m.needLineNums, a)
 }
 
 func (m *AhoCorasickMatcher) findAllInvert(data []byte) MatchSet {
@@ -263,6 +314,42 @@ func (m *AhoCorasickMatcher) findAllInvert(data []byte) MatchSet {
 	return ms
 }
 
+func (m *AhoCorasickMatcher) firstLine(data []byte) (int, int, bool) {
+	if m.invert {
+		return firstInvertLine(data, func(line []byte) bool {
+			return !m.matchExists(line)
+		})
+	}
+	node := m.root
+	cand := -1
+	for i := 0; i < len(data); i++ {
+		if node == m.root && i > cand {
+			if i, cand = m.skip(data, i); i < 0 {
+				break
+			}
+		}
+		b := data[i]
+		if m.ignoreCase {
+			b = toLower(b)
+		}
+		for node != m.root && node.children[b] == nil {
+			node = node.fail
+		}
+		if node.children[b] != nil {
+			node = node.children[b]
+		}
+		if len(node.output) > 0 {
+			start, end := lineBounds(data, i)
+			return start, end, true
+		}
+	}
+	return 0, 0, false
+}
+
+func (m *AhoCorasickMatcher) scanPositions(line []byte) [][2]int {
+	return m.searchLocs(line)
+}
+
 func (m *AhoCorasickMatcher) FindLine(line []byte, lineNum int, byteOffset int64) (MatchSet, bool) {
 	locs := m.searchLocs(line)
 	hasMatch := len(locs) > 0
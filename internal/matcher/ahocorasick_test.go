@@ -2,6 +2,8 @@ package matcher
 
 import (
 	"bytes"
+	"math/rand/v2"
+	"reflect"
 	"testing"
 )
 
@@ -161,9 +163,61 @@ func TestAhoCorasickMatcher_SearchLocs(t *testing.T) {
 	m := NewAhoCorasickMatcher([]string{"he", "she", "his", "hers"}, false, false)
 	locs := m.searchLocs([]byte("ahishers"))
 
-	// Expected matches: "his" at [1,4], "she" at [3,6], "he" at [4,6], "hers" at [4,8]
-	if len(locs) < 3 {
-		t.Errorf("got %d locs, want at least 3: %v", len(locs), locs)
+	// "his" at [1,4], "she" at [3,6], "he" at [4,6] and "hers" at [4,8] all
+	// occur; "she" overlaps "his" and "he" is shorter than "hers".
+	want := [][2]int{{1, 4}, {4, 8}}
+	if !reflect.DeepEqual(locs, want) {
+		t.Errorf("locs = %v, want %v", locs, want)
+	}
+}
+
+func TestAhoCorasickMatcher_Prefilter(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	alphabet := []byte("abcxyz \nXYZ")
+	data := make([]byte, 4096)
+	for i := range data {
+		data[i] = alphabet[rng.IntN(len(alphabet))]
+	}
+
+	tests := []struct {
+		patterns   []string
+		ignoreCase bool
+	}{
+		{[]string{"xyz", "zy"}, false},
+		{[]string{"abc", "cab", "yz"}, false},
+		{[]string{"x"}, false},
+		{[]string{"xyz", "ZY"}, true},
+		{[]string{"abcx", "b"}, true},
+	}
+	for _, tt := range tests {
+		m := NewAhoCorasickMatcher(tt.patterns, tt.ignoreCase, false)
+		if m.pre == nil {
+			t.Fatalf("%q: no prefilter", tt.patterns)
+		}
+		ref := NewAhoCorasickMatcher(tt.patterns, tt.ignoreCase, false)
+		ref.pre = nil
+
+		if got, want := m.searchLocs(data), ref.searchLocs(data); !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: searchLocs = %v, want %v", tt.patterns, got, want)
+		}
+		if got, want := m.CountAll(data), ref.CountAll(data); got != want {
+			t.Errorf("%q: CountAll = %d, want %d", tt.patterns, got, want)
+		}
+		gs, ge, gok := m.firstLine(data)
+		ws, we, wok := ref.firstLine(data)
+		if gs != ws || ge != we || gok != wok {
+			t.Errorf("%q: firstLine = %d,%d,%v, want %d,%d,%v", tt.patterns, gs, ge, gok, ws, we, wok)
+		}
+		for line := range bytes.SplitSeq(data, []byte{'\n'}) {
+			if got, want := m.MatchExists(line), ref.MatchExists(line); got != want {
+				t.Errorf("%q: MatchExists(%q) = %v, want %v", tt.patterns, line, got, want)
+			}
+		}
+	}
+
+	// Patterns made only of common bytes scan without a prefilter.
+	if m := NewAhoCorasickMatcher([]string{"the", " "}, false, false); m.pre != nil {
+		t.Errorf("prefilter set %q for common bytes", m.pre.set)
 	}
 }
 
@@ -209,3 +263,14 @@ func BenchmarkAhoCorasick_CaseInsensitive(b *testing.B) {
 		m.FindAll(data)
 	}
 }
+
+func BenchmarkAhoCorasick_Sparse(b *testing.B) {
+	data := bytes.Repeat([]byte("the quick brown fox jumps over the lazy dog\n"), 10000)
+	copy(data[len(data)/2:], "ERROR")
+	m := NewAhoCorasickMatcher([]string{"ERROR", "FATAL", "panic:"}, false, false)
+	b.ResetTimer()
+	b.SetBytes(int64(len(data)))
+	for b.Loop() {
+		m.FindAll(data)
+	}
+}
@@ -0,0 +1,78 @@
+package matcher
+
+// arenaBlock is the number of elements in a new arena block. A request
+// larger than the space left starts a block of max(arenaBlock, n).
+const arenaBlock = 512
+
+// Arena is a bump allocator for the Matches and Positions slices of
+// MatchSets. A search worker keeps one and resets it after each file, so a
+// stream of small files reuses the same few blocks instead of allocating
+// two slices per matching file.
+//
+// Slices handed out stay valid until Reset. A MatchSet built in an arena
+// must not outlive the arena's next Reset: callers that pass results on
+// release the arena with the result's Closer, as the scheduler does, or
+// Detach first. Both slice types are pointer-free, so blocks cost the
+// garbage collector nothing to scan.
+type Arena struct {
+	matches   []Match  // current block; len is the part handed out
+	positions [][2]int // current block; len is the part handed out
+}
+
+// NewArena returns an empty Arena; blocks are allocated on first use.
+func NewArena() *Arena {
+	return &Arena{}
+}
+
+// Reset makes the current blocks available again. Earlier blocks, replaced
+// when a block filled up, are left to the garbage collector.
+func (a *Arena) Reset() {
+	a.matches = a.matches[:0]
+	a.positions = a.positions[:0]
+}
+
+// matchSlice returns an empty slice with room for n matches. Appending
+// beyond n moves the slice to the heap without touching the arena. A nil
+// arena allocates from the heap.
+func (a *Arena) matchSlice(n int) []Match {
+	if a == nil {
+		return make([]Match, 0, n)
+	}
+	used := len(a.matches)
+	if cap(a.matches)-used < n {
+		a.matches = make([]Match, 0, max(arenaBlock, n))
+		used = 0
+	}
+	a.matches = a.matches[:used+n]
+	return a.matches[used : used : used+n]
+}
+
+// positionSlice is matchSlice for highlight positions.
+func (a *Arena) positionSlice(n int) [][2]int {
+	if a == nil {
+		return make([][2]int, 0, n)
+	}
+	used := len(a.positions)
+	if cap(a.positions)-used < n {
+		a.positions = make([][2]int, 0, max(arenaBlock, n))
+		used = 0
+	}
+	a.positions = a.positions[:used+n]
+	return a.positions[used : used : used+n]
+}
+
+// arenaFinder is implemented by matchers that can build FindAll's MatchSet
+// in an arena. A nil arena means the heap.
+type arenaFinder interface {
+	findAllArena(data []byte, a *Arena) MatchSet
+}
+
+// FindAllIn is m.FindAll with the MatchSet's slices taken from a where m
+// supports it; other matchers, such as the context and range wrappers,
+// allocate as FindAll does. The result is valid until a.Reset.
+func FindAllIn(m Matcher, data []byte, a *Arena) MatchSet {
+	if af, ok := m.(arenaFinder); ok {
+		return af.findAllArena(data, a)
+	}
+	return m.FindAll(data)
+}
@@ -0,0 +1,86 @@
+package matcher
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFindAllIn_MatchesFindAll(t *testing.T) {
+	data := []byte("alpha beta\ngamma\nbeta beta alpha\n\nalphabet\n")
+	sets := []struct {
+		patterns []string
+		fixed    bool
+	}{
+		{[]string{"beta"}, true},
+		{[]string{"alpha", "beta"}, true},
+		{strings.Fields("a b c d e f g h i j"), true},
+		{[]string{"al.ha"}, false},
+		{[]string{"[ab]eta", "g.mma"}, false},
+		{[]string{"alpha", "g.mma"}, false},
+	}
+	a := NewArena()
+	for _, set := range sets {
+		m, err := NewMatcher(set.patterns, set.fixed, false, false, false, MatcherOpts{NeedLineNums: true, MaxCols: 8})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := m.(arenaFinder); !ok {
+			t.Errorf("%v: %T does not build in an arena", set.patterns, m)
+		}
+		want := m.FindAll(data)
+		// Twice, so the second search reuses the first one's blocks.
+		for range 2 {
+			a.Reset()
+			got := FindAllIn(m, data, a)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%v: got %+v, want %+v", set.patterns, got, want)
+			}
+		}
+	}
+}
+
+func TestArena_SlicesDoNotOverlap(t *testing.T) {
+	a := NewArena()
+	first := a.matchSlice(3)
+	second := a.matchSlice(arenaBlock) // does not fit: a new block
+	third := a.matchSlice(2)
+	first = append(first, Match{LineNum: 1}, Match{LineNum: 2}, Match{LineNum: 3})
+	third = append(third, Match{LineNum: 4}, Match{LineNum: 5}, Match{LineNum: 6}) // grows past its room
+	second = append(second, Match{LineNum: 7})
+	if fmt.Sprint(first[0].LineNum, first[2].LineNum, second[0].LineNum, third[2].LineNum) != "1 3 7 6" {
+		t.Errorf("slices overlap: %v %v %v", first, second[:1], third)
+	}
+	if len(a.positionSlice(4)) != 0 || cap(a.positionSlice(4)) != 4 {
+		t.Error("positionSlice: want an empty slice with room for 4")
+	}
+}
+
+// BenchmarkFindAllIn_SmallFiles searches many small inputs with a match
+// each, as a recursive search of a source tree does, allocating the
+// MatchSets from the heap or from one arena reset per input.
+func BenchmarkFindAllIn_SmallFiles(b *testing.B) {
+	var inputs [][]byte
+	for i := range 256 {
+		inputs = append(inputs, []byte(strings.Repeat("package main\nfunc f() {}\n", i%8)+"// TODO: fix\nreturn nil\n"))
+	}
+	m, err := NewMatcher([]string{"TODO"}, true, false, false, false, MatcherOpts{NeedLineNums: true, MaxCols: 75})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Run("heap", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := range b.N {
+			_ = m.FindAll(inputs[i%len(inputs)])
+		}
+	})
+	b.Run("arena", func(b *testing.B) {
+		b.ReportAllocs()
+		a := NewArena()
+		for i := range b.N {
+			_ = FindAllIn(m, inputs[i%len(inputs)], a)
+			a.Reset()
+		}
+	})
+}
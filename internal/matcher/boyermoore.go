@@ -37,7 +37,12 @@ func NewBoyerMooreMatcher(pattern string, ignoreCase bool, invert bool) *BoyerMo
 
 func (m *BoyerMooreMatcher) MatchExists(data []byte) bool {
 	if m.invert {
-		return len(data) > 0
+		return existsInvert(data, func(line []byte) bool {
+			if m.ignoreCase {
+				return simd.IndexCaseInsensitive(line, m.patternLow) < 0
+			}
+			return simd.Index(line, m.patternLow) < 0
+		})
 	}
 	if m.ignoreCase {
 		return simd.IndexCaseInsensitive(data, m.patternLow) >= 0
@@ -55,6 +60,14 @@ func (m *BoyerMooreMatcher) CountAll(data []byte) int {
 		})
 	}
 
+	// A pattern without a newline matches within one line, so the fused
+	// count can skip the rest of a line once it has matched.
+	if bytes.IndexByte(m.patternLow, '\n') < 0 {
+		if m.ignoreCase {
+			return simd.CountLinesCaseInsensitive(data, m.patternLow)
+		}
+		return simd.CountLines(data, m.patternLow)
+	}
 	if m.ignoreCase {
 		return countUniqueLines(data, simd.IndexAllCaseInsensitive(data, m.patternLow))
 	}
@@ -62,6 +75,10 @@ func (m *BoyerMooreMatcher) CountAll(data []byte) int {
 }
 
 func (m *BoyerMooreMatcher) FindAll(data []byte) MatchSet {
+	return m.findAllArena(data, nil)
+}
+
+func (m *BoyerMooreMatcher) findAllArena(data []byte, a *Arena) MatchSet {
 	if m.invert {
 		return m.findAllInvert(data)
 	}
@@ -72,7 +89,7 @@ func (m *BoyerMooreMatcher) FindAll(data []byte) MatchSet {
 	} else {
 		offsets = simd.IndexAll(data, m.patternLow)
 	}
-	return matchSetFromOffsets(data, offsets, len(m.patternLow), m.maxCols, m.needLineNums)
+	return matchSetFromOffsetsIn(data, offsets, len(m.patternLow), m.maxCols, m.needLineNums, a)
 }
 
 // findAllInvert returns lines that do NOT contain the pattern.
@@ -120,6 +137,46 @@ func (m *BoyerMooreMatcher) findAllInvert(data []byte) MatchSet {
 	return ms
 }
 
+func (m *BoyerMooreMatcher) firstLine(data []byte) (int, int, bool) {
+	if m.invert {
+		return firstInvertLine(data, func(line []byte) bool {
+			if m.ignoreCase {
+				return simd.IndexCaseInsensitive(line, m.patternLow) < 0
+			}
+			return simd.Index(line, m.patternLow) < 0
+		})
+	}
+	var off int
+	if m.ignoreCase {
+		off = simd.IndexCaseInsensitive(data, m.patternLow)
+	} else {
+		off = simd.Index(data, m.patternLow)
+	}
+	if off < 0 {
+		return 0, 0, false
+	}
+	start, end := lineBounds(data, off)
+	return start, end, true
+}
+
+func (m *BoyerMooreMatcher) scanPositions(line []byte) [][2]int {
+	var offsets []int
+	if m.ignoreCase {
+		offsets = simd.IndexAllCaseInsensitive(line, m.patternLow)
+	} else {
+		offsets = simd.IndexAll(line, m.patternLow)
+	}
+	if len(offsets) == 0 {
+		return nil
+	}
+	pLen := len(m.patternLow)
+	positions := make([][2]int, len(offsets))
+	for i, off := range offsets {
+		positions[i] = [2]int{off, off + pLen}
+	}
+	return positions
+}
+
 func (m *BoyerMooreMatcher) FindLine(line []byte, lineNum int, byteOffset int64) (MatchSet, bool) {
 	var offsets []int
 	if m.ignoreCase {
@@ -165,3 +222,11 @@ func toLower(b byte) byte {
 	}
 	return b
 }
+
+// toUpper converts an ASCII byte to uppercase.
+func toUpper(b byte) byte {
+	if b >= 'a' && b <= 'z' {
+		return b - ('a' - 'A')
+	}
+	return b
+}
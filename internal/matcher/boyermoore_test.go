@@ -3,6 +3,8 @@ package matcher
 import (
 	"bytes"
 	"testing"
+
+	"github.com/dl/gogrep/internal/simd"
 )
 
 func TestBoyerMooreMatcher_FindAll(t *testing.T) {
@@ -109,6 +111,9 @@ func TestBoyerMooreMatcher_FindAll(t *testing.T) {
 					t.Errorf("match[%d].LineNum = %d, want %d", i, ms.Matches[i].LineNum, wantLine)
 				}
 			}
+			if got := m.CountAll([]byte(tt.input)); got != tt.wantCount {
+				t.Errorf("CountAll = %d, want %d", got, tt.wantCount)
+			}
 		})
 	}
 }
@@ -267,6 +272,27 @@ func BenchmarkBoyerMoore_CaseInsensitive(b *testing.B) {
 	}
 }
 
+// BenchmarkBoyerMoore_CountDense: -c where every line matches, "o" four
+// times per line and "lazy" once, against the per-match count it replaced.
+func BenchmarkBoyerMoore_CountDense(b *testing.B) {
+	data := bytes.Repeat([]byte("the quick brown fox jumps over the lazy dog\n"), 10000)
+	for _, pattern := range []string{"o", "lazy"} {
+		m := NewBoyerMooreMatcher(pattern, false, false)
+		b.Run(pattern+"/CountAll", func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for b.Loop() {
+				m.CountAll(data)
+			}
+		})
+		b.Run(pattern+"/IndexAll", func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for b.Loop() {
+				countUniqueLines(data, simd.IndexAll(data, m.patternLow))
+			}
+		})
+	}
+}
+
 // BenchmarkBoyerMoore_SparseMatch: 10K lines, only 10 match (1 in 1000)
 func BenchmarkBoyerMoore_SparseMatch(b *testing.B) {
 	var buf []byte
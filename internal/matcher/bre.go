@@ -0,0 +1,160 @@
+package matcher
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Dialect selects the pattern syntax, mirroring grep's -F/-G/-E/-P.
+type Dialect int
+
+const (
+	DialectDefault  Dialect = iota // RE2 syntax (gogrep's native dialect)
+	DialectFixed                   // -F: literal strings
+	DialectBasic                   // -G: POSIX basic regular expressions, translated to RE2
+	DialectExtended                // -E: POSIX extended regular expressions (RE2 is a superset)
+	DialectPerl                    // -P: PCRE2
+)
+
+// QuotePattern returns a pattern that matches lit literally in the syntax
+// selected by fixed and dialect, the arguments of NewMatcher, so fixed
+// strings can join a set of regular expressions.
+func QuotePattern(lit string, fixed bool, dialect Dialect) string {
+	switch {
+	case dialect == DialectFixed, fixed && dialect == DialectDefault:
+		return lit
+	case dialect == DialectBasic:
+		// Only these are special in a BRE; escaping others, such as + or
+		// (, would turn them into GNU operators.
+		var b strings.Builder
+		for i := range len(lit) {
+			if strings.IndexByte(`\.[]*^$`, lit[i]) >= 0 {
+				b.WriteByte('\\')
+			}
+			b.WriteByte(lit[i])
+		}
+		return b.String()
+	}
+	return regexp.QuoteMeta(lit)
+}
+
+// translateBRE rewrites a POSIX basic regular expression (with the GNU
+// extensions \+ \? \| \< \> \w \W \s \S \b \B) into equivalent RE2 syntax.
+//
+// In BRE the roles of escaped and bare metacharacters are swapped for
+// grouping, intervals and alternation: \( \) \{ \} \| are operators while
+// ( ) { } | + ? are literals. '*' is literal at the start of an expression,
+// '^' is an anchor only at the start and '$' only at the end.
+// Back-references (\1..\9) have no RE2 equivalent and return an error.
+func translateBRE(pattern string) (string, error) {
+	var b strings.Builder
+	b.Grow(len(pattern) + 8)
+
+	// atStart tracks positions where '*' is literal and '^' is an anchor:
+	// the beginning of the pattern, after \( and after \|.
+	atStart := true
+
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch c {
+		case '\\':
+			if i+1 >= len(pattern) {
+				return "", fmt.Errorf("trailing backslash")
+			}
+			i++
+			e := pattern[i]
+			switch e {
+			case '(', ')', '{', '}', '|', '+', '?':
+				b.WriteByte(e)
+				atStart = e == '(' || e == '|'
+				continue
+			case '<', '>':
+				b.WriteString(`\b`)
+			case 'w', 'W', 's', 'S', 'b', 'B':
+				b.WriteByte('\\')
+				b.WriteByte(e)
+			case '1', '2', '3', '4', '5', '6', '7', '8', '9':
+				return "", fmt.Errorf("back-reference \\%c is not supported with -G; use -P", e)
+			default:
+				b.WriteString(regexp.QuoteMeta(string(e)))
+			}
+
+		case '(', ')', '{', '}', '|', '+', '?':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+
+		case '*':
+			if atStart {
+				b.WriteString(`\*`)
+			} else {
+				b.WriteByte('*')
+			}
+
+		case '^':
+			if atStart {
+				b.WriteByte('^')
+				continue // a following '*' is still literal
+			}
+			b.WriteString(`\^`)
+
+		case '$':
+			if i == len(pattern)-1 || strings.HasPrefix(pattern[i+1:], `\)`) || strings.HasPrefix(pattern[i+1:], `\|`) {
+				b.WriteByte('$')
+			} else {
+				b.WriteString(`\$`)
+			}
+
+		case '[':
+			end, err := copyBracket(&b, pattern, i)
+			if err != nil {
+				return "", err
+			}
+			i = end
+
+		default:
+			b.WriteByte(c)
+		}
+		atStart = false
+	}
+	return b.String(), nil
+}
+
+// copyBracket writes the POSIX bracket expression starting at pattern[start]
+// to b and returns the index of its closing ']'. Backslash is literal inside
+// POSIX brackets but an escape in RE2, so it is doubled.
+func copyBracket(b *strings.Builder, pattern string, start int) (int, error) {
+	i := start + 1
+	b.WriteByte('[')
+	if i < len(pattern) && pattern[i] == '^' {
+		b.WriteByte('^')
+		i++
+	}
+	// A ']' first in the list is a literal.
+	if i < len(pattern) && pattern[i] == ']' {
+		b.WriteString(`\]`)
+		i++
+	}
+	for ; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case c == ']':
+			b.WriteByte(']')
+			return i, nil
+		case c == '[' && i+1 < len(pattern) && (pattern[i+1] == ':' || pattern[i+1] == '.' || pattern[i+1] == '='):
+			// Character class [:alpha:], collating [.x.] or equivalence [=x=].
+			delim := pattern[i+1]
+			end := strings.Index(pattern[i+2:], string(delim)+"]")
+			if end < 0 {
+				return 0, fmt.Errorf("unterminated [%c in bracket expression", delim)
+			}
+			b.WriteString(pattern[i : i+2+end+2])
+			i += 2 + end + 1
+		case c == '\\':
+			b.WriteString(`\\`)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return 0, fmt.Errorf("unterminated bracket expression")
+}
@@ -0,0 +1,91 @@
+package matcher
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestTranslateBRE(t *testing.T) {
+	tests := []struct {
+		name string
+		bre  string
+		want string
+	}{
+		{"literal", "hello", "hello"},
+		{"group", `\(ab\)*c`, `(ab)*c`},
+		{"literal parens", `f(x)`, `f\(x\)`},
+		{"interval", `a\{2,3\}`, `a{2,3}`},
+		{"literal braces", `a{2}`, `a\{2\}`},
+		{"alternation", `cat\|dog`, `cat|dog`},
+		{"literal pipe and plus", `a|b+c?`, `a\|b\+c\?`},
+		{"gnu plus", `ab\+`, `ab+`},
+		{"leading star", `*abc`, `\*abc`},
+		{"star after anchor", `^*x`, `^\*x`},
+		{"star after group", `\(*a\)`, `(\*a)`},
+		{"mid caret literal", `a^b`, `a\^b`},
+		{"mid dollar literal", `a$b`, `a\$b`},
+		{"anchors", `^foo$`, `^foo$`},
+		{"dollar before group end", `\(a$\)`, `(a$)`},
+		{"word boundaries", `\<word\>`, `\bword\b`},
+		{"escaped dot", `a\.b`, `a\.b`},
+		{"bracket", `[a-z]`, `[a-z]`},
+		{"bracket backslash", `[\n]`, `[\\n]`},
+		{"bracket leading close", `[]a]`, `[\]a]`},
+		{"bracket negated close", `[^]a]`, `[^\]a]`},
+		{"char class", `[[:digit:]]\+`, `[[:digit:]]+`},
+		{"escaped slash", `a\/b`, `a/b`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := translateBRE(tt.bre)
+			if err != nil {
+				t.Fatalf("translateBRE(%q) error: %v", tt.bre, err)
+			}
+			if got != tt.want {
+				t.Errorf("translateBRE(%q) = %q, want %q", tt.bre, got, tt.want)
+			}
+			if _, err := regexp.Compile(got); err != nil {
+				t.Errorf("translated %q does not compile: %v", got, err)
+			}
+		})
+	}
+}
+
+func TestTranslateBRE_Errors(t *testing.T) {
+	for _, bre := range []string{`\(a\)\1`, `abc\`, `[abc`, `[[:alpha]`} {
+		if _, err := translateBRE(bre); err == nil {
+			t.Errorf("translateBRE(%q): expected error", bre)
+		}
+	}
+}
+
+func TestNewMatcher_BasicDialect(t *testing.T) {
+	m, err := NewMatcher([]string{`\(ab\)\{2\}`}, false, false, false, false, MatcherOpts{Dialect: DialectBasic})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms := m.FindAll([]byte("ab\nabab\n(ab){2}\n"))
+	if len(ms.Matches) != 1 || string(ms.LineBytes(0)) != "abab" {
+		t.Errorf("got %d matches, want only the abab line", len(ms.Matches))
+	}
+
+	// Bare metacharacters are literals in BRE.
+	m, err = NewMatcher([]string{`f(x)+1`}, false, false, false, false, MatcherOpts{Dialect: DialectBasic})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms = m.FindAll([]byte("f(x)+1\nfx1\n"))
+	if len(ms.Matches) != 1 || ms.Matches[0].LineStart != 0 {
+		t.Errorf("got %d matches, want literal f(x)+1 line", len(ms.Matches))
+	}
+}
+
+func TestNewMatcher_FixedDialect(t *testing.T) {
+	m, err := NewMatcher([]string{`a.c`}, false, false, false, false, MatcherOpts{Dialect: DialectFixed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ms := m.FindAll([]byte("abc\na.c\n")); len(ms.Matches) != 1 {
+		t.Errorf("got %d matches, want 1 literal match", len(ms.Matches))
+	}
+}
@@ -0,0 +1,117 @@
+package matcher
+
+import "bytes"
+
+// ByteContextSlack is how far past a match start the inner matcher's
+// snippet must reach so that ByteContextMatcher sees the whole match.
+// Callers add it to the byte context when choosing the inner MaxCols.
+const ByteContextSlack = 256
+
+// ByteContextMatcher replaces each matching line with byte windows around
+// its matches: n bytes before and after each occurrence, clipped at line
+// boundaries. Occurrences whose windows touch share one record. It makes
+// context usable for minified or single-line files, where a line of
+// context is the whole file.
+type ByteContextMatcher struct {
+	inner Matcher
+	n     int
+}
+
+// NewByteContextMatcher wraps inner to emit n-byte context windows.
+// If n <= 0, returns the inner matcher directly.
+func NewByteContextMatcher(inner Matcher, n int) Matcher {
+	if n <= 0 {
+		return inner
+	}
+	return &ByteContextMatcher{inner: inner, n: n}
+}
+
+func (m *ByteContextMatcher) MatchExists(data []byte) bool {
+	return m.inner.MatchExists(data)
+}
+
+func (m *ByteContextMatcher) CountAll(data []byte) int {
+	return m.inner.CountAll(data)
+}
+
+func (m *ByteContextMatcher) FindAll(data []byte) MatchSet {
+	return m.windows(m.inner.FindAll(data))
+}
+
+func (m *ByteContextMatcher) FindLine(line []byte, lineNum int, byteOffset int64) (MatchSet, bool) {
+	ms, ok := m.inner.FindLine(line, lineNum, byteOffset)
+	if !ok {
+		return ms, false
+	}
+	return m.windows(ms), true
+}
+
+// windows splits every match with positions into one record per cluster of
+// occurrences. Matches without positions (inverted, context) pass through.
+func (m *ByteContextMatcher) windows(ms MatchSet) MatchSet {
+	if !ms.HasMatch() {
+		return ms
+	}
+	out := MatchSet{Data: ms.Data, Matches: make([]Match, 0, len(ms.Matches))}
+	for i := range ms.Matches {
+		src := ms.Matches[i]
+		positions := ms.MatchPositions(i)
+		if src.LineStart < 0 || len(positions) == 0 {
+			src.PosIdx = len(out.Positions)
+			out.Positions = append(out.Positions, positions...)
+			out.Matches = append(out.Matches, src)
+			continue
+		}
+
+		for j := 0; j < len(positions); {
+			s := src.LineStart + positions[j][0]
+			e := src.LineStart + positions[j][1]
+			lo := m.windowStart(ms.Data, s)
+			hi := m.windowEnd(ms.Data, e)
+
+			// Absorb following occurrences whose window overlaps this one.
+			k := j + 1
+			for ; k < len(positions); k++ {
+				ns := src.LineStart + positions[k][0]
+				if m.windowStart(ms.Data, ns) > hi {
+					break
+				}
+				hi = max(hi, m.windowEnd(ms.Data, src.LineStart+positions[k][1]))
+			}
+
+			w := src
+			w.LineStart = lo
+			w.LineLen = hi - lo
+			w.ByteOffset = src.ByteOffset + int64(lo-src.LineStart)
+			w.PosIdx = len(out.Positions)
+			w.PosCount = k - j
+			for _, p := range positions[j:k] {
+				out.Positions = append(out.Positions, [2]int{src.LineStart + p[0] - lo, src.LineStart + p[1] - lo})
+			}
+			out.Matches = append(out.Matches, w)
+			j = k
+		}
+	}
+	return out
+}
+
+// windowStart returns the start of the window before offset s: n bytes
+// back, or the start of the line if that is closer.
+func (m *ByteContextMatcher) windowStart(data []byte, s int) int {
+	lo := max(s-m.n, 0)
+	if i := bytes.LastIndexByte(data[lo:s], '\n'); i >= 0 {
+		lo += i + 1
+	}
+	return lo
+}
+
+// windowEnd returns the end of the window after offset e: n bytes on, or
+// the end of the line if that is closer.
+func (m *ByteContextMatcher) windowEnd(data []byte, e int) int {
+	e = min(e, len(data))
+	hi := min(e+m.n, len(data))
+	if i := bytes.IndexByte(data[e:hi], '\n'); i >= 0 {
+		hi = e + i
+	}
+	return hi
+}
@@ -0,0 +1,60 @@
+package matcher
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestByteContextMatcher(t *testing.T) {
+	data := []byte("aaaaaaaaaaFOObbbbbbbbbbbbbbbbbbbbFOOcc\nxFOOx\nnone\n")
+	inner := NewBoyerMooreMatcher("FOO", false, false)
+	inner.needLineNums = true
+	m := NewByteContextMatcher(inner, 4)
+
+	ms := m.FindAll(data)
+	want := []struct {
+		text      string
+		lineNum   int
+		offset    int64
+		positions string
+	}{
+		{"aaaaFOObbbb", 1, 6, "[[4 7]]"},
+		{"bbbbFOOcc", 1, 29, "[[4 7]]"},
+		{"xFOOx", 2, 39, "[[1 4]]"},
+	}
+	if len(ms.Matches) != len(want) {
+		t.Fatalf("got %d windows, want %d", len(ms.Matches), len(want))
+	}
+	for i, w := range want {
+		got := ms.Matches[i]
+		if string(ms.LineBytes(i)) != w.text || got.LineNum != w.lineNum || got.ByteOffset != w.offset {
+			t.Errorf("window %d = %q line %d off %d, want %q line %d off %d",
+				i, ms.LineBytes(i), got.LineNum, got.ByteOffset, w.text, w.lineNum, w.offset)
+		}
+		if p := fmt.Sprint(ms.MatchPositions(i)); p != w.positions {
+			t.Errorf("window %d positions = %s, want %s", i, p, w.positions)
+		}
+	}
+}
+
+func TestByteContextMatcher_MergesOverlapping(t *testing.T) {
+	m := NewByteContextMatcher(NewBoyerMooreMatcher("ab", false, false), 3)
+	ms := m.FindAll([]byte("----ab--ab----------ab----"))
+	if len(ms.Matches) != 2 {
+		t.Fatalf("got %d windows, want 2", len(ms.Matches))
+	}
+	if got := string(ms.LineBytes(0)); got != "---ab--ab---" {
+		t.Errorf("merged window = %q", got)
+	}
+	if p := fmt.Sprint(ms.MatchPositions(0)); p != "[[3 5] [7 9]]" {
+		t.Errorf("merged positions = %s", p)
+	}
+}
+
+func TestByteContextMatcher_InvertPassesThrough(t *testing.T) {
+	m := NewByteContextMatcher(NewBoyerMooreMatcher("x", false, true), 2)
+	ms := m.FindAll([]byte("x\nlong line without it\n"))
+	if len(ms.Matches) != 1 || string(ms.LineBytes(0)) != "long line without it" {
+		t.Errorf("inverted lines should be untouched, got %d matches", len(ms.Matches))
+	}
+}
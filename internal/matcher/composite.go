@@ -0,0 +1,131 @@
+package matcher
+
+// literalSearcher is a fixed-string engine a CompositeMatcher can drive:
+// MultiScanMatcher or AhoCorasickMatcher, built without invert.
+type literalSearcher interface {
+	firstLocator
+	positionScanner
+	searchLocs(data []byte) [][2]int
+}
+
+// CompositeMatcher searches a pattern set that mixes fixed strings and
+// regular expressions. The literals go to a fixed-string engine, one SIMD
+// or Aho-Corasick pass, and the rest to a single RegexMatcher, whose
+// alternation keeps any literal prefilter the regexes share; folding the
+// literals into that alternation would cost it the prefilter and send every
+// byte through RE2. Both passes run over the same buffer, and their
+// locations are merged in order before lines and snippets are cut, so the
+// result is the MatchSet one engine would have produced.
+type CompositeMatcher struct {
+	lits         literalSearcher
+	re           *RegexMatcher
+	invert       bool
+	maxCols      int
+	needLineNums bool
+}
+
+// newCompositeMatcher builds a CompositeMatcher for literals, searched as
+// fixed strings, and regexes, the remaining patterns. Both must be
+// non-empty.
+func newCompositeMatcher(literals, regexes []string, ignoreCase bool, invert bool, opts MatcherOpts) (*CompositeMatcher, error) {
+	re, err := NewRegexMatcher(alternation(regexes), ignoreCase, false)
+	if err != nil {
+		return nil, err
+	}
+	m := &CompositeMatcher{re: re, invert: invert, maxCols: opts.MaxCols, needLineNums: opts.NeedLineNums}
+	if selectFixedEngine(literals, ignoreCase) == engineAhoCorasick {
+		m.lits = NewAhoCorasickMatcher(literals, ignoreCase, false)
+	} else {
+		m.lits = NewMultiScanMatcher(literals, ignoreCase, false)
+	}
+	return m, nil
+}
+
+// searchLocs returns the locations of both engines in data, sorted by start
+// (longer first on ties), as matchSetFromLocs needs. A location that
+// overlaps an earlier one, such as a literal inside a regex match, is
+// dropped, so the spans do not overlap, as with a single engine.
+func (m *CompositeMatcher) searchLocs(data []byte) [][2]int {
+	return leftmostLocs(append(m.lits.searchLocs(data), m.re.searchLocs(data)...))
+}
+
+func (m *CompositeMatcher) noMatch(line []byte) bool {
+	_, _, ok := m.lits.firstLine(line)
+	return !ok && !m.re.re.Match(line)
+}
+
+func (m *CompositeMatcher) MatchExists(data []byte) bool {
+	_, _, ok := m.firstLine(data)
+	return ok
+}
+
+// firstLine returns the earlier of the engines' first matching lines.
+func (m *CompositeMatcher) firstLine(data []byte) (int, int, bool) {
+	if m.invert {
+		return firstInvertLine(data, m.noMatch)
+	}
+	ls, le, lok := m.lits.firstLine(data)
+	limit := data
+	if lok {
+		// Only a line before the literal's can win.
+		limit = data[:ls]
+	}
+	if rs, re, rok := m.re.firstLine(limit); rok {
+		return rs, re, true
+	}
+	return ls, le, lok
+}
+
+func (m *CompositeMatcher) CountAll(data []byte) int {
+	if m.invert {
+		return countInvert(data, m.noMatch)
+	}
+	return countLocsUniqueLines(data, m.searchLocs(data))
+}
+
+func (m *CompositeMatcher) FindAll(data []byte) MatchSet {
+	return m.findAllArena(data, nil)
+}
+
+func (m *CompositeMatcher) findAllArena(data []byte, a *Arena) MatchSet {
+	if m.invert {
+		return invertMatchSet(data, m.noMatch)
+	}
+	locs := m.searchLocs(data)
+	if len(locs) == 0 {
+		return MatchSet{}
+	}
+	return matchSetFromLocsIn(data, locs, m.maxCols, m.needLineNums, a)
+}
+
+func (m *CompositeMatcher) scanPositions(line []byte) [][2]int {
+	return m.searchLocs(line)
+}
+
+func (m *CompositeMatcher) FindLine(line []byte, lineNum int, byteOffset int64) (MatchSet, bool) {
+	locs := m.searchLocs(line)
+	hasMatch := len(locs) > 0
+
+	if m.invert {
+		hasMatch = !hasMatch
+	}
+
+	if !hasMatch {
+		return MatchSet{}, false
+	}
+
+	ms := MatchSet{Data: line}
+	match := Match{
+		LineNum:    lineNum,
+		LineStart:  0,
+		LineLen:    len(line),
+		ByteOffset: byteOffset,
+	}
+	if !m.invert {
+		match.PosCount = len(locs)
+		ms.Positions = locs
+	}
+	ms.Matches = []Match{match}
+
+	return ms, true
+}
@@ -0,0 +1,113 @@
+package matcher
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCompositeMatcher_MatchesRegex(t *testing.T) {
+	inputs := []string{
+		"user 42 denied\nok\na.b[0] set\n",
+		"nothing here\nUSER 7 DENIED and a.b[0]\n",
+		"a.b[0]user 1 denied\n\n",
+		"",
+		"user 9 denied",
+	}
+	literals := []string{"a.b[0]", "ok"}
+	regexes := []string{`user [0-9]+ denied`}
+	var all []string
+	for _, l := range literals {
+		all = append(all, QuotePattern(l, false, DialectDefault))
+	}
+	all = append(all, regexes...)
+
+	for _, ignoreCase := range []bool{false, true} {
+		for _, invert := range []bool{false, true} {
+			opts := MatcherOpts{NeedLineNums: true}
+			got, err := NewMatcher(all, false, false, ignoreCase, invert, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := got.(*CompositeMatcher); !ok {
+				t.Fatalf("NewMatcher built %T, want *CompositeMatcher", got)
+			}
+			ref, err := NewRegexMatcher(alternation(all), ignoreCase, invert)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ref.needLineNums = true
+
+			for _, in := range inputs {
+				data := []byte(in)
+				name := fmt.Sprintf("i=%v v=%v %q", ignoreCase, invert, in)
+
+				g, w := got.FindAll(data), ref.FindAll(data)
+				if len(g.Matches) != len(w.Matches) {
+					t.Errorf("%s: FindAll %d matches, want %d", name, len(g.Matches), len(w.Matches))
+					continue
+				}
+				for i := range g.Matches {
+					if g.Matches[i] != w.Matches[i] {
+						t.Errorf("%s: match %d = %+v, want %+v", name, i, g.Matches[i], w.Matches[i])
+					}
+					if gp, wp := fmt.Sprint(g.MatchPositions(i)), fmt.Sprint(w.MatchPositions(i)); gp != wp {
+						t.Errorf("%s: match %d positions %s, want %s", name, i, gp, wp)
+					}
+				}
+				if g, w := got.CountAll(data), ref.CountAll(data); g != w {
+					t.Errorf("%s: CountAll = %d, want %d", name, g, w)
+				}
+				if g, w := got.MatchExists(data), ref.MatchExists(data); g != w {
+					t.Errorf("%s: MatchExists = %v, want %v", name, g, w)
+				}
+				gs, ge, gok := got.(*CompositeMatcher).firstLine(data)
+				ws, we, wok := ref.firstLine(data)
+				if gs != ws || ge != we || gok != wok {
+					t.Errorf("%s: firstLine = (%d,%d,%v), want (%d,%d,%v)", name, gs, ge, gok, ws, we, wok)
+				}
+			}
+		}
+	}
+}
+
+// A literal found inside a regex match is one span, not two.
+func TestCompositeMatcher_OverlappingSpans(t *testing.T) {
+	m, err := NewMatcher([]string{"denied", `user [0-9]+ denied`}, false, false, false, false, MatcherOpts{NeedLineNums: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.(*CompositeMatcher); !ok {
+		t.Fatalf("NewMatcher built %T, want *CompositeMatcher", m)
+	}
+	for in, want := range map[string]string{
+		"user 42 denied\n":       "[[0 14]]",
+		"denied user 1 denied\n": "[[0 6] [7 20]]",
+	} {
+		ms := m.FindAll([]byte(in))
+		if len(ms.Matches) != 1 {
+			t.Fatalf("%q: %d matches, want 1", in, len(ms.Matches))
+		}
+		if got := fmt.Sprint(ms.MatchPositions(0)); got != want {
+			t.Errorf("%q: positions %s, want %s", in, got, want)
+		}
+	}
+}
+
+func TestQuotePattern(t *testing.T) {
+	lit := `a.b[0]*+(x)|^$\`
+	for _, dialect := range []Dialect{DialectDefault, DialectExtended, DialectBasic, DialectPerl} {
+		m, err := NewMatcher([]string{QuotePattern(lit, false, dialect)}, false, false, false, false, MatcherOpts{Dialect: dialect})
+		if err != nil {
+			t.Fatalf("dialect %d: %v", dialect, err)
+		}
+		if !m.MatchExists([]byte("x " + lit + " y\n")) {
+			t.Errorf("dialect %d: quoted literal does not match itself", dialect)
+		}
+		if m.MatchExists([]byte("aXb[0]*+(x)|^$\\\n")) {
+			t.Errorf("dialect %d: quoted literal matches as a regex", dialect)
+		}
+	}
+	if got := QuotePattern(lit, true, DialectDefault); got != lit {
+		t.Errorf("-F: got %q, want the literal", got)
+	}
+}
@@ -2,14 +2,15 @@ package matcher
 
 import "bytes"
 
-// separatorData is a shared backing buffer for "--" separator lines.
-var separatorData = []byte("--")
-
 // ContextMatcher wraps a Matcher and adds context lines (before/after).
 type ContextMatcher struct {
-	inner  Matcher
-	before int
-	after  int
+	inner        Matcher
+	before       int
+	after        int
+	highlight    bool // scan context lines for pattern positions
+	noSeparators bool // never emit group separator sentinels
+	joinGap      int  // merge groups separated by at most this many lines
+	maxCount     int  // select at most this many lines (0 = no limit)
 }
 
 // NewContextMatcher wraps an existing matcher to add context lines.
@@ -21,123 +22,248 @@ func NewContextMatcher(inner Matcher, before, after int) Matcher {
 	return &ContextMatcher{inner: inner, before: before, after: after}
 }
 
+// NewStreamContextMatcher is NewContextMatcher for watch mode: it returns
+// a ContextMatcher even without context lines, since its Stream also
+// carries line numbers and byte offsets from chunk to chunk.
+func NewStreamContextMatcher(inner Matcher, before, after int) *ContextMatcher {
+	return &ContextMatcher{inner: inner, before: before, after: after}
+}
+
+// SetHighlightContext enables a position scan on context lines so that
+// pattern occurrences in them can be highlighted. Context lines only contain
+// the pattern under -v, where they are the lines that matched.
+func (m *ContextMatcher) SetHighlightContext(on bool) {
+	m.highlight = on
+}
+
+// SetSeparators controls whether a separator sentinel (LineStart -1) is
+// emitted between non-contiguous groups. On by default.
+func (m *ContextMatcher) SetSeparators(on bool) {
+	m.noSeparators = !on
+}
+
+// SetJoinGap merges groups that are at most n lines apart into one block,
+// emitting the lines in between as context instead of a separator.
+func (m *ContextMatcher) SetJoinGap(n int) {
+	m.joinGap = n
+}
+
+// SetMaxCount selects at most n lines, as grep -m does (0 = no limit).
+// Trailing context after the last selected line is still emitted in full;
+// lines that would have been selected in it are printed as context.
+func (m *ContextMatcher) SetMaxCount(n int) {
+	m.maxCount = n
+}
+
 func (m *ContextMatcher) MatchExists(data []byte) bool {
 	return m.inner.MatchExists(data)
 }
 
 func (m *ContextMatcher) CountAll(data []byte) int {
+	if m.maxCount > 0 {
+		return countAtMost(m.inner, data, m.maxCount)
+	}
 	return m.inner.CountAll(data)
 }
 
+// FindAll runs the inner matcher over the whole buffer, so the SIMD and
+// prefiltered engines keep their speed, and then walks out from each matched
+// line to its context lines with newline searches. Lines far from a match
+// are never looked at.
 func (m *ContextMatcher) FindAll(data []byte) MatchSet {
-	// First, split data into lines and find all matching line numbers
-	type lineInfo struct {
-		start int
-		len   int
-	}
-	var lines []lineInfo
-	offset := 0
-	remaining := data
-	for len(remaining) > 0 {
-		idx := bytes.IndexByte(remaining, '\n')
-		var lineLen int
-		if idx >= 0 {
-			lineLen = idx
-			remaining = remaining[idx+1:]
-		} else {
-			lineLen = len(remaining)
-			remaining = nil
-		}
-		lines = append(lines, lineInfo{start: offset, len: lineLen})
-		offset += lineLen + 1
+	hits := m.matchedLines(data, 0, 1, m.locateLimit(0))
+	if len(hits.lines) == 0 {
+		return MatchSet{}
 	}
+	result := MatchSet{Data: data}
+	var st contextState
+	m.appendGroups(&result, data, hits, &st)
+	return result
+}
 
-	// Find which lines match — store the MatchSet from FindLine for each
-	type matchInfo struct {
-		ms MatchSet
+// contextState is where the output stands between calls on the chunks of
+// one file: the number of the last line emitted (0 if none), how many
+// after-context lines it is still owed, and how many lines were selected.
+type contextState struct {
+	last      int
+	afterLeft int
+	selected  int
+}
+
+// appendGroups appends the matched lines of hits, with their context lines
+// and group separators, to result. Line numbers continue from st. Context
+// lines are only taken from data: lines before it are never emitted.
+//
+// All matches and context lines reference data; a separator is a context
+// Match with LineStart -1, which the formatters print as "--".
+func (m *ContextMatcher) appendGroups(result *MatchSet, data []byte, hits contextHits, st *contextState) {
+	var scanner positionScanner
+	if m.highlight {
+		scanner, _ = m.inner.(positionScanner)
 	}
-	matchSet := make(map[int]matchInfo)
-	for i, li := range lines {
-		line := data[li.start : li.start+li.len]
-		ms, ok := m.inner.FindLine(line, i+1, int64(li.start))
-		if ok {
-			matchSet[i] = matchInfo{ms: ms}
+
+	emitContext := func(start int) int {
+		_, end := lineBounds(data, start)
+		st.last++
+		cm := Match{
+			LineNum:    st.last,
+			LineStart:  start,
+			LineLen:    end - start,
+			ByteOffset: int64(start),
+			IsContext:  true,
+		}
+		if scanner != nil {
+			positions := scanner.scanPositions(data[start:end])
+			cm.PosIdx = len(result.Positions)
+			cm.PosCount = len(positions)
+			result.Positions = append(result.Positions, positions...)
 		}
+		result.Matches = append(result.Matches, cm)
+		return end + 1
 	}
 
-	if len(matchSet) == 0 {
-		return MatchSet{}
+	// Finish the after-context owed to the last line of an earlier chunk,
+	// which hits.next locates in data.
+	limit := len(data)
+	if len(hits.lines) > 0 {
+		limit = hits.lines[0].start
+	}
+	for next := hits.next; st.afterLeft > 0 && next >= 0 && next < limit; st.afterLeft-- {
+		next = emitContext(next)
 	}
 
-	// Determine which lines to include (matches + context)
-	include := make(map[int]bool)
-	for idx := range matchSet {
-		for i := idx - m.before; i <= idx+m.after; i++ {
-			if i >= 0 && i < len(lines) {
-				include[i] = true
+	for k, hl := range hits.lines {
+		if m.maxCount > 0 && st.selected == m.maxCount {
+			// The -m limit is reached: later lines are at most trailing
+			// context, emitted below.
+			break
+		}
+		st.selected++
+
+		// Walk back over the before-context, not past what was emitted.
+		from, fromNum := hl.start, hl.num
+		for range m.before {
+			if from == 0 || fromNum-1 == st.last {
+				break
 			}
+			from, _ = lineBounds(data, from-1)
+			fromNum--
+		}
+		if st.last > 0 && fromNum > st.last+1 {
+			if start, ok := m.joinStart(data, from, fromNum-st.last-1); ok {
+				from, fromNum = start, st.last+1
+			} else if !m.noSeparators {
+				result.Matches = append(result.Matches, Match{LineStart: -1, IsContext: true})
+			}
+		}
+		st.last = fromNum - 1
+		for from < hl.start {
+			from = emitContext(from)
 		}
-	}
 
-	// Build result in order, inserting group separators
-	// All matches and context lines reference data, separators reference separatorData
-	result := MatchSet{Data: data}
-	lastIncluded := -2 // sentinel
+		posIdx := len(result.Positions)
+		result.Positions = append(result.Positions, hits.positions[hl.posIdx:hl.posIdx+hl.posCount]...)
+		result.Matches = append(result.Matches, Match{
+			LineNum:    hl.num,
+			LineStart:  hl.start,
+			LineLen:    hl.end - hl.start,
+			ByteOffset: int64(hl.start),
+			PosIdx:     posIdx,
+			PosCount:   hl.posCount,
+		})
+		st.last = hl.num
 
-	for i := 0; i < len(lines); i++ {
-		if !include[i] {
-			continue
+		// After-context, up to the next matched line, or in full once the
+		// -m limit is reached.
+		limit := len(data)
+		if k+1 < len(hits.lines) && st.selected != m.maxCount {
+			limit = hits.lines[k+1].start
 		}
-
-		// Insert separator between non-contiguous groups
-		if lastIncluded >= 0 && i > lastIncluded+1 && len(result.Matches) > 0 {
-			// Separator: LineNum=0, references separatorData indirectly.
-			// We store negative LineStart as sentinel; the formatter checks IsContext+LineNum==0.
-			// Actually, we need the separator text available. Since Data=data and "--" isn't in data,
-			// we handle separators specially: LineStart=-1, LineLen=0 signals separator.
-			result.Matches = append(result.Matches, Match{
-				LineNum:   0,
-				LineStart: -1, // sentinel for separator
-				LineLen:   0,
-				IsContext: true,
-			})
+		next := hl.end + 1
+		for st.afterLeft = m.after; st.afterLeft > 0 && next < limit; st.afterLeft-- {
+			next = emitContext(next)
 		}
+	}
+}
 
-		if mi, isMatch := matchSet[i]; isMatch {
-			// Copy match from inner FindLine result
-			// The inner result has Data=line (sub-slice of data), positions relative to line start.
-			// We need to re-base: positions stay the same (relative to line start),
-			// but LineStart needs to reference our data buffer.
-			li := lines[i]
-			innerMatch := mi.ms.Matches[0]
-			posIdx := len(result.Positions)
-			innerPositions := mi.ms.MatchPositions(0)
-			result.Positions = append(result.Positions, innerPositions...)
-
-			result.Matches = append(result.Matches, Match{
-				LineNum:    innerMatch.LineNum,
-				LineStart:  li.start,
-				LineLen:    li.len,
-				ByteOffset: int64(li.start),
-				PosIdx:     posIdx,
-				PosCount:   len(innerPositions),
-			})
-		} else {
-			// Context line
-			li := lines[i]
-			result.Matches = append(result.Matches, Match{
-				LineNum:    i + 1,
-				LineStart:  li.start,
-				LineLen:    li.len,
-				ByteOffset: int64(li.start),
-				IsContext:  true,
-			})
+// joinStart returns where a group starting at from begins when it is
+// joined to the previous one across gap lines, or false if the gap is too
+// wide to join or reaches back before data.
+func (m *ContextMatcher) joinStart(data []byte, from, gap int) (int, bool) {
+	if m.joinGap == 0 || gap > m.joinGap {
+		return 0, false
+	}
+	for range gap {
+		if from == 0 {
+			return 0, false
 		}
+		from, _ = lineBounds(data, from-1)
+	}
+	return from, true
+}
 
-		lastIncluded = i
+// contextHits is the set of lines the inner matcher selected, in buffer
+// order, with their positions relative to each line's start.
+type contextHits struct {
+	lines     []hitLine
+	positions [][2]int
+	next      int // start of the first searched line, -1 if there is none
+}
+
+type hitLine struct {
+	start, end int // line bounds in data, end excluding the newline
+	num        int // 1-based line number
+	posIdx     int
+	posCount   int
+}
+
+// matchedLines widens the inner matcher's matches, which may be snippets
+// cut to the column limit, to whole lines. Several snippets on one line
+// become one line with all their positions. Matches starting before skip,
+// in lines kept from an earlier chunk, are dropped. firstNum is the
+// number of data's first line; lines are counted between matches only.
+// If limit is positive, the search may stop after that many selected lines.
+func (m *ContextMatcher) matchedLines(data []byte, skip, firstNum, limit int) contextHits {
+	hits := contextHits{next: -1}
+	if skip < len(data) {
+		hits.next = skip
 	}
+	var ms MatchSet
+	if limit > 0 {
+		ms = findAtMost(m.inner, data, skip, limit)
+	} else {
+		ms = m.inner.FindAll(data)
+	}
+	counted, num := 0, firstNum
+	for i, mt := range ms.Matches {
+		if mt.IsContext || mt.LineStart < skip || mt.LineStart >= len(data) {
+			continue
+		}
+		start, end := lineBounds(data, mt.LineStart)
+		n := len(hits.lines)
+		if n == 0 || hits.lines[n-1].start != start {
+			num += bytes.Count(data[counted:start], []byte{'\n'})
+			counted = start
+			hits.lines = append(hits.lines, hitLine{start: start, end: end, num: num, posIdx: len(hits.positions)})
+			n++
+		}
+		shift := mt.LineStart - start
+		for _, pos := range ms.MatchPositions(i) {
+			hits.positions = append(hits.positions, [2]int{pos[0] + shift, pos[1] + shift})
+		}
+		hits.lines[n-1].posCount = len(hits.positions) - hits.lines[n-1].posIdx
+	}
+	return hits
+}
 
-	return result
+// locateLimit returns how many selected lines a search must locate when
+// selected lines were already selected (0 = all of them): the ones the
+// -m limit still allows. It must not be called once the limit is reached.
+func (m *ContextMatcher) locateLimit(selected int) int {
+	if m.maxCount == 0 {
+		return 0
+	}
+	return m.maxCount - selected
 }
 
 func (m *ContextMatcher) FindLine(line []byte, lineNum int, byteOffset int64) (MatchSet, bool) {
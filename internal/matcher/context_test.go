@@ -1,6 +1,10 @@
 package matcher
 
 import (
+	"bytes"
+	"math/rand/v2"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -132,3 +136,246 @@ func TestContextMatcher_FindLine(t *testing.T) {
 		t.Errorf("LineNum = %d, want 5", ms.Matches[0].LineNum)
 	}
 }
+
+func TestContextMatcher_HighlightContext(t *testing.T) {
+	inner, _ := NewRegexMatcher("foo", false, true)
+	m := NewContextMatcher(inner, 1, 1).(*ContextMatcher)
+	m.SetHighlightContext(true)
+
+	ms := m.FindAll([]byte("foo foo\nbar\nbaz foo\n"))
+	// Inverted: bar matches; foo lines are context and carry positions.
+	if len(ms.Matches) != 3 {
+		t.Fatalf("got %d matches, want 3", len(ms.Matches))
+	}
+	if got := ms.MatchPositions(0); len(got) != 2 || got[0] != [2]int{0, 3} || got[1] != [2]int{4, 7} {
+		t.Errorf("context line 1 positions = %v, want [[0 3] [4 7]]", got)
+	}
+	if got := ms.MatchPositions(1); len(got) != 0 {
+		t.Errorf("inverted match positions = %v, want none", got)
+	}
+	if got := ms.MatchPositions(2); len(got) != 1 || got[0] != [2]int{4, 7} {
+		t.Errorf("context line 3 positions = %v, want [[4 7]]", got)
+	}
+}
+
+func TestContextMatcher_HighlightContextAllEngines(t *testing.T) {
+	data := []byte("TODO one\nother\nTODO two\n")
+	inners := map[string]Matcher{
+		"boyermoore":  NewBoyerMooreMatcher("TODO", false, true),
+		"ahocorasick": NewAhoCorasickMatcher([]string{"TODO", "FIXME"}, false, true),
+		"fixed":       NewFixedMatcher("TODO", false, true),
+	}
+	for name, inner := range inners {
+		t.Run(name, func(t *testing.T) {
+			m := NewContextMatcher(inner, 1, 1).(*ContextMatcher)
+			m.SetHighlightContext(true)
+			ms := m.FindAll(data)
+			if len(ms.Matches) != 3 {
+				t.Fatalf("got %d matches, want 3", len(ms.Matches))
+			}
+			for _, i := range []int{0, 2} {
+				if got := ms.MatchPositions(i); len(got) != 1 || got[0] != [2]int{0, 4} {
+					t.Errorf("context %d positions = %v, want [[0 4]]", i, got)
+				}
+			}
+		})
+	}
+}
+
+func TestContextMatcher_NoHighlightByDefault(t *testing.T) {
+	inner, _ := NewRegexMatcher("foo", false, true)
+	m := NewContextMatcher(inner, 1, 0)
+
+	ms := m.FindAll([]byte("foo\nbar\n"))
+	if len(ms.Matches) != 2 {
+		t.Fatalf("got %d matches, want 2", len(ms.Matches))
+	}
+	if got := ms.MatchPositions(0); len(got) != 0 {
+		t.Errorf("context positions = %v, want none without highlight", got)
+	}
+}
+
+func TestContextMatcher_NoSeparators(t *testing.T) {
+	inner, _ := NewRegexMatcher("match", false, false)
+	m := NewContextMatcher(inner, 0, 1).(*ContextMatcher)
+	m.SetSeparators(false)
+
+	ms := m.FindAll([]byte("match\na\nb\nc\nmatch\nd\n"))
+	if len(ms.Matches) != 4 {
+		t.Fatalf("got %d entries, want 4", len(ms.Matches))
+	}
+	for _, mt := range ms.Matches {
+		if mt.LineStart < 0 {
+			t.Error("separator emitted with separators disabled")
+		}
+	}
+}
+
+func TestContextMatcher_JoinGap(t *testing.T) {
+	inner, _ := NewRegexMatcher("match", false, false)
+	data := []byte("match\na\nb\nc\nmatch\nd\ne\nf\ng\nh\nmatch\n")
+
+	tests := []struct {
+		gap       int
+		wantLines []int // 0 = separator
+	}{
+		{0, []int{1, 2, 0, 5, 6, 0, 11}},
+		{2, []int{1, 2, 3, 4, 5, 6, 0, 11}},
+		{4, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}},
+	}
+	for _, tt := range tests {
+		m := NewContextMatcher(inner, 0, 1).(*ContextMatcher)
+		m.SetJoinGap(tt.gap)
+		ms := m.FindAll(data)
+		var got []int
+		for _, mt := range ms.Matches {
+			got = append(got, mt.LineNum)
+		}
+		if !equalInts(got, tt.wantLines) {
+			t.Errorf("gap %d: lines %v, want %v", tt.gap, got, tt.wantLines)
+		}
+	}
+}
+
+func TestContextMatcher_SnippetsWidenedToLines(t *testing.T) {
+	// A column limit makes the inner matcher report two snippets on the
+	// long line; the context result has the whole line once, with both
+	// positions relative to its start.
+	inner, err := NewMatcher([]string{"needle"}, true, false, false, false, MatcherOpts{MaxCols: 10, NeedLineNums: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	long := "needle" + strings.Repeat("x", 100) + "needle"
+	m := NewContextMatcher(inner, 1, 0)
+
+	ms := m.FindAll([]byte("before\n" + long + "\nafter\n"))
+	if len(ms.Matches) != 2 {
+		t.Fatalf("got %d matches, want 2", len(ms.Matches))
+	}
+	mt := ms.Matches[1]
+	if mt.LineNum != 2 || mt.LineStart != 7 || mt.LineLen != len(long) {
+		t.Errorf("match: LineNum=%d LineStart=%d LineLen=%d, want 2, 7, %d", mt.LineNum, mt.LineStart, mt.LineLen, len(long))
+	}
+	want := [][2]int{{0, 6}, {106, 112}}
+	if got := ms.MatchPositions(1); !reflect.DeepEqual(got, want) {
+		t.Errorf("positions = %v, want %v", got, want)
+	}
+}
+
+// TestContextMatcher_MatchesLineScan checks FindAll against a plain scan
+// that calls FindLine on every line.
+func TestContextMatcher_MatchesLineScan(t *testing.T) {
+	rng := rand.New(rand.NewPCG(3, 4))
+	words := []string{"foo", "bar", "baz", "", "quux"}
+	var sb strings.Builder
+	for range 300 {
+		sb.WriteString(words[rng.IntN(len(words))])
+		sb.WriteByte('\n')
+	}
+	data := []byte(sb.String())
+
+	inner, _ := NewRegexMatcher("quux", false, false)
+	for _, before := range []int{0, 1, 3} {
+		for _, after := range []int{0, 2} {
+			for _, gap := range []int{0, 2} {
+				for _, maxCount := range []int{0, 1, 7} {
+					if before == 0 && after == 0 {
+						continue
+					}
+					m := NewContextMatcher(inner, before, after).(*ContextMatcher)
+					m.SetJoinGap(gap)
+					m.SetMaxCount(maxCount)
+					got := m.FindAll(data)
+					want := lineScanContext(inner, data, before, after, gap, maxCount)
+					if !reflect.DeepEqual(contextLines(got), want) {
+						t.Errorf("-B%d -A%d join %d -m %d:\n got %v\nwant %v", before, after, gap, maxCount, contextLines(got), want)
+					}
+				}
+			}
+		}
+	}
+}
+
+// contextLines renders a context result as line numbers, negative for
+// context lines and 0 for separators.
+func contextLines(ms MatchSet) []int {
+	var lines []int
+	for _, mt := range ms.Matches {
+		switch {
+		case mt.LineStart < 0:
+			lines = append(lines, 0)
+		case mt.IsContext:
+			lines = append(lines, -mt.LineNum)
+		default:
+			lines = append(lines, mt.LineNum)
+		}
+	}
+	return lines
+}
+
+// lineScanContext is the reference for ContextMatcher.FindAll. With
+// maxCount, as in grep, nothing is selected after the last line allowed,
+// and the file ends for the search after that line's trailing context.
+func lineScanContext(inner Matcher, data []byte, before, after, gap, maxCount int) []int {
+	lines := bytes.SplitAfter(data, []byte{'\n'})
+	if len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	selectable := len(lines)
+	if maxCount > 0 {
+		selected := 0
+		for i, l := range lines {
+			if _, ok := inner.FindLine(bytes.TrimSuffix(l, []byte{'\n'}), i+1, 0); ok {
+				if selected++; selected == maxCount {
+					selectable = i + 1
+					lines = lines[:min(i+1+after, len(lines))]
+					break
+				}
+			}
+		}
+	}
+	matched := make([]bool, len(lines))
+	include := make([]bool, len(lines))
+	for i, l := range lines[:min(selectable, len(lines))] {
+		if _, ok := inner.FindLine(bytes.TrimSuffix(l, []byte{'\n'}), i+1, 0); ok {
+			matched[i] = true
+			for j := max(i-before, 0); j <= min(i+after, len(lines)-1); j++ {
+				include[j] = true
+			}
+		}
+	}
+	var out []int
+	last := -1
+	for i := range lines {
+		if !include[i] {
+			continue
+		}
+		if last >= 0 && i > last+1 {
+			if i-last-1 <= gap {
+				for j := last + 1; j < i; j++ {
+					out = append(out, -(j + 1))
+				}
+			} else {
+				out = append(out, 0)
+			}
+		}
+		if matched[i] {
+			out = append(out, i+1)
+		} else {
+			out = append(out, -(i + 1))
+		}
+		last = i
+	}
+	return out
+}
+
+func BenchmarkContextMatcher_Sparse(b *testing.B) {
+	data := bytes.Repeat([]byte("the quick brown fox jumps over the lazy dog\n"), 20000)
+	copy(data[len(data)/2:], "ERROR")
+	inner := NewBoyerMooreMatcher("ERROR", false, false)
+	m := NewContextMatcher(inner, 2, 2)
+	b.SetBytes(int64(len(data)))
+	for b.Loop() {
+		m.FindAll(data)
+	}
+}
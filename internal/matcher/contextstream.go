@@ -0,0 +1,108 @@
+package matcher
+
+import "bytes"
+
+// ContextStream searches the successive chunks of a growing file, as watch
+// mode reads them, so that line numbers, byte offsets and context lines
+// come out as a search of the whole file prints them: before-context and
+// joined gaps reach back into earlier chunks, after-context continues into
+// later ones, and separators fall between groups, not between chunks.
+type ContextStream struct {
+	m      *ContextMatcher
+	tail   []byte // last complete lines of earlier chunks, for before-context
+	lines  int    // complete lines before the next chunk
+	offset int64  // file offset of the next chunk
+	st     contextState
+}
+
+// Stream returns a ContextStream with m's context settings, for a file of
+// which lines lines, offset bytes, were read before and are not searched.
+// Without context lines, results are the inner matcher's, renumbered.
+func (m *ContextMatcher) Stream(lines int, offset int64) *ContextStream {
+	return &ContextStream{m: m, lines: lines, offset: offset}
+}
+
+// FindAll searches the next chunk of the file. Line numbers and byte
+// offsets in the result are the file's. The result's Data may begin with
+// lines kept from earlier chunks.
+func (s *ContextStream) FindAll(chunk []byte) MatchSet {
+	defer s.advance(chunk)
+
+	if s.m.maxCount > 0 && s.st.selected == s.m.maxCount && s.st.afterLeft == 0 {
+		return MatchSet{} // -m reached, and no trailing context owed
+	}
+
+	if s.m.before == 0 && s.m.after == 0 {
+		var ms MatchSet
+		if s.m.maxCount > 0 {
+			left := s.m.maxCount - s.st.selected
+			var n int
+			ms, n = limitLines(findAtMost(s.m.inner, chunk, 0, left), left)
+			s.st.selected += n
+		} else {
+			ms = s.m.inner.FindAll(chunk)
+		}
+		for i := range ms.Matches {
+			if mt := &ms.Matches[i]; mt.LineStart >= 0 {
+				mt.LineNum += s.lines
+				mt.ByteOffset += s.offset
+			}
+		}
+		return ms
+	}
+
+	data := chunk
+	if len(s.tail) > 0 {
+		data = append(s.tail[:len(s.tail):len(s.tail)], chunk...)
+	}
+	firstNum := s.lines - bytes.Count(s.tail, []byte{'\n'}) + 1
+	var hits contextHits
+	if s.m.maxCount > 0 && s.st.selected == s.m.maxCount {
+		// Only the trailing context of the last allowed line is owed.
+		hits = contextHits{next: len(s.tail)}
+	} else {
+		hits = s.m.matchedLines(data, len(s.tail), firstNum, s.m.locateLimit(s.st.selected))
+	}
+	if len(hits.lines) == 0 && s.st.afterLeft == 0 {
+		return MatchSet{}
+	}
+
+	result := MatchSet{Data: data}
+	s.m.appendGroups(&result, data, hits, &s.st)
+	if len(result.Matches) == 0 {
+		return MatchSet{}
+	}
+	base := s.offset - int64(len(s.tail))
+	for i := range result.Matches {
+		if mt := &result.Matches[i]; mt.LineStart >= 0 {
+			mt.ByteOffset += base
+		}
+	}
+	return result
+}
+
+// Swap makes the stream search later chunks with m, which must have the
+// same context settings, keeping its place in the file and any pending
+// context. Watch mode swaps in a matcher built from reloaded patterns.
+func (s *ContextStream) Swap(m *ContextMatcher) {
+	s.m = m
+}
+
+// advance moves past chunk, keeping as many of the last complete lines as
+// before-context and a joined gap ahead of it can reach back.
+func (s *ContextStream) advance(chunk []byte) {
+	s.lines += bytes.Count(chunk, []byte{'\n'})
+	s.offset += int64(len(chunk))
+
+	keep := s.m.before + s.m.joinGap
+	if keep == 0 {
+		return
+	}
+	data := append(s.tail[:len(s.tail):len(s.tail)], chunk...)
+	end := bytes.LastIndexByte(data, '\n') + 1
+	start := end
+	for i := 0; i < keep && start > 0; i++ {
+		start = bytes.LastIndexByte(data[:start-1], '\n') + 1
+	}
+	s.tail = append(s.tail[:0:0], data[start:end]...)
+}
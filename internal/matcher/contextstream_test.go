@@ -0,0 +1,103 @@
+package matcher
+
+import (
+	"bytes"
+	"math/rand/v2"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// streamRecord is a match as printed: line number, kind, text and offset.
+type streamRecord struct {
+	line   int // negative for context lines, 0 for separators
+	text   string
+	offset int64
+}
+
+func streamRecords(ms MatchSet) []streamRecord {
+	var recs []streamRecord
+	for i, n := range contextLines(ms) {
+		mt := ms.Matches[i]
+		if n == 0 {
+			recs = append(recs, streamRecord{})
+			continue
+		}
+		recs = append(recs, streamRecord{n, string(ms.Data[mt.LineStart : mt.LineStart+mt.LineLen]), mt.ByteOffset})
+	}
+	return recs
+}
+
+func TestContextStream_MatchesWholeFile(t *testing.T) {
+	rng := rand.New(rand.NewPCG(5, 6))
+	words := []string{"foo", "bar", "", "quux", "baz"}
+	var lines []string
+	for range 200 {
+		lines = append(lines, words[rng.IntN(len(words))])
+	}
+	data := []byte(strings.Join(lines, "\n") + "\n")
+
+	inner, err := NewMatcher([]string{"quux"}, false, false, false, false, MatcherOpts{NeedLineNums: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct{ before, after, gap, skip, maxCount int }{
+		{0, 0, 0, 0, 0}, {0, 0, 0, 10, 0}, {2, 0, 0, 0, 0}, {0, 3, 0, 0, 0}, {1, 1, 0, 0, 0}, {1, 1, 3, 0, 0},
+		{0, 0, 0, 0, 5}, {0, 4, 0, 0, 9}, {2, 2, 1, 0, 12},
+	} {
+		whole := NewStreamContextMatcher(inner, tc.before, tc.after)
+		whole.SetJoinGap(tc.gap)
+		whole.SetMaxCount(tc.maxCount)
+		want := streamRecords(whole.Stream(0, 0).FindAll(data))
+
+		// The same file appended a few lines at a time, after the first
+		// skip lines that were there before watching began.
+		start := 0
+		for range tc.skip {
+			start += bytes.IndexByte(data[start:], '\n') + 1
+		}
+		for len(want) > 0 && -want[0].line <= tc.skip && want[0].line <= tc.skip {
+			want = want[1:]
+		}
+		s := whole.Stream(tc.skip, int64(start))
+		var got []streamRecord
+		for off := start; off < len(data); {
+			end := off
+			for range 1 + rng.IntN(6) {
+				if end < len(data) {
+					end += bytes.IndexByte(data[end:], '\n') + 1
+				}
+			}
+			got = append(got, streamRecords(s.FindAll(data[off:end]))...)
+			off = end
+		}
+
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("-B%d -A%d join %d skip %d -m %d:\n got %v\nwant %v", tc.before, tc.after, tc.gap, tc.skip, tc.maxCount, got, want)
+		}
+	}
+}
+
+func TestContextStream_Swap(t *testing.T) {
+	newCtx := func(pattern string) *ContextMatcher {
+		inner, err := NewMatcher([]string{pattern}, false, false, false, false, MatcherOpts{NeedLineNums: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return NewStreamContextMatcher(inner, 1, 1)
+	}
+	s := newCtx("foo").Stream(0, 0)
+	got := streamRecords(s.FindAll([]byte("a\nfoo\n")))
+	s.Swap(newCtx("bar"))
+	got = append(got, streamRecords(s.FindAll([]byte("b\nfoo\nc\nbar\n")))...)
+
+	// After-context of foo continues into the second chunk; there, only
+	// bar matches, with c as its before-context, after a separator.
+	want := []streamRecord{
+		{-1, "a", 0}, {2, "foo", 2}, {-3, "b", 6}, {},
+		{-5, "c", 12}, {6, "bar", 14},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,152 @@
+package matcher
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// emptyCases are inputs with no lines or empty lines, searched with
+// patterns that can match the empty string and ones that cannot. grep
+// reads a file as the lines its newlines end: an empty file has none, and
+// the end of a file that ends in a newline does not start another.
+var emptyCases = []struct {
+	name  string
+	input string
+}{
+	{"empty", ""},
+	{"newline", "\n"},
+	{"two newlines", "\n\n"},
+	{"line and empty line", "a\n\n"},
+	{"no trailing newline", "foo\n\nbar"},
+}
+
+var emptyPatterns = []string{"a*", "x?", "fo+", "foo", "^$", "^", "a$", "^b"}
+
+// emptyMatchers builds every engine for pattern, which is a literal when
+// fixed. The multi-pattern engines get a second pattern that never matches.
+func emptyMatchers(t *testing.T, pattern string, fixed, invert bool) map[string]Matcher {
+	t.Helper()
+	opts := MatcherOpts{NeedLineNums: true}
+	ms := make(map[string]Matcher)
+	add := func(name string, patterns []string, fixed, pcre bool) {
+		m, err := NewMatcher(patterns, fixed, pcre, false, invert, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ms[name] = m
+	}
+	if fixed {
+		add("fixed", []string{pattern}, true, false)
+		add("fixed-multi", []string{pattern, "never\x00"}, true, false)
+		return ms
+	}
+	add("regex", []string{pattern}, false, false)
+	add("regex-multi", []string{pattern, "nev(er)+"}, false, false)
+	if os.Getenv("GOGREP_SKIP_PCRE") != "1" {
+		add("pcre", []string{pattern}, false, true)
+	}
+	re, err := NewMatcher([]string{pattern}, false, false, false, invert, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms["context"] = NewContextMatcher(re, 1, 1)
+	return ms
+}
+
+// emptyRef is refLines for an input that may have no lines at all.
+func emptyRef(pattern, input string, invert bool) []int {
+	if input == "" {
+		return nil
+	}
+	return refLines(regexp.MustCompile(pattern), input, invert)
+}
+
+// checkEmptyCase runs every entry point of m on input against want, the
+// numbers of the selected lines.
+func checkEmptyCase(t *testing.T, m Matcher, input string, want []int) {
+	t.Helper()
+	data := []byte(input)
+	if got := m.CountAll(data); got != len(want) {
+		t.Errorf("CountAll = %d, want %d", got, len(want))
+	}
+	if got := m.MatchExists(data); got != (len(want) > 0) {
+		t.Errorf("MatchExists = %v, want %v", got, len(want) > 0)
+	}
+	var got []int
+	for _, mt := range m.FindAll(data).Matches {
+		if !mt.IsContext && mt.LineStart >= 0 {
+			got = append(got, mt.LineNum)
+		}
+	}
+	if !equalInts(got, want) {
+		t.Errorf("FindAll lines = %v, want %v", got, want)
+	}
+	got = got[:0]
+	for _, mt := range FindFirst(m, data).Matches {
+		if !mt.IsContext && mt.LineStart >= 0 {
+			got = append(got, mt.LineNum)
+		}
+	}
+	if !equalInts(got, want[:min(len(want), 1)]) {
+		t.Errorf("FindFirst lines = %v, want %v", got, want[:min(len(want), 1)])
+	}
+}
+
+func TestEmptyLines_CrossMatcher(t *testing.T) {
+	for _, invert := range []bool{false, true} {
+		for _, pattern := range emptyPatterns {
+			for _, tc := range emptyCases {
+				want := emptyRef(pattern, tc.input, invert)
+				fixed := pattern == "foo"
+				for name, m := range emptyMatchers(t, pattern, fixed, invert) {
+					t.Run(tc.name+"/"+pattern+"/"+name+"/invert="+strconv.FormatBool(invert), func(t *testing.T) {
+						checkEmptyCase(t, m, tc.input, want)
+					})
+				}
+			}
+		}
+	}
+}
+
+// TestEmptyLines_GNUGrep compares line selection on empty files and empty
+// lines against the system grep, when one is available.
+func TestEmptyLines_GNUGrep(t *testing.T) {
+	grep, err := exec.LookPath("grep")
+	if err != nil {
+		t.Skip("grep not found in PATH")
+	}
+	dir := t.TempDir()
+
+	for _, tc := range emptyCases {
+		path := filepath.Join(dir, strings.ReplaceAll(tc.name, " ", "_"))
+		if err := os.WriteFile(path, []byte(tc.input), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		for _, invert := range []bool{false, true} {
+			for _, pattern := range emptyPatterns {
+				args := []string{"-n", "-E", "-e", pattern, path}
+				if invert {
+					args = append([]string{"-v"}, args...)
+				}
+				out, _ := exec.Command(grep, args...).Output()
+				var want []int
+				for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+					if num, _, ok := strings.Cut(line, ":"); ok {
+						n, _ := strconv.Atoi(num)
+						want = append(want, n)
+					}
+				}
+				for name, m := range emptyMatchers(t, pattern, pattern == "foo", invert) {
+					t.Run(tc.name+"/"+pattern+"/"+name+"/invert="+strconv.FormatBool(invert), func(t *testing.T) {
+						checkEmptyCase(t, m, tc.input, want)
+					})
+				}
+			}
+		}
+	}
+}
@@ -2,107 +2,281 @@ package matcher
 
 import (
 	"fmt"
-	"strings"
+	"regexp"
+	"slices"
 )
 
 // MatcherOpts holds display-related options that affect match extraction.
 type MatcherOpts struct {
-	MaxCols      int  // max columns for snippet extraction (0 = full lines)
-	NeedLineNums bool // compute line numbers (false = skip for speed)
+	MaxCols      int     // max columns for snippet extraction (0 = full lines)
+	NeedLineNums bool    // compute line numbers (false = skip for speed)
+	Dialect      Dialect // pattern syntax; overrides fixed/usePCRE when set
+	LineRegexp   bool    // select only lines that a pattern matches whole (-x)
+	Multiline    bool    // let matches span lines, each reported with all its lines (-U)
+	Symbol       bool    // keep only matches bounded by non-identifier bytes (--symbol)
 }
 
 // NewMatcher creates the appropriate Matcher based on the provided options.
+// opts.Dialect, when not DialectDefault, takes precedence over the fixed and
+// usePCRE flags. DialectBasic patterns are translated to RE2 first.
 // Selection logic:
+//   - Symbol -> SymbolMatcher around the matcher chosen below, built
+//     without invert so that literals keep their SIMD engines
+//   - LineRegexp with fixed or literal patterns -> LineEqualMatcher (each
+//     line compared whole); regexes are anchored and go on as below
+//   - Multiline -> RegexMatcher or PCREMatcher over the whole buffer, with
+//     matches reported as the lines they span
 //   - PCRE flag -> PCREMatcher (PCRE2 via pure Go port)
-//   - Fixed + 1 pattern -> BoyerMooreMatcher (sublinear search)
+//   - Fixed + 1 pattern -> BoyerMooreMatcher (sublinear search); up to 8
+//     bytes, switching to Shift-Or on inputs dense with matches
+//   - Fixed + few patterns -> MultiScanMatcher (one SIMD scan per pattern)
 //   - Fixed + N patterns -> AhoCorasickMatcher (single-pass multi-pattern)
+//   - Literals mixed with regexes -> CompositeMatcher (a fixed-string pass
+//     and a regex pass, merged)
+//   - Several regexes without a prefilter literal -> LazyDFAMatcher
 //   - Otherwise -> RegexMatcher (RE2)
 func NewMatcher(patterns []string, fixed bool, usePCRE bool, ignoreCase bool, invert bool, opts MatcherOpts) (Matcher, error) {
 	if len(patterns) == 0 {
 		return nil, fmt.Errorf("no patterns provided")
 	}
 
-	if usePCRE {
-		// Combine multiple patterns with |
-		pattern := patterns[0]
-		if len(patterns) > 1 {
-			combined := ""
-			for i, p := range patterns {
-				if i > 0 {
-					combined += "|"
-				}
-				combined += "(?:" + p + ")"
-			}
-			pattern = combined
+	if opts.Symbol {
+		innerOpts := opts
+		innerOpts.Symbol = false
+		if invert {
+			// Inverted output is the lines between matches, found from
+			// the line starts the inner matcher reports.
+			innerOpts.MaxCols = 0
 		}
-		m, err := NewPCREMatcher(pattern, ignoreCase, invert)
+		m, err := NewMatcher(patterns, fixed, usePCRE, ignoreCase, false, innerOpts)
 		if err != nil {
 			return nil, err
 		}
-		m.maxCols = opts.MaxCols
-		m.needLineNums = opts.NeedLineNums
-		return m, nil
+		return NewSymbolMatcher(m, invert), nil
 	}
 
-	if fixed {
-		if len(patterns) == 1 {
-			m := NewBoyerMooreMatcher(patterns[0], ignoreCase, invert)
-			m.maxCols = opts.MaxCols
-			m.needLineNums = opts.NeedLineNums
-			return m, nil
+	switch opts.Dialect {
+	case DialectFixed:
+		fixed, usePCRE = true, false
+	case DialectPerl:
+		fixed, usePCRE = false, true
+	case DialectExtended:
+		fixed, usePCRE = false, false
+	case DialectBasic:
+		fixed, usePCRE = false, false
+		translated := make([]string, len(patterns))
+		for i, p := range patterns {
+			t, err := translateBRE(p)
+			if err != nil {
+				return nil, fmt.Errorf("basic regexp %q: %w", p, err)
+			}
+			translated[i] = t
 		}
-		m := NewAhoCorasickMatcher(patterns, ignoreCase, invert)
-		m.maxCols = opts.MaxCols
-		m.needLineNums = opts.NeedLineNums
-		return m, nil
+		patterns = translated
 	}
 
-	// Optimization: if all patterns are literal strings (no regex metacharacters),
-	// use BoyerMooreMatcher / AhoCorasickMatcher for SIMD-accelerated search.
-	allLiteral := true
-	for _, p := range patterns {
-		if !isLiteral(p) {
-			allLiteral = false
-			break
+	if opts.LineRegexp {
+		if fixed {
+			return NewLineEqualMatcher(patterns, ignoreCase, invert), nil
 		}
+		if literals, ok := allLiterals(patterns); ok && !usePCRE {
+			return NewLineEqualMatcher(literals, ignoreCase, invert), nil
+		}
+		patterns = anchorLines(patterns)
+	}
+
+	if opts.Multiline {
+		return newMultilineMatcher(patterns, fixed, usePCRE, ignoreCase, invert, opts)
 	}
-	if allLiteral {
-		if len(patterns) == 1 {
-			m := NewBoyerMooreMatcher(patterns[0], ignoreCase, invert)
-			m.maxCols = opts.MaxCols
-			m.needLineNums = opts.NeedLineNums
-			return m, nil
+
+	if usePCRE {
+		m, err := NewPCREMatcher(alternation(patterns), ignoreCase, invert)
+		if err != nil {
+			return nil, err
 		}
-		m := NewAhoCorasickMatcher(patterns, ignoreCase, invert)
 		m.maxCols = opts.MaxCols
 		m.needLineNums = opts.NeedLineNums
 		return m, nil
 	}
 
-	// Regex mode: combine multiple patterns with |
-	pattern := patterns[0]
-	if len(patterns) > 1 {
-		combined := ""
-		for i, p := range patterns {
-			if i > 0 {
-				combined += "|"
-			}
-			combined += "(?:" + p + ")"
-		}
-		pattern = combined
+	if fixed {
+		return newFixedMatcher(patterns, ignoreCase, invert, opts), nil
+	}
+
+	// Optimization: if all patterns are literal strings (no regex metacharacters,
+	// or only escaped ones), use the fixed-string matchers for SIMD search.
+	if literals, ok := allLiterals(patterns); ok {
+		return newFixedMatcher(literals, ignoreCase, invert, opts), nil
+	}
+
+	// A mix of literals and regexes searches each kind with its own engine.
+	if literals, regexes := splitLiterals(patterns); len(literals) > 0 && len(regexes) > 0 {
+		return newCompositeMatcher(literals, regexes, ignoreCase, invert, opts)
 	}
 
+	// Regex mode: combine multiple patterns with |
+	pattern := alternation(patterns)
+
 	m, err := NewRegexMatcher(pattern, ignoreCase, invert)
 	if err != nil {
 		return nil, err
 	}
+
+	// A literal prefilter skips most lines with a SIMD scan, which beats any
+	// automaton. Without one, an alternation runs faster through the lazy
+	// DFA (unless it uses \b or \B, which the DFA cannot evaluate).
+	if len(patterns) > 1 && !m.hasPrefilter() {
+		if dm, err := NewLazyDFAMatcher(pattern, ignoreCase, invert); err == nil {
+			dm.maxCols = opts.MaxCols
+			dm.needLineNums = opts.NeedLineNums
+			return dm, nil
+		}
+	}
+
 	m.maxCols = opts.MaxCols
 	m.needLineNums = opts.NeedLineNums
 	return m, nil
 }
 
-// isLiteral returns true if the pattern contains no regex metacharacters
-// and can be treated as a fixed string.
-func isLiteral(pattern string) bool {
-	return !strings.ContainsAny(pattern, `\.+*?()|[]{}^$`)
+// allLiterals returns patterns unescaped if every one is a plain literal.
+func allLiterals(patterns []string) ([]string, bool) {
+	literals := make([]string, 0, len(patterns))
+	for _, p := range patterns {
+		lit, ok := patternLiteral(p)
+		if !ok {
+			return nil, false
+		}
+		literals = append(literals, lit)
+	}
+	return literals, true
+}
+
+// anchorLines makes each pattern match only whole lines, in RE2 and PCRE
+// syntax alike. The group keeps an alternation inside the anchors, and
+// the m flag makes them match at every line's edges, since matchers run a
+// pattern over a whole buffer.
+func anchorLines(patterns []string) []string {
+	anchored := make([]string, len(patterns))
+	for i, p := range patterns {
+		anchored[i] = "(?m:^(?:" + p + ")$)"
+	}
+	return anchored
+}
+
+// splitLiterals separates the patterns that are plain literals, returned
+// unescaped, from the rest. The empty pattern counts as a regex: it
+// matches every line, which the fixed-string engines cannot express.
+func splitLiterals(patterns []string) (literals, regexes []string) {
+	for _, p := range patterns {
+		if lit, ok := patternLiteral(p); ok && lit != "" {
+			literals = append(literals, lit)
+		} else {
+			regexes = append(regexes, p)
+		}
+	}
+	return literals, regexes
+}
+
+// alternation combines patterns into one that matches any of them.
+func alternation(patterns []string) string {
+	if len(patterns) == 1 {
+		return patterns[0]
+	}
+	combined := ""
+	for i, p := range patterns {
+		if i > 0 {
+			combined += "|"
+		}
+		combined += "(?:" + p + ")"
+	}
+	return combined
+}
+
+// fixedEngine identifies a fixed-string matcher implementation.
+type fixedEngine int
+
+const (
+	engineBoyerMoore fixedEngine = iota
+	engineShortPattern
+	engineMultiScan
+	engineAhoCorasick
+)
+
+// Crossover thresholds between MultiScanMatcher and AhoCorasickMatcher,
+// measured with BenchmarkFixedEngineCrossover (20K lines, AVX2). Aho-Corasick
+// runs at a flat ~300-450 MB/s whatever the pattern count; MultiScan pays one
+// SIMD pass per pattern, ~3 GB/s per pass for multi-byte patterns without
+// matches, dropping to ~700 MB/s when every other line matches. So:
+//
+//	multi-byte patterns:       MultiScan wins up to ~12 sparse, ~8 dense
+//	single-byte or -i scans:   MultiScan still wins at 16, any density
+//
+// Density is unknown when the matcher is built, so the cut-offs use the
+// dense-data crossover.
+const (
+	multiScanMaxPatterns     = 8  // multi-byte, case-sensitive patterns
+	multiScanMaxFastPatterns = 16 // when every scan takes a faster SIMD path
+)
+
+// selectFixedEngine picks the fastest matcher for a set of fixed patterns.
+func selectFixedEngine(patterns []string, ignoreCase bool) fixedEngine {
+	if len(patterns) == 1 {
+		// Shift-Or needs a pattern byte to mark the end of a match.
+		if n := len(patterns[0]); n > 0 && n <= shiftOrMaxAuto {
+			return engineShortPattern
+		}
+		return engineBoyerMoore
+	}
+	limit := multiScanMaxFastPatterns
+	if !ignoreCase {
+		for _, p := range patterns {
+			if len(p) > 1 {
+				limit = multiScanMaxPatterns
+				break
+			}
+		}
+	}
+	if len(patterns) > limit {
+		return engineAhoCorasick
+	}
+	return engineMultiScan
+}
+
+// newFixedMatcher builds the matcher chosen by selectFixedEngine.
+func newFixedMatcher(patterns []string, ignoreCase bool, invert bool, opts MatcherOpts) Matcher {
+	if slices.Contains(patterns, "") {
+		// The SIMD scans and the automaton find no empty needle; the regex
+		// engine matches it on every line, as grep does. The empty
+		// alternative goes last so that, leftmost-first, the other patterns
+		// still win where they match. Quoted literals always compile.
+		var quoted []string
+		for _, p := range patterns {
+			if p != "" {
+				quoted = append(quoted, regexp.QuoteMeta(p))
+			}
+		}
+		m, _ := NewRegexMatcher(alternation(append(quoted, "")), ignoreCase, invert)
+		m.maxCols = opts.MaxCols
+		m.needLineNums = opts.NeedLineNums
+		return m
+	}
+	switch selectFixedEngine(patterns, ignoreCase) {
+	case engineBoyerMoore:
+		m := NewBoyerMooreMatcher(patterns[0], ignoreCase, invert)
+		m.maxCols = opts.MaxCols
+		m.needLineNums = opts.NeedLineNums
+		return m
+	case engineShortPattern:
+		return newShortPatternMatcher(patterns[0], ignoreCase, invert, opts)
+	case engineMultiScan:
+		m := NewMultiScanMatcher(patterns, ignoreCase, invert)
+		m.maxCols = opts.MaxCols
+		m.needLineNums = opts.NeedLineNums
+		return m
+	default:
+		m := NewAhoCorasickMatcher(patterns, ignoreCase, invert)
+		m.maxCols = opts.MaxCols
+		m.needLineNums = opts.NeedLineNums
+		return m
+	}
 }
@@ -0,0 +1,86 @@
+package matcher
+
+import "bytes"
+
+// firstLocator is implemented by matchers that can find the first matching
+// line without scanning the rest of the buffer.
+type firstLocator interface {
+	// firstLine returns the [start, end) bounds of the first selected line
+	// (honoring invert), or ok=false if no line is selected.
+	firstLine(data []byte) (start, end int, ok bool)
+}
+
+// FindFirst returns a MatchSet holding only the first matching line in data,
+// with full highlight positions for that line. Matchers that implement
+// firstLocator stop scanning at the first hit, like MatchExists; others fall
+// back to FindAll and keep the first match (and, for ContextMatcher, its
+// context group).
+func FindFirst(m Matcher, data []byte) MatchSet {
+	loc, ok := m.(firstLocator)
+	if !ok {
+		return firstOf(m.FindAll(data))
+	}
+
+	start, end, found := loc.firstLine(data)
+	if !found {
+		return MatchSet{}
+	}
+
+	lineNum := 1 + bytes.Count(data[:start], []byte{'\n'})
+	ms, ok := m.FindLine(data[start:end], lineNum, int64(start))
+	if !ok {
+		return MatchSet{}
+	}
+
+	// Re-base the line-relative result onto data; positions stay line-relative.
+	ms.Data = data
+	ms.Matches[0].LineStart = start
+	return ms
+}
+
+// firstOf truncates ms after the first non-context match, keeping trailing
+// context up to the next group separator.
+func firstOf(ms MatchSet) MatchSet {
+	seen := false
+	for i := range ms.Matches {
+		m := &ms.Matches[i]
+		if seen && (m.LineStart < 0 || !m.IsContext) {
+			ms.Matches = ms.Matches[:i]
+			break
+		}
+		if !m.IsContext {
+			seen = true
+		}
+	}
+	return ms
+}
+
+// lineBounds returns the [start, end) bounds of the line containing off.
+func lineBounds(data []byte, off int) (int, int) {
+	start := 0
+	if i := bytes.LastIndexByte(data[:off], '\n'); i >= 0 {
+		start = i + 1
+	}
+	end := len(data)
+	if i := bytes.IndexByte(data[off:], '\n'); i >= 0 {
+		end = off + i
+	}
+	return start, end
+}
+
+// firstInvertLine returns the bounds of the first line for which
+// matchFunc returns true.
+func firstInvertLine(data []byte, matchFunc func(line []byte) bool) (int, int, bool) {
+	off := 0
+	for off < len(data) {
+		end := len(data)
+		if i := bytes.IndexByte(data[off:], '\n'); i >= 0 {
+			end = off + i
+		}
+		if matchFunc(data[off:end]) {
+			return off, end, true
+		}
+		off = end + 1
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,81 @@
+package matcher
+
+import (
+	"os"
+	"testing"
+)
+
+func TestFindFirst(t *testing.T) {
+	data := []byte("alpha\nfoo bar foo\nbeta\nfoo again\n")
+
+	re, _ := NewRegexMatcher("fo+", false, false)
+	rePre, _ := NewRegexMatcher("foo.*bar", false, false)
+	matchers := map[string]Matcher{
+		"regex":           re,
+		"regex-prefilter": rePre,
+		"boyermoore":      NewBoyerMooreMatcher("foo", false, false),
+		"ahocorasick":     NewAhoCorasickMatcher([]string{"foo", "zzz"}, false, false),
+		"multiscan":       NewMultiScanMatcher([]string{"foo", "zzz"}, false, false),
+		"fixed":           NewFixedMatcher("foo", false, false),
+	}
+	if os.Getenv("GOGREP_SKIP_PCRE") != "1" {
+		pm, _ := NewPCREMatcher("foo", false, false)
+		matchers["pcre"] = pm
+	}
+
+	for name, m := range matchers {
+		t.Run(name, func(t *testing.T) {
+			ms := FindFirst(m, data)
+			if len(ms.Matches) != 1 {
+				t.Fatalf("got %d matches, want 1", len(ms.Matches))
+			}
+			mt := ms.Matches[0]
+			if mt.LineNum != 2 {
+				t.Errorf("LineNum = %d, want 2", mt.LineNum)
+			}
+			if got := string(ms.LineBytes(0)); got != "foo bar foo" {
+				t.Errorf("line = %q, want %q", got, "foo bar foo")
+			}
+			if mt.ByteOffset != 6 {
+				t.Errorf("ByteOffset = %d, want 6", mt.ByteOffset)
+			}
+			if len(ms.MatchPositions(0)) == 0 {
+				t.Error("expected highlight positions on first line")
+			}
+		})
+	}
+}
+
+func TestFindFirst_Invert(t *testing.T) {
+	m := NewBoyerMooreMatcher("foo", false, true)
+	ms := FindFirst(m, []byte("foo\nfoo\nbar\nbaz\n"))
+	if len(ms.Matches) != 1 || ms.Matches[0].LineNum != 3 {
+		t.Fatalf("got %+v, want line 3", ms.Matches)
+	}
+	if got := string(ms.LineBytes(0)); got != "bar" {
+		t.Errorf("line = %q, want bar", got)
+	}
+}
+
+func TestFindFirst_NoMatch(t *testing.T) {
+	m := NewBoyerMooreMatcher("zzz", false, false)
+	if ms := FindFirst(m, []byte("foo\nbar\n")); ms.HasMatch() {
+		t.Errorf("got %d matches, want 0", len(ms.Matches))
+	}
+	if ms := FindFirst(m, nil); ms.HasMatch() {
+		t.Error("empty input should not match")
+	}
+}
+
+func TestFindFirst_Context(t *testing.T) {
+	inner, _ := NewRegexMatcher("x", false, false)
+	m := NewContextMatcher(inner, 1, 1)
+	ms := FindFirst(m, []byte("a\nx\nb\nc\nd\nx\ne\n"))
+	// First group only: a (ctx), x (match), b (ctx)
+	if len(ms.Matches) != 3 {
+		t.Fatalf("got %d matches, want 3", len(ms.Matches))
+	}
+	if ms.Matches[1].IsContext || ms.Matches[1].LineNum != 2 {
+		t.Errorf("match[1] = %+v, want match on line 2", ms.Matches[1])
+	}
+}
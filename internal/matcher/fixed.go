@@ -29,7 +29,10 @@ func NewFixedMatcher(pattern string, ignoreCase bool, invert bool) *FixedMatcher
 
 func (m *FixedMatcher) MatchExists(data []byte) bool {
 	if m.invert {
-		return len(data) > 0
+		return existsInvert(data, func(line []byte) bool {
+			_, ok := m.findInLine(line, 0, 0)
+			return ok
+		})
 	}
 	if m.ignoreCase {
 		return bytes.Contains(bytes.ToLower(data), m.patternLow)
@@ -109,27 +112,7 @@ func (m *FixedMatcher) FindLine(line []byte, lineNum int, byteOffset int64) (Mat
 }
 
 func (m *FixedMatcher) findInLine(line []byte, lineNum int, byteOffset int64) (MatchSet, bool) {
-	searchLine := line
-	pattern := m.pattern
-	if m.ignoreCase {
-		searchLine = bytes.ToLower(line)
-		pattern = m.patternLow
-	}
-
-	var positions [][2]int
-	start := 0
-	for start <= len(searchLine) {
-		idx := bytes.Index(searchLine[start:], pattern)
-		if idx < 0 {
-			break
-		}
-		pos := start + idx
-		positions = append(positions, [2]int{pos, pos + len(pattern)})
-		start = pos + len(pattern)
-		if len(pattern) == 0 {
-			start++ // avoid infinite loop on empty pattern
-		}
-	}
+	positions := m.scanPositions(line)
 
 	hasMatch := len(positions) > 0
 	if m.invert {
@@ -156,3 +139,29 @@ func (m *FixedMatcher) findInLine(line []byte, lineNum int, byteOffset int64) (M
 
 	return ms, true
 }
+
+func (m *FixedMatcher) scanPositions(line []byte) [][2]int {
+	searchLine := line
+	pattern := m.pattern
+	if m.ignoreCase {
+		searchLine = bytes.ToLower(line)
+		pattern = m.patternLow
+	}
+
+	var positions [][2]int
+	start := 0
+	for start <= len(searchLine) {
+		idx := bytes.Index(searchLine[start:], pattern)
+		if idx < 0 {
+			break
+		}
+		pos := start + idx
+		positions = append(positions, [2]int{pos, pos + len(pattern)})
+		start = pos + len(pattern)
+		if len(pattern) == 0 {
+			start++ // avoid infinite loop on empty pattern
+		}
+	}
+
+	return positions
+}
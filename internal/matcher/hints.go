@@ -0,0 +1,100 @@
+package matcher
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+)
+
+// regexMeta is the set of bytes that make a pattern more than a plain string.
+const regexMeta = `\.+*?()|[]{}^$`
+
+// isLiteral returns true if the pattern contains no regex metacharacters
+// and can be treated as a fixed string.
+func isLiteral(pattern string) bool {
+	return !strings.ContainsAny(pattern, regexMeta)
+}
+
+// patternLiteral returns the fixed string a regex matches when the pattern
+// is nothing but a literal, including escaped metacharacters such as
+// `1\.2\.3`. Literals containing a newline are rejected: a fixed-string
+// search would otherwise match across lines.
+func patternLiteral(pattern string) (string, bool) {
+	if isLiteral(pattern) {
+		return pattern, true
+	}
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return "", false
+	}
+	re = re.Simplify()
+	if re.Op != syntax.OpLiteral || re.Flags&syntax.FoldCase != 0 {
+		return "", false
+	}
+	lit := string(re.Rune)
+	if strings.ContainsRune(lit, '\n') {
+		return "", false
+	}
+	return lit, true
+}
+
+// PatternHints returns advice about patterns whose syntax suggests a faster
+// engine or a different mode than the one selected. The arguments mirror
+// NewMatcher. Hints never change matching; callers print them on request.
+func PatternHints(patterns []string, fixed bool, usePCRE bool, dialect Dialect) []string {
+	switch dialect {
+	case DialectFixed:
+		fixed, usePCRE = true, false
+	case DialectPerl:
+		fixed, usePCRE = false, true
+	case DialectBasic, DialectExtended:
+		fixed, usePCRE = false, false
+	}
+
+	var hints []string
+	for _, p := range patterns {
+		if dialect == DialectBasic {
+			t, err := translateBRE(p)
+			if err != nil {
+				continue
+			}
+			p = t
+		}
+
+		switch {
+		case fixed:
+			if !isLiteral(p) {
+				hints = append(hints, fmt.Sprintf("-F matches %q literally, metacharacters included; drop -F if a regular expression was meant", p))
+			}
+		case usePCRE:
+			if _, err := regexp.Compile(p); err == nil {
+				hints = append(hints, fmt.Sprintf("%q uses no PCRE-only syntax; without -P the faster RE2 engine is used", p))
+			}
+		default:
+			if lit, ok := patternLiteral(p); ok && !isLiteral(p) {
+				hints = append(hints, fmt.Sprintf("%q is the plain string %q; -F %q says so without escaping", p, lit, lit))
+			}
+			if redundantDotStar(p) {
+				hints = append(hints, fmt.Sprintf("leading or trailing .* in %q is redundant when matching lines and disables the literal prefilter", p))
+			}
+		}
+	}
+	return hints
+}
+
+// redundantDotStar reports whether p starts or ends with an unescaped .*.
+func redundantDotStar(p string) bool {
+	if strings.HasPrefix(p, ".*") {
+		return true
+	}
+	if !strings.HasSuffix(p, ".*") {
+		return false
+	}
+	// Count the backslashes before the final ".*": odd means "\.*".
+	n := 0
+	for i := len(p) - 3; i >= 0 && p[i] == '\\'; i-- {
+		n++
+	}
+	return n%2 == 0
+}
@@ -0,0 +1,76 @@
+package matcher
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPatternLiteral(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    string
+		ok      bool
+	}{
+		{"hello", "hello", true},
+		{`1\.2\.3`, "1.2.3", true},
+		{`\Qa+b\E`, "a+b", true},
+		{`a\nb`, "", false},
+		{"a.b", "", false},
+		{"(?i)abc", "", false},
+		{"^abc", "", false},
+		{"foo|bar", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := patternLiteral(tt.pattern)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("patternLiteral(%q) = %q, %v; want %q, %v", tt.pattern, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestNewMatcher_EscapedLiteralPromoted(t *testing.T) {
+	m, err := NewMatcher([]string{`v1\.2`}, false, false, false, false, MatcherOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.(*RegexMatcher); ok {
+		t.Fatalf("escaped literal not promoted to a fixed-string matcher: %T", m)
+	}
+	ms := m.FindAll([]byte("v1.2\nv1x2\n"))
+	if len(ms.Matches) != 1 {
+		t.Errorf("got %d matches, want 1", len(ms.Matches))
+	}
+}
+
+func TestPatternHints(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		fixed    bool
+		pcre     bool
+		dialect  Dialect
+		want     []string // substrings, one per expected hint
+	}{
+		{"fixed with meta", []string{"a.b"}, true, false, DialectDefault, []string{"drop -F"}},
+		{"fixed plain", []string{"abc"}, true, false, DialectDefault, nil},
+		{"escaped literal", []string{`1\.2`}, false, false, DialectDefault, []string{`-F "1.2"`}},
+		{"real regex", []string{`\d+`}, false, false, DialectDefault, nil},
+		{"pcre needless", []string{`\d+`}, false, true, DialectDefault, []string{"RE2"}},
+		{"pcre needed", []string{`(?<=a)b`}, false, true, DialectDefault, nil},
+		{"dotstar", []string{".*error.*"}, false, false, DialectDefault, []string{"redundant"}},
+		{"escaped dotstar", []string{`a\.*`}, false, false, DialectDefault, nil},
+		{"dialect fixed", []string{"a+"}, false, false, DialectFixed, []string{"drop -F"}},
+	}
+	for _, tt := range tests {
+		got := PatternHints(tt.patterns, tt.fixed, tt.pcre, tt.dialect)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got hints %q, want %d", tt.name, got, len(tt.want))
+			continue
+		}
+		for i, sub := range tt.want {
+			if !strings.Contains(got[i], sub) {
+				t.Errorf("%s: hint %q does not mention %q", tt.name, got[i], sub)
+			}
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package matcher
+
+// IgnoreLineMatcher drops lines selected by inner that also match a
+// secondary ignore matcher, e.g. lines with "password" but not "example".
+// Both matchers scan the whole buffer with their own prefilters; the
+// results are then merged by offset, so files without an ignore hit cost
+// one extra scan and nothing else.
+type IgnoreLineMatcher struct {
+	inner  Matcher
+	ignore Matcher // built with MaxCols 0 so its records span whole lines
+}
+
+// NewIgnoreLineMatcher wraps inner to drop lines matched by ignore.
+// If ignore is nil, returns the inner matcher directly. ignore must not be
+// inverted and must report full lines (MaxCols 0).
+func NewIgnoreLineMatcher(inner Matcher, ignore Matcher) Matcher {
+	if ignore == nil {
+		return inner
+	}
+	return &IgnoreLineMatcher{inner: inner, ignore: ignore}
+}
+
+func (m *IgnoreLineMatcher) MatchExists(data []byte) bool {
+	if !m.ignore.MatchExists(data) {
+		return m.inner.MatchExists(data)
+	}
+	ms := m.FindAll(data)
+	return ms.HasMatch()
+}
+
+func (m *IgnoreLineMatcher) CountAll(data []byte) int {
+	if !m.ignore.MatchExists(data) {
+		return m.inner.CountAll(data)
+	}
+	ms := m.FindAll(data)
+	return ms.Len()
+}
+
+func (m *IgnoreLineMatcher) FindAll(data []byte) MatchSet {
+	ms := m.inner.FindAll(data)
+	if !ms.HasMatch() {
+		return ms
+	}
+	ign := m.ignore.FindAll(data)
+	if !ign.HasMatch() {
+		return ms
+	}
+
+	// Both sets are in buffer order. A match is dropped when its snippet
+	// start falls inside an ignored line. Positions stay in place; the kept
+	// matches still index them correctly.
+	kept := ms.Matches[:0]
+	j := 0
+	for _, mt := range ms.Matches {
+		for j < len(ign.Matches) && ign.Matches[j].LineStart+ign.Matches[j].LineLen < mt.LineStart {
+			j++
+		}
+		if j < len(ign.Matches) && ign.Matches[j].LineStart <= mt.LineStart {
+			continue
+		}
+		kept = append(kept, mt)
+	}
+	ms.Matches = kept
+	return ms
+}
+
+func (m *IgnoreLineMatcher) FindLine(line []byte, lineNum int, byteOffset int64) (MatchSet, bool) {
+	ms, ok := m.inner.FindLine(line, lineNum, byteOffset)
+	if !ok || m.ignore.MatchExists(line) {
+		return MatchSet{}, false
+	}
+	return ms, true
+}
+
+func (m *IgnoreLineMatcher) firstLine(data []byte) (int, int, bool) {
+	loc, ok := m.inner.(firstLocator)
+	if !ok {
+		ms := m.FindAll(data)
+		if !ms.HasMatch() {
+			return 0, 0, false
+		}
+		s, e := lineBounds(data, ms.Matches[0].LineStart)
+		return s, e, true
+	}
+
+	// Walk the inner matcher's hits until one survives the ignore check.
+	off := 0
+	for off <= len(data) {
+		s, e, found := loc.firstLine(data[off:])
+		if !found {
+			return 0, 0, false
+		}
+		s, e = off+s, off+e
+		if !m.ignore.MatchExists(data[s:e]) {
+			return s, e, true
+		}
+		off = e + 1
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,73 @@
+package matcher
+
+import "testing"
+
+func TestIgnoreLineMatcher(t *testing.T) {
+	data := []byte("password=1\npassword=example\nnothing\nexample only\npassword=2\n")
+	ignore := NewBoyerMooreMatcher("example", false, false)
+
+	tests := []struct {
+		name      string
+		inner     Matcher
+		wantLines []int
+	}{
+		{"fixed", NewBoyerMooreMatcher("password", false, false), []int{1, 5}},
+		{"invert", NewBoyerMooreMatcher("password", false, true), []int{3}},
+		{"no ignore hits", NewBoyerMooreMatcher("nothing", false, false), []int{3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setNeedLineNums(tt.inner)
+			m := NewIgnoreLineMatcher(tt.inner, ignore)
+			ms := m.FindAll(data)
+			var got []int
+			for _, mt := range ms.Matches {
+				got = append(got, mt.LineNum)
+			}
+			if !equalInts(got, tt.wantLines) {
+				t.Errorf("lines = %v, want %v", got, tt.wantLines)
+			}
+			if c := m.CountAll(data); c != len(tt.wantLines) {
+				t.Errorf("CountAll = %d, want %d", c, len(tt.wantLines))
+			}
+			if !m.MatchExists(data) {
+				t.Error("MatchExists = false, want true")
+			}
+
+			first := FindFirst(m, data)
+			if len(first.Matches) != 1 || first.Matches[0].LineNum != tt.wantLines[0] {
+				t.Errorf("FindFirst = %+v, want line %d", first.Matches, tt.wantLines[0])
+			}
+		})
+	}
+}
+
+func TestIgnoreLineMatcher_AllIgnored(t *testing.T) {
+	inner := NewBoyerMooreMatcher("password", false, false)
+	m := NewIgnoreLineMatcher(inner, NewBoyerMooreMatcher("pass", false, false))
+	data := []byte("password=1\nother\n")
+	if m.MatchExists(data) {
+		t.Error("MatchExists = true, want false")
+	}
+	if ms := FindFirst(m, data); ms.HasMatch() {
+		t.Errorf("FindFirst = %+v, want none", ms.Matches)
+	}
+	if _, ok := m.FindLine([]byte("password=1"), 1, 0); ok {
+		t.Error("FindLine matched an ignored line")
+	}
+}
+
+func TestIgnoreLineMatcher_Nil(t *testing.T) {
+	inner := NewBoyerMooreMatcher("foo", false, false)
+	if m := NewIgnoreLineMatcher(inner, nil); m != Matcher(inner) {
+		t.Error("expected inner matcher for nil ignore")
+	}
+}
+
+// setNeedLineNums enables line numbers on a BoyerMooreMatcher.
+func setNeedLineNums(m Matcher) {
+	if bm, ok := m.(*BoyerMooreMatcher); ok {
+		bm.needLineNums = true
+	}
+}
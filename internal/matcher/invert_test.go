@@ -0,0 +1,166 @@
+package matcher
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// invertCase is one input for the cross-matcher -v consistency tests.
+type invertCase struct {
+	name    string
+	pattern string
+	input   string
+}
+
+var invertCases = []invertCase{
+	{"mixed", "hello", "hello\nworld\nhello again\nfoo\n"},
+	{"all lines match", "hello", "hello\nhello there\n"},
+	{"no line matches", "xyz", "hello\nworld\n"},
+	{"no trailing newline", "end", "start\nmiddle\nthe end"},
+	{"empty lines", "a", "a\n\n\nb\n"},
+	{"single char", "x", "x\ny\nxx\n"},
+	{"empty input", "hello", ""},
+}
+
+// invertMatchers builds every matcher engine for pattern with invert enabled.
+func invertMatchers(t *testing.T, pattern string) map[string]Matcher {
+	t.Helper()
+	re, err := NewRegexMatcher(pattern, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	re.needLineNums = true
+	bm := NewBoyerMooreMatcher(pattern, false, true)
+	bm.needLineNums = true
+	ac := NewAhoCorasickMatcher([]string{pattern, pattern + "\x00never"}, false, true)
+	ac.needLineNums = true
+	mscan := NewMultiScanMatcher([]string{pattern, pattern + "\x00never"}, false, true)
+	mscan.needLineNums = true
+	ms := map[string]Matcher{
+		"regex":       re,
+		"boyermoore":  bm,
+		"ahocorasick": ac,
+		"multiscan":   mscan,
+		"fixed":       NewFixedMatcher(pattern, false, true),
+		"context":     NewContextMatcher(re, 1, 1),
+	}
+	if os.Getenv("GOGREP_SKIP_PCRE") != "1" {
+		pm, err := NewPCREMatcher(pattern, false, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pm.needLineNums = true
+		ms["pcre"] = pm
+	}
+	return ms
+}
+
+// refInvert returns the 1-based numbers of lines not containing pattern,
+// following grep's line splitting (a trailing newline does not start a line).
+func refInvert(pattern, input string) []int {
+	var lines []int
+	if input == "" {
+		return nil
+	}
+	for i, line := range strings.Split(strings.TrimSuffix(input, "\n"), "\n") {
+		if !strings.Contains(line, pattern) {
+			lines = append(lines, i+1)
+		}
+	}
+	return lines
+}
+
+func TestInvert_CrossMatcher(t *testing.T) {
+	for _, tc := range invertCases {
+		want := refInvert(tc.pattern, tc.input)
+		for name, m := range invertMatchers(t, tc.pattern) {
+			t.Run(tc.name+"/"+name, func(t *testing.T) {
+				data := []byte(tc.input)
+
+				if got := m.CountAll(data); got != len(want) {
+					t.Errorf("CountAll = %d, want %d", got, len(want))
+				}
+				if got := m.MatchExists(data); got != (len(want) > 0) {
+					t.Errorf("MatchExists = %v, want %v", got, len(want) > 0)
+				}
+
+				ms := m.FindAll(data)
+				var got []int
+				for i, mt := range ms.Matches {
+					if mt.IsContext {
+						continue
+					}
+					got = append(got, mt.LineNum)
+					if n := len(ms.MatchPositions(i)); n != 0 {
+						t.Errorf("line %d: %d positions, want none for inverted line", mt.LineNum, n)
+					}
+				}
+				if !equalInts(got, want) {
+					t.Errorf("FindAll lines = %v, want %v", got, want)
+				}
+			})
+		}
+	}
+}
+
+// TestInvert_GNUGrep compares -v line selection and -c counts against the
+// system grep, when one is available.
+func TestInvert_GNUGrep(t *testing.T) {
+	grep, err := exec.LookPath("grep")
+	if err != nil {
+		t.Skip("grep not found in PATH")
+	}
+	dir := t.TempDir()
+
+	for _, tc := range invertCases {
+		path := filepath.Join(dir, strings.ReplaceAll(tc.name, " ", "_"))
+		if err := os.WriteFile(path, []byte(tc.input), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		out, _ := exec.Command(grep, "-v", "-n", "-F", "-e", tc.pattern, path).Output()
+		var want []int
+		for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+			if num, _, ok := strings.Cut(line, ":"); ok {
+				n, _ := strconv.Atoi(num)
+				want = append(want, n)
+			}
+		}
+		countOut, _ := exec.Command(grep, "-v", "-c", "-F", "-e", tc.pattern, path).Output()
+		wantCount, _ := strconv.Atoi(string(bytes.TrimSpace(countOut)))
+
+		for name, m := range invertMatchers(t, tc.pattern) {
+			data := []byte(tc.input)
+			if got := m.CountAll(data); got != wantCount {
+				t.Errorf("%s/%s: CountAll = %d, grep -vc = %d", tc.name, name, got, wantCount)
+			}
+			var got []int
+			ms := m.FindAll(data)
+			for _, mt := range ms.Matches {
+				if !mt.IsContext {
+					got = append(got, mt.LineNum)
+				}
+			}
+			if !equalInts(got, want) {
+				t.Errorf("%s/%s: lines = %v, grep -vn = %v", tc.name, name, got, want)
+			}
+		}
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,362 @@
+package matcher
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"regexp/syntax"
+	"slices"
+	"sync"
+	"unicode/utf8"
+)
+
+// maxDFAStates caps the states one lazy DFA cache holds. When a pattern set
+// needs more (a state blow-up), the cache is dropped and rebuilt as the
+// search goes on, so memory stays bounded at the cost of recomputing.
+const maxDFAStates = 2000
+
+// errDFAUnsupported is returned for patterns the lazy DFA cannot run: word
+// boundaries depend on the byte after the current one, which a DFA reading
+// one rune at a time has not seen yet.
+var errDFAUnsupported = errors.New("lazy DFA: \\b and \\B are not supported")
+
+// LazyDFAMatcher decides which lines match a regex (typically the
+// alternation of many -e patterns) with a DFA built lazily from the RE2
+// program: each state is the set of program positions the NFA could be in,
+// created the first time a transition reaches it and cached afterwards.
+// Go's RE2 simulates the NFA directly and pays for every branch at every
+// byte, which is slow for bundles of log-parsing regexes that share
+// prefixes; the DFA pays once per distinct state. Match positions need
+// submatch boundaries the DFA does not track, so they are extracted by
+// RE2, but only for lines the DFA accepted.
+type LazyDFAMatcher struct {
+	re           *regexp.Regexp // same pattern, for match positions
+	prog         *syntax.Prog
+	invert       bool
+	maxCols      int
+	needLineNums bool
+	caches       sync.Pool // *lazyDFA; the state cache is not safe for concurrent use
+}
+
+// NewLazyDFAMatcher creates a LazyDFAMatcher for the given pattern.
+func NewLazyDFAMatcher(pattern string, ignoreCase bool, invert bool) (*LazyDFAMatcher, error) {
+	if ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return nil, err
+	}
+	prog, err := syntax.Compile(parsed.Simplify())
+	if err != nil {
+		return nil, err
+	}
+	for _, inst := range prog.Inst {
+		if inst.Op == syntax.InstEmptyWidth &&
+			syntax.EmptyOp(inst.Arg)&(syntax.EmptyWordBoundary|syntax.EmptyNoWordBoundary) != 0 {
+			return nil, errDFAUnsupported
+		}
+	}
+
+	m := &LazyDFAMatcher{re: re, prog: prog, invert: invert}
+	m.caches.New = func() any { return newLazyDFA(prog) }
+	return m, nil
+}
+
+// selects returns a line predicate honoring invert, backed by d.
+func (m *LazyDFAMatcher) selects(d *lazyDFA) func(line []byte) bool {
+	if m.invert {
+		return func(line []byte) bool { return !d.matchLine(line) }
+	}
+	return d.matchLine
+}
+
+func (m *LazyDFAMatcher) MatchExists(data []byte) bool {
+	d := m.caches.Get().(*lazyDFA)
+	defer m.caches.Put(d)
+	return existsInvert(data, m.selects(d))
+}
+
+func (m *LazyDFAMatcher) firstLine(data []byte) (int, int, bool) {
+	d := m.caches.Get().(*lazyDFA)
+	defer m.caches.Put(d)
+	return firstInvertLine(data, m.selects(d))
+}
+
+func (m *LazyDFAMatcher) CountAll(data []byte) int {
+	d := m.caches.Get().(*lazyDFA)
+	defer m.caches.Put(d)
+	return countInvert(data, m.selects(d))
+}
+
+func (m *LazyDFAMatcher) FindAll(data []byte) MatchSet {
+	return m.findAllArena(data, nil)
+}
+
+func (m *LazyDFAMatcher) findAllArena(data []byte, a *Arena) MatchSet {
+	d := m.caches.Get().(*lazyDFA)
+	defer m.caches.Put(d)
+
+	if m.invert {
+		return invertMatchSet(data, func(line []byte) bool { return !d.matchLine(line) })
+	}
+
+	var allLocs [][2]int
+	off := 0
+	for off < len(data) {
+		end := len(data)
+		if i := bytes.IndexByte(data[off:], '\n'); i >= 0 {
+			end = off + i
+		}
+		line := data[off:end]
+		if d.matchLine(line) {
+			for _, loc := range m.re.FindAllIndex(line, -1) {
+				allLocs = append(allLocs, [2]int{off + loc[0], off + loc[1]})
+			}
+		}
+		off = end + 1
+	}
+
+	if len(allLocs) == 0 {
+		return MatchSet{}
+	}
+	return matchSetFromLocsIn(data, allLocs, m.maxCols, m.needLineNums, a)
+}
+
+func (m *LazyDFAMatcher) scanPositions(line []byte) [][2]int {
+	return toLocs2(m.re.FindAllIndex(line, -1))
+}
+
+func (m *LazyDFAMatcher) FindLine(line []byte, lineNum int, byteOffset int64) (MatchSet, bool) {
+	d := m.caches.Get().(*lazyDFA)
+	hasMatch := d.matchLine(line)
+	m.caches.Put(d)
+
+	if hasMatch == m.invert {
+		return MatchSet{}, false
+	}
+
+	ms := MatchSet{Data: line}
+	match := Match{
+		LineNum:    lineNum,
+		LineStart:  0,
+		LineLen:    len(line),
+		ByteOffset: byteOffset,
+	}
+	if !m.invert {
+		ms.Positions = m.scanPositions(line)
+		match.PosCount = len(ms.Positions)
+	}
+	ms.Matches = []Match{match}
+	return ms, true
+}
+
+// lazyDFA is one state cache over a program. The DFA searches unanchored:
+// the program start is re-added after every rune, so a state is reached
+// by any line containing a match that ends there.
+type lazyDFA struct {
+	prog   *syntax.Prog
+	states map[string]*dfaState
+	start  *dfaState
+
+	// Scratch for building states: a sparse set of program positions.
+	seen []uint32 // seen[pc] == gen means pc is already in buf
+	gen  uint32
+	buf  []uint32
+	key  []byte
+
+	emptyLine int8 // whether an empty line matches: 0 = unknown, 1 = yes, -1 = no
+}
+
+// dfaState is a set of program positions: instructions that consume a
+// rune, Match, and empty-width assertions that did not hold where the
+// state was built (they are retried at the end of the line).
+type dfaState struct {
+	pcs      []uint32
+	match    bool // contains Match: the line matches, whatever follows
+	endMatch int8 // whether the line matches if it ends here: 0 = unknown, 1 = yes, -1 = no
+	next     [utf8.RuneSelf]*dfaState
+	nextRune map[rune]*dfaState // transitions on non-ASCII runes
+}
+
+const (
+	emptyBegin = syntax.EmptyBeginLine | syntax.EmptyBeginText
+	emptyEnd   = syntax.EmptyEndLine | syntax.EmptyEndText
+)
+
+func newLazyDFA(prog *syntax.Prog) *lazyDFA {
+	return &lazyDFA{
+		prog:   prog,
+		states: make(map[string]*dfaState),
+		seen:   make([]uint32, len(prog.Inst)),
+	}
+}
+
+// matchLine reports whether the program matches anywhere in line.
+func (d *lazyDFA) matchLine(line []byte) bool {
+	if len(line) == 0 {
+		if d.emptyLine == 0 {
+			d.emptyLine = -1
+			if d.startState().match || d.matchesAtEnd(d.startState(), emptyBegin|emptyEnd) {
+				d.emptyLine = 1
+			}
+		}
+		return d.emptyLine > 0
+	}
+
+	s := d.startState()
+	if s.match {
+		return true
+	}
+	for i := 0; i < len(line); {
+		var next *dfaState
+		if b := line[i]; b < utf8.RuneSelf {
+			next = s.next[b]
+			if next == nil {
+				next = d.step(s, rune(b))
+				s.next[b] = next
+			}
+			i++
+		} else {
+			r, size := utf8.DecodeRune(line[i:])
+			next = s.nextRune[r]
+			if next == nil {
+				next = d.step(s, r)
+				if s.nextRune == nil {
+					s.nextRune = make(map[rune]*dfaState)
+				}
+				s.nextRune[r] = next
+			}
+			i += size
+		}
+		s = next
+		if s.match {
+			return true
+		}
+	}
+
+	if s.endMatch == 0 {
+		s.endMatch = -1
+		if d.matchesAtEnd(s, emptyEnd) {
+			s.endMatch = 1
+		}
+	}
+	return s.endMatch > 0
+}
+
+func (d *lazyDFA) startState() *dfaState {
+	if d.start == nil {
+		d.reset()
+		d.add(uint32(d.prog.Start), emptyBegin)
+		d.start = d.intern()
+	}
+	return d.start
+}
+
+// step returns the state after s consumes r.
+func (d *lazyDFA) step(s *dfaState, r rune) *dfaState {
+	d.reset()
+	for _, pc := range s.pcs {
+		inst := &d.prog.Inst[pc]
+		switch inst.Op {
+		case syntax.InstRune, syntax.InstRune1:
+			if inst.MatchRune(r) {
+				d.add(inst.Out, 0)
+			}
+		case syntax.InstRuneAny:
+			d.add(inst.Out, 0)
+		case syntax.InstRuneAnyNotNL:
+			if r != '\n' {
+				d.add(inst.Out, 0)
+			}
+		}
+	}
+	d.add(uint32(d.prog.Start), 0)
+	return d.intern()
+}
+
+// matchesAtEnd reports whether an assertion left pending in s holds under
+// flag and leads to Match.
+func (d *lazyDFA) matchesAtEnd(s *dfaState, flag syntax.EmptyOp) bool {
+	d.reset()
+	for _, pc := range s.pcs {
+		inst := &d.prog.Inst[pc]
+		if inst.Op == syntax.InstEmptyWidth && syntax.EmptyOp(inst.Arg)&^flag == 0 {
+			d.add(inst.Out, flag)
+		}
+	}
+	for _, pc := range d.buf {
+		if d.prog.Inst[pc].Op == syntax.InstMatch {
+			return true
+		}
+	}
+	return false
+}
+
+// reset starts building a new state in buf.
+func (d *lazyDFA) reset() {
+	d.buf = d.buf[:0]
+	d.gen++
+	if d.gen == 0 {
+		clear(d.seen)
+		d.gen = 1
+	}
+}
+
+// add adds pc to buf, following the instructions that consume nothing.
+// Assertions that do not hold under flag stay in buf unexpanded.
+func (d *lazyDFA) add(pc uint32, flag syntax.EmptyOp) {
+	if d.seen[pc] == d.gen {
+		return
+	}
+	d.seen[pc] = d.gen
+	inst := &d.prog.Inst[pc]
+	switch inst.Op {
+	case syntax.InstFail:
+	case syntax.InstAlt, syntax.InstAltMatch:
+		d.add(inst.Out, flag)
+		d.add(inst.Arg, flag)
+	case syntax.InstCapture, syntax.InstNop:
+		d.add(inst.Out, flag)
+	case syntax.InstEmptyWidth:
+		if syntax.EmptyOp(inst.Arg)&^flag == 0 {
+			d.add(inst.Out, flag)
+		} else {
+			d.buf = append(d.buf, pc)
+		}
+	default:
+		d.buf = append(d.buf, pc)
+	}
+}
+
+// intern returns the cached state for the set in buf, creating it if new.
+func (d *lazyDFA) intern() *dfaState {
+	slices.Sort(d.buf)
+	d.key = d.key[:0]
+	for _, pc := range d.buf {
+		d.key = append(d.key, byte(pc), byte(pc>>8), byte(pc>>16), byte(pc>>24))
+	}
+	if s, ok := d.states[string(d.key)]; ok {
+		return s
+	}
+	if len(d.states) >= maxDFAStates {
+		// States still referenced by the caller stay valid; they just
+		// are no longer shared with later lookups.
+		clear(d.states)
+		d.start = nil
+		d.emptyLine = 0
+	}
+	s := &dfaState{pcs: slices.Clone(d.buf)}
+	for _, pc := range s.pcs {
+		if d.prog.Inst[pc].Op == syntax.InstMatch {
+			s.match = true
+			break
+		}
+	}
+	d.states[string(d.key)] = s
+	return s
+}
@@ -0,0 +1,195 @@
+package matcher
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// refLines returns the 1-based numbers of the lines re matches (or, with
+// invert, does not match), evaluating each line on its own like grep.
+func refLines(re *regexp.Regexp, input string, invert bool) []int {
+	var lines []int
+	for i, line := range strings.Split(strings.TrimSuffix(input, "\n"), "\n") {
+		if re.MatchString(line) != invert {
+			lines = append(lines, i+1)
+		}
+	}
+	return lines
+}
+
+func TestLazyDFAMatcher_MatchesRE2(t *testing.T) {
+	input := "GET /index.html 200\n" +
+		"POST /api/v1/users 201\n" +
+		"\n" +
+		"ERROR: disk full\n" +
+		"error: Disk Full on /dev/sda1\n" +
+		"warn timeout after 30s\n" +
+		"naïve café ünïcode 123\n" +
+		"trailing space \n" +
+		"x\n" +
+		"ab\xffcd invalid utf-8\n"
+
+	patterns := []string{
+		`(?:GET|POST|PUT) /api/\w+`,
+		`(?:ERROR|WARN): .*full`,
+		`^$`,
+		`^x$`,
+		`\d{3}$`,
+		`caf[éè]`,
+		`^(?:error|warn) `,
+		` $`,
+		`a.c`,
+		`\xff`,
+		`(?:timeout after \d+s)|(?:disk (?:full|error))`,
+		`[^\x00-\x7f]+`,
+		`(?:x*)`,
+	}
+
+	for _, p := range patterns {
+		for _, ic := range []bool{false, true} {
+			for _, invert := range []bool{false, true} {
+				name := fmt.Sprintf("%s/i=%v/v=%v", p, ic, invert)
+				t.Run(name, func(t *testing.T) {
+					m, err := NewLazyDFAMatcher(p, ic, invert)
+					if err != nil {
+						t.Fatal(err)
+					}
+					m.needLineNums = true
+					refPat := p
+					if ic {
+						refPat = "(?i)" + p
+					}
+					want := refLines(regexp.MustCompile(refPat), input, invert)
+
+					ms := m.FindAll([]byte(input))
+					var got []int
+					for _, mt := range ms.Matches {
+						got = append(got, mt.LineNum)
+					}
+					if !equalInts(got, want) {
+						t.Errorf("FindAll lines = %v, want %v", got, want)
+					}
+					if c := m.CountAll([]byte(input)); c != len(want) {
+						t.Errorf("CountAll = %d, want %d", c, len(want))
+					}
+					if e := m.MatchExists([]byte(input)); e != (len(want) > 0) {
+						t.Errorf("MatchExists = %v, want %v", e, len(want) > 0)
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestLazyDFAMatcher_Positions(t *testing.T) {
+	m, err := NewLazyDFAMatcher(`(?:foo\d)|(?:ba[rz])`, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms := m.FindAll([]byte("none\nfoo1 and baz\n"))
+	if len(ms.Matches) != 1 {
+		t.Fatalf("got %d matches, want 1", len(ms.Matches))
+	}
+	got := ms.MatchPositions(0)
+	want := [][2]int{{0, 4}, {9, 12}}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("positions = %v, want %v", got, want)
+	}
+}
+
+func TestLazyDFAMatcher_StateLimit(t *testing.T) {
+	// (a|b)*a(a|b){12} needs thousands of states: the cache is dropped and
+	// rebuilt during the search, without changing the result.
+	m, err := NewLazyDFAMatcher(`(?:x)|(?:a[ab]{12}$)`, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	for i := range 5000 {
+		for j := range 20 {
+			if (i>>j)&1 == 1 {
+				b.WriteByte('a')
+			} else {
+				b.WriteByte('b')
+			}
+		}
+		b.WriteByte('\n')
+	}
+	input := b.String()
+	want := refLines(regexp.MustCompile(`(?:x)|(?:a[ab]{12}$)`), input, false)
+	if c := m.CountAll([]byte(input)); c != len(want) {
+		t.Errorf("CountAll = %d, want %d", c, len(want))
+	}
+}
+
+func TestNewMatcher_SelectsLazyDFA(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		wantDFA  bool
+	}{
+		{[]string{`err\w+`, `warn\d`}, true},
+		{[]string{`err\w+`}, false},                   // single regex stays on RE2
+		{[]string{`\berr`, `warn\d`}, false},          // word boundary
+		{[]string{`timeout \d+`, `timeout x`}, false}, // shared literal prefilter
+	}
+	for _, tt := range tests {
+		m, err := NewMatcher(tt.patterns, false, false, false, false, MatcherOpts{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := m.(*LazyDFAMatcher); ok != tt.wantDFA {
+			t.Errorf("%q: got %T, want lazy DFA %v", tt.patterns, m, tt.wantDFA)
+		}
+	}
+}
+
+// logBundle is a set of log-parsing regexes with shared prefixes, the
+// workload the lazy DFA targets.
+var logBundle = []string{
+	`(?:GET|POST) /api/v1/users/\d+`,
+	`(?:GET|POST) /api/v1/orders/\d+`,
+	`(?:GET|POST) /api/v1/items/[a-f0-9]+`,
+	`(?:GET|POST) /api/v2/\w+/\d+`,
+	`status=5\d\d`,
+	`status=4\d\d latency=\d+ms`,
+	`user=[a-z]+@example\.(?:com|org)`,
+	`session=[A-Z0-9]{8}`,
+}
+
+func logBundleData() []byte {
+	var b bytes.Buffer
+	for i := range 20000 {
+		fmt.Fprintf(&b, "2024-01-01T00:00:%02d host%d GET /static/asset%d.js status=200 latency=%dms\n", i%60, i%7, i, i%900)
+		if i%100 == 0 {
+			fmt.Fprintf(&b, "2024-01-01T00:00:00 host1 POST /api/v1/orders/%d status=503\n", i)
+		}
+	}
+	return b.Bytes()
+}
+
+func BenchmarkLogBundle_LazyDFA(b *testing.B) {
+	data := logBundleData()
+	m, err := NewLazyDFAMatcher(strings.Join(logBundle, "|"), false, false)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(len(data)))
+	for b.Loop() {
+		m.CountAll(data)
+	}
+}
+
+func BenchmarkLogBundle_RE2(b *testing.B) {
+	data := logBundleData()
+	m, err := NewRegexMatcher(strings.Join(logBundle, "|"), false, false)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(len(data)))
+	for b.Loop() {
+		m.CountAll(data)
+	}
+}
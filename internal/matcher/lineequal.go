@@ -0,0 +1,112 @@
+package matcher
+
+import (
+	"bytes"
+)
+
+// LineEqualMatcher selects the lines equal to one of a set of fixed
+// strings, for -x with fixed or literal patterns. Each line is compared
+// whole against the patterns of its length, so there is no search inside
+// lines and no regex anchoring; a line selects with its whole text
+// highlighted. Case folding, as in the other fixed-string matchers, is
+// ASCII only.
+type LineEqualMatcher struct {
+	byLen      map[int][][]byte // patterns by length, lowered with ignoreCase
+	ignoreCase bool
+	invert     bool
+}
+
+// NewLineEqualMatcher creates a LineEqualMatcher for patterns. The empty
+// pattern selects empty lines.
+func NewLineEqualMatcher(patterns []string, ignoreCase bool, invert bool) *LineEqualMatcher {
+	m := &LineEqualMatcher{
+		byLen:      make(map[int][][]byte),
+		ignoreCase: ignoreCase,
+		invert:     invert,
+	}
+	for _, p := range patterns {
+		b := []byte(p)
+		if ignoreCase {
+			b = bytes.ToLower(b)
+		}
+		m.byLen[len(b)] = append(m.byLen[len(b)], b)
+	}
+	return m
+}
+
+// selects reports whether line is selected: equal to a pattern or, with
+// invert, to none.
+func (m *LineEqualMatcher) selects(line []byte) bool {
+	for _, p := range m.byLen[len(line)] {
+		if m.ignoreCase && equalFoldASCII(line, p) || !m.ignoreCase && bytes.Equal(line, p) {
+			return !m.invert
+		}
+	}
+	return m.invert
+}
+
+// equalFoldASCII reports whether s equals lower, which is lower case,
+// under ASCII case folding.
+func equalFoldASCII(s, lower []byte) bool {
+	for i, b := range s {
+		if toLower(b) != lower[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// The line walks written for -v take any selector, and selects already
+// accounts for invert.
+
+func (m *LineEqualMatcher) MatchExists(data []byte) bool {
+	return existsInvert(data, m.selects)
+}
+
+func (m *LineEqualMatcher) CountAll(data []byte) int {
+	return countInvert(data, m.selects)
+}
+
+func (m *LineEqualMatcher) FindAll(data []byte) MatchSet {
+	ms := invertMatchSet(data, m.selects)
+	if !m.invert {
+		m.highlight(&ms)
+	}
+	return ms
+}
+
+// highlight gives each match one position spanning its line.
+func (m *LineEqualMatcher) highlight(ms *MatchSet) {
+	ms.Positions = make([][2]int, len(ms.Matches))
+	for i := range ms.Matches {
+		match := &ms.Matches[i]
+		match.PosIdx, match.PosCount = i, 1
+		ms.Positions[i] = [2]int{0, match.LineLen}
+	}
+}
+
+func (m *LineEqualMatcher) FindLine(line []byte, lineNum int, byteOffset int64) (MatchSet, bool) {
+	if !m.selects(line) {
+		return MatchSet{}, false
+	}
+	ms := MatchSet{Data: line, Matches: []Match{{
+		LineNum:    lineNum,
+		LineLen:    len(line),
+		ByteOffset: byteOffset,
+	}}}
+	if !m.invert {
+		m.highlight(&ms)
+	}
+	return ms, true
+}
+
+func (m *LineEqualMatcher) firstLine(data []byte) (int, int, bool) {
+	return firstInvertLine(data, m.selects)
+}
+
+func (m *LineEqualMatcher) scanPositions(line []byte) [][2]int {
+	if m.invert || !m.selects(line) {
+		return nil
+	}
+	return [][2]int{{0, len(line)}}
+}
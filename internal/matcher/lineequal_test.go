@@ -0,0 +1,92 @@
+package matcher
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestLineRegexp(t *testing.T) {
+	data := []byte("foo\nfoobar\nFOO\n\nbar\nbarfoo\nfoo")
+
+	tests := []struct {
+		name       string
+		patterns   []string
+		fixed      bool
+		pcre       bool
+		ignoreCase bool
+		invert     bool
+		dialect    Dialect
+		wantType   string
+		wantLines  []int
+	}{
+		{"fixed", []string{"foo"}, true, false, false, false, DialectDefault, "*matcher.LineEqualMatcher", []int{1, 7}},
+		{"literal", []string{"foo"}, false, false, false, false, DialectDefault, "*matcher.LineEqualMatcher", []int{1, 7}},
+		{"ignore case", []string{"foo"}, true, false, true, false, DialectDefault, "*matcher.LineEqualMatcher", []int{1, 3, 7}},
+		{"invert", []string{"foo"}, true, false, false, true, DialectDefault, "*matcher.LineEqualMatcher", []int{2, 3, 4, 5, 6}},
+		{"invert ignore case", []string{"foo"}, false, false, true, true, DialectDefault, "*matcher.LineEqualMatcher", []int{2, 4, 5, 6}},
+		{"several", []string{"bar", "foobar"}, true, false, false, false, DialectDefault, "*matcher.LineEqualMatcher", []int{2, 5}},
+		{"empty", []string{""}, true, false, false, false, DialectDefault, "*matcher.LineEqualMatcher", []int{4}},
+		{"regex", []string{"fo+|bar"}, false, false, false, false, DialectDefault, "*matcher.RegexMatcher", []int{1, 5, 7}},
+		{"regex invert", []string{"fo+|bar"}, false, false, false, true, DialectDefault, "*matcher.RegexMatcher", []int{2, 3, 4, 6}},
+		{"regexes", []string{"f.o", "b.r"}, false, false, false, false, DialectDefault, "*matcher.LazyDFAMatcher", []int{1, 5, 7}},
+		{"basic", []string{`foo\|bar`}, false, false, false, false, DialectBasic, "*matcher.RegexMatcher", []int{1, 5, 7}},
+		{"pcre", []string{"foo|bar"}, false, true, true, false, DialectDefault, "*matcher.PCREMatcher", []int{1, 3, 5, 7}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewMatcher(tt.patterns, tt.fixed, tt.pcre, tt.ignoreCase, tt.invert, MatcherOpts{
+				NeedLineNums: true,
+				Dialect:      tt.dialect,
+				LineRegexp:   true,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := fmt.Sprintf("%T", m); got != tt.wantType {
+				t.Errorf("type = %s, want %s", got, tt.wantType)
+			}
+			ms := m.FindAll(data)
+			var got []int
+			for i, mt := range ms.Matches {
+				got = append(got, mt.LineNum)
+				if !tt.invert {
+					pos := ms.MatchPositions(i)
+					if len(pos) != 1 || pos[0] != [2]int{0, mt.LineLen} {
+						t.Errorf("line %d positions = %v, want the whole line", mt.LineNum, pos)
+					}
+				}
+			}
+			if !equalInts(got, tt.wantLines) {
+				t.Errorf("lines = %v, want %v", got, tt.wantLines)
+			}
+			if c := m.CountAll(data); c != len(tt.wantLines) {
+				t.Errorf("CountAll = %d, want %d", c, len(tt.wantLines))
+			}
+			if !m.MatchExists(data) {
+				t.Error("MatchExists = false, want true")
+			}
+			first := FindFirst(m, data)
+			if len(first.Matches) != 1 || first.Matches[0].LineNum != tt.wantLines[0] {
+				t.Errorf("FindFirst = %+v, want line %d", first.Matches, tt.wantLines[0])
+			}
+		})
+	}
+}
+
+func TestLineEqualMatcher_FindLine(t *testing.T) {
+	m := NewLineEqualMatcher([]string{"Foo"}, true, false)
+	ms, ok := m.FindLine([]byte("fOO"), 3, 20)
+	if !ok {
+		t.Fatal("FindLine did not match")
+	}
+	if mt := ms.Matches[0]; mt.LineNum != 3 || mt.ByteOffset != 20 || mt.LineLen != 3 {
+		t.Errorf("match = %+v", mt)
+	}
+	if _, ok := m.FindLine([]byte("foo "), 1, 0); ok {
+		t.Error("FindLine matched a longer line")
+	}
+	if m.MatchExists([]byte("food\nfo\n")) {
+		t.Error("MatchExists = true, want false")
+	}
+}
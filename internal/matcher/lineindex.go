@@ -1,6 +1,9 @@
 package matcher
 
-import "bytes"
+import (
+	"bytes"
+	"slices"
+)
 
 // snippetFromOffset extracts a line snippet around a match at off in data.
 // Instead of resolving full line boundaries (which may be thousands of bytes
@@ -46,12 +49,18 @@ func snippetFromOffset(data []byte, off int, maxCols int) (snippetStart int, sni
 // Uses window-based snippet extraction (bounded by maxCols) and incremental
 // bytes.Count for line numbers. O(1) pointer overhead, O(n) total time.
 func matchSetFromOffsets(data []byte, offsets []int, patternLen int, maxCols int, needLineNums bool) MatchSet {
+	return matchSetFromOffsetsIn(data, offsets, patternLen, maxCols, needLineNums, nil)
+}
+
+// matchSetFromOffsetsIn is matchSetFromOffsets with the Matches and
+// Positions slices taken from a.
+func matchSetFromOffsetsIn(data []byte, offsets []int, patternLen int, maxCols int, needLineNums bool, a *Arena) MatchSet {
 	if len(offsets) == 0 {
 		return MatchSet{}
 	}
 
-	matches := make([]Match, 0, len(offsets))
-	positions := make([][2]int, 0, len(offsets))
+	matches := a.matchSlice(len(offsets))
+	positions := a.positionSlice(len(offsets))
 	lastSnippetStart := -1
 	lineNum := 1
 	prevOff := 0
@@ -91,11 +100,20 @@ func matchSetFromOffsets(data []byte, offsets []int, patternLen int, maxCols int
 // It reuses the locs slice in-place for positions (converting buffer-absolute offsets
 // to snippet-relative offsets), eliminating one allocation.
 func matchSetFromLocs(data []byte, locs [][2]int, maxCols int, needLineNums bool) MatchSet {
+	return matchSetFromLocsIn(data, locs, maxCols, needLineNums, nil)
+}
+
+// matchSetFromLocsIn is matchSetFromLocs with the Matches slice taken from
+// a; the positions stay in locs.
+func matchSetFromLocsIn(data []byte, locs [][2]int, maxCols int, needLineNums bool, a *Arena) MatchSet {
+	if n := len(locs); n > 0 && pastLastLine(data, locs[n-1][0]) {
+		locs = locs[:n-1]
+	}
 	if len(locs) == 0 {
 		return MatchSet{}
 	}
 
-	matches := make([]Match, 0, len(locs))
+	matches := a.matchSlice(len(locs))
 	lastSnippetStart := -1
 	lineNum := 1
 	prevOff := 0
@@ -183,6 +201,68 @@ func countInvert(data []byte, matchFunc func(line []byte) bool) int {
 	return count
 }
 
+// existsInvert reports whether matchFunc returns true for any line in data,
+// stopping at the first such line. It is the MatchExists counterpart of
+// countInvert: for -v, a file matches only if some line lacks the pattern,
+// so a file where every line matches must report false.
+func existsInvert(data []byte, matchFunc func(line []byte) bool) bool {
+	for len(data) > 0 {
+		idx := bytes.IndexByte(data, '\n')
+		var line []byte
+		if idx >= 0 {
+			line = data[:idx]
+			data = data[idx+1:]
+		} else {
+			line = data
+			data = nil
+		}
+		if matchFunc(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// invertMatchSet returns a MatchSet of the full lines for which selected
+// returns true, without highlight positions, as -v output needs.
+func invertMatchSet(data []byte, selected func(line []byte) bool) MatchSet {
+	ms := MatchSet{Data: data}
+	var offset int64
+	lineNum := 1
+	remaining := data
+
+	for len(remaining) > 0 {
+		idx := bytes.IndexByte(remaining, '\n')
+		var lineLen int
+		if idx >= 0 {
+			lineLen = idx
+		} else {
+			lineLen = len(remaining)
+		}
+		lineStart := int(offset)
+		line := remaining[:lineLen]
+
+		if selected(line) {
+			ms.Matches = append(ms.Matches, Match{
+				LineNum:    lineNum,
+				LineStart:  lineStart,
+				LineLen:    lineLen,
+				ByteOffset: offset,
+			})
+		}
+
+		if idx >= 0 {
+			remaining = remaining[idx+1:]
+		} else {
+			remaining = nil
+		}
+		offset += int64(lineLen) + 1
+		lineNum++
+	}
+
+	return ms
+}
+
 // toLocs2 converts [][]int (as returned by regexp.FindAllIndex / pcre.FindAllIndex)
 // to [][2]int value type, eliminating per-element heap allocations.
 func toLocs2(locs [][]int) [][2]int {
@@ -196,6 +276,37 @@ func toLocs2(locs [][]int) [][2]int {
 	return result
 }
 
+// pastLastLine reports whether off is the end of data and no line is
+// there: data is empty or ends in a newline. Patterns that match the empty
+// string find a match at such an offset, but as grep splits input into
+// lines, an empty file has none and the end of a file that ends in a
+// newline does not start another.
+func pastLastLine(data []byte, off int) bool {
+	return off == len(data) && (off == 0 || data[off-1] == '\n')
+}
+
+// leftmostLocs sorts locs by start, longer first on ties, and drops every
+// location that overlaps an earlier one, leaving the leftmost-longest
+// non-overlapping matches grep reports. Engines that find each pattern
+// separately (several fixed strings, or literals beside a regex) can
+// otherwise report "fo" and "oo" both inside "foo".
+func leftmostLocs(locs [][2]int) [][2]int {
+	slices.SortFunc(locs, func(a, b [2]int) int {
+		if a[0] != b[0] {
+			return a[0] - b[0]
+		}
+		return b[1] - a[1]
+	})
+	kept := locs[:0]
+	for _, loc := range locs {
+		if n := len(kept); n > 0 && loc[0] < kept[n-1][1] {
+			continue
+		}
+		kept = append(kept, loc)
+	}
+	return kept
+}
+
 // countLocsUniqueLines counts how many distinct lines contain at least one loc.
 func countLocsUniqueLines(data []byte, locs [][2]int) int {
 	if len(locs) == 0 {
@@ -207,6 +318,9 @@ func countLocsUniqueLines(data []byte, locs [][2]int) int {
 
 	for _, loc := range locs {
 		off := loc[0]
+		if pastLastLine(data, off) {
+			break
+		}
 		if off > lineEnd {
 			count++
 			i := bytes.IndexByte(data[off:], '\n')
@@ -179,3 +179,50 @@ func isASCIIRunes(runes []rune) bool {
 	}
 	return true
 }
+
+// RequiredLiterals returns, for each pattern, a literal that every match of
+// that pattern contains. A buffer containing none of them cannot match, so
+// callers may use the set to skip files from an index. The arguments mirror
+// NewMatcher. ok is false if any pattern lacks a usable literal, or for PCRE,
+// whose syntax RE2's parser cannot be trusted to read. Literals from
+// case-insensitive patterns are lowercased.
+func RequiredLiterals(patterns []string, fixed bool, usePCRE bool, ignoreCase bool, dialect Dialect) ([]string, bool) {
+	switch dialect {
+	case DialectFixed:
+		fixed, usePCRE = true, false
+	case DialectPerl:
+		fixed, usePCRE = false, true
+	case DialectBasic, DialectExtended:
+		fixed, usePCRE = false, false
+	}
+	if usePCRE || len(patterns) == 0 {
+		return nil, false
+	}
+
+	lits := make([]string, 0, len(patterns))
+	for _, p := range patterns {
+		if fixed {
+			if len(p) < minPrefilterLen {
+				return nil, false
+			}
+			if ignoreCase {
+				p = strings.ToLower(p)
+			}
+			lits = append(lits, p)
+			continue
+		}
+		if dialect == DialectBasic {
+			t, err := translateBRE(p)
+			if err != nil {
+				return nil, false
+			}
+			p = t
+		}
+		info, ok := extractLiteral(p, ignoreCase)
+		if !ok {
+			return nil, false
+		}
+		lits = append(lits, info.literal)
+	}
+	return lits, true
+}
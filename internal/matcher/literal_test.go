@@ -270,3 +270,42 @@ func BenchmarkRegex_NoPrefilter_Sparse(b *testing.B) {
 		m.FindAll(buf)
 	}
 }
+
+func TestRequiredLiterals(t *testing.T) {
+	tests := []struct {
+		name       string
+		patterns   []string
+		fixed      bool
+		pcre       bool
+		ignoreCase bool
+		dialect    Dialect
+		want       []string
+		wantOK     bool
+	}{
+		{"regex", []string{`error\d+`, "timeout"}, false, false, false, DialectDefault, []string{"error", "timeout"}, true},
+		{"fixed", []string{"Foo.Bar"}, true, false, false, DialectDefault, []string{"Foo.Bar"}, true},
+		{"fixed ignore case", []string{"Foo"}, true, false, true, DialectDefault, []string{"foo"}, true},
+		{"fixed too short", []string{"ab"}, true, false, false, DialectDefault, nil, false},
+		{"one pattern without literal", []string{"timeout", `\d+`}, false, false, false, DialectDefault, nil, false},
+		{"basic", []string{`err\(or\)*`}, false, false, false, DialectBasic, []string{"err"}, true},
+		{"pcre", []string{"timeout"}, false, true, false, DialectDefault, nil, false},
+		{"perl dialect", []string{"timeout"}, false, false, false, DialectPerl, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := RequiredLiterals(tt.patterns, tt.fixed, tt.pcre, tt.ignoreCase, tt.dialect)
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("literals = %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("literals = %q, want %q", got, tt.want)
+				}
+			}
+		})
+	}
+}
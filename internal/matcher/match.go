@@ -16,6 +16,11 @@ type Match struct {
 // MatchSet holds matches and the shared backing data they reference.
 // Only MatchSet contains pointer types — individual Match structs are pointer-free,
 // so the GC scans O(1) pointers regardless of match count.
+//
+// Data is usually the file buffer itself: a pooled read buffer or an mmap
+// that the reader releases when the owning output.Result's Closer runs.
+// LineBytes and any slice of Data are valid only until then. A consumer
+// that keeps matches longer must call Detach first.
 type MatchSet struct {
 	Data      []byte   // the file data buffer (matches reference offsets into this)
 	Matches   []Match  // pointer-free match structs
@@ -47,7 +52,21 @@ func (ms *MatchSet) HasMatch() bool {
 	return len(ms.Matches) > 0
 }
 
+// positionScanner is implemented by matchers that can report the raw pattern
+// positions within a single line, ignoring invert. ContextMatcher uses it to
+// highlight occurrences in context lines.
+type positionScanner interface {
+	scanPositions(line []byte) [][2]int
+}
+
 // Matcher finds pattern matches in data.
+//
+// A Matcher is shared by all scheduler workers, so its methods must be safe
+// for concurrent use and should not serialize on a lock held while
+// matching. State that is not safe to share lives in per-goroutine copies
+// drawn from a pool (the lazy DFA's state cache, PCREMatcher's compiled
+// patterns); wrappers keep per-call state on the stack and aggregate with
+// atomics (PatternStats).
 type Matcher interface {
 	// FindAll scans data (full file content) and returns all matches.
 	FindAll(data []byte) MatchSet
@@ -62,3 +81,50 @@ type Matcher interface {
 	// lineNum is 1-based, byteOffset is the offset of the line start in the file.
 	FindLine(line []byte, lineNum int, byteOffset int64) (MatchSet, bool)
 }
+
+// Detach returns a copy of ms that owns its memory: Data holds only the
+// snippets the matches reference, and Matches and Positions are fresh
+// slices. The copy stays valid after the source buffer is released.
+// Each snippet keeps the byte on either side of it, or a '\n' at the edges
+// of the source, so formatters can still tell whether it was cut mid-line.
+func (ms MatchSet) Detach() MatchSet {
+	if len(ms.Matches) == 0 {
+		return MatchSet{}
+	}
+
+	n := 0
+	for i := range ms.Matches {
+		if ms.Matches[i].LineStart >= 0 {
+			n += ms.Matches[i].LineLen + 2
+		}
+	}
+	out := MatchSet{
+		Data:      make([]byte, 0, n),
+		Matches:   make([]Match, len(ms.Matches)),
+		Positions: make([][2]int, len(ms.Positions)),
+	}
+	copy(out.Matches, ms.Matches)
+	copy(out.Positions, ms.Positions)
+
+	for i := range out.Matches {
+		m := &out.Matches[i]
+		if m.LineStart < 0 {
+			continue // group separator
+		}
+		end := m.LineStart + m.LineLen
+		if m.LineStart > 0 {
+			out.Data = append(out.Data, ms.Data[m.LineStart-1])
+		} else {
+			out.Data = append(out.Data, '\n')
+		}
+		start := len(out.Data)
+		out.Data = append(out.Data, ms.Data[m.LineStart:end]...)
+		if end < len(ms.Data) {
+			out.Data = append(out.Data, ms.Data[end])
+		} else {
+			out.Data = append(out.Data, '\n')
+		}
+		m.LineStart = start
+	}
+	return out
+}
@@ -215,3 +215,93 @@ func TestNewMatcher_NoPatterns(t *testing.T) {
 		t.Error("expected error for no patterns")
 	}
 }
+
+func TestMatchSet_Detach(t *testing.T) {
+	data := []byte("alpha beta\ngamma delta beta\n")
+	ms := MatchSet{
+		Data: data,
+		Matches: []Match{
+			{LineNum: 1, LineStart: 0, LineLen: 10, PosIdx: 0, PosCount: 1},
+			{LineNum: 0, LineStart: -1},
+			{LineNum: 2, LineStart: 17, LineLen: 10, PosIdx: 1, PosCount: 1}, // "delta beta", cut mid-line
+		},
+		Positions: [][2]int{{6, 10}, {6, 10}},
+	}
+	want := []string{string(ms.LineBytes(0)), "", string(ms.LineBytes(2))}
+
+	d := ms.Detach()
+	for i := range data {
+		data[i] = 0xDD
+	}
+
+	for i, w := range want {
+		if d.Matches[i].LineStart < 0 {
+			continue
+		}
+		if got := string(d.LineBytes(i)); got != w {
+			t.Errorf("line %d = %q, want %q", i, got, w)
+		}
+		if got := d.MatchPositions(i); len(got) != 1 || got[0] != [2]int{6, 10} {
+			t.Errorf("positions %d = %v", i, got)
+		}
+	}
+	if d.Matches[1].LineStart >= 0 {
+		t.Error("separator lost its sentinel")
+	}
+
+	// Neighbour bytes survive so clip detection still works.
+	first, last := d.Matches[0], d.Matches[2]
+	if d.Data[first.LineStart-1] != '\n' || d.Data[first.LineStart+first.LineLen] != '\n' {
+		t.Error("first snippet should look like a whole line")
+	}
+	if d.Data[last.LineStart-1] != ' ' {
+		t.Errorf("byte before cut snippet = %q, want ' '", d.Data[last.LineStart-1])
+	}
+
+	if e := (MatchSet{}).Detach(); e.HasMatch() {
+		t.Error("Detach of empty set has matches")
+	}
+}
+
+func TestWholeFileMatcher(t *testing.T) {
+	data := []byte("func main() {\n\tdefer cleanup()\n\tpanic(err)\n}\n")
+	tests := []struct {
+		name     string
+		patterns []string
+		fixed    bool
+		invert   bool
+		dialect  Dialect
+		want     bool
+	}{
+		{"spans lines", []string{`(?s)defer.*panic`}, false, false, DialectDefault, true},
+		{"dot stops at newline", []string{`defer.*panic`}, false, false, DialectDefault, false},
+		{"order matters", []string{`(?s)panic.*defer`}, false, false, DialectDefault, false},
+		{"any pattern", []string{`nothing`, `(?s)main.*\}\n\z`}, false, false, DialectDefault, true},
+		{"fixed with newline", []string{"cleanup()\n\tpanic"}, true, false, DialectDefault, true},
+		{"basic", []string{`cleanup()`}, false, false, DialectBasic, true},
+		{"invert", []string{`(?s)defer.*panic`}, false, true, DialectDefault, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewWholeFileMatcher(tt.patterns, tt.fixed, false, tt.invert, tt.dialect)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := m.MatchExists(data); got != tt.want {
+				t.Errorf("MatchExists = %v, want %v", got, tt.want)
+			}
+			if ms := m.FindAll(data); ms.HasMatch() != tt.want {
+				t.Errorf("FindAll has match = %v, want %v", ms.HasMatch(), tt.want)
+			}
+		})
+	}
+
+	m, _ := NewWholeFileMatcher([]string{`(?s)defer.*panic`}, false, false, false, DialectDefault)
+	ms := m.FindAll(data)
+	if ms.Matches[0].LineNum != 2 || string(ms.LineBytes(0)) != "\tdefer cleanup()" {
+		t.Errorf("match reported on line %d %q, want line 2", ms.Matches[0].LineNum, ms.LineBytes(0))
+	}
+	if _, err := NewWholeFileMatcher([]string{"x"}, false, false, false, DialectPerl); err == nil {
+		t.Error("PCRE accepted")
+	}
+}
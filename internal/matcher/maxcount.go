@@ -0,0 +1,113 @@
+package matcher
+
+// MaxCountMatcher selects at most max lines of each buffer, as grep -m does
+// without context lines. With context lines the limit is set on the
+// ContextMatcher instead (SetMaxCount), which prints the last selected
+// line's trailing context, matching lines included, as context.
+type MaxCountMatcher struct {
+	inner Matcher
+	max   int
+}
+
+// NewMaxCountMatcher wraps inner to select at most max lines per buffer.
+// If max is 0 or less, returns the inner matcher directly.
+func NewMaxCountMatcher(inner Matcher, max int) Matcher {
+	if max <= 0 {
+		return inner
+	}
+	return &MaxCountMatcher{inner: inner, max: max}
+}
+
+func (m *MaxCountMatcher) MatchExists(data []byte) bool {
+	return m.inner.MatchExists(data)
+}
+
+func (m *MaxCountMatcher) CountAll(data []byte) int {
+	return countAtMost(m.inner, data, m.max)
+}
+
+func (m *MaxCountMatcher) FindAll(data []byte) MatchSet {
+	ms, _ := limitLines(findAtMost(m.inner, data, 0, m.max), m.max)
+	return ms
+}
+
+func (m *MaxCountMatcher) FindLine(line []byte, lineNum int, byteOffset int64) (MatchSet, bool) {
+	return m.inner.FindLine(line, lineNum, byteOffset)
+}
+
+// cutAfter returns data up to and including the n-th line at or after from
+// that m selects, so that a search stops there, or all of data if there are
+// fewer such lines or m cannot locate them without a full search.
+func cutAfter(m Matcher, data []byte, from, n int) []byte {
+	loc, ok := m.(firstLocator)
+	if !ok {
+		return data
+	}
+	off := from
+	for range n {
+		if off >= len(data) {
+			return data
+		}
+		_, end, found := loc.firstLine(data[off:])
+		if !found {
+			return data
+		}
+		off += end + 1
+	}
+	if off >= len(data) {
+		return data
+	}
+	return data[:off]
+}
+
+// findAtMost is m.FindAll, stopped early where m allows it after the n-th
+// selected line at or after from. The result may hold more lines than
+// that when m cannot stop early; limitLines trims it.
+func findAtMost(m Matcher, data []byte, from, n int) MatchSet {
+	return m.FindAll(cutAfter(m, data, from, n))
+}
+
+// countAtMost is min(m.CountAll(data), n), locating at most n lines where
+// m allows it.
+func countAtMost(m Matcher, data []byte, n int) int {
+	loc, ok := m.(firstLocator)
+	if !ok {
+		return min(m.CountAll(data), n)
+	}
+	count, off := 0, 0
+	for count < n && off < len(data) {
+		_, end, found := loc.firstLine(data[off:])
+		if !found {
+			break
+		}
+		count++
+		off += end + 1
+	}
+	return count
+}
+
+// limitLines truncates ms after its n-th selected line, with any snippets
+// that line was cut into, and returns it with the number of selected
+// lines it keeps. A separator left at the end is dropped.
+func limitLines(ms MatchSet, n int) (MatchSet, int) {
+	lines, last := 0, -1
+	for i, mt := range ms.Matches {
+		if mt.IsContext || mt.LineStart < 0 {
+			continue
+		}
+		start, _ := lineBounds(ms.Data, mt.LineStart)
+		if start == last {
+			continue
+		}
+		if lines == n {
+			ms.Matches = ms.Matches[:i]
+			break
+		}
+		lines++
+		last = start
+	}
+	for k := len(ms.Matches); k > 0 && ms.Matches[k-1].LineStart < 0; k-- {
+		ms.Matches = ms.Matches[:k-1]
+	}
+	return ms, lines
+}
@@ -0,0 +1,86 @@
+package matcher
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"testing"
+)
+
+// selectedLines returns the numbers of the lines m selects in data, in
+// order, by calling FindLine on each.
+func selectedLines(m Matcher, data []byte) []int {
+	var nums []int
+	for i, l := range bytes.Split(bytes.TrimSuffix(data, []byte{'\n'}), []byte{'\n'}) {
+		if _, ok := m.FindLine(l, i+1, 0); ok {
+			nums = append(nums, i+1)
+		}
+	}
+	return nums
+}
+
+// noLocate hides a matcher's firstLocator, so searches cannot stop early.
+type noLocate struct{ Matcher }
+
+func TestMaxCountMatcher(t *testing.T) {
+	rng := rand.New(rand.NewPCG(7, 8))
+	words := []string{"foo", "bar", "quux", "", "quux quux quux quux"}
+	var lines []string
+	for range 100 {
+		lines = append(lines, words[rng.IntN(len(words))])
+	}
+	data := []byte(strings.Join(lines, "\n") + "\n")
+
+	for _, invert := range []bool{false, true} {
+		for _, fixed := range []bool{false, true} {
+			// A narrow column limit cuts the long lines into several snippets.
+			engine, err := NewMatcher([]string{"quux"}, fixed, false, false, invert, MatcherOpts{NeedLineNums: true, MaxCols: 6})
+			if err != nil {
+				t.Fatal(err)
+			}
+			all := selectedLines(engine, data)
+			for _, inner := range []Matcher{engine, noLocate{engine}} {
+				for _, n := range []int{1, 4, 1000} {
+					name := fmt.Sprintf("%T -v=%v -m %d", inner, invert, n)
+					m := NewMaxCountMatcher(inner, n)
+					want := all[:min(n, len(all))]
+
+					var got []int
+					ms := m.FindAll(data)
+					for _, mt := range ms.Matches {
+						if len(got) == 0 || got[len(got)-1] != mt.LineNum {
+							got = append(got, mt.LineNum)
+						}
+					}
+					if fmt.Sprint(got) != fmt.Sprint(want) {
+						t.Errorf("%s: FindAll lines %v, want %v", name, got, want)
+					}
+					if c := m.CountAll(data); c != len(want) {
+						t.Errorf("%s: CountAll = %d, want %d", name, c, len(want))
+					}
+				}
+			}
+		}
+	}
+	if _, ok := NewMaxCountMatcher(NewBoyerMooreMatcher("x", false, false), 0).(*BoyerMooreMatcher); !ok {
+		t.Error("-m 0 should return the inner matcher")
+	}
+}
+
+// TestContextMatcher_MaxCountKeepsTrailingContext checks grep's rule: the
+// last line allowed by -m gets its full trailing context, in which lines
+// that would have been selected are printed as context.
+func TestContextMatcher_MaxCountKeepsTrailingContext(t *testing.T) {
+	inner, _ := NewRegexMatcher("a", false, false)
+	inner.needLineNums = true
+	m := NewContextMatcher(inner, 0, 3).(*ContextMatcher)
+	m.SetMaxCount(1)
+	got := contextLines(m.FindAll([]byte("a\nb\na\nc\n")))
+	if want := []int{1, -2, -3, -4}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if c := m.CountAll([]byte("a\na\na\n")); c != 1 {
+		t.Errorf("CountAll = %d, want 1", c)
+	}
+}
@@ -0,0 +1,138 @@
+package matcher
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+)
+
+// newMultilineMatcher builds the matcher for -U: one RE2 or PCRE regex run
+// over the whole buffer, whose matches may cross line ends. ^ and $ match
+// at every line's edges, as they would line by line; . still stops at a
+// newline, which \n or [\s\S] cross. Fixed strings are quoted into the
+// regex. There is no literal prefilter or lazy DFA, as both work a line at
+// a time, and the matcher is wrapped so that FindFirst, whose shortcut
+// finds a line and then matches it alone, takes the first of FindAll.
+func newMultilineMatcher(patterns []string, fixed bool, usePCRE bool, ignoreCase bool, invert bool, opts MatcherOpts) (Matcher, error) {
+	if invert {
+		return nil, errors.New("multiline matching cannot be inverted")
+	}
+	if fixed {
+		quoted := make([]string, len(patterns))
+		for i, p := range patterns {
+			quoted[i] = regexp.QuoteMeta(p)
+		}
+		patterns = quoted
+	}
+	pattern := "(?m)" + alternation(patterns)
+
+	if usePCRE {
+		m, err := NewPCREMatcher(pattern, ignoreCase, false)
+		if err != nil {
+			return nil, err
+		}
+		m.multiline = true
+		m.needLineNums = opts.NeedLineNums
+		return multilineMatcher{m}, nil
+	}
+	m, err := NewRegexMatcher(pattern, ignoreCase, false)
+	if err != nil {
+		return nil, err
+	}
+	m.prefilter = nil
+	m.multiline = true
+	m.needLineNums = opts.NeedLineNums
+	return multilineMatcher{m}, nil
+}
+
+// multilineMatcher hides everything of its matcher but the Matcher
+// interface, so no caller looks for matches one line at a time.
+type multilineMatcher struct {
+	Matcher
+}
+
+// spanBounds returns the [start, end) bounds of the lines that the match at
+// loc touches, without the last line's newline. A match that ends with a
+// newline ends on that newline's line.
+func spanBounds(data []byte, loc [2]int) (int, int) {
+	start, _ := lineBounds(data, loc[0])
+	last := loc[0]
+	if loc[1] > loc[0] {
+		last = loc[1] - 1
+	}
+	end := len(data)
+	if i := bytes.IndexByte(data[last:], '\n'); i >= 0 {
+		end = last + i
+	}
+	return start, end
+}
+
+// spanMatchSet builds a MatchSet from buffer-absolute match locations, as
+// matchSetFromLocs does, except that each match covers the whole lines its
+// locations span, newlines included, and is never cut to a snippet.
+// Locations whose lines overlap share one match. LineNum is the first
+// line's. Positions are relative to the match's start, clipped to it.
+func spanMatchSet(data []byte, locs [][2]int, needLineNums bool) MatchSet {
+	if n := len(locs); n > 0 && pastLastLine(data, locs[n-1][0]) {
+		locs = locs[:n-1]
+	}
+	if len(locs) == 0 {
+		return MatchSet{}
+	}
+
+	var matches []Match
+	spanEnd := -1
+	lineNum := 1
+	prevOff := 0
+	for i, loc := range locs {
+		start, end := spanBounds(data, loc)
+		if len(matches) > 0 && start <= spanEnd {
+			last := &matches[len(matches)-1]
+			spanEnd = max(spanEnd, end)
+			last.LineLen = spanEnd - last.LineStart
+			last.PosCount = i - last.PosIdx + 1
+		} else {
+			if needLineNums {
+				lineNum += bytes.Count(data[prevOff:start], []byte{'\n'})
+				prevOff = start
+			}
+			matches = append(matches, Match{
+				LineNum:    lineNum,
+				LineStart:  start,
+				LineLen:    end - start,
+				ByteOffset: int64(start),
+				PosIdx:     i,
+				PosCount:   1,
+			})
+			spanEnd = end
+		}
+	}
+
+	// Positions become relative once each match's extent is final.
+	for _, m := range matches {
+		for i := m.PosIdx; i < m.PosIdx+m.PosCount; i++ {
+			s, e := locs[i][0]-m.LineStart, locs[i][1]-m.LineStart
+			locs[i] = [2]int{s, min(e, m.LineLen)}
+		}
+	}
+	return MatchSet{Data: data, Matches: matches, Positions: locs}
+}
+
+// countSpanLines counts the lines that the matches at locs touch.
+func countSpanLines(data []byte, locs [][2]int) int {
+	count := 0
+	spanEnd := -1
+	for _, loc := range locs {
+		if pastLastLine(data, loc[0]) {
+			break
+		}
+		start, end := spanBounds(data, loc)
+		if end <= spanEnd {
+			continue
+		}
+		from := max(start, spanEnd+1)
+		count += 1 + bytes.Count(data[from:end], []byte{'\n'})
+		spanEnd = end
+	}
+	return count
+}
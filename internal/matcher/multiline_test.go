@@ -0,0 +1,70 @@
+package matcher
+
+import (
+	"testing"
+)
+
+func TestMultiline(t *testing.T) {
+	data := []byte("a\nfoo\nx bar\nfoo\nbar\nfoo bar\nz")
+
+	tests := []struct {
+		name      string
+		patterns  []string
+		fixed     bool
+		pcre      bool
+		wantLines []int
+		wantLens  []int
+		wantCount int
+	}{
+		// The spans on lines 2-3 and 4-5 touch no common line; 6 is
+		// a single-line match.
+		{"regex", []string{`foo\n.*bar`}, false, false, []int{2, 4}, []int{9, 7}, 4},
+		{"single line", []string{`foo.*bar`}, false, false, []int{6}, []int{7}, 1},
+		{"anchors", []string{`^bar$\n^foo`}, false, false, []int{5}, []int{11}, 2},
+		// o\nx on lines 2-3 and bar\nfoo on 3-4 share line 3: one span.
+		{"overlapping", []string{`o\nx`, `bar\nfoo`}, false, false, []int{2, 5}, []int{13, 11}, 5},
+		{"fixed", []string{"bar\nfoo"}, true, false, []int{3, 5}, []int{9, 11}, 4},
+		{"trailing newline", []string{`foo bar\n`}, false, false, []int{6}, []int{7}, 1},
+		{"pcre", []string{`x\s+bar\nfoo`}, false, true, []int{3}, []int{9}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewMatcher(tt.patterns, tt.fixed, tt.pcre, false, false, MatcherOpts{
+				NeedLineNums: true,
+				Multiline:    true,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ms := m.FindAll(data)
+			var lines, lens []int
+			for i, mt := range ms.Matches {
+				lines = append(lines, mt.LineNum)
+				lens = append(lens, mt.LineLen)
+				for _, p := range ms.MatchPositions(i) {
+					if p[0] < 0 || p[1] > mt.LineLen || p[0] > p[1] {
+						t.Errorf("line %d position %v outside the span", mt.LineNum, p)
+					}
+				}
+			}
+			if !equalInts(lines, tt.wantLines) || !equalInts(lens, tt.wantLens) {
+				t.Errorf("lines = %v, lens = %v, want %v, %v", lines, lens, tt.wantLines, tt.wantLens)
+			}
+			if c := m.CountAll(data); c != tt.wantCount {
+				t.Errorf("CountAll = %d, want %d", c, tt.wantCount)
+			}
+			if !m.MatchExists(data) {
+				t.Error("MatchExists = false, want true")
+			}
+			first := FindFirst(m, data)
+			if len(first.Matches) != 1 || first.Matches[0].LineNum != tt.wantLines[0] || first.Matches[0].LineLen != tt.wantLens[0] {
+				t.Errorf("FindFirst = %+v, want line %d", first.Matches, tt.wantLines[0])
+			}
+		})
+	}
+
+	if _, err := NewMatcher([]string{"a"}, false, false, false, true, MatcherOpts{Multiline: true}); err == nil {
+		t.Error("inverted multiline matcher built without error")
+	}
+}
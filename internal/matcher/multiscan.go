@@ -0,0 +1,186 @@
+package matcher
+
+import (
+	"bytes"
+
+	"github.com/dl/gogrep/internal/simd"
+)
+
+// MultiScanMatcher matches a handful of fixed patterns by running one SIMD
+// scan per pattern and merging the results. For few, not-too-short patterns
+// this beats the byte-at-a-time Aho-Corasick walk; see selectFixedEngine.
+type MultiScanMatcher struct {
+	patterns     [][]byte // lowered when ignoreCase
+	ignoreCase   bool
+	invert       bool
+	maxCols      int
+	needLineNums bool
+}
+
+// NewMultiScanMatcher creates a MultiScanMatcher for several fixed patterns.
+func NewMultiScanMatcher(patterns []string, ignoreCase bool, invert bool) *MultiScanMatcher {
+	m := &MultiScanMatcher{ignoreCase: ignoreCase, invert: invert}
+	for _, p := range patterns {
+		pat := []byte(p)
+		if ignoreCase {
+			pat = bytes.ToLower(pat)
+		}
+		m.patterns = append(m.patterns, pat)
+	}
+	return m
+}
+
+// index returns the first occurrence of any pattern in data, or -1.
+func (m *MultiScanMatcher) index(data []byte) int {
+	first := -1
+	for _, p := range m.patterns {
+		limit := data
+		if first >= 0 {
+			// Only an earlier occurrence can win.
+			end := first + len(p)
+			if end > len(data) {
+				end = len(data)
+			}
+			limit = data[:end]
+		}
+		var off int
+		if m.ignoreCase {
+			off = simd.IndexCaseInsensitive(limit, p)
+		} else {
+			off = simd.Index(limit, p)
+		}
+		if off >= 0 && (first < 0 || off < first) {
+			first = off
+		}
+	}
+	return first
+}
+
+// searchLocs returns the leftmost-longest non-overlapping occurrences of
+// the patterns, sorted by start so line numbers can be counted
+// incrementally.
+func (m *MultiScanMatcher) searchLocs(data []byte) [][2]int {
+	var locs [][2]int
+	for _, p := range m.patterns {
+		var offsets []int
+		if m.ignoreCase {
+			offsets = simd.IndexAllCaseInsensitive(data, p)
+		} else {
+			offsets = simd.IndexAll(data, p)
+		}
+		for _, off := range offsets {
+			locs = append(locs, [2]int{off, off + len(p)})
+		}
+	}
+	return leftmostLocs(locs)
+}
+
+func (m *MultiScanMatcher) noMatch(line []byte) bool {
+	return m.index(line) < 0
+}
+
+func (m *MultiScanMatcher) MatchExists(data []byte) bool {
+	if m.invert {
+		return existsInvert(data, m.noMatch)
+	}
+	return m.index(data) >= 0
+}
+
+func (m *MultiScanMatcher) CountAll(data []byte) int {
+	if m.invert {
+		return countInvert(data, m.noMatch)
+	}
+	return countLocsUniqueLines(data, m.searchLocs(data))
+}
+
+func (m *MultiScanMatcher) FindAll(data []byte) MatchSet {
+	return m.findAllArena(data, nil)
+}
+
+func (m *MultiScanMatcher) findAllArena(data []byte, a *Arena) MatchSet {
+	if m.invert {
+		return m.findAllInvert(data)
+	}
+	locs := m.searchLocs(data)
+	if len(locs) == 0 {
+		return MatchSet{}
+	}
+	return matchSetFromLocsIn(data, locs, m.maxCols, m.needLineNums, a)
+}
+
+func (m *MultiScanMatcher) findAllInvert(data []byte) MatchSet {
+	ms := MatchSet{Data: data}
+	var offset int64
+	lineNum := 1
+	remaining := data
+
+	for len(remaining) > 0 {
+		idx := bytes.IndexByte(remaining, '\n')
+		lineLen := len(remaining)
+		if idx >= 0 {
+			lineLen = idx
+		}
+		if m.noMatch(remaining[:lineLen]) {
+			ms.Matches = append(ms.Matches, Match{
+				LineNum:    lineNum,
+				LineStart:  int(offset),
+				LineLen:    lineLen,
+				ByteOffset: offset,
+			})
+		}
+
+		if idx >= 0 {
+			remaining = remaining[idx+1:]
+		} else {
+			remaining = nil
+		}
+		offset += int64(lineLen) + 1
+		lineNum++
+	}
+
+	return ms
+}
+
+func (m *MultiScanMatcher) firstLine(data []byte) (int, int, bool) {
+	if m.invert {
+		return firstInvertLine(data, m.noMatch)
+	}
+	off := m.index(data)
+	if off < 0 {
+		return 0, 0, false
+	}
+	start, end := lineBounds(data, off)
+	return start, end, true
+}
+
+func (m *MultiScanMatcher) scanPositions(line []byte) [][2]int {
+	return m.searchLocs(line)
+}
+
+func (m *MultiScanMatcher) FindLine(line []byte, lineNum int, byteOffset int64) (MatchSet, bool) {
+	locs := m.searchLocs(line)
+	hasMatch := len(locs) > 0
+
+	if m.invert {
+		hasMatch = !hasMatch
+	}
+
+	if !hasMatch {
+		return MatchSet{}, false
+	}
+
+	ms := MatchSet{Data: line}
+	match := Match{
+		LineNum:    lineNum,
+		LineStart:  0,
+		LineLen:    len(line),
+		ByteOffset: byteOffset,
+	}
+	if !m.invert {
+		match.PosCount = len(locs)
+		ms.Positions = locs
+	}
+	ms.Matches = []Match{match}
+
+	return ms, true
+}
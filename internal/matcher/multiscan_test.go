@@ -0,0 +1,184 @@
+package matcher
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestMultiScanMatcher_MatchesAhoCorasick(t *testing.T) {
+	inputs := []string{
+		"apple pie\nbanana split\ncherry tart\n",
+		"APPLE\nno fruit here\nBanana and cherry\n",
+		"applecherry\n\nbanan\n",
+		"",
+		"cherry",
+	}
+	patterns := []string{"apple", "cherry", "banana"}
+	for _, ignoreCase := range []bool{false, true} {
+		for _, invert := range []bool{false, true} {
+			ms := NewMultiScanMatcher(patterns, ignoreCase, invert)
+			ms.needLineNums = true
+			ac := NewAhoCorasickMatcher(patterns, ignoreCase, invert)
+			ac.needLineNums = true
+			for _, in := range inputs {
+				data := []byte(in)
+				name := fmt.Sprintf("i=%v v=%v %q", ignoreCase, invert, in)
+
+				got, want := ms.FindAll(data), ac.FindAll(data)
+				if len(got.Matches) != len(want.Matches) {
+					t.Errorf("%s: FindAll %d matches, want %d", name, len(got.Matches), len(want.Matches))
+					continue
+				}
+				for i := range got.Matches {
+					if got.Matches[i].LineNum != want.Matches[i].LineNum {
+						t.Errorf("%s: match %d line %d, want %d", name, i, got.Matches[i].LineNum, want.Matches[i].LineNum)
+					}
+				}
+				if g, w := ms.CountAll(data), ac.CountAll(data); g != w {
+					t.Errorf("%s: CountAll = %d, want %d", name, g, w)
+				}
+				if g, w := ms.MatchExists(data), ac.MatchExists(data); g != w {
+					t.Errorf("%s: MatchExists = %v, want %v", name, g, w)
+				}
+				gs, ge, gok := ms.firstLine(data)
+				ws, we, wok := ac.firstLine(data)
+				if gs != ws || ge != we || gok != wok {
+					t.Errorf("%s: firstLine = (%d,%d,%v), want (%d,%d,%v)", name, gs, ge, gok, ws, we, wok)
+				}
+			}
+		}
+	}
+}
+
+func TestMultiScanMatcher_PositionsSorted(t *testing.T) {
+	m := NewMultiScanMatcher([]string{"cd", "ab"}, false, false)
+	ms := m.FindAll([]byte("xx cd ab cd\n"))
+	if len(ms.Matches) != 1 {
+		t.Fatalf("got %d matches, want 1", len(ms.Matches))
+	}
+	want := [][2]int{{3, 5}, {6, 8}, {9, 11}}
+	got := ms.MatchPositions(0)
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("positions = %v, want %v", got, want)
+	}
+}
+
+func TestFixedEngines_Overlapping(t *testing.T) {
+	patterns := []string{"fo", "oo"}
+	engines := map[string]Matcher{
+		"multiscan": NewMultiScanMatcher(patterns, false, false),
+		"ac":        NewAhoCorasickMatcher(patterns, false, false),
+	}
+	want := [][2]int{{0, 2}, {3, 5}}
+	for name, m := range engines {
+		ms := m.FindAll([]byte("foofoo\n"))
+		if len(ms.Matches) != 1 {
+			t.Fatalf("%s: got %d matches, want 1", name, len(ms.Matches))
+		}
+		if got := ms.MatchPositions(0); fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("%s: positions = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestNewFixedMatcher_EmptyPattern(t *testing.T) {
+	ten := strings.Fields("one two three four five six seven eight nine foo")
+	for _, patterns := range [][]string{{"", "foo"}, {"foo", ""}, append(ten, "")} {
+		m, err := NewMatcher(patterns, true, false, false, false, MatcherOpts{NeedLineNums: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ms := m.FindAll([]byte("a foo\nbar\n\n"))
+		if len(ms.Matches) != 3 {
+			t.Fatalf("%q: got %d matches, want every line", patterns, len(ms.Matches))
+		}
+		var got [][2]int
+		for i := range ms.Matches {
+			for _, pos := range ms.MatchPositions(i) {
+				if pos[1] > pos[0] {
+					got = append(got, pos)
+				}
+			}
+		}
+		if want := [][2]int{{2, 5}}; fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("%q: non-empty positions = %v, want %v", patterns, got, want)
+		}
+	}
+}
+
+func TestSelectFixedEngine(t *testing.T) {
+	ten := strings.Fields("one two three four five six seven eight nine ten")
+	tests := []struct {
+		patterns   []string
+		ignoreCase bool
+		want       fixedEngine
+	}{
+		{[]string{"error"}, false, engineShortPattern},
+		{[]string{""}, false, engineBoyerMoore},
+		{[]string{"errors.New"}, false, engineBoyerMoore},
+		{[]string{"ab", "cd"}, false, engineMultiScan},
+		{ten[:8], false, engineMultiScan},
+		{ten, false, engineAhoCorasick},
+		{ten, true, engineMultiScan},
+		{strings.Split("abcdefghij", ""), false, engineMultiScan},
+		{strings.Split("abcdefghijklmnopq", ""), false, engineAhoCorasick},
+	}
+	for _, tt := range tests {
+		if got := selectFixedEngine(tt.patterns, tt.ignoreCase); got != tt.want {
+			t.Errorf("selectFixedEngine(%q, %v) = %v, want %v", tt.patterns, tt.ignoreCase, got, tt.want)
+		}
+	}
+}
+
+// BenchmarkFixedEngineCrossover compares Aho-Corasick against per-pattern
+// SIMD scans across pattern count, pattern length and match density. The
+// thresholds in selectFixedEngine come from this benchmark:
+//
+//	go test -bench FixedEngineCrossover -run ^$ ./internal/matcher/
+func BenchmarkFixedEngineCrossover(b *testing.B) {
+	line := "the quick brown fox jumps over the lazy dog while 42 clocks tick\n"
+	sets := map[string][]string{
+		"byte":  strings.Split("!@#$%^&*+=<>?/|~", ""),
+		"short": strings.Fields("zq qz xj jx vq qv zx xz jq qj kz zk wq qw vz zv"),
+		"word":  strings.Fields("zebra quartz jukebox vortex pixel waltz glyph nymph fjord sphinx kayak wharf crypt oxbow blitz vexing"),
+	}
+
+	for _, density := range []string{"none", "sparse", "dense"} {
+		for _, plen := range []string{"byte", "short", "word", "word-i"} {
+			for _, k := range []int{2, 4, 8, 12, 16} {
+				ignoreCase := plen == "word-i"
+				patterns := sets[strings.TrimSuffix(plen, "-i")][:k]
+
+				var buf bytes.Buffer
+				for i := 0; i < 20000; i++ {
+					buf.WriteString(line)
+					switch {
+					case density == "dense":
+						buf.WriteString(patterns[i%k] + " " + line)
+					case density == "sparse" && i%1000 == 0:
+						buf.WriteString(patterns[i%k] + "\n")
+					}
+				}
+				data := buf.Bytes()
+
+				engines := []struct {
+					name string
+					m    Matcher
+				}{
+					{"ac", NewAhoCorasickMatcher(patterns, ignoreCase, false)},
+					{"multiscan", NewMultiScanMatcher(patterns, ignoreCase, false)},
+				}
+				for _, e := range engines {
+					b.Run(fmt.Sprintf("%s/%s/k=%d/%s", density, plen, k, e.name), func(b *testing.B) {
+						b.SetBytes(int64(len(data)))
+						for b.Loop() {
+							e.m.FindAll(data)
+						}
+					})
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package matcher
+
+import (
+	"bytes"
+	"slices"
+	"sort"
+)
+
+// NearMatcher reports places where two patterns occur within a given number
+// of lines of each other. Each A hit is paired with the nearest B hit and
+// vice versa; a pair no more than within lines apart spans a block from
+// the first hit to the second, and overlapping or adjacent blocks merge.
+// Hit lines inside a block are matches, the lines between them context,
+// and blocks are separated like context groups.
+type NearMatcher struct {
+	a, b         Matcher
+	within       int
+	noSeparators bool // never emit group separator sentinels
+}
+
+// nearHit is a line matched by A, B or both.
+type nearHit struct {
+	line      int // 1-based
+	start     int
+	len       int
+	a, b      bool
+	positions [][2]int
+}
+
+// NewNearMatcher pairs the hits of a and b. Both must report line numbers
+// and full, untruncated lines from FindAll.
+func NewNearMatcher(a, b Matcher, within int) *NearMatcher {
+	return &NearMatcher{a: a, b: b, within: within}
+}
+
+// SetSeparators controls whether a separator sentinel (LineStart -1) is
+// emitted between blocks. On by default.
+func (m *NearMatcher) SetSeparators(on bool) {
+	m.noSeparators = !on
+}
+
+// hits merges the line hits of both patterns in line order.
+func (m *NearMatcher) hits(data []byte) []nearHit {
+	if !m.a.MatchExists(data) || !m.b.MatchExists(data) {
+		return nil
+	}
+	as, bs := m.a.FindAll(data), m.b.FindAll(data)
+	hits := make([]nearHit, 0, len(as.Matches)+len(bs.Matches))
+	i, j := 0, 0
+	for i < len(as.Matches) || j < len(bs.Matches) {
+		var h nearHit
+		switch {
+		case j == len(bs.Matches) || (i < len(as.Matches) && as.Matches[i].LineNum < bs.Matches[j].LineNum):
+			h = hitFrom(&as, i)
+			h.a = true
+			i++
+		case i == len(as.Matches) || bs.Matches[j].LineNum < as.Matches[i].LineNum:
+			h = hitFrom(&bs, j)
+			h.b = true
+			j++
+		default:
+			h = hitFrom(&as, i)
+			h.a, h.b = true, true
+			h.positions = append(h.positions, bs.MatchPositions(j)...)
+			slices.SortFunc(h.positions, func(x, y [2]int) int { return x[0] - y[0] })
+			i++
+			j++
+		}
+		hits = append(hits, h)
+	}
+	return hits
+}
+
+func hitFrom(ms *MatchSet, i int) nearHit {
+	mt := &ms.Matches[i]
+	return nearHit{
+		line:      mt.LineNum,
+		start:     mt.LineStart,
+		len:       mt.LineLen,
+		positions: slices.Clone(ms.MatchPositions(i)),
+	}
+}
+
+// blocks returns the merged [first, last] line spans of all pairs, in order.
+func (m *NearMatcher) blocks(hits []nearHit) [][2]int {
+	var aLines, bLines []int
+	for _, h := range hits {
+		if h.a {
+			aLines = append(aLines, h.line)
+		}
+		if h.b {
+			bLines = append(bLines, h.line)
+		}
+	}
+	var spans [][2]int
+	pair := func(from []int, to []int) {
+		for _, l := range from {
+			if o, ok := nearest(to, l); ok && abs(o-l) <= m.within {
+				spans = append(spans, [2]int{min(l, o), max(l, o)})
+			}
+		}
+	}
+	pair(aLines, bLines)
+	pair(bLines, aLines)
+	if len(spans) == 0 {
+		return nil
+	}
+
+	slices.SortFunc(spans, func(x, y [2]int) int { return x[0] - y[0] })
+	merged := spans[:1]
+	for _, s := range spans[1:] {
+		last := &merged[len(merged)-1]
+		if s[0] <= last[1]+1 {
+			last[1] = max(last[1], s[1])
+			continue
+		}
+		merged = append(merged, s)
+	}
+	return merged
+}
+
+// nearest returns the line in sorted lines closest to l.
+func nearest(lines []int, l int) (int, bool) {
+	i := sort.SearchInts(lines, l)
+	switch {
+	case len(lines) == 0:
+		return 0, false
+	case i == len(lines):
+		return lines[i-1], true
+	case i == 0 || lines[i]-l < l-lines[i-1]:
+		return lines[i], true
+	default:
+		return lines[i-1], true
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func (m *NearMatcher) FindAll(data []byte) MatchSet {
+	hits := m.hits(data)
+	blocks := m.blocks(hits)
+	if len(blocks) == 0 {
+		return MatchSet{}
+	}
+
+	result := MatchSet{Data: data}
+	h := 0
+	for bi, blk := range blocks {
+		if bi > 0 && !m.noSeparators {
+			result.Matches = append(result.Matches, Match{LineStart: -1, IsContext: true})
+		}
+		for hits[h].line < blk[0] {
+			h++
+		}
+		// Blocks start and end on hit lines; walk the lines in between.
+		off := hits[h].start
+		for line := blk[0]; line <= blk[1]; line++ {
+			if h < len(hits) && hits[h].line == line {
+				hit := &hits[h]
+				result.Matches = append(result.Matches, Match{
+					LineNum:    line,
+					LineStart:  hit.start,
+					LineLen:    hit.len,
+					ByteOffset: int64(hit.start),
+					PosIdx:     len(result.Positions),
+					PosCount:   len(hit.positions),
+				})
+				result.Positions = append(result.Positions, hit.positions...)
+				off = hit.start + hit.len + 1
+				h++
+				continue
+			}
+			n := bytes.IndexByte(data[off:], '\n')
+			if n < 0 {
+				n = len(data) - off
+			}
+			result.Matches = append(result.Matches, Match{
+				LineNum:    line,
+				LineStart:  off,
+				LineLen:    n,
+				ByteOffset: int64(off),
+				IsContext:  true,
+			})
+			off += n + 1
+		}
+	}
+	return result
+}
+
+func (m *NearMatcher) MatchExists(data []byte) bool {
+	return len(m.blocks(m.hits(data))) > 0
+}
+
+// CountAll counts the hit lines inside blocks, the lines FindAll reports
+// as matches.
+func (m *NearMatcher) CountAll(data []byte) int {
+	hits := m.hits(data)
+	count := 0
+	h := 0
+	for _, blk := range m.blocks(hits) {
+		for ; h < len(hits) && hits[h].line <= blk[1]; h++ {
+			if hits[h].line >= blk[0] {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// FindLine matches a line containing both patterns, the only block a
+// single line can hold.
+func (m *NearMatcher) FindLine(line []byte, lineNum int, byteOffset int64) (MatchSet, bool) {
+	as, ok := m.a.FindLine(line, lineNum, byteOffset)
+	if !ok {
+		return MatchSet{}, false
+	}
+	bs, ok := m.b.FindLine(line, lineNum, byteOffset)
+	if !ok {
+		return MatchSet{}, false
+	}
+	positions := append(slices.Clone(as.MatchPositions(0)), bs.MatchPositions(0)...)
+	slices.SortFunc(positions, func(x, y [2]int) int { return x[0] - y[0] })
+	as.Positions = positions
+	as.Matches[0].PosIdx = 0
+	as.Matches[0].PosCount = len(positions)
+	return as, true
+}
@@ -0,0 +1,69 @@
+package matcher
+
+import "testing"
+
+func newNear(t *testing.T, a, b string, within int) *NearMatcher {
+	t.Helper()
+	opts := MatcherOpts{NeedLineNums: true}
+	am, err := NewMatcher([]string{a}, true, false, false, false, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bm, err := NewMatcher([]string{b}, true, false, false, false, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewNearMatcher(am, bm, within)
+}
+
+func TestNearMatcher(t *testing.T) {
+	data := []byte("open\nx\nclose\ny\ny\ny\ny\nopen\ny\ny\ny\ny\nclose\nopen close\n")
+	m := newNear(t, "open", "close", 2)
+
+	ms := m.FindAll(data)
+	type line struct {
+		num     int
+		context bool
+	}
+	want := []line{{1, false}, {2, true}, {3, false}, {0, true}, {13, false}, {14, false}}
+	if len(ms.Matches) != len(want) {
+		t.Fatalf("got %d lines, want %d: %+v", len(ms.Matches), len(want), ms.Matches)
+	}
+	for i, w := range want {
+		got := ms.Matches[i]
+		if got.LineNum != w.num || got.IsContext != w.context {
+			t.Errorf("line %d = {%d %v}, want {%d %v}", i, got.LineNum, got.IsContext, w.num, w.context)
+		}
+	}
+	if s := string(ms.LineBytes(1)); s != "x" {
+		t.Errorf("context line = %q, want %q", s, "x")
+	}
+	if pos := ms.MatchPositions(5); len(pos) != 2 || pos[0] != [2]int{0, 4} || pos[1] != [2]int{5, 10} {
+		t.Errorf("positions on both-pattern line = %v", pos)
+	}
+
+	if n := m.CountAll(data); n != 4 {
+		t.Errorf("CountAll = %d, want 4", n)
+	}
+	if !m.MatchExists(data) {
+		t.Error("MatchExists = false, want true")
+	}
+	if _, ok := m.FindLine([]byte("open close"), 1, 0); !ok {
+		t.Error("FindLine missed a line with both patterns")
+	}
+	if _, ok := m.FindLine([]byte("open"), 1, 0); ok {
+		t.Error("FindLine matched a line with one pattern")
+	}
+}
+
+func TestNearMatcher_TooFar(t *testing.T) {
+	data := []byte("open\n1\n2\n3\nclose\n")
+	if m := newNear(t, "open", "close", 3); m.MatchExists(data) || len(m.FindAll(data).Matches) > 0 {
+		t.Error("matched hits 4 lines apart with within=3")
+	}
+	m := newNear(t, "open", "close", 4)
+	m.SetSeparators(false)
+	if ms := m.FindAll(data); len(ms.Matches) != 5 {
+		t.Errorf("got %d lines, want the 5-line block", len(ms.Matches))
+	}
+}
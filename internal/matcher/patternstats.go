@@ -0,0 +1,113 @@
+package matcher
+
+import "sync/atomic"
+
+// PatternStats attributes matches to individual patterns of a multi-pattern
+// search: for each pattern, the lines it matches and the files it occurs
+// in. Counters are atomic, so one PatternStats is shared by all scheduler
+// workers and read once the search is done.
+type PatternStats struct {
+	patterns []string
+	counters []Matcher // one single-pattern matcher per pattern
+	lines    []atomic.Int64
+	files    []atomic.Int64
+}
+
+// PatternTotal is one pattern's share of a search.
+type PatternTotal struct {
+	Pattern string
+	Lines   int // lines matching the pattern (a line matching two patterns counts for both)
+	Files   int // files with at least one such line
+}
+
+// NewPatternStats builds a counter for each pattern with build, which
+// should apply the same options as the main matcher.
+func NewPatternStats(patterns []string, build func(pattern string) (Matcher, error)) (*PatternStats, error) {
+	s := &PatternStats{
+		patterns: patterns,
+		counters: make([]Matcher, len(patterns)),
+		lines:    make([]atomic.Int64, len(patterns)),
+		files:    make([]atomic.Int64, len(patterns)),
+	}
+	for i, p := range patterns {
+		m, err := build(p)
+		if err != nil {
+			return nil, err
+		}
+		s.counters[i] = m
+	}
+	return s, nil
+}
+
+// Add adds each pattern's matching lines in data, counting data as one
+// file. The wrapping matcher calls it with every buffer that matched.
+func (s *PatternStats) Add(data []byte) {
+	for i, c := range s.counters {
+		if n := c.CountAll(data); n > 0 {
+			s.lines[i].Add(int64(n))
+			s.files[i].Add(1)
+		}
+	}
+}
+
+// Totals returns the counts so far, in pattern order.
+func (s *PatternStats) Totals() []PatternTotal {
+	totals := make([]PatternTotal, len(s.patterns))
+	for i, p := range s.patterns {
+		totals[i] = PatternTotal{
+			Pattern: p,
+			Lines:   int(s.lines[i].Load()),
+			Files:   int(s.files[i].Load()),
+		}
+	}
+	return totals
+}
+
+// PatternStatsMatcher wraps a Matcher and feeds every buffer in which inner
+// finds a match to a PatternStats. Buffers without a match cost nothing
+// extra; each matching one is rescanned once per pattern.
+type PatternStatsMatcher struct {
+	inner Matcher
+	stats *PatternStats
+}
+
+// NewPatternStatsMatcher wraps inner to count per-pattern matches into s.
+// If s is nil, returns the inner matcher directly.
+func NewPatternStatsMatcher(inner Matcher, s *PatternStats) Matcher {
+	if s == nil {
+		return inner
+	}
+	return &PatternStatsMatcher{inner: inner, stats: s}
+}
+
+func (m *PatternStatsMatcher) FindAll(data []byte) MatchSet {
+	ms := m.inner.FindAll(data)
+	if ms.HasMatch() {
+		m.stats.Add(data)
+	}
+	return ms
+}
+
+func (m *PatternStatsMatcher) MatchExists(data []byte) bool {
+	if !m.inner.MatchExists(data) {
+		return false
+	}
+	m.stats.Add(data)
+	return true
+}
+
+func (m *PatternStatsMatcher) CountAll(data []byte) int {
+	n := m.inner.CountAll(data)
+	if n > 0 {
+		m.stats.Add(data)
+	}
+	return n
+}
+
+func (m *PatternStatsMatcher) FindLine(line []byte, lineNum int, byteOffset int64) (MatchSet, bool) {
+	ms, ok := m.inner.FindLine(line, lineNum, byteOffset)
+	if ok {
+		m.stats.Add(line)
+	}
+	return ms, ok
+}
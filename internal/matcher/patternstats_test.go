@@ -0,0 +1,30 @@
+package matcher
+
+import "testing"
+
+func TestPatternStatsMatcher(t *testing.T) {
+	patterns := []string{"foo", "bar", "baz"}
+	stats, err := NewPatternStats(patterns, func(p string) (Matcher, error) {
+		return NewBoyerMooreMatcher(p, false, false), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewPatternStatsMatcher(NewAhoCorasickMatcher(patterns, false, false), stats)
+
+	m.FindAll([]byte("foo\nfoo bar\nnone\n"))
+	m.CountAll([]byte("bar\n"))
+	m.FindAll([]byte("nothing here\n"))
+
+	want := []PatternTotal{
+		{Pattern: "foo", Lines: 2, Files: 1},
+		{Pattern: "bar", Lines: 2, Files: 2},
+		{Pattern: "baz", Lines: 0, Files: 0},
+	}
+	got := stats.Totals()
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Totals()[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
@@ -1,24 +1,42 @@
+//go:build !wasm
+
 package matcher
 
 import (
 	"bytes"
+	"sync"
 
 	"go.elara.ws/pcre"
 )
 
 // PCREMatcher matches using PCRE2-compatible regexes via the pure Go pcre package.
 // Supports lookahead, lookbehind, backreferences, atomic groups, and all PCRE2 features.
+//
+// A compiled pcre.Regexp serializes every call on an internal lock, so one
+// instance shared by all scheduler workers would run them one at a time.
+// PCREMatcher instead keeps a pool of compiled copies: each call checks one
+// out, matches without any shared lock, and returns it. The pool grows to
+// the number of goroutines matching at once.
 type PCREMatcher struct {
-	re           *pcre.Regexp
+	pattern      string
+	opts         pcre.CompileOption
 	ignoreCase   bool
 	invert       bool
 	maxCols      int
 	needLineNums bool
+	multiline    bool     // matches may span lines (-U); see newMultilineMatcher
+	groups       []string // named groups, for Captures
+
+	mu   sync.Mutex
+	free []*pcre.Regexp // idle compiled copies
+	all  []*pcre.Regexp // every copy, for Close
 }
 
 // NewPCREMatcher creates a PCREMatcher from a PCRE2 pattern string.
 func NewPCREMatcher(pattern string, ignoreCase bool, invert bool) (*PCREMatcher, error) {
-	var opts pcre.CompileOption
+	// Buffers are searched whole, so ^ and $ must match at every line's
+	// edges, as they do when a line is matched alone.
+	opts := pcre.Multiline
 	if ignoreCase {
 		opts |= pcre.Caseless
 	}
@@ -29,44 +47,93 @@ func NewPCREMatcher(pattern string, ignoreCase bool, invert bool) (*PCREMatcher,
 	}
 
 	return &PCREMatcher{
-		re:         re,
+		pattern:    pattern,
+		opts:       opts,
 		ignoreCase: ignoreCase,
 		invert:     invert,
+		groups:     namedGroups(pattern),
+		free:       []*pcre.Regexp{re},
+		all:        []*pcre.Regexp{re},
 	}, nil
 }
 
+// get checks out a compiled copy of the pattern, compiling a new one if
+// all copies are in use. The pattern compiled once already, so it cannot
+// fail to compile again.
+func (m *PCREMatcher) get() *pcre.Regexp {
+	m.mu.Lock()
+	if n := len(m.free); n > 0 {
+		re := m.free[n-1]
+		m.free = m.free[:n-1]
+		m.mu.Unlock()
+		return re
+	}
+	m.mu.Unlock()
+
+	re := pcre.MustCompileOpts(m.pattern, m.opts)
+	m.mu.Lock()
+	m.all = append(m.all, re)
+	m.mu.Unlock()
+	return re
+}
+
+// put returns a copy checked out by get.
+func (m *PCREMatcher) put(re *pcre.Regexp) {
+	m.mu.Lock()
+	m.free = append(m.free, re)
+	m.mu.Unlock()
+}
+
 func (m *PCREMatcher) MatchExists(data []byte) bool {
+	re := m.get()
+	defer m.put(re)
+
 	if m.invert {
-		return len(data) > 0
+		return existsInvert(data, func(line []byte) bool {
+			return !re.Match(line)
+		})
 	}
-	return m.re.Match(data)
+	loc := re.FindIndex(data)
+	return loc != nil && !pastLastLine(data, loc[0])
 }
 
 func (m *PCREMatcher) CountAll(data []byte) int {
+	re := m.get()
+	defer m.put(re)
+
 	if m.invert {
 		return countInvert(data, func(line []byte) bool {
-			return len(m.re.FindAllIndex(line, -1)) == 0
+			return !re.Match(line)
 		})
 	}
 
-	locs := toLocs2(m.re.FindAllIndex(data, -1))
+	locs := toLocs2(re.FindAllIndex(data, -1))
+	if m.multiline {
+		return countSpanLines(data, locs)
+	}
 	return countLocsUniqueLines(data, locs)
 }
 
 func (m *PCREMatcher) FindAll(data []byte) MatchSet {
+	re := m.get()
+	defer m.put(re)
+
 	if m.invert {
-		return m.findAllInvert(data)
+		return m.findAllInvert(re, data)
 	}
 
-	locs := toLocs2(m.re.FindAllIndex(data, -1))
+	locs := toLocs2(re.FindAllIndex(data, -1))
 	if len(locs) == 0 {
 		return MatchSet{}
 	}
+	if m.multiline {
+		return spanMatchSet(data, locs, m.needLineNums)
+	}
 
 	return matchSetFromLocs(data, locs, m.maxCols, m.needLineNums)
 }
 
-func (m *PCREMatcher) findAllInvert(data []byte) MatchSet {
+func (m *PCREMatcher) findAllInvert(re *pcre.Regexp, data []byte) MatchSet {
 	ms := MatchSet{Data: data}
 	var offset int64
 	lineNum := 1
@@ -83,7 +150,7 @@ func (m *PCREMatcher) findAllInvert(data []byte) MatchSet {
 		lineStart := int(offset)
 		line := remaining[:lineLen]
 
-		locs := m.re.FindAllIndex(line, -1)
+		locs := re.FindAllIndex(line, -1)
 		if len(locs) == 0 {
 			ms.Matches = append(ms.Matches, Match{
 				LineNum:    lineNum,
@@ -105,8 +172,35 @@ func (m *PCREMatcher) findAllInvert(data []byte) MatchSet {
 	return ms
 }
 
+func (m *PCREMatcher) firstLine(data []byte) (int, int, bool) {
+	re := m.get()
+	defer m.put(re)
+
+	if m.invert {
+		return firstInvertLine(data, func(line []byte) bool {
+			return !re.Match(line)
+		})
+	}
+	loc := re.FindIndex(data)
+	if loc == nil || pastLastLine(data, loc[0]) {
+		return 0, 0, false
+	}
+	start, end := lineBounds(data, loc[0])
+	return start, end, true
+}
+
+func (m *PCREMatcher) scanPositions(line []byte) [][2]int {
+	re := m.get()
+	defer m.put(re)
+
+	return toLocs2(re.FindAllIndex(line, -1))
+}
+
 func (m *PCREMatcher) FindLine(line []byte, lineNum int, byteOffset int64) (MatchSet, bool) {
-	locs := m.re.FindAllIndex(line, -1)
+	re := m.get()
+	defer m.put(re)
+
+	locs := re.FindAllIndex(line, -1)
 	hasMatch := len(locs) > 0
 
 	if m.invert {
@@ -137,9 +231,47 @@ func (m *PCREMatcher) FindLine(line []byte, lineNum int, byteOffset int64) (Matc
 	return ms, true
 }
 
-// Close releases the compiled PCRE regex resources.
+// Close releases the compiled PCRE regex resources. The matcher must not
+// be used afterwards.
 func (m *PCREMatcher) Close() {
-	if m.re != nil {
-		m.re.Close()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, re := range m.all {
+		re.Close()
+	}
+	m.free, m.all = nil, nil
+}
+
+// Captures returns the named groups of the first match in line.
+func (m *PCREMatcher) Captures(line []byte) []Capture {
+	re := m.get()
+	defer m.put(re)
+	loc := re.FindSubmatchIndex(line)
+	if loc == nil {
+		return nil
+	}
+	caps := make([]Capture, 0, len(m.groups))
+	for _, name := range m.groups {
+		c := Capture{Name: name, Start: -1, End: -1}
+		if i := re.SubexpIndex(name); i > 0 && 2*i+1 < len(loc) {
+			c.Start, c.End = loc[2*i], loc[2*i+1]
+		}
+		caps = append(caps, c)
+	}
+	return caps
+}
+
+func (m *PCREMatcher) submatches(line []byte) [][]int {
+	re := m.get()
+	defer m.put(re)
+	return re.FindAllSubmatchIndex(line, -1)
+}
+
+func (m *PCREMatcher) groupIndexes(name string) []int {
+	re := m.get()
+	defer m.put(re)
+	if i := re.SubexpIndex(name); i > 0 {
+		return []int{i}
 	}
+	return nil
 }
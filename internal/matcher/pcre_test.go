@@ -1,8 +1,11 @@
+//go:build !wasm
+
 package matcher
 
 import (
 	"bytes"
 	"os"
+	"sync"
 	"testing"
 )
 
@@ -174,6 +177,36 @@ func TestPCREMatcher_FindLine(t *testing.T) {
 	}
 }
 
+func TestPCREMatcher_Concurrent(t *testing.T) {
+	skipIfRace(t)
+	m, err := NewPCREMatcher(`(\w+)\s+\1`, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	data := bytes.Repeat([]byte("say hello hello\nno repeat here\n"), 100)
+	var wg sync.WaitGroup
+	for range 16 {
+		wg.Go(func() {
+			for range 20 {
+				if got := m.CountAll(data); got != 100 {
+					t.Errorf("CountAll = %d, want 100", got)
+					return
+				}
+			}
+		})
+	}
+	wg.Wait()
+
+	if n := len(m.all); n < 1 || n > 16 {
+		t.Errorf("compiled %d copies, want 1..16", n)
+	}
+	if len(m.free) != len(m.all) {
+		t.Errorf("%d of %d copies returned to the pool", len(m.free), len(m.all))
+	}
+}
+
 func TestPCREMatcher_InvalidPattern(t *testing.T) {
 	skipIfRace(t)
 	_, err := NewPCREMatcher("[invalid", false, false)
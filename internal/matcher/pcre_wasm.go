@@ -0,0 +1,36 @@
+package matcher
+
+import "errors"
+
+// PCREMatcher is not available in WebAssembly builds: the PCRE2 port is
+// transpiled C that runs on a libc shim with no wasm support. The type
+// exists so the factory and callers build unchanged; NewPCREMatcher
+// always fails.
+type PCREMatcher struct {
+	Matcher
+	maxCols      int
+	needLineNums bool
+	multiline    bool
+}
+
+// NewPCREMatcher reports that PCRE is unavailable.
+func NewPCREMatcher(pattern string, ignoreCase bool, invert bool) (*PCREMatcher, error) {
+	return nil, errors.New("PCRE (-P) is not supported in WebAssembly builds")
+}
+
+// Captures is never called: there is no PCREMatcher to call it on.
+func (m *PCREMatcher) Captures(line []byte) []Capture {
+	return nil
+}
+
+// submatches is never called either.
+func (m *PCREMatcher) submatches(line []byte) [][]int {
+	return nil
+}
+
+func (m *PCREMatcher) groupIndexes(name string) []int {
+	return nil
+}
+
+// Close has nothing to release.
+func (m *PCREMatcher) Close() {}
@@ -0,0 +1,179 @@
+package matcher
+
+import "bytes"
+
+// Range restricts matching to a region of each file. Zero values mean
+// "unbounded" on that side. Byte bounds are widened to whole lines so no
+// line is searched partially.
+type Range struct {
+	FromLine int   // first line to search, 1-based
+	ToLine   int   // last line to search, inclusive
+	FromByte int64 // first byte to search; negative counts back from the end
+	ToByte   int64 // byte offset where the search stops (exclusive)
+}
+
+// IsZero reports whether the range covers the whole file.
+func (r Range) IsZero() bool {
+	return r == Range{}
+}
+
+// RangeMatcher wraps a Matcher and searches only the lines within a Range.
+// Results are re-based onto the full buffer: LineStart and ByteOffset are
+// file-relative, and line numbers start from the window's first line rather
+// than 1.
+type RangeMatcher struct {
+	inner        Matcher
+	rng          Range
+	needLineNums bool
+}
+
+// NewRangeMatcher wraps inner to search only within r.
+// If r is the zero Range, returns the inner matcher directly.
+// needLineNums controls whether the line-number base is computed; counting
+// newlines before the window reads the file prefix, which --from-byte on a
+// huge log would otherwise avoid entirely.
+func NewRangeMatcher(inner Matcher, r Range, needLineNums bool) Matcher {
+	if r.IsZero() {
+		return inner
+	}
+	return &RangeMatcher{inner: inner, rng: r, needLineNums: needLineNums || r.FromLine > 0}
+}
+
+// window returns the [start, end) byte bounds of the searched region and
+// the 1-based line number of its first line.
+func (m *RangeMatcher) window(data []byte) (start, end, baseLine int) {
+	n := len(data)
+	start, end = 0, n
+	baseLine = 1
+
+	if m.rng.FromByte != 0 {
+		from := m.rng.FromByte
+		if from < 0 {
+			from += int64(n)
+		}
+		start = clampOffset(from, n)
+		// Skip the partial line the offset lands in.
+		if start > 0 && data[start-1] != '\n' {
+			if i := bytes.IndexByte(data[start:], '\n'); i >= 0 {
+				start += i + 1
+			} else {
+				start = n
+			}
+		}
+	}
+	if m.rng.ToByte > 0 {
+		to := clampOffset(m.rng.ToByte, n)
+		// Include the whole line that contains the last byte.
+		if to > 0 && to < n && data[to-1] != '\n' {
+			if i := bytes.IndexByte(data[to:], '\n'); i >= 0 {
+				to += i
+			} else {
+				to = n
+			}
+		}
+		end = to
+	}
+
+	if m.needLineNums && start > 0 {
+		baseLine = 1 + bytes.Count(data[:start], []byte{'\n'})
+	}
+
+	if m.rng.FromLine > baseLine {
+		// Advance start to the beginning of FromLine.
+		for baseLine < m.rng.FromLine && start < n {
+			i := bytes.IndexByte(data[start:], '\n')
+			if i < 0 {
+				start = n
+				break
+			}
+			start += i + 1
+			baseLine++
+		}
+	}
+	if m.rng.ToLine > 0 {
+		// Stop after ToLine.
+		off, line := start, baseLine
+		for line <= m.rng.ToLine && off < end {
+			i := bytes.IndexByte(data[off:end], '\n')
+			if i < 0 {
+				off = end
+				break
+			}
+			off += i + 1
+			line++
+		}
+		if off < end {
+			end = off
+		}
+	}
+
+	if start > end {
+		start = end
+	}
+	return start, end, baseLine
+}
+
+// clampOffset converts off to an int within [0, n].
+func clampOffset(off int64, n int) int {
+	if off < 0 {
+		return 0
+	}
+	if off > int64(n) {
+		return n
+	}
+	return int(off)
+}
+
+// rebase shifts a MatchSet found in data[start:] onto data.
+func rebase(ms MatchSet, data []byte, start, baseLine int) MatchSet {
+	if len(ms.Matches) == 0 {
+		return ms
+	}
+	ms.Data = data
+	for i := range ms.Matches {
+		mt := &ms.Matches[i]
+		if mt.LineStart < 0 {
+			continue // group separator
+		}
+		mt.LineStart += start
+		mt.ByteOffset += int64(start)
+		mt.LineNum += baseLine - 1
+	}
+	return ms
+}
+
+func (m *RangeMatcher) FindAll(data []byte) MatchSet {
+	start, end, baseLine := m.window(data)
+	return rebase(m.inner.FindAll(data[start:end]), data, start, baseLine)
+}
+
+func (m *RangeMatcher) MatchExists(data []byte) bool {
+	start, end, _ := m.window(data)
+	return m.inner.MatchExists(data[start:end])
+}
+
+func (m *RangeMatcher) CountAll(data []byte) int {
+	start, end, _ := m.window(data)
+	return m.inner.CountAll(data[start:end])
+}
+
+func (m *RangeMatcher) FindLine(line []byte, lineNum int, byteOffset int64) (MatchSet, bool) {
+	return m.inner.FindLine(line, lineNum, byteOffset)
+}
+
+func (m *RangeMatcher) firstLine(data []byte) (int, int, bool) {
+	start, end, _ := m.window(data)
+	window := data[start:end]
+	if loc, ok := m.inner.(firstLocator); ok {
+		s, e, found := loc.firstLine(window)
+		return start + s, start + e, found
+	}
+	ms := firstOf(m.inner.FindAll(window))
+	for i := range ms.Matches {
+		if !ms.Matches[i].IsContext {
+			mt := &ms.Matches[i]
+			return start + mt.LineStart, start + mt.LineStart + mt.LineLen, true
+		}
+	}
+	return 0, 0, false
+}
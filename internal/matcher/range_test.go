@@ -0,0 +1,87 @@
+package matcher
+
+import "testing"
+
+func TestRangeMatcher_Lines(t *testing.T) {
+	data := []byte("foo 1\nbar 2\nfoo 3\nbar 4\nfoo 5\n")
+	inner := NewBoyerMooreMatcher("foo", false, false)
+	inner.needLineNums = true
+
+	tests := []struct {
+		name      string
+		rng       Range
+		wantLines []int
+		wantCount int
+	}{
+		{"from line", Range{FromLine: 2}, []int{3, 5}, 2},
+		{"to line", Range{ToLine: 3}, []int{1, 3}, 2},
+		{"line window", Range{FromLine: 2, ToLine: 4}, []int{3}, 1},
+		{"past end", Range{FromLine: 10}, nil, 0},
+		{"from byte mid-line", Range{FromByte: 2}, []int{3, 5}, 2},
+		{"from byte at line start", Range{FromByte: 12}, []int{3, 5}, 2},
+		{"tail bytes", Range{FromByte: -6}, []int{5}, 1},
+		{"to byte", Range{ToByte: 13}, []int{1, 3}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewRangeMatcher(inner, tt.rng, true)
+			ms := m.FindAll(data)
+			var got []int
+			for i, mt := range ms.Matches {
+				got = append(got, mt.LineNum)
+				line := string(ms.LineBytes(i))
+				if line[:3] != "foo" || int(line[4]-'0') != mt.LineNum {
+					t.Errorf("line %d = %q, not re-based onto data", mt.LineNum, line)
+				}
+				if int64(mt.LineStart) != mt.ByteOffset {
+					t.Errorf("ByteOffset %d != LineStart %d", mt.ByteOffset, mt.LineStart)
+				}
+			}
+			if !equalInts(got, tt.wantLines) {
+				t.Errorf("lines = %v, want %v", got, tt.wantLines)
+			}
+			if c := m.CountAll(data); c != tt.wantCount {
+				t.Errorf("CountAll = %d, want %d", c, tt.wantCount)
+			}
+			if e := m.MatchExists(data); e != (tt.wantCount > 0) {
+				t.Errorf("MatchExists = %v, want %v", e, tt.wantCount > 0)
+			}
+		})
+	}
+}
+
+func TestRangeMatcher_Zero(t *testing.T) {
+	inner := NewBoyerMooreMatcher("foo", false, false)
+	if m := NewRangeMatcher(inner, Range{}, true); m != Matcher(inner) {
+		t.Error("expected inner matcher for zero range")
+	}
+}
+
+func TestRangeMatcher_FindFirst(t *testing.T) {
+	data := []byte("foo 1\nbar 2\nfoo 3\n")
+	m := NewRangeMatcher(NewBoyerMooreMatcher("foo", false, false), Range{FromLine: 2}, true)
+	ms := FindFirst(m, data)
+	if len(ms.Matches) != 1 || ms.Matches[0].LineNum != 3 {
+		t.Fatalf("got %+v, want line 3", ms.Matches)
+	}
+	if got := string(ms.LineBytes(0)); got != "foo 3" {
+		t.Errorf("line = %q, want %q", got, "foo 3")
+	}
+}
+
+func TestRangeMatcher_Context(t *testing.T) {
+	data := []byte("a\nfoo\nb\nc\nfoo\nd\n")
+	inner, _ := NewRegexMatcher("foo", false, false)
+	m := NewRangeMatcher(NewContextMatcher(inner, 1, 0), Range{FromLine: 4}, true)
+	ms := m.FindAll(data)
+	if len(ms.Matches) != 2 {
+		t.Fatalf("got %d matches, want 2", len(ms.Matches))
+	}
+	if ms.Matches[0].LineNum != 4 || !ms.Matches[0].IsContext {
+		t.Errorf("match[0] = %+v, want context line 4", ms.Matches[0])
+	}
+	if ms.Matches[1].LineNum != 5 || ms.Matches[1].IsContext {
+		t.Errorf("match[1] = %+v, want match line 5", ms.Matches[1])
+	}
+}
@@ -18,6 +18,7 @@ type RegexMatcher struct {
 	needLineNums bool
 	prefilter    []byte // extracted literal for SIMD prefilter (nil = no prefilter)
 	prefilterCI  bool   // use case-insensitive SIMD scan
+	multiline    bool   // matches may span lines (-U); see newMultilineMatcher
 }
 
 // NewRegexMatcher creates a RegexMatcher for the given pattern.
@@ -25,7 +26,9 @@ func NewRegexMatcher(pattern string, ignoreCase bool, invert bool) (*RegexMatche
 	if ignoreCase {
 		pattern = "(?i)" + pattern
 	}
-	re, err := regexp.Compile(pattern)
+	// Buffers are searched whole, so ^ and $ must match at every line's
+	// edges, as they do when a line is matched alone.
+	re, err := regexp.Compile("(?m)" + pattern)
 	if err != nil {
 		return nil, err
 	}
@@ -50,11 +53,29 @@ func (m *RegexMatcher) hasPrefilter() bool {
 
 func (m *RegexMatcher) MatchExists(data []byte) bool {
 	if m.invert {
-		return len(data) > 0
+		return existsInvert(data, func(line []byte) bool {
+			return !m.re.Match(line)
+		})
+	}
+
+	_, _, ok := m.firstLine(data)
+	return ok
+}
+
+func (m *RegexMatcher) firstLine(data []byte) (int, int, bool) {
+	if m.invert {
+		return firstInvertLine(data, func(line []byte) bool {
+			return !m.re.Match(line)
+		})
 	}
 
 	if !m.hasPrefilter() {
-		return m.re.Match(data)
+		loc := m.re.FindIndex(data)
+		if loc == nil || pastLastLine(data, loc[0]) {
+			return 0, 0, false
+		}
+		start, end := lineBounds(data, loc[0])
+		return start, end, true
 	}
 
 	// SIMD scan for literal candidates one at a time, verify with regex.
@@ -67,34 +88,23 @@ func (m *RegexMatcher) MatchExists(data []byte) bool {
 			idx = simd.Index(data[off:], m.prefilter)
 		}
 		if idx < 0 {
-			return false
+			return 0, 0, false
 		}
 
-		absOff := off + idx
-
 		// Find containing line boundaries.
-		lineStart := 0
-		if absOff > 0 {
-			if i := bytes.LastIndexByte(data[:absOff], '\n'); i >= 0 {
-				lineStart = i + 1
-			}
-		}
-		lineEnd := len(data)
-		if i := bytes.IndexByte(data[absOff:], '\n'); i >= 0 {
-			lineEnd = absOff + i
-		}
+		lineStart, lineEnd := lineBounds(data, off+idx)
 
 		if m.re.Match(data[lineStart:lineEnd]) {
-			return true
+			return lineStart, lineEnd, true
 		}
 
 		// Advance past this line.
 		if lineEnd >= len(data) {
-			return false
+			return 0, 0, false
 		}
 		off = lineEnd + 1
 	}
-	return false
+	return 0, 0, false
 }
 
 func (m *RegexMatcher) CountAll(data []byte) int {
@@ -104,6 +114,9 @@ func (m *RegexMatcher) CountAll(data []byte) int {
 		})
 	}
 
+	if m.multiline {
+		return countSpanLines(data, toLocs2(m.re.FindAllIndex(data, -1)))
+	}
 	if !m.hasPrefilter() {
 		return countLocsUniqueLines(data, toLocs2(m.re.FindAllIndex(data, -1)))
 	}
@@ -149,24 +162,36 @@ func (m *RegexMatcher) CountAll(data []byte) int {
 }
 
 func (m *RegexMatcher) FindAll(data []byte) MatchSet {
+	return m.findAllArena(data, nil)
+}
+
+func (m *RegexMatcher) findAllArena(data []byte, a *Arena) MatchSet {
 	if m.invert {
 		return m.findAllInvert(data)
 	}
 
-	if !m.hasPrefilter() {
-		locs := toLocs2(m.re.FindAllIndex(data, -1))
-		if len(locs) == 0 {
-			return MatchSet{}
-		}
-		return matchSetFromLocs(data, locs, m.maxCols, m.needLineNums)
+	locs := m.searchLocs(data)
+	if len(locs) == 0 {
+		return MatchSet{}
 	}
+	if m.multiline {
+		return spanMatchSet(data, locs, m.needLineNums)
+	}
+	return matchSetFromLocsIn(data, locs, m.maxCols, m.needLineNums, a)
+}
 
-	return m.findAllPrefiltered(data)
+// searchLocs returns the buffer-absolute locations of every match in data,
+// in order, ignoring invert.
+func (m *RegexMatcher) searchLocs(data []byte) [][2]int {
+	if !m.hasPrefilter() {
+		return toLocs2(m.re.FindAllIndex(data, -1))
+	}
+	return m.prefilteredLocs(data)
 }
 
-// findAllPrefiltered scans the buffer with SIMD for literal candidates,
+// prefilteredLocs scans the buffer with SIMD for literal candidates,
 // extracts candidate lines, runs the regex on each, and collects results.
-func (m *RegexMatcher) findAllPrefiltered(data []byte) MatchSet {
+func (m *RegexMatcher) prefilteredLocs(data []byte) [][2]int {
 	// Step 1: SIMD scan for all literal occurrences.
 	var offsets []int
 	if m.prefilterCI {
@@ -175,7 +200,7 @@ func (m *RegexMatcher) findAllPrefiltered(data []byte) MatchSet {
 		offsets = simd.IndexAll(data, m.prefilter)
 	}
 	if len(offsets) == 0 {
-		return MatchSet{}
+		return nil
 	}
 
 	// Step 2: Convert offsets to candidate lines, deduplicated.
@@ -212,49 +237,17 @@ func (m *RegexMatcher) findAllPrefiltered(data []byte) MatchSet {
 		}
 	}
 
-	if len(allLocs) == 0 {
-		return MatchSet{}
-	}
-
-	return matchSetFromLocs(data, allLocs, m.maxCols, m.needLineNums)
+	return allLocs
 }
 
 func (m *RegexMatcher) findAllInvert(data []byte) MatchSet {
-	ms := MatchSet{Data: data}
-	var offset int64
-	lineNum := 1
-	remaining := data
-
-	for len(remaining) > 0 {
-		idx := bytes.IndexByte(remaining, '\n')
-		var lineLen int
-		if idx >= 0 {
-			lineLen = idx
-		} else {
-			lineLen = len(remaining)
-		}
-		lineStart := int(offset)
-		line := remaining[:lineLen]
-
-		if !m.re.Match(line) {
-			ms.Matches = append(ms.Matches, Match{
-				LineNum:    lineNum,
-				LineStart:  lineStart,
-				LineLen:    lineLen,
-				ByteOffset: offset,
-			})
-		}
-
-		if idx >= 0 {
-			remaining = remaining[idx+1:]
-		} else {
-			remaining = nil
-		}
-		offset += int64(lineLen) + 1
-		lineNum++
-	}
+	return invertMatchSet(data, func(line []byte) bool {
+		return !m.re.Match(line)
+	})
+}
 
-	return ms
+func (m *RegexMatcher) scanPositions(line []byte) [][2]int {
+	return toLocs2(m.re.FindAllIndex(line, -1))
 }
 
 func (m *RegexMatcher) FindLine(line []byte, lineNum int, byteOffset int64) (MatchSet, bool) {
@@ -0,0 +1,198 @@
+package matcher
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Replacer expands a replacement template for each match, as --replace
+// prints it in place of the matched text. The template is copied as is
+// except for group references: $N or ${N} for group N, $0 being the whole
+// match; $name or ${name} for a named group; and $$ for a literal $. As
+// in regexp.Expand, $name takes the longest run of letters, digits and
+// underscores, so ${1}x puts x after group 1. A group that took no part
+// in the match, or that the pattern does not have, expands to nothing.
+// With several patterns, groups are numbered across them in order, as if
+// the patterns were joined with |.
+type Replacer struct {
+	pieces []replacePiece
+	sub    submatcher // nil when the template needs no group but $0
+}
+
+// replacePiece is a literal run of a template or, if ref is set, a group
+// reference, resolved to the groups it may name.
+type replacePiece struct {
+	lit    string
+	ref    bool
+	groups []int // for a name used by several groups, each in order
+}
+
+// submatcher finds the matches in a line together with their groups.
+// RegexMatcher and PCREMatcher implement it.
+type submatcher interface {
+	// submatches returns every match in line with its groups' offsets,
+	// as regexp.FindAllSubmatchIndex does.
+	submatches(line []byte) [][]int
+	// groupIndexes returns the numbers of the groups called name.
+	groupIndexes(name string) []int
+}
+
+// NewReplacer parses template for matches of patterns, built with the same
+// arguments as NewMatcher (without invert, and with MatcherOpts.LineRegexp
+// as lineRegexp). Fixed strings have no groups but $0.
+func NewReplacer(template string, patterns []string, fixed bool, usePCRE bool, ignoreCase bool, dialect Dialect, lineRegexp bool) (*Replacer, error) {
+	refs := parseTemplate(template)
+	r := &Replacer{}
+	needGroups := false
+	for _, ref := range refs {
+		if ref.ref && ref.name != "0" {
+			needGroups = true
+		}
+	}
+	if needGroups {
+		pattern, usePCRE, ok, err := groupPattern(patterns, fixed, usePCRE, dialect, lineRegexp)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			if usePCRE {
+				m, err := NewPCREMatcher(pattern, ignoreCase, false)
+				if err != nil {
+					return nil, err
+				}
+				r.sub = m
+			} else {
+				m, err := NewRegexMatcher(pattern, ignoreCase, false)
+				if err != nil {
+					return nil, err
+				}
+				r.sub = m
+			}
+		}
+	}
+	for _, ref := range refs {
+		p := replacePiece{lit: ref.lit, ref: ref.ref}
+		if ref.ref {
+			if n, err := strconv.Atoi(ref.name); err == nil {
+				p.groups = []int{n}
+			} else if r.sub != nil {
+				p.groups = r.sub.groupIndexes(ref.name)
+			}
+		}
+		r.pieces = append(r.pieces, p)
+	}
+	return r, nil
+}
+
+// templateRef is a parsed piece of a template: a literal, or a reference
+// to the group name, which may be a number.
+type templateRef struct {
+	lit  string
+	ref  bool
+	name string
+}
+
+// parseTemplate splits template into literals and group references. A $
+// not followed by a valid reference is kept literally.
+func parseTemplate(template string) []templateRef {
+	var refs []templateRef
+	var lit strings.Builder
+	flush := func() {
+		if lit.Len() > 0 {
+			refs = append(refs, templateRef{lit: lit.String()})
+			lit.Reset()
+		}
+	}
+	for i := 0; i < len(template); i++ {
+		c := template[i]
+		if c != '$' || i+1 == len(template) {
+			lit.WriteByte(c)
+			continue
+		}
+		if template[i+1] == '$' {
+			lit.WriteByte('$')
+			i++
+			continue
+		}
+		name, n := groupName(template[i+1:])
+		if n == 0 {
+			lit.WriteByte('$')
+			continue
+		}
+		flush()
+		refs = append(refs, templateRef{ref: true, name: name})
+		i += n
+	}
+	flush()
+	return refs
+}
+
+// groupName reads the group name at the start of s, just after a $: a
+// braced name, or the longest run of name characters. It returns the name
+// and the bytes it took, 0 if there is none.
+func groupName(s string) (string, int) {
+	braced := s[0] == '{'
+	if braced {
+		s = s[1:]
+	}
+	n := 0
+	for n < len(s) && isNameByte(s[n]) {
+		n++
+	}
+	if n == 0 {
+		return "", 0
+	}
+	if braced {
+		if n == len(s) || s[n] != '}' {
+			return "", 0
+		}
+		return s[:n], n + 2
+	}
+	return s[:n], n
+}
+
+func isNameByte(c byte) bool {
+	return c == '_' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// Submatches returns every match in line with the offsets of its groups,
+// as regexp.FindAllSubmatchIndex does, or nil when the template needs no
+// groups; Expand then takes just the match's bounds.
+func (r *Replacer) Submatches(line []byte) [][]int {
+	if r.sub == nil {
+		return nil
+	}
+	return r.sub.submatches(line)
+}
+
+// Expand appends to dst the template expanded for one match in line. loc
+// holds the match's offsets in line, from Submatches, or just its bounds.
+func (r *Replacer) Expand(dst []byte, line []byte, loc []int) []byte {
+	for _, p := range r.pieces {
+		if !p.ref {
+			dst = append(dst, p.lit...)
+			continue
+		}
+		for _, g := range p.groups {
+			if 2*g+1 < len(loc) && loc[2*g] >= 0 {
+				dst = append(dst, line[loc[2*g]:loc[2*g+1]]...)
+				break
+			}
+		}
+	}
+	return dst
+}
+
+func (m *RegexMatcher) submatches(line []byte) [][]int {
+	return m.re.FindAllSubmatchIndex(line, -1)
+}
+
+func (m *RegexMatcher) groupIndexes(name string) []int {
+	var groups []int
+	for i, n := range m.re.SubexpNames() {
+		if n == name {
+			groups = append(groups, i)
+		}
+	}
+	return groups
+}
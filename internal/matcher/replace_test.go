@@ -0,0 +1,93 @@
+package matcher
+
+import (
+	"os"
+	"testing"
+)
+
+func TestReplacer(t *testing.T) {
+	line := []byte("user=alice id=42")
+	for _, tc := range []struct {
+		name     string
+		template string
+		patterns []string
+		pcre     bool
+		dialect  Dialect
+		want     []string // one per match
+	}{
+		{"whole match", "<$0:$1>", []string{`(\d+)`}, false, DialectDefault, []string{"<42:42>"}},
+		{"numbered", "$2:$1", []string{`(\w+)=(\w+)`}, false, DialectDefault, []string{"alice:user", "42:id"}},
+		{"braced", "${1}_x", []string{`(\w+)=`}, false, DialectDefault, []string{"user_x", "id_x"}},
+		{"longest name", "$1_x", []string{`(\w+)=`}, false, DialectDefault, []string{"", ""}},
+		{"named", "${v}@$k", []string{`(?P<k>\w+)=(?P<v>\w+)`}, false, DialectDefault, []string{"alice@user", "42@id"}},
+		{"literal dollar", "$$1 $ ${x $1", []string{`(\d+)`}, false, DialectDefault, []string{"$1 $ ${x 42"}},
+		{"missing group", "[$3]", []string{`(\d+)`}, false, DialectDefault, []string{"[]"}},
+		{"several patterns", "$1|$2", []string{`(alice)`, `(\d+)`}, false, DialectDefault, []string{"alice|", "|42"}},
+		{"shared name", "$n", []string{`(?P<n>alice)`, `(?P<n>\d+)`}, false, DialectDefault, []string{"alice", "42"}},
+		{"basic", `\1`, []string{`\([0-9]*\)`}, false, DialectBasic, nil},
+		{"basic group", "$1", []string{`id=\([0-9]*\)`}, false, DialectBasic, []string{"42"}},
+		{"pcre", "${v}", []string{`(?<v>\d+)`}, true, DialectDefault, []string{"42"}},
+	} {
+		if tc.pcre && os.Getenv("GOGREP_SKIP_PCRE") == "1" {
+			continue
+		}
+		r, err := NewReplacer(tc.template, tc.patterns, false, tc.pcre, false, tc.dialect, false)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		locs := r.Submatches(line)
+		if tc.want == nil {
+			continue
+		}
+		if len(locs) != len(tc.want) {
+			t.Errorf("%s: %d matches, want %d", tc.name, len(locs), len(tc.want))
+			continue
+		}
+		for i, loc := range locs {
+			if got := string(r.Expand(nil, line, loc)); got != tc.want[i] {
+				t.Errorf("%s: match %d = %q, want %q", tc.name, i, got, tc.want[i])
+			}
+		}
+	}
+}
+
+func TestReplacer_NoGroups(t *testing.T) {
+	// Templates without group references, and fixed strings, need no
+	// second match: Expand takes the bounds of the span alone.
+	for _, tc := range []struct {
+		template string
+		fixed    bool
+	}{
+		{"<$0>", false},
+		{"<$0$1>", true},
+	} {
+		r, err := NewReplacer(tc.template, []string{`a(b)`}, tc.fixed, false, false, DialectDefault, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		line := []byte("xa(b)y")
+		if locs := r.Submatches(line); locs != nil {
+			t.Errorf("%q: Submatches = %v, want nil", tc.template, locs)
+		}
+		if got := string(r.Expand(nil, line, []int{1, 5})); got != "<a(b)>" {
+			t.Errorf("%q: Expand = %q", tc.template, got)
+		}
+	}
+}
+
+func TestReplacer_LineRegexp(t *testing.T) {
+	// With -x the groups come from the match of the whole line, not from
+	// the leftmost match inside it.
+	r, err := NewReplacer("<$1>", []string{`(a|ab)`}, false, false, false, DialectDefault, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := []byte("ab")
+	locs := r.Submatches(line)
+	if len(locs) != 1 {
+		t.Fatalf("Submatches = %v, want one match", locs)
+	}
+	if got := string(r.Expand(nil, line, locs[0])); got != "<ab>" {
+		t.Errorf("Expand = %q, want %q", got, "<ab>")
+	}
+}
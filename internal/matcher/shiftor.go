@@ -0,0 +1,256 @@
+package matcher
+
+import "bytes"
+
+// shiftOrMaxLen is the longest pattern ShiftOrMatcher accepts: the state
+// for every pattern prefix must fit in one machine word.
+const shiftOrMaxLen = 64
+
+// ShiftOrMatcher matches one short fixed pattern with the bit-parallel
+// Shift-Or algorithm. Each input byte costs one table load, a shift and an
+// or, with no candidate verification, so throughput does not degrade when
+// the pattern's bytes are common in the data.
+type ShiftOrMatcher struct {
+	masks        [256]uint64 // bit i clear where pattern[i] may equal the byte
+	hit          uint64      // bit of the last pattern position
+	plen         int
+	invert       bool
+	maxCols      int
+	needLineNums bool
+}
+
+// NewShiftOrMatcher creates a ShiftOrMatcher. pattern must be 1 to
+// shiftOrMaxLen bytes long. With ignoreCase, ASCII letters match either case.
+func NewShiftOrMatcher(pattern string, ignoreCase bool, invert bool) *ShiftOrMatcher {
+	m := &ShiftOrMatcher{
+		plen:   len(pattern),
+		hit:    1 << (len(pattern) - 1),
+		invert: invert,
+	}
+	for i := range m.masks {
+		m.masks[i] = ^uint64(0)
+	}
+	for i := 0; i < len(pattern); i++ {
+		b := pattern[i]
+		bit := uint64(1) << i
+		m.masks[b] &^= bit
+		if ignoreCase {
+			m.masks[toLower(b)] &^= bit
+			m.masks[toUpper(b)] &^= bit
+		}
+	}
+	return m
+}
+
+// index returns the offset of the first occurrence in data, or -1.
+func (m *ShiftOrMatcher) index(data []byte) int {
+	d := ^uint64(0)
+	for i, b := range data {
+		d = d<<1 | m.masks[b]
+		if d&m.hit == 0 {
+			return i - m.plen + 1
+		}
+	}
+	return -1
+}
+
+// indexAll returns the offsets of all non-overlapping occurrences in data.
+func (m *ShiftOrMatcher) indexAll(data []byte) []int {
+	var offsets []int
+	d := ^uint64(0)
+	for i, b := range data {
+		d = d<<1 | m.masks[b]
+		if d&m.hit == 0 {
+			offsets = append(offsets, i-m.plen+1)
+			d = ^uint64(0) // restart so matches do not overlap
+		}
+	}
+	return offsets
+}
+
+func (m *ShiftOrMatcher) noMatch(line []byte) bool {
+	return m.index(line) < 0
+}
+
+func (m *ShiftOrMatcher) MatchExists(data []byte) bool {
+	if m.invert {
+		return existsInvert(data, m.noMatch)
+	}
+	return m.index(data) >= 0
+}
+
+func (m *ShiftOrMatcher) CountAll(data []byte) int {
+	if m.invert {
+		return countInvert(data, m.noMatch)
+	}
+	return countUniqueLines(data, m.indexAll(data))
+}
+
+func (m *ShiftOrMatcher) FindAll(data []byte) MatchSet {
+	return m.findAllArena(data, nil)
+}
+
+func (m *ShiftOrMatcher) findAllArena(data []byte, a *Arena) MatchSet {
+	if m.invert {
+		return m.findAllInvert(data)
+	}
+	return matchSetFromOffsetsIn(data, m.indexAll(data), m.plen, m.maxCols, m.needLineNums, a)
+}
+
+func (m *ShiftOrMatcher) findAllInvert(data []byte) MatchSet {
+	ms := MatchSet{Data: data}
+	var offset int64
+	lineNum := 1
+	remaining := data
+
+	for len(remaining) > 0 {
+		idx := bytes.IndexByte(remaining, '\n')
+		lineLen := len(remaining)
+		if idx >= 0 {
+			lineLen = idx
+		}
+		if m.noMatch(remaining[:lineLen]) {
+			ms.Matches = append(ms.Matches, Match{
+				LineNum:    lineNum,
+				LineStart:  int(offset),
+				LineLen:    lineLen,
+				ByteOffset: offset,
+			})
+		}
+
+		if idx >= 0 {
+			remaining = remaining[idx+1:]
+		} else {
+			remaining = nil
+		}
+		offset += int64(lineLen) + 1
+		lineNum++
+	}
+
+	return ms
+}
+
+func (m *ShiftOrMatcher) firstLine(data []byte) (int, int, bool) {
+	if m.invert {
+		return firstInvertLine(data, m.noMatch)
+	}
+	off := m.index(data)
+	if off < 0 {
+		return 0, 0, false
+	}
+	start, end := lineBounds(data, off)
+	return start, end, true
+}
+
+func (m *ShiftOrMatcher) scanPositions(line []byte) [][2]int {
+	offsets := m.indexAll(line)
+	if len(offsets) == 0 {
+		return nil
+	}
+	positions := make([][2]int, len(offsets))
+	for i, off := range offsets {
+		positions[i] = [2]int{off, off + m.plen}
+	}
+	return positions
+}
+
+func (m *ShiftOrMatcher) FindLine(line []byte, lineNum int, byteOffset int64) (MatchSet, bool) {
+	positions := m.scanPositions(line)
+	hasMatch := len(positions) > 0
+
+	if m.invert {
+		hasMatch = !hasMatch
+	}
+
+	if !hasMatch {
+		return MatchSet{}, false
+	}
+
+	ms := MatchSet{Data: line}
+	match := Match{
+		LineNum:    lineNum,
+		LineStart:  0,
+		LineLen:    len(line),
+		ByteOffset: byteOffset,
+	}
+	if !m.invert {
+		match.PosCount = len(positions)
+		ms.Positions = positions
+	}
+	ms.Matches = []Match{match}
+
+	return ms, true
+}
+
+// Density probe parameters for shortPatternMatcher, from
+// BenchmarkShortPatternCrossover. SIMD search is 4-10x faster than Shift-Or
+// on sparse data, but once occurrences are closer than about
+// shiftOrDenseGap bytes apart, the per-call overhead of repeated bytes.Index
+// makes Shift-Or's single pass ~20% faster.
+const (
+	shiftOrMaxAuto  = 8        // longest pattern considered for Shift-Or
+	shiftOrDenseGap = 4        // default denseGap
+	shiftOrProbe    = 4 << 10  // bytes sampled to estimate density
+	shiftOrMinData  = 64 << 10 // smaller inputs are not worth probing
+)
+
+// denseGap is the mean bytes between occurrences, beyond the pattern, below
+// which Shift-Or is used. Set from --calibrate results via SetDenseGap.
+var denseGap = shiftOrDenseGap
+
+// SetDenseGap sets the occurrence gap below which a single short pattern is
+// searched with Shift-Or rather than SIMD; n <= 0 restores the default.
+// Call before searching.
+func SetDenseGap(n int) {
+	if n <= 0 {
+		n = shiftOrDenseGap
+	}
+	denseGap = n
+}
+
+// shortPatternMatcher picks between SIMD search and Shift-Or per input for
+// a single short pattern. Density cannot be known when the matcher is built,
+// so FindAll and CountAll probe a prefix of the data first. Everything that
+// stops at the first occurrence stays on the SIMD path.
+type shortPatternMatcher struct {
+	*BoyerMooreMatcher
+	so *ShiftOrMatcher
+}
+
+func newShortPatternMatcher(pattern string, ignoreCase bool, invert bool, opts MatcherOpts) *shortPatternMatcher {
+	m := &shortPatternMatcher{
+		BoyerMooreMatcher: NewBoyerMooreMatcher(pattern, ignoreCase, invert),
+		so:                NewShiftOrMatcher(pattern, ignoreCase, invert),
+	}
+	m.maxCols, m.so.maxCols = opts.MaxCols, opts.MaxCols
+	m.needLineNums, m.so.needLineNums = opts.NeedLineNums, opts.NeedLineNums
+	return m
+}
+
+// dense reports whether occurrences in data are packed tightly enough for
+// Shift-Or to win, judging by the first shiftOrProbe bytes.
+func (m *shortPatternMatcher) dense(data []byte) bool {
+	if m.invert || len(data) < shiftOrMinData {
+		return false
+	}
+	n := len(m.so.indexAll(data[:shiftOrProbe]))
+	return n > 0 && shiftOrProbe/n < m.so.plen+denseGap
+}
+
+func (m *shortPatternMatcher) FindAll(data []byte) MatchSet {
+	return m.findAllArena(data, nil)
+}
+
+func (m *shortPatternMatcher) findAllArena(data []byte, a *Arena) MatchSet {
+	if m.dense(data) {
+		return m.so.findAllArena(data, a)
+	}
+	return m.BoyerMooreMatcher.findAllArena(data, a)
+}
+
+func (m *shortPatternMatcher) CountAll(data []byte) int {
+	if m.dense(data) {
+		return m.so.CountAll(data)
+	}
+	return m.BoyerMooreMatcher.CountAll(data)
+}
@@ -0,0 +1,139 @@
+package matcher
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestShiftOrMatcher_MatchesBoyerMoore(t *testing.T) {
+	inputs := []string{
+		"the cat sat\non the mat\n",
+		"aaaa\naa\na\n",
+		"THE CAT\nThe Cat\nno\n",
+		"catcatcat",
+		"",
+		"\n\n",
+	}
+	for _, pattern := range []string{"at", "cat", "a", "aa", "the ca"} {
+		for _, ignoreCase := range []bool{false, true} {
+			for _, invert := range []bool{false, true} {
+				so := NewShiftOrMatcher(pattern, ignoreCase, invert)
+				so.needLineNums = true
+				bm := NewBoyerMooreMatcher(pattern, ignoreCase, invert)
+				bm.needLineNums = true
+				for _, in := range inputs {
+					data := []byte(in)
+					name := fmt.Sprintf("%q i=%v v=%v %q", pattern, ignoreCase, invert, in)
+
+					got, want := so.FindAll(data), bm.FindAll(data)
+					if len(got.Matches) != len(want.Matches) {
+						t.Errorf("%s: FindAll %d matches, want %d", name, len(got.Matches), len(want.Matches))
+						continue
+					}
+					for i := range got.Matches {
+						g, w := got.Matches[i], want.Matches[i]
+						if g.LineNum != w.LineNum || !bytes.Equal(got.LineBytes(i), want.LineBytes(i)) {
+							t.Errorf("%s: match %d = line %d %q, want line %d %q", name, i, g.LineNum, got.LineBytes(i), w.LineNum, want.LineBytes(i))
+						}
+						if fmt.Sprint(got.MatchPositions(i)) != fmt.Sprint(want.MatchPositions(i)) {
+							t.Errorf("%s: match %d positions %v, want %v", name, i, got.MatchPositions(i), want.MatchPositions(i))
+						}
+					}
+					if g, w := so.CountAll(data), bm.CountAll(data); g != w {
+						t.Errorf("%s: CountAll = %d, want %d", name, g, w)
+					}
+					if g, w := so.MatchExists(data), bm.MatchExists(data); g != w {
+						t.Errorf("%s: MatchExists = %v, want %v", name, g, w)
+					}
+				}
+			}
+		}
+	}
+}
+func TestShortPatternMatcher_Dense(t *testing.T) {
+	opts := MatcherOpts{NeedLineNums: true}
+	for _, tt := range []struct {
+		name      string
+		data      []byte
+		wantDense bool
+	}{
+		{"dense", bytes.Repeat([]byte("ab ab ab ab ab\n"), 10000), true},
+		{"sparse", bytes.Repeat([]byte("the quick brown fox ab\n"), 10000), false},
+		{"small", []byte("ab ab ab\n"), false},
+	} {
+		m := newShortPatternMatcher("ab", false, false, opts)
+		if got := m.dense(tt.data); got != tt.wantDense {
+			t.Errorf("%s: dense = %v, want %v", tt.name, got, tt.wantDense)
+		}
+		bm := NewBoyerMooreMatcher("ab", false, false)
+		bm.needLineNums = true
+		got, want := m.FindAll(tt.data), bm.FindAll(tt.data)
+		if len(got.Matches) != len(want.Matches) || len(got.Positions) != len(want.Positions) {
+			t.Errorf("%s: FindAll %d/%d, want %d/%d", tt.name, len(got.Matches), len(got.Positions), len(want.Matches), len(want.Positions))
+		} else if last := len(got.Matches) - 1; got.Matches[last] != want.Matches[last] {
+			t.Errorf("%s: last match %+v, want %+v", tt.name, got.Matches[last], want.Matches[last])
+		}
+		if g, w := m.CountAll(tt.data), bm.CountAll(tt.data); g != w {
+			t.Errorf("%s: CountAll = %d, want %d", tt.name, g, w)
+		}
+	}
+}
+
+// BenchmarkShortPatternCrossover compares Shift-Or with the SIMD
+// Boyer-Moore path for short patterns on sparse and dense data. The
+// selection rule in selectFixedEngine comes from this benchmark.
+func BenchmarkShortPatternCrossover(b *testing.B) {
+	sparse := bytes.Repeat([]byte("the quick brown fox jumps over the lazy dog\n"), 20000)
+	// Near: every byte is a candidate for the pattern's first byte.
+	near := bytes.Repeat([]byte(strings.Repeat("aaaaaaab", 6)+"\n"), 20000)
+
+	for _, plen := range []int{2, 4, 8} {
+		pattern := strings.Repeat("a", plen-1) + "c"
+		// Dense: an occurrence every plen+gap bytes.
+		dense := map[int][]byte{}
+		for _, gap := range []int{1, 4, 16} {
+			dense[gap] = bytes.Repeat([]byte(strings.Repeat(pattern+strings.Repeat(" ", gap), 48/(plen+gap)+1)+"\n"), 20000)
+		}
+		for _, data := range []struct {
+			name string
+			buf  []byte
+		}{{"sparse", sparse}, {"near", near}, {"gap1", dense[1]}, {"gap4", dense[4]}, {"gap16", dense[16]}} {
+			engines := []struct {
+				name string
+				m    Matcher
+			}{
+				{"bm", NewBoyerMooreMatcher(pattern, false, false)},
+				{"shiftor", NewShiftOrMatcher(pattern, false, false)},
+				{"bm-i", NewBoyerMooreMatcher(pattern, true, false)},
+				{"shiftor-i", NewShiftOrMatcher(pattern, true, false)},
+				{"auto", newShortPatternMatcher(pattern, false, false, MatcherOpts{})},
+			}
+			for _, e := range engines {
+				b.Run(fmt.Sprintf("len=%d/%s/%s", plen, data.name, e.name), func(b *testing.B) {
+					b.SetBytes(int64(len(data.buf)))
+					for b.Loop() {
+						e.m.FindAll(data.buf)
+					}
+				})
+			}
+		}
+	}
+}
+
+// An empty fixed pattern, as from -F -e "", matches every line and never
+// reaches Shift-Or.
+func TestFixedEmptyPattern(t *testing.T) {
+	m, err := NewMatcher([]string{""}, true, false, false, false, MatcherOpts{NeedLineNums: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms := m.FindAll([]byte("a\n\nbc\n"))
+	if len(ms.Matches) != 3 || ms.Matches[2].LineNum != 3 {
+		t.Errorf("matches = %+v, want one per line", ms.Matches)
+	}
+	if n := m.CountAll([]byte("a\nb\n")); n != 2 {
+		t.Errorf("CountAll = %d, want 2", n)
+	}
+}
@@ -0,0 +1,142 @@
+package matcher
+
+import "fmt"
+
+// Capture is a named group captured by a match. Start and End are offsets
+// in the searched line; both are -1 when the group took no part in the
+// match, as in an untaken alternative.
+type Capture struct {
+	Name       string
+	Start, End int
+}
+
+// Submatcher reports the named groups of a pattern. RegexMatcher and
+// PCREMatcher implement it.
+type Submatcher interface {
+	// Captures returns the named groups of the first match in line, in
+	// pattern order, or nil if line does not match.
+	Captures(line []byte) []Capture
+}
+
+// NewSubmatcher returns a Submatcher for patterns, built with the same
+// arguments as NewMatcher (without invert, and with MatcherOpts.LineRegexp
+// as lineRegexp), or nil if the patterns have no named groups. Fixed
+// strings have none.
+func NewSubmatcher(patterns []string, fixed bool, usePCRE bool, ignoreCase bool, dialect Dialect, lineRegexp bool) (Submatcher, error) {
+	pattern, usePCRE, ok, err := groupPattern(patterns, fixed, usePCRE, dialect, lineRegexp)
+	if !ok || err != nil {
+		return nil, err
+	}
+	if usePCRE {
+		if len(namedGroups(pattern)) == 0 {
+			return nil, nil
+		}
+		m, err := NewPCREMatcher(pattern, ignoreCase, false)
+		if err != nil {
+			return nil, err
+		}
+		return m, nil
+	}
+	m, err := NewRegexMatcher(pattern, ignoreCase, false)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range m.re.SubexpNames() {
+		if name != "" {
+			return m, nil
+		}
+	}
+	return nil, nil
+}
+
+// groupPattern returns the one pattern whose groups are those of patterns,
+// built with NewMatcher's arguments, and whether it is PCRE. ok is false
+// when there are no groups to find: fixed strings, or no patterns.
+func groupPattern(patterns []string, fixed bool, usePCRE bool, dialect Dialect, lineRegexp bool) (pattern string, pcre bool, ok bool, err error) {
+	switch dialect {
+	case DialectFixed:
+		return "", false, false, nil
+	case DialectPerl:
+		fixed, usePCRE = false, true
+	case DialectBasic:
+		translated := make([]string, len(patterns))
+		for i, p := range patterns {
+			t, err := translateBRE(p)
+			if err != nil {
+				return "", false, false, fmt.Errorf("basic regexp %q: %w", p, err)
+			}
+			translated[i] = t
+		}
+		patterns = translated
+		fixed, usePCRE = false, false
+	case DialectExtended:
+		fixed, usePCRE = false, false
+	}
+	if fixed || len(patterns) == 0 {
+		return "", false, false, nil
+	}
+	if lineRegexp {
+		patterns = anchorLines(patterns)
+	}
+	return alternation(patterns), usePCRE, true, nil
+}
+
+// Captures returns the named groups of the first match in line.
+func (m *RegexMatcher) Captures(line []byte) []Capture {
+	loc := m.re.FindSubmatchIndex(line)
+	if loc == nil {
+		return nil
+	}
+	var caps []Capture
+	for i, name := range m.re.SubexpNames() {
+		if name != "" {
+			caps = append(caps, Capture{Name: name, Start: loc[2*i], End: loc[2*i+1]})
+		}
+	}
+	return caps
+}
+
+// namedGroups returns the names of the named groups of a PCRE pattern in
+// the order they open: (?<name>...), (?'name'...) and (?P<name>...).
+// Escapes and character classes are skipped, so \( and [(] open nothing.
+func namedGroups(pattern string) []string {
+	var names []string
+	inClass := false
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case c == '\\':
+			i++
+		case inClass:
+			inClass = c != ']'
+		case c == '[':
+			inClass = true
+			// A ] right after [ or [^ is a literal member.
+			if i+1 < len(pattern) && pattern[i+1] == '^' {
+				i++
+			}
+			if i+1 < len(pattern) && pattern[i+1] == ']' {
+				i++
+			}
+		case c == '(' && i+2 < len(pattern) && pattern[i+1] == '?':
+			rest := pattern[i+2:]
+			var close byte
+			switch {
+			case len(rest) > 1 && rest[0] == 'P' && rest[1] == '<':
+				rest, close = rest[2:], '>'
+			case rest[0] == '<' && len(rest) > 1 && rest[1] != '=' && rest[1] != '!':
+				rest, close = rest[1:], '>'
+			case rest[0] == '\'':
+				rest, close = rest[1:], '\''
+			default:
+				continue
+			}
+			for j := 0; j < len(rest); j++ {
+				if rest[j] == close {
+					names = append(names, rest[:j])
+					break
+				}
+			}
+		}
+	}
+	return names
+}
@@ -0,0 +1,82 @@
+package matcher
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestNamedGroups(t *testing.T) {
+	for _, tc := range []struct {
+		pattern string
+		want    []string
+	}{
+		{`(?P<ip>\d+)`, []string{"ip"}},
+		{`(?<user>\w+)@(?'host'\S+)`, []string{"user", "host"}},
+		{`(?<=x)(?<!y)(?:z)(a)`, nil},
+		{`\(?<no>x\)`, nil},
+		{`[(?<no>)](?<yes>.)`, []string{"yes"}},
+		{`[]](?<a>.)[^]](?<b>.)`, []string{"a", "b"}},
+	} {
+		if got := namedGroups(tc.pattern); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("namedGroups(%q) = %q, want %q", tc.pattern, got, tc.want)
+		}
+	}
+}
+
+func TestNewSubmatcher(t *testing.T) {
+	line := []byte("GET /index.html 200 from 10.0.0.1")
+	text := func(caps []Capture) map[string]string {
+		out := make(map[string]string)
+		for _, c := range caps {
+			if c.Start < 0 {
+				out[c.Name] = "<unset>"
+			} else {
+				out[c.Name] = string(line[c.Start:c.End])
+			}
+		}
+		return out
+	}
+
+	for _, tc := range []struct {
+		name     string
+		patterns []string
+		pcre     bool
+		dialect  Dialect
+		want     map[string]string // nil = no Submatcher
+	}{
+		{"no named groups", []string{`(\d+) from`}, false, DialectDefault, nil},
+		{"fixed", []string{`(?P<x>a)`}, false, DialectFixed, nil},
+		{"regex", []string{`(?P<method>[A-Z]+) (?P<path>\S+) (?P<status>\d+)`}, false, DialectDefault,
+			map[string]string{"method": "GET", "path": "/index.html", "status": "200"}},
+		{"untaken group", []string{`from (?P<ip>[\d.]+)|to (?P<dest>\S+)`}, false, DialectDefault,
+			map[string]string{"ip": "10.0.0.1", "dest": "<unset>"}},
+		{"several patterns", []string{`nothing`, `(?P<status>\d{3})`}, false, DialectDefault,
+			map[string]string{"status": "200"}},
+		{"pcre", []string{`(?<ip>\d+\.\d+\.\d+\.\d+)`}, true, DialectDefault,
+			map[string]string{"ip": "10.0.0.1"}},
+	} {
+		if tc.pcre && os.Getenv("GOGREP_SKIP_PCRE") == "1" {
+			continue
+		}
+		sm, err := NewSubmatcher(tc.patterns, false, tc.pcre, false, tc.dialect, false)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if tc.want == nil {
+			if sm != nil {
+				t.Errorf("%s: got a Submatcher, want none", tc.name)
+			}
+			continue
+		}
+		if sm == nil {
+			t.Fatalf("%s: got no Submatcher", tc.name)
+		}
+		if got := text(sm.Captures(line)); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: captures = %v, want %v", tc.name, got, tc.want)
+		}
+		if caps := sm.Captures([]byte("no match here")); caps != nil {
+			t.Errorf("%s: captures on a non-matching line = %v", tc.name, caps)
+		}
+	}
+}
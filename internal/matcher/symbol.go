@@ -0,0 +1,130 @@
+package matcher
+
+import "bytes"
+
+// SymbolMatcher keeps only the matches of inner that stand as whole
+// identifiers: the bytes on either side of a match, if any, are not ASCII
+// letters, digits or '_'. That is the boundary of names in most code, where
+// \b would also treat non-ASCII letters as word bytes. The inner matcher
+// is built without invert, so a literal pattern is still found by the SIMD
+// fixed-string engines and only its hits are checked.
+//
+// Only the matches inner reports are checked: a regex that prefers a
+// shorter alternative, like foo|foobar on "foobar", does not try the longer
+// one after the shorter fails the boundary test.
+type SymbolMatcher struct {
+	inner  Matcher // not inverted; full lines when invert is set
+	invert bool
+}
+
+// NewSymbolMatcher wraps inner, which must not be inverted, to report only
+// identifier-bounded matches, or with invert the lines without one. With
+// invert, inner must report full lines (MaxCols 0).
+func NewSymbolMatcher(inner Matcher, invert bool) *SymbolMatcher {
+	return &SymbolMatcher{inner: inner, invert: invert}
+}
+
+// isSymbolByte reports whether c can be part of an identifier.
+func isSymbolByte(c byte) bool {
+	return c == '_' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// symbolBounded reports whether data[start:end] has no identifier byte
+// directly before or after it.
+func symbolBounded(data []byte, start, end int) bool {
+	if start > 0 && isSymbolByte(data[start-1]) {
+		return false
+	}
+	return end >= len(data) || !isSymbolByte(data[end])
+}
+
+// filter drops the positions of ms that are not identifier-bounded, and
+// the matches left without any. It works in place.
+func (m *SymbolMatcher) filter(ms MatchSet) MatchSet {
+	kept := ms.Matches[:0]
+	for _, mt := range ms.Matches {
+		n := 0
+		for _, p := range ms.Positions[mt.PosIdx : mt.PosIdx+mt.PosCount] {
+			if symbolBounded(ms.Data, mt.LineStart+p[0], mt.LineStart+p[1]) {
+				ms.Positions[mt.PosIdx+n] = p
+				n++
+			}
+		}
+		if n == 0 {
+			continue
+		}
+		mt.PosCount = n
+		kept = append(kept, mt)
+	}
+	ms.Matches = kept
+	return ms
+}
+
+func (m *SymbolMatcher) FindAll(data []byte) MatchSet {
+	ms := m.filter(m.inner.FindAll(data))
+	if !m.invert {
+		return ms
+	}
+
+	// The kept matches are whole lines in buffer order; select the others.
+	out := MatchSet{Data: data}
+	j := 0
+	lineNum := 1
+	for off := 0; off < len(data); lineNum++ {
+		end := len(data)
+		if i := bytes.IndexByte(data[off:], '\n'); i >= 0 {
+			end = off + i
+		}
+		for j < len(ms.Matches) && ms.Matches[j].LineStart < off {
+			j++
+		}
+		if j == len(ms.Matches) || ms.Matches[j].LineStart != off {
+			out.Matches = append(out.Matches, Match{
+				LineNum:    lineNum,
+				LineStart:  off,
+				LineLen:    end - off,
+				ByteOffset: int64(off),
+			})
+		}
+		off = end + 1
+	}
+	return out
+}
+
+func (m *SymbolMatcher) MatchExists(data []byte) bool {
+	if !m.invert && !m.inner.MatchExists(data) {
+		return false
+	}
+	ms := m.FindAll(data)
+	return ms.HasMatch()
+}
+
+func (m *SymbolMatcher) CountAll(data []byte) int {
+	if !m.invert && !m.inner.MatchExists(data) {
+		return 0
+	}
+	ms := m.FindAll(data)
+	return ms.Len()
+}
+
+func (m *SymbolMatcher) FindLine(line []byte, lineNum int, byteOffset int64) (MatchSet, bool) {
+	ms, ok := m.inner.FindLine(line, lineNum, byteOffset)
+	if ok {
+		ms = m.filter(ms)
+		ok = ms.HasMatch()
+	}
+	if !m.invert {
+		return ms, ok
+	}
+	if ok {
+		return MatchSet{}, false
+	}
+	return MatchSet{
+		Data: line,
+		Matches: []Match{{
+			LineNum:    lineNum,
+			LineLen:    len(line),
+			ByteOffset: byteOffset,
+		}},
+	}, true
+}
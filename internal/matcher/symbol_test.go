@@ -0,0 +1,71 @@
+package matcher
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSymbolMatcher(t *testing.T) {
+	data := []byte("foo()\nfoobar foo_1\nx.foo = foofoo\n2foo\nnone\nαfooβ")
+
+	tests := []struct {
+		name      string
+		patterns  []string
+		fixed     bool
+		invert    bool
+		wantLines []int
+		wantPos   [][2]int // of the first line
+	}{
+		{"literal", []string{"foo"}, false, false, []int{1, 3, 6}, [][2]int{{0, 3}}},
+		{"fixed", []string{"foo"}, true, false, []int{1, 3, 6}, [][2]int{{0, 3}}},
+		{"multi", []string{"foo", "foo_1"}, true, false, []int{1, 2, 3, 6}, [][2]int{{0, 3}}},
+		{"regex", []string{"f[o]+"}, false, false, []int{1, 3, 6}, [][2]int{{0, 3}}},
+		{"invert", []string{"foo"}, false, true, []int{2, 4, 5}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewMatcher(tt.patterns, tt.fixed, false, false, tt.invert, MatcherOpts{NeedLineNums: true, Symbol: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ms := m.FindAll(data)
+			var got []int
+			for _, mt := range ms.Matches {
+				got = append(got, mt.LineNum)
+			}
+			if !equalInts(got, tt.wantLines) {
+				t.Fatalf("lines = %v, want %v", got, tt.wantLines)
+			}
+			if pos := ms.MatchPositions(0); !slices.Equal(pos, tt.wantPos) {
+				t.Errorf("positions = %v, want %v", pos, tt.wantPos)
+			}
+			if c := m.CountAll(data); c != len(tt.wantLines) {
+				t.Errorf("CountAll = %d, want %d", c, len(tt.wantLines))
+			}
+			if !m.MatchExists(data) {
+				t.Error("MatchExists = false, want true")
+			}
+		})
+	}
+}
+
+func TestSymbolMatcher_Positions(t *testing.T) {
+	m, err := NewMatcher([]string{"foo"}, true, false, false, false, MatcherOpts{Symbol: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms, ok := m.FindLine([]byte("foofoo foo(foo)"), 1, 0)
+	if !ok {
+		t.Fatal("FindLine found nothing")
+	}
+	if got, want := ms.MatchPositions(0), [][2]int{{7, 10}, {11, 14}}; !slices.Equal(got, want) {
+		t.Errorf("positions = %v, want %v", got, want)
+	}
+	if m.MatchExists([]byte("foofoo\n_foo\n")) {
+		t.Error("MatchExists = true without a bounded match")
+	}
+	if _, ok := m.FindLine([]byte("foo_"), 1, 0); ok {
+		t.Error("FindLine matched inside an identifier")
+	}
+}
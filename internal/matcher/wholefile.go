@@ -0,0 +1,110 @@
+package matcher
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+)
+
+// WholeFileMatcher evaluates a regex against the whole buffer as a single
+// string instead of line by line, so a match may span lines: with (?s),
+// `TODO.*FIXME` finds files where FIXME follows TODO anywhere later. A
+// buffer either matches or not; -v selects buffers that do not.
+type WholeFileMatcher struct {
+	re     *regexp.Regexp
+	invert bool
+}
+
+// NewWholeFileMatcher creates a WholeFileMatcher. Several patterns match
+// if any of them does. Fixed patterns are quoted; DialectBasic patterns
+// are translated to RE2. PCRE is not supported.
+func NewWholeFileMatcher(patterns []string, fixed bool, ignoreCase bool, invert bool, dialect Dialect) (*WholeFileMatcher, error) {
+	if len(patterns) == 0 {
+		return nil, fmt.Errorf("no patterns provided")
+	}
+	if dialect == DialectPerl {
+		return nil, fmt.Errorf("whole-file matching does not support PCRE")
+	}
+	fixed = (fixed && dialect == DialectDefault) || dialect == DialectFixed
+
+	var b bytes.Buffer
+	if ignoreCase {
+		b.WriteString("(?i)")
+	}
+	for i, p := range patterns {
+		switch {
+		case fixed:
+			p = regexp.QuoteMeta(p)
+		case dialect == DialectBasic:
+			t, err := translateBRE(p)
+			if err != nil {
+				return nil, fmt.Errorf("basic regexp %q: %w", p, err)
+			}
+			p = t
+		}
+		if i > 0 {
+			b.WriteByte('|')
+		}
+		b.WriteString("(?:" + p + ")")
+	}
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return nil, err
+	}
+	return &WholeFileMatcher{re: re, invert: invert}, nil
+}
+
+func (m *WholeFileMatcher) MatchExists(data []byte) bool {
+	return m.re.Match(data) != m.invert
+}
+
+func (m *WholeFileMatcher) CountAll(data []byte) int {
+	if m.MatchExists(data) {
+		return 1
+	}
+	return 0
+}
+
+// FindAll reports a selected buffer as one match on the line where the
+// first match starts, highlighting the part of the match on that line.
+// With -v there is no match to point at, so the first line is reported.
+func (m *WholeFileMatcher) FindAll(data []byte) MatchSet {
+	if m.invert {
+		if m.re.Match(data) {
+			return MatchSet{}
+		}
+		end := len(data)
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			end = i
+		}
+		return MatchSet{Data: data, Matches: []Match{{LineNum: 1, LineLen: end}}}
+	}
+
+	loc := m.re.FindIndex(data)
+	if loc == nil {
+		return MatchSet{}
+	}
+	start, end := lineBounds(data, loc[0])
+	posEnd := min(loc[1], end)
+	return MatchSet{
+		Data: data,
+		Matches: []Match{{
+			LineNum:    1 + bytes.Count(data[:start], []byte{'\n'}),
+			LineStart:  start,
+			LineLen:    end - start,
+			ByteOffset: int64(start),
+			PosCount:   1,
+		}},
+		Positions: [][2]int{{loc[0] - start, posEnd - start}},
+	}
+}
+
+func (m *WholeFileMatcher) FindLine(line []byte, lineNum int, byteOffset int64) (MatchSet, bool) {
+	ms := m.FindAll(line)
+	if !ms.HasMatch() {
+		return MatchSet{}, false
+	}
+	ms.Matches[0].LineNum = lineNum
+	ms.Matches[0].ByteOffset = byteOffset
+	return ms, true
+}
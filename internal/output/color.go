@@ -1,10 +1,6 @@
 package output
 
-import (
-	"os"
-
-	"golang.org/x/sys/unix"
-)
+import "os"
 
 // ANSI escape sequences for coloring. Raw codes avoid the overhead of lipgloss.Render().
 var (
@@ -15,12 +11,6 @@ var (
 	ansiBoldRed   = []byte("\x1b[1;31m") // match highlight
 )
 
-// IsTerminal checks if the given file descriptor is a terminal using ioctl.
-func IsTerminal(fd uintptr) bool {
-	_, err := unix.IoctlGetTermios(int(fd), unix.TCGETS)
-	return err == nil
-}
-
 // StdoutIsTerminal returns true if stdout is a terminal.
 func StdoutIsTerminal() bool {
 	return IsTerminal(os.Stdout.Fd())
@@ -0,0 +1,68 @@
+package output
+
+import (
+	"path/filepath"
+	"slices"
+	"strconv"
+)
+
+// DirLimitFormatter wraps a formatter to print at most max matching files
+// of each directory, so that a vendored or generated directory does not
+// swamp the output. The files over the limit are counted, and Summary
+// prints one "… and N more" line for each directory that had them, sorted
+// by path. Results without a match are forwarded unchanged.
+type DirLimitFormatter struct {
+	Wrapper
+	max    int
+	shown  map[string]int // directory -> matching files printed
+	hidden map[string]int // directory -> matching files over the limit
+}
+
+// NewDirLimitFormatter wraps inner to print at most max matching files per
+// directory; max is at least 1.
+func NewDirLimitFormatter(inner Formatter, max int) *DirLimitFormatter {
+	return &DirLimitFormatter{
+		Wrapper: Wrapper{inner},
+		max:     max,
+		shown:   make(map[string]int),
+		hidden:  make(map[string]int),
+	}
+}
+
+func (f *DirLimitFormatter) Format(buf []byte, result Result, multiFile bool) []byte {
+	if !result.HasMatch() {
+		return f.Inner.Format(buf, result, multiFile)
+	}
+	dir := filepath.Dir(result.FilePath)
+	if f.shown[dir] >= f.max {
+		f.hidden[dir]++
+		return buf
+	}
+	f.shown[dir]++
+	return f.Inner.Format(buf, result, multiFile)
+}
+
+// Summary appends the wrapped formatter's summary, then a line for each
+// directory with files over the limit.
+func (f *DirLimitFormatter) Summary(buf []byte, multiFile bool) []byte {
+	buf = f.Wrapper.Summary(buf, multiFile)
+	dirs := make([]string, 0, len(f.hidden))
+	for dir := range f.hidden {
+		dirs = append(dirs, dir)
+	}
+	slices.Sort(dirs)
+	for _, dir := range dirs {
+		n := f.hidden[dir]
+		buf = append(buf, dir...)
+		buf = append(buf, ": … and "...)
+		buf = strconv.AppendInt(buf, int64(n), 10)
+		buf = append(buf, " more matching file"...)
+		if n > 1 {
+			buf = append(buf, 's')
+		}
+		buf = append(buf, '\n')
+	}
+	return buf
+}
+
+var _ Formatter = (*DirLimitFormatter)(nil)
@@ -0,0 +1,24 @@
+package output
+
+import (
+	"testing"
+
+	"github.com/dl/gogrep/internal/matcher"
+)
+
+func TestDirLimitFormatter(t *testing.T) {
+	f := NewDirLimitFormatter(NewTextFormatter(false, false, true, false, 0), 2)
+	match := matcher.MatchSet{Matches: []matcher.Match{{LineNum: 1}}}
+	var buf []byte
+	for _, p := range []string{"vendor/a.go", "main.go", "vendor/b.go", "vendor/c.go", "gen/x.go", "vendor/d.go", "gen/y.go", "gen/z.go"} {
+		buf = f.Format(buf, Result{FilePath: p, MatchSet: match}, true)
+	}
+	buf = f.Format(buf, Result{FilePath: "vendor/e.go"}, true) // no match, not counted
+	buf = f.Summary(buf, true)
+
+	want := "vendor/a.go\nmain.go\nvendor/b.go\ngen/x.go\ngen/y.go\n" +
+		"gen: … and 1 more matching file\nvendor: … and 2 more matching files\n"
+	if string(buf) != want {
+		t.Errorf("got %q, want %q", buf, want)
+	}
+}
@@ -0,0 +1,84 @@
+package output
+
+import (
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/dl/gogrep/internal/matcher"
+)
+
+// stdinName stands in for the file name of standard input where a format
+// needs one.
+const stdinName = "(standard input)"
+
+// EmacsFormatter prints matching lines as "FILE:LINE:COL:TEXT", the form
+// Emacs compilation-mode and grep-mode jump from. Every line carries its
+// file name, whether or not several files are searched: there are no
+// headings. COL is the 1-based character column of the line's first match,
+// or 1 when the line has none (-v). Context lines print as
+// "FILE-LINE-TEXT", as grep prints them, and group separators as "--"
+// unless SetSeparator says otherwise.
+type EmacsFormatter struct {
+	separator []byte // nil = separatorLine
+}
+
+// NewEmacsFormatter creates an EmacsFormatter.
+func NewEmacsFormatter() *EmacsFormatter {
+	return &EmacsFormatter{}
+}
+
+// SetSeparator sets the line printed between context groups; nil restores
+// the default "--".
+func (f *EmacsFormatter) SetSeparator(sep []byte) {
+	f.separator = sep
+}
+
+func (f *EmacsFormatter) Format(buf []byte, result Result, multiFile bool) []byte {
+	name := result.FilePath
+	if name == "" {
+		name = stdinName
+	}
+	ms := &result.MatchSet
+	for i := range ms.Matches {
+		m := &ms.Matches[i]
+		if m.LineStart < 0 {
+			if f.separator != nil {
+				buf = append(buf, f.separator...)
+			} else {
+				buf = append(buf, separatorLine...)
+			}
+			buf = append(buf, '\n')
+			continue
+		}
+		buf = append(buf, name...)
+		if m.IsContext {
+			buf = append(buf, '-')
+			buf = strconv.AppendInt(buf, int64(m.LineNum), 10)
+			buf = append(buf, '-')
+		} else {
+			buf = append(buf, ':')
+			buf = strconv.AppendInt(buf, int64(m.LineNum), 10)
+			buf = append(buf, ':')
+			buf = strconv.AppendInt(buf, int64(firstColumn(ms, i)), 10)
+			buf = append(buf, ':')
+		}
+		buf = append(buf, ms.LineBytes(i)...)
+		buf = append(buf, '\n')
+	}
+	return buf
+}
+
+// firstColumn returns the 1-based character column in its line of the
+// first match of ms.Matches[i], or 1 if it has no positions. The match may
+// be a snippet of the line, or a single span with -o.
+func firstColumn(ms *matcher.MatchSet, i int) int {
+	positions := ms.MatchPositions(i)
+	if len(positions) == 0 {
+		return 1
+	}
+	m := &ms.Matches[i]
+	lineStart, _ := lineExtent(ms.Data, m.LineStart, m.LineStart+m.LineLen)
+	return utf8.RuneCount(ms.Data[lineStart:m.LineStart+positions[0][0]]) + 1
+}
+
+var _ Formatter = (*EmacsFormatter)(nil)
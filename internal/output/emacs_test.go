@@ -0,0 +1,43 @@
+package output
+
+import (
+	"testing"
+
+	"github.com/dl/gogrep/internal/matcher"
+)
+
+func TestEmacsFormatter(t *testing.T) {
+	data := []byte("ctx\nnaïve FOO x FOO\nbar\n")
+	result := Result{FilePath: "a.go", MatchSet: matcher.MatchSet{
+		Data: data,
+		Matches: []matcher.Match{
+			{LineNum: 1, LineStart: 0, LineLen: 3, IsContext: true},
+			{LineNum: 2, LineStart: 4, LineLen: 16, PosIdx: 0, PosCount: 2},
+			{LineNum: 0, LineStart: -1},
+			{LineNum: 3, LineStart: 21, LineLen: 3, PosIdx: 2}, // -v: no positions
+		},
+		Positions: [][2]int{{7, 10}, {13, 16}},
+	}}
+
+	f := NewEmacsFormatter()
+	// The column counts characters: "naïve " is 6 of them in 7 bytes.
+	want := "a.go-1-ctx\na.go:2:7:naïve FOO x FOO\n--\na.go:3:1:bar\n"
+	if got := string(f.Format(nil, result, false)); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	f.SetSeparator([]byte("\t~"))
+	want = "a.go-1-ctx\na.go:2:7:naïve FOO x FOO\n\t~\na.go:3:1:bar\n"
+	if got := string(f.Format(nil, result, false)); got != want {
+		t.Errorf("with a separator: got %q, want %q", got, want)
+	}
+	f.SetSeparator(nil)
+
+	// With -o, each match has its own column; stdin gets a name.
+	result.FilePath = ""
+	result.MatchSet.Matches = result.MatchSet.Matches[1:2]
+	want = "(standard input):2:7:FOO\n(standard input):2:13:FOO\n"
+	if got := string(NewOnlyMatchingFormatter(f).Format(nil, result, false)); got != want {
+		t.Errorf("with -o: got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,32 @@
+package output
+
+import "strconv"
+
+// FileCountFormatter prints nothing per file; Summary prints how many
+// files matched, the number of lines -l would have printed.
+type FileCountFormatter struct {
+	files int
+}
+
+// NewFileCountFormatter creates a FileCountFormatter.
+func NewFileCountFormatter() *FileCountFormatter {
+	return &FileCountFormatter{}
+}
+
+func (f *FileCountFormatter) Format(buf []byte, result Result, multiFile bool) []byte {
+	if result.HasMatch() {
+		f.files++
+	}
+	return buf
+}
+
+// Summary prints the count, 0 included, on a line of its own.
+func (f *FileCountFormatter) Summary(buf []byte, multiFile bool) []byte {
+	buf = strconv.AppendInt(buf, int64(f.files), 10)
+	return append(buf, '\n')
+}
+
+var (
+	_ Formatter  = (*FileCountFormatter)(nil)
+	_ Summarizer = (*FileCountFormatter)(nil)
+)
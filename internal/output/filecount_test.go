@@ -0,0 +1,26 @@
+package output
+
+import (
+	"testing"
+
+	"github.com/dl/gogrep/internal/matcher"
+)
+
+func TestFileCountFormatter(t *testing.T) {
+	f := NewFileCountFormatter()
+	if got := string(f.Summary(nil, true)); got != "0\n" {
+		t.Errorf("empty summary = %q, want 0", got)
+	}
+	for _, r := range []Result{
+		{FilePath: "a", MatchSet: matcher.MatchSet{Matches: []matcher.Match{{}}}},
+		{FilePath: "b"},
+		{FilePath: "c", MatchSet: matcher.MatchSet{Matches: []matcher.Match{{}}}},
+	} {
+		if out := f.Format(nil, r, true); len(out) != 0 {
+			t.Errorf("Format printed %q", out)
+		}
+	}
+	if got := string(f.Summary(nil, true)); got != "2\n" {
+		t.Errorf("summary = %q, want 2", got)
+	}
+}
@@ -0,0 +1,62 @@
+package output
+
+import (
+	"os"
+	"os/exec"
+)
+
+// FilterCmd is a shell command that receives gogrep's formatted output on
+// its stdin, with its stdout and stderr going to gogrep's. Writes block
+// while the command's pipe is full, so a slow consumer slows the search
+// instead of buffering output without bound.
+type FilterCmd struct {
+	cmd  *exec.Cmd
+	pipe *os.File // write end of the command's stdin
+	done chan struct{}
+	err  error // exit status, valid once done is closed
+}
+
+// StartFilter starts command under /bin/sh -c.
+func StartFilter(command string) (*FilterCmd, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command("/bin/sh", "-c", command)
+	cmd.Stdin = r
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		r.Close()
+		w.Close()
+		return nil, err
+	}
+	r.Close()
+
+	f := &FilterCmd{cmd: cmd, pipe: w, done: make(chan struct{})}
+	go func() {
+		f.err = cmd.Wait()
+		close(f.done)
+	}()
+	return f, nil
+}
+
+// Writer returns a Writer feeding the command's stdin. Once the command
+// has exited, writes fail with EPIPE and output is dropped.
+func (f *FilterCmd) Writer() *Writer {
+	return &Writer{fd: int(f.pipe.Fd())}
+}
+
+// Done is closed when the command exits, so long-running searches such as
+// watch mode can stop once nothing consumes their output.
+func (f *FilterCmd) Done() <-chan struct{} {
+	return f.done
+}
+
+// Close closes the command's stdin, waits for it to exit, and returns its
+// exit error, if any.
+func (f *FilterCmd) Close() error {
+	f.pipe.Close()
+	<-f.done
+	return f.err
+}
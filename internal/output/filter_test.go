@@ -0,0 +1,52 @@
+package output
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFilterCmd(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	f, err := StartFilter("sort -u > " + out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := f.Writer()
+	w.Write([]byte("b\na\n"))
+	w.Write([]byte("b\n"))
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+
+	got, _ := os.ReadFile(out)
+	if string(got) != "a\nb\n" {
+		t.Errorf("filtered output = %q, want %q", got, "a\nb\n")
+	}
+}
+
+func TestFilterCmd_ExitStatus(t *testing.T) {
+	f, err := StartFilter("cat >/dev/null; exit 3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Writer().Write([]byte("x\n"))
+	if err := f.Close(); err == nil {
+		t.Error("Close() = nil, want exit status error")
+	}
+}
+
+func TestFilterCmd_EarlyExit(t *testing.T) {
+	f, err := StartFilter("exit 0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-f.Done()
+	// Writes after the command exits fail instead of blocking or killing us.
+	if err := f.Writer().Write([]byte("x\n")); err == nil {
+		t.Error("Write after exit succeeded")
+	}
+	if err := f.Close(); err != nil {
+		t.Errorf("Close() = %v, want nil", err)
+	}
+}
@@ -0,0 +1,110 @@
+package output
+
+import (
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// dirStats accumulates match counts for one directory.
+type dirStats struct {
+	matches int
+	files   []fileCount // only populated when listing files
+	nfiles  int
+}
+
+type fileCount struct {
+	path  string
+	count int
+}
+
+// GroupFormatter aggregates match counts by directory. Format records each
+// result and writes nothing; Summary prints one line per directory, sorted
+// by path, optionally followed by the matching files in that directory.
+type GroupFormatter struct {
+	listFiles bool
+	dirs      map[string]*dirStats
+}
+
+// NewGroupFormatter creates a GroupFormatter. If listFiles is true, each
+// directory line is followed by its matching files and their counts.
+func NewGroupFormatter(listFiles bool) *GroupFormatter {
+	return &GroupFormatter{
+		listFiles: listFiles,
+		dirs:      make(map[string]*dirStats),
+	}
+}
+
+func (f *GroupFormatter) Format(buf []byte, result Result, multiFile bool) []byte {
+	count := result.MatchCount
+	if count == 0 {
+		ms := &result.MatchSet
+		for i := range ms.Matches {
+			if !ms.Matches[i].IsContext {
+				count++
+			}
+		}
+	}
+	if count == 0 {
+		return buf
+	}
+
+	dir := filepath.Dir(result.FilePath)
+	ds := f.dirs[dir]
+	if ds == nil {
+		ds = &dirStats{}
+		f.dirs[dir] = ds
+	}
+	ds.matches += count
+	ds.nfiles++
+	if f.listFiles {
+		ds.files = append(ds.files, fileCount{path: result.FilePath, count: count})
+	}
+	return buf
+}
+
+// Summary appends one "dir: N matches in M files" line per directory.
+func (f *GroupFormatter) Summary(buf []byte, multiFile bool) []byte {
+	dirs := make([]string, 0, len(f.dirs))
+	for d := range f.dirs {
+		dirs = append(dirs, d)
+	}
+	sort.Strings(dirs)
+
+	for _, d := range dirs {
+		ds := f.dirs[d]
+		buf = append(buf, d...)
+		buf = append(buf, ": "...)
+		buf = strconv.AppendInt(buf, int64(ds.matches), 10)
+		buf = appendPlural(buf, " match", " matches", ds.matches)
+		buf = append(buf, " in "...)
+		buf = strconv.AppendInt(buf, int64(ds.nfiles), 10)
+		buf = appendPlural(buf, " file", " files", ds.nfiles)
+		buf = append(buf, '\n')
+
+		if f.listFiles {
+			sort.Slice(ds.files, func(i, j int) bool { return ds.files[i].path < ds.files[j].path })
+			for _, fc := range ds.files {
+				buf = append(buf, "  "...)
+				buf = append(buf, filepath.Base(fc.path)...)
+				buf = append(buf, ':')
+				buf = strconv.AppendInt(buf, int64(fc.count), 10)
+				buf = append(buf, '\n')
+			}
+		}
+	}
+	return buf
+}
+
+func appendPlural(buf []byte, one, many string, n int) []byte {
+	if n == 1 {
+		return append(buf, one...)
+	}
+	return append(buf, many...)
+}
+
+// Ensure GroupFormatter implements Formatter and Summarizer.
+var (
+	_ Formatter  = (*GroupFormatter)(nil)
+	_ Summarizer = (*GroupFormatter)(nil)
+)
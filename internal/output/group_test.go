@@ -0,0 +1,52 @@
+package output
+
+import (
+	"testing"
+
+	"github.com/dl/gogrep/internal/matcher"
+)
+
+func TestGroupFormatter(t *testing.T) {
+	results := []Result{
+		{FilePath: "src/b/x.go", MatchCount: 2},
+		{FilePath: "src/a/y.go", MatchCount: 1},
+		{FilePath: "src/b/w.go", MatchCount: 3},
+		{FilePath: "src/a/none.go"},
+		{FilePath: "src/a/z.go", MatchSet: matcher.MatchSet{
+			Matches: []matcher.Match{{LineNum: 1}, {LineNum: 2, IsContext: true}, {LineNum: 3}},
+		}},
+	}
+
+	f := NewGroupFormatter(false)
+	var buf []byte
+	for _, r := range results {
+		buf = f.Format(buf, r, true)
+	}
+	if len(buf) != 0 {
+		t.Fatalf("Format wrote %q, want nothing before Summary", buf)
+	}
+
+	got := string(f.Summary(nil, true))
+	want := "src/a: 3 matches in 2 files\nsrc/b: 5 matches in 2 files\n"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	f = NewGroupFormatter(true)
+	for _, r := range results {
+		f.Format(nil, r, true)
+	}
+	got = string(f.Summary(nil, true))
+	want = "src/a: 3 matches in 2 files\n  y.go:1\n  z.go:2\nsrc/b: 5 matches in 2 files\n  w.go:3\n  x.go:2\n"
+	if got != want {
+		t.Errorf("with files: got %q, want %q", got, want)
+	}
+}
+
+func TestGroupFormatter_Singular(t *testing.T) {
+	f := NewGroupFormatter(false)
+	f.Format(nil, Result{FilePath: "pkg/a.go", MatchCount: 1}, true)
+	if got := string(f.Summary(nil, true)); got != "pkg: 1 match in 1 file\n" {
+		t.Errorf("got %q", got)
+	}
+}
@@ -0,0 +1,89 @@
+package output
+
+import (
+	"strconv"
+
+	"github.com/dl/gogrep/internal/matcher"
+)
+
+// JoinFormatter collapses runs of consecutive matching lines into one
+// record giving their line range and count, "120-168: 49 matching lines",
+// so that a dense burst in a log takes one line of output. Matches outside
+// such runs, and context lines around them, are printed by the wrapped
+// TextFormatter as usual. Line numbers must have been computed.
+type JoinFormatter struct {
+	text   *TextFormatter
+	minRun int // shortest run that is collapsed
+}
+
+// NewJoinFormatter wraps text to collapse runs of at least minRun
+// consecutive matching lines.
+func NewJoinFormatter(text *TextFormatter, minRun int) *JoinFormatter {
+	return &JoinFormatter{text: text, minRun: max(minRun, 2)}
+}
+
+func (f *JoinFormatter) Format(buf []byte, result Result, multiFile bool) []byte {
+	matches := result.MatchSet.Matches
+	start := 0 // first match not yet formatted
+	for i := 0; i < len(matches); {
+		j, lines := adjacentRun(matches, i)
+		if lines >= f.minRun {
+			buf = f.formatPart(buf, result, start, i, multiFile)
+			buf = f.appendRun(buf, result, matches[i].LineNum, matches[j-1].LineNum, multiFile)
+			start = j
+		}
+		i = j
+	}
+	return f.formatPart(buf, result, start, len(matches), multiFile)
+}
+
+// adjacentRun returns the end of the run of matching lines starting at
+// matches[i], and how many lines it covers; 0 if matches[i] is a context
+// line or a separator. Snippets of one line belong to the same run.
+func adjacentRun(matches []matcher.Match, i int) (int, int) {
+	m := matches[i]
+	if m.IsContext || m.LineStart < 0 {
+		return i + 1, 0
+	}
+	last := m.LineNum
+	j := i + 1
+	for ; j < len(matches); j++ {
+		n := matches[j]
+		if n.IsContext || n.LineStart < 0 || (n.LineNum != last && n.LineNum != last+1) {
+			break
+		}
+		last = n.LineNum
+	}
+	return j, last - m.LineNum + 1
+}
+
+// formatPart formats matches [from, to) of result with the wrapped
+// formatter.
+func (f *JoinFormatter) formatPart(buf []byte, result Result, from, to int, multiFile bool) []byte {
+	if from == to {
+		return buf
+	}
+	result.MatchSet.Matches = result.MatchSet.Matches[from:to]
+	return f.text.Format(buf, result, multiFile)
+}
+
+// appendRun appends the record for lines first through last.
+func (f *JoinFormatter) appendRun(buf []byte, result Result, first, last int, multiFile bool) []byte {
+	if multiFile {
+		buf = f.text.appendName(buf, result.Root, result.FilePath, ":")
+	}
+	if f.text.useColor {
+		buf = append(buf, ansiGreen...)
+	}
+	buf = strconv.AppendInt(buf, int64(first), 10)
+	buf = append(buf, '-')
+	buf = strconv.AppendInt(buf, int64(last), 10)
+	if f.text.useColor {
+		buf = append(buf, ansiReset...)
+	}
+	buf = append(buf, ": "...)
+	buf = strconv.AppendInt(buf, int64(last-first+1), 10)
+	return append(buf, " matching lines\n"...)
+}
+
+var _ Formatter = (*JoinFormatter)(nil)
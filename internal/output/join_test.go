@@ -0,0 +1,42 @@
+package output
+
+import (
+	"testing"
+
+	"github.com/dl/gogrep/internal/matcher"
+)
+
+func TestJoinFormatter(t *testing.T) {
+	data := []byte("a1\na2\na3\nb4\na5\na6\nc7\na8\n")
+	line := func(n int, context bool) matcher.Match {
+		return matcher.Match{LineNum: n, LineStart: 3 * (n - 1), LineLen: 2, ByteOffset: int64(3 * (n - 1)), IsContext: context}
+	}
+	result := Result{FilePath: "f", MatchSet: matcher.MatchSet{
+		Data: data,
+		Matches: []matcher.Match{
+			line(1, false), line(2, false), line(3, false), line(4, true),
+			line(5, false), line(6, false), line(7, true),
+			{LineNum: 0, LineStart: -1},
+			line(8, false),
+		},
+	}}
+
+	tests := []struct {
+		name   string
+		minRun int
+		multi  bool
+		want   string
+	}{
+		{"pairs", 2, false, "1-3: 3 matching lines\nb4\n5-6: 2 matching lines\nc7\n--\na8\n"},
+		{"triples", 3, true, "f:1-3: 3 matching lines\nf-b4\nf:a5\nf:a6\nf-c7\n--\nf:a8\n"},
+		{"none", 4, false, "a1\na2\na3\nb4\na5\na6\nc7\n--\na8\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := NewJoinFormatter(NewTextFormatter(false, false, false, false, 0), tt.minRun)
+			if got := string(f.Format(nil, result, tt.multi)); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,25 +1,147 @@
 package output
 
 import (
+	"bytes"
 	"encoding/json"
+	"slices"
+	"time"
+
+	"github.com/dl/gogrep/internal/input"
+
+	"github.com/dl/gogrep/internal/matcher"
 )
 
 // JSONFormatter formats results as JSON Lines (one JSON object per match).
-type JSONFormatter struct{}
+// When the MatchSet carries context lines, each contiguous group of lines is
+// emitted as a block: a "block" record describing the file and line range,
+// followed by the "match" and "context" records that belong to it.
+// With pattern stats set, a final "summary" record gives per-pattern totals.
+// With a context window set, each "match" record also carries the lines
+// around it in "pre" and "post" arrays. A record whose text is not its whole
+// line says so with "truncated" and the line's "line_length". With a
+// submatcher set, match records carry the pattern's named groups in a
+// "captures" object.
+type JSONFormatter struct {
+	patternStats *matcher.PatternStats
+	window       int  // lines of pre/post context per match record (0 = none)
+	stat         bool // add a "stat" object to each record
+	roots        bool // add the walk root's label to each record as "root"
+	maxColumns   int  // cut text to this many bytes (0 = no limit)
+	captures     matcher.Submatcher
+}
 
 // NewJSONFormatter creates a JSONFormatter.
 func NewJSONFormatter() *JSONFormatter {
 	return &JSONFormatter{}
 }
 
-// jsonMatch is the JSON serialization format for a match line.
+// SetPatternStats makes Summary emit the per-pattern totals of s.
+func (f *JSONFormatter) SetPatternStats(s *matcher.PatternStats) {
+	f.patternStats = s
+}
+
+// SetContextWindow embeds up to n lines before and after each match in its
+// record, taken from the file buffer, so clients need not reopen the file.
+// Near the start or end of the file the arrays are shorter.
+func (f *JSONFormatter) SetContextWindow(n int) {
+	f.window = n
+}
+
+// SetStat adds the file's metadata, as captured when it was read, to each
+// record as a "stat" object.
+func (f *JSONFormatter) SetStat(on bool) {
+	f.stat = on
+}
+
+// SetRoots adds the label of the walk root each file was found under
+// (Result.Root) to its records as "root".
+func (f *JSONFormatter) SetRoots(on bool) {
+	f.roots = on
+}
+
+// SetMaxColumns cuts the text of records longer than n bytes to a window
+// of n bytes centered on the first match, as the text formatter does. The
+// byte offset and match positions follow the window. 0 means no limit.
+func (f *JSONFormatter) SetMaxColumns(n int) {
+	f.maxColumns = n
+}
+
+// SetCaptures adds the named groups of the first match on each match
+// record's line, found with s, as a "captures" object mapping each name to
+// the captured text, or to null for a group that took no part in the match.
+// Captures come from the whole line even when the text is truncated. A nil
+// s turns them off.
+func (f *JSONFormatter) SetCaptures(s matcher.Submatcher) {
+	f.captures = s
+}
+
+// jsonMatch is the JSON serialization format for a match or context line.
+// ByteOffset is the file offset of Text. When Text is only part of the
+// line, Truncated is set and LineLength is the whole line's length in bytes.
 type jsonMatch struct {
-	Type       string    `json:"type"`
-	File       string    `json:"file,omitempty"`
-	LineNum    int       `json:"line_number"`
-	ByteOffset int64     `json:"byte_offset"`
-	Text       string    `json:"text"`
-	Matches    []jsonPos `json:"matches,omitempty"`
+	Type       string             `json:"type"`
+	File       string             `json:"file,omitempty"`
+	Root       string             `json:"root,omitempty"`
+	Block      int                `json:"block,omitempty"`
+	LineNum    int                `json:"line_number"`
+	ByteOffset int64              `json:"byte_offset"`
+	Text       string             `json:"text"`
+	Truncated  bool               `json:"truncated,omitempty"`
+	LineLength int                `json:"line_length,omitempty"`
+	Matches    []jsonPos          `json:"matches,omitempty"`
+	Captures   map[string]*string `json:"captures,omitempty"`
+	Stat       *jsonStat          `json:"stat,omitempty"`
+}
+
+// jsonWindowMatch is a match record with its context window. The arrays
+// are always present, empty at the edges of the file.
+type jsonWindowMatch struct {
+	jsonMatch
+	Pre  []string `json:"pre"`
+	Post []string `json:"post"`
+}
+
+// jsonBlock opens a group of match and context lines covering
+// [FirstLine, LastLine] in a file. Block numbers are 1-based per file.
+type jsonBlock struct {
+	Type      string    `json:"type"`
+	File      string    `json:"file,omitempty"`
+	Root      string    `json:"root,omitempty"`
+	Block     int       `json:"block"`
+	FirstLine int       `json:"first_line"`
+	LastLine  int       `json:"last_line"`
+	Stat      *jsonStat `json:"stat,omitempty"`
+}
+
+// jsonStat is a file's metadata. Mode is st_mode, type bits included.
+type jsonStat struct {
+	Dev   uint64 `json:"dev"`
+	Inode uint64 `json:"inode"`
+	Size  int64  `json:"size"`
+	Mtime string `json:"mtime"` // RFC 3339, nanosecond precision
+	Mode  uint32 `json:"mode"`
+}
+
+func newJSONStat(s input.FileStat) *jsonStat {
+	return &jsonStat{
+		Dev:   s.Dev,
+		Inode: s.Ino,
+		Size:  s.Size,
+		Mtime: time.Unix(0, s.Mtime).UTC().Format(time.RFC3339Nano),
+		Mode:  s.Mode,
+	}
+}
+
+// jsonSummary closes the stream with per-pattern totals.
+type jsonSummary struct {
+	Type     string        `json:"type"`
+	Patterns []jsonPattern `json:"patterns"`
+}
+
+type jsonPattern struct {
+	Pattern string `json:"pattern"`
+	Lines   int    `json:"lines"`
+	Files   int    `json:"files"`
 }
 
 type jsonPos struct {
@@ -33,38 +155,198 @@ func (f *JSONFormatter) Format(buf []byte, result Result, multiFile bool) []byte
 		return buf
 	}
 
+	hasContext := false
+	for i := range ms.Matches {
+		if ms.Matches[i].IsContext {
+			hasContext = true
+			break
+		}
+	}
+
+	var stat *jsonStat
+	if f.stat && result.Stat.Known() {
+		stat = newJSONStat(result.Stat)
+	}
+
+	var root string
+	if f.roots {
+		root = result.Root
+	}
+
+	block := 0
 	for i := range ms.Matches {
 		m := &ms.Matches[i]
-		if m.IsContext {
+
+		// Separator sentinel: ends the current block.
+		if m.LineStart < 0 {
 			continue
 		}
 
-		var lineText string
-		if m.LineStart >= 0 {
-			lineText = string(ms.Data[m.LineStart : m.LineStart+m.LineLen])
+		if hasContext && (i == 0 || ms.Matches[i-1].LineStart < 0) {
+			block++
+			jb := jsonBlock{
+				Type:      "block",
+				File:      result.FilePath,
+				Root:      root,
+				Block:     block,
+				FirstLine: m.LineNum,
+				LastLine:  blockLastLine(ms.Matches, i),
+				Stat:      stat,
+			}
+			data, _ := json.Marshal(jb)
+			buf = append(buf, data...)
+			buf = append(buf, '\n')
+		}
+
+		typ := "match"
+		if m.IsContext {
+			typ = "context"
+		}
+
+		start, end := m.LineStart, m.LineStart+m.LineLen
+		offset := m.ByteOffset
+		positions := ms.MatchPositions(i)
+		if f.maxColumns > 0 && end-start > f.maxColumns {
+			winStart, winEnd := truncateWindow(ms.Data[start:end], positions, f.maxColumns)
+			positions = clipPositions(positions, winStart, winEnd-winStart)
+			start, end = start+winStart, start+winEnd
+			offset += int64(winStart)
 		}
 
 		jm := jsonMatch{
-			Type:       "match",
+			Type:       typ,
 			File:       result.FilePath,
+			Root:       root,
+			Block:      block,
 			LineNum:    m.LineNum,
-			ByteOffset: m.ByteOffset,
-			Text:       lineText,
+			ByteOffset: offset,
+			Text:       string(ms.Data[start:end]),
+			Stat:       stat,
+		}
+		// The matcher may have cut a long line to a snippet already.
+		lineStart, lineEnd := lineExtent(ms.Data, m.LineStart, m.LineStart+m.LineLen)
+		if end-start < lineEnd-lineStart {
+			jm.Truncated = true
+			jm.LineLength = lineEnd - lineStart
+		}
+		if f.captures != nil && !m.IsContext {
+			jm.Captures = jsonCaptures(f.captures.Captures(ms.Data[lineStart:lineEnd]), ms.Data[lineStart:lineEnd])
 		}
 
-		positions := ms.MatchPositions(i)
 		if len(positions) > 0 {
 			jm.Matches = make([]jsonPos, len(positions))
 			for j, pos := range positions {
 				jm.Matches[j] = jsonPos{Start: pos[0], End: pos[1]}
 			}
 		}
-		data, _ := json.Marshal(jm)
+		var data []byte
+		if f.window > 0 && !m.IsContext {
+			pre, post := contextWindow(ms.Data, m.LineStart, m.LineStart+m.LineLen, f.window)
+			data, _ = json.Marshal(jsonWindowMatch{jsonMatch: jm, Pre: pre, Post: post})
+		} else {
+			data, _ = json.Marshal(jm)
+		}
 		buf = append(buf, data...)
 		buf = append(buf, '\n')
 	}
 	return buf
 }
 
-// Ensure JSONFormatter implements Formatter.
-var _ Formatter = (*JSONFormatter)(nil)
+// jsonCaptures maps each captured name to its text in line. A name used by
+// several groups, as when patterns are combined, keeps the group that took
+// part in the match. Returns nil when there is nothing to report.
+func jsonCaptures(caps []matcher.Capture, line []byte) map[string]*string {
+	if len(caps) == 0 {
+		return nil
+	}
+	out := make(map[string]*string, len(caps))
+	for _, c := range caps {
+		if c.Start < 0 {
+			if _, ok := out[c.Name]; !ok {
+				out[c.Name] = nil
+			}
+			continue
+		}
+		text := string(line[c.Start:c.End])
+		out[c.Name] = &text
+	}
+	return out
+}
+
+// lineExtent returns the bounds of the line holding data[start:end],
+// which may be a snippet inside it. Data is only scanned when the snippet
+// does not already begin and end at line boundaries.
+func lineExtent(data []byte, start, end int) (int, int) {
+	if start > 0 && data[start-1] != '\n' {
+		start = bytes.LastIndexByte(data[:start], '\n') + 1
+	}
+	if end < len(data) && data[end] != '\n' {
+		if nl := bytes.IndexByte(data[end:], '\n'); nl >= 0 {
+			end += nl
+		} else {
+			end = len(data)
+		}
+	}
+	return start, end
+}
+
+// contextWindow returns up to n lines before and after the line holding
+// data[start:end], stopping at the edges of data. The snippet may be a
+// window inside a longer line, so the line's own bounds are found first.
+func contextWindow(data []byte, start, end, n int) (pre, post []string) {
+	pre, post = []string{}, []string{}
+
+	lineStart := bytes.LastIndexByte(data[:start], '\n') + 1
+	for len(pre) < n && lineStart > 0 {
+		prev := bytes.LastIndexByte(data[:lineStart-1], '\n') + 1
+		pre = append(pre, string(data[prev:lineStart-1]))
+		lineStart = prev
+	}
+	slices.Reverse(pre)
+
+	lineEnd := len(data)
+	if nl := bytes.IndexByte(data[end:], '\n'); nl >= 0 {
+		lineEnd = end + nl
+	}
+	// lineEnd is the newline ending the current line; a final newline
+	// starts no further line.
+	for len(post) < n && lineEnd+1 < len(data) {
+		next := lineEnd + 1
+		lineEnd = len(data)
+		if nl := bytes.IndexByte(data[next:], '\n'); nl >= 0 {
+			lineEnd = next + nl
+		}
+		post = append(post, string(data[next:lineEnd]))
+	}
+	return pre, post
+}
+
+// blockLastLine returns the line number of the last line in the block
+// starting at matches[start], i.e. the line before the next separator.
+func blockLastLine(matches []matcher.Match, start int) int {
+	last := matches[start].LineNum
+	for j := start + 1; j < len(matches) && matches[j].LineStart >= 0; j++ {
+		last = matches[j].LineNum
+	}
+	return last
+}
+
+// Summary appends the "summary" record, if pattern stats are set.
+func (f *JSONFormatter) Summary(buf []byte, multiFile bool) []byte {
+	if f.patternStats == nil {
+		return buf
+	}
+	js := jsonSummary{Type: "summary"}
+	for _, t := range f.patternStats.Totals() {
+		js.Patterns = append(js.Patterns, jsonPattern{Pattern: t.Pattern, Lines: t.Lines, Files: t.Files})
+	}
+	data, _ := json.Marshal(js)
+	buf = append(buf, data...)
+	return append(buf, '\n')
+}
+
+// Ensure JSONFormatter implements Formatter and Summarizer.
+var (
+	_ Formatter  = (*JSONFormatter)(nil)
+	_ Summarizer = (*JSONFormatter)(nil)
+)
@@ -2,9 +2,11 @@ package output
 
 import (
 	"encoding/json"
+	"reflect"
 	"strings"
 	"testing"
 
+	"github.com/dl/gogrep/internal/input"
 	"github.com/dl/gogrep/internal/matcher"
 )
 
@@ -77,7 +79,7 @@ func TestJSONFormatter_MultipleMatches(t *testing.T) {
 	}
 }
 
-func TestJSONFormatter_ContextLinesSkipped(t *testing.T) {
+func TestJSONFormatter_ContextLines(t *testing.T) {
 	f := NewJSONFormatter()
 	data := []byte("context\nmatch\ncontext\n")
 	result := Result{
@@ -95,8 +97,64 @@ func TestJSONFormatter_ContextLinesSkipped(t *testing.T) {
 
 	got := string(f.Format(nil, result, false))
 	lines := strings.Split(strings.TrimSpace(got), "\n")
-	if len(lines) != 1 {
-		t.Fatalf("got %d lines, want 1 (context should be skipped)", len(lines))
+	if len(lines) != 4 {
+		t.Fatalf("got %d lines, want 4 (block + 3 lines):\n%s", len(lines), got)
+	}
+
+	wantTypes := []string{"block", "context", "match", "context"}
+	for i, line := range lines {
+		var jm map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &jm); err != nil {
+			t.Fatalf("line %d: invalid JSON: %v", i, err)
+		}
+		if jm["type"] != wantTypes[i] {
+			t.Errorf("line %d: type = %v, want %s", i, jm["type"], wantTypes[i])
+		}
+		if jm["block"].(float64) != 1 {
+			t.Errorf("line %d: block = %v, want 1", i, jm["block"])
+		}
+	}
+
+	var jb map[string]interface{}
+	json.Unmarshal([]byte(lines[0]), &jb)
+	if jb["first_line"].(float64) != 1 || jb["last_line"].(float64) != 3 {
+		t.Errorf("block range = [%v, %v], want [1, 3]", jb["first_line"], jb["last_line"])
+	}
+}
+
+func TestJSONFormatter_ContextBlocks(t *testing.T) {
+	f := NewJSONFormatter()
+	data := []byte("a\nmatch\nb\nc\nd\nmatch\n")
+	result := Result{
+		FilePath: "test.txt",
+		MatchSet: matcher.MatchSet{
+			Data: data,
+			Matches: []matcher.Match{
+				{LineNum: 2, LineStart: 2, LineLen: 5, PosIdx: 0, PosCount: 1},
+				{LineNum: 3, LineStart: 8, LineLen: 1, IsContext: true},
+				{LineNum: 0, LineStart: -1, IsContext: true},
+				{LineNum: 5, LineStart: 12, LineLen: 1, IsContext: true},
+				{LineNum: 6, LineStart: 14, LineLen: 5, PosIdx: 1, PosCount: 1},
+			},
+			Positions: [][2]int{{0, 5}, {0, 5}},
+		},
+	}
+
+	got := string(f.Format(nil, result, false))
+	lines := strings.Split(strings.TrimSpace(got), "\n")
+	if len(lines) != 6 {
+		t.Fatalf("got %d lines, want 6:\n%s", len(lines), got)
+	}
+
+	var b2 map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[3]), &b2); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if b2["type"] != "block" || b2["block"].(float64) != 2 {
+		t.Errorf("line 3 = %v, want second block record", b2)
+	}
+	if b2["first_line"].(float64) != 5 || b2["last_line"].(float64) != 6 {
+		t.Errorf("block 2 range = [%v, %v], want [5, 6]", b2["first_line"], b2["last_line"])
 	}
 }
 
@@ -142,3 +200,222 @@ func TestJSONFormatter_MatchPositions(t *testing.T) {
 		t.Errorf("position[0] = %v, want {start:0, end:5}", pos0)
 	}
 }
+
+func TestJSONFormatter_Summary(t *testing.T) {
+	f := NewJSONFormatter()
+	if got := f.Summary(nil, true); len(got) != 0 {
+		t.Errorf("Summary without stats = %q, want empty", got)
+	}
+
+	stats, err := matcher.NewPatternStats([]string{"foo", "bar"}, func(p string) (matcher.Matcher, error) {
+		return matcher.NewBoyerMooreMatcher(p, false, false), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := matcher.NewPatternStatsMatcher(matcher.NewAhoCorasickMatcher([]string{"foo", "bar"}, false, false), stats)
+	m.CountAll([]byte("foo\nfoo\n"))
+	f.SetPatternStats(stats)
+
+	want := `{"type":"summary","patterns":[{"pattern":"foo","lines":2,"files":1},{"pattern":"bar","lines":0,"files":0}]}` + "\n"
+	if got := string(f.Summary(nil, true)); got != want {
+		t.Errorf("Summary = %s, want %s", got, want)
+	}
+}
+
+func TestJSONFormatter_ContextWindow(t *testing.T) {
+	f := NewJSONFormatter()
+	f.SetContextWindow(2)
+	data := []byte("one\ntwo\nthree\nfour\n")
+	result := Result{
+		FilePath: "test.txt",
+		MatchSet: matcher.MatchSet{
+			Data: data,
+			Matches: []matcher.Match{
+				{LineNum: 2, LineStart: 4, LineLen: 3, ByteOffset: 4},
+			},
+		},
+	}
+
+	var jm struct {
+		Text string   `json:"text"`
+		Pre  []string `json:"pre"`
+		Post []string `json:"post"`
+	}
+	if err := json.Unmarshal(f.Format(nil, result, false), &jm); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if jm.Text != "two" || strings.Join(jm.Pre, ",") != "one" || strings.Join(jm.Post, ",") != "three,four" {
+		t.Errorf("got text %q, pre %q, post %q", jm.Text, jm.Pre, jm.Post)
+	}
+}
+
+func TestContextWindow(t *testing.T) {
+	tests := []struct {
+		data       string
+		start, end int
+		n          int
+		pre, post  string
+	}{
+		{"a\nb\nc\n", 0, 1, 1, "", "b"},
+		{"a\nb\nc\n", 4, 5, 1, "b", ""},
+		{"a\nb\nc", 4, 5, 5, "a,b", ""},
+		{"a\nb\nc", 2, 3, 5, "a", "c"},
+		{"a\n\nxyz\n\nb\n", 4, 5, 2, "a,", ",b"}, // snippet inside the line, empty lines kept
+		{"only", 0, 4, 3, "", ""},
+	}
+	for _, tt := range tests {
+		pre, post := contextWindow([]byte(tt.data), tt.start, tt.end, tt.n)
+		if pre == nil || post == nil {
+			t.Errorf("%q: nil slice", tt.data)
+		}
+		if got := strings.Join(pre, ","); got != tt.pre {
+			t.Errorf("%q [%d:%d]: pre = %q, want %q", tt.data, tt.start, tt.end, got, tt.pre)
+		}
+		if got := strings.Join(post, ","); got != tt.post {
+			t.Errorf("%q [%d:%d]: post = %q, want %q", tt.data, tt.start, tt.end, got, tt.post)
+		}
+	}
+}
+
+func TestJSONFormatter_Stat(t *testing.T) {
+	f := NewJSONFormatter()
+	f.SetStat(true)
+	data := []byte("hello\n")
+	result := Result{
+		FilePath: "test.txt",
+		MatchSet: matcher.MatchSet{
+			Data:    data,
+			Matches: []matcher.Match{{LineNum: 1, LineStart: 0, LineLen: 5}},
+		},
+		Stat: input.FileStat{Dev: 2049, Ino: 42, Size: 6, Mtime: 1_700_000_000_500_000_000, Mode: 0o100644},
+	}
+
+	var jm struct {
+		Stat struct {
+			Dev   uint64 `json:"dev"`
+			Inode uint64 `json:"inode"`
+			Size  int64  `json:"size"`
+			Mtime string `json:"mtime"`
+			Mode  uint32 `json:"mode"`
+		} `json:"stat"`
+	}
+	if err := json.Unmarshal(f.Format(nil, result, false), &jm); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	s := jm.Stat
+	if s.Dev != 2049 || s.Inode != 42 || s.Size != 6 || s.Mode != 0o100644 || s.Mtime != "2023-11-14T22:13:20.5Z" {
+		t.Errorf("stat = %+v", s)
+	}
+
+	// Unknown metadata (stdin) is left out.
+	result.Stat = input.FileStat{}
+	if got := string(f.Format(nil, result, false)); strings.Contains(got, `"stat"`) {
+		t.Errorf("got stat for stdin: %s", got)
+	}
+}
+
+func TestJSONFormatter_MaxColumns(t *testing.T) {
+	type record struct {
+		ByteOffset int64     `json:"byte_offset"`
+		Text       string    `json:"text"`
+		Truncated  bool      `json:"truncated"`
+		LineLength int       `json:"line_length"`
+		Matches    []jsonPos `json:"matches"`
+	}
+	format := func(f *JSONFormatter, ms matcher.MatchSet) record {
+		t.Helper()
+		var r record
+		if err := json.Unmarshal(f.Format(nil, Result{FilePath: "min.js", MatchSet: ms}, false), &r); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+		return r
+	}
+
+	// "short\n" then a 100-byte line with "KEY" at bytes 50-53.
+	long := strings.Repeat("a", 50) + "KEY" + strings.Repeat("b", 47)
+	data := []byte("short\n" + long + "\n")
+	whole := matcher.MatchSet{
+		Data:      data,
+		Matches:   []matcher.Match{{LineNum: 2, LineStart: 6, LineLen: 100, ByteOffset: 6, PosCount: 1}},
+		Positions: [][2]int{{50, 53}},
+	}
+
+	f := NewJSONFormatter()
+	if r := format(f, whole); r.Text != long || r.Truncated || r.LineLength != 0 {
+		t.Errorf("no limit: got %+v, want the whole line untruncated", r)
+	}
+
+	f.SetMaxColumns(10)
+	r := format(f, whole)
+	want := record{ByteOffset: 6 + 46, Text: "aaaaKEYbbb", Truncated: true, LineLength: 100, Matches: []jsonPos{{4, 7}}}
+	if !reflect.DeepEqual(r, want) {
+		t.Errorf("-M 10: got %+v, want %+v", r, want)
+	}
+
+	// A short line is left alone.
+	short := matcher.MatchSet{Data: data, Matches: []matcher.Match{{LineNum: 1, LineStart: 0, LineLen: 5}}}
+	if r := format(f, short); r.Text != "short" || r.Truncated {
+		t.Errorf("short line: got %+v", r)
+	}
+
+	// A snippet the matcher already cut out of the line is marked too.
+	snippet := matcher.MatchSet{
+		Data:      data,
+		Matches:   []matcher.Match{{LineNum: 2, LineStart: 6 + 48, LineLen: 7, ByteOffset: 6 + 48, PosCount: 1}},
+		Positions: [][2]int{{2, 5}},
+	}
+	if r := format(NewJSONFormatter(), snippet); r.Text != "aaKEYbb" || !r.Truncated || r.LineLength != 100 {
+		t.Errorf("matcher snippet: got %+v", r)
+	}
+}
+
+func TestJSONFormatter_Captures(t *testing.T) {
+	t.Run("RE2", func(t *testing.T) { testJSONCaptures(t, false) })
+	t.Run("PCRE", func(t *testing.T) { testJSONCaptures(t, true) })
+}
+
+// testJSONCaptures checks the "captures" of JSON records from a
+// Submatcher built with or without PCRE.
+func testJSONCaptures(t *testing.T, pcre bool) {
+	sm, err := matcher.NewSubmatcher([]string{`user=(?P<user>\w+)|uid=(?P<uid>\d+)`}, false, pcre, false, matcher.DialectDefault, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m, ok := sm.(*matcher.PCREMatcher); ok {
+		defer m.Close()
+	}
+	f := NewJSONFormatter()
+	f.SetCaptures(sm)
+	data := []byte("login user=alice ok\nnext line\n")
+	result := Result{
+		FilePath: "auth.log",
+		MatchSet: matcher.MatchSet{
+			Data: data,
+			Matches: []matcher.Match{
+				{LineNum: 1, LineStart: 0, LineLen: 19},
+				{LineNum: 2, LineStart: 20, LineLen: 9, IsContext: true},
+			},
+		},
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(f.Format(nil, result, false))), "\n")
+	var match struct {
+		Captures map[string]*string `json:"captures"`
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &match); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if u := match.Captures["user"]; u == nil || *u != "alice" {
+		t.Errorf("user = %v, want alice", u)
+	}
+	if uid, ok := match.Captures["uid"]; !ok || uid != nil {
+		t.Errorf("uid = %v, %v; want null", uid, ok)
+	}
+	if !strings.Contains(lines[1], `"captures":{"uid":null,"user":"alice"}`) {
+		t.Errorf("match record = %s", lines[1])
+	}
+	if strings.Contains(lines[2], `"captures"`) {
+		t.Errorf("context record has captures: %s", lines[2])
+	}
+}
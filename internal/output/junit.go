@@ -0,0 +1,98 @@
+package output
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strconv"
+)
+
+// junitFile is one searched file: a test case, failed by its matching
+// lines, each kept as "LINE:COL: TEXT".
+type junitFile struct {
+	path  string
+	lines int
+	text  []byte
+}
+
+// JUnitFormatter turns a search into a JUnit XML report for CI, so that a
+// policy such as "no TODOs" shows up as failed tests. Every file searched
+// is a test case named by its path, failed when it has a match; the
+// failure lists the matching lines. Context lines are left out. Format
+// prints nothing, as the report's counts are only known at the end;
+// Summary prints the whole document.
+type JUnitFormatter struct {
+	files  []junitFile
+	failed int
+}
+
+// NewJUnitFormatter creates a JUnitFormatter.
+func NewJUnitFormatter() *JUnitFormatter {
+	return &JUnitFormatter{}
+}
+
+func (f *JUnitFormatter) Format(buf []byte, result Result, multiFile bool) []byte {
+	jf := junitFile{path: result.FilePath}
+	if jf.path == "" {
+		jf.path = stdinName
+	}
+	ms := &result.MatchSet
+	for i := range ms.Matches {
+		m := &ms.Matches[i]
+		if m.IsContext || m.LineStart < 0 {
+			continue
+		}
+		jf.lines++
+		jf.text = strconv.AppendInt(jf.text, int64(m.LineNum), 10)
+		jf.text = append(jf.text, ':')
+		jf.text = strconv.AppendInt(jf.text, int64(firstColumn(ms, i)), 10)
+		jf.text = append(jf.text, ": "...)
+		jf.text = append(jf.text, ms.LineBytes(i)...)
+		jf.text = append(jf.text, '\n')
+	}
+	if jf.lines > 0 {
+		f.failed++
+	}
+	f.files = append(f.files, jf)
+	return buf
+}
+
+// Summary prints the report: one suite holding every file's test case.
+func (f *JUnitFormatter) Summary(buf []byte, multiFile bool) []byte {
+	tests := strconv.Itoa(len(f.files))
+	failures := strconv.Itoa(f.failed)
+	buf = append(buf, xml.Header...)
+	buf = append(buf, `<testsuites name="gogrep" tests="`+tests+`" failures="`+failures+`">`+"\n"...)
+	buf = append(buf, `  <testsuite name="gogrep" tests="`+tests+`" failures="`+failures+`" errors="0" skipped="0">`+"\n"...)
+	for _, jf := range f.files {
+		buf = append(buf, `    <testcase classname="gogrep" name="`...)
+		buf = appendXMLText(buf, []byte(jf.path))
+		if jf.lines == 0 {
+			buf = append(buf, "\"/>\n"...)
+			continue
+		}
+		buf = append(buf, "\">\n      <failure type=\"match\" message=\""...)
+		buf = strconv.AppendInt(buf, int64(jf.lines), 10)
+		buf = appendPlural(buf, ` matching line">`, ` matching lines">`, jf.lines)
+		// EscapeText writes newlines as character references; the
+		// failure text reads better with its lines as they are.
+		start := len(buf)
+		buf = appendXMLText(buf, jf.text)
+		buf = append(buf[:start], bytes.ReplaceAll(buf[start:], []byte("&#xA;"), []byte("\n"))...)
+		buf = append(buf, "</failure>\n    </testcase>\n"...)
+	}
+	buf = append(buf, "  </testsuite>\n</testsuites>\n"...)
+	return buf
+}
+
+// appendXMLText appends s escaped for XML text and attribute values.
+// Bytes XML cannot carry, such as NUL in a binary file, become U+FFFD.
+func appendXMLText(buf []byte, s []byte) []byte {
+	var b bytes.Buffer
+	xml.EscapeText(&b, s)
+	return append(buf, b.Bytes()...)
+}
+
+var (
+	_ Formatter  = (*JUnitFormatter)(nil)
+	_ Summarizer = (*JUnitFormatter)(nil)
+)
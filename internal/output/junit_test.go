@@ -0,0 +1,62 @@
+package output
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/dl/gogrep/internal/matcher"
+)
+
+func TestJUnitFormatter(t *testing.T) {
+	data := []byte("ctx\n// TODO <fix> & \x00\n")
+	f := NewJUnitFormatter()
+	for _, r := range []Result{
+		{FilePath: "clean.go"},
+		{FilePath: `a "b".go`, MatchSet: matcher.MatchSet{
+			Data: data,
+			Matches: []matcher.Match{
+				{LineNum: 1, LineStart: 0, LineLen: 3, IsContext: true},
+				{LineNum: 2, LineStart: 4, LineLen: 17, PosIdx: 0, PosCount: 1},
+			},
+			Positions: [][2]int{{3, 7}},
+		}},
+	} {
+		if out := f.Format(nil, r, true); len(out) != 0 {
+			t.Errorf("Format printed %q", out)
+		}
+	}
+	out := f.Summary(nil, true)
+
+	var doc struct {
+		Tests    int `xml:"tests,attr"`
+		Failures int `xml:"failures,attr"`
+		Suite    struct {
+			Cases []struct {
+				Name    string `xml:"name,attr"`
+				Failure *struct {
+					Message string `xml:"message,attr"`
+					Text    string `xml:",chardata"`
+				} `xml:"failure"`
+			} `xml:"testcase"`
+		} `xml:"testsuite"`
+	}
+	if err := xml.Unmarshal(out, &doc); err != nil {
+		t.Fatalf("invalid XML: %v\n%s", err, out)
+	}
+	cases := doc.Suite.Cases
+	if doc.Tests != 2 || doc.Failures != 1 || len(cases) != 2 {
+		t.Fatalf("tests = %d, failures = %d, cases = %+v", doc.Tests, doc.Failures, cases)
+	}
+	if cases[0].Name != "clean.go" || cases[0].Failure != nil {
+		t.Errorf("passing case = %+v", cases[0])
+	}
+	fail := cases[1].Failure
+	if cases[1].Name != `a "b".go` || fail == nil || fail.Message != "1 matching line" ||
+		fail.Text != "2:4: // TODO <fix> & �\n" {
+		t.Errorf("failed case = %q %+v", cases[1].Name, fail)
+	}
+	if !strings.Contains(string(out), "&amp; \uFFFD\n</failure>") {
+		t.Errorf("failure text lines are not kept as lines:\n%s", out)
+	}
+}
@@ -0,0 +1,111 @@
+package output
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/dl/gogrep/internal/input"
+	"github.com/dl/gogrep/internal/matcher"
+)
+
+// readResult searches path with pattern through a pooled buffered reader
+// and returns a Result owning the buffer, as the scheduler does.
+func readResult(t *testing.T, path, pattern string) Result {
+	t.Helper()
+	rr, err := input.NewBufferedReader().Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := matcher.NewBoyerMooreMatcher(pattern, false, false)
+	return Result{
+		FilePath: path,
+		MatchSet: m.FindAll(rr.Data),
+		Closer:   func() { rr.Closer() },
+	}
+}
+
+func TestResult_DetachSurvivesPoison(t *testing.T) {
+	input.SetPoison(true)
+	defer input.SetPoison(false)
+
+	path := filepath.Join(t.TempDir(), "a.txt")
+	os.WriteFile(path, []byte("one needle\ntwo\nneedle three\n"), 0644)
+
+	f := NewTextFormatter(true, false, false, false, 0)
+	r := readResult(t, path, "needle")
+	want := string(f.Format(nil, r, false))
+
+	r.Detach()
+	if r.Closer != nil {
+		t.Error("Detach left Closer set")
+	}
+	// Reuse the pool so the released buffer is overwritten again.
+	other := readResult(t, path, "two")
+	defer other.Closer()
+
+	if got := string(f.Format(nil, r, false)); got != want {
+		t.Errorf("after release got %q, want %q", got, want)
+	}
+}
+
+// TestOrderedWriter_FormatsBeforeRelease delivers results out of order from
+// concurrent producers with poisoning on. Any formatting after Closer would
+// print PoisonByte instead of file content. Run with -race.
+func TestOrderedWriter_FormatsBeforeRelease(t *testing.T) {
+	input.SetPoison(true)
+	defer input.SetPoison(false)
+
+	dir := t.TempDir()
+	const n = 32
+	paths := make([]string, n)
+	for i := range paths {
+		paths[i] = filepath.Join(dir, fmt.Sprintf("f%02d.txt", i))
+		os.WriteFile(paths[i], []byte(fmt.Sprintf("match %02d\nskip\n", i)), 0644)
+	}
+
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	copied := make(chan struct{})
+	go func() {
+		io.Copy(&out, pr)
+		close(copied)
+	}()
+
+	results := make(chan Result)
+	var wg sync.WaitGroup
+	for i := n - 1; i >= 0; i-- {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := readResult(t, paths[i], "match")
+			r.SeqNum = i + 1
+			results <- r
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	ow := NewOrderedWriter(&Writer{fd: int(pw.Fd())}, NewTextFormatter(false, false, false, false, 0), true)
+	ow.WriteOrdered(results, nil)
+	pw.Close()
+	<-copied
+
+	var want strings.Builder
+	for i, p := range paths {
+		fmt.Fprintf(&want, "%s:match %02d\n", p, i)
+	}
+	if out.String() != want.String() {
+		t.Errorf("output =\n%s\nwant\n%s", out.String(), want.String())
+	}
+}
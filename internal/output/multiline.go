@@ -0,0 +1,70 @@
+package output
+
+import (
+	"bytes"
+
+	"github.com/dl/gogrep/internal/matcher"
+)
+
+// MultilineFormatter prints the matches of -U, which may span several
+// lines, one line at a time: each line of a match becomes a record with
+// its own line number and the part of the match on it highlighted, so the
+// wrapped formatter prefixes every line as it would a matching line.
+type MultilineFormatter struct {
+	Wrapper
+}
+
+// NewMultilineFormatter wraps inner to print multi-line matches line by
+// line.
+func NewMultilineFormatter(inner Formatter) *MultilineFormatter {
+	return &MultilineFormatter{Wrapper: Wrapper{inner}}
+}
+
+func (f *MultilineFormatter) Format(buf []byte, result Result, multiFile bool) []byte {
+	if len(result.MatchSet.Matches) > 0 {
+		result.MatchSet = splitLines(result.MatchSet)
+	}
+	return f.Inner.Format(buf, result, multiFile)
+}
+
+// splitLines returns ms with each match that spans several lines cut into
+// one match per line, pointing into the same Data. Line numbers count up
+// from the match's, and positions are clipped to each line. Matches on a
+// single line are kept as they are.
+func splitLines(ms matcher.MatchSet) matcher.MatchSet {
+	out := matcher.MatchSet{Data: ms.Data}
+	for i, m := range ms.Matches {
+		positions := ms.MatchPositions(i)
+		if m.LineStart < 0 || bytes.IndexByte(ms.LineBytes(i), '\n') < 0 {
+			m.PosIdx = len(out.Positions)
+			out.Positions = append(out.Positions, positions...)
+			out.Matches = append(out.Matches, m)
+			continue
+		}
+		text := ms.LineBytes(i)
+		for off, n := 0, 0; off <= len(text); n++ {
+			end := len(text)
+			if j := bytes.IndexByte(text[off:], '\n'); j >= 0 {
+				end = off + j
+			}
+			line := matcher.Match{
+				LineStart:  m.LineStart + off,
+				LineLen:    end - off,
+				ByteOffset: m.ByteOffset + int64(off),
+				PosIdx:     len(out.Positions),
+				IsContext:  m.IsContext,
+			}
+			if m.LineNum > 0 {
+				line.LineNum = m.LineNum + n
+			}
+			clipped := clipPositions(positions, off, end-off)
+			line.PosCount = len(clipped)
+			out.Positions = append(out.Positions, clipped...)
+			out.Matches = append(out.Matches, line)
+			off = end + 1
+		}
+	}
+	return out
+}
+
+var _ Formatter = (*MultilineFormatter)(nil)
@@ -0,0 +1,31 @@
+package output
+
+import (
+	"testing"
+
+	"github.com/dl/gogrep/internal/matcher"
+)
+
+func TestMultilineFormatter(t *testing.T) {
+	data := []byte("a\nfoo\nbar baz\nc\n")
+	result := Result{FilePath: "f", MatchSet: matcher.MatchSet{
+		Data: data,
+		Matches: []matcher.Match{
+			{LineNum: 2, LineStart: 2, LineLen: 11, ByteOffset: 2, PosIdx: 0, PosCount: 1},
+			{LineNum: 4, LineStart: 14, LineLen: 1, ByteOffset: 14, PosIdx: 1, PosCount: 1},
+		},
+		Positions: [][2]int{{0, 7}, {0, 1}},
+	}}
+
+	tf := NewTextFormatter(true, false, false, false, 0)
+	tf.SetOptions(TextOpts{PrintPositions: true})
+	got := string(NewMultilineFormatter(tf).Format(nil, result, true))
+	if want := "f:2:foo\t0-3\nf:3:bar baz\t0-3\nf:4:c\t0-1\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	ms := splitLines(result.MatchSet)
+	if len(ms.Matches) != 3 || ms.Matches[1].ByteOffset != 6 || ms.Matches[2].PosIdx != 2 {
+		t.Errorf("matches: %+v", ms.Matches)
+	}
+}
@@ -0,0 +1,38 @@
+package output
+
+import "slices"
+
+// NumberingFormatter numbers the lines of every input from a given line
+// and byte offset rather than from 1 and 0, for inputs that are fragments
+// of something larger: a chunk split off a huge file at line 1000001, byte
+// 524288000, then reports the line numbers and offsets of the whole file.
+// Each input starts from the same numbers. Matches are renumbered before
+// the wrapped formatter, and any wrapper inside it, sees them.
+type NumberingFormatter struct {
+	Wrapper
+	lines  int   // added to every line number
+	offset int64 // added to every byte offset
+}
+
+// NewNumberingFormatter wraps inner to number each input's first line
+// firstLine and its first byte firstOffset.
+func NewNumberingFormatter(inner Formatter, firstLine int, firstOffset int64) *NumberingFormatter {
+	return &NumberingFormatter{Wrapper: Wrapper{inner}, lines: firstLine - 1, offset: firstOffset}
+}
+
+func (f *NumberingFormatter) Format(buf []byte, result Result, multiFile bool) []byte {
+	if len(result.MatchSet.Matches) > 0 {
+		// The caller still holds the matches; renumber a copy.
+		matches := slices.Clone(result.MatchSet.Matches)
+		for i := range matches {
+			if m := &matches[i]; m.LineStart >= 0 {
+				m.LineNum += f.lines
+				m.ByteOffset += f.offset
+			}
+		}
+		result.MatchSet.Matches = matches
+	}
+	return f.Inner.Format(buf, result, multiFile)
+}
+
+var _ Formatter = (*NumberingFormatter)(nil)
@@ -0,0 +1,28 @@
+package output
+
+import (
+	"testing"
+
+	"github.com/dl/gogrep/internal/matcher"
+)
+
+func TestNumberingFormatter(t *testing.T) {
+	data := []byte("a\nfoo\nb\nfoo\n")
+	matches := []matcher.Match{
+		{LineNum: 2, LineStart: 2, LineLen: 3, ByteOffset: 2},
+		{LineStart: -1},
+		{LineNum: 4, LineStart: 8, LineLen: 3, ByteOffset: 8},
+	}
+	result := Result{MatchSet: matcher.MatchSet{Data: data, Matches: matches}}
+
+	tf := NewTextFormatter(true, false, false, false, 0)
+	tf.SetOptions(TextOpts{ByteOffset: true})
+	f := NewNumberingFormatter(tf, 1001, 500)
+	want := "1002:502:foo\n--\n1004:508:foo\n"
+	if got := string(f.Format(nil, result, false)); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if matches[0].LineNum != 2 || matches[2].ByteOffset != 8 {
+		t.Errorf("the caller's matches were renumbered: %+v", matches)
+	}
+}
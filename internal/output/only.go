@@ -0,0 +1,55 @@
+package output
+
+import "github.com/dl/gogrep/internal/matcher"
+
+// OnlyMatchingFormatter prints each match on its own, as -o does: every
+// highlighted span of a matching line becomes a record of its own, with
+// the line's number and the span as its whole text, while context lines
+// and group separators are dropped. It wraps the formatter that prints the
+// records, so colour, line numbers and --print-positions apply to each
+// span as to a line.
+type OnlyMatchingFormatter struct {
+	Wrapper
+}
+
+// NewOnlyMatchingFormatter wraps inner to print matches instead of lines.
+func NewOnlyMatchingFormatter(inner Formatter) *OnlyMatchingFormatter {
+	return &OnlyMatchingFormatter{Wrapper: Wrapper{inner}}
+}
+
+func (f *OnlyMatchingFormatter) Format(buf []byte, result Result, multiFile bool) []byte {
+	if len(result.MatchSet.Matches) > 0 {
+		result.MatchSet = onlyMatching(result.MatchSet)
+	}
+	return f.Inner.Format(buf, result, multiFile)
+}
+
+// onlyMatching returns ms with one match per span, pointing into the same
+// Data. Each keeps its line's number, and its ByteOffset moves to the
+// span's start. Empty spans, as from a pattern that matches the empty
+// string, print nothing.
+func onlyMatching(ms matcher.MatchSet) matcher.MatchSet {
+	out := matcher.MatchSet{Data: ms.Data}
+	for i, m := range ms.Matches {
+		if m.LineStart < 0 || m.IsContext {
+			continue
+		}
+		for _, p := range ms.MatchPositions(i) {
+			if p[1] <= p[0] {
+				continue
+			}
+			out.Matches = append(out.Matches, matcher.Match{
+				LineNum:    m.LineNum,
+				LineStart:  m.LineStart + p[0],
+				LineLen:    p[1] - p[0],
+				ByteOffset: m.ByteOffset + int64(p[0]),
+				PosIdx:     len(out.Positions),
+				PosCount:   1,
+			})
+			out.Positions = append(out.Positions, [2]int{0, p[1] - p[0]})
+		}
+	}
+	return out
+}
+
+var _ Formatter = (*OnlyMatchingFormatter)(nil)
@@ -0,0 +1,56 @@
+package output
+
+import (
+	"testing"
+
+	"github.com/dl/gogrep/internal/matcher"
+)
+
+func TestOnlyMatchingFormatter(t *testing.T) {
+	data := []byte("ctx\nfoo=1 bar=22\n")
+	result := Result{FilePath: "f", MatchSet: matcher.MatchSet{
+		Data: data,
+		Matches: []matcher.Match{
+			{LineNum: 1, LineStart: 0, LineLen: 3, IsContext: true},
+			{LineNum: 0, LineStart: -1},
+			{LineNum: 2, LineStart: 4, LineLen: 12, ByteOffset: 4, PosIdx: 0, PosCount: 3},
+		},
+		Positions: [][2]int{{0, 5}, {6, 6}, {6, 12}},
+	}}
+
+	tf := NewTextFormatter(true, false, false, false, 0)
+	tf.SetOptions(TextOpts{PrintPositions: true})
+	got := string(NewOnlyMatchingFormatter(tf).Format(nil, result, true))
+	if want := "f:2:foo=1\t0-5\nf:2:bar=22\t6-12\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	ms := onlyMatching(result.MatchSet)
+	if len(ms.Matches) != 2 || ms.Matches[1].ByteOffset != 10 {
+		t.Errorf("matches: %+v", ms.Matches)
+	}
+}
+
+// TestOnlyMatchingFormatter_OverlappingPatterns checks that patterns
+// overlapping in the text print grep's leftmost-longest matches, with
+// both the few-pattern and the many-pattern fixed-string engines.
+func TestOnlyMatchingFormatter_OverlappingPatterns(t *testing.T) {
+	many := []string{"fo", "oo", "a1", "a2", "a3", "a4", "a5", "a6", "a7", "a8"}
+	for _, patterns := range [][]string{{"fo", "oo"}, many} {
+		m, err := matcher.NewMatcher(patterns, true, false, false, false, matcher.MatcherOpts{NeedLineNums: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		result := Result{FilePath: "f", MatchSet: m.FindAll([]byte("foofoo\n"))}
+
+		tf := NewTextFormatter(false, false, false, false, 0)
+		tf.SetOptions(TextOpts{PrintPositions: true})
+		if got, want := string(tf.Format(nil, result, true)), "f:foofoo\t0-2,3-5\n"; got != want {
+			t.Errorf("%d patterns, --print-positions: got %q, want %q", len(patterns), got, want)
+		}
+		tf = NewTextFormatter(false, false, false, false, 0)
+		if got, want := string(NewOnlyMatchingFormatter(tf).Format(nil, result, true)), "f:fo\nf:fo\n"; got != want {
+			t.Errorf("%d patterns, -o: got %q, want %q", len(patterns), got, want)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package output
 import (
 	"strings"
 	"testing"
+	"unicode/utf8"
 
 	"github.com/dl/gogrep/internal/matcher"
 )
@@ -78,6 +79,16 @@ func TestTextFormatter_CountOnly(t *testing.T) {
 	if got != "test.txt:3\n" {
 		t.Errorf("count multi: got %q, want %q", got, "test.txt:3\n")
 	}
+
+	// A file searched without a match counts 0, as in grep; one that was
+	// not searched prints nothing.
+	zero := Result{FilePath: "empty.txt", Counted: true}
+	if got := string(f.Format(nil, zero, true)); got != "empty.txt:0\n" {
+		t.Errorf("count zero: got %q, want %q", got, "empty.txt:0\n")
+	}
+	if got := string(f.Format(nil, Result{FilePath: "skipped.bin"}, true)); got != "" {
+		t.Errorf("count unsearched: got %q, want nothing", got)
+	}
 }
 
 func TestTextFormatter_FilesOnly(t *testing.T) {
@@ -95,6 +106,13 @@ func TestTextFormatter_FilesOnly(t *testing.T) {
 		t.Errorf("got %q, want %q", got, "test.txt\n")
 	}
 
+	// With --print-hash
+	result.Hash = "ab12"
+	got = string(f.Format(nil, result, true))
+	if got != "ab12  test.txt\n" {
+		t.Errorf("got %q, want %q", got, "ab12  test.txt\n")
+	}
+
 	// No matches
 	result.MatchSet.Matches = nil
 	got = string(f.Format(nil, result, true))
@@ -180,3 +198,241 @@ func TestTextFormatter_MaxColumnsCentered(t *testing.T) {
 		t.Errorf("output line length %d exceeds maxColumns 60", len(line2))
 	}
 }
+
+func TestTextFormatter_DisplayWidthNoSplitRune(t *testing.T) {
+	// 20 CJK characters (3 bytes, 2 columns each) followed by a match.
+	line := strings.Repeat("日", 20) + "match" + strings.Repeat("本", 20)
+	data := []byte(line + "\n")
+	start := len(strings.Repeat("日", 20))
+	result := Result{
+		FilePath: "test.txt",
+		MatchSet: matcher.MatchSet{
+			Data: data,
+			Matches: []matcher.Match{
+				{LineNum: 1, LineStart: 0, LineLen: len(line), PosIdx: 0, PosCount: 1},
+			},
+			Positions: [][2]int{{start, start + 5}},
+		},
+	}
+
+	f := NewTextFormatter(false, false, false, false, 15)
+	f.SetOptions(TextOpts{DisplayWidth: true})
+	got := strings.TrimSuffix(string(f.Format(nil, result, false)), "\n")
+
+	if !utf8.ValidString(got) {
+		t.Fatalf("output %q is not valid UTF-8", got)
+	}
+	if !strings.Contains(got, "match") {
+		t.Errorf("output %q does not contain match", got)
+	}
+	if w := displayWidth([]byte(got)); w > 15 {
+		t.Errorf("display width %d exceeds maxColumns 15 (%q)", w, got)
+	}
+	if !strings.HasPrefix(got, "日") {
+		t.Errorf("output %q should start on a rune boundary", got)
+	}
+}
+
+func TestTextFormatter_DisplayWidthFits(t *testing.T) {
+	// 10 wide runes = 30 bytes but 20 columns: fits in 20 columns untruncated.
+	line := strings.Repeat("字", 10)
+	data := []byte(line + "\n")
+	result := Result{
+		MatchSet: matcher.MatchSet{
+			Data:    data,
+			Matches: []matcher.Match{{LineNum: 1, LineStart: 0, LineLen: len(line)}},
+		},
+	}
+
+	f := NewTextFormatter(false, false, false, false, 20)
+	f.SetOptions(TextOpts{DisplayWidth: true})
+	if got := string(f.Format(nil, result, false)); got != line+"\n" {
+		t.Errorf("got %q, want full line", got)
+	}
+}
+
+func TestTextFormatter_DisplayWidthPartialSnippet(t *testing.T) {
+	// Snippet cut mid-rune at both ends, as a matcher's byte window can produce.
+	full := []byte(strings.Repeat("é", 30) + "hit" + strings.Repeat("é", 30))
+	snippet := full[1 : len(full)-1]
+	hit := strings.Index(string(snippet), "hit")
+	result := Result{
+		MatchSet: matcher.MatchSet{
+			Data:      snippet,
+			Matches:   []matcher.Match{{LineNum: 1, LineStart: 0, LineLen: len(snippet), PosIdx: 0, PosCount: 1}},
+			Positions: [][2]int{{hit, hit + 3}},
+		},
+	}
+
+	f := NewTextFormatter(false, false, false, true, 11)
+	f.SetOptions(TextOpts{DisplayWidth: true})
+	got := string(f.Format(nil, result, false))
+	if !utf8.ValidString(got) {
+		t.Fatalf("output %q is not valid UTF-8", got)
+	}
+	if !strings.Contains(got, "\x1b[1;31mhit\x1b[0m") {
+		t.Errorf("output %q does not highlight hit", got)
+	}
+}
+
+func TestDisplayWidth(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int
+	}{
+		{"", 0},
+		{"hello", 5},
+		{"héllo", 5},
+		{"日本", 4},
+		{"é", 1},   // combining acute accent
+		{"\xff", 1}, // invalid byte
+		{"ｈｉ", 4},   // fullwidth latin
+	}
+	for _, tt := range tests {
+		if got := displayWidth([]byte(tt.in)); got != tt.want {
+			t.Errorf("displayWidth(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestTextFormatter_BinarySafeguards(t *testing.T) {
+	line := "\x00\x01" + strings.Repeat("x", 500) + "magic" + strings.Repeat("\x00", 500)
+	data := []byte(line)
+	pos := strings.Index(line, "magic")
+	result := Result{
+		Binary: true,
+		MatchSet: matcher.MatchSet{
+			Data:      data,
+			Matches:   []matcher.Match{{LineNum: 1, LineStart: 0, LineLen: len(line), PosIdx: 0, PosCount: 1}},
+			Positions: [][2]int{{pos, pos + 5}},
+		},
+	}
+
+	f := NewTextFormatter(false, false, false, false, 0)
+	got := strings.TrimSuffix(string(f.Format(nil, result, false)), "\n")
+	if len(got) > binaryMaxColumns {
+		t.Errorf("binary line length %d exceeds %d", len(got), binaryMaxColumns)
+	}
+	if strings.IndexByte(got, 0) >= 0 {
+		t.Errorf("output contains NUL bytes: %q", got)
+	}
+	if !strings.Contains(got, "magic") {
+		t.Errorf("output %q does not contain match", got)
+	}
+
+	f.SetOptions(TextOpts{BinaryRaw: true})
+	raw := strings.TrimSuffix(string(f.Format(nil, result, false)), "\n")
+	if raw != line {
+		t.Errorf("raw output length %d, want unmodified line of %d bytes", len(raw), len(line))
+	}
+}
+
+func TestTextFormatter_ClipMarkers(t *testing.T) {
+	data := []byte("head\nxxFOOyy\nFOO\n")
+	result := Result{MatchSet: matcher.MatchSet{
+		Data: data,
+		Matches: []matcher.Match{
+			{LineNum: 2, LineStart: 6, LineLen: 5, PosIdx: 0, PosCount: 1},  // "xFOOy": clipped both sides
+			{LineNum: 3, LineStart: 13, LineLen: 3, PosIdx: 1, PosCount: 1}, // "FOO": whole line
+		},
+		Positions: [][2]int{{1, 4}, {0, 3}},
+	}}
+
+	f := NewTextFormatter(false, false, false, false, 0)
+	f.SetOptions(TextOpts{ClipMarkers: true})
+	got := string(f.Format(nil, result, false))
+	if want := "…xFOOy…\nFOO\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	f.SetOptions(TextOpts{})
+	if got := string(f.Format(nil, result, false)); got != "xFOOy\nFOO\n" {
+		t.Errorf("without markers: got %q", got)
+	}
+}
+
+func TestTextFormatter_PrintPositions(t *testing.T) {
+	data := []byte("head\nxxFOOyFOO\nctx\n")
+	result := Result{FilePath: "f", MatchSet: matcher.MatchSet{
+		Data: data,
+		Matches: []matcher.Match{
+			{LineNum: 1, LineStart: 0, LineLen: 4, IsContext: true},
+			{LineNum: 2, LineStart: 7, LineLen: 7, PosIdx: 0, PosCount: 2}, // snippet "FOOyFOO"
+		},
+		Positions: [][2]int{{0, 3}, {4, 7}},
+	}}
+
+	f := NewTextFormatter(true, false, false, false, 0)
+	f.SetOptions(TextOpts{PrintPositions: true})
+	// Ranges count from the start of line 2, not of the snippet.
+	if got, want := string(f.Format(nil, result, true)), "f-1-head\nf:2:FOOyFOO\t2-5,6-9\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// A -M window cuts the text but not the ranges.
+	f = NewTextFormatter(false, false, false, false, 3)
+	f.SetOptions(TextOpts{PrintPositions: true})
+	if got, want := string(f.Format(nil, result, false)), "hea\nFOO\t2-5,6-9\n"; got != want {
+		t.Errorf("with -M: got %q, want %q", got, want)
+	}
+}
+
+func TestTextFormatter_NullNames(t *testing.T) {
+	data := []byte("a:b\nFOO\n")
+	result := Result{FilePath: "x:y", MatchSet: matcher.MatchSet{
+		Data: data,
+		Matches: []matcher.Match{
+			{LineNum: 1, LineStart: 0, LineLen: 3, IsContext: true},
+			{LineNum: 2, LineStart: 4, LineLen: 3},
+		},
+	}, MatchCount: 1}
+
+	for _, tc := range []struct {
+		name                 string
+		countOnly, filesOnly bool
+		want                 string
+	}{
+		{"lines", false, false, "x:y\x001-a:b\nx:y\x002:FOO\n"},
+		{"-c", true, false, "x:y\x001\n"},
+		{"-l", false, true, "x:y\x00"},
+	} {
+		f := NewTextFormatter(true, tc.countOnly, tc.filesOnly, false, 0)
+		f.SetOptions(TextOpts{NullNames: true})
+		if got := string(f.Format(nil, result, true)); got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestTextFormatter_ByteOffset(t *testing.T) {
+	data := []byte("head\nxxFOOyFOO\n--\n")
+	result := Result{FilePath: "f", MatchSet: matcher.MatchSet{
+		Data: data,
+		Matches: []matcher.Match{
+			{LineNum: 1, LineStart: 0, LineLen: 4, IsContext: true},
+			{LineNum: 2, LineStart: 5, LineLen: 9, ByteOffset: 5, PosIdx: 0, PosCount: 2},
+			{LineNum: 0, LineStart: -1},
+		},
+		Positions: [][2]int{{2, 5}, {6, 9}},
+	}}
+
+	f := NewTextFormatter(true, false, false, false, 0)
+	f.SetOptions(TextOpts{ByteOffset: true})
+	if got, want := string(f.Format(nil, result, false)), "1-0-head\n2:5:xxFOOyFOO\n--\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// The offset follows a -M window to the text printed.
+	f = NewTextFormatter(false, false, false, false, 4)
+	f.SetOptions(TextOpts{ByteOffset: true})
+	if got, want := string(f.Format(nil, result, false)), "0-head\n6:xFOO\n--\n"; got != want {
+		t.Errorf("with -M: got %q, want %q", got, want)
+	}
+
+	// With -o, each match's own offset.
+	f = NewTextFormatter(false, false, false, false, 0)
+	f.SetOptions(TextOpts{ByteOffset: true})
+	if got, want := string(NewOnlyMatchingFormatter(f).Format(nil, result, false)), "7:FOO\n11:FOO\n"; got != want {
+		t.Errorf("with -o: got %q, want %q", got, want)
+	}
+}
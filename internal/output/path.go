@@ -0,0 +1,119 @@
+package output
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// PathStyle selects how result paths are printed.
+type PathStyle int
+
+const (
+	PathAsFound  PathStyle = iota // as the walker produced them (default)
+	PathRelative                  // relative to the current directory
+	PathAbsolute                  // absolute and cleaned
+	PathBasename                  // the final element only
+)
+
+// PathOpts configures a PathFormatter.
+type PathOpts struct {
+	Style PathStyle
+	// StripPrefixes are directory prefixes removed from paths after Style
+	// is applied, such as a CI runner's checkout directory. A prefix only
+	// matches whole path elements; the longest matching one is removed,
+	// and paths under none of them are left alone.
+	StripPrefixes []string
+	// AddPrefix is prepended, with one separator, to every relative path
+	// after stripping, such as a repository's name in a monorepo
+	// workspace. Absolute paths are left alone.
+	AddPrefix string
+}
+
+// PathFormatter rewrites each result's FilePath in one style before
+// handing it to the wrapped formatter, so text, JSON and the aggregating
+// formatters all print the same form. Results without a path (stdin) are
+// passed through unchanged.
+type PathFormatter struct {
+	Wrapper
+	opts PathOpts
+	cwd  string // absolute current directory, for PathRelative and PathAbsolute
+}
+
+// NewPathFormatter wraps inner to print paths in style, resolving relative
+// paths against cwd. For PathAsFound it returns inner directly.
+func NewPathFormatter(inner Formatter, style PathStyle, cwd string) Formatter {
+	return NewPathFormatterOpts(inner, PathOpts{Style: style}, cwd)
+}
+
+// NewPathFormatterOpts is NewPathFormatter with prefix rewriting. When opts
+// changes nothing it returns inner directly.
+func NewPathFormatterOpts(inner Formatter, opts PathOpts, cwd string) Formatter {
+	if opts.Style == PathAsFound && len(opts.StripPrefixes) == 0 && opts.AddPrefix == "" {
+		return inner
+	}
+	return &PathFormatter{Wrapper: Wrapper{inner}, opts: opts, cwd: cwd}
+}
+
+func (f *PathFormatter) Format(buf []byte, result Result, multiFile bool) []byte {
+	if result.FilePath != "" {
+		result.FilePath = f.path(result.FilePath)
+	}
+	return f.Inner.Format(buf, result, multiFile)
+}
+
+func (f *PathFormatter) path(p string) string {
+	p = f.styled(p)
+	if len(f.opts.StripPrefixes) > 0 {
+		p = stripPrefix(p, f.opts.StripPrefixes)
+	}
+	if f.opts.AddPrefix != "" && !filepath.IsAbs(p) {
+		p = strings.TrimSuffix(f.opts.AddPrefix, string(filepath.Separator)) + string(filepath.Separator) + p
+	}
+	return p
+}
+
+// styled returns p in the formatter's PathStyle.
+func (f *PathFormatter) styled(p string) string {
+	switch f.opts.Style {
+	case PathAsFound:
+		return p
+	case PathBasename:
+		return filepath.Base(p)
+	}
+	abs := p
+	if !filepath.IsAbs(abs) {
+		abs = filepath.Join(f.cwd, abs)
+	} else {
+		abs = filepath.Clean(abs)
+	}
+	if f.opts.Style == PathAbsolute {
+		return abs
+	}
+	rel, err := filepath.Rel(f.cwd, abs)
+	if err != nil {
+		return abs
+	}
+	return rel
+}
+
+// stripPrefix removes from p the longest of prefixes that names a
+// directory containing it. Paths are compared cleaned, so "./src/a.go" is
+// under "src"; a path equal to a prefix, or under none, is returned as is.
+func stripPrefix(p string, prefixes []string) string {
+	clean := filepath.Clean(p)
+	best := -1
+	for _, prefix := range prefixes {
+		prefix = filepath.Clean(prefix)
+		n := len(prefix)
+		if prefix == string(filepath.Separator) {
+			n = 0 // the separator after it is the root itself
+		}
+		if n > best && len(clean) > n && strings.HasPrefix(clean, prefix) && clean[n] == filepath.Separator {
+			best = n
+		}
+	}
+	if best < 0 {
+		return p
+	}
+	return clean[best+1:]
+}
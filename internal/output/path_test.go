@@ -0,0 +1,91 @@
+package output
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dl/gogrep/internal/matcher"
+)
+
+func TestPathFormatter(t *testing.T) {
+	tests := []struct {
+		style PathStyle
+		path  string
+		want  string
+	}{
+		{PathRelative, "./src/a.go", "src/a.go"},
+		{PathRelative, "/home/u/proj/src/a.go", "src/a.go"},
+		{PathRelative, "/home/u/other/a.go", "../other/a.go"},
+		{PathRelative, "../proj/a.go", "a.go"},
+		{PathAbsolute, "./src/a.go", "/home/u/proj/src/a.go"},
+		{PathAbsolute, "/x//y/../a.go", "/x/a.go"},
+		{PathBasename, "./src/a.go", "a.go"},
+		{PathBasename, "/x/y/a.go", "a.go"},
+		{PathAbsolute, "", ""}, // stdin
+	}
+	for _, tt := range tests {
+		f := NewPathFormatter(NewTextFormatter(false, false, true, false, 0), tt.style, "/home/u/proj")
+		result := Result{FilePath: tt.path, MatchSet: matcher.MatchSet{Matches: make([]matcher.Match, 1)}}
+		got := strings.TrimSuffix(string(f.Format(nil, result, true)), "\n")
+		if got != tt.want {
+			t.Errorf("style %d, %q: got %q, want %q", tt.style, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestPathFormatter_JSONAndSummary(t *testing.T) {
+	data := []byte("hello\n")
+	result := Result{
+		FilePath: "a/b.txt",
+		MatchSet: matcher.MatchSet{
+			Data:      data,
+			Matches:   []matcher.Match{{LineNum: 1, LineStart: 0, LineLen: 5, PosCount: 1}},
+			Positions: [][2]int{{0, 5}},
+		},
+	}
+
+	f := NewPathFormatter(NewJSONFormatter(), PathAbsolute, "/w")
+	if got := string(f.Format(nil, result, true)); !strings.Contains(got, `"file":"/w/a/b.txt"`) {
+		t.Errorf("JSON: got %s", got)
+	}
+
+	f = NewPathFormatter(NewWCFormatter(), PathBasename, "/w")
+	f.Format(nil, result, true)
+	result.FilePath = "c/b.txt"
+	f.Format(nil, result, true)
+	if got := string(f.(Summarizer).Summary(nil, true)); got != "2 2 12 total\n" {
+		t.Errorf("Summary: got %q", got)
+	}
+
+	if _, ok := NewPathFormatter(NewWCFormatter(), PathAsFound, "/w").(*WCFormatter); !ok {
+		t.Error("PathAsFound wrapped the formatter")
+	}
+}
+
+func TestPathFormatter_Prefixes(t *testing.T) {
+	tests := []struct {
+		opts PathOpts
+		path string
+		want string
+	}{
+		{PathOpts{StripPrefixes: []string{"/tmp/ci/abc"}}, "/tmp/ci/abc/src/a.go", "src/a.go"},
+		{PathOpts{StripPrefixes: []string{"/tmp/ci/abc/"}}, "/tmp/ci/abc/src/a.go", "src/a.go"},
+		{PathOpts{StripPrefixes: []string{"/tmp/ci/ab"}}, "/tmp/ci/abc/src/a.go", "/tmp/ci/abc/src/a.go"},
+		{PathOpts{StripPrefixes: []string{"src"}}, "./src/a.go", "a.go"},
+		{PathOpts{StripPrefixes: []string{"src"}}, "src", "src"},
+		{PathOpts{StripPrefixes: []string{"/w", "/w/proj"}}, "/w/proj/a.go", "a.go"},
+		{PathOpts{Style: PathAbsolute, StripPrefixes: []string{"/home/u"}}, "proj/a.go", "proj/a.go"},
+		{PathOpts{AddPrefix: "repo"}, "src/a.go", "repo/src/a.go"},
+		{PathOpts{AddPrefix: "repo/"}, "src/a.go", "repo/src/a.go"},
+		{PathOpts{AddPrefix: "repo"}, "/abs/a.go", "/abs/a.go"},
+		{PathOpts{StripPrefixes: []string{"/tmp/ci"}, AddPrefix: "repo"}, "/tmp/ci/a.go", "repo/a.go"},
+	}
+	for _, tt := range tests {
+		f := NewPathFormatterOpts(NewTextFormatter(false, false, true, false, 0), tt.opts, "/home/u")
+		result := Result{FilePath: tt.path, MatchSet: matcher.MatchSet{Matches: make([]matcher.Match, 1)}}
+		got := strings.TrimSuffix(string(f.Format(nil, result, true)), "\n")
+		if got != tt.want {
+			t.Errorf("%+v, %q: got %q, want %q", tt.opts, tt.path, got, tt.want)
+		}
+	}
+}
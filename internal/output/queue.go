@@ -0,0 +1,87 @@
+package output
+
+import "sync"
+
+// Queue decouples a producer from a slow Writer: formatted buffers wait in
+// a bounded queue and a goroutine writes them in order. When the queue is
+// full, Write either blocks until the consumer catches up (pause) or
+// discards the oldest queued buffer and counts it (drop-oldest), so a
+// stalled pipe never makes memory grow without bound.
+type Queue struct {
+	w          *Writer
+	limit      int
+	dropOldest bool
+
+	mu      sync.Mutex
+	cond    *sync.Cond // signaled on every push, pop and Close
+	items   [][]byte
+	closed  bool
+	dropped int64
+	done    chan struct{}
+}
+
+// NewQueue starts a queue of up to limit buffers in front of w.
+func NewQueue(w *Writer, limit int, dropOldest bool) *Queue {
+	q := &Queue{
+		w:          w,
+		limit:      max(limit, 1),
+		dropOldest: dropOldest,
+		done:       make(chan struct{}),
+	}
+	q.cond = sync.NewCond(&q.mu)
+	go q.run()
+	return q
+}
+
+// Write queues buf, which the queue takes ownership of.
+func (q *Queue) Write(buf []byte) {
+	if len(buf) == 0 {
+		return
+	}
+	q.mu.Lock()
+	for len(q.items) >= q.limit && !q.dropOldest {
+		q.cond.Wait()
+	}
+	if len(q.items) >= q.limit {
+		q.items[0] = nil
+		q.items = q.items[1:]
+		q.dropped++
+	}
+	q.items = append(q.items, buf)
+	q.cond.Broadcast()
+	q.mu.Unlock()
+}
+
+func (q *Queue) run() {
+	defer close(q.done)
+	for {
+		q.mu.Lock()
+		for len(q.items) == 0 && !q.closed {
+			q.cond.Wait()
+		}
+		if len(q.items) == 0 {
+			q.mu.Unlock()
+			return
+		}
+		buf := q.items[0]
+		q.items[0] = nil
+		q.items = q.items[1:]
+		q.cond.Broadcast()
+		q.mu.Unlock()
+
+		q.w.Write(buf)
+	}
+}
+
+// Close writes out what is queued and stops the queue. It returns the
+// number of buffers dropped because the queue was full.
+func (q *Queue) Close() int64 {
+	q.mu.Lock()
+	q.closed = true
+	q.cond.Broadcast()
+	q.mu.Unlock()
+	<-q.done
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.dropped
+}
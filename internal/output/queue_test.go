@@ -0,0 +1,84 @@
+package output
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+// blockedQueue returns a queue whose writer goroutine is stuck writing a
+// buffer larger than the pipe, and the pipe's read end.
+func blockedQueue(t *testing.T, limit int, dropOldest bool) (*Queue, *os.File, []byte) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close(); w.Close() })
+
+	big := bytes.Repeat([]byte("x"), 1<<20)
+	q := NewQueue(&Writer{fd: int(w.Fd())}, limit, dropOldest)
+	q.Write(big)
+	for {
+		q.mu.Lock()
+		n := len(q.items)
+		q.mu.Unlock()
+		if n == 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return q, r, big
+}
+
+func TestQueue_DropOldest(t *testing.T) {
+	q, r, big := blockedQueue(t, 2, true)
+	q.Write([]byte("a"))
+	q.Write([]byte("b"))
+	q.Write([]byte("c"))
+
+	got := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(io.LimitReader(r, int64(len(big)+2)))
+		got <- data
+	}()
+	if dropped := q.Close(); dropped != 1 {
+		t.Errorf("dropped = %d, want 1", dropped)
+	}
+	data := <-got
+	if !bytes.Equal(data[len(big):], []byte("bc")) {
+		t.Errorf("tail = %q, want %q", data[len(big):], "bc")
+	}
+}
+
+func TestQueue_Pause(t *testing.T) {
+	q, r, big := blockedQueue(t, 1, false)
+	q.Write([]byte("a"))
+
+	written := make(chan struct{})
+	go func() {
+		q.Write([]byte("b")) // blocks: the queue is full
+		close(written)
+	}()
+	select {
+	case <-written:
+		t.Fatal("Write did not wait for a full queue")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	got := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(io.LimitReader(r, int64(len(big)+2)))
+		got <- data
+	}()
+	<-written
+	if dropped := q.Close(); dropped != 0 {
+		t.Errorf("dropped = %d, want 0", dropped)
+	}
+	data := <-got
+	if !bytes.Equal(data[len(big):], []byte("ab")) {
+		t.Errorf("tail = %q, want %q", data[len(big):], "ab")
+	}
+}
@@ -0,0 +1,68 @@
+package output
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/dl/gogrep/internal/matcher"
+)
+
+// RedactScope selects what --redact replaces with a hash.
+type RedactScope int
+
+const (
+	RedactNone  RedactScope = iota
+	RedactMatch             // the matched text: each highlighted span
+	RedactLine              // every printed line, context lines included
+)
+
+// redactHexLen is how many hex digits of the HMAC a token keeps: 48 bits,
+// enough to tell secrets apart in one report without making the token long.
+const redactHexLen = 12
+
+// RedactFormatter replaces matched text, or whole lines, with salted hash
+// tokens before handing each result to the wrapped formatter, so every
+// output format prints the same tokens. A token is [redacted:HEX], where
+// HEX begins the HMAC-SHA256 of the replaced text keyed by the salt: equal
+// secrets get equal tokens under one salt, which lets shared reports be
+// deduplicated and compared without revealing what was found. File paths,
+// line numbers and byte offsets are kept, and offsets still refer to the
+// original file.
+type RedactFormatter struct {
+	Wrapper
+	scope RedactScope
+	salt  []byte
+}
+
+// NewRedactFormatter wraps inner to redact in scope with salt. For
+// RedactNone it returns inner directly.
+func NewRedactFormatter(inner Formatter, scope RedactScope, salt []byte) Formatter {
+	if scope == RedactNone {
+		return inner
+	}
+	return &RedactFormatter{Wrapper: Wrapper{inner}, scope: scope, salt: salt}
+}
+
+func (f *RedactFormatter) Format(buf []byte, result Result, multiFile bool) []byte {
+	if len(result.MatchSet.Matches) > 0 {
+		result.MatchSet = f.redact(result.MatchSet)
+	}
+	return f.Inner.Format(buf, result, multiFile)
+}
+
+// redact returns a copy of ms with the scope's spans replaced by tokens.
+func (f *RedactFormatter) redact(ms matcher.MatchSet) matcher.MatchSet {
+	return rewriteSpans(ms, f.scope == RedactLine, func(start, end int) string {
+		return f.token(ms.Data[start:end])
+	})
+}
+
+// token returns the redaction token for text.
+func (f *RedactFormatter) token(text []byte) string {
+	mac := hmac.New(sha256.New, f.salt)
+	mac.Write(text)
+	return "[redacted:" + hex.EncodeToString(mac.Sum(nil))[:redactHexLen] + "]"
+}
+
+var _ Formatter = (*RedactFormatter)(nil)
@@ -0,0 +1,90 @@
+package output
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/dl/gogrep/internal/matcher"
+)
+
+func redactResult() Result {
+	// "key=abc and abc" with "abc" matched twice, then a context line.
+	data := []byte("key=abc and abc\nnext line\n")
+	return Result{
+		FilePath: "f",
+		MatchSet: matcher.MatchSet{
+			Data: data,
+			Matches: []matcher.Match{
+				{LineNum: 1, LineStart: 0, LineLen: 15, PosIdx: 0, PosCount: 2},
+				{LineNum: 2, LineStart: 16, LineLen: 9, ByteOffset: 16, IsContext: true},
+			},
+			Positions: [][2]int{{4, 7}, {12, 15}},
+		},
+	}
+}
+
+func TestRedactFormatter_Match(t *testing.T) {
+	salt := []byte("s")
+	rf := &RedactFormatter{scope: RedactMatch, salt: salt}
+	tok := rf.token([]byte("abc"))
+
+	f := NewRedactFormatter(NewTextFormatter(true, false, false, false, 0), RedactMatch, salt)
+	got := string(f.Format(nil, redactResult(), false))
+	want := "1:key=" + tok + " and " + tok + "\n2-next line\n"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if strings.Contains(got, "abc") {
+		t.Errorf("matched text leaked: %q", got)
+	}
+
+	ms := rf.redact(redactResult().MatchSet)
+	n := len(tok)
+	wantPos := [][2]int{{4, 4 + n}, {9 + n, 9 + 2*n}}
+	if pos := ms.MatchPositions(0); len(pos) != 2 || pos[0] != wantPos[0] || pos[1] != wantPos[1] {
+		t.Errorf("positions: got %v, want %v", pos, wantPos)
+	}
+	if m := ms.Matches[1]; string(ms.Data[m.LineStart:m.LineStart+m.LineLen]) != "next line" || m.ByteOffset != 16 {
+		t.Errorf("context line moved wrongly: %+v", m)
+	}
+}
+
+func TestRedactFormatter_Line(t *testing.T) {
+	salt := []byte("s")
+	rf := &RedactFormatter{scope: RedactLine, salt: salt}
+	tok1 := rf.token([]byte("key=abc and abc"))
+	tok2 := rf.token([]byte("next line"))
+
+	f := NewRedactFormatter(NewJSONFormatter(), RedactLine, salt)
+	got := string(f.Format(nil, redactResult(), false))
+	for _, want := range []string{
+		`"text":"` + tok1 + `"`,
+		`"matches":[{"start":0,"end":` + strconv.Itoa(len(tok1)) + `}]`,
+		`"text":"` + tok2 + `"`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %s in %s", want, got)
+		}
+	}
+	if strings.Contains(got, "abc") || strings.Contains(got, "next") {
+		t.Errorf("line text leaked: %s", got)
+	}
+}
+
+func TestRedactFormatter_Token(t *testing.T) {
+	a := &RedactFormatter{salt: []byte("one")}
+	b := &RedactFormatter{salt: []byte("two")}
+	if a.token([]byte("x")) != a.token([]byte("x")) {
+		t.Error("token not deterministic for one salt")
+	}
+	if a.token([]byte("x")) == b.token([]byte("x")) {
+		t.Error("token does not depend on the salt")
+	}
+	if tok := a.token([]byte("x")); len(tok) != len("[redacted:]")+redactHexLen {
+		t.Errorf("token %q has the wrong length", tok)
+	}
+	if _, ok := NewRedactFormatter(NewWCFormatter(), RedactNone, nil).(*WCFormatter); !ok {
+		t.Error("RedactNone should return the inner formatter")
+	}
+}
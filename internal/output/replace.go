@@ -0,0 +1,67 @@
+package output
+
+import (
+	"github.com/dl/gogrep/internal/matcher"
+)
+
+// ReplaceFormatter prints each match's replacement, expanded from a
+// --replace template, in place of the matched text before handing the
+// result to the wrapped formatter, so every output format shows the same
+// replaced lines. Only highlighted spans change: context lines and the
+// rest of each line are kept, and byte offsets still refer to the
+// original file. Nothing is written back to the file.
+type ReplaceFormatter struct {
+	Wrapper
+	rep *matcher.Replacer
+}
+
+// NewReplaceFormatter wraps inner to replace matches with rep's template.
+func NewReplaceFormatter(inner Formatter, rep *matcher.Replacer) *ReplaceFormatter {
+	return &ReplaceFormatter{Wrapper: Wrapper{inner}, rep: rep}
+}
+
+// SetReplacer swaps the template's replacer, as watch mode does when the
+// patterns are reloaded and its groups may have moved.
+func (f *ReplaceFormatter) SetReplacer(rep *matcher.Replacer) {
+	f.rep = rep
+}
+
+func (f *ReplaceFormatter) Format(buf []byte, result Result, multiFile bool) []byte {
+	if len(result.MatchSet.Matches) > 0 {
+		result.MatchSet = f.replace(result.MatchSet)
+	}
+	return f.Inner.Format(buf, result, multiFile)
+}
+
+// replace returns a copy of ms with every highlighted span replaced. The
+// groups come from matching the span's whole line again, once per line:
+// a span the template's pattern matches at the same bounds takes that
+// match's groups, and any other (a fixed-string hit, spans merged across
+// matches) has only $0.
+func (f *ReplaceFormatter) replace(ms matcher.MatchSet) matcher.MatchSet {
+	rep := f.rep
+	var lineStart, lineEnd int
+	var locs [][]int
+	var dst []byte
+	return rewriteSpans(ms, false, func(start, end int) string {
+		if locs == nil || start < lineStart || end > lineEnd {
+			lineStart, lineEnd = lineExtent(ms.Data, start, end)
+			locs = rep.Submatches(ms.Data[lineStart:lineEnd])
+			if locs == nil {
+				locs = [][]int{}
+			}
+		}
+		line := ms.Data[lineStart:lineEnd]
+		loc := []int{start - lineStart, end - lineStart}
+		for _, l := range locs {
+			if l[0] == loc[0] && l[1] == loc[1] {
+				loc = l
+				break
+			}
+		}
+		dst = rep.Expand(dst[:0], line, loc)
+		return string(dst)
+	})
+}
+
+var _ Formatter = (*ReplaceFormatter)(nil)
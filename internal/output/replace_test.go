@@ -0,0 +1,52 @@
+package output
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dl/gogrep/internal/matcher"
+)
+
+func TestReplaceFormatter(t *testing.T) {
+	rep, err := matcher.NewReplacer("$2=$1", []string{`(\w+)=(\w+)`}, false, false, false, matcher.DialectDefault, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("a=1 and b=22\nnext line\n")
+	result := Result{
+		FilePath: "f",
+		MatchSet: matcher.MatchSet{
+			Data: data,
+			Matches: []matcher.Match{
+				{LineNum: 1, LineStart: 0, LineLen: 12, PosIdx: 0, PosCount: 2},
+				{LineNum: 2, LineStart: 13, LineLen: 9, ByteOffset: 13, IsContext: true},
+			},
+			Positions: [][2]int{{0, 3}, {8, 12}},
+		},
+	}
+
+	f := NewReplaceFormatter(NewTextFormatter(true, false, false, false, 0), rep)
+	if got, want := string(f.Format(nil, result, false)), "1:1=a and 22=b\n2-next line\n"; got != want {
+		t.Errorf("text: got %q, want %q", got, want)
+	}
+
+	f = NewReplaceFormatter(NewJSONFormatter(), rep)
+	got := string(f.Format(nil, result, false))
+	for _, want := range []string{
+		`"text":"1=a and 22=b"`,
+		`"matches":[{"start":0,"end":3},{"start":8,"end":12}]`,
+		`"text":"next line"`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %s in %s", want, got)
+		}
+	}
+
+	// A span the pattern does not match at the same bounds has only $0:
+	// its groups expand to nothing.
+	result.MatchSet.Positions = [][2]int{{2, 3}, {8, 12}}
+	f = NewReplaceFormatter(NewTextFormatter(false, false, false, false, 0), rep)
+	if got, want := string(f.Format(nil, result, false)), "a== and 22=b\nnext line\n"; got != want {
+		t.Errorf("partial span: got %q, want %q", got, want)
+	}
+}
@@ -1,21 +1,56 @@
 package output
 
-import "github.com/dl/gogrep/internal/matcher"
+import (
+	"github.com/dl/gogrep/internal/input"
+	"github.com/dl/gogrep/internal/matcher"
+)
 
 // Result aggregates the matches found in a single file.
 type Result struct {
 	FilePath string
+	// Root is the label of the walk root the file was found under
+	// (walker.FileEntry.Root), or "" outside a recursive walk.
+	Root     string
 	SeqNum   int
 	MatchSet matcher.MatchSet
 	// MatchCount holds the count for -c mode without building Match structs.
 	// When set to 0 (default), len(MatchSet.Matches) is used instead.
 	MatchCount int
-	Err        error
+	// Counted marks a -c result for a file that was searched, so that a
+	// count of 0 is printed, as grep does, rather than nothing.
+	Counted bool
+	// Binary marks results from files detected as binary and searched
+	// anyway (-a). Formatters apply output safeguards to these.
+	Binary bool
+	// Hash is the hex SHA-256 of the file's content, set for matching
+	// files in -l mode with --print-hash.
+	Hash string
+	// Stat is the file's metadata, captured when it was read.
+	Stat input.FileStat
+	// Size is the number of bytes searched: 0 when the file could not be
+	// read or was skipped as binary.
+	Size int64
+	Err  error
 	// Closer releases the underlying buffer that MatchSet.Data points into.
-	// Must be called after the result has been fully formatted/consumed.
+	// Must be called after the result has been fully formatted/consumed;
+	// MatchSet.Data must not be read afterwards. Use Detach to keep a
+	// result beyond that point.
 	Closer func()
 }
 
+// Detach makes r independent of the file buffer: the match set is copied
+// (see matcher.MatchSet.Detach) and the buffer released. Afterwards r can
+// be kept, queued or formatted at any time, at the cost of one copy of the
+// matched snippets.
+func (r *Result) Detach() {
+	if r.Closer == nil {
+		return
+	}
+	r.MatchSet = r.MatchSet.Detach()
+	r.Closer()
+	r.Closer = nil
+}
+
 // Count returns the number of matches in this result.
 func (r *Result) Count() int {
 	if r.MatchCount > 0 {
@@ -0,0 +1,112 @@
+package output
+
+import (
+	"sort"
+
+	"github.com/dl/gogrep/internal/matcher"
+)
+
+// spanEdit replaces data[start:end] with text.
+type spanEdit struct {
+	start, end int
+	text       string
+	shift      int // change in length from the edits before this one
+}
+
+// rewriteSpans returns a copy of ms whose Data has each match's highlighted
+// spans, or with lines set its whole printed lines, replaced by the text
+// that fill returns for them, with every match's line bounds and positions
+// moved to match. The rest of Data is kept, so formatters that look past a
+// snippet (line extents, clip markers, context windows) see the same
+// surroundings. RedactFormatter and ReplaceFormatter share it.
+func rewriteSpans(ms matcher.MatchSet, lines bool, fill func(start, end int) string) matcher.MatchSet {
+	var edits []spanEdit
+	for i := range ms.Matches {
+		m := &ms.Matches[i]
+		if m.LineStart < 0 {
+			continue
+		}
+		if lines {
+			start, end := lineExtent(ms.Data, m.LineStart, m.LineStart+m.LineLen)
+			edits = append(edits, spanEdit{start: start, end: end})
+			continue
+		}
+		for _, p := range ms.MatchPositions(i) {
+			edits = append(edits, spanEdit{start: m.LineStart + p[0], end: m.LineStart + p[1]})
+		}
+	}
+	if len(edits) == 0 {
+		return ms
+	}
+
+	// Sort, then drop duplicates and overlaps: a line printed twice, or
+	// spans that touch, are replaced once.
+	sort.Slice(edits, func(i, j int) bool { return edits[i].start < edits[j].start })
+	kept := edits[:0]
+	for _, e := range edits {
+		if n := len(kept); n > 0 && e.start < kept[n-1].end {
+			kept[n-1].end = max(kept[n-1].end, e.end)
+			continue
+		}
+		kept = append(kept, e)
+	}
+	edits = kept
+
+	data := make([]byte, 0, len(ms.Data))
+	prev := 0
+	for i := range edits {
+		e := &edits[i]
+		e.text = fill(e.start, e.end)
+		e.shift = len(data) - prev
+		data = append(data, ms.Data[prev:e.start]...)
+		data = append(data, e.text...)
+		prev = e.end
+	}
+	data = append(data, ms.Data[prev:]...)
+
+	// newPos maps an offset outside or at the bounds of an edit, finding
+	// the first edit that ends after it by binary search.
+	newPos := func(off int) int {
+		i := sort.Search(len(edits), func(i int) bool { return edits[i].end > off })
+		if i == len(edits) {
+			return off + len(data) - len(ms.Data)
+		}
+		if e := edits[i]; e.start < off {
+			off = e.start // inside a replaced span: its start
+		}
+		return off + edits[i].shift
+	}
+
+	out := matcher.MatchSet{Data: data, Matches: make([]matcher.Match, len(ms.Matches))}
+	for i, m := range ms.Matches {
+		out.Matches[i] = m
+		if m.LineStart < 0 {
+			continue
+		}
+		start, end := m.LineStart, m.LineStart+m.LineLen
+		if lines {
+			start, end = lineExtent(ms.Data, start, end)
+		}
+		nm := &out.Matches[i]
+		nm.LineStart = newPos(start)
+		nm.LineLen = newPos(end) - nm.LineStart
+
+		positions := ms.MatchPositions(i)
+		if lines && len(positions) > 0 {
+			positions = [][2]int{{0, nm.LineLen}}
+		}
+		nm.PosIdx, nm.PosCount = len(out.Positions), 0
+		for _, p := range positions {
+			if !lines {
+				p = [2]int{newPos(m.LineStart+p[0]) - nm.LineStart, newPos(m.LineStart+p[1]) - nm.LineStart}
+			}
+			// Merged spans map several positions to one replacement.
+			if n := len(out.Positions); nm.PosCount > 0 && out.Positions[n-1] == p {
+				continue
+			}
+			out.Positions = append(out.Positions, p)
+			nm.PosCount++
+		}
+	}
+	return out
+}
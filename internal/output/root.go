@@ -0,0 +1,73 @@
+package output
+
+// RootTotal is what a search found under one walk root.
+type RootTotal struct {
+	Root    string // the root's label (Result.Root)
+	Files   int    // files searched
+	Matched int    // files with a match
+	Lines   int    // matching lines, or the -c counts; under -l, Matched again
+}
+
+// RootCounter wraps a formatter to total the results of each walk root,
+// so that a search over several roots can say what each contributed.
+// Results are forwarded unchanged.
+type RootCounter struct {
+	Wrapper
+	totals []RootTotal
+	index  map[string]int // label -> position in totals
+}
+
+// NewRootCounter wraps inner to count results by root. roots lists the
+// labels in walk order, so that Totals reports them in that order, even
+// those under which nothing was found; a label not listed is added as
+// it is first seen.
+func NewRootCounter(inner Formatter, roots []string) *RootCounter {
+	c := &RootCounter{Wrapper: Wrapper{inner}, index: make(map[string]int, len(roots))}
+	for _, r := range roots {
+		c.total(r)
+	}
+	return c
+}
+
+func (c *RootCounter) Format(buf []byte, result Result, multiFile bool) []byte {
+	t := c.total(result.Root)
+	t.Files++
+	if result.HasMatch() {
+		t.Matched++
+		t.Lines += matchingLines(result)
+	}
+	return c.Inner.Format(buf, result, multiFile)
+}
+
+// Totals returns the totals of every root, in walk order.
+func (c *RootCounter) Totals() []RootTotal {
+	return c.totals
+}
+
+// total returns the totals for root, adding them if they are new.
+func (c *RootCounter) total(root string) *RootTotal {
+	i, ok := c.index[root]
+	if !ok {
+		i = len(c.totals)
+		c.index[root] = i
+		c.totals = append(c.totals, RootTotal{Root: root})
+	}
+	return &c.totals[i]
+}
+
+// matchingLines counts the matching lines of result, leaving out context
+// lines and separators; a -c result gives its count.
+func matchingLines(result Result) int {
+	if result.MatchCount > 0 {
+		return result.MatchCount
+	}
+	n := 0
+	for _, m := range result.MatchSet.Matches {
+		if !m.IsContext && m.LineStart >= 0 {
+			n++
+		}
+	}
+	return n
+}
+
+var _ Formatter = (*RootCounter)(nil)
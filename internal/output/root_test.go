@@ -0,0 +1,66 @@
+package output
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dl/gogrep/internal/matcher"
+)
+
+func TestRootLabels(t *testing.T) {
+	data := []byte("foo\nbar\n")
+	result := Result{FilePath: "x.go", Root: "repo", MatchSet: matcher.MatchSet{
+		Data: data,
+		Matches: []matcher.Match{
+			{LineNum: 1, LineStart: 0, LineLen: 3, IsContext: true},
+			{LineNum: 2, LineStart: 4, LineLen: 3, ByteOffset: 4},
+		},
+	}}
+
+	tf := NewTextFormatter(true, false, false, false, 0)
+	tf.SetOptions(TextOpts{RootLabels: true})
+	if got, want := string(tf.Format(nil, result, true)), "repo-x.go-1-foo\nrepo:x.go:2:bar\n"; got != want {
+		t.Errorf("text = %q, want %q", got, want)
+	}
+	tf = NewTextFormatter(false, true, false, false, 0)
+	tf.SetOptions(TextOpts{RootLabels: true})
+	if got, want := string(tf.Format(nil, result, true)), "repo:x.go:2\n"; got != want {
+		t.Errorf("count = %q, want %q", got, want)
+	}
+
+	jf := NewJSONFormatter()
+	if got := string(jf.Format(nil, result, true)); strings.Contains(got, `"root"`) {
+		t.Errorf("root without SetRoots: %s", got)
+	}
+	jf.SetRoots(true)
+	if got := string(jf.Format(nil, result, true)); strings.Count(got, `"root":"repo"`) != 3 {
+		t.Errorf("want root in the block, context and match records: %s", got)
+	}
+}
+
+func TestRootCounter(t *testing.T) {
+	c := NewRootCounter(NewTextFormatter(false, true, false, false, 0), []string{"a", "b", "c"})
+	for _, r := range []Result{
+		{FilePath: "1", Root: "b", MatchCount: 3},
+		{FilePath: "2", Root: "b"},
+		{FilePath: "3", Root: "a", MatchCount: 1},
+		{FilePath: "4", Root: "d", MatchCount: 2},
+	} {
+		c.Format(nil, r, true)
+	}
+	want := []RootTotal{
+		{Root: "a", Files: 1, Matched: 1, Lines: 1},
+		{Root: "b", Files: 2, Matched: 1, Lines: 3},
+		{Root: "c"},
+		{Root: "d", Files: 1, Matched: 1, Lines: 2},
+	}
+	got := c.Totals()
+	if len(got) != len(want) {
+		t.Fatalf("totals = %+v", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("totals[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
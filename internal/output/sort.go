@@ -0,0 +1,53 @@
+package output
+
+import (
+	"cmp"
+	"slices"
+)
+
+// SortKey selects the order of --sort and --sortr.
+type SortKey int
+
+const (
+	SortNone     SortKey = iota // search order (default)
+	SortPath                    // by path, byte-wise
+	SortSize                    // by file size, smallest first
+	SortModified                // by modification time, oldest first
+	SortCreated                 // by creation time, oldest first
+)
+
+// SortResults sorts results by key, or in reverse with reverse set; ties
+// go by path. Size and modification time come from each result's Stat,
+// taken when the file was read. Creation time is not part of it and is
+// looked up here, one statx per result; a file whose filesystem does not
+// record it sorts as the oldest.
+func SortResults(results []Result, key SortKey, reverse bool) {
+	if key == SortNone {
+		return
+	}
+	var created map[string]int64
+	if key == SortCreated {
+		created = make(map[string]int64, len(results))
+		for _, r := range results {
+			created[r.FilePath], _ = birthTime(r.FilePath)
+		}
+	}
+	slices.SortStableFunc(results, func(a, b Result) int {
+		var c int
+		switch key {
+		case SortSize:
+			c = cmp.Compare(a.Stat.Size, b.Stat.Size)
+		case SortModified:
+			c = cmp.Compare(a.Stat.Mtime, b.Stat.Mtime)
+		case SortCreated:
+			c = cmp.Compare(created[a.FilePath], created[b.FilePath])
+		}
+		if c == 0 {
+			c = cmp.Compare(a.FilePath, b.FilePath)
+		}
+		if reverse {
+			return -c
+		}
+		return c
+	})
+}
@@ -0,0 +1,40 @@
+package output
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/dl/gogrep/internal/input"
+)
+
+func TestSortResults(t *testing.T) {
+	results := []Result{
+		{FilePath: "b", Stat: input.FileStat{Size: 30, Mtime: 1}},
+		{FilePath: "c", Stat: input.FileStat{Size: 10, Mtime: 3}},
+		{FilePath: "a", Stat: input.FileStat{Size: 30, Mtime: 2}},
+	}
+	tests := []struct {
+		key     SortKey
+		reverse bool
+		want    []string
+	}{
+		{SortNone, false, []string{"b", "c", "a"}},
+		{SortPath, false, []string{"a", "b", "c"}},
+		{SortPath, true, []string{"c", "b", "a"}},
+		{SortSize, false, []string{"c", "a", "b"}},
+		{SortSize, true, []string{"b", "a", "c"}},
+		{SortModified, false, []string{"b", "a", "c"}},
+		{SortModified, true, []string{"c", "a", "b"}},
+	}
+	for _, tt := range tests {
+		rs := slices.Clone(results)
+		SortResults(rs, tt.key, tt.reverse)
+		var got []string
+		for _, r := range rs {
+			got = append(got, r.FilePath)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("key %d, reverse %v: %v, want %v", tt.key, tt.reverse, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package output
+
+// SearchTotals is what a whole search found.
+type SearchTotals struct {
+	Files   int   // files searched
+	Matched int   // files with a match
+	Lines   int   // matching lines, or the -c counts; under -l, Matched again
+	Bytes   int64 // bytes searched (Result.Size)
+}
+
+// SearchCounter wraps a formatter to total every result of a search, for
+// --stats. Results are forwarded unchanged.
+type SearchCounter struct {
+	Wrapper
+	totals SearchTotals
+}
+
+// NewSearchCounter wraps inner to total its results.
+func NewSearchCounter(inner Formatter) *SearchCounter {
+	return &SearchCounter{Wrapper: Wrapper{inner}}
+}
+
+func (c *SearchCounter) Format(buf []byte, result Result, multiFile bool) []byte {
+	c.Add(result)
+	return c.Inner.Format(buf, result, multiFile)
+}
+
+// Add counts result without formatting it, for a caller that does not
+// format results without matches.
+func (c *SearchCounter) Add(result Result) {
+	c.totals.Files++
+	c.totals.Bytes += result.Size
+	if result.HasMatch() {
+		c.totals.Matched++
+		c.totals.Lines += matchingLines(result)
+	}
+}
+
+// Totals returns the totals of the results formatted so far.
+func (c *SearchCounter) Totals() SearchTotals {
+	return c.totals
+}
+
+var _ Formatter = (*SearchCounter)(nil)
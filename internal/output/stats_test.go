@@ -0,0 +1,31 @@
+package output
+
+import (
+	"testing"
+
+	"github.com/dl/gogrep/internal/matcher"
+)
+
+func TestSearchCounter(t *testing.T) {
+	data := []byte("foo\nbar\nfoo\n")
+	c := NewSearchCounter(NewTextFormatter(false, false, false, false, 0))
+	for _, r := range []Result{
+		{FilePath: "1", Size: 12, MatchSet: matcher.MatchSet{
+			Data: data,
+			Matches: []matcher.Match{
+				{LineNum: 1, LineStart: 0, LineLen: 3},
+				{LineNum: 2, LineStart: 4, LineLen: 3, ByteOffset: 4, IsContext: true},
+				{LineNum: 3, LineStart: 8, LineLen: 3, ByteOffset: 8},
+			},
+		}},
+		{FilePath: "2", Size: 100},
+		{FilePath: "3", Size: 5, MatchCount: 4},
+		{FilePath: "4"},
+	} {
+		c.Format(nil, r, true)
+	}
+	want := SearchTotals{Files: 4, Matched: 2, Lines: 6, Bytes: 117}
+	if got := c.Totals(); got != want {
+		t.Errorf("Totals = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,24 @@
+package output
+
+import "golang.org/x/sys/unix"
+
+// IsTerminal checks if the given file descriptor is a terminal using ioctl.
+func IsTerminal(fd uintptr) bool {
+	_, err := unix.IoctlGetTermios(int(fd), unix.TCGETS)
+	return err == nil
+}
+
+// writev writes iovs to fd with a single writev(2).
+func writev(fd int, iovs [][]byte) (int, error) {
+	return unix.Writev(fd, iovs)
+}
+
+// birthTime returns the creation time of path in nanoseconds since the
+// Unix epoch, if its filesystem records one.
+func birthTime(path string) (int64, bool) {
+	var stx unix.Statx_t
+	if err := unix.Statx(unix.AT_FDCWD, path, unix.AT_STATX_DONT_SYNC, unix.STATX_BTIME, &stx); err != nil || stx.Mask&unix.STATX_BTIME == 0 {
+		return 0, false
+	}
+	return stx.Btime.Sec*1e9 + int64(stx.Btime.Nsec), true
+}
@@ -0,0 +1,40 @@
+//go:build !linux
+
+package output
+
+import (
+	"io/fs"
+	"os"
+	"syscall"
+)
+
+// IsTerminal reports whether fd, one of the standard streams, is a
+// character device. Without termios this is the best portable guess.
+func IsTerminal(fd uintptr) bool {
+	for _, f := range []*os.File{os.Stdin, os.Stdout, os.Stderr} {
+		if f.Fd() == fd {
+			fi, err := f.Stat()
+			return err == nil && fi.Mode()&fs.ModeCharDevice != 0
+		}
+	}
+	return false
+}
+
+// writev writes the buffers in turn; there is no scatter-gather write.
+func writev(fd int, iovs [][]byte) (int, error) {
+	total := 0
+	for _, b := range iovs {
+		n, err := syscall.Write(fd, b)
+		total += n
+		if err != nil || n < len(b) {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// birthTime would return the creation time of path; it is not available
+// without statx.
+func birthTime(path string) (int64, bool) {
+	return 0, false
+}
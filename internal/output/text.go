@@ -9,6 +9,47 @@ import (
 // separatorLine is the shared "--" separator text for context groups.
 var separatorLine = []byte("--")
 
+// TextOpts holds optional TextFormatter settings beyond the constructor flags.
+type TextOpts struct {
+	// DisplayWidth measures maxColumns in terminal columns instead of bytes.
+	// Truncation windows never split a UTF-8 codepoint and wide (CJK)
+	// characters count as two columns.
+	DisplayWidth bool
+	// BinaryRaw disables the safeguards applied to binary results:
+	// NUL replacement and the forced column limit.
+	BinaryRaw bool
+	// GroupSeparator replaces the "--" line printed between context groups.
+	// nil keeps the default.
+	GroupSeparator []byte
+	// ClipMarkers prints clipMarker where a snippet starts or ends inside
+	// a line, as with --context-bytes windows.
+	ClipMarkers bool
+	// PrintPositions ends each matching line with a tab and the byte
+	// ranges of its matches, as written by appendPositions.
+	PrintPositions bool
+	// RootLabels prints each result's Root before its file name, wherever
+	// the name is printed, followed by the same separator.
+	RootLabels bool
+	// ByteOffset prints the file offset of each line's text after its line
+	// number, as grep -b does.
+	ByteOffset bool
+	// NullNames ends every file name with a NUL instead of the ':' or '-'
+	// after it, or instead of the newline with -l, so that names holding
+	// those characters can be split off safely, as by xargs -0.
+	NullNames bool
+}
+
+// clipMarker flags snippet edges that cut through a line.
+var clipMarker = []byte("…")
+
+// binaryMaxColumns caps line output for binary results unless BinaryRaw is
+// set, since a single binary "line" can span hundreds of megabytes.
+const binaryMaxColumns = 200
+
+// binaryNULReplacement stands in for NUL bytes in binary results. It has the
+// same width as NUL so highlight positions stay valid.
+const binaryNULReplacement = '.'
+
 // TextFormatter formats results as human-readable text with optional color.
 type TextFormatter struct {
 	lineNumbers bool
@@ -16,6 +57,7 @@ type TextFormatter struct {
 	filesOnly   bool
 	useColor    bool
 	maxColumns  int
+	opts        TextOpts
 }
 
 // NewTextFormatter creates a TextFormatter.
@@ -29,24 +71,38 @@ func NewTextFormatter(lineNumbers bool, countOnly bool, filesOnly bool, useColor
 	}
 }
 
+// SetOptions applies optional settings to the formatter.
+func (f *TextFormatter) SetOptions(opts TextOpts) {
+	f.opts = opts
+}
+
 func (f *TextFormatter) Format(buf []byte, result Result, multiFile bool) []byte {
 	if f.filesOnly {
 		if result.HasMatch() {
+			if result.Hash != "" {
+				// sha256sum layout, so the list feeds the usual tools.
+				buf = append(buf, result.Hash...)
+				buf = append(buf, "  "...)
+			}
+			buf = f.appendRoot(buf, result.Root, ":")
 			buf = append(buf, result.FilePath...)
-			buf = append(buf, '\n')
-			return buf
+			if f.opts.NullNames {
+				return append(buf, 0)
+			}
+			return append(buf, '\n')
 		}
 		return buf
 	}
 
 	if f.countOnly {
 		count := result.Count()
-		if count == 0 {
+		if count == 0 && !result.Counted {
 			return buf
 		}
 		if multiFile {
+			buf = f.appendRoot(buf, result.Root, ":")
 			buf = append(buf, result.FilePath...)
-			buf = append(buf, ':')
+			buf = append(buf, f.nameEnd(":")...)
 		}
 		buf = strconv.AppendInt(buf, int64(count), 10)
 		buf = append(buf, '\n')
@@ -54,23 +110,70 @@ func (f *TextFormatter) Format(buf []byte, result Result, multiFile bool) []byte
 	}
 
 	ms := &result.MatchSet
+	binary := result.Binary && !f.opts.BinaryRaw
 	for i := range ms.Matches {
-		buf = f.formatMatch(buf, result.FilePath, ms, i, multiFile)
+		buf = f.formatMatch(buf, result.Root, result.FilePath, ms, i, multiFile, binary)
 	}
 	return buf
 }
 
-func (f *TextFormatter) formatMatch(buf []byte, filePath string, ms *matcher.MatchSet, idx int, multiFile bool) []byte {
+// appendRoot appends root and sep with RootLabels, colored as a file name
+// and its separator are.
+func (f *TextFormatter) appendRoot(buf []byte, root, sep string) []byte {
+	if !f.opts.RootLabels || root == "" {
+		return buf
+	}
+	if f.useColor {
+		buf = append(buf, ansiMagenta...)
+		buf = append(buf, root...)
+		buf = append(buf, ansiReset...)
+		buf = append(buf, ansiCyan...)
+		buf = append(buf, sep...)
+		return append(buf, ansiReset...)
+	}
+	buf = append(buf, root...)
+	return append(buf, sep...)
+}
+
+// appendName appends the root label, if any, and filePath, each followed
+// by sep.
+func (f *TextFormatter) appendName(buf []byte, root, filePath, sep string) []byte {
+	buf = f.appendRoot(buf, root, sep)
+	if f.useColor {
+		buf = append(buf, ansiMagenta...)
+		buf = append(buf, filePath...)
+		buf = append(buf, ansiReset...)
+		buf = append(buf, ansiCyan...)
+		buf = append(buf, f.nameEnd(sep)...)
+		return append(buf, ansiReset...)
+	}
+	buf = append(buf, filePath...)
+	return append(buf, f.nameEnd(sep)...)
+}
+
+// nameEnd returns what follows a file name: sep, or a NUL with NullNames.
+func (f *TextFormatter) nameEnd(sep string) string {
+	if f.opts.NullNames {
+		return "\x00"
+	}
+	return sep
+}
+
+func (f *TextFormatter) formatMatch(buf []byte, root, filePath string, ms *matcher.MatchSet, idx int, multiFile bool, binary bool) []byte {
 	m := &ms.Matches[idx]
 
-	// Resolve line bytes: separator sentinel or normal line
-	var lineBytes []byte
+	// A separator sentinel prints alone, without file name or line number.
 	if m.LineStart < 0 {
-		lineBytes = separatorLine
-	} else {
-		lineBytes = ms.Data[m.LineStart : m.LineStart+m.LineLen]
+		if f.opts.GroupSeparator != nil {
+			buf = append(buf, f.opts.GroupSeparator...)
+		} else {
+			buf = append(buf, separatorLine...)
+		}
+		return append(buf, '\n')
 	}
+	lineBytes := ms.Data[m.LineStart : m.LineStart+m.LineLen]
 	positions := ms.MatchPositions(idx)
+	matchPositions := positions // before any truncation window
 
 	sep := ":"
 	if m.IsContext {
@@ -79,70 +182,172 @@ func (f *TextFormatter) formatMatch(buf []byte, filePath string, ms *matcher.Mat
 
 	// Filename prefix
 	if multiFile {
+		buf = f.appendName(buf, root, filePath, sep)
+	}
+
+	// Line number
+	if f.lineNumbers {
 		if f.useColor {
-			buf = append(buf, ansiMagenta...)
-			buf = append(buf, filePath...)
+			buf = append(buf, ansiGreen...)
+			buf = strconv.AppendInt(buf, int64(m.LineNum), 10)
 			buf = append(buf, ansiReset...)
 			buf = append(buf, ansiCyan...)
 			buf = append(buf, sep...)
 			buf = append(buf, ansiReset...)
 		} else {
-			buf = append(buf, filePath...)
+			buf = strconv.AppendInt(buf, int64(m.LineNum), 10)
 			buf = append(buf, sep...)
 		}
 	}
 
-	// Line number
-	if f.lineNumbers {
+	maxColumns := f.maxColumns
+	if binary && (maxColumns <= 0 || maxColumns > binaryMaxColumns) {
+		maxColumns = binaryMaxColumns
+	}
+
+	// Truncate line content if needed, centering around the first match
+	cut := 0 // bytes of lineBytes cut off before the window
+	if maxColumns > 0 && len(lineBytes) > maxColumns && f.needsTruncate(lineBytes, maxColumns) {
+		var winStart, winEnd int
+		if f.opts.DisplayWidth {
+			// Snippets cut by the matcher may start or end inside a rune.
+			trimStart, trimEnd := trimPartialRunes(lineBytes)
+			winStart, winEnd = truncateWindowWidth(lineBytes[trimStart:trimEnd], shiftPositions(positions, trimStart), maxColumns)
+			winStart += trimStart
+			winEnd += trimStart
+		} else {
+			winStart, winEnd = truncateWindow(lineBytes, positions, maxColumns)
+		}
+		lineBytes = lineBytes[winStart:winEnd]
+		positions = clipPositions(positions, winStart, len(lineBytes))
+		cut = winStart
+	}
+
+	// Byte offset of the text printed, as JSON's byte_offset: the line's
+	// start, the match's with -o, or the start of a truncation window.
+	if f.opts.ByteOffset {
+		offset := m.ByteOffset + int64(cut)
 		if f.useColor {
 			buf = append(buf, ansiGreen...)
-			buf = strconv.AppendInt(buf, int64(m.LineNum), 10)
+			buf = strconv.AppendInt(buf, offset, 10)
 			buf = append(buf, ansiReset...)
 			buf = append(buf, ansiCyan...)
 			buf = append(buf, sep...)
 			buf = append(buf, ansiReset...)
 		} else {
-			buf = strconv.AppendInt(buf, int64(m.LineNum), 10)
+			buf = strconv.AppendInt(buf, offset, 10)
 			buf = append(buf, sep...)
 		}
 	}
 
-	// Truncate line content if needed, centering around the first match
-	if f.maxColumns > 0 && len(lineBytes) > f.maxColumns {
-		winStart, winEnd := truncateWindow(lineBytes, positions, f.maxColumns)
-		lineBytes = lineBytes[winStart:winEnd]
-		// Shift positions into the window and clip
-		var clipped [][2]int
-		for _, pos := range positions {
-			s := pos[0] - winStart
-			e := pos[1] - winStart
-			if e <= 0 {
-				continue
-			}
-			if s >= len(lineBytes) {
-				break
-			}
-			if s < 0 {
-				s = 0
-			}
-			if e > len(lineBytes) {
-				e = len(lineBytes)
-			}
-			clipped = append(clipped, [2]int{s, e})
-		}
-		positions = clipped
+	clipLeft, clipRight := false, false
+	if f.opts.ClipMarkers {
+		end := m.LineStart + m.LineLen
+		clipLeft = m.LineStart > 0 && ms.Data[m.LineStart-1] != '\n'
+		clipRight = end < len(ms.Data) && ms.Data[end] != '\n'
+	}
+	if clipLeft {
+		buf = append(buf, clipMarker...)
 	}
 
 	// Line content with match highlighting
+	lineOut := len(buf)
 	if f.useColor && len(positions) > 0 {
 		buf = f.highlightMatches(buf, lineBytes, positions)
 	} else {
 		buf = append(buf, lineBytes...)
 	}
+	if binary {
+		for i := lineOut; i < len(buf); i++ {
+			if buf[i] == 0 {
+				buf[i] = binaryNULReplacement
+			}
+		}
+	}
+	if clipRight {
+		buf = append(buf, clipMarker...)
+	}
+	if f.opts.PrintPositions && len(matchPositions) > 0 {
+		// The matcher may have cut the line to a snippet; ranges count
+		// from the line's real start.
+		lineStart, _ := lineExtent(ms.Data, m.LineStart, m.LineStart+m.LineLen)
+		buf = append(buf, '\t')
+		buf = appendPositions(buf, matchPositions, m.LineStart-lineStart)
+	}
 	buf = append(buf, '\n')
 	return buf
 }
 
+// appendPositions appends positions, shifted by base, as comma-separated
+// half-open byte ranges: "4-7,12-15" for [4,7) and [12,15). The format
+// has no spaces and no other punctuation, so a consumer can take
+// everything after the line's last tab and split on ',' and '-'.
+func appendPositions(buf []byte, positions [][2]int, base int) []byte {
+	for i, pos := range positions {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		buf = strconv.AppendInt(buf, int64(base+pos[0]), 10)
+		buf = append(buf, '-')
+		buf = strconv.AppendInt(buf, int64(base+pos[1]), 10)
+	}
+	return buf
+}
+
+// needsTruncate reports whether line exceeds maxColumns. In display-width
+// mode a line can be longer than maxColumns bytes yet still fit, since
+// multi-byte runes occupy fewer columns than bytes.
+func (f *TextFormatter) needsTruncate(line []byte, maxColumns int) bool {
+	if !f.opts.DisplayWidth {
+		return true
+	}
+	return displayWidth(line) > maxColumns
+}
+
+// clipPositions shifts positions into the window of n bytes starting at
+// start and clips them to it, dropping those outside.
+func clipPositions(positions [][2]int, start, n int) [][2]int {
+	var clipped [][2]int
+	for _, pos := range positions {
+		s := pos[0] - start
+		e := pos[1] - start
+		if e <= 0 {
+			continue
+		}
+		if s >= n {
+			break
+		}
+		if s < 0 {
+			s = 0
+		}
+		if e > n {
+			e = n
+		}
+		clipped = append(clipped, [2]int{s, e})
+	}
+	return clipped
+}
+
+// shiftPositions rebases positions by -off, dropping any that end at or
+// before the new origin.
+func shiftPositions(positions [][2]int, off int) [][2]int {
+	if off == 0 {
+		return positions
+	}
+	shifted := make([][2]int, 0, len(positions))
+	for _, pos := range positions {
+		s, e := pos[0]-off, pos[1]-off
+		if e <= 0 {
+			continue
+		}
+		if s < 0 {
+			s = 0
+		}
+		shifted = append(shifted, [2]int{s, e})
+	}
+	return shifted
+}
+
 // truncateWindow computes a [start, end) byte window of maxCols bytes
 // centered on the first match position.
 func truncateWindow(line []byte, positions [][2]int, maxCols int) (int, int) {
@@ -0,0 +1,148 @@
+package output
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/dl/gogrep/internal/matcher"
+)
+
+// watchCount is a file's matching lines since the watch started, and
+// since the last summary.
+type watchCount struct {
+	total, recent int
+}
+
+// WatchSummaryFormatter aggregates watch mode's results into periodic
+// counts instead of printing matching lines. Format records each result
+// and writes nothing; Summary prints the lines matched since the previous
+// summary and since the start, in total, per file (sorted by path) and,
+// given PatternStats, per pattern, then starts a new interval. Summary
+// prints nothing when no line matched in the interval, so a quiet log
+// leaves the terminal alone.
+type WatchSummaryFormatter struct {
+	files map[string]*watchCount
+	total watchCount
+	stats *matcher.PatternStats
+	last  []matcher.PatternTotal // stats at the previous summary
+	now   func() time.Time
+}
+
+// NewWatchSummaryFormatter creates a WatchSummaryFormatter. stats, if not
+// nil, receives every matching line, to break the counts down by pattern.
+func NewWatchSummaryFormatter(stats *matcher.PatternStats) *WatchSummaryFormatter {
+	return &WatchSummaryFormatter{
+		files: make(map[string]*watchCount),
+		stats: stats,
+		now:   time.Now,
+	}
+}
+
+// SetPatternStats replaces the per-pattern counters, as when the patterns
+// are reloaded. Pattern counts start again from zero.
+func (f *WatchSummaryFormatter) SetPatternStats(stats *matcher.PatternStats) {
+	f.stats = stats
+	f.last = nil
+}
+
+func (f *WatchSummaryFormatter) Format(buf []byte, result Result, multiFile bool) []byte {
+	ms := &result.MatchSet
+	count := 0
+	var lines []byte
+	for i := range ms.Matches {
+		m := &ms.Matches[i]
+		if m.IsContext || m.LineStart < 0 {
+			continue
+		}
+		count++
+		if f.stats != nil {
+			lines = append(lines, ms.LineBytes(i)...)
+			lines = append(lines, '\n')
+		}
+	}
+	if count == 0 {
+		return buf
+	}
+	if f.stats != nil {
+		f.stats.Add(lines)
+	}
+	c := f.files[result.FilePath]
+	if c == nil {
+		c = &watchCount{}
+		f.files[result.FilePath] = c
+	}
+	c.total += count
+	c.recent += count
+	f.total.total += count
+	f.total.recent += count
+	return buf
+}
+
+// Summary appends the counts of the interval that ends now, as
+//
+//	[15:04:05] 3 new matching lines, 10 in total
+//	  app.log: 2 new, 7 in total
+//	  pattern "ERROR": 1 new, 4 in total
+//
+// with every file and pattern that has matched so far.
+func (f *WatchSummaryFormatter) Summary(buf []byte, multiFile bool) []byte {
+	if f.total.recent == 0 {
+		return buf
+	}
+	buf = append(buf, '[')
+	buf = f.now().AppendFormat(buf, time.TimeOnly)
+	buf = append(buf, "] "...)
+	buf = strconv.AppendInt(buf, int64(f.total.recent), 10)
+	buf = appendPlural(buf, " new matching line, ", " new matching lines, ", f.total.recent)
+	buf = strconv.AppendInt(buf, int64(f.total.total), 10)
+	buf = append(buf, " in total\n"...)
+	f.total.recent = 0
+
+	paths := make([]string, 0, len(f.files))
+	for p := range f.files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		c := f.files[p]
+		buf = append(buf, "  "...)
+		buf = append(buf, p...)
+		buf = append(buf, ": "...)
+		buf = appendWatchCount(buf, c.recent, c.total)
+		c.recent = 0
+	}
+
+	if f.stats != nil {
+		totals := f.stats.Totals()
+		for i, t := range totals {
+			if t.Lines == 0 {
+				continue
+			}
+			recent := t.Lines
+			if i < len(f.last) {
+				recent -= f.last[i].Lines
+			}
+			buf = append(buf, "  pattern "...)
+			buf = strconv.AppendQuote(buf, t.Pattern)
+			buf = append(buf, ": "...)
+			buf = appendWatchCount(buf, recent, t.Lines)
+		}
+		f.last = totals
+	}
+	return buf
+}
+
+// appendWatchCount appends "N new, M in total" and a newline.
+func appendWatchCount(buf []byte, recent, total int) []byte {
+	buf = strconv.AppendInt(buf, int64(recent), 10)
+	buf = append(buf, " new, "...)
+	buf = strconv.AppendInt(buf, int64(total), 10)
+	buf = append(buf, " in total\n"...)
+	return buf
+}
+
+var (
+	_ Formatter  = (*WatchSummaryFormatter)(nil)
+	_ Summarizer = (*WatchSummaryFormatter)(nil)
+)
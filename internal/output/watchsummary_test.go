@@ -0,0 +1,57 @@
+package output
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dl/gogrep/internal/matcher"
+)
+
+func TestWatchSummaryFormatter(t *testing.T) {
+	stats, err := matcher.NewPatternStats([]string{"ERROR", "WARN"}, func(p string) (matcher.Matcher, error) {
+		return matcher.NewBoyerMooreMatcher(p, false, false), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := NewWatchSummaryFormatter(stats)
+	f.now = func() time.Time { return time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC) }
+
+	result := func(path, data string, lines ...int) Result {
+		var ms matcher.MatchSet
+		ms.Data = []byte(data)
+		start := 0
+		for i, n := range lines {
+			ms.Matches = append(ms.Matches, matcher.Match{LineNum: i + 1, LineStart: start, LineLen: n})
+			start += n + 1
+		}
+		return Result{FilePath: path, MatchSet: ms}
+	}
+
+	if buf := f.Format(nil, result("b.log", "ERROR x\nWARN y\n", 7, 6), true); len(buf) != 0 {
+		t.Fatalf("Format wrote %q", buf)
+	}
+	f.Format(nil, result("a.log", "ERROR z\n", 7), true)
+	want := "[15:04:05] 3 new matching lines, 3 in total\n" +
+		"  a.log: 1 new, 1 in total\n" +
+		"  b.log: 2 new, 2 in total\n" +
+		"  pattern \"ERROR\": 2 new, 2 in total\n" +
+		"  pattern \"WARN\": 1 new, 1 in total\n"
+	if got := string(f.Summary(nil, true)); got != want {
+		t.Errorf("first summary:\ngot  %q\nwant %q", got, want)
+	}
+
+	if got := string(f.Summary(nil, true)); got != "" {
+		t.Errorf("quiet interval printed %q", got)
+	}
+
+	f.Format(nil, result("a.log", "WARN again\n", 10), true)
+	want = "[15:04:05] 1 new matching line, 4 in total\n" +
+		"  a.log: 1 new, 2 in total\n" +
+		"  b.log: 0 new, 2 in total\n" +
+		"  pattern \"ERROR\": 0 new, 2 in total\n" +
+		"  pattern \"WARN\": 1 new, 2 in total\n"
+	if got := string(f.Summary(nil, true)); got != want {
+		t.Errorf("second summary:\ngot  %q\nwant %q", got, want)
+	}
+}
@@ -0,0 +1,108 @@
+package output
+
+import (
+	"strconv"
+)
+
+// Summarizer is implemented by formatters that aggregate across results and
+// emit a final summary after the last result has been formatted.
+type Summarizer interface {
+	Summary(buf []byte, multiFile bool) []byte
+}
+
+// wcCounts holds wc-style totals for a set of lines.
+type wcCounts struct {
+	lines int64
+	words int64
+	bytes int64
+}
+
+// WCFormatter aggregates matching lines wc-style: for each file it prints
+// "lines words bytes path", and Summary prints the overall totals.
+// Bytes include the trailing newline of each line, as `grep | wc` would see.
+// Context lines and separators are not counted.
+type WCFormatter struct {
+	total wcCounts
+	files int
+}
+
+// NewWCFormatter creates a WCFormatter.
+func NewWCFormatter() *WCFormatter {
+	return &WCFormatter{}
+}
+
+func (f *WCFormatter) Format(buf []byte, result Result, multiFile bool) []byte {
+	ms := &result.MatchSet
+	var c wcCounts
+	for i := range ms.Matches {
+		m := &ms.Matches[i]
+		if m.IsContext || m.LineStart < 0 {
+			continue
+		}
+		line := ms.LineBytes(i)
+		c.lines++
+		c.words += int64(countWords(line))
+		c.bytes += int64(len(line)) + 1
+	}
+	if c.lines == 0 {
+		return buf
+	}
+
+	f.total.lines += c.lines
+	f.total.words += c.words
+	f.total.bytes += c.bytes
+	f.files++
+
+	name := result.FilePath
+	if !multiFile {
+		name = ""
+	}
+	return appendWC(buf, c, name)
+}
+
+// Summary appends the overall totals. Like wc, the total line is only
+// printed when more than one file was searched.
+func (f *WCFormatter) Summary(buf []byte, multiFile bool) []byte {
+	if !multiFile || f.files == 0 {
+		return buf
+	}
+	return appendWC(buf, f.total, "total")
+}
+
+func appendWC(buf []byte, c wcCounts, name string) []byte {
+	buf = strconv.AppendInt(buf, c.lines, 10)
+	buf = append(buf, ' ')
+	buf = strconv.AppendInt(buf, c.words, 10)
+	buf = append(buf, ' ')
+	buf = strconv.AppendInt(buf, c.bytes, 10)
+	if name != "" {
+		buf = append(buf, ' ')
+		buf = append(buf, name...)
+	}
+	return append(buf, '\n')
+}
+
+// countWords counts runs of non-whitespace bytes, splitting on the ASCII
+// whitespace set wc uses in the C locale.
+func countWords(line []byte) int {
+	words := 0
+	inWord := false
+	for _, b := range line {
+		switch b {
+		case ' ', '\t', '\n', '\v', '\f', '\r':
+			inWord = false
+		default:
+			if !inWord {
+				words++
+				inWord = true
+			}
+		}
+	}
+	return words
+}
+
+// Ensure WCFormatter implements Formatter and Summarizer.
+var (
+	_ Formatter  = (*WCFormatter)(nil)
+	_ Summarizer = (*WCFormatter)(nil)
+)
@@ -0,0 +1,77 @@
+package output
+
+import (
+	"testing"
+
+	"github.com/dl/gogrep/internal/matcher"
+)
+
+func TestWCFormatter_SingleFile(t *testing.T) {
+	f := NewWCFormatter()
+	data := []byte("error one two\nok\nerror  three\n")
+	result := Result{
+		FilePath: "a.log",
+		MatchSet: matcher.MatchSet{
+			Data: data,
+			Matches: []matcher.Match{
+				{LineNum: 1, LineStart: 0, LineLen: 13},
+				{LineNum: 2, LineStart: 14, LineLen: 2, IsContext: true},
+				{LineNum: 3, LineStart: 17, LineLen: 12},
+			},
+		},
+	}
+
+	got := string(f.Format(nil, result, false))
+	if got != "2 5 27\n" {
+		t.Errorf("got %q, want %q", got, "2 5 27\n")
+	}
+	if s := f.Summary(nil, false); len(s) != 0 {
+		t.Errorf("single-file summary = %q, want empty", s)
+	}
+}
+
+func TestWCFormatter_Totals(t *testing.T) {
+	f := NewWCFormatter()
+	a := Result{
+		FilePath: "a",
+		MatchSet: matcher.MatchSet{
+			Data:    []byte("x y\n"),
+			Matches: []matcher.Match{{LineNum: 1, LineStart: 0, LineLen: 3}},
+		},
+	}
+	b := Result{
+		FilePath: "b",
+		MatchSet: matcher.MatchSet{
+			Data:    []byte("z\n"),
+			Matches: []matcher.Match{{LineNum: 1, LineStart: 0, LineLen: 1}},
+		},
+	}
+
+	var buf []byte
+	buf = f.Format(buf, a, true)
+	buf = f.Format(buf, Result{FilePath: "empty"}, true)
+	buf = f.Format(buf, b, true)
+	buf = f.Summary(buf, true)
+
+	want := "1 2 4 a\n1 1 2 b\n2 3 6 total\n"
+	if string(buf) != want {
+		t.Errorf("got %q, want %q", buf, want)
+	}
+}
+
+func TestCountWords(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int
+	}{
+		{"", 0},
+		{"one", 1},
+		{"  leading and trailing  ", 3},
+		{"tab\tseparated\vwords", 3},
+	}
+	for _, tt := range tests {
+		if got := countWords([]byte(tt.in)); got != tt.want {
+			t.Errorf("countWords(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
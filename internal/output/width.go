@@ -0,0 +1,184 @@
+package output
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// wideRanges lists the East Asian Wide (W) and Fullwidth (F) code point
+// ranges that occupy two terminal columns. Sorted for binary search.
+var wideRanges = [][2]rune{
+	{0x1100, 0x115F},   // Hangul Jamo initial consonants
+	{0x231A, 0x231B},   // watch, hourglass
+	{0x2329, 0x232A},   // angle brackets
+	{0x23E9, 0x23EC},   // media controls
+	{0x23F0, 0x23F0},   // alarm clock
+	{0x23F3, 0x23F3},   // hourglass with flowing sand
+	{0x25FD, 0x25FE},   // medium small squares
+	{0x2614, 0x2615},   // umbrella, hot beverage
+	{0x2648, 0x2653},   // zodiac
+	{0x267F, 0x267F},   // wheelchair
+	{0x2693, 0x2693},   // anchor
+	{0x26A1, 0x26A1},   // high voltage
+	{0x26AA, 0x26AB},   // circles
+	{0x26BD, 0x26BE},   // soccer, baseball
+	{0x26C4, 0x26C5},   // snowman, sun behind cloud
+	{0x26CE, 0x26CE},   // ophiuchus
+	{0x26D4, 0x26D4},   // no entry
+	{0x26EA, 0x26EA},   // church
+	{0x26F2, 0x26F3},   // fountain, golf
+	{0x26F5, 0x26F5},   // sailboat
+	{0x26FA, 0x26FA},   // tent
+	{0x26FD, 0x26FD},   // fuel pump
+	{0x2705, 0x2705},   // check mark
+	{0x270A, 0x270B},   // fists
+	{0x2728, 0x2728},   // sparkles
+	{0x274C, 0x274C},   // cross mark
+	{0x274E, 0x274E},   // cross mark button
+	{0x2753, 0x2755},   // question marks
+	{0x2757, 0x2757},   // exclamation mark
+	{0x2795, 0x2797},   // plus, minus, divide
+	{0x27B0, 0x27B0},   // curly loop
+	{0x27BF, 0x27BF},   // double curly loop
+	{0x2B1B, 0x2B1C},   // large squares
+	{0x2B50, 0x2B50},   // star
+	{0x2B55, 0x2B55},   // circle
+	{0x2E80, 0x303E},   // CJK radicals, Kangxi, CJK symbols and punctuation
+	{0x3041, 0x33FF},   // Hiragana, Katakana, Bopomofo, CJK compatibility
+	{0x3400, 0x4DBF},   // CJK Unified Ideographs Extension A
+	{0x4E00, 0x9FFF},   // CJK Unified Ideographs
+	{0xA000, 0xA4CF},   // Yi
+	{0xA960, 0xA97F},   // Hangul Jamo Extended-A
+	{0xAC00, 0xD7A3},   // Hangul Syllables
+	{0xF900, 0xFAFF},   // CJK Compatibility Ideographs
+	{0xFE10, 0xFE19},   // vertical forms
+	{0xFE30, 0xFE6F},   // CJK compatibility forms, small form variants
+	{0xFF00, 0xFF60},   // fullwidth forms
+	{0xFFE0, 0xFFE6},   // fullwidth signs
+	{0x16FE0, 0x16FE4}, // ideographic symbols
+	{0x17000, 0x18AFF}, // Tangut
+	{0x1B000, 0x1B2FF}, // Kana supplement, Nushu
+	{0x1F004, 0x1F004}, // mahjong tile
+	{0x1F0CF, 0x1F0CF}, // playing card
+	{0x1F18E, 0x1F18E}, // AB button
+	{0x1F191, 0x1F19A}, // squared words
+	{0x1F200, 0x1F251}, // enclosed ideographic supplement
+	{0x1F300, 0x1F64F}, // misc symbols and pictographs, emoticons
+	{0x1F680, 0x1F6FF}, // transport and map symbols
+	{0x1F7E0, 0x1F7EB}, // colored circles and squares
+	{0x1F90C, 0x1F9FF}, // supplemental symbols and pictographs
+	{0x1FA70, 0x1FAFF}, // symbols and pictographs extended-A
+	{0x20000, 0x2FFFD}, // CJK Extension B..F
+	{0x30000, 0x3FFFD}, // CJK Extension G..
+}
+
+// runeWidth returns the number of terminal columns r occupies:
+// 0 for combining marks and zero-width format characters, 2 for East Asian
+// wide and fullwidth characters, 1 otherwise.
+func runeWidth(r rune) int {
+	if r < 0x300 {
+		return 1 // ASCII and Latin-1 fast path
+	}
+	if unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf) {
+		return 0
+	}
+	lo, hi := 0, len(wideRanges)-1
+	for lo <= hi {
+		mid := (lo + hi) / 2
+		switch {
+		case r < wideRanges[mid][0]:
+			hi = mid - 1
+		case r > wideRanges[mid][1]:
+			lo = mid + 1
+		default:
+			return 2
+		}
+	}
+	return 1
+}
+
+// displayWidth returns the number of terminal columns b occupies.
+// Invalid UTF-8 bytes count as one column each.
+func displayWidth(b []byte) int {
+	w := 0
+	for i := 0; i < len(b); {
+		if b[i] < utf8.RuneSelf {
+			w++
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRune(b[i:])
+		w += runeWidth(r)
+		i += size
+	}
+	return w
+}
+
+// trimPartialRunes returns the [start, end) sub-range of b with leading
+// UTF-8 continuation bytes and a trailing incomplete sequence removed.
+// Matchers cut snippets at byte offsets, which may land inside a rune.
+func trimPartialRunes(b []byte) (int, int) {
+	start := 0
+	for start < len(b) && start < utf8.UTFMax && !utf8.RuneStart(b[start]) {
+		start++
+	}
+	end := len(b)
+	for i := end - 1; i >= start && i >= end-utf8.UTFMax; i-- {
+		if utf8.RuneStart(b[i]) {
+			if !utf8.FullRune(b[i:end]) {
+				end = i
+			}
+			break
+		}
+	}
+	return start, end
+}
+
+// truncateWindowWidth computes a [start, end) byte window of at most maxCols
+// terminal columns centered on the first match position. Both ends fall on
+// rune boundaries, so no codepoint is split.
+func truncateWindowWidth(line []byte, positions [][2]int, maxCols int) (int, int) {
+	center := 0
+	if len(positions) > 0 {
+		center = (positions[0][0] + positions[0][1]) / 2
+	}
+	if center > len(line) {
+		center = len(line)
+	}
+	for center > 0 && center < len(line) && !utf8.RuneStart(line[center]) {
+		center--
+	}
+
+	// Grow left by half the budget, then right with the remainder,
+	// then left again if the line ended early.
+	start, end := center, center
+	used := 0
+	for start > 0 {
+		r, size := utf8.DecodeLastRune(line[:start])
+		w := runeWidth(r)
+		if used+w > maxCols/2 {
+			break
+		}
+		used += w
+		start -= size
+	}
+	for end < len(line) {
+		r, size := utf8.DecodeRune(line[end:])
+		w := runeWidth(r)
+		if used+w > maxCols {
+			break
+		}
+		used += w
+		end += size
+	}
+	for start > 0 {
+		r, size := utf8.DecodeLastRune(line[:start])
+		w := runeWidth(r)
+		if used+w > maxCols {
+			break
+		}
+		used += w
+		start -= size
+	}
+	return start, end
+}
@@ -0,0 +1,18 @@
+package output
+
+// Wrapper is embedded by a formatter that wraps another, Inner, and hands
+// it each result. It forwards Summary, so that a wrapper anywhere in a
+// chain keeps the summary of an aggregating formatter under it.
+type Wrapper struct {
+	Inner Formatter
+}
+
+// Summary returns Inner's summary if it is a Summarizer, else buf.
+func (w Wrapper) Summary(buf []byte, multiFile bool) []byte {
+	if s, ok := w.Inner.(Summarizer); ok {
+		return s.Summary(buf, multiFile)
+	}
+	return buf
+}
+
+var _ Summarizer = Wrapper{}
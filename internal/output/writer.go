@@ -1,14 +1,28 @@
 package output
 
 import (
+	"bytes"
+	"errors"
 	"os"
-
-	"golang.org/x/sys/unix"
+	"sync"
+	"sync/atomic"
+	"syscall"
 )
 
 // Writer writes formatted output to stdout, using writev for batching.
+//
+// When the reader of a pipe goes away, as `| head` does once it has its
+// lines, writes fail with EPIPE. Go ignores SIGPIPE for raw writes, so
+// nothing would stop the search; instead the Writer marks itself closed,
+// drops all later output without a syscall, and closes the Closed
+// channel so the caller can cancel the search.
 type Writer struct {
-	fd int
+	fd   int
+	crlf bool // end lines with "\r\n"
+
+	broken atomic.Bool
+	once   sync.Once
+	closed chan struct{}
 }
 
 // NewWriter creates a Writer that writes to stdout.
@@ -16,16 +30,44 @@ func NewWriter() *Writer {
 	return &Writer{fd: int(os.Stdout.Fd())}
 }
 
+// NewFileWriter creates a Writer that writes to f, such as a socket
+// handed to a client.
+func NewFileWriter(f *os.File) *Writer {
+	return &Writer{fd: int(f.Fd())}
+}
+
+// SetCRLF makes the Writer end every line it writes with "\r\n" instead
+// of "\n", for Windows terminals and CRLF tooling. Every formatter ends its
+// records with a newline and escapes or never prints others, so this is
+// the one place the terminator changes. A line that already ends with
+// '\r', as the lines of a CRLF file do, keeps its own.
+func (w *Writer) SetCRLF(crlf bool) {
+	w.crlf = crlf
+}
+
 // Write writes the given bytes to stdout using writev for scatter-gather I/O.
 func (w *Writer) Write(data []byte) error {
 	if len(data) == 0 {
 		return nil
 	}
+	if w.crlf {
+		bp := crlfPool.Get().(*[]byte)
+		*bp = appendCRLF((*bp)[:0], data)
+		data = *bp
+		defer crlfPool.Put(bp)
+	}
+
+	if w.broken.Load() {
+		return syscall.EPIPE
+	}
 
 	for len(data) > 0 {
 		iovs := [][]byte{data}
-		n, err := unix.Writev(w.fd, iovs)
+		n, err := writev(w.fd, iovs)
 		if err != nil {
+			if errors.Is(err, syscall.EPIPE) && w.broken.CompareAndSwap(false, true) {
+				close(w.closedChan())
+			}
 			return err
 		}
 		data = data[n:]
@@ -33,12 +75,53 @@ func (w *Writer) Write(data []byte) error {
 	return nil
 }
 
+// crlfPool holds the buffers Write converts line endings into, so that
+// CRLF output does not allocate a copy of every write.
+var crlfPool = sync.Pool{New: func() any { return new([]byte) }}
+
+// appendCRLF appends data to dst with each "\n" not preceded by '\r'
+// turned into "\r\n".
+func appendCRLF(dst, data []byte) []byte {
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			return append(dst, data...)
+		}
+		if i == 0 || data[i-1] != '\r' {
+			dst = append(dst, data[:i]...)
+			dst = append(dst, '\r', '\n')
+		} else {
+			dst = append(dst, data[:i+1]...)
+		}
+		data = data[i+1:]
+	}
+	return dst
+}
+
+// Closed returns a channel that is closed once a write has failed with
+// EPIPE, meaning nothing reads the output any more.
+func (w *Writer) Closed() <-chan struct{} {
+	return w.closedChan()
+}
+
+func (w *Writer) closedChan() chan struct{} {
+	w.once.Do(func() { w.closed = make(chan struct{}) })
+	return w.closed
+}
+
+// IsClosed reports whether a write has failed with EPIPE.
+func (w *Writer) IsClosed() bool {
+	return w.broken.Load()
+}
+
 // OrderedWriter receives results from a channel and writes them in sequence order.
 // This ensures output is deterministic even with parallel workers.
 type OrderedWriter struct {
 	writer    *Writer
 	formatter Formatter
 	multiFile bool
+	batch     int    // accumulate up to this many bytes per write (0 = write each result)
+	release   func() // called once per result after it is written or dropped
 }
 
 // NewOrderedWriter creates an OrderedWriter.
@@ -50,15 +133,46 @@ func NewOrderedWriter(w *Writer, f Formatter, multiFile bool) *OrderedWriter {
 	}
 }
 
+// SetBatch makes the writer collect formatted results and write them in
+// chunks of about size bytes instead of one writev per result. Meant for
+// -l, where results are a single path each and hundreds of thousands of
+// them would otherwise cost a syscall apiece. Whatever is collected is
+// written as soon as no result is ready, so a slow search still shows its
+// output as it goes.
+func (ow *OrderedWriter) SetBatch(size int) {
+	ow.batch = size
+}
+
+// SetRelease sets a function called once for every result, after it is
+// written or, if it failed, dropped. Results held back waiting for an
+// earlier one are not released until their turn, so the caller can bound
+// how many files are between discovery and output.
+func (ow *OrderedWriter) SetRelease(release func()) {
+	ow.release = release
+}
+
 // WriteOrdered consumes results from the channel, buffering out-of-order results
 // and writing them in sequence-number order. Reuses a single format buffer
 // across all writes to avoid per-file allocation.
 func (ow *OrderedWriter) WriteOrdered(results <-chan Result, onMatch func()) {
 	nextSeq := 1
 	pending := make(map[int]Result)
-	var buf []byte // reused across all writeResult calls
+	var buf []byte // reused across all writeResult calls; holds unwritten output when batching
+
+	for {
+		var r Result
+		var ok bool
+		select {
+		case r, ok = <-results:
+		default:
+			// Nothing ready: write out the batch before blocking.
+			buf = ow.flush(buf)
+			r, ok = <-results
+		}
+		if !ok {
+			break
+		}
 
-	for r := range results {
 		if r.Err == nil && r.HasMatch() {
 			if onMatch != nil {
 				onMatch()
@@ -82,19 +196,33 @@ func (ow *OrderedWriter) WriteOrdered(results <-chan Result, onMatch func()) {
 			pending[r.SeqNum] = r
 		}
 	}
+	ow.flush(buf)
 }
 
+// writeResult formats r after the unwritten output in buf and writes it
+// unless it is being batched. Returns buf holding whatever is unwritten.
 func (ow *OrderedWriter) writeResult(buf []byte, r Result) []byte {
+	if ow.release != nil {
+		defer ow.release()
+	}
 	if r.Err != nil {
 		if r.Closer != nil {
 			r.Closer()
 		}
 		return buf
 	}
-	buf = ow.formatter.Format(buf[:0], r, ow.multiFile)
+	buf = ow.formatter.Format(buf, r, ow.multiFile)
 	if r.Closer != nil {
 		r.Closer()
 	}
+	if len(buf) < ow.batch {
+		return buf
+	}
+	return ow.flush(buf)
+}
+
+// flush writes buf and returns it emptied for reuse.
+func (ow *OrderedWriter) flush(buf []byte) []byte {
 	ow.writer.Write(buf)
-	return buf
+	return buf[:0]
 }
@@ -0,0 +1,85 @@
+package output
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// packetWriter returns a Writer onto a SOCK_SEQPACKET socket, which keeps
+// each write a message of its own, and a function that closes it and
+// returns what was written and in how many writes.
+func packetWriter(tb testing.TB) (*Writer, func() (string, int)) {
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_SEQPACKET|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	var out strings.Builder
+	writes := 0
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buf := make([]byte, 1<<20)
+		for {
+			n, err := unix.Read(fds[1], buf)
+			if err != nil || n == 0 {
+				break
+			}
+			out.Write(buf[:n])
+			writes++
+		}
+		unix.Close(fds[1])
+	}()
+	return &Writer{fd: fds[0]}, func() (string, int) {
+		unix.Close(fds[0])
+		<-done
+		return out.String(), writes
+	}
+}
+
+func TestOrderedWriter_Batch(t *testing.T) {
+	const n = 5000
+	for _, batch := range []int{0, 64 << 10} {
+		w, finish := packetWriter(t)
+		ow := NewOrderedWriter(w, NewTextFormatter(false, false, true, false, 0), true)
+		ow.SetBatch(batch)
+		ow.WriteOrdered(filesOnlyResults(n), nil)
+		out, writes := finish()
+
+		var want strings.Builder
+		for i := range n {
+			fmt.Fprintf(&want, "src/pkg%03d/file%05d.go\n", i%500, i)
+		}
+		if out != want.String() {
+			t.Errorf("batch %d: output differs from per-result writes", batch)
+		}
+		if batch > 0 && writes > want.Len()/batch+2 {
+			t.Errorf("batch %d: %d writes for %d bytes", batch, writes, want.Len())
+		}
+	}
+}
+
+// BenchmarkOrderedWriter_FilesOnly compares writev calls for a large -l
+// listing written one result at a time and in 64 KiB batches.
+func BenchmarkOrderedWriter_FilesOnly(b *testing.B) {
+	const n = 100000
+
+	for _, batch := range []int{0, 64 << 10} {
+		b.Run(fmt.Sprintf("batch=%d", batch), func(b *testing.B) {
+			w, finish := packetWriter(b)
+			f := NewTextFormatter(false, false, true, false, 0)
+			for b.Loop() {
+				b.StopTimer()
+				results := filesOnlyResults(n)
+				b.StartTimer()
+				ow := NewOrderedWriter(w, f, true)
+				ow.SetBatch(batch)
+				ow.WriteOrdered(results, nil)
+			}
+			_, writes := finish()
+			b.ReportMetric(float64(writes)/float64(b.N), "writev/op")
+		})
+	}
+}
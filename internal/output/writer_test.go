@@ -0,0 +1,88 @@
+package output
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/dl/gogrep/internal/matcher"
+)
+
+// filesOnlyResults returns n -l style results, in order.
+func filesOnlyResults(n int) <-chan Result {
+	ch := make(chan Result, n)
+	for i := range n {
+		ch <- Result{
+			FilePath: fmt.Sprintf("src/pkg%03d/file%05d.go", i%500, i),
+			SeqNum:   i + 1,
+			MatchSet: matcher.MatchSet{Matches: []matcher.Match{{}}},
+		}
+	}
+	close(ch)
+	return ch
+}
+
+func TestWriter_ClosedPipe(t *testing.T) {
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pw.Close()
+	pr.Close()
+
+	w := &Writer{fd: int(pw.Fd())}
+	if w.IsClosed() {
+		t.Fatal("closed before any write")
+	}
+	if err := w.Write([]byte("a\n")); !errors.Is(err, syscall.EPIPE) {
+		t.Fatalf("got %v, want EPIPE", err)
+	}
+	select {
+	case <-w.Closed():
+	default:
+		t.Fatal("Closed not closed after EPIPE")
+	}
+
+	// Later output is dropped without a syscall, which on this fd would
+	// fail with EBADF.
+	w.fd = -1
+	ow := NewOrderedWriter(w, NewTextFormatter(false, false, true, false, 0), true)
+	ow.WriteOrdered(filesOnlyResults(100), nil)
+	if err := w.Write([]byte("b\n")); !errors.Is(err, syscall.EPIPE) || !w.IsClosed() {
+		t.Errorf("write after EPIPE: %v, want EPIPE without a syscall", err)
+	}
+}
+
+func TestWriter_CRLF(t *testing.T) {
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &Writer{fd: int(pw.Fd())}
+	w.SetCRLF(true)
+	w.Write([]byte("a:1:x\n\nb:2:crlf line\r\n\x1b[1;31mhit\x1b[0m\n"))
+	pw.Close()
+	out, _ := io.ReadAll(pr)
+	if want := "a:1:x\r\n\r\nb:2:crlf line\r\n\x1b[1;31mhit\x1b[0m\r\n"; string(out) != want {
+		t.Errorf("got %q, want %q", out, want)
+	}
+}
+
+func BenchmarkWriter_CRLF(b *testing.B) {
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer devNull.Close()
+	w := &Writer{fd: int(devNull.Fd())}
+	w.SetCRLF(true)
+	data := []byte(strings.Repeat("src/pkg/file.go:12:some matching line\n", 1000))
+	b.ReportAllocs()
+	for b.Loop() {
+		w.Write(data)
+	}
+}
@@ -0,0 +1,43 @@
+package scheduler
+
+import (
+	"fmt"
+	"runtime/debug"
+
+	"github.com/dl/gogrep/internal/output"
+)
+
+// Fault is the error of a Result whose search panicked: a matcher bug, or
+// a memory fault reading a mapped file that shrank under us (SIGBUS).
+type Fault struct {
+	Path  string
+	Value any // the recovered panic value
+}
+
+func (f *Fault) Error() string {
+	return fmt.Sprintf("search panicked: %v", f.Value)
+}
+
+// Guard runs search for path and turns a panic into a Result whose Err is
+// a *Fault, so one bad file does not abort the whole search. While search
+// runs, memory faults panic instead of crashing the process (see
+// debug.SetPanicOnFault). search must release its file buffer if it
+// panics; ReleaseOnPanic does that.
+func Guard(path string, search func() output.Result) (result output.Result) {
+	defer debug.SetPanicOnFault(debug.SetPanicOnFault(true))
+	defer func() {
+		if v := recover(); v != nil {
+			result = output.Result{FilePath: path, Err: &Fault{Path: path, Value: v}}
+		}
+	}()
+	return search()
+}
+
+// ReleaseOnPanic is deferred after a file is read: if the search panics,
+// it calls release and lets the panic continue to Guard.
+func ReleaseOnPanic(release func()) {
+	if v := recover(); v != nil {
+		release()
+		panic(v)
+	}
+}
@@ -0,0 +1,93 @@
+package scheduler
+
+import (
+	"github.com/dl/gogrep/internal/output"
+)
+
+// Middleware is a set of hooks around each file the scheduler processes,
+// so an embedder can add its own skipping, metrics or result rewriting
+// without changing the pipeline. Any hook may be nil.
+//
+// BeforeRead and AfterMatch run on the worker goroutines, concurrently for
+// different files. BeforeFormat runs on the goroutine writing results, one
+// result at a time, in output order.
+type Middleware struct {
+	// BeforeRead is called with each file's path before it is opened.
+	// Returning false skips the file: it is not read, and its result is
+	// empty, like that of a file without a match.
+	BeforeRead func(path string) bool
+
+	// AfterMatch is called with the result of each file read, matching or
+	// not, failed included, before it is queued for output. It may change
+	// the result. The MatchSet refers to the file's buffer, which stays
+	// valid until the result's Closer runs; a hook that drops the matches
+	// must leave the Closer in place. Not called for files that were
+	// skipped or dropped after a cancel.
+	AfterMatch func(r *output.Result)
+
+	// BeforeFormat is called with each result as it is about to be
+	// formatted (see Scheduler.Formatter). Changes affect only what is
+	// printed. Failed results are not formatted, so it never sees them.
+	BeforeFormat func(r *output.Result)
+}
+
+// Use appends mw to the scheduler's middleware chain. Call before Run.
+//
+// The chain nests, the first middleware added being the outermost.
+// BeforeRead hooks run in the order added, and the first to return false
+// skips the file without asking the rest. AfterMatch and BeforeFormat
+// hooks run in the reverse order, so the outermost middleware sees each
+// result last, as it leaves the scheduler and as it is printed.
+func (s *Scheduler) Use(mw ...Middleware) {
+	s.chain = append(s.chain, mw...)
+}
+
+// Formatter wraps f so that the chain's BeforeFormat hooks run on each
+// result before f formats it. Pass the returned formatter to the
+// OrderedWriter that consumes Run's results. Without BeforeFormat hooks
+// it returns f directly.
+func (s *Scheduler) Formatter(f output.Formatter) output.Formatter {
+	var hooks []func(*output.Result)
+	for i := len(s.chain) - 1; i >= 0; i-- {
+		if h := s.chain[i].BeforeFormat; h != nil {
+			hooks = append(hooks, h)
+		}
+	}
+	if len(hooks) == 0 {
+		return f
+	}
+	return &hookFormatter{Wrapper: output.Wrapper{Inner: f}, hooks: hooks}
+}
+
+// beforeRead reports whether every BeforeRead hook lets path be read.
+func (s *Scheduler) beforeRead(path string) bool {
+	for _, mw := range s.chain {
+		if mw.BeforeRead != nil && !mw.BeforeRead(path) {
+			return false
+		}
+	}
+	return true
+}
+
+// afterMatch runs the AfterMatch hooks on r, innermost first.
+func (s *Scheduler) afterMatch(r *output.Result) {
+	for i := len(s.chain) - 1; i >= 0; i-- {
+		if h := s.chain[i].AfterMatch; h != nil {
+			h(r)
+		}
+	}
+}
+
+// hookFormatter runs BeforeFormat hooks, in the order of hooks, on each
+// result before the wrapped formatter sees it.
+type hookFormatter struct {
+	output.Wrapper
+	hooks []func(*output.Result)
+}
+
+func (f *hookFormatter) Format(buf []byte, result output.Result, multiFile bool) []byte {
+	for _, h := range f.hooks {
+		h(&result)
+	}
+	return f.Inner.Format(buf, result, multiFile)
+}
@@ -0,0 +1,32 @@
+package scheduler
+
+import "fmt"
+
+// IOClass is an I/O scheduling class, numbered as for ioprio_set(2).
+type IOClass int
+
+const (
+	IOClassNone       IOClass = iota // leave the I/O priority unchanged
+	IOClassRealtime                  // served first; needs CAP_SYS_ADMIN
+	IOClassBestEffort                // the default class, by Level
+	IOClassIdle                      // served only when no other I/O waits
+)
+
+// IOPriority is an I/O scheduling class and, for the realtime and
+// best-effort classes, a level from 0 (highest) to 7.
+type IOPriority struct {
+	Class IOClass
+	Level int
+}
+
+func (p IOPriority) String() string {
+	switch p.Class {
+	case IOClassRealtime:
+		return fmt.Sprintf("realtime:%d", p.Level)
+	case IOClassBestEffort:
+		return fmt.Sprintf("best-effort:%d", p.Level)
+	case IOClassIdle:
+		return "idle"
+	}
+	return "none"
+}
@@ -0,0 +1,121 @@
+//go:build linux
+
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+// ioprio_set(2) values that x/sys/unix does not define.
+const (
+	ioprioWhoProcess = 1
+	ioprioClassShift = 13
+)
+
+// Niceness range; the kernel clamps to it too.
+const (
+	minNice = -20
+	maxNice = 19
+)
+
+// SetNice adds inc to the niceness of the whole process, within -20..19.
+// A negative result needs CAP_SYS_NICE or room under RLIMIT_NICE; without
+// either, the niceness goes as low as the limit allows, or is left as it
+// was, and an error says what was used instead.
+func SetNice(inc int) error {
+	// The raw syscall returns 20 - nice, so that it is never negative.
+	raw, err := unix.Getpriority(unix.PRIO_PROCESS, 0)
+	if err != nil {
+		return err
+	}
+	cur := 20 - raw
+	want := min(max(cur+inc, minNice), maxNice)
+	err = eachThread(func(tid int) error {
+		return unix.Setpriority(unix.PRIO_PROCESS, tid, want)
+	})
+	if !denied(err) {
+		return err
+	}
+
+	got := cur
+	var lim unix.Rlimit
+	if unix.Getrlimit(unix.RLIMIT_NICE, &lim) == nil {
+		// RLIMIT_NICE n allows a niceness down to 20 - n.
+		if floor := 20 - int(min(lim.Cur, 40)); floor < cur {
+			got = max(want, floor)
+		}
+	}
+	if got != cur {
+		err := eachThread(func(tid int) error {
+			return unix.Setpriority(unix.PRIO_PROCESS, tid, got)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("niceness %d not permitted, using %d", want, got)
+}
+
+// SetIOPriority sets the I/O priority of the whole process. The realtime
+// class needs CAP_SYS_ADMIN; without it, best-effort at the same level is
+// used instead, and an error says so.
+func SetIOPriority(p IOPriority) error {
+	err := eachThread(func(tid int) error { return ioprioSet(tid, p) })
+	if !denied(err) || p.Class != IOClassRealtime {
+		return err
+	}
+	fallback := IOPriority{Class: IOClassBestEffort, Level: p.Level}
+	if err := eachThread(func(tid int) error { return ioprioSet(tid, fallback) }); err != nil {
+		return err
+	}
+	return fmt.Errorf("%s not permitted, using %s", p, fallback)
+}
+
+// ioprioSet sets the I/O priority of thread tid.
+func ioprioSet(tid int, p IOPriority) error {
+	prio := int(p.Class)<<ioprioClassShift | p.Level
+	if _, _, errno := unix.Syscall(unix.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), uintptr(prio)); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// eachThread calls set for every thread of the process, including any
+// started meanwhile. Linux keeps niceness and I/O priority per thread, and
+// a new thread inherits them from the one that creates it, so once every
+// existing thread is set, the threads the runtime starts later follow.
+func eachThread(set func(tid int) error) error {
+	done := make(map[int]bool)
+	for {
+		entries, err := os.ReadDir("/proc/self/task")
+		if err != nil {
+			return err
+		}
+		fresh := false
+		for _, e := range entries {
+			tid, err := strconv.Atoi(e.Name())
+			if err != nil || done[tid] {
+				continue
+			}
+			// A thread that exited in the meantime needs nothing.
+			if err := set(tid); err != nil && !errors.Is(err, unix.ESRCH) {
+				return err
+			}
+			done[tid] = true
+			fresh = true
+		}
+		if !fresh {
+			return nil
+		}
+	}
+}
+
+// denied reports whether err is a missing-privilege error.
+func denied(err error) bool {
+	return errors.Is(err, unix.EPERM) || errors.Is(err, unix.EACCES)
+}
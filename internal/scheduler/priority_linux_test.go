@@ -0,0 +1,80 @@
+package scheduler
+
+import (
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// threads returns the thread IDs of the process.
+func threads(t *testing.T) []int {
+	t.Helper()
+	entries, err := os.ReadDir("/proc/self/task")
+	if err != nil {
+		t.Skipf("no /proc: %v", err)
+	}
+	var tids []int
+	for _, e := range entries {
+		tid, _ := strconv.Atoi(e.Name())
+		tids = append(tids, tid)
+	}
+	return tids
+}
+
+// spawnThreads keeps n goroutines locked to their own threads at once, so
+// the runtime has to start new ones.
+func spawnThreads(n int) {
+	var wg sync.WaitGroup
+	for range n {
+		wg.Go(func() {
+			// Exiting while locked ends the thread, so it is never reused.
+			runtime.LockOSThread()
+			time.Sleep(10 * time.Millisecond)
+		})
+	}
+	wg.Wait()
+}
+
+func TestSetNice(t *testing.T) {
+	raw, err := unix.Getpriority(unix.PRIO_PROCESS, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := min(20-raw+3, maxNice)
+	if err := SetNice(3); err != nil {
+		t.Fatalf("SetNice: %v", err)
+	}
+	spawnThreads(8)
+	for _, tid := range threads(t) {
+		raw, err := unix.Getpriority(unix.PRIO_PROCESS, tid)
+		if err != nil {
+			continue // exited
+		}
+		if got := 20 - raw; got != want {
+			t.Errorf("thread %d: niceness %d, want %d", tid, got, want)
+		}
+	}
+}
+
+func TestSetIOPriority(t *testing.T) {
+	p := IOPriority{Class: IOClassBestEffort, Level: 7}
+	if err := SetIOPriority(p); err != nil {
+		t.Fatalf("SetIOPriority: %v", err)
+	}
+	spawnThreads(8)
+	want := uintptr(IOClassBestEffort)<<ioprioClassShift | 7
+	for _, tid := range threads(t) {
+		got, _, errno := unix.Syscall(unix.SYS_IOPRIO_GET, ioprioWhoProcess, uintptr(tid), 0)
+		if errno != 0 {
+			continue // exited
+		}
+		if got != want {
+			t.Errorf("thread %d: ioprio %#x, want %#x", tid, got, want)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package scheduler
+
+import "errors"
+
+var errPriorityUnsupported = errors.New("not supported on this platform")
+
+// SetNice is only implemented on Linux.
+func SetNice(int) error {
+	return errPriorityUnsupported
+}
+
+// SetIOPriority is only implemented on Linux.
+func SetIOPriority(IOPriority) error {
+	return errPriorityUnsupported
+}
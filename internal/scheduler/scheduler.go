@@ -1,6 +1,7 @@
 package scheduler
 
 import (
+	"bytes"
 	"runtime"
 	"sync"
 	"sync/atomic"
@@ -18,11 +19,31 @@ type Scheduler struct {
 	reader    input.Reader
 	filesOnly bool // when true, use MatchExists for faster -l mode
 	countOnly bool // when true, use CountAll for faster -c mode
+	firstOnly bool // when true, use FindFirst for --first mode
+	hash      bool // with filesOnly, hash matching files (--print-hash)
+
+	searchBinary     bool // search binary files instead of skipping them (-a)
+	binaryMaxMatches int  // cap on matches kept per binary file (0 = no cap)
+	binaryPolicy     *walker.BinaryPolicy
+
+	cancel   <-chan struct{} // closed to stop searching (nil = never)
+	searched atomic.Int64    // files read and searched
+	dropped  atomic.Int64    // files received but not searched after cancel
+
+	faultMu sync.Mutex
+	faults  []*Fault // files whose search panicked
+
+	chain []Middleware // hooks around each file, outermost first (Use)
 }
 
+// arenas holds match arenas between uses. A worker keeps one while the
+// files it searches have no match, and hands it on with the first result
+// whose matches live in it; the result's Closer returns it here.
+var arenas = sync.Pool{New: func() any { return matcher.NewArena() }}
+
 // New creates a Scheduler with the given number of workers.
 // If workers is 0, defaults to NumCPU * 2.
-func New(workers int, m matcher.Matcher, r input.Reader, filesOnly bool, countOnly bool) *Scheduler {
+func New(workers int, m matcher.Matcher, r input.Reader, filesOnly bool, countOnly bool, firstOnly bool) *Scheduler {
 	if workers <= 0 {
 		workers = runtime.NumCPU() * 2
 	}
@@ -32,24 +53,123 @@ func New(workers int, m matcher.Matcher, r input.Reader, filesOnly bool, countOn
 		reader:    r,
 		filesOnly: filesOnly,
 		countOnly: countOnly,
+		firstOnly: firstOnly,
 	}
 }
 
+// SearchBinary makes the scheduler search files detected as binary instead
+// of skipping them (-a/--text). maxMatches caps the matches kept per binary
+// file; 0 means no cap.
+func (s *Scheduler) SearchBinary(maxMatches int) {
+	s.searchBinary = true
+	s.binaryMaxMatches = maxMatches
+}
+
+// HashMatches sets Result.Hash for each matching file in filesOnly mode,
+// from the buffer already read for the search.
+func (s *Scheduler) HashMatches() {
+	s.hash = true
+}
+
+// OverrideBinary applies p's per-path text and binary globs in place of
+// binary detection.
+func (s *Scheduler) OverrideBinary(p *walker.BinaryPolicy) {
+	s.binaryPolicy = p
+}
+
+// Cancel makes the scheduler stop searching once done is closed: files
+// already being searched finish, files still queued are dropped, and no
+// more files are taken from the walker. The result channel still closes
+// normally, so partial results are flushed.
+func (s *Scheduler) Cancel(done <-chan struct{}) {
+	s.cancel = done
+}
+
+// Counts returns how many files were searched, and how many were received
+// but dropped because the search was canceled.
+func (s *Scheduler) Counts() (searched, dropped int) {
+	return int(s.searched.Load()), int(s.dropped.Load())
+}
+
+// Faults returns the files whose search panicked, in no particular order.
+// Call once the result channel is drained.
+func (s *Scheduler) Faults() []*Fault {
+	s.faultMu.Lock()
+	defer s.faultMu.Unlock()
+	return s.faults
+}
+
+// job is a file stamped with its position in the walker's emission order.
+type job struct {
+	entry walker.FileEntry
+	seq   int
+}
+
 // Run processes files from the file channel and returns results on the result channel.
-// Results include sequence numbers for ordered output.
+// Results include sequence numbers for ordered output. Numbers follow the
+// order in which files arrive on the channel: a single stage stamps them
+// before any worker sees the file, so which worker dequeues first cannot
+// reorder the output.
 func (s *Scheduler) Run(files <-chan walker.FileEntry) <-chan output.Result {
 	resultCh := make(chan output.Result, s.workers*2)
-	var seq atomic.Int64
+
+	jobs := make(chan job, s.workers*2)
+	go func() {
+		defer close(jobs)
+		seq := 0
+		for entry := range files {
+			seq++
+			select {
+			case jobs <- job{entry: entry, seq: seq}:
+			case <-s.cancel:
+				// Unblock the walker; it stops on the same signal.
+				s.dropped.Add(1)
+				for range files {
+					s.dropped.Add(1)
+				}
+				return
+			}
+		}
+	}()
 
 	var wg sync.WaitGroup
 	for range s.workers {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			for entry := range files {
-				seqNum := int(seq.Add(1))
-				result := s.processFile(entry)
-				result.SeqNum = seqNum
+			arena := arenas.Get().(*matcher.Arena)
+			// The worker's arena changes each time a result takes it.
+			defer func() { arenas.Put(arena) }()
+			for j := range jobs {
+				var result output.Result
+				if s.canceled() {
+					// Keep the sequence contiguous for the ordered writer.
+					result = output.Result{FilePath: j.entry.Path}
+					s.dropped.Add(1)
+				} else if !s.beforeRead(j.entry.Path) {
+					result = output.Result{FilePath: j.entry.Path}
+				} else {
+					handedOff := false
+					result = Guard(j.entry.Path, func() output.Result {
+						var r output.Result
+						r, handedOff = s.processFile(j.entry, arena)
+						return r
+					})
+					if handedOff {
+						arena = arenas.Get().(*matcher.Arena)
+					} else {
+						arena.Reset()
+					}
+					if f, ok := result.Err.(*Fault); ok {
+						s.faultMu.Lock()
+						s.faults = append(s.faults, f)
+						s.faultMu.Unlock()
+					}
+					s.searched.Add(1)
+					s.afterMatch(&result)
+				}
+				result.SeqNum = j.seq
+				result.Root = j.entry.Root
 				resultCh <- result
 			}
 		}()
@@ -63,48 +183,136 @@ func (s *Scheduler) Run(files <-chan walker.FileEntry) <-chan output.Result {
 	return resultCh
 }
 
-func (s *Scheduler) processFile(entry walker.FileEntry) output.Result {
+func (s *Scheduler) canceled() bool {
+	select {
+	case <-s.cancel:
+		return true
+	default:
+		return false
+	}
+}
+
+// processFile searches one file, building its matches in arena. It reports
+// whether the result took the arena with it, to be released by its Closer.
+func (s *Scheduler) processFile(entry walker.FileEntry, arena *matcher.Arena) (output.Result, bool) {
 	result := output.Result{FilePath: entry.Path}
 
 	readResult, err := s.reader.Read(entry.Path)
 	if err != nil {
 		result.Err = err
-		return result
+		return result, false
 	}
+	result.Stat = readResult.Stat
 
 	closeReader := func() {
 		if readResult.Closer != nil {
 			readResult.Closer()
+			readResult.Closer = nil
 		}
 	}
+	defer ReleaseOnPanic(closeReader)
 
-	if readResult.Data == nil {
+	// Empty input has no lines, so nothing can match, not even a
+	// pattern that matches the empty string, -v, or a whole-file match.
+	if len(readResult.Data) == 0 {
 		closeReader()
-		return result
+		result.Counted = s.countOnly
+		return result, false
 	}
 
-	// Binary detection: skip binary files entirely (like ripgrep)
-	if walker.IsBinary(readResult.Data) {
-		closeReader()
-		return result
+	// Binary detection: skip binary files entirely (like ripgrep) unless -a
+	if s.binaryPolicy.IsBinary(entry.Path, readResult.Data) {
+		if !s.searchBinary {
+			closeReader()
+			return result, false
+		}
+		result.Binary = true
 	}
+	result.Size = int64(len(readResult.Data))
 
+	if !s.filesOnly && readResult.Prefetch != nil {
+		readResult.Prefetch(len(readResult.Data))
+	}
 	if s.filesOnly {
-		if s.matcher.MatchExists(readResult.Data) {
+		if MatchExists(s.matcher, &readResult) {
 			result.MatchSet = matcher.MatchSet{Matches: []matcher.Match{{}}}
+			if s.hash {
+				result.Hash = readResult.Digest()
+			}
 		}
 		closeReader()
 	} else if s.countOnly {
 		count := s.matcher.CountAll(readResult.Data)
 		result.MatchCount = count
+		result.Counted = true
 		closeReader()
 	} else {
-		result.MatchSet = s.matcher.FindAll(readResult.Data)
-		if result.MatchSet.HasMatch() {
-			result.Closer = closeReader
+		if s.firstOnly {
+			result.MatchSet = matcher.FindFirst(s.matcher, readResult.Data)
 		} else {
-			closeReader()
+			result.MatchSet = matcher.FindAllIn(s.matcher, readResult.Data, arena)
+		}
+		if result.Binary && s.binaryMaxMatches > 0 && len(result.MatchSet.Matches) > s.binaryMaxMatches {
+			result.MatchSet.Matches = result.MatchSet.Matches[:s.binaryMaxMatches]
+		}
+		RemapOffsets(&readResult, result.MatchSet.Matches)
+		if result.MatchSet.HasMatch() {
+			result.Closer = func() {
+				closeReader()
+				if arena != nil {
+					arena.Reset()
+					arenas.Put(arena)
+					arena = nil
+				}
+			}
+			return result, true
 		}
+		closeReader()
+	}
+	return result, false
+}
+
+// existsWindow is how much of a lazily prefetched file MatchExists
+// searches at a time.
+const existsWindow = 1 << 20
+
+// MatchExists reports whether m matches anywhere in r.Data. With
+// r.Prefetch set, it searches whole lines a window at a time, prefetching
+// each just before, and stops at the first match, so that -l reads no
+// further into a throttled file. Readers prefetch lazily only for searches
+// that find each line's matches from the line alone (see
+// input.AdaptiveOptions.LazyPrefetch).
+func MatchExists(m matcher.Matcher, r *input.ReadResult) bool {
+	if r.Prefetch == nil {
+		return m.MatchExists(r.Data)
+	}
+	data := r.Data
+	for start, end := 0, 0; start < len(data); {
+		end = min(end+existsWindow, len(data))
+		r.Prefetch(end)
+		cut := end
+		if end < len(data) {
+			i := bytes.LastIndexByte(data[start:end], '\n')
+			if i < 0 {
+				continue // a line longer than the window: widen it
+			}
+			cut = start + i + 1
+		}
+		if m.MatchExists(data[start:cut]) {
+			return true
+		}
+		start = cut
+	}
+	return false
+}
+
+// RemapOffsets rewrites the ByteOffset of each match from an offset in
+// r.Data to a file offset. A no-op unless holes were skipped.
+func RemapOffsets(r *input.ReadResult, matches []matcher.Match) {
+	if r.Extents == nil {
+		return
+	}
+	for i := range matches {
+		matches[i].ByteOffset = r.FileOffset(matches[i].ByteOffset)
 	}
-	return result
 }
@@ -0,0 +1,375 @@
+package scheduler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/dl/gogrep/internal/input"
+	"github.com/dl/gogrep/internal/matcher"
+	"github.com/dl/gogrep/internal/output"
+	"github.com/dl/gogrep/internal/walker"
+)
+
+func TestRun_SeqNumFollowsEmissionOrder(t *testing.T) {
+	dir := t.TempDir()
+	const n = 200
+	files := make(chan walker.FileEntry, n)
+	for i := range n {
+		path := filepath.Join(dir, fmt.Sprintf("f%03d.txt", i))
+		os.WriteFile(path, []byte("needle\n"), 0644)
+		files <- walker.FileEntry{Path: path, Root: fmt.Sprint(i % 3)}
+	}
+	close(files)
+
+	m := matcher.NewBoyerMooreMatcher("needle", false, false)
+	s := New(8, m, input.NewBufferedReader(), false, false, false)
+
+	seen := make(map[int]bool)
+	for r := range s.Run(files) {
+		want := filepath.Join(dir, fmt.Sprintf("f%03d.txt", r.SeqNum-1))
+		if r.FilePath != want {
+			t.Errorf("SeqNum %d is %s, want %s", r.SeqNum, r.FilePath, want)
+		}
+		if root := fmt.Sprint((r.SeqNum - 1) % 3); r.Root != root {
+			t.Errorf("SeqNum %d has root %q, want %q", r.SeqNum, r.Root, root)
+		}
+		seen[r.SeqNum] = true
+		if r.Closer != nil {
+			r.Closer()
+		}
+	}
+	if len(seen) != n {
+		t.Errorf("got %d distinct sequence numbers, want %d", len(seen), n)
+	}
+}
+
+// TestRun_CountOnlyZero checks that -c reports a count for every file
+// searched, 0 for one without a match or without lines, as grep does.
+func TestRun_CountOnlyZero(t *testing.T) {
+	dir := t.TempDir()
+	contents := []string{"needle\nneedle\n", "hay\n", ""}
+	files := make(chan walker.FileEntry, len(contents))
+	for i, c := range contents {
+		path := filepath.Join(dir, fmt.Sprintf("f%d.txt", i))
+		os.WriteFile(path, []byte(c), 0644)
+		files <- walker.FileEntry{Path: path}
+	}
+	close(files)
+
+	m := matcher.NewBoyerMooreMatcher("needle", false, false)
+	counts := make(map[int]int)
+	for r := range New(2, m, input.NewBufferedReader(), false, true, false).Run(files) {
+		if !r.Counted {
+			t.Errorf("%s: not marked counted", r.FilePath)
+		}
+		counts[r.SeqNum] = r.Count()
+	}
+	if want := map[int]int{1: 2, 2: 0, 3: 0}; fmt.Sprint(counts) != fmt.Sprint(want) {
+		t.Errorf("counts = %v, want %v", counts, want)
+	}
+}
+
+func TestRun_Cancel(t *testing.T) {
+	dir := t.TempDir()
+	const n = 50
+	files := make(chan walker.FileEntry, n)
+	for i := range n {
+		path := filepath.Join(dir, fmt.Sprintf("f%03d.txt", i))
+		os.WriteFile(path, []byte("needle\n"), 0644)
+		files <- walker.FileEntry{Path: path}
+	}
+	close(files)
+
+	done := make(chan struct{})
+	close(done)
+	m := matcher.NewBoyerMooreMatcher("needle", false, false)
+	s := New(4, m, input.NewBufferedReader(), false, false, false)
+	s.Cancel(done)
+
+	seen := make(map[int]bool)
+	for r := range s.Run(files) {
+		if r.HasMatch() {
+			t.Errorf("%s was searched after cancel", r.FilePath)
+		}
+		seen[r.SeqNum] = true
+	}
+	for seq := 1; seq <= len(seen); seq++ {
+		if !seen[seq] {
+			t.Errorf("sequence number %d missing; results must stay contiguous", seq)
+		}
+	}
+	if searched, dropped := s.Counts(); searched != 0 || dropped != n {
+		t.Errorf("Counts() = %d, %d; want 0, %d", searched, dropped, n)
+	}
+}
+
+// panicMatcher panics on buffers containing "boom".
+type panicMatcher struct{ matcher.Matcher }
+
+func (m panicMatcher) FindAll(data []byte) matcher.MatchSet {
+	if bytes.Contains(data, []byte("boom")) {
+		panic("matcher bug")
+	}
+	return m.Matcher.FindAll(data)
+}
+
+// countingReader counts released buffers.
+type countingReader struct {
+	input.Reader
+	released atomic.Int64
+}
+
+func (r *countingReader) Read(path string) (input.ReadResult, error) {
+	res, err := r.Reader.Read(path)
+	if err == nil {
+		closer := res.Closer
+		res.Closer = func() error {
+			r.released.Add(1)
+			return closer()
+		}
+	}
+	return res, err
+}
+
+func TestRun_PanicIsolated(t *testing.T) {
+	dir := t.TempDir()
+	const n = 20
+	files := make(chan walker.FileEntry, n)
+	for i := range n {
+		path := filepath.Join(dir, fmt.Sprintf("f%03d.txt", i))
+		content := "needle\n"
+		if i%5 == 0 {
+			content = "needle boom\n"
+		}
+		os.WriteFile(path, []byte(content), 0644)
+		files <- walker.FileEntry{Path: path}
+	}
+	close(files)
+
+	reader := &countingReader{Reader: input.NewBufferedReader()}
+	s := New(4, panicMatcher{matcher.NewBoyerMooreMatcher("needle", false, false)}, reader, false, false, false)
+	matched := 0
+	for r := range s.Run(files) {
+		var f *Fault
+		if errors.As(r.Err, &f) {
+			if f.Path != r.FilePath || f.Value != "matcher bug" {
+				t.Errorf("fault = %+v for %s", f, r.FilePath)
+			}
+			continue
+		}
+		if r.HasMatch() {
+			matched++
+		}
+		if r.Closer != nil {
+			r.Closer()
+		}
+	}
+	if matched != n-n/5 {
+		t.Errorf("matched %d files, want %d", matched, n-n/5)
+	}
+	if got := len(s.Faults()); got != n/5 {
+		t.Errorf("Faults() has %d files, want %d", got, n/5)
+	}
+	if got := reader.released.Load(); got != n {
+		t.Errorf("released %d buffers, want %d", got, n)
+	}
+}
+
+// pathFormatter prints each result's path, to show what BeforeFormat
+// hooks changed.
+type pathFormatter struct{}
+
+func (pathFormatter) Format(buf []byte, r output.Result, _ bool) []byte {
+	return append(buf, r.FilePath...)
+}
+
+func TestMiddleware_Order(t *testing.T) {
+	dir := t.TempDir()
+	const n = 6
+	files := make(chan walker.FileEntry, n)
+	for i := range n {
+		path := filepath.Join(dir, fmt.Sprintf("f%d", i))
+		os.WriteFile(path, []byte("needle\n"), 0644)
+		files <- walker.FileEntry{Path: path}
+	}
+	close(files)
+
+	var innerSaw sync.Map // paths the inner BeforeRead was asked about
+	skip := func(name string) func(string) bool {
+		return func(path string) bool { return filepath.Base(path) != name }
+	}
+	tag := func(suffix string) func(*output.Result) {
+		return func(r *output.Result) { r.FilePath += suffix }
+	}
+	s := New(3, matcher.NewBoyerMooreMatcher("needle", false, false), input.NewBufferedReader(), false, false, false)
+	s.Use(Middleware{BeforeRead: skip("f1"), AfterMatch: tag(" a1"), BeforeFormat: tag(" a2")})
+	s.Use(Middleware{
+		BeforeRead: func(path string) bool {
+			innerSaw.Store(filepath.Base(path), true)
+			return skip("f2")(path)
+		},
+		AfterMatch:   tag(" b1"),
+		BeforeFormat: tag(" b2"),
+	})
+	f := s.Formatter(pathFormatter{})
+
+	for r := range s.Run(files) {
+		name := strings.TrimPrefix(r.FilePath, dir+string(filepath.Separator))
+		got := string(f.Format(nil, r, false))
+		switch name {
+		case "f1", "f2":
+			if r.HasMatch() {
+				t.Errorf("%s: skipped file has matches", name)
+			}
+			if want := r.FilePath + " b2 a2"; got != want {
+				t.Errorf("%s: formatted %q, want %q", name, got, want)
+			}
+		default:
+			if !r.HasMatch() || !strings.HasSuffix(name, " b1 a1") {
+				t.Errorf("result %q: want a match and AfterMatch tags innermost first", name)
+			}
+			if want := r.FilePath + " b2 a2"; got != want {
+				t.Errorf("%s: formatted %q, want %q", name, got, want)
+			}
+		}
+		if r.Closer != nil {
+			r.Closer()
+		}
+	}
+	if _, ok := innerSaw.Load("f1"); ok {
+		t.Error("inner BeforeRead ran for a file the outer one skipped")
+	}
+	if _, ok := innerSaw.Load("f2"); !ok {
+		t.Error("inner BeforeRead did not run")
+	}
+	if searched, _ := s.Counts(); searched != n-2 {
+		t.Errorf("searched %d files, want %d", searched, n-2)
+	}
+}
+
+// TestGuard_MmapFault reads past the end of a mapped file that was
+// truncated after mapping, which raises SIGBUS.
+func TestGuard_MmapFault(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "f.bin")
+	os.WriteFile(path, bytes.Repeat([]byte("x"), 3*os.Getpagesize()), 0644)
+	res, err := input.NewMmapReader().Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Closer()
+	os.Truncate(path, 0)
+
+	result := Guard(path, func() output.Result {
+		return output.Result{FilePath: path, MatchCount: int(res.Data[len(res.Data)-1])}
+	})
+	var f *Fault
+	if !errors.As(result.Err, &f) {
+		t.Fatalf("Err = %v, want a *Fault", result.Err)
+	}
+}
+
+// Matches built in a worker's arena stay intact while their result is
+// held, however many files the worker searches meanwhile.
+func TestRun_ArenaOutlivesWorker(t *testing.T) {
+	dir := t.TempDir()
+	const n = 300
+	files := make(chan walker.FileEntry, n)
+	for i := range n {
+		path := filepath.Join(dir, fmt.Sprintf("f%03d.txt", i))
+		body := bytes.Repeat([]byte("x\n"), i%7) // the match moves down a line per file
+		os.WriteFile(path, append(body, "needle\nnone\nneedle needle\n"...), 0644)
+		files <- walker.FileEntry{Path: path}
+	}
+	close(files)
+
+	m, err := matcher.NewMatcher([]string{"needle"}, true, false, false, false, matcher.MatcherOpts{NeedLineNums: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var held []output.Result
+	for r := range New(4, m, input.NewBufferedReader(), false, false, false).Run(files) {
+		held = append(held, r)
+	}
+	for _, r := range held {
+		i := r.SeqNum - 1
+		ms := r.MatchSet
+		if len(ms.Matches) != 2 || ms.Matches[0].LineNum != i%7+1 || ms.Matches[1].LineNum != i%7+3 ||
+			len(ms.MatchPositions(1)) != 2 {
+			t.Errorf("%s: matches %+v", r.FilePath, ms.Matches)
+		}
+		r.Closer()
+	}
+}
+
+// A worker returns only the arena it still owns to the pool, not one a
+// held result took, so a later search cannot build in a held result's
+// matches.
+func TestRun_HeldArenaNotReused(t *testing.T) {
+	dir := t.TempDir()
+	search := func(names ...string) []output.Result {
+		files := make(chan walker.FileEntry, len(names))
+		for _, name := range names {
+			files <- walker.FileEntry{Path: filepath.Join(dir, name)}
+		}
+		close(files)
+		m, err := matcher.NewMatcher([]string{"needle"}, true, false, false, false, matcher.MatcherOpts{NeedLineNums: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var results []output.Result
+		for r := range New(1, m, input.NewBufferedReader(), false, false, false).Run(files) {
+			results = append(results, r)
+		}
+		return results
+	}
+	os.WriteFile(filepath.Join(dir, "held.txt"), []byte("needle\n"), 0644)
+	for i := range 8 {
+		os.WriteFile(filepath.Join(dir, fmt.Sprintf("f%d.txt", i)), []byte("x\nx\nx\nx\nneedle\n"), 0644)
+	}
+
+	held := search("held.txt")[0]
+	for i := range 8 {
+		for _, r := range search(fmt.Sprintf("f%d.txt", i), "held.txt") {
+			if r.Closer != nil {
+				r.Closer()
+			}
+		}
+	}
+	if ms := held.MatchSet; len(ms.Matches) != 1 || ms.Matches[0].LineNum != 1 {
+		t.Errorf("held matches changed: %+v", ms.Matches)
+	}
+	held.Closer()
+}
+
+func TestMatchExists_ByWindow(t *testing.T) {
+	line := []byte(strings.Repeat("x", 99) + "\n")
+	m := matcher.NewBoyerMooreMatcher("needle", false, false)
+	tests := []struct {
+		name      string
+		data      []byte
+		want      bool
+		wantAhead int // how far MatchExists prefetched
+	}{
+		{"early match", append(append([]byte("needle\n"), bytes.Repeat(line, 30000)...), "needle\n"...), true, existsWindow},
+		{"across a window edge", append(append(bytes.Repeat(line, existsWindow/100), strings.Repeat("x", 93)+"needle\n"...), bytes.Repeat(line, 20000)...), true, 2 * existsWindow},
+		{"long line", append([]byte(strings.Repeat("y", existsWindow+5)+"needle\n"), bytes.Repeat(line, 20000)...), true, 2 * existsWindow},
+		{"no match", bytes.Repeat(line, 30000), false, 30000 * len(line)},
+	}
+	for _, tt := range tests {
+		ahead := 0
+		r := &input.ReadResult{Data: tt.data, Prefetch: func(end int) { ahead = max(ahead, end) }}
+		if got := MatchExists(m, r); got != tt.want {
+			t.Errorf("%s: MatchExists = %v, want %v", tt.name, got, tt.want)
+		}
+		if ahead != tt.wantAhead {
+			t.Errorf("%s: prefetched %d bytes, want %d", tt.name, ahead, tt.wantAhead)
+		}
+	}
+}
@@ -1,3 +1,5 @@
+//go:build goexperiment.simd && amd64
+
 package simd
 
 import (
@@ -7,61 +9,6 @@ import (
 	"simd/archsimd"
 )
 
-// Index returns the index of the first occurrence of pattern in data, or -1 if not present.
-// Delegates to bytes.Index which uses optimized AVX2 assembly internally.
-func Index(data, pattern []byte) int {
-	return bytes.Index(data, pattern)
-}
-
-// IndexAll returns all byte offsets where pattern occurs in data.
-// Non-overlapping matches only. Uses bytes.Index (AVX2 asm) for the scan loop.
-func IndexAll(data, pattern []byte) []int {
-	plen := len(pattern)
-	switch {
-	case plen == 0:
-		return nil
-	case plen == 1:
-		return indexAllByte(data, pattern[0])
-	case plen > len(data):
-		return nil
-	}
-
-	// Collect into a non-escaping stack buffer first, then copy to heap
-	// only if we found matches. This avoids a 128-byte heap alloc on no-match.
-	var stackBuf [16]int
-	n := 0
-	var overflow []int
-	i := 0
-
-	for {
-		idx := bytes.Index(data[i:], pattern)
-		if idx < 0 {
-			break
-		}
-		if n < len(stackBuf) {
-			stackBuf[n] = i + idx
-		} else {
-			if overflow == nil {
-				overflow = make([]int, 0, 64)
-				overflow = append(overflow, stackBuf[:]...)
-			}
-			overflow = append(overflow, i+idx)
-		}
-		n++
-		i += idx + plen
-	}
-
-	if n == 0 {
-		return nil
-	}
-	if overflow != nil {
-		return overflow
-	}
-	result := make([]int, n)
-	copy(result, stackBuf[:n])
-	return result
-}
-
 // indexAllByte returns all byte offsets where byte c occurs in data.
 func indexAllByte(data []byte, c byte) []int {
 	var stackBuf [16]int
@@ -118,6 +65,72 @@ func indexAllByte(data []byte, c byte) []int {
 	return result
 }
 
+// countLines is CountLines for a non-empty pattern. Each 32-byte block is
+// compared once against the pattern's first and last bytes and against
+// '\n', giving a bitmap of candidate starts and one of line ends; the two
+// are then walked alternately: the first verified candidate counts its
+// line, and every bit up to the next newline is dropped.
+func countLines(data, pattern []byte) int {
+	plen := len(pattern)
+	first := archsimd.BroadcastUint8x32(pattern[0])
+	last := archsimd.BroadcastUint8x32(pattern[plen-1])
+	newline := archsimd.BroadcastUint8x32('\n')
+	count := 0
+	inLine := false // a line was counted and its newline not yet seen
+	i := 0
+	limit := len(data) - plen + 1
+
+	for i+32 <= limit {
+		block := archsimd.LoadUint8x32Slice(data[i:])
+		hits := block.Equal(first).ToBits()
+		if plen > 1 {
+			hits &= archsimd.LoadUint8x32Slice(data[i+plen-1:]).Equal(last).ToBits()
+		}
+		ends := block.Equal(newline).ToBits()
+		for {
+			if inLine {
+				if ends == 0 {
+					break
+				}
+				// Drop everything up to and including the newline.
+				keep := ^(uint32(2)<<bits.TrailingZeros32(ends) - 1)
+				hits &= keep
+				ends &= keep
+				inLine = false
+			}
+			for hits != 0 && plen > 2 {
+				j := i + bits.TrailingZeros32(hits)
+				if bytes.Equal(data[j+1:j+plen-1], pattern[1:plen-1]) {
+					break
+				}
+				hits &= hits - 1
+			}
+			if hits == 0 {
+				break
+			}
+			count++
+			inLine = true
+			// Newlines before the match end lines without one.
+			ends &^= uint32(1)<<bits.TrailingZeros32(hits) - 1
+		}
+		i += 32
+	}
+
+	// Scalar tail
+	for ; i < len(data); i++ {
+		switch {
+		case data[i] == '\n':
+			inLine = false
+		case !inLine && i < limit && bytes.Equal(data[i:i+plen], pattern):
+			count++
+			inLine = true
+		}
+	}
+
+	archsimd.ClearAVXUpperBits()
+	return count
+}
+
 // IndexCaseInsensitive returns the index of the first case-insensitive occurrence of pattern in data.
 // Pattern must be pre-lowered. Only handles ASCII case folding.
 func IndexCaseInsensitive(data, patternLower []byte) int {
@@ -202,6 +215,7 @@ func IndexAllCaseInsensitive(data, patternLower []byte) []int {
 	n := 0
 	var overflow []int
 	i := 0
+	next := 0 // no match may start before the end of the last one
 	limit := len(data) - plen + 1
 
 	for i+32 <= limit {
@@ -215,7 +229,7 @@ func IndexAllCaseInsensitive(data, patternLower []byte) []int {
 		for b != 0 {
 			j := bits.TrailingZeros32(b)
 			pos := i + j
-			if matchCaseInsensitive(data[pos:pos+plen], patternLower) {
+			if pos >= next && matchCaseInsensitive(data[pos:pos+plen], patternLower) {
 				if n < len(stackBuf) {
 					stackBuf[n] = pos
 				} else {
@@ -226,6 +240,7 @@ func IndexAllCaseInsensitive(data, patternLower []byte) []int {
 					overflow = append(overflow, pos)
 				}
 				n++
+				next = pos + plen
 				skipTo := j + plen
 				if skipTo < 32 {
 					b >>= skipTo
@@ -241,7 +256,7 @@ func IndexAllCaseInsensitive(data, patternLower []byte) []int {
 		i += 32
 	}
 
-	for ; i < limit; i++ {
+	for i = max(i, next); i < limit; i++ {
 		if matchCaseInsensitive(data[i:i+plen], patternLower) {
 			if n < len(stackBuf) {
 				stackBuf[n] = i
@@ -277,17 +292,3 @@ func matchCaseInsensitive(data, patternLower []byte) bool {
 	}
 	return true
 }
-
-func toLowerASCII(b byte) byte {
-	if b >= 'A' && b <= 'Z' {
-		return b + ('a' - 'A')
-	}
-	return b
-}
-
-func toUpperASCII(b byte) byte {
-	if b >= 'a' && b <= 'z' {
-		return b - ('a' - 'A')
-	}
-	return b
-}
@@ -2,6 +2,9 @@ package simd
 
 import (
 	"bytes"
+	"math/rand/v2"
+	"slices"
+	"strings"
 	"testing"
 )
 
@@ -183,6 +186,74 @@ func TestIndexAllCaseInsensitive(t *testing.T) {
 	}
 }
 
+func TestIndexAllCaseInsensitive_AcrossBlocks(t *testing.T) {
+	// A match that runs past the end of a 32-byte block must still hide
+	// the overlapping candidates at the start of the next one.
+	data := []byte(strings.Repeat("x", 30) + "AaAaAa" + strings.Repeat("x", 30))
+	got := IndexAllCaseInsensitive(data, []byte("aaaa"))
+	if want := []int{30}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestCountLines(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		pattern string
+		want    int
+	}{
+		{"empty pattern", "a\nb\n", "", 0},
+		{"empty data", "", "a", 0},
+		{"one per line", "ab\nab\nab", "a", 3},
+		{"many per line", "aaaa\naaa\n", "a", 2},
+		{"some lines", "foo\nbar\nfoo bar\n", "bar", 2},
+		{"no trailing newline", "x\ny", "y", 1},
+		{"empty lines", "\n\n\n", "a", 0},
+		{"not found", "abc\ndef\n", "xyz", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := CountLines([]byte(tt.data), []byte(tt.pattern))
+			if got != tt.want {
+				t.Errorf("CountLines(%q, %q) = %d, want %d", tt.data, tt.pattern, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestCountLines_LargeData checks the block kernel against a line-by-line
+// count, with matches and newlines falling on every position of a block.
+func TestCountLines_LargeData(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	alphabet := []byte("aab\n\nxy")
+	for n := range 200 {
+		data := make([]byte, 64+n*3)
+		for i := range data {
+			data[i] = alphabet[rng.IntN(len(alphabet))]
+		}
+		for _, pattern := range []string{"a", "b", "ab", "aab", "xy"} {
+			want := 0
+			for line := range bytes.Lines(data) {
+				if bytes.Contains(line, []byte(pattern)) {
+					want++
+				}
+			}
+			if got := CountLines(data, []byte(pattern)); got != want {
+				t.Fatalf("CountLines(%q, %q) = %d, want %d", data, pattern, got, want)
+			}
+		}
+	}
+}
+
+func TestCountLinesCaseInsensitive(t *testing.T) {
+	data := []byte("Hello\nHELLO hello\nworld\nhElLo")
+	if got := CountLinesCaseInsensitive(data, []byte("hello")); got != 3 {
+		t.Errorf("CountLinesCaseInsensitive = %d, want 3", got)
+	}
+}
+
 // Benchmarks
 
 func BenchmarkIndex_SIMD_Short(b *testing.B) {
@@ -0,0 +1,114 @@
+package simd
+
+import "bytes"
+
+// The functions in this file need no vector instructions of their own and
+// are built on every platform.
+
+// Index returns the index of the first occurrence of pattern in data, or -1 if not present.
+// Delegates to bytes.Index which uses optimized AVX2 assembly internally.
+func Index(data, pattern []byte) int {
+	return bytes.Index(data, pattern)
+}
+
+// IndexAll returns all byte offsets where pattern occurs in data.
+// Non-overlapping matches only. Uses bytes.Index (AVX2 asm) for the scan loop.
+func IndexAll(data, pattern []byte) []int {
+	plen := len(pattern)
+	switch {
+	case plen == 0:
+		return nil
+	case plen == 1:
+		return indexAllByte(data, pattern[0])
+	case plen > len(data):
+		return nil
+	}
+
+	// Collect into a non-escaping stack buffer first, then copy to heap
+	// only if we found matches. This avoids a 128-byte heap alloc on no-match.
+	var stackBuf [16]int
+	n := 0
+	var overflow []int
+	i := 0
+
+	for {
+		idx := bytes.Index(data[i:], pattern)
+		if idx < 0 {
+			break
+		}
+		if n < len(stackBuf) {
+			stackBuf[n] = i + idx
+		} else {
+			if overflow == nil {
+				overflow = make([]int, 0, 64)
+				overflow = append(overflow, stackBuf[:]...)
+			}
+			overflow = append(overflow, i+idx)
+		}
+		n++
+		i += idx + plen
+	}
+
+	if n == 0 {
+		return nil
+	}
+	if overflow != nil {
+		return overflow
+	}
+	result := make([]int, n)
+	copy(result, stackBuf[:n])
+	return result
+}
+
+// CountLines returns the number of lines of data that contain pattern,
+// which must not contain a newline. Once a line has matched, the rest of
+// it is skipped, and no offsets are collected: on dense data -c no longer
+// pays for every match plus a slice of them all.
+func CountLines(data, pattern []byte) int {
+	if len(pattern) == 0 {
+		return 0
+	}
+	return countLines(data, pattern)
+}
+
+// CountLinesCaseInsensitive is CountLines with ASCII case folding.
+// Pattern must be pre-lowered.
+func CountLinesCaseInsensitive(data, patternLower []byte) int {
+	if len(patternLower) == 0 {
+		return 0
+	}
+	return countLinesWith(data, func(d []byte) int { return IndexCaseInsensitive(d, patternLower) })
+}
+
+// countLinesWith counts the lines of data in which index, returning the
+// first match in its argument or -1, finds a match that starts there.
+func countLinesWith(data []byte, index func([]byte) int) int {
+	count := 0
+	for i := 0; i < len(data); {
+		j := index(data[i:])
+		if j < 0 {
+			break
+		}
+		count++
+		k := bytes.IndexByte(data[i+j:], '\n')
+		if k < 0 {
+			break
+		}
+		i += j + k + 1
+	}
+	return count
+}
+
+func toLowerASCII(b byte) byte {
+	if b >= 'A' && b <= 'Z' {
+		return b + ('a' - 'A')
+	}
+	return b
+}
+
+func toUpperASCII(b byte) byte {
+	if b >= 'a' && b <= 'z' {
+		return b - ('a' - 'A')
+	}
+	return b
+}
@@ -0,0 +1,124 @@
+//go:build !(goexperiment.simd && amd64)
+
+package simd
+
+import "bytes"
+
+// Scalar versions of the vector functions in simd.go and index.go, for
+// builds without simd/archsimd (wasm, other architectures, or no
+// GOEXPERIMENT=simd). They return the same results; the bytes package
+// still uses whatever assembly the platform has.
+
+// backend names this implementation in SelfTest's report.
+const backend = "scalar"
+
+// supported reports whether the CPU can run this implementation: always.
+func supported() bool {
+	return true
+}
+
+// IndexByte returns the index of the first occurrence of c in data, or -1 if not present.
+func IndexByte(data []byte, c byte) int {
+	return bytes.IndexByte(data, c)
+}
+
+// IndexAnyByte returns the index of the first byte of data that is in
+// set, or -1 if there is none.
+func IndexAnyByte(data []byte, set []byte) int {
+	if len(set) == 1 {
+		return bytes.IndexByte(data, set[0])
+	}
+	var in [256]bool
+	for _, c := range set {
+		in[c] = true
+	}
+	for i, b := range data {
+		if in[b] {
+			return i
+		}
+	}
+	return -1
+}
+
+// LastIndexByte returns the index of the last occurrence of c in data, or -1 if not present.
+func LastIndexByte(data []byte, c byte) int {
+	return bytes.LastIndexByte(data, c)
+}
+
+// Count returns the number of occurrences of c in data.
+func Count(data []byte, c byte) int {
+	return bytes.Count(data, []byte{c})
+}
+
+// ToLowerASCII lowercases ASCII bytes from src into dst.
+// dst must be at least len(src) bytes. Non-ASCII bytes are copied unchanged.
+func ToLowerASCII(dst, src []byte) {
+	for i, b := range src {
+		dst[i] = toLowerASCII(b)
+	}
+}
+
+// indexAllByte returns all byte offsets where byte c occurs in data.
+func indexAllByte(data []byte, c byte) []int {
+	var result []int
+	for i := 0; ; i++ {
+		j := bytes.IndexByte(data[i:], c)
+		if j < 0 {
+			return result
+		}
+		i += j
+		result = append(result, i)
+	}
+}
+
+// countLines is CountLines for a non-empty pattern.
+func countLines(data, pattern []byte) int {
+	return countLinesWith(data, func(d []byte) int { return bytes.Index(d, pattern) })
+}
+
+// IndexCaseInsensitive returns the index of the first case-insensitive occurrence of pattern in data.
+// Pattern must be pre-lowered. Only handles ASCII case folding.
+func IndexCaseInsensitive(data, patternLower []byte) int {
+	plen := len(patternLower)
+	switch {
+	case plen == 0:
+		return 0
+	case plen > len(data):
+		return -1
+	}
+	for i := 0; i+plen <= len(data); i++ {
+		if equalFoldLower(data[i:i+plen], patternLower) {
+			return i
+		}
+	}
+	return -1
+}
+
+// IndexAllCaseInsensitive returns all byte offsets of case-insensitive, non-overlapping matches.
+func IndexAllCaseInsensitive(data, patternLower []byte) []int {
+	plen := len(patternLower)
+	if plen == 0 || plen > len(data) {
+		return nil
+	}
+	var result []int
+	for i := 0; i+plen <= len(data); {
+		if equalFoldLower(data[i:i+plen], patternLower) {
+			result = append(result, i)
+			i += plen
+		} else {
+			i++
+		}
+	}
+	return result
+}
+
+// equalFoldLower reports whether s equals the lowercase lower under ASCII
+// case folding.
+func equalFoldLower(s, lower []byte) bool {
+	for i, b := range s {
+		if toLowerASCII(b) != lower[i] {
+			return false
+		}
+	}
+	return true
+}
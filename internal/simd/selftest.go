@@ -0,0 +1,254 @@
+package simd
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strings"
+)
+
+// SelfTestReport is the outcome of SelfTest: which backend was checked
+// and how each function fared.
+type SelfTestReport struct {
+	Backend string // "avx2" or "scalar"
+	// Unsupported is set when the CPU lacks the instructions the backend
+	// was built for. No check is run then: the first would crash.
+	Unsupported bool
+	Checks      []SelfTestCheck
+}
+
+// SelfTestCheck is the result of comparing one function with its
+// reference on every generated case.
+type SelfTestCheck struct {
+	Name    string
+	Cases   int    // cases compared
+	Failure string // the first differing case, or "" if all agreed
+}
+
+// OK reports whether the backend is supported and every check passed.
+func (r SelfTestReport) OK() bool {
+	if r.Unsupported {
+		return false
+	}
+	for _, c := range r.Checks {
+		if c.Failure != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// String formats the report as one line per check, then a verdict.
+func (r SelfTestReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "backend: %s\n", r.Backend)
+	if r.Unsupported {
+		b.WriteString("FAIL: this CPU lacks the instructions the backend needs; use a build without GOEXPERIMENT=simd\n")
+		return b.String()
+	}
+	for _, c := range r.Checks {
+		if c.Failure != "" {
+			fmt.Fprintf(&b, "FAIL %-26s %s\n", c.Name, c.Failure)
+		} else {
+			fmt.Fprintf(&b, "ok   %-26s %d cases\n", c.Name, c.Cases)
+		}
+	}
+	if r.OK() {
+		b.WriteString("PASS\n")
+	} else {
+		b.WriteString("FAIL\n")
+	}
+	return b.String()
+}
+
+// SelfTest compares every exported search function with a plain
+// implementation built on the bytes package, on rounds random inputs drawn
+// from seed, and reports the first difference of each. The inputs vary in
+// length around the 32-byte vector width, in alignment, and in how often
+// the needle occurs, so that tails, block edges and dense matches are all
+// exercised on the running CPU. A check that panics fails with the panic.
+func SelfTest(rounds int, seed uint64) SelfTestReport {
+	r := SelfTestReport{Backend: backend}
+	if !supported() {
+		r.Unsupported = true
+		return r
+	}
+	rng := rand.New(rand.NewPCG(seed, seed^0x9e3779b97f4a7c15))
+	for _, c := range selfTestChecks {
+		r.Checks = append(r.Checks, runCheck(c, rounds, rng))
+	}
+	return r
+}
+
+// selfTestCase is one generated input: data and a needle drawn from the
+// same alphabet, so that it often occurs.
+type selfTestCase struct {
+	data   []byte
+	needle []byte
+	set    []byte
+}
+
+// selfTestAlphabet mixes letters of both cases, newlines and bytes with
+// the high bit set, where signed comparisons or case folding would slip.
+const selfTestAlphabet = "aAbBzZ\n\x00\x7f\x80\xc3\xff"
+
+// selfTestCheck compares one function with its reference on a case,
+// returning a description of the difference or "".
+type selfTestCheck struct {
+	name  string
+	check func(tc selfTestCase) string
+}
+
+func runCheck(c selfTestCheck, rounds int, rng *rand.Rand) (res SelfTestCheck) {
+	res.Name = c.name
+	var tc selfTestCase
+	defer func() {
+		if p := recover(); p != nil {
+			res.Failure = fmt.Sprintf("panic %v on data %q needle %q", p, tc.data, tc.needle)
+		}
+	}()
+	for range rounds {
+		tc = newSelfTestCase(rng)
+		res.Cases++
+		if f := c.check(tc); f != "" {
+			res.Failure = f + fmt.Sprintf(" (data %q, needle %q)", tc.data, tc.needle)
+			return res
+		}
+	}
+	return res
+}
+
+// newSelfTestCase draws a case. The data sits at a random offset into a
+// larger buffer, so loads start at every alignment.
+func newSelfTestCase(rng *rand.Rand) selfTestCase {
+	n := rng.IntN(4 * 32)
+	if rng.IntN(4) == 0 {
+		n = rng.IntN(1024)
+	}
+	// A narrow alphabet makes dense matches; the full one makes sparse.
+	alphabet := selfTestAlphabet[:2+rng.IntN(len(selfTestAlphabet)-1)]
+	off := rng.IntN(32)
+	buf := make([]byte, off+n)
+	for i := range buf {
+		buf[i] = alphabet[rng.IntN(len(alphabet))]
+	}
+	data := buf[off:]
+
+	var needle []byte
+	if n > 0 && rng.IntN(2) == 0 {
+		// Cut from data, so that it occurs at least once.
+		i := rng.IntN(n)
+		needle = slices.Clone(data[i:min(n, i+1+rng.IntN(8))])
+	} else {
+		needle = make([]byte, 1+rng.IntN(8))
+		for i := range needle {
+			needle[i] = alphabet[rng.IntN(len(alphabet))]
+		}
+	}
+	set := make([]byte, 1+rng.IntN(8))
+	for i := range set {
+		set[i] = selfTestAlphabet[rng.IntN(len(selfTestAlphabet))]
+	}
+	return selfTestCase{data: data, needle: needle, set: set}
+}
+
+var selfTestChecks = []selfTestCheck{
+	{"IndexByte", func(tc selfTestCase) string {
+		return compare(IndexByte(tc.data, tc.needle[0]), bytes.IndexByte(tc.data, tc.needle[0]))
+	}},
+	{"IndexAnyByte", func(tc selfTestCase) string {
+		want := -1
+		for i, b := range tc.data {
+			if bytes.IndexByte(tc.set, b) >= 0 {
+				want = i
+				break
+			}
+		}
+		return compare(IndexAnyByte(tc.data, tc.set), want)
+	}},
+	{"LastIndexByte", func(tc selfTestCase) string {
+		return compare(LastIndexByte(tc.data, tc.needle[0]), bytes.LastIndexByte(tc.data, tc.needle[0]))
+	}},
+	{"Count", func(tc selfTestCase) string {
+		return compare(Count(tc.data, tc.needle[0]), bytes.Count(tc.data, tc.needle[:1]))
+	}},
+	{"ToLowerASCII", func(tc selfTestCase) string {
+		got := make([]byte, len(tc.data))
+		ToLowerASCII(got, tc.data)
+		return compare(string(got), string(lowerASCII(tc.data)))
+	}},
+	{"Index", func(tc selfTestCase) string {
+		return compare(Index(tc.data, tc.needle), bytes.Index(tc.data, tc.needle))
+	}},
+	{"IndexAll", func(tc selfTestCase) string {
+		return compare(IndexAll(tc.data, tc.needle), indexAllRef(tc.data, tc.needle))
+	}},
+	{"IndexCaseInsensitive", func(tc selfTestCase) string {
+		lower := lowerASCII(tc.needle)
+		return compare(IndexCaseInsensitive(tc.data, lower), bytes.Index(lowerASCII(tc.data), lower))
+	}},
+	{"IndexAllCaseInsensitive", func(tc selfTestCase) string {
+		lower := lowerASCII(tc.needle)
+		return compare(IndexAllCaseInsensitive(tc.data, lower), indexAllRef(lowerASCII(tc.data), lower))
+	}},
+	{"CountLines", func(tc selfTestCase) string {
+		needle := lineNeedle(tc.needle)
+		return compare(CountLines(tc.data, needle), countLinesRef(tc.data, needle))
+	}},
+	{"CountLinesCaseInsensitive", func(tc selfTestCase) string {
+		lower := lowerASCII(lineNeedle(tc.needle))
+		return compare(CountLinesCaseInsensitive(tc.data, lower), countLinesRef(lowerASCII(tc.data), lower))
+	}},
+}
+
+// compare describes how got differs from want, or returns "".
+func compare[T any](got, want T) string {
+	if g, w := fmt.Sprint(got), fmt.Sprint(want); g != w {
+		return fmt.Sprintf("got %s, want %s", g, w)
+	}
+	return ""
+}
+
+func lowerASCII(b []byte) []byte {
+	out := make([]byte, len(b))
+	for i, c := range b {
+		out[i] = toLowerASCII(c)
+	}
+	return out
+}
+
+// indexAllRef is IndexAll by repeated bytes.Index.
+func indexAllRef(data, pattern []byte) []int {
+	var out []int
+	for i := 0; i+len(pattern) <= len(data); {
+		j := bytes.Index(data[i:], pattern)
+		if j < 0 {
+			break
+		}
+		out = append(out, i+j)
+		i += j + len(pattern)
+	}
+	return out
+}
+
+// countLinesRef is CountLines line by line.
+func countLinesRef(data, pattern []byte) int {
+	n := 0
+	for line := range bytes.Lines(data) {
+		if bytes.Contains(line, pattern) {
+			n++
+		}
+	}
+	return n
+}
+
+// lineNeedle drops the newlines CountLines does not accept, keeping at
+// least one byte.
+func lineNeedle(needle []byte) []byte {
+	out := bytes.ReplaceAll(needle, []byte("\n"), nil)
+	if len(out) == 0 {
+		return []byte("a")
+	}
+	return out
+}
@@ -0,0 +1,33 @@
+package simd
+
+import (
+	"math/rand/v2"
+	"strings"
+	"testing"
+)
+
+func TestSelfTest(t *testing.T) {
+	r := SelfTest(3000, 1)
+	if !r.OK() {
+		t.Fatalf("self-test failed:\n%s", r)
+	}
+	if len(r.Checks) != len(selfTestChecks) || !strings.HasSuffix(r.String(), "PASS\n") {
+		t.Errorf("unexpected report:\n%s", r)
+	}
+}
+
+func TestSelfTest_ReportsFailure(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	broken := selfTestCheck{"Broken", func(tc selfTestCase) string {
+		return compare(len(tc.data)%7, 0)
+	}}
+	if res := runCheck(broken, 100, rng); res.Failure == "" {
+		t.Error("differing results not reported")
+	}
+	panics := selfTestCheck{"Panics", func(tc selfTestCase) string {
+		return compare(tc.data[len(tc.data)], 0)
+	}}
+	if res := runCheck(panics, 100, rng); !strings.HasPrefix(res.Failure, "panic") {
+		t.Errorf("panic reported as %q", res.Failure)
+	}
+}
@@ -1,5 +1,8 @@
+//go:build goexperiment.simd && amd64
+
 // Package simd provides SIMD-accelerated byte search functions using Go 1.26's
-// simd/archsimd intrinsics. Requires GOEXPERIMENT=simd at build time.
+// simd/archsimd intrinsics, built with GOEXPERIMENT=simd on amd64. Other
+// builds, such as wasm, get the scalar versions in scalar.go.
 package simd
 
 import (
@@ -8,6 +11,14 @@ import (
 	"simd/archsimd"
 )
 
+// backend names this implementation in SelfTest's report.
+const backend = "avx2"
+
+// supported reports whether the CPU can run this implementation.
+func supported() bool {
+	return archsimd.X86.AVX2()
+}
+
 // IndexByte returns the index of the first occurrence of c in data, or -1 if not present.
 // Uses AVX2 VPCMPEQB to compare 32 bytes per iteration.
 func IndexByte(data []byte, c byte) int {
@@ -42,6 +53,55 @@ func IndexByte(data []byte, c byte) int {
 	return -1
 }
 
+// IndexAnyByte returns the index of the first byte in data that is one of
+// set, or -1 if there is none. Meant for small sets (up to about 8 bytes):
+// each 32-byte chunk is compared against every byte of set.
+func IndexAnyByte(data []byte, set []byte) int {
+	n := len(data)
+	if n == 0 || len(set) == 0 {
+		return -1
+	}
+	if len(set) == 1 {
+		return IndexByte(data, set[0])
+	}
+
+	var needles [8]archsimd.Uint8x32
+	k := min(len(set), len(needles))
+	for j := range k {
+		needles[j] = archsimd.BroadcastUint8x32(set[j])
+	}
+	i := 0
+
+	if k == len(set) {
+		for i+32 <= n {
+			chunk := archsimd.LoadUint8x32Slice(data[i:])
+			mask := chunk.Equal(needles[0])
+			for j := 1; j < k; j++ {
+				mask = mask.Or(chunk.Equal(needles[j]))
+			}
+			b := mask.ToBits()
+			if b != 0 {
+				archsimd.ClearAVXUpperBits()
+				return i + bits.TrailingZeros32(b)
+			}
+			i += 32
+		}
+	}
+
+	// Scalar tail, and sets too large for the vector loop
+	for ; i < n; i++ {
+		for _, c := range set {
+			if data[i] == c {
+				archsimd.ClearAVXUpperBits()
+				return i
+			}
+		}
+	}
+
+	archsimd.ClearAVXUpperBits()
+	return -1
+}
+
 // LastIndexByte returns the index of the last occurrence of c in data, or -1 if not present.
 // Uses AVX2 scanning from the end.
 func LastIndexByte(data []byte, c byte) int {
@@ -69,6 +69,30 @@ func TestIndexByte_LargeData(t *testing.T) {
 	}
 }
 
+func TestIndexAnyByte(t *testing.T) {
+	tests := []struct {
+		data string
+		set  string
+	}{
+		{"", "ab"},
+		{"abc", ""},
+		{"abc", "c"},
+		{"xyzxyz", "ab"},
+		{"aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaX", "XYZ"},
+		{"aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaZaaaaaaaaX", "XYZ"},
+		{"aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", "XYZ"},
+		{"aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaj", "bcdefghij"},
+	}
+
+	for _, tt := range tests {
+		got := IndexAnyByte([]byte(tt.data), []byte(tt.set))
+		want := bytes.IndexAny([]byte(tt.data), tt.set)
+		if got != want {
+			t.Errorf("IndexAnyByte(%q, %q) = %d, want %d", tt.data, tt.set, got, want)
+		}
+	}
+}
+
 func TestLastIndexByte(t *testing.T) {
 	tests := []struct {
 		name string
@@ -0,0 +1,76 @@
+package walker
+
+import (
+	"path/filepath"
+	"sync"
+)
+
+// Canonical resolves file paths to their real paths, absolute with every
+// symlink, "." and ".." resolved, and remembers which real paths it has
+// handed out, so a file reached under several paths is searched once.
+// Hard links keep their own paths. Safe for concurrent use.
+type Canonical struct {
+	mu   sync.Mutex
+	dirs map[string]string   // directory as given -> its real path
+	seen map[string]struct{} // real paths handed out
+}
+
+// NewCanonical returns an empty Canonical.
+func NewCanonical() *Canonical {
+	return &Canonical{dirs: make(map[string]string), seen: make(map[string]struct{})}
+}
+
+// Resolve returns the real path of the file at path, and false if a
+// previous call already returned it. A path that cannot be resolved is
+// returned as given, so the search reports why it cannot be read.
+func (c *Canonical) Resolve(path string) (string, bool) {
+	real, err := c.realPath(path)
+	if err != nil {
+		return path, true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, dup := c.seen[real]; dup {
+		return real, false
+	}
+	c.seen[real] = struct{}{}
+	return real, true
+}
+
+// realPath resolves path. A directory is resolved once for all the files
+// in it; after that each file costs one lstat.
+func (c *Canonical) realPath(path string) (string, error) {
+	dir, name := filepath.Split(path)
+	c.mu.Lock()
+	realDir, ok := c.dirs[dir]
+	c.mu.Unlock()
+	if !ok {
+		eval := dir
+		if eval == "" {
+			eval = "."
+		}
+		// Symlinks first: "link/.." is the parent of link's target, which
+		// cleaning the path lexically would get wrong.
+		resolved, err := filepath.EvalSymlinks(eval)
+		if err != nil {
+			return "", err
+		}
+		if realDir, err = filepath.Abs(resolved); err != nil {
+			return "", err
+		}
+		c.mu.Lock()
+		c.dirs[dir] = realDir
+		c.mu.Unlock()
+	}
+	full := filepath.Join(realDir, name)
+	typ, err := statType(full, false)
+	if err != nil {
+		return "", err
+	}
+	if typ == DT_LNK {
+		if full, err = filepath.EvalSymlinks(full); err != nil {
+			return "", err
+		}
+	}
+	return full, nil
+}
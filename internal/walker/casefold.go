@@ -0,0 +1,12 @@
+package walker
+
+import "strings"
+
+// foldName lowercases s when fold is set. Used on both sides of glob and
+// ignore comparisons, mirroring git's core.ignorecase.
+func foldName(s string, fold bool) string {
+	if !fold {
+		return s
+	}
+	return strings.ToLower(s)
+}
@@ -28,6 +28,7 @@ const (
 type Dirent struct {
 	Name string
 	Type uint8
+	Ino  uint64 // inode number; 0 where the platform does not report it
 }
 
 // ParseDirents parses raw getdents64 output into Dirent structs.
@@ -43,7 +44,8 @@ func ParseDirents(buf []byte, n int, dst []Dirent) []Dirent {
 			break
 		}
 
-		// Parse fields from the raw buffer (skip d_ino at offset+0, d_off at offset+8)
+		// Parse fields from the raw buffer (skip d_off at offset+8)
+		ino := *(*uint64)(unsafe.Pointer(&buf[offset]))
 		reclen := *(*uint16)(unsafe.Pointer(&buf[offset+16]))
 		dtype := buf[offset+18]
 
@@ -71,6 +73,7 @@ func ParseDirents(buf []byte, n int, dst []Dirent) []Dirent {
 			entries = append(entries, Dirent{
 				Name: name,
 				Type: dtype,
+				Ino:  ino,
 			})
 		}
 
@@ -0,0 +1,219 @@
+package walker
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Explanation is the walker's verdict on one path: whether a recursive
+// walk of its root would search it and which check decided.
+type Explanation struct {
+	Path     string // the path asked about
+	Included bool
+	Entry    string // what the verdict is about: Path, or the ancestor directory that was skipped
+	Layer    string // deciding check: "vcs", "hidden", "binary-glob", "binary-extension", "gitignore", "glob", "symlink", "file-type", "binary-content", "text-glob", "repo-boundary", "virtual-fs"; "" if nothing excluded it
+	Detail   string // the deciding rule, or why nothing excluded it
+}
+
+// String formats e as one line, for example
+//
+//	build/out.txt: excluded by gitignore on directory build: rule "build/" at .gitignore:1
+func (e Explanation) String() string {
+	if e.Included {
+		if e.Layer == "" {
+			return fmt.Sprintf("%s: included: %s", e.Path, e.Detail)
+		}
+		return fmt.Sprintf("%s: included by %s: %s", e.Path, e.Layer, e.Detail)
+	}
+	if e.Entry != e.Path {
+		return fmt.Sprintf("%s: excluded by %s on directory %s: %s", e.Path, e.Layer, e.Entry, e.Detail)
+	}
+	return fmt.Sprintf("%s: excluded by %s: %s", e.Path, e.Layer, e.Detail)
+}
+
+// Explain evaluates path the way a recursive walk of roots would reach
+// it: each directory on the way down is checked like a subdirectory and
+// contributes its .gitignore, then path itself is checked like a file. It
+// uses the same checks as the walk, in the same order, and reports the
+// first that drops an entry. Files that survive are also checked for
+// binary content unless opts.IncludeBinary is set or a text glob forces
+// them to text, as searching skips binary files. Roots in opts.Roots are
+// considered after roots, with their own options.
+func Explain(path string, roots []string, opts WalkOptions) (Explanation, error) {
+	e := Explanation{Path: path, Entry: path, Included: true}
+	if len(roots) == 0 && len(opts.Roots) == 0 {
+		roots = []string{"."}
+	}
+	root, rel, err := explainRoot(path, walkRoots(roots, opts))
+	if err != nil {
+		return e, err
+	}
+	if rel == "." {
+		e.Detail = "named on the command line"
+		return e, nil
+	}
+
+	f := root.filter
+	item := root.item()
+
+	names := strings.Split(rel, "/")
+	for i, name := range names {
+		fullPath := joinPath(item.path, name)
+		last := i == len(names)-1
+		skip := func(layer, detail string) (Explanation, error) {
+			e.Included = false
+			e.Entry = fullPath
+			if last {
+				e.Entry = path
+			}
+			e.Layer, e.Detail = layer, detail
+			return e, nil
+		}
+
+		typ, err := statType(fullPath, false)
+		if err != nil {
+			return e, &WalkError{Path: fullPath, Err: err}
+		}
+		if typ == DT_LNK {
+			if !f.followSymlinks {
+				return skip("symlink", "symlinks are not followed without -L")
+			}
+			if typ, err = statType(fullPath, true); err != nil {
+				return skip("symlink", "broken symlink")
+			}
+		}
+
+		switch typ {
+		case DT_DIR:
+			r := f.subdirReason(item, name, fullPath)
+			if r == keep && !f.virtualFS && !item.virtual && isVirtualFS(fullPath) {
+				// The walk finds this out when it opens the directory.
+				r = skipVirtual
+			}
+			if r != keep {
+				return skip(f.explainSkip(r, item, name, fullPath, true))
+			}
+			if last {
+				e.Layer, e.Detail = f.explainKeep(item, name, fullPath, true)
+				return e, nil
+			}
+			item = subdirItem(item, fullPath, nil)
+		case DT_REG:
+			if !last {
+				return e, &WalkError{Path: fullPath, Err: errNotDir}
+			}
+			if r := f.fileReason(item, name, fullPath); r != keep {
+				return skip(f.explainSkip(r, item, name, fullPath, false))
+			}
+			if !f.includeBinary && f.binary.Resolve(fullPath) == BinaryAuto {
+				binary, err := hasBinaryHead(fullPath)
+				if err != nil {
+					return e, &WalkError{Path: fullPath, Err: err}
+				}
+				if binary {
+					return skip("binary-content", "NUL byte in the first 8 KiB; use -a to search it")
+				}
+			}
+			e.Layer, e.Detail = f.explainKeep(item, name, fullPath, false)
+			return e, nil
+		default:
+			return skip("file-type", "not a regular file or directory")
+		}
+	}
+	return e, nil
+}
+
+// explainRoot picks the first root containing path and returns it with
+// path relative to it, slash-separated.
+func explainRoot(path string, roots []walkRoot) (root walkRoot, rel string, err error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return root, "", err
+	}
+	names := make([]string, len(roots))
+	for i, r := range roots {
+		names[i] = r.path
+		absRoot, err := filepath.Abs(r.path)
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(absRoot, absPath)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+			continue
+		}
+		return r, filepath.ToSlash(rel), nil
+	}
+	return root, "", fmt.Errorf("%s is not under %s", path, strings.Join(names, ", "))
+}
+
+// explainSkip names the check behind r and the rule that triggered it.
+func (f *walkFilter) explainSkip(r skipReason, item walkItem, name, fullPath string, isDir bool) (layer, detail string) {
+	switch r {
+	case skipVCS:
+		return "vcs", "version-control and node_modules directories are never searched"
+	case skipHidden:
+		if isDir {
+			return "hidden", "hidden directory; use --hidden or --hidden-dirs"
+		}
+		return "hidden", "hidden file; use --hidden or --hidden-files"
+	case skipBinary:
+		if o, g := f.binary.resolve(fullPath); o == ForceBinary {
+			return "binary-glob", fmt.Sprintf("matches --binary-glob %q; use -a to search it", g)
+		}
+		return "binary-extension", fmt.Sprintf("%s is a known binary extension; use -a or --remove-binary-ext to search it", filepath.Ext(name))
+	case skipIgnore:
+		l, rule, _ := ignoreRule(item.ignores, fullPath, isDir)
+		return "gitignore", fmt.Sprintf("rule %q at %s:%d", rule.Line, joinPath(l.dir, ".gitignore"), rule.LineNo)
+	case skipGlob:
+		if exclude, _ := f.globRule(name, item.fold); exclude != "" {
+			return "glob", fmt.Sprintf("matches --glob %q", exclude)
+		}
+		return "glob", "matches no --glob include pattern"
+	case skipRepo:
+		if typ, _ := gitEntry(fullPath); typ == DT_DIR {
+			return "repo-boundary", "nested git repository; searched unless --stop-at-repo-boundary"
+		}
+		return "repo-boundary", "git submodule or worktree; searched unless --stop-at-repo-boundary or --skip-submodules"
+	case skipVirtual:
+		return "virtual-fs", "virtual filesystem such as /proc or /sys; use --virtual-fs to search it"
+	}
+	return "", ""
+}
+
+// explainKeep reports what let an entry through, if anything overrode a
+// check that would otherwise have dropped it.
+func (f *walkFilter) explainKeep(item walkItem, name, fullPath string, isDir bool) (layer, detail string) {
+	if isHidden(name) {
+		allowed := f.hidden.files
+		if isDir {
+			allowed = f.hidden.dirs
+		}
+		if !allowed {
+			return "hidden", fmt.Sprintf("re-included by --hidden-glob %q", f.hidden.includedBy(name, item.fold))
+		}
+	}
+	if !isDir {
+		if o, g := f.binary.resolve(fullPath); o == ForceText {
+			return "text-glob", fmt.Sprintf("matches --text-glob %q, so binary detection is skipped", g)
+		}
+	}
+	if _, rule, _ := ignoreRule(item.ignores, fullPath, isDir); rule != nil {
+		return "gitignore", fmt.Sprintf("rule %q is negated by a later \"!\" rule", rule.Line)
+	}
+	if _, include := f.globRule(name, item.fold); include != "" {
+		return "glob", fmt.Sprintf("matches --glob %q", include)
+	}
+	return "", "no rule excludes it"
+}
+
+// hasBinaryHead reports whether the file at path is binary by IsBinary's
+// rule, reading only the bytes that rule looks at.
+func hasBinaryHead(path string) (bool, error) {
+	buf := make([]byte, 8192)
+	n, err := readHead(path, buf)
+	if err != nil {
+		return false, err
+	}
+	return IsBinary(buf[:n]), nil
+}
@@ -0,0 +1,96 @@
+package walker
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	root := t.TempDir()
+	for _, d := range []string{"src", "build", ".cache", ".git", "node_modules", "sub"} {
+		os.Mkdir(filepath.Join(root, d), 0755)
+	}
+	files := map[string]string{
+		".gitignore":        "build/\n*.log\n!keep.log\n",
+		"src/main.go":       "package main\n",
+		"src/app.log":       "log\n",
+		"src/keep.log":      "log\n",
+		"src/img.png":       "png\n",
+		"src/.env":          "x\n",
+		"src/data.txt":      "a\x00b\n",
+		"src/app.min.js":    "x\n",
+		"build/out.txt":     "x\n",
+		".cache/entry":      "x\n",
+		".git/config":       "x\n",
+		"node_modules/x.js": "x\n",
+		"sub/.git":          "gitdir: ../.git/modules/sub\n",
+		"sub/x.go":          "package sub\n",
+	}
+	for name, data := range files {
+		os.WriteFile(filepath.Join(root, name), []byte(data), 0644)
+	}
+	os.Symlink("main.go", filepath.Join(root, "src/link.go"))
+
+	tests := []struct {
+		path     string
+		opts     WalkOptions
+		included bool
+		layer    string
+		entry    string // ancestor the verdict is about, if not path
+	}{
+		{"src/main.go", WalkOptions{}, true, "", ""},
+		{"src/app.log", WalkOptions{}, false, "gitignore", ""},
+		{"src/keep.log", WalkOptions{}, true, "gitignore", ""},
+		{"src/app.log", WalkOptions{NoIgnore: true}, true, "", ""},
+		{"build/out.txt", WalkOptions{}, false, "gitignore", "build"},
+		{"src/img.png", WalkOptions{}, false, "binary-extension", ""},
+		{"src/data.txt", WalkOptions{}, false, "binary-content", ""},
+		{"src/data.txt", WalkOptions{IncludeBinary: true}, true, "", ""},
+		{"src/.env", WalkOptions{}, false, "hidden", ""},
+		{"src/.env", WalkOptions{HiddenGlobs: []string{".env"}}, true, "hidden", ""},
+		{".cache/entry", WalkOptions{HiddenFiles: true}, false, "hidden", ".cache"},
+		{".git/config", WalkOptions{Hidden: true}, false, "vcs", ".git"},
+		{"node_modules/x.js", WalkOptions{}, false, "vcs", "node_modules"},
+		{"src/app.min.js", WalkOptions{Globs: []string{"!*.min.js"}}, false, "glob", ""},
+		{"src/link.go", WalkOptions{}, false, "symlink", ""},
+		{"src/link.go", WalkOptions{FollowSymlinks: true}, true, "", ""},
+		{"src", WalkOptions{}, true, "", ""},
+		{"src/img.png", WalkOptions{Binary: &BinaryPolicy{TextGlobs: []string{"*.png"}}}, true, "text-glob", ""},
+		{"src/data.txt", WalkOptions{Binary: &BinaryPolicy{TextGlobs: []string{"src/*.txt"}}}, true, "text-glob", ""},
+		{"src/main.go", WalkOptions{Binary: &BinaryPolicy{BinaryGlobs: []string{"main.*"}}}, false, "binary-glob", ""},
+		{"sub/x.go", WalkOptions{}, true, "", ""},
+		{"sub/x.go", WalkOptions{Repos: StopAtSubmodules}, false, "repo-boundary", "sub"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			path := filepath.Join(root, tt.path)
+			e, err := Explain(path, []string{root}, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e.Included != tt.included || e.Layer != tt.layer {
+				t.Errorf("got included=%v layer=%q (%s), want %v %q", e.Included, e.Layer, e, tt.included, tt.layer)
+			}
+			wantEntry := path
+			if tt.entry != "" {
+				wantEntry = filepath.Join(root, tt.entry)
+			}
+			if e.Entry != wantEntry {
+				t.Errorf("entry = %s, want %s", e.Entry, wantEntry)
+			}
+		})
+	}
+
+	// The gitignore verdict names the rule and where it comes from.
+	e, _ := Explain(filepath.Join(root, "src/app.log"), []string{root}, WalkOptions{})
+	want := filepath.Join(root, "src/app.log") + `: excluded by gitignore: rule "*.log" at ` + filepath.Join(root, ".gitignore") + ":2"
+	if e.String() != want {
+		t.Errorf("String() = %s\nwant %s", e, want)
+	}
+
+	if _, err := Explain("/elsewhere/file", []string{root}, WalkOptions{}); err == nil {
+		t.Error("path outside the roots was explained")
+	}
+}
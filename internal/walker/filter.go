@@ -2,7 +2,10 @@ package walker
 
 import (
 	"bytes"
+	"fmt"
+	"path/filepath"
 	"strings"
+	"sync"
 )
 
 // IsBinary checks if data appears to be binary by scanning for NUL bytes
@@ -15,39 +18,164 @@ func IsBinary(data []byte) bool {
 	return bytes.IndexByte(data[:limit], 0) >= 0
 }
 
+// BinaryOverride is a per-path decision that replaces binary detection.
+type BinaryOverride int
+
+const (
+	BinaryAuto  BinaryOverride = iota // use the extension table and the NUL heuristic
+	ForceText                         // always text: never skipped as binary
+	ForceBinary                       // always binary, even without a NUL byte
+)
+
+// BinaryPolicy forces files matching TextGlobs to be treated as text and
+// files matching BinaryGlobs as binary, overriding both the extension table
+// and IsBinary. Globs match the base name or, if they contain a '/', the
+// path or any tail of it starting after a '/' (so "vendor/*.js" matches
+// "./x/vendor/a.js"). A path matching both kinds is text.
+type BinaryPolicy struct {
+	TextGlobs   []string
+	BinaryGlobs []string
+
+	once         sync.Once // compiles the globs on first use
+	text, binary []glob
+}
+
+// Resolve returns the override for path.
+func (p *BinaryPolicy) Resolve(path string) BinaryOverride {
+	o, _ := p.resolve(path)
+	return o
+}
+
+// resolve is Resolve that also returns the deciding glob.
+func (p *BinaryPolicy) resolve(path string) (BinaryOverride, string) {
+	if p == nil || len(p.TextGlobs)+len(p.BinaryGlobs) == 0 {
+		return BinaryAuto, ""
+	}
+	p.once.Do(func() {
+		p.text = compileGlobs(p.TextGlobs)
+		p.binary = compileGlobs(p.BinaryGlobs)
+	})
+	name := filepath.Base(path)
+	if g := matchAnyGlob(p.text, path, name); g != "" {
+		return ForceText, g
+	}
+	if g := matchAnyGlob(p.binary, path, name); g != "" {
+		return ForceBinary, g
+	}
+	return BinaryAuto, ""
+}
+
+// IsBinary is the package-level IsBinary with the overrides for path
+// applied.
+func (p *BinaryPolicy) IsBinary(path string, data []byte) bool {
+	switch p.Resolve(path) {
+	case ForceText:
+		return false
+	case ForceBinary:
+		return true
+	}
+	return IsBinary(data)
+}
+
+// matchAnyGlob returns the first of globs matching name (or path, for a
+// glob with a '/'), or "".
+func matchAnyGlob(globs []glob, path, name string) string {
+	for i := range globs {
+		g := &globs[i]
+		if !strings.ContainsRune(g.text, '/') {
+			if g.match(name, false) {
+				return g.text
+			}
+			continue
+		}
+		for tail := path; ; {
+			if g.match(tail, false) {
+				return g.text
+			}
+			i := strings.IndexByte(tail, '/')
+			if i < 0 {
+				break
+			}
+			tail = tail[i+1:]
+		}
+	}
+	return ""
+}
+
 // IsBinaryExtension returns true if the filename has an extension known to be
 // a binary format. Skipping these avoids opening + reading files that would be
 // discarded by IsBinary anyway, saving syscalls on trees like /usr/lib.
-// Also handles versioned shared libs like "libfoo.so.1.2.3".
+// Extensions match case-insensitively, so "IMG.PNG" is binary too. Also
+// handles versioned shared libs like "libfoo.so.1.2.3".
 func IsBinaryExtension(name string) bool {
 	dot := strings.LastIndexByte(name, '.')
 	if dot < 0 {
 		return false
 	}
-	ext := name[dot:]
-	// Two-stage check: single character for .a/.o/.z, then map for the rest.
-	if len(ext) == 2 {
-		switch ext[1] {
-		case 'a', 'o', 'z':
-			return true
-		}
-	}
-	_, ok := binaryExts[ext]
+	// ToLower returns its argument when there is nothing to lower.
+	_, ok := binaryExts[strings.ToLower(name[dot:])]
 	if ok {
 		return true
 	}
 	// Handle versioned shared libraries: libfoo.so.1, libfoo.so.1.2.3
-	if strings.Contains(name, ".so.") {
+	if _, so := binaryExts[".so"]; so && strings.Contains(name, ".so.") {
 		return true
 	}
 	return false
 }
 
-// binaryExts is the set of file extensions known to be binary.
-// Covers: compiled objects, shared libs, archives, images, audio, video,
-// fonts, executables, compressed, databases, and other common binary formats.
-var binaryExts = map[string]struct{}{
+// SetBinaryExtensions rebuilds the extension table IsBinaryExtension
+// consults: the built-in extensions, plus add, minus remove. Extensions
+// are given with or without their dot, in any case; one that removes an
+// extension not in the table is not an error. Call it before walking, as
+// the table is read without a lock.
+func SetBinaryExtensions(add, remove []string) error {
+	exts := make(map[string]struct{}, len(defaultBinaryExts)+len(add))
+	for ext := range defaultBinaryExts {
+		exts[ext] = struct{}{}
+	}
+	for _, set := range []struct {
+		exts []string
+		add  bool
+	}{{add, true}, {remove, false}} {
+		for _, ext := range set.exts {
+			key, err := binaryExtKey(ext)
+			if err != nil {
+				return err
+			}
+			if set.add {
+				exts[key] = struct{}{}
+			} else {
+				delete(exts, key)
+			}
+		}
+	}
+	binaryExts = exts
+	return nil
+}
+
+// binaryExtKey returns ext as a key of the extension table: lower case,
+// with its leading dot.
+func binaryExtKey(ext string) (string, error) {
+	name := strings.TrimPrefix(ext, ".")
+	if name == "" || strings.ContainsAny(name, "./") {
+		return "", fmt.Errorf("invalid binary extension %q: want a single extension such as .foo", ext)
+	}
+	return "." + strings.ToLower(name), nil
+}
+
+// binaryExts is the extension table in use: defaultBinaryExts, unless
+// SetBinaryExtensions changed it.
+var binaryExts = defaultBinaryExts
+
+// defaultBinaryExts is the set of file extensions known to be binary, in
+// lower case. Covers: compiled objects, shared libs, archives, images, audio,
+// video, fonts, executables, compressed, databases, and other common binary
+// formats.
+var defaultBinaryExts = map[string]struct{}{
 	// Compiled / linked
+	".a":     {},
+	".o":     {},
 	".so":    {},
 	".dylib": {},
 	".dll":   {},
@@ -59,6 +187,7 @@ var binaryExts = map[string]struct{}{
 	".pyo":   {},
 	".wasm":  {},
 	// Archives / compressed
+	".z":   {},
 	".gz":  {},
 	".bz2": {},
 	".xz":  {},
@@ -120,5 +249,5 @@ var binaryExts = map[string]struct{}{
 	// Misc binary
 	".swp": {},
 	".swo": {},
-	".DS_Store": {},
+	".ds_store": {},
 }
@@ -27,3 +27,66 @@ func TestIsBinary(t *testing.T) {
 		})
 	}
 }
+
+func TestBinaryPolicy(t *testing.T) {
+	p := &BinaryPolicy{
+		TextGlobs:   []string{"*.pdfextracted", "docs/*.bin"},
+		BinaryGlobs: []string{"*.dat", "*.bin"},
+	}
+	text, nul := []byte("plain\n"), []byte("a\x00b")
+
+	tests := []struct {
+		path string
+		data []byte
+		want bool
+	}{
+		{"a/report.pdfextracted", nul, false}, // text glob beats the NUL heuristic
+		{"a/table.dat", text, true},           // binary glob without a NUL
+		{"docs/x.bin", nul, false},            // path glob; text wins over binary
+		{"/src/docs/x.bin", nul, false},       // path glob matches a tail
+		{"a/x.bin", text, true},               // base-name binary glob
+		{"a/notes.txt", nul, true},            // no glob: heuristic
+		{"a/notes.txt", text, false},
+	}
+	for _, tt := range tests {
+		if got := p.IsBinary(tt.path, tt.data); got != tt.want {
+			t.Errorf("IsBinary(%s) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+
+	var none *BinaryPolicy
+	if none.Resolve("x.dat") != BinaryAuto || !none.IsBinary("x", nul) {
+		t.Error("nil policy must fall back to detection")
+	}
+}
+
+func TestSetBinaryExtensions(t *testing.T) {
+	defer SetBinaryExtensions(nil, nil)
+
+	names := []string{"a.png", "A.PNG", "x.o", "libc.so.6", ".DS_Store", "logo.svg", "blob.FOO", "main.go"}
+	check := func(want ...bool) {
+		t.Helper()
+		for i, name := range names {
+			if got := IsBinaryExtension(name); got != want[i] {
+				t.Errorf("IsBinaryExtension(%q) = %v, want %v", name, got, want[i])
+			}
+		}
+	}
+	check(true, true, true, true, true, true, false, false)
+
+	if err := SetBinaryExtensions([]string{".foo"}, []string{"SVG", ".so", ".png"}); err != nil {
+		t.Fatal(err)
+	}
+	check(false, false, true, false, true, false, true, false)
+
+	if err := SetBinaryExtensions(nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	check(true, true, true, true, true, true, false, false)
+
+	for _, bad := range []string{"", ".", ".tar.gz", "a/b"} {
+		if err := SetBinaryExtensions([]string{bad}, nil); err == nil {
+			t.Errorf("SetBinaryExtensions(%q): no error", bad)
+		}
+	}
+}
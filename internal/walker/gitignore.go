@@ -1,7 +1,9 @@
 package walker
 
 import (
+	"os"
 	"path/filepath"
+	"strings"
 
 	ignore "github.com/sabhiram/go-gitignore"
 )
@@ -14,7 +16,37 @@ type ignoreStack struct {
 
 type ignoreLayer struct {
 	dir    string
+	prefix string // dir with a trailing slash, as joinPath builds descendants
 	parser *ignore.GitIgnore
+	fold   bool // rules were lowercased; lowercase paths before matching
+}
+
+func newIgnoreLayer(dir string, parser *ignore.GitIgnore, fold bool) ignoreLayer {
+	prefix := dir
+	if len(dir) == 0 || dir[len(dir)-1] != '/' {
+		prefix += "/"
+	}
+	return ignoreLayer{dir: dir, prefix: prefix, parser: parser, fold: fold}
+}
+
+// relPath returns path relative to the layer's directory, the form its
+// rules match against. Walked paths are built by joinPath under the
+// layer's directory, so the relative path is a suffix of them and costs
+// no allocation; anything else goes through filepath.Rel. A directory path
+// carries its trailing slash through.
+func (l *ignoreLayer) relPath(path string, isDir bool) (string, bool) {
+	rel, ok := strings.CutPrefix(path, l.prefix)
+	if !ok {
+		var err error
+		rel, err = filepath.Rel(l.dir, strings.TrimSuffix(path, "/"))
+		if err != nil {
+			return "", false
+		}
+		if isDir {
+			rel += "/"
+		}
+	}
+	return foldName(rel, l.fold), true
 }
 
 func newIgnoreStack() *ignoreStack {
@@ -27,10 +59,10 @@ func (s *ignoreStack) push(dir string) {
 	parser, err := ignore.CompileIgnoreFile(gitignorePath)
 	if err != nil {
 		// No .gitignore or parse error — push nil layer to maintain stack depth
-		s.layers = append(s.layers, ignoreLayer{dir: dir, parser: nil})
+		s.layers = append(s.layers, newIgnoreLayer(dir, nil, false))
 		return
 	}
-	s.layers = append(s.layers, ignoreLayer{dir: dir, parser: parser})
+	s.layers = append(s.layers, newIgnoreLayer(dir, parser, false))
 }
 
 // pop removes the top layer.
@@ -45,50 +77,125 @@ func (s *ignoreStack) isIgnored(fullPath string, isDir bool) bool {
 	return isIgnoredByLayers(s.layers, fullPath, isDir)
 }
 
-// cloneLayers returns a copy of the current layers slice.
-// The underlying *GitIgnore parsers are immutable and shared safely across goroutines.
-func (s *ignoreStack) cloneLayers() []ignoreLayer {
-	if s == nil || len(s.layers) == 0 {
+// loadIgnoreLayer loads and compiles a .gitignore from the given directory.
+// Returns a layer with nil parser if no .gitignore exists or on parse error.
+// If fold is true the rules are compiled lowercased, for case-insensitive
+// filesystems (git's core.ignorecase).
+func loadIgnoreLayer(dir string, fold bool) ignoreLayer {
+	var c *ruleCache
+	return c.load(dir, fold)
+}
+
+// maxCachedRules bounds a ruleCache. Past it, files are compiled uncached.
+const maxCachedRules = 1024
+
+// ruleCache memoizes compiled .gitignore files by content. Compiling builds
+// several regexps per rule, and trees with many .gitignore files (vendored
+// dependencies, monorepo packages) repeat the same few files over and
+// over. Each walker worker owns one, so lookups take no lock; the compiled
+// rules are immutable and shared by every layer that uses them. A nil
+// cache compiles every file.
+type ruleCache struct {
+	parsers map[string]*ignore.GitIgnore
+}
+
+func newRuleCache() *ruleCache {
+	return &ruleCache{parsers: make(map[string]*ignore.GitIgnore)}
+}
+
+// load is loadIgnoreLayer through the cache.
+func (c *ruleCache) load(dir string, fold bool) ignoreLayer {
+	layer := newIgnoreLayer(dir, nil, fold)
+	data, err := os.ReadFile(layer.prefix + ".gitignore")
+	if err != nil {
+		return layer
+	}
+	content := foldName(string(data), fold)
+	if c != nil {
+		if p, ok := c.parsers[content]; ok {
+			layer.parser = p
+			return layer
+		}
+	}
+	layer.parser = ignore.CompileIgnoreLines(strings.Split(content, "\n")...)
+	if c != nil && len(c.parsers) < maxCachedRules {
+		c.parsers[content] = layer.parser
+	}
+	return layer
+}
+
+// rootIgnores returns the ignore layers for a walk root: nil with
+// --no-ignore, otherwise a non-nil slice, empty if root has no .gitignore.
+func rootIgnores(root string, fold, noIgnore bool) []ignoreLayer {
+	if noIgnore {
 		return nil
 	}
-	c := make([]ignoreLayer, len(s.layers))
-	copy(c, s.layers)
-	return c
+	return withIgnoreLayer([]ignoreLayer{}, root, fold, nil)
 }
 
-// loadIgnoreLayer loads and compiles a .gitignore from the given directory.
-// Returns a layer with nil parser if no .gitignore exists or on parse error.
-func loadIgnoreLayer(dir string) ignoreLayer {
-	var path string
-	if len(dir) > 0 && dir[len(dir)-1] == '/' {
-		path = dir + ".gitignore"
-	} else {
-		path = dir + "/.gitignore"
+// withIgnoreLayer returns layers extended by dir's .gitignore. Only
+// directories that have one add a layer, so matching visits no empty
+// layers and a directory without one shares its parent's slice. Sibling
+// items share that slice too, so it is copied, never appended to in place.
+func withIgnoreLayer(layers []ignoreLayer, dir string, fold bool, c *ruleCache) []ignoreLayer {
+	l := c.load(dir, fold)
+	if l.parser == nil {
+		return layers
 	}
-	parser, err := ignore.CompileIgnoreFile(path)
-	if err != nil {
-		return ignoreLayer{dir: dir, parser: nil}
+	return append(layers[:len(layers):len(layers)], l)
+}
+
+// dirPath appends the trailing slash that marks a directory for matching.
+func dirPath(fullPath string, isDir bool) string {
+	if isDir {
+		return fullPath + "/"
 	}
-	return ignoreLayer{dir: dir, parser: parser}
+	return fullPath
 }
 
 // isIgnoredByLayers checks if a path should be ignored by any layer in the slice.
 func isIgnoredByLayers(layers []ignoreLayer, fullPath string, isDir bool) bool {
-	for _, layer := range layers {
+	if len(layers) == 0 {
+		return false
+	}
+	path := dirPath(fullPath, isDir)
+	for i := range layers {
+		layer := &layers[i]
 		if layer.parser == nil {
 			continue
 		}
-		rel, err := filepath.Rel(layer.dir, fullPath)
-		if err != nil {
+		checkPath, ok := layer.relPath(path, isDir)
+		if !ok {
 			continue
 		}
-		checkPath := rel
-		if isDir {
-			checkPath = rel + "/"
-		}
 		if layer.parser.MatchesPath(checkPath) {
 			return true
 		}
 	}
 	return false
 }
+
+// ignoreRule is isIgnoredByLayers for Explain: it also returns the layer
+// and the rule that decided. If no layer ignores the path but a rule
+// matched and a later "!" rule re-included it, that rule is returned with
+// ignored false.
+func ignoreRule(layers []ignoreLayer, fullPath string, isDir bool) (layer ignoreLayer, rule *ignore.IgnorePattern, ignored bool) {
+	path := dirPath(fullPath, isDir)
+	for _, l := range layers {
+		if l.parser == nil {
+			continue
+		}
+		checkPath, ok := l.relPath(path, isDir)
+		if !ok {
+			continue
+		}
+		matched, ip := l.parser.MatchesPathHow(checkPath)
+		if matched {
+			return l, ip, true
+		}
+		if ip != nil {
+			layer, rule = l, ip
+		}
+	}
+	return layer, rule, false
+}
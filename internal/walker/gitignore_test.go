@@ -1,8 +1,10 @@
 package walker
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -84,3 +86,149 @@ func TestIgnoreStack_NoGitignore(t *testing.T) {
 
 	s.pop()
 }
+
+func TestLoadIgnoreLayer_Fold(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, ".gitignore"), []byte("*.Log\nBuild/\n"), 0644)
+
+	tests := []struct {
+		path  string
+		isDir bool
+		fold  bool
+		want  bool
+	}{
+		{"app.Log", false, false, true},
+		{"APP.LOG", false, false, false},
+		{"APP.LOG", false, true, true},
+		{"build", true, false, false},
+		{"build", true, true, true},
+		{"BUILD", true, true, true},
+	}
+	for _, tt := range tests {
+		layers := []ignoreLayer{loadIgnoreLayer(dir, tt.fold)}
+		got := isIgnoredByLayers(layers, filepath.Join(dir, tt.path), tt.isDir)
+		if got != tt.want {
+			t.Errorf("fold=%v isIgnored(%q) = %v, want %v", tt.fold, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestIsGlobExcluded_Fold(t *testing.T) {
+	f := &walkFilter{globs: newFilterGlobs([]string{"*.go", "!*_TEST.go"})}
+	tests := []struct {
+		name string
+		fold bool
+		want bool
+	}{
+		{"main.go", false, false},
+		{"MAIN.GO", false, true},
+		{"MAIN.GO", true, false},
+		{"x_test.go", false, false},
+		{"x_test.go", true, true},
+	}
+	for _, tt := range tests {
+		if got := f.isGlobExcluded(tt.name, tt.fold); got != tt.want {
+			t.Errorf("fold=%v isGlobExcluded(%q) = %v, want %v", tt.fold, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWithIgnoreLayer(t *testing.T) {
+	root := t.TempDir()
+	for _, d := range []string{"a", "b", "c"} {
+		os.Mkdir(filepath.Join(root, d), 0o755)
+	}
+	os.WriteFile(filepath.Join(root, "a", ".gitignore"), []byte("*.o\n"), 0o644)
+	os.WriteFile(filepath.Join(root, "b", ".gitignore"), []byte("*.o\n"), 0o644)
+
+	rules := newRuleCache()
+	parent := rootIgnores(root, false, false)
+	if parent == nil || len(parent) != 0 {
+		t.Fatalf("rootIgnores without .gitignore = %v, want empty non-nil", parent)
+	}
+	a := withIgnoreLayer(parent, filepath.Join(root, "a"), false, rules)
+	b := withIgnoreLayer(parent, filepath.Join(root, "b"), false, rules)
+	c := withIgnoreLayer(parent, filepath.Join(root, "c"), false, rules)
+	if len(a) != 1 || len(b) != 1 || len(c) != 0 {
+		t.Fatalf("layer counts = %d, %d, %d; want 1, 1, 0", len(a), len(b), len(c))
+	}
+	if a[0].dir == b[0].dir {
+		t.Error("sibling items share one layer slot")
+	}
+	if a[0].parser != b[0].parser {
+		t.Error("identical .gitignore files were compiled twice")
+	}
+	if !isIgnoredByLayers(b, filepath.Join(root, "b", "x.o"), false) {
+		t.Error("b/x.o not ignored")
+	}
+	if isIgnoredByLayers(b, filepath.Join(root, "b", "x.go"), false) {
+		t.Error("b/x.go ignored")
+	}
+}
+
+// manyIgnoresTree builds a tree where every directory has a .gitignore,
+// most of them identical, like a checkout with many vendored packages.
+// It returns the root and a path to a file at the deepest level.
+func manyIgnoresTree(tb testing.TB) (string, string) {
+	tb.Helper()
+	root := tb.TempDir()
+	rules := []byte("*.o\n*.tmp\nbuild/\n/dist\nnode_modules/\ncoverage/\n*.log\n!keep.log\ndocs/**/*.pdf\n.cache\n")
+	var deepest string
+	var mk func(dir string, depth int)
+	mk = func(dir string, depth int) {
+		if err := os.WriteFile(filepath.Join(dir, ".gitignore"), rules, 0o644); err != nil {
+			tb.Fatal(err)
+		}
+		for i := range 8 {
+			deepest = filepath.Join(dir, fmt.Sprintf("f%d.go", i))
+			if err := os.WriteFile(deepest, nil, 0o644); err != nil {
+				tb.Fatal(err)
+			}
+			os.WriteFile(filepath.Join(dir, fmt.Sprintf("f%d.o", i)), nil, 0o644)
+		}
+		if depth == 0 {
+			return
+		}
+		for i := range 4 {
+			sub := filepath.Join(dir, fmt.Sprintf("d%d", i))
+			if err := os.Mkdir(sub, 0o755); err != nil {
+				tb.Fatal(err)
+			}
+			mk(sub, depth-1)
+		}
+	}
+	mk(root, 4)
+	return root, deepest
+}
+
+func BenchmarkIsIgnoredByLayers(b *testing.B) {
+	root, deepest := manyIgnoresTree(b)
+	var layers []ignoreLayer
+	for dir := root; ; {
+		layers = append(layers, loadIgnoreLayer(dir, false))
+		if dir == filepath.Dir(deepest) {
+			break
+		}
+		rel, _ := filepath.Rel(dir, deepest)
+		dir = filepath.Join(dir, strings.SplitN(rel, "/", 2)[0])
+	}
+	b.ReportAllocs()
+	for b.Loop() {
+		isIgnoredByLayers(layers, deepest, false)
+		isIgnoredByLayers(layers, filepath.Dir(deepest), true)
+	}
+}
+
+func BenchmarkWalk_ManyGitignores(b *testing.B) {
+	root, _ := manyIgnoresTree(b)
+	b.ReportAllocs()
+	for b.Loop() {
+		files, errs := Walk([]string{root}, WalkOptions{Recursive: true})
+		go func() {
+			for range errs {
+			}
+		}()
+		for range files {
+		}
+	}
+}
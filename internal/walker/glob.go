@@ -0,0 +1,392 @@
+package walker
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Glob syntax, shared by --glob, --hidden-glob, --text-glob and
+// --binary-glob:
+//
+//	*        any run of characters other than '/'
+//	?        one character other than '/'
+//	**       as a whole path segment, any number of segments
+//	[a-z0-9] one character from the class; [!...] or [^...] negates it,
+//	         a ']' first in the class is literal, [:alpha:] and the other
+//	         POSIX names are allowed inside; classes never match '/'
+//	{a,b}    either alternative; braces nest and alternatives may hold
+//	         any of the above
+//	\c       the character c literally, also inside classes
+//
+// A '{' without a matching '}', and a '}' or ',' outside braces, are
+// literal.
+
+// glob is a pattern compiled once and matched against many names. Common
+// shapes (a literal name, "*" plus a literal suffix) skip the regexp.
+type glob struct {
+	text   string // the pattern as given
+	exact  globProg
+	folded globProg // the pattern lowercased, for lowercased names
+}
+
+type globKind int
+
+const (
+	globNever   globKind = iota // malformed pattern: matches nothing
+	globLiteral                 // name == lit
+	globSuffix                  // "*" + lit
+	globRegexp
+)
+
+type globProg struct {
+	kind globKind
+	lit  string
+	re   *regexp.Regexp
+}
+
+// compileGlob compiles pattern. A malformed pattern yields a glob that
+// matches nothing; ValidateGlob reports why.
+func compileGlob(pattern string) glob {
+	return glob{
+		text:   pattern,
+		exact:  compileGlobProg(pattern),
+		folded: compileGlobProg(strings.ToLower(pattern)),
+	}
+}
+
+func compileGlobs(patterns []string) []glob {
+	if len(patterns) == 0 {
+		return nil
+	}
+	gs := make([]glob, len(patterns))
+	for i, p := range patterns {
+		gs[i] = compileGlob(p)
+	}
+	return gs
+}
+
+// ValidateGlob reports whether pattern is a well-formed glob.
+func ValidateGlob(pattern string) error {
+	_, err := parseGlob(pattern)
+	return err
+}
+
+// match reports whether name matches. With fold set, name must already be
+// lowercased (foldName) and is matched against the lowercased pattern.
+func (g *glob) match(name string, fold bool) bool {
+	if fold {
+		return g.folded.match(name)
+	}
+	return g.exact.match(name)
+}
+
+func (p *globProg) match(name string) bool {
+	switch p.kind {
+	case globLiteral:
+		return name == p.lit
+	case globSuffix:
+		return strings.HasSuffix(name, p.lit) && strings.IndexByte(name[:len(name)-len(p.lit)], '/') < 0
+	case globRegexp:
+		return p.re.MatchString(name)
+	}
+	return false
+}
+
+func compileGlobProg(pattern string) globProg {
+	toks, err := parseGlob(pattern)
+	if err != nil {
+		return globProg{kind: globNever}
+	}
+	if lit, ok := literalToks(toks); ok {
+		return globProg{kind: globLiteral, lit: lit}
+	}
+	if len(toks) > 0 && toks[0].kind == tokStar {
+		if lit, ok := literalToks(toks[1:]); ok {
+			return globProg{kind: globSuffix, lit: lit}
+		}
+	}
+	re, err := regexp.Compile(globRegexpSource(toks))
+	if err != nil {
+		return globProg{kind: globNever}
+	}
+	return globProg{kind: globRegexp, re: re}
+}
+
+type globTokKind int
+
+const (
+	tokLit      globTokKind = iota // r literally
+	tokStar                        // *
+	tokAny                         // ?
+	tokGlobstar                    // ** as a whole segment
+	tokClass                       // [...]; src is the regexp class
+	tokOpen                        // { with a matching }
+	tokComma                       // , directly inside braces
+	tokClose                       // } matching a {
+)
+
+type globTok struct {
+	kind globTokKind
+	r    rune
+	src  string
+}
+
+var (
+	errGlobTrailingEscape = errors.New("trailing backslash")
+	errGlobClass          = errors.New("unterminated character class")
+)
+
+// parseGlob splits pattern into tokens and pairs up its braces.
+func parseGlob(pattern string) ([]globTok, error) {
+	if !utf8.ValidString(pattern) {
+		return nil, errors.New("invalid UTF-8")
+	}
+	var toks []globTok
+	for i := 0; i < len(pattern); {
+		r, n := utf8.DecodeRuneInString(pattern[i:])
+		switch r {
+		case '\\':
+			if i+1 >= len(pattern) {
+				return nil, errGlobTrailingEscape
+			}
+			r, n = utf8.DecodeRuneInString(pattern[i+1:])
+			toks = append(toks, globTok{kind: tokLit, r: r})
+			i += 1 + n
+			continue
+		case '*':
+			if strings.HasPrefix(pattern[i:], "**") && segmentStart(pattern, i) && segmentEnd(pattern, i+2) {
+				toks = append(toks, globTok{kind: tokGlobstar})
+				i += 2
+				continue
+			}
+			toks = append(toks, globTok{kind: tokStar})
+		case '?':
+			toks = append(toks, globTok{kind: tokAny})
+		case '[':
+			src, end, err := parseClass(pattern, i+1)
+			if err != nil {
+				return nil, err
+			}
+			toks = append(toks, globTok{kind: tokClass, src: src})
+			i = end
+			continue
+		case '{':
+			toks = append(toks, globTok{kind: tokOpen, r: r})
+		case ',':
+			toks = append(toks, globTok{kind: tokComma, r: r})
+		case '}':
+			toks = append(toks, globTok{kind: tokClose, r: r})
+		default:
+			toks = append(toks, globTok{kind: tokLit, r: r})
+		}
+		i += n
+	}
+	pairBraces(toks)
+	return toks, nil
+}
+
+// segmentStart and segmentEnd report whether a "**" at i (ending at end)
+// fills a whole path segment, also counting brace delimiters as edges so
+// that "{**/a,b}" works.
+func segmentStart(pattern string, i int) bool {
+	return i == 0 || strings.IndexByte("/{,", pattern[i-1]) >= 0
+}
+
+func segmentEnd(pattern string, end int) bool {
+	return end == len(pattern) || strings.IndexByte("/},", pattern[end]) >= 0
+}
+
+// pairBraces turns unpaired '{' and '}', and ',' outside paired braces,
+// into literals.
+func pairBraces(toks []globTok) {
+	var open []int
+	for i := range toks {
+		switch toks[i].kind {
+		case tokOpen:
+			open = append(open, i)
+		case tokClose:
+			if len(open) == 0 {
+				toks[i].kind = tokLit
+				continue
+			}
+			open = open[:len(open)-1]
+		}
+	}
+	for _, o := range open {
+		toks[o].kind = tokLit
+	}
+	depth := 0
+	for i := range toks {
+		switch toks[i].kind {
+		case tokOpen:
+			depth++
+		case tokClose:
+			depth--
+		case tokComma:
+			if depth == 0 {
+				toks[i].kind = tokLit
+			}
+		}
+	}
+}
+
+// posixClasses are the [:name:] classes allowed inside brackets, as rune
+// ranges (ASCII only, like the C locale).
+var posixClasses = map[string][][2]rune{
+	"alnum":  {{'0', '9'}, {'A', 'Z'}, {'a', 'z'}},
+	"alpha":  {{'A', 'Z'}, {'a', 'z'}},
+	"blank":  {{'\t', '\t'}, {' ', ' '}},
+	"cntrl":  {{0, 0x1f}, {0x7f, 0x7f}},
+	"digit":  {{'0', '9'}},
+	"graph":  {{'!', '~'}},
+	"lower":  {{'a', 'z'}},
+	"print":  {{' ', '~'}},
+	"punct":  {{'!', '/'}, {':', '@'}, {'[', '`'}, {'{', '~'}},
+	"space":  {{'\t', '\r'}, {' ', ' '}},
+	"upper":  {{'A', 'Z'}},
+	"xdigit": {{'0', '9'}, {'A', 'F'}, {'a', 'f'}},
+}
+
+// parseClass parses a bracket expression whose body starts at i. It
+// returns the equivalent regexp class, which never matches '/', and the
+// index just past the closing ']'.
+func parseClass(pattern string, i int) (string, int, error) {
+	negate := false
+	if i < len(pattern) && (pattern[i] == '!' || pattern[i] == '^') {
+		negate = true
+		i++
+	}
+	var items strings.Builder
+	first := true
+	for {
+		if i >= len(pattern) {
+			return "", 0, errGlobClass
+		}
+		if pattern[i] == ']' && !first {
+			i++
+			break
+		}
+		first = false
+		if strings.HasPrefix(pattern[i:], "[:") {
+			end := strings.Index(pattern[i+2:], ":]")
+			if end < 0 {
+				return "", 0, errGlobClass
+			}
+			name := pattern[i+2 : i+2+end]
+			ranges, ok := posixClasses[name]
+			if !ok {
+				return "", 0, fmt.Errorf("unknown character class [:%s:]", name)
+			}
+			for _, r := range ranges {
+				writeClassRange(&items, r[0], r[1])
+			}
+			i += 2 + end + 2
+			continue
+		}
+		lo, n, err := classChar(pattern, i)
+		if err != nil {
+			return "", 0, err
+		}
+		i += n
+		hi := lo
+		if i+1 < len(pattern) && pattern[i] == '-' && pattern[i+1] != ']' {
+			hi, n, err = classChar(pattern, i+1)
+			if err != nil {
+				return "", 0, err
+			}
+			i += 1 + n
+		}
+		if lo > hi {
+			continue // an empty range matches nothing
+		}
+		writeClassRange(&items, lo, hi)
+	}
+
+	if negate {
+		return `[^/` + items.String() + `]`, i, nil
+	}
+	if items.Len() == 0 {
+		return `[^\x00-\x{10FFFF}]`, i, nil
+	}
+	return `[` + items.String() + `]`, i, nil
+}
+
+// classChar decodes one possibly escaped character of a bracket expression.
+func classChar(pattern string, i int) (rune, int, error) {
+	if pattern[i] == '\\' {
+		if i+1 >= len(pattern) {
+			return 0, 0, errGlobTrailingEscape
+		}
+		r, n := utf8.DecodeRuneInString(pattern[i+1:])
+		return r, 1 + n, nil
+	}
+	r, n := utf8.DecodeRuneInString(pattern[i:])
+	return r, n, nil
+}
+
+// writeClassRange writes lo-hi as regexp class items, leaving out '/'.
+func writeClassRange(b *strings.Builder, lo, hi rune) {
+	if lo <= '/' && '/' <= hi {
+		if lo < '/' {
+			writeClassRange(b, lo, '/'-1)
+		}
+		if hi > '/' {
+			writeClassRange(b, '/'+1, hi)
+		}
+		return
+	}
+	fmt.Fprintf(b, `\x{%x}`, lo)
+	if hi != lo {
+		fmt.Fprintf(b, `-\x{%x}`, hi)
+	}
+}
+
+// literalToks returns the text of toks if they are all literals.
+func literalToks(toks []globTok) (string, bool) {
+	var b strings.Builder
+	for _, t := range toks {
+		if t.kind != tokLit {
+			return "", false
+		}
+		b.WriteRune(t.r)
+	}
+	return b.String(), true
+}
+
+// globRegexpSource translates tokens into an anchored regexp.
+func globRegexpSource(toks []globTok) string {
+	var b strings.Builder
+	b.WriteString(`(?s)^`)
+	for i := 0; i < len(toks); i++ {
+		t := toks[i]
+		switch t.kind {
+		case tokLit:
+			b.WriteString(regexp.QuoteMeta(string(t.r)))
+		case tokStar:
+			b.WriteString(`[^/]*`)
+		case tokAny:
+			b.WriteString(`[^/]`)
+		case tokGlobstar:
+			// "**/" may match no segment at all, so "a/**/b" matches "a/b".
+			if i+1 < len(toks) && toks[i+1].kind == tokLit && toks[i+1].r == '/' {
+				b.WriteString(`(?:.*/)?`)
+				i++
+			} else {
+				b.WriteString(`.*`)
+			}
+		case tokClass:
+			b.WriteString(t.src)
+		case tokOpen:
+			b.WriteString(`(?:`)
+		case tokComma:
+			b.WriteString(`|`)
+		case tokClose:
+			b.WriteString(`)`)
+		}
+	}
+	b.WriteString(`$`)
+	return b.String()
+}
@@ -0,0 +1,162 @@
+package walker
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "main.goo", false},
+		{"*.go", "a/main.go", false},
+		{"main.go", "main.go", true},
+		{"ma?n.go", "main.go", true},
+		{"ma?n.go", "ma/n.go", false},
+
+		{"[a-c]x", "bx", true},
+		{"[a-c]x", "dx", false},
+		{"[!a-c]x", "dx", true},
+		{"[^a-c]x", "ax", false},
+		{"[]]x", "]x", true},
+		{"[!]]x", "]x", false},
+		{`[\]a]x`, "]x", true},
+		{"[[:digit:]]*", "7z", true},
+		{"[[:digit:]]*", "z7", false},
+		{"[[:upper:][:digit:]]", "Q", true},
+		{"[z-a]", "z", false},
+		{"a[/]b", "a/b", false},
+		{"a[!x]b", "a/b", false},
+
+		{`\*.go`, "*.go", true},
+		{`\*.go`, "x.go", false},
+		{`\{a,b\}`, "{a,b}", true},
+		{`{a\,b,c}`, "a,b", true},
+		{`{a\,b,c}`, "b", false},
+
+		{"*.{go,rs}", "x.rs", true},
+		{"*.{go,rs}", "x.c", false},
+		{"{a,b{c,d}}x", "bdx", true},
+		{"{a,b{c,d}}x", "bx", false},
+		{"{*.min,vendor}.js", "app.min.js", true},
+		{"{,x}y", "y", true},
+		{"{a,[0-9]}", "5", true},
+		{"{a", "{a", true},
+		{"a}", "a}", true},
+		{"a,b", "a,b", true},
+		{"{a,{b}", "{a,b", true},
+
+		{"**/vendor/*.js", "vendor/a.js", true},
+		{"**/vendor/*.js", "x/y/vendor/a.js", true},
+		{"docs/**", "docs/a/b.md", true},
+		{"a/**/b", "a/b", true},
+		{"a/**/b", "a/x/y/b", true},
+		{"a/**/b", "a/xb", false},
+		{"a**b", "axyb", true},
+		{"a**b", "ax/yb", false},
+		{"{**/a,b}", "x/a", true},
+
+		{"a\\", "a\\", false},
+		{"[abc", "a", false},
+		{"[[:nope:]]", "a", false},
+	}
+	for _, tt := range tests {
+		g := compileGlob(tt.pattern)
+		if got := g.match(tt.name, false); got != tt.want {
+			t.Errorf("%q matching %q = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGlob_Fold(t *testing.T) {
+	g := compileGlob("*.[J]S")
+	if g.match("app.js", false) {
+		t.Error("exact match ignored case")
+	}
+	if !g.match(foldName("App.JS", true), true) {
+		t.Error("folded match failed")
+	}
+}
+
+func TestValidateGlob(t *testing.T) {
+	for _, p := range []string{"*.go", "{a,b", "[]]", `\{`, "**/x"} {
+		if err := ValidateGlob(p); err != nil {
+			t.Errorf("ValidateGlob(%q) = %v", p, err)
+		}
+	}
+	for _, p := range []string{"a\\", "[abc", "[[:nope:]]", "[a-\\"} {
+		if err := ValidateGlob(p); err == nil {
+			t.Errorf("ValidateGlob(%q) = nil, want error", p)
+		}
+	}
+}
+
+// FuzzGlob checks that compiling never panics and that, on the syntax it
+// shares with filepath.Match, a glob agrees with it.
+func FuzzGlob(f *testing.F) {
+	for _, seed := range [][2]string{
+		{"*.go", "main.go"}, {"[a-z]?", "b1"}, {`\*x`, "*x"}, {"[^0-9]*", "a9"},
+		{"{a,b{c,d}}", "bd"}, {"**/x", "a/x"}, {"[!]]", "]"}, {"[[:alpha:]]", "q"},
+	} {
+		f.Add(seed[0], seed[1])
+	}
+	f.Fuzz(func(t *testing.T, pattern, name string) {
+		g := compileGlob(pattern)
+		got := g.match(name, false)
+		g.match(foldName(name, true), true)
+
+		if !utf8.ValidString(pattern) || !utf8.ValidString(name) || strings.Contains(name, "/") ||
+			strings.ContainsAny(pattern, "{},") || strings.Contains(pattern, "**") ||
+			strings.Contains(pattern, "[!") || strings.Contains(pattern, "[:") {
+			return
+		}
+		want, err := filepath.Match(pattern, name)
+		if err != nil {
+			return
+		}
+		if got != want {
+			t.Errorf("%q matching %q = %v, filepath.Match says %v", pattern, name, got, want)
+		}
+	})
+}
+
+func TestTypeFilterGlobs(t *testing.T) {
+	for _, name := range TypeNames() {
+		globs, err := TypeFilterGlobs([]string{name}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, g := range globs {
+			if err := ValidateGlob(g); err != nil {
+				t.Errorf("type %s: %q: %v", name, g, err)
+			}
+		}
+	}
+
+	globs, err := TypeFilterGlobs([]string{"go", "md"}, []string{"test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &walkFilter{globs: newFilterGlobs(globs)}
+	for name, want := range map[string]bool{
+		"main.go":      false,
+		"README.md":    false,
+		"main_test.go": true,
+		"app.py":       true,
+		"Makefile":     true,
+	} {
+		if got := f.isGlobExcluded(name, false); got != want {
+			t.Errorf("isGlobExcluded(%q) = %v, want %v", name, got, want)
+		}
+	}
+
+	if _, err := TypeFilterGlobs(nil, []string{"cobol"}); err == nil || !strings.Contains(err.Error(), `"cobol"`) {
+		t.Errorf("unknown type: err = %v", err)
+	}
+}
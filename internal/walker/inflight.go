@@ -0,0 +1,73 @@
+package walker
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// DefaultMaxInFlight is the in-flight file limit used by the CLI.
+const DefaultMaxInFlight = 4096
+
+// maxQueuedDirs bounds the directories waiting in the walk's shared work
+// queue. When it is full, a worker walks the subdirectories it found
+// itself, depth-first, instead of queueing them. A variable for tests.
+var maxQueuedDirs = 4096
+
+// InFlight bounds how far file discovery runs ahead of the search: a walk
+// given one pauses before emitting a file while limit files it emitted are
+// still unfinished, and the consumer calls Done for each file once its
+// result is written. Without it the walker can find files far faster than
+// they are searched, and on trees with tens of millions of files the
+// channels, the reordering buffers and the ordered writer's pending
+// results all grow with the lead.
+type InFlight struct {
+	slots chan struct{}
+
+	count  atomic.Int64
+	peak   atomic.Int64
+	pauses atomic.Int64
+	paused atomic.Int64 // nanoseconds spent paused
+}
+
+// NewInFlight returns a limit of n unfinished files, at least 1.
+func NewInFlight(n int) *InFlight {
+	return &InFlight{slots: make(chan struct{}, max(n, 1))}
+}
+
+// acquire takes a slot for a file about to be emitted, waiting while none
+// is free. It returns false if cancel is closed first.
+func (f *InFlight) acquire(cancel <-chan struct{}) bool {
+	select {
+	case f.slots <- struct{}{}:
+	default:
+		start := time.Now()
+		select {
+		case f.slots <- struct{}{}:
+		case <-cancel:
+			return false
+		}
+		f.pauses.Add(1)
+		f.paused.Add(int64(time.Since(start)))
+	}
+	n := f.count.Add(1)
+	for p := f.peak.Load(); n > p && !f.peak.CompareAndSwap(p, n); p = f.peak.Load() {
+	}
+	return true
+}
+
+// Done releases the slot of a file whose result is written or dropped.
+// A nil InFlight ignores it.
+func (f *InFlight) Done() {
+	if f == nil {
+		return
+	}
+	f.count.Add(-1)
+	<-f.slots
+}
+
+// addStats records the pauses and the peak into s.
+func (f *InFlight) addStats(s *WalkStats) {
+	s.Paused += int(f.pauses.Load())
+	s.PausedFor += time.Duration(f.paused.Load())
+	s.PeakInFlight = max(s.PeakInFlight, int(f.peak.Load()))
+}
@@ -0,0 +1,112 @@
+package walker
+
+import "container/heap"
+
+// Priority selects the order in which walked files are handed to the
+// search.
+type Priority int
+
+const (
+	PriorityWalk     Priority = iota // walk order (default)
+	PrioritySmallest                 // smallest files first
+	PriorityRecent                   // most recently modified first
+)
+
+// DefaultPriorityWindow is the reordering window used by the CLI.
+const DefaultPriorityWindow = 1024
+
+// Prioritize reorders the files from in by p. It holds up to window
+// entries, stat'ing each as it arrives, takes in whatever the walker has
+// ready, and hands the best entry held to the consumer when it asks.
+// Reordering is therefore local: a file is never overtaken by one found
+// more than window entries later, and while the consumer keeps up, files
+// pass straight through. With PriorityWalk, in is returned unchanged.
+func Prioritize(in <-chan FileEntry, p Priority, window int) <-chan FileEntry {
+	if p == PriorityWalk {
+		return in
+	}
+	window = max(window, 1)
+	out := make(chan FileEntry)
+	go func() {
+		defer close(out)
+		h := &rankedHeap{}
+		seq := 0
+		push := func(e FileEntry) {
+			heap.Push(h, rankedEntry{entry: e, key: p.key(e.Path), seq: seq})
+			seq++
+		}
+		for in != nil || h.Len() > 0 {
+			recv := in
+			if h.Len() >= window {
+				recv = nil
+			}
+			// Fill the window from what is ready before choosing.
+			if recv != nil {
+				select {
+				case e, ok := <-recv:
+					if !ok {
+						in = nil
+					} else {
+						push(e)
+					}
+					continue
+				default:
+				}
+			}
+
+			var send chan<- FileEntry
+			var next FileEntry
+			if h.Len() > 0 {
+				send, next = out, (*h)[0].entry
+			}
+			select {
+			case e, ok := <-recv:
+				if !ok {
+					in = nil
+					continue
+				}
+				push(e)
+			case send <- next:
+				heap.Pop(h)
+			}
+		}
+	}()
+	return out
+}
+
+// key ranks path for p; lower keys go first. Files that cannot be stat'ed
+// rank as empty and unmodified since the epoch.
+func (p Priority) key(path string) int64 {
+	size, mtime, err := statSize(path)
+	if err != nil {
+		return 0
+	}
+	if p == PriorityRecent {
+		return -mtime
+	}
+	return size
+}
+
+type rankedEntry struct {
+	entry FileEntry
+	key   int64
+	seq   int // arrival order, to keep ties in walk order
+}
+
+type rankedHeap []rankedEntry
+
+func (h rankedHeap) Len() int { return len(h) }
+func (h rankedHeap) Less(i, j int) bool {
+	if h[i].key != h[j].key {
+		return h[i].key < h[j].key
+	}
+	return h[i].seq < h[j].seq
+}
+func (h rankedHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *rankedHeap) Push(x any)   { *h = append(*h, x.(rankedEntry)) }
+func (h *rankedHeap) Pop() any {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
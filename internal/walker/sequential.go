@@ -0,0 +1,42 @@
+package walker
+
+// WalkSequential traverses roots depth-first on the calling goroutine,
+// calling visit for each file and onErr for each traversal error. It starts
+// no goroutines and holds at most one directory fd open, trading throughput
+// for a small, predictable footprint. Filtering matches Walk; Recursive is
+// implied.
+func WalkSequential(roots []string, opts WalkOptions, visit func(FileEntry), onErr func(error)) {
+	pw := &parallelWalker{
+		cancel:    opts.Cancel,
+		visit:     visit,
+		onErr:     onErr,
+		canonical: opts.Canonical,
+		output:    opts.Output,
+	}
+
+	buf := make([]byte, 32*1024)
+	var dirents []Dirent
+	var subdirs []walkItem
+	var st WalkStats
+	rules := newRuleCache()
+
+	// Explicit stack instead of recursion. Children are pushed in reverse
+	// so they are visited in directory order.
+	var stack []walkItem
+	rs := walkRoots(roots, opts)
+	for i := len(rs) - 1; i >= 0; i-- {
+		stack = append(stack, rs[i].item())
+	}
+	for len(stack) > 0 && !pw.canceled() {
+		item := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		dirents, subdirs = pw.processDir(item, buf, dirents, &st, subdirs[:0], rules)
+		for i := len(subdirs) - 1; i >= 0; i-- {
+			stack = append(stack, subdirs[i])
+		}
+	}
+
+	if opts.Stats != nil {
+		opts.Stats.add(&st)
+	}
+}
@@ -0,0 +1,239 @@
+package walker
+
+import (
+	"os"
+	"sync/atomic"
+
+	"golang.org/x/sys/unix"
+)
+
+// Errors reported for roots and path components of the wrong type.
+var (
+	errIsDir  error = unix.EISDIR
+	errNotDir error = unix.ENOTDIR
+)
+
+// noatimeWorks tracks whether O_NOATIME is usable for directory opens.
+// Starts as 1 (try it); set to 0 after the first EPERM.
+var noatimeWorks atomic.Int32
+
+func init() { noatimeWorks.Store(1) }
+
+// openDir opens a directory with O_NOATIME, falling back without it.
+func openDir(path string) (int, error) {
+	flags := unix.O_RDONLY | unix.O_DIRECTORY
+	if noatimeWorks.Load() != 0 {
+		fd, err := unix.Open(path, flags|unix.O_NOATIME, 0)
+		if err == nil {
+			return fd, nil
+		}
+		if err == unix.EPERM {
+			noatimeWorks.Store(0)
+		}
+	}
+	return unix.Open(path, flags, 0)
+}
+
+// readHead reads the start of the file at path into buf, opened with
+// O_NOATIME where the file allows it, and returns the bytes read: all of
+// buf unless the file is shorter.
+func readHead(path string, buf []byte) (int, error) {
+	fd, err := unix.Open(path, unix.O_RDONLY|unix.O_NOATIME, 0)
+	if err == unix.EPERM {
+		fd, err = unix.Open(path, unix.O_RDONLY, 0)
+	}
+	if err != nil {
+		return 0, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	defer unix.Close(fd)
+	total := 0
+	for total < len(buf) {
+		n, err := unix.Pread(fd, buf[total:], int64(total))
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return 0, &os.PathError{Op: "read", Path: path, Err: err}
+		}
+		if n == 0 {
+			break
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// readDirents reads the next batch of entries of the directory fd into dst
+// using buf. n is 0 at the end of the directory; a batch may hold no
+// entries when it had only "." and "..".
+func readDirents(fd int, buf []byte, dst []Dirent) (entries []Dirent, n int, err error) {
+	n, err = unix.Getdents(fd, buf)
+	if err != nil || n == 0 {
+		return dst[:0], 0, err
+	}
+	return ParseDirents(buf, n, dst), n, nil
+}
+
+// closeDir closes a directory opened by openDir.
+func closeDir(fd int) {
+	unix.Close(fd)
+}
+
+// resolveTypes fills in the type of the DT_UNKNOWN entries of a batch read
+// from the directory fd, as filesystems that leave d_type unset (some XFS
+// and NFS setups) report every entry. Each is stat'ed relative to fd, so
+// the kernel looks up one name instead of walking the entry's whole path
+// again, and the batch is resolved before any of it is filtered. A
+// symlink is not followed, so it becomes DT_LNK as getdents would have
+// reported it, and the caller applies -L to it. An entry whose stat fails
+// keeps DT_UNKNOWN, for the caller to report. Returns the number of
+// entries stat'ed.
+func resolveTypes(fd int, entries []Dirent) int {
+	var st unix.Stat_t
+	n := 0
+	for i := range entries {
+		e := &entries[i]
+		if e.Type != DT_UNKNOWN {
+			continue
+		}
+		n++
+		if unix.Fstatat(fd, e.Name, &st, unix.AT_SYMLINK_NOFOLLOW) == nil {
+			e.Type = uint8((st.Mode & unix.S_IFMT) >> 12) // IFTODT
+		}
+	}
+	return n
+}
+
+// statType returns the DT_* type of the file at path, following a final
+// symlink when follow is set.
+func statType(path string, follow bool) (uint8, error) {
+	var st unix.Stat_t
+	var err error
+	if follow {
+		err = unix.Stat(path, &st)
+	} else {
+		err = unix.Lstat(path, &st)
+	}
+	if err != nil {
+		return DT_UNKNOWN, err
+	}
+	return uint8((st.Mode & unix.S_IFMT) >> 12), nil // IFTODT
+}
+
+// statSize returns the size and modification time, in nanoseconds since
+// the Unix epoch, of the file at path.
+func statSize(path string) (size, mtime int64, err error) {
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		return 0, 0, err
+	}
+	return st.Size, st.Mtim.Nano(), nil
+}
+
+// statID returns the identity of the file at path, following a final
+// symlink.
+func statID(path string) (FileID, bool) {
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		return FileID{}, false
+	}
+	return FileID{Dev: st.Dev, Ino: st.Ino}, true
+}
+
+// OutputFile returns the identity of f if it is a regular file, as stdout
+// is when redirected to one, for WalkOptions.Output.
+func OutputFile(f *os.File) FileID {
+	var st unix.Stat_t
+	if err := unix.Fstat(int(f.Fd()), &st); err != nil || st.Mode&unix.S_IFMT != unix.S_IFREG {
+		return FileID{}
+	}
+	return FileID{Dev: st.Dev, Ino: st.Ino}
+}
+
+// Filesystem magic numbers (statfs f_type) for filesystems that compare
+// names case-insensitively. Constants missing from x/sys are spelled out.
+const (
+	ntfs3SuperMagic   = 0x7366746e
+	hfsplusSuperMagic = 0x482b
+
+	// fsCasefoldFL is FS_CASEFOLD_FL: set on ext4/f2fs directories created
+	// with +F, whose lookups are case-insensitive.
+	fsCasefoldFL = 0x40000000
+)
+
+// isCaseInsensitiveFS reports whether names under dir are looked up
+// case-insensitively, either because the whole filesystem folds case
+// (vfat, exfat, ntfs3, hfsplus, SMB) or because dir carries the casefold
+// attribute. Errors are treated as case-sensitive, git's default.
+func isCaseInsensitiveFS(dir string) bool {
+	var st unix.Statfs_t
+	if err := unix.Statfs(dir, &st); err != nil {
+		return false
+	}
+	switch uint32(st.Type) {
+	case unix.MSDOS_SUPER_MAGIC, unix.EXFAT_SUPER_MAGIC, ntfs3SuperMagic, hfsplusSuperMagic,
+		unix.CIFS_SUPER_MAGIC, unix.SMB2_SUPER_MAGIC, unix.SMB_SUPER_MAGIC:
+		return true
+	}
+
+	fd, err := openDir(dir)
+	if err != nil {
+		return false
+	}
+	defer unix.Close(fd)
+	flags, err := unix.IoctlGetUint32(fd, unix.FS_IOC_GETFLAGS)
+	if err != nil {
+		return false
+	}
+	return flags&fsCasefoldFL != 0
+}
+
+// Magic numbers of virtual filesystems missing from x/sys.
+const (
+	configfsMagic = 0x62656570
+	fusectlMagic  = 0x65735543
+)
+
+// isVirtualFS reports whether dir is on a filesystem the kernel makes up
+// as it is read, such as procfs or sysfs. Their files report sizes that
+// are not their content, may block or never end, and mirror the rest of
+// the system. Errors are treated as a real filesystem.
+func isVirtualFS(dir string) bool {
+	var st unix.Statfs_t
+	if err := unix.Statfs(dir, &st); err != nil {
+		return false
+	}
+	return isVirtualFSType(st.Type)
+}
+
+// dirDevice returns the device of the directory open at fd, and whether
+// it is on a virtual filesystem (see isVirtualFS). Only a directory on
+// another device than parent, the device of the directory that listed it,
+// is a mount point, so only then is the filesystem asked for its type.
+// A parent of 0, for a root, is never a crossing: walkRoot.item checks the
+// root itself. Errors are treated as no crossing.
+func dirDevice(fd int, parent uint64) (dev uint64, virtual bool) {
+	var st unix.Stat_t
+	if err := unix.Fstat(fd, &st); err != nil {
+		return parent, false
+	}
+	if st.Dev == parent || parent == 0 {
+		return st.Dev, false
+	}
+	var fs unix.Statfs_t
+	if err := unix.Fstatfs(fd, &fs); err != nil {
+		return st.Dev, false
+	}
+	return st.Dev, isVirtualFSType(fs.Type)
+}
+
+func isVirtualFSType(typ int64) bool {
+	switch uint32(typ) {
+	case unix.PROC_SUPER_MAGIC, unix.SYSFS_MAGIC, unix.DEBUGFS_MAGIC, unix.TRACEFS_MAGIC,
+		unix.SECURITYFS_MAGIC, unix.CGROUP_SUPER_MAGIC, unix.CGROUP2_SUPER_MAGIC, unix.DEVPTS_SUPER_MAGIC,
+		unix.BPF_FS_MAGIC, unix.PSTOREFS_MAGIC, unix.EFIVARFS_MAGIC, unix.BINFMTFS_MAGIC,
+		unix.SELINUX_MAGIC, unix.SMACK_MAGIC, configfsMagic, fusectlMagic:
+		return true
+	}
+	return false
+}
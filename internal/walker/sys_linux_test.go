@@ -0,0 +1,151 @@
+package walker
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// walkAll runs a recursive walk of root with opts and returns the files
+// and errors it reported.
+func walkAll(root string, opts WalkOptions) (files []string, errs []error) {
+	opts.Recursive = true
+	fileCh, errCh := Walk([]string{root}, opts)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for err := range errCh {
+			errs = append(errs, err)
+		}
+	}()
+	for e := range fileCh {
+		files = append(files, e.Path)
+	}
+	<-done
+	return files, errs
+}
+
+func TestWalkVirtualFS(t *testing.T) {
+	if !isVirtualFS("/proc/self/fdinfo") {
+		t.Skip("/proc is not mounted")
+	}
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "a.txt"), []byte("a\n"), 0644)
+	os.Symlink("/proc/self/fdinfo", filepath.Join(root, "proc"))
+
+	var st WalkStats
+	files, _ := walkAll(root, WalkOptions{FollowSymlinks: true, Stats: &st})
+	if len(files) != 1 || st.SkippedVirtual != 1 {
+		t.Errorf("files = %v, SkippedVirtual = %d, want a.txt alone and 1", files, st.SkippedVirtual)
+	}
+
+	files, _ = walkAll(root, WalkOptions{FollowSymlinks: true, VirtualFS: true})
+	if !hasPrefix(files, filepath.Join(root, "proc")+"/") {
+		t.Errorf("with VirtualFS, nothing under proc/ was emitted: %v", files)
+	}
+
+	// A root on a virtual filesystem was asked for: everything beneath it
+	// is walked.
+	files, _ = walkAll("/proc/self/fdinfo", WalkOptions{})
+	if len(files) == 0 {
+		t.Error("walking /proc/self/fdinfo emitted no files")
+	}
+
+	e, err := Explain(filepath.Join(root, "proc/0"), []string{root}, WalkOptions{FollowSymlinks: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Included || e.Layer != "virtual-fs" {
+		t.Errorf("Explain = %v, want excluded by virtual-fs", e)
+	}
+}
+
+func TestDirDevice(t *testing.T) {
+	fd, err := openDir("/proc/self/fdinfo")
+	if err != nil {
+		t.Skip("/proc is not mounted")
+	}
+	defer closeDir(fd)
+	parent, err := openDir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeDir(parent)
+	other, _ := dirDevice(parent, 0)
+
+	dev, virtual := dirDevice(fd, other)
+	if !virtual {
+		t.Error("crossing into /proc: not virtual")
+	}
+	// On the parent's device there is no mount to check.
+	if _, virtual := dirDevice(fd, dev); virtual {
+		t.Error("same device as the parent: virtual")
+	}
+	if _, virtual := dirDevice(fd, 0); virtual {
+		t.Error("a root: virtual")
+	}
+}
+
+func TestWalkOutput(t *testing.T) {
+	root := t.TempDir()
+	os.Mkdir(filepath.Join(root, "sub"), 0755)
+	for _, name := range []string{"a.txt", "sub/out.txt", "sub/b.txt"} {
+		os.WriteFile(filepath.Join(root, name), []byte("x\n"), 0644)
+	}
+	f, err := os.OpenFile(filepath.Join(root, "sub/out.txt"), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	out := OutputFile(f)
+	if out == (FileID{}) {
+		t.Fatal("OutputFile of a regular file is zero")
+	}
+
+	var st WalkStats
+	files, errs := walkAll(root, WalkOptions{Output: out, Stats: &st})
+	if len(files) != 2 || hasPrefix(files, filepath.Join(root, "sub/out.txt")) {
+		t.Errorf("files = %v, want a.txt and sub/b.txt", files)
+	}
+	if st.SkippedOutput != 1 || len(errs) != 1 || !strings.Contains(errs[0].Error(), "input file is also the output") {
+		t.Errorf("SkippedOutput = %d, errors = %v", st.SkippedOutput, errs)
+	}
+
+	if OutputFile(os.Stdin) == out || !out.Matches(filepath.Join(root, "sub/../sub/out.txt")) {
+		t.Error("FileID does not identify the file by device and inode")
+	}
+}
+
+// hasPrefix reports whether a path in paths starts with prefix.
+func hasPrefix(paths []string, prefix string) bool {
+	for _, p := range paths {
+		if strings.HasPrefix(p, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestResolveTypes(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "f"), []byte("x\n"), 0644)
+	os.Mkdir(filepath.Join(dir, "d"), 0755)
+	os.Symlink("f", filepath.Join(dir, "link"))
+
+	fd, err := openDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeDir(fd)
+	entries := []Dirent{{Name: "f"}, {Name: "d"}, {Name: "link"}, {Name: "gone"}, {Name: "known", Type: DT_FIFO}}
+	if n := resolveTypes(fd, entries); n != 4 {
+		t.Errorf("stat'ed %d entries, want 4", n)
+	}
+	want := []uint8{DT_REG, DT_DIR, DT_LNK, DT_UNKNOWN, DT_FIFO}
+	for i, e := range entries {
+		if e.Type != want[i] {
+			t.Errorf("%s: type %d, want %d", e.Name, e.Type, want[i])
+		}
+	}
+}
@@ -0,0 +1,143 @@
+//go:build !linux
+
+package walker
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+)
+
+// Portable versions of sys_linux.go, for builds other than Linux (chiefly
+// wasip1): directories are read with os.File.ReadDir and files stat'ed with
+// the os package. There is no O_NOATIME, no casefold or virtual filesystem
+// detection, and files have no identity to compare with the output's.
+
+// Errors reported for roots and path components of the wrong type.
+var (
+	errIsDir  = errors.New("is a directory")
+	errNotDir = errors.New("not a directory")
+)
+
+// direntBatch is the number of entries readDirents asks for at a time.
+const direntBatch = 256
+
+// openDir opens a directory.
+func openDir(path string) (*os.File, error) {
+	return os.Open(path)
+}
+
+// readDirents reads the next batch of entries of the directory f into dst.
+// n is 0 at the end of the directory. buf is unused.
+func readDirents(f *os.File, _ []byte, dst []Dirent) (entries []Dirent, n int, err error) {
+	des, err := f.ReadDir(direntBatch)
+	if err == io.EOF {
+		return dst[:0], 0, nil
+	}
+	entries = dst[:0]
+	for _, de := range des {
+		entries = append(entries, Dirent{Name: de.Name(), Type: direntType(de.Type())})
+	}
+	return entries, len(des), err
+}
+
+// closeDir closes a directory opened by openDir.
+func closeDir(f *os.File) {
+	f.Close()
+}
+
+// direntType maps a file mode type to its DT_* constant.
+func direntType(t fs.FileMode) uint8 {
+	switch t {
+	case 0:
+		return DT_REG
+	case fs.ModeDir:
+		return DT_DIR
+	case fs.ModeSymlink:
+		return DT_LNK
+	case fs.ModeNamedPipe:
+		return DT_FIFO
+	case fs.ModeSocket:
+		return DT_SOCK
+	case fs.ModeDevice:
+		return DT_BLK
+	case fs.ModeDevice | fs.ModeCharDevice:
+		return DT_CHR
+	}
+	return DT_UNKNOWN
+}
+
+// resolveTypes does nothing: ReadDir already reports types where the
+// platform has them, and processDir stats any entry left DT_UNKNOWN.
+func resolveTypes(*os.File, []Dirent) int {
+	return 0
+}
+
+// statType returns the DT_* type of the file at path, following a final
+// symlink when follow is set.
+func statType(path string, follow bool) (uint8, error) {
+	var fi fs.FileInfo
+	var err error
+	if follow {
+		fi, err = os.Stat(path)
+	} else {
+		fi, err = os.Lstat(path)
+	}
+	if err != nil {
+		return DT_UNKNOWN, err
+	}
+	return direntType(fi.Mode().Type()), nil
+}
+
+// statSize returns the size and modification time, in nanoseconds since
+// the Unix epoch, of the file at path.
+func statSize(path string) (size, mtime int64, err error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	return fi.Size(), fi.ModTime().UnixNano(), nil
+}
+
+// isCaseInsensitiveFS reports false: case-folding filesystems are only
+// detected on Linux.
+func isCaseInsensitiveFS(string) bool {
+	return false
+}
+
+// statID reports no identity: inode numbers are not portable.
+func statID(string) (FileID, bool) {
+	return FileID{}, false
+}
+
+// OutputFile returns the zero FileID, which matches no file.
+func OutputFile(*os.File) FileID {
+	return FileID{}
+}
+
+// isVirtualFS reports false: virtual filesystems are only detected on
+// Linux.
+func isVirtualFS(string) bool {
+	return false
+}
+
+// dirDevice reports no device and no virtual filesystem.
+func dirDevice(*os.File, uint64) (uint64, bool) {
+	return 0, false
+}
+
+// readHead reads the start of the file at path into buf and returns the
+// bytes read: all of buf unless the file is shorter.
+func readHead(path string, buf []byte) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	n, err := io.ReadFull(f, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	return n, err
+}
@@ -0,0 +1,76 @@
+package walker
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// fileTypes maps the names -t and -T accept to the globs of each file type,
+// after ripgrep's built-in types. The globs match base names, as --glob
+// does; "test" gathers the usual test file names of several languages, so
+// that -T test leaves them out whatever the language.
+var fileTypes = map[string][]string{
+	"c":        {"*.c", "*.h"},
+	"cpp":      {"*.cc", "*.cpp", "*.cxx", "*.c++", "*.hh", "*.hpp", "*.hxx", "*.h++", "*.inl"},
+	"csharp":   {"*.cs", "*.csx"},
+	"css":      {"*.css", "*.scss", "*.sass", "*.less"},
+	"docker":   {"Dockerfile", "Dockerfile.*", "*.dockerfile", "Containerfile"},
+	"go":       {"*.go"},
+	"html":     {"*.html", "*.htm", "*.xhtml"},
+	"java":     {"*.java", "*.jsp"},
+	"js":       {"*.js", "*.jsx", "*.mjs", "*.cjs", "*.vue"},
+	"json":     {"*.json", "*.jsonl", "*.ndjson"},
+	"kotlin":   {"*.kt", "*.kts"},
+	"lua":      {"*.lua"},
+	"make":     {"Makefile", "makefile", "GNUmakefile", "*.mk", "*.mak"},
+	"markdown": {"*.md", "*.markdown", "*.mdx"},
+	"md":       {"*.md", "*.markdown", "*.mdx"},
+	"php":      {"*.php", "*.phtml"},
+	"proto":    {"*.proto"},
+	"py":       {"*.py", "*.pyi", "*.pyw"},
+	"rb":       {"*.rb", "*.rake", "*.gemspec", "Gemfile", "Rakefile"},
+	"rust":     {"*.rs"},
+	"sh":       {"*.sh", "*.bash", "*.zsh", ".bashrc", ".zshrc", ".profile"},
+	"sql":      {"*.sql"},
+	"swift":    {"*.swift"},
+	"test":     {"*_test.go", "test_*.py", "*_test.py", "*_test.rb", "*_spec.rb", "*.test.{js,jsx,ts,tsx}", "*.spec.{js,jsx,ts,tsx}", "*Test.java", "*Tests.java"},
+	"toml":     {"*.toml"},
+	"ts":       {"*.ts", "*.tsx", "*.mts", "*.cts"},
+	"txt":      {"*.txt"},
+	"xml":      {"*.xml", "*.xsd", "*.xsl", "*.xslt", "*.plist"},
+	"yaml":     {"*.yaml", "*.yml"},
+}
+
+// TypeNames returns the names of the built-in file types, sorted.
+func TypeNames() []string {
+	names := make([]string, 0, len(fileTypes))
+	for name := range fileTypes {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// TypeFilterGlobs expands the types of -t (include) and -T (exclude) into
+// WalkOptions.Globs patterns: the include types' globs as they are, and
+// the exclude types' prefixed with "!". Unknown names are an error, which
+// lists the known ones.
+func TypeFilterGlobs(include, exclude []string) ([]string, error) {
+	var globs []string
+	for _, set := range []struct {
+		names  []string
+		prefix string
+	}{{include, ""}, {exclude, "!"}} {
+		for _, name := range set.names {
+			tg, ok := fileTypes[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown file type %q (known: %s)", name, strings.Join(TypeNames(), ", "))
+			}
+			for _, g := range tg {
+				globs = append(globs, set.prefix+g)
+			}
+		}
+	}
+	return globs, nil
+}
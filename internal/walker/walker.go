@@ -1,56 +1,230 @@
 package walker
 
 import (
-	"path/filepath"
+	"errors"
 	"runtime"
 	"strings"
 	"sync"
-	"sync/atomic"
+	"time"
 	"unsafe"
-
-	"golang.org/x/sys/unix"
 )
 
-// noatimeWorks tracks whether O_NOATIME is usable for directory opens.
-// Starts as 1 (try it); set to 0 after the first EPERM.
-var noatimeWorks atomic.Int32
-
-func init() { noatimeWorks.Store(1) }
+// FileID identifies a file by device and inode number. The zero FileID
+// matches no file.
+type FileID struct {
+	Dev, Ino uint64
+}
 
-// openDir opens a directory with O_NOATIME, falling back without it.
-func openDir(path string) (int, error) {
-	flags := unix.O_RDONLY | unix.O_DIRECTORY
-	if noatimeWorks.Load() != 0 {
-		fd, err := unix.Open(path, flags|unix.O_NOATIME, 0)
-		if err == nil {
-			return fd, nil
-		}
-		if err == unix.EPERM {
-			noatimeWorks.Store(0)
-		}
+// Matches reports whether path names the file id identifies.
+func (id FileID) Matches(path string) bool {
+	if id == (FileID{}) {
+		return false
 	}
-	return unix.Open(path, flags, 0)
+	got, ok := statID(path)
+	return ok && got == id
 }
 
+// errIsOutput is reported for a file the walk would emit that is the file
+// output is written to: searching it would read back the results.
+var errIsOutput = errors.New("input file is also the output")
+
 // FileEntry represents a file discovered during directory traversal.
 type FileEntry struct {
 	Path string
+	Root string // label of the root it was found under: its RootSpec.Label, or the root path as given
 }
 
+// DirAction selects what a non-recursive walk does with a root that is a
+// directory, like grep's -d/--directories.
+type DirAction int
+
+const (
+	DirWarn DirAction = iota // report the directory as an error
+	DirSkip                  // drop it silently
+	DirRead                  // emit the files directly inside it, without descending
+)
+
 // WalkOptions configures directory traversal behavior.
 type WalkOptions struct {
 	Recursive      bool
-	NoIgnore       bool     // skip .gitignore processing
-	Hidden         bool     // include hidden files and directories
-	FollowSymlinks bool     // follow symbolic links
-	IncludeBinary  bool     // include files with known binary extensions (.so, .o, .png, etc.)
-	Globs          []string // include/exclude globs (prefix ! to exclude)
+	Directories    DirAction       // directory roots when Recursive is false
+	NoIgnore       bool            // skip .gitignore processing
+	Hidden         bool            // include hidden files and directories (sets both below)
+	HiddenFiles    bool            // include dot-files
+	HiddenDirs     bool            // descend into dot-directories
+	HiddenGlobs    []string        // re-include hidden files and directories whose name matches
+	FollowSymlinks bool            // follow symbolic links
+	IncludeBinary  bool            // include files with known binary extensions (.so, .o, .png, etc.)
+	Globs          []string        // include/exclude globs (prefix ! to exclude)
+	Binary         *BinaryPolicy   // per-path overrides of binary detection
+	Roots          []RootSpec      // further roots with their own filtering, walked after the roots argument
+	Stats          *WalkStats      // if non-nil, filled with traversal counters when the walk ends
+	Cancel         <-chan struct{} // closing it stops the walk; unvisited directories are dropped
+	InFlight       *InFlight       // if non-nil, bounds emitted files the consumer has not finished (recursive walks)
+	Repos          RepoBoundary    // whether to descend into nested git repositories and submodules
+	Canonical      *Canonical      // if non-nil, emit real paths, each once
+	VirtualFS      bool            // descend into virtual filesystems (procfs, sysfs, cgroup, ...) met below a root
+	Output         FileID          // the file output goes to: reported instead of emitted (zero = none)
+}
+
+// RepoBoundary says whether a recursive walk descends into a subdirectory
+// that is the top of another git repository, which it recognizes by a .git
+// entry. A nested clone has a .git directory; a submodule or a linked
+// worktree has a .git file pointing at the repository's real git
+// directory. Roots are always walked, whatever they contain.
+type RepoBoundary int
+
+const (
+	DescendRepos     RepoBoundary = iota // walk nested repositories like any directory
+	StopAtSubmodules                     // skip directories whose .git is a file
+	StopAtRepos                          // skip every directory holding a .git entry
+)
+
+// gitEntry returns the type of dir's .git entry, if it has one.
+func gitEntry(dir string) (uint8, bool) {
+	typ, err := statType(joinPath(dir, ".git"), false)
+	return typ, err == nil
+}
+
+// stops reports whether the walk does not descend into dir. It costs a
+// stat per directory, so DescendRepos, the default, skips it.
+func (b RepoBoundary) stops(dir string) bool {
+	if b == DescendRepos {
+		return false
+	}
+	typ, ok := gitEntry(dir)
+	if !ok {
+		return false
+	}
+	return b == StopAtRepos || typ != DT_DIR
+}
+
+// RootSpec is a walk root filtered with its own options, so one walk can
+// search, say, one tree with hidden files and another without. Options
+// replaces the walk's filtering options under Path: NoIgnore, the hidden
+// options, FollowSymlinks, IncludeBinary, Globs, Binary, Repos and
+// VirtualFS. Its other fields are ignored; Recursive, Directories, Stats,
+// Cancel and Output are set for the whole walk. Label names the root in
+// the FileEntry.Root of its files; "" names it by Path.
+type RootSpec struct {
+	Path    string
+	Label   string
+	Options WalkOptions
+}
+
+// walkFilter holds the options that decide which entries a walk keeps.
+// Each root has one, shared by every directory beneath it.
+type walkFilter struct {
+	hidden         hiddenPolicy
+	noIgnore       bool
+	followSymlinks bool
+	includeBinary  bool
+	globs          []filterGlob
+	binary         *BinaryPolicy
+	repos          RepoBoundary
+	virtualFS      bool
+}
+
+func newWalkFilter(opts WalkOptions) *walkFilter {
+	return &walkFilter{
+		hidden:         newHiddenPolicy(opts),
+		noIgnore:       opts.NoIgnore,
+		followSymlinks: opts.FollowSymlinks,
+		includeBinary:  opts.IncludeBinary,
+		globs:          newFilterGlobs(opts.Globs),
+		binary:         opts.Binary,
+		repos:          opts.Repos,
+		virtualFS:      opts.VirtualFS,
+	}
+}
+
+// walkRoot is a root path with the filter that applies beneath it.
+type walkRoot struct {
+	path   string
+	label  string
+	filter *walkFilter
+}
+
+// walkRoots pairs roots with the walk-wide filter, followed by opts.Roots
+// with their own.
+func walkRoots(roots []string, opts WalkOptions) []walkRoot {
+	rs := make([]walkRoot, 0, len(roots)+len(opts.Roots))
+	if len(roots) > 0 {
+		f := newWalkFilter(opts)
+		for _, r := range roots {
+			rs = append(rs, walkRoot{path: r, label: r, filter: f})
+		}
+	}
+	for _, spec := range opts.Roots {
+		label := spec.Label
+		if label == "" {
+			label = spec.Path
+		}
+		rs = append(rs, walkRoot{path: spec.Path, label: label, filter: newWalkFilter(spec.Options)})
+	}
+	return rs
+}
+
+// item returns the work item for the root directory. Case sensitivity is
+// decided once per root and inherited by everything beneath it, as is
+// whether the root itself is on a virtual filesystem.
+func (r walkRoot) item() walkItem {
+	fold := isCaseInsensitiveFS(r.path)
+	virtual := !r.filter.virtualFS && isVirtualFS(r.path)
+	return walkItem{path: r.path, root: r.label, ignores: rootIgnores(r.path, fold, r.filter.noIgnore), fold: fold, virtual: virtual, filter: r.filter}
+}
+
+// WalkStats counts what the walker visited and why entries were dropped.
+// Counters are complete once the file channel returned by Walk is closed.
+type WalkStats struct {
+	Dirs           int // directories read
+	Files          int // files emitted
+	SkippedVCS     int // .git, .svn, .hg and node_modules directories
+	SkippedHidden  int // dot-files and dot-directories not included by the hidden options
+	SkippedBinary  int // files with a known binary extension
+	SkippedIgnore  int // entries matched by a .gitignore rule
+	SkippedGlob    int // entries rejected by --glob
+	SkippedLinks   int // symlinks not followed, or broken
+	SkippedRepos   int // nested repositories and submodules not descended into (Repos)
+	SkippedDups    int // files already emitted under another path (Canonical)
+	SkippedVirtual int // virtual filesystems not descended into (VirtualFS)
+	SkippedOutput  int // the output file (Output)
+	TypeStats      int // entries without a d_type, stat'ed for their type
+
+	PeakQueuedDirs int           // most directories waiting in the shared work queue
+	DepthFirstDirs int           // directories walked depth-first because the queue was full
+	Paused         int           // times discovery waited for in-flight files (InFlight)
+	PausedFor      time.Duration // total time spent waiting
+	PeakInFlight   int           // most emitted files unfinished at once
+}
+
+// add accumulates o into s.
+func (s *WalkStats) add(o *WalkStats) {
+	s.Dirs += o.Dirs
+	s.Files += o.Files
+	s.SkippedVCS += o.SkippedVCS
+	s.SkippedHidden += o.SkippedHidden
+	s.SkippedBinary += o.SkippedBinary
+	s.SkippedIgnore += o.SkippedIgnore
+	s.SkippedGlob += o.SkippedGlob
+	s.SkippedLinks += o.SkippedLinks
+	s.SkippedRepos += o.SkippedRepos
+	s.SkippedDups += o.SkippedDups
+	s.SkippedVirtual += o.SkippedVirtual
+	s.SkippedOutput += o.SkippedOutput
+	s.TypeStats += o.TypeStats
+	s.PeakQueuedDirs = max(s.PeakQueuedDirs, o.PeakQueuedDirs)
+	s.DepthFirstDirs += o.DepthFirstDirs
+	s.Paused += o.Paused
+	s.PausedFor += o.PausedFor
+	s.PeakInFlight = max(s.PeakInFlight, o.PeakInFlight)
 }
 
 // Walk traverses directories and sends discovered files on the returned channel.
 // It uses raw getdents64 for maximum Linux performance.
 // Respects .gitignore files and skips hidden files/directories by default.
-// If recursive is false, only the given paths are used as literal file paths.
+// If recursive is false, regular files among the roots are emitted as given
+// and directories are handled per opts.Directories.
 func Walk(roots []string, opts WalkOptions) (<-chan FileEntry, <-chan error) {
 	fileCh := make(chan FileEntry, 256)
 	errCh := make(chan error, 16)
@@ -59,38 +233,28 @@ func Walk(roots []string, opts WalkOptions) (<-chan FileEntry, <-chan error) {
 		defer close(fileCh)
 		defer close(errCh)
 
-		if !opts.Recursive {
-			for _, root := range roots {
-				var stat unix.Stat_t
-				if err := unix.Stat(root, &stat); err != nil {
-					errCh <- &WalkError{Path: root, Err: err}
-					continue
-				}
-				if stat.Mode&unix.S_IFMT == unix.S_IFREG {
-					fileCh <- FileEntry{Path: root}
-				}
-			}
-			return
-		}
-
 		pw := &parallelWalker{
-			fileCh:         fileCh,
-			errCh:          errCh,
-			hidden:         opts.Hidden,
-			noIgnore:       opts.NoIgnore,
-			followSymlinks: opts.FollowSymlinks,
-			includeBinary: opts.IncludeBinary,
-			globs:          opts.Globs,
+			fileCh:    fileCh,
+			errCh:     errCh,
+			stats:     opts.Stats,
+			cancel:    opts.Cancel,
+			inFlight:  opts.InFlight,
+			canonical: opts.Canonical,
+			output:    opts.Output,
 		}
 		pw.cond = sync.NewCond(&pw.mu)
 
+		if !opts.Recursive {
+			pw.walkTopLevel(walkRoots(roots, opts), opts.Directories)
+			return
+		}
+
 		// Seed work queue with root directories.
-		for _, root := range roots {
-			var layers []ignoreLayer
-			if !opts.NoIgnore {
-				layers = []ignoreLayer{loadIgnoreLayer(root)}
-			}
-			pw.enqueue(walkItem{path: root, ignores: layers})
+		for _, root := range walkRoots(roots, opts) {
+			pw.enqueue(root.item())
+		}
+		if pw.stats != nil && pw.inFlight != nil {
+			defer pw.inFlight.addStats(pw.stats)
 		}
 
 		// Launch parallel walker goroutines.
@@ -109,27 +273,70 @@ func Walk(roots []string, opts WalkOptions) (<-chan FileEntry, <-chan error) {
 	return fileCh, errCh
 }
 
+// walkTopLevel handles a non-recursive walk: regular files are emitted as
+// given, directories according to dirs. Runs on the calling goroutine.
+func (pw *parallelWalker) walkTopLevel(roots []walkRoot, dirs DirAction) {
+	var st WalkStats
+	for _, wr := range roots {
+		root := wr.path
+		typ, err := statType(root, true)
+		if err != nil {
+			pw.fail(&WalkError{Path: root, Err: err})
+			continue
+		}
+		switch typ {
+		case DT_REG:
+			pw.emitFile(root, 0, wr.label, &st)
+		case DT_DIR:
+			switch dirs {
+			case DirSkip:
+			case DirRead:
+				// processDir filters and emits the files; the subdirectories
+				// it collects are dropped.
+				pw.processDir(wr.item(), make([]byte, 32*1024), nil, &st, nil, nil)
+			default:
+				pw.fail(&WalkError{Path: root, Err: errIsDir})
+			}
+		}
+	}
+	if pw.stats != nil {
+		pw.stats.add(&st)
+	}
+}
+
 // walkItem represents a directory to be traversed by a worker.
 type walkItem struct {
 	path    string
+	root    string        // the root's label, for FileEntry.Root
 	ignores []ignoreLayer // snapshot of parent's ignore layers (nil if --no-ignore)
+	fold    bool          // root is on a case-insensitive filesystem
+	virtual bool          // root is on a virtual filesystem, so all beneath is searched
+	dev     uint64        // device of the directory that listed this one; 0 for a root
+	filter  *walkFilter   // the root's filtering options
 }
 
 // parallelWalker coordinates concurrent BFS directory traversal.
 type parallelWalker struct {
-	fileCh         chan<- FileEntry
-	errCh          chan<- error
-	hidden         bool
-	noIgnore       bool
-	followSymlinks bool
-	includeBinary bool
-	globs          []string
+	fileCh chan<- FileEntry
+	errCh  chan<- error
+	stats  *WalkStats // shared totals; workers merge into it on exit
+	cancel <-chan struct{}
+
+	inFlight  *InFlight  // bounds emitted files not yet finished (nil = unbounded)
+	canonical *Canonical // resolves emitted paths (nil = as found)
+	output    FileID     // the output file, never emitted
+
+	// Sequential mode: files and errors go to these callbacks instead of
+	// the channels, on the walking goroutine.
+	visit func(FileEntry)
+	onErr func(error)
 
 	mu      sync.Mutex
 	queue   []walkItem
 	pending int        // dirs enqueued but not yet fully processed
 	cond    *sync.Cond // signaled when items are enqueued or work is done
 	done    bool
+	peak    int // most items queued at once
 }
 
 // enqueue adds a directory to the work queue.
@@ -137,10 +344,28 @@ func (pw *parallelWalker) enqueue(item walkItem) {
 	pw.mu.Lock()
 	pw.queue = append(pw.queue, item)
 	pw.pending++
+	pw.peak = max(pw.peak, len(pw.queue))
 	pw.mu.Unlock()
 	pw.cond.Signal()
 }
 
+// share counts added new directories at the end of local as pending, then
+// moves as many directories from the start of local, the shallowest, to
+// the shared queue as it has room for. What stays in local the worker
+// walks itself. Returns the rest of local.
+func (pw *parallelWalker) share(local []walkItem, added int) []walkItem {
+	pw.mu.Lock()
+	pw.pending += added
+	n := min(max(maxQueuedDirs-len(pw.queue), 0), len(local))
+	pw.queue = append(pw.queue, local[:n]...)
+	pw.peak = max(pw.peak, len(pw.queue))
+	pw.mu.Unlock()
+	if n > 0 {
+		pw.cond.Broadcast()
+	}
+	return append(local[:0], local[n:]...)
+}
+
 // dequeue retrieves a work item, blocking if the queue is temporarily empty.
 // Returns false when all work is complete.
 func (pw *parallelWalker) dequeue() (walkItem, bool) {
@@ -170,172 +395,319 @@ func (pw *parallelWalker) finish() {
 }
 
 // worker processes directories from the work queue until all work is done.
+// Counters are kept per worker and merged once, so the hot path never
+// touches shared memory.
 func (pw *parallelWalker) worker() {
 	buf := make([]byte, 32*1024) // per-worker getdents buffer
-	var dirents []Dirent          // per-worker reusable dirent slice
+	var dirents []Dirent         // per-worker reusable dirent slice
+	var subdirs []walkItem       // per-worker reusable subdir slice
+	rules := newRuleCache()      // per-worker compiled .gitignore files
+	var local []walkItem         // directories this worker walks itself while the queue is full
+	var st WalkStats
 	for {
-		item, ok := pw.dequeue()
-		if !ok {
-			return
+		var item walkItem
+		if n := len(local); n > 0 {
+			item, local = local[n-1], local[:n-1]
+			st.DepthFirstDirs++
+		} else {
+			var ok bool
+			if item, ok = pw.dequeue(); !ok {
+				break
+			}
+		}
+		if pw.canceled() {
+			// Drain the queue without reading anything so the walk ends.
+			pw.finish()
+			continue
 		}
-		dirents = pw.processDir(item, buf, dirents)
+		// Share discovered subdirectories after processDir closed the fd.
+		dirents, subdirs = pw.processDir(item, buf, dirents, &st, subdirs[:0], rules)
+		local = pw.share(append(local, subdirs...), len(subdirs))
 		pw.finish()
 	}
+	if pw.stats != nil {
+		pw.mu.Lock()
+		st.PeakQueuedDirs = pw.peak
+		pw.stats.add(&st)
+		pw.mu.Unlock()
+	}
+}
+
+// skipReason says why the walker drops an entry; keep means it doesn't.
+// The walk only counts reasons; Explain also reports them.
+type skipReason int
+
+const (
+	keep skipReason = iota
+	skipVCS
+	skipHidden
+	skipBinary
+	skipIgnore
+	skipGlob
+	skipLink
+	skipRepo
+	skipVirtual
+)
+
+// count adds one entry dropped for r.
+func (s *WalkStats) count(r skipReason) {
+	switch r {
+	case skipVCS:
+		s.SkippedVCS++
+	case skipHidden:
+		s.SkippedHidden++
+	case skipBinary:
+		s.SkippedBinary++
+	case skipIgnore:
+		s.SkippedIgnore++
+	case skipGlob:
+		s.SkippedGlob++
+	case skipLink:
+		s.SkippedLinks++
+	case skipRepo:
+		s.SkippedRepos++
+	case skipVirtual:
+		s.SkippedVirtual++
+	}
+}
+
+// fileReason decides whether a regular file is emitted. The order of the
+// checks is the order in which they are reported.
+func (f *walkFilter) fileReason(item walkItem, name, fullPath string) skipReason {
+	switch {
+	case f.hidden.skipFile(name, item.fold):
+		return skipHidden
+	case !f.includeBinary && f.binaryByName(name, fullPath):
+		return skipBinary
+	case item.ignores != nil && isIgnoredByLayers(item.ignores, fullPath, false):
+		return skipIgnore
+	case f.isGlobExcluded(name, item.fold):
+		return skipGlob
+	}
+	return keep
+}
+
+// binaryByName reports whether a file is binary by its name alone: forced
+// by a binary glob, or a known binary extension not forced to text.
+func (f *walkFilter) binaryByName(name, fullPath string) bool {
+	switch f.binary.Resolve(fullPath) {
+	case ForceText:
+		return false
+	case ForceBinary:
+		return true
+	}
+	return IsBinaryExtension(name)
+}
+
+// subdirReason decides whether a subdirectory is descended into.
+func (f *walkFilter) subdirReason(item walkItem, name, fullPath string) skipReason {
+	switch {
+	case skipDir(name, f.hidden, item.fold):
+		if isVCSDir(name) {
+			return skipVCS
+		}
+		return skipHidden
+	case item.ignores != nil && isIgnoredByLayers(item.ignores, fullPath, true):
+		return skipIgnore
+	case f.isDirGlobExcluded(name, item.fold):
+		return skipGlob
+	case f.repos.stops(fullPath):
+		return skipRepo
+	}
+	return keep
+}
+
+// skipFile reports whether a regular file should not be emitted, counting
+// the reason in st.
+func (pw *parallelWalker) skipFile(item walkItem, name, fullPath string, st *WalkStats) bool {
+	r := item.filter.fileReason(item, name, fullPath)
+	st.count(r)
+	return r != keep
+}
+
+// skipSubdir reports whether a subdirectory should not be descended into,
+// counting the reason in st.
+func (pw *parallelWalker) skipSubdir(item walkItem, name, fullPath string, st *WalkStats) bool {
+	r := item.filter.subdirReason(item, name, fullPath)
+	st.count(r)
+	return r != keep
+}
+
+// subdirItem builds the work item for a subdirectory: the parent's ignore
+// layers plus this dir's .gitignore, compiled through rules (may be nil).
+func subdirItem(item walkItem, fullPath string, rules *ruleCache) walkItem {
+	var childIgnores []ignoreLayer
+	if !item.filter.noIgnore {
+		childIgnores = withIgnoreLayer(item.ignores, fullPath, item.fold, rules)
+	}
+	return walkItem{path: fullPath, root: item.root, ignores: childIgnores, fold: item.fold, virtual: item.virtual, dev: item.dev, filter: item.filter}
 }
 
-// processDir opens a single directory, reads all entries, and dispatches files/subdirs.
+// processDir opens a single directory, reads all entries, emits files, and
+// appends subdirectories to subdirs for the caller to schedule.
 // The directory fd is closed before returning — not held during subtree traversal.
-// Returns the dirents slice for reuse by the next call.
-func (pw *parallelWalker) processDir(item walkItem, buf []byte, dirents []Dirent) []Dirent {
+// Returns the dirents and subdirs slices for reuse by the next call.
+func (pw *parallelWalker) processDir(item walkItem, buf []byte, dirents []Dirent, st *WalkStats, subdirs []walkItem, rules *ruleCache) ([]Dirent, []walkItem) {
 	fd, err := openDir(item.path)
 	if err != nil {
-		pw.errCh <- &WalkError{Path: item.path, Err: err}
-		return dirents
+		pw.fail(&WalkError{Path: item.path, Err: err})
+		return dirents, subdirs
 	}
-
-	// Collect subdirectories to enqueue after closing the fd.
-	var subdirs []walkItem
+	if !item.filter.virtualFS && !item.virtual {
+		// From here on item.dev is this directory's device, which the
+		// subdirectories inherit as their parent's.
+		var virtual bool
+		if item.dev, virtual = dirDevice(fd, item.dev); virtual {
+			st.count(skipVirtual)
+			closeDir(fd)
+			return dirents, subdirs
+		}
+	}
+	st.Dirs++
 
 	for {
-		n, err := unix.Getdents(fd, buf)
+		var n int
+		dirents, n, err = readDirents(fd, buf, dirents)
 		if err != nil {
-			pw.errCh <- &WalkError{Path: item.path, Err: err}
+			pw.fail(&WalkError{Path: item.path, Err: err})
 			break
 		}
 		if n == 0 {
 			break
 		}
+		st.TypeStats += resolveTypes(fd, dirents)
 
-		dirents = ParseDirents(buf, n, dirents)
 		for _, entry := range dirents {
 			fullPath := joinPath(item.path, entry.Name)
 
 			switch entry.Type {
 			case DT_DIR:
-				if skipDir(entry.Name, pw.hidden) {
-					continue
-				}
-				if item.ignores != nil && isIgnoredByLayers(item.ignores, fullPath, true) {
+				if pw.skipSubdir(item, entry.Name, fullPath, st) {
 					continue
 				}
-				if pw.isGlobExcluded(entry.Name) {
-					continue
-				}
-				// Build child ignore layers: clone parent + load this dir's .gitignore
-				var childIgnores []ignoreLayer
-				if !pw.noIgnore {
-					childIgnores = make([]ignoreLayer, len(item.ignores)+1)
-					copy(childIgnores, item.ignores)
-					childIgnores[len(item.ignores)] = loadIgnoreLayer(fullPath)
-				}
-				subdirs = append(subdirs, walkItem{path: fullPath, ignores: childIgnores})
+				subdirs = append(subdirs, subdirItem(item, fullPath, rules))
 
 			case DT_REG:
-				if !pw.hidden && len(entry.Name) > 0 && entry.Name[0] == '.' {
+				if pw.skipFile(item, entry.Name, fullPath, st) {
 					continue
 				}
-				if !pw.includeBinary && IsBinaryExtension(entry.Name) {
-					continue
-				}
-				if item.ignores != nil && isIgnoredByLayers(item.ignores, fullPath, false) {
-					continue
-				}
-				if pw.isGlobExcluded(entry.Name) {
-					continue
-				}
-				pw.fileCh <- FileEntry{Path: fullPath}
+				pw.emitFile(fullPath, entry.Ino, item.root, st)
 
 			case DT_LNK:
-				if !pw.followSymlinks {
+				if !item.filter.followSymlinks {
+					st.SkippedLinks++
 					continue
 				}
-				var stat unix.Stat_t
-				if err := unix.Stat(fullPath, &stat); err != nil {
+				typ, err := statType(fullPath, true)
+				if err != nil {
+					st.SkippedLinks++
 					continue // silently skip broken symlinks
 				}
-				if stat.Mode&unix.S_IFMT == unix.S_IFREG {
-					if !pw.hidden && len(entry.Name) > 0 && entry.Name[0] == '.' {
-						continue
-					}
-					if !pw.includeBinary && IsBinaryExtension(entry.Name) {
-						continue
-					}
-					if item.ignores != nil && isIgnoredByLayers(item.ignores, fullPath, false) {
-						continue
-					}
-					if pw.isGlobExcluded(entry.Name) {
+				if typ == DT_REG {
+					if pw.skipFile(item, entry.Name, fullPath, st) {
 						continue
 					}
-					pw.fileCh <- FileEntry{Path: fullPath}
-				} else if stat.Mode&unix.S_IFMT == unix.S_IFDIR {
-					if skipDir(entry.Name, pw.hidden) {
+					pw.emitFile(fullPath, 0, item.root, st)
+				} else if typ == DT_DIR {
+					if pw.skipSubdir(item, entry.Name, fullPath, st) {
 						continue
 					}
-					if item.ignores != nil && isIgnoredByLayers(item.ignores, fullPath, true) {
-						continue
-					}
-					if pw.isGlobExcluded(entry.Name) {
-						continue
-					}
-					var childIgnores []ignoreLayer
-					if !pw.noIgnore {
-						childIgnores = make([]ignoreLayer, len(item.ignores)+1)
-						copy(childIgnores, item.ignores)
-						childIgnores[len(item.ignores)] = loadIgnoreLayer(fullPath)
-					}
-					subdirs = append(subdirs, walkItem{path: fullPath, ignores: childIgnores})
+					subdirs = append(subdirs, subdirItem(item, fullPath, rules))
 				}
 
 			case DT_UNKNOWN:
-				var stat unix.Stat_t
-				if err := unix.Stat(fullPath, &stat); err != nil {
-					pw.errCh <- &WalkError{Path: fullPath, Err: err}
+				// resolveTypes could not stat it; this reports why.
+				typ, err := statType(fullPath, false)
+				if err != nil {
+					pw.fail(&WalkError{Path: fullPath, Err: err})
 					continue
 				}
-				mode := stat.Mode & unix.S_IFMT
-				if mode == unix.S_IFREG {
-					if !pw.hidden && len(entry.Name) > 0 && entry.Name[0] == '.' {
-						continue
-					}
-					if !pw.includeBinary && IsBinaryExtension(entry.Name) {
-						continue
-					}
-					if item.ignores != nil && isIgnoredByLayers(item.ignores, fullPath, false) {
-						continue
-					}
-					if pw.isGlobExcluded(entry.Name) {
-						continue
-					}
-					pw.fileCh <- FileEntry{Path: fullPath}
-				} else if mode == unix.S_IFDIR {
-					if skipDir(entry.Name, pw.hidden) {
+				if typ == DT_REG {
+					if pw.skipFile(item, entry.Name, fullPath, st) {
 						continue
 					}
-					if item.ignores != nil && isIgnoredByLayers(item.ignores, fullPath, true) {
+					pw.emitFile(fullPath, 0, item.root, st)
+				} else if typ == DT_DIR {
+					if pw.skipSubdir(item, entry.Name, fullPath, st) {
 						continue
 					}
-					if pw.isGlobExcluded(entry.Name) {
-						continue
-					}
-					var childIgnores []ignoreLayer
-					if !pw.noIgnore {
-						childIgnores = make([]ignoreLayer, len(item.ignores)+1)
-						copy(childIgnores, item.ignores)
-						childIgnores[len(item.ignores)] = loadIgnoreLayer(fullPath)
-					}
-					subdirs = append(subdirs, walkItem{path: fullPath, ignores: childIgnores})
+					subdirs = append(subdirs, subdirItem(item, fullPath, rules))
 				}
 			}
 		}
 	}
 
-	unix.Close(fd)
+	closeDir(fd)
+	return dirents, subdirs
+}
+
+// emitFile counts and emits a file that passed the filters, under its
+// real path with Canonical, unless it was already emitted under another.
+// The output file is reported instead. ino is the file's inode number
+// from its directory entry, or 0; root is the label of its walk root.
+func (pw *parallelWalker) emitFile(path string, ino uint64, root string, st *WalkStats) {
+	if pw.isOutput(path, ino) {
+		st.SkippedOutput++
+		pw.fail(&WalkError{Path: path, Err: errIsOutput})
+		return
+	}
+	if pw.canonical != nil {
+		real, first := pw.canonical.Resolve(path)
+		if !first {
+			st.SkippedDups++
+			return
+		}
+		path = real
+	}
+	st.Files++
+	pw.emit(FileEntry{Path: path, Root: root})
+}
+
+// isOutput reports whether path is the output file. A known inode number
+// rules out all but that file without a stat.
+func (pw *parallelWalker) isOutput(path string, ino uint64) bool {
+	if ino != 0 && ino != pw.output.Ino {
+		return false
+	}
+	return pw.output.Matches(path)
+}
+
+// emit delivers a file to the consumer: the callback in sequential mode,
+// otherwise the file channel, after waiting for an in-flight slot. Once the
+// walk is canceled, files are dropped.
+func (pw *parallelWalker) emit(e FileEntry) {
+	if pw.visit != nil {
+		if !pw.canceled() {
+			pw.visit(e)
+		}
+		return
+	}
+	if pw.inFlight != nil && !pw.inFlight.acquire(pw.cancel) {
+		return
+	}
+	select {
+	case pw.fileCh <- e:
+	case <-pw.cancel:
+	}
+}
+
+// canceled reports whether opts.Cancel has been closed.
+func (pw *parallelWalker) canceled() bool {
+	select {
+	case <-pw.cancel:
+		return true
+	default:
+		return false
+	}
+}
 
-	// Enqueue discovered subdirectories after closing fd.
-	for _, sub := range subdirs {
-		pw.enqueue(sub)
+// fail reports a traversal error the same way emit reports files.
+func (pw *parallelWalker) fail(err error) {
+	if pw.onErr != nil {
+		pw.onErr(err)
+		return
 	}
-	return dirents
+	pw.errCh <- err
 }
 
 // joinPath concatenates a directory and entry name with a single separator.
@@ -361,41 +733,111 @@ func joinPath(dirPath, name string) string {
 
 // skipDir returns true for directories that should be skipped.
 // VCS directories (.git, .svn, .hg) and node_modules are always skipped.
-// Other hidden directories are skipped unless hidden is true.
-func skipDir(name string, hidden bool) bool {
-	switch name {
-	case ".git", ".svn", ".hg", "node_modules":
+// Other hidden directories are skipped unless the policy includes them.
+func skipDir(name string, hidden hiddenPolicy, fold bool) bool {
+	if isVCSDir(name) {
 		return true
 	}
-	if !hidden && len(name) > 0 && name[0] == '.' {
+	return hidden.skipDir(name, fold)
+}
+
+// hiddenPolicy decides which dot-files and dot-directories are walked.
+// Files and directories are switched separately so that, for example,
+// .env and .eslintrc can be searched without descending into .cache or
+// .idea. globs re-include matching hidden names either way.
+type hiddenPolicy struct {
+	files bool
+	dirs  bool
+	globs []glob
+}
+
+func newHiddenPolicy(opts WalkOptions) hiddenPolicy {
+	return hiddenPolicy{
+		files: opts.Hidden || opts.HiddenFiles,
+		dirs:  opts.Hidden || opts.HiddenDirs,
+		globs: compileGlobs(opts.HiddenGlobs),
+	}
+}
+
+func (h hiddenPolicy) skipFile(name string, fold bool) bool {
+	return !h.files && isHidden(name) && !h.included(name, fold)
+}
+
+func (h hiddenPolicy) skipDir(name string, fold bool) bool {
+	return !h.dirs && isHidden(name) && !h.included(name, fold)
+}
+
+// included reports whether name matches one of the re-include globs.
+func (h hiddenPolicy) included(name string, fold bool) bool {
+	return h.includedBy(name, fold) != ""
+}
+
+// includedBy returns the first re-include glob matching name, or "".
+func (h hiddenPolicy) includedBy(name string, fold bool) string {
+	name = foldName(name, fold)
+	for i := range h.globs {
+		if h.globs[i].match(name, fold) {
+			return h.globs[i].text
+		}
+	}
+	return ""
+}
+
+func isHidden(name string) bool {
+	return len(name) > 0 && name[0] == '.'
+}
+
+// isVCSDir returns true for directories that are never searched.
+func isVCSDir(name string) bool {
+	switch name {
+	case ".git", ".svn", ".hg", "node_modules":
 		return true
 	}
 	return false
 }
 
+// filterGlob is a compiled --glob: an inclusion, or with a "!" prefix an
+// exclusion. Its text keeps the prefix.
+type filterGlob struct {
+	glob
+	exclude bool
+}
+
+func newFilterGlobs(patterns []string) []filterGlob {
+	if len(patterns) == 0 {
+		return nil
+	}
+	gs := make([]filterGlob, len(patterns))
+	for i, p := range patterns {
+		pattern, exclude := strings.CutPrefix(p, "!")
+		gs[i] = filterGlob{glob: compileGlob(pattern), exclude: exclude}
+		gs[i].text = p
+	}
+	return gs
+}
+
 // isGlobExcluded checks if a filename matches any glob exclusion patterns.
 // Globs prefixed with ! are exclusion patterns; others are inclusion patterns.
 // If only exclusion patterns exist, a file is excluded if it matches any exclusion.
 // If any inclusion patterns exist, a file must match at least one inclusion AND not
-// match any exclusion.
-func (pw *parallelWalker) isGlobExcluded(name string) bool {
-	if len(pw.globs) == 0 {
+// match any exclusion. With fold set, globs match case-insensitively.
+func (f *walkFilter) isGlobExcluded(name string, fold bool) bool {
+	if len(f.globs) == 0 {
 		return false
 	}
 
+	name = foldName(name, fold)
 	hasIncludes := false
 	included := false
-	for _, g := range pw.globs {
-		if strings.HasPrefix(g, "!") {
-			// Exclusion glob
-			pattern := g[1:]
-			if matchGlob(pattern, name) {
+	for i := range f.globs {
+		g := &f.globs[i]
+		if g.exclude {
+			if g.match(name, fold) {
 				return true
 			}
 		} else {
-			// Inclusion glob
 			hasIncludes = true
-			if matchGlob(g, name) {
+			if g.match(name, fold) {
 				included = true
 			}
 		}
@@ -407,25 +849,38 @@ func (pw *parallelWalker) isGlobExcluded(name string) bool {
 	return false
 }
 
-// matchGlob matches a name against a glob pattern.
-// Supports brace expansion for {a,b,c} patterns.
-func matchGlob(pattern, name string) bool {
-	// Handle brace expansion: {a,b,c} → try each alternative
-	if i := strings.IndexByte(pattern, '{'); i >= 0 {
-		if j := strings.IndexByte(pattern[i:], '}'); j >= 0 {
-			prefix := pattern[:i]
-			suffix := pattern[i+j+1:]
-			alts := strings.Split(pattern[i+1:i+j], ",")
-			for _, alt := range alts {
-				if matchGlob(prefix+alt+suffix, name) {
-					return true
-				}
+// isDirGlobExcluded checks if a directory name matches a glob exclusion
+// pattern. Inclusion patterns select files, so a directory is descended
+// into whether or not its name matches one.
+func (f *walkFilter) isDirGlobExcluded(name string, fold bool) bool {
+	if len(f.globs) == 0 {
+		return false
+	}
+	name = foldName(name, fold)
+	for i := range f.globs {
+		if g := &f.globs[i]; g.exclude && g.match(name, fold) {
+			return true
+		}
+	}
+	return false
+}
+
+// globRule returns the glob that decides name under isGlobExcluded: the
+// exclusion glob that matched, else the first inclusion glob that matched.
+// Both are empty if no glob matched.
+func (f *walkFilter) globRule(name string, fold bool) (exclude, include string) {
+	folded := foldName(name, fold)
+	for i := range f.globs {
+		g := &f.globs[i]
+		if g.exclude {
+			if g.match(folded, fold) {
+				return g.text, ""
 			}
-			return false
+		} else if include == "" && g.match(folded, fold) {
+			include = g.text
 		}
 	}
-	matched, _ := filepath.Match(pattern, name)
-	return matched
+	return "", include
 }
 
 // WalkError represents an error during directory traversal.
@@ -0,0 +1,503 @@
+package walker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWalkStats(t *testing.T) {
+	root := t.TempDir()
+	for _, d := range []string{"src", "build", ".cache", ".git"} {
+		os.Mkdir(filepath.Join(root, d), 0755)
+	}
+	files := map[string]string{
+		".gitignore":  "build/\n*.log\n",
+		"src/main.go": "package main\n",
+		"src/app.log": "log\n",
+		"src/img.png": "png\n",
+		"src/.env":    "x\n",
+		"src/a.txt":   "a\n",
+		"README":      "readme\n",
+	}
+	for name, data := range files {
+		os.WriteFile(filepath.Join(root, name), []byte(data), 0644)
+	}
+
+	var st WalkStats
+	fileCh, errCh := Walk([]string{root}, WalkOptions{
+		Recursive: true,
+		Globs:     []string{"!*.txt"},
+		Stats:     &st,
+	})
+	go func() {
+		for range errCh {
+		}
+	}()
+	n := 0
+	for range fileCh {
+		n++
+	}
+
+	want := WalkStats{
+		Dirs:          2, // root, src
+		Files:         2, // src/main.go, README
+		SkippedVCS:    1,
+		SkippedHidden: 3, // .cache, .gitignore, src/.env
+		SkippedBinary: 1,
+		SkippedIgnore: 2, // build/, src/app.log
+		SkippedGlob:   1,
+
+		PeakQueuedDirs: 1, // root, then src
+	}
+	if st != want {
+		t.Errorf("stats = %+v, want %+v", st, want)
+	}
+	if n != st.Files {
+		t.Errorf("received %d files, stats say %d", n, st.Files)
+	}
+}
+
+func TestWalkSequential(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "a", "deep"), 0755)
+	os.Mkdir(filepath.Join(root, "b"), 0755)
+	for _, name := range []string{"top.txt", "a/x.txt", "a/deep/y.txt", "b/z.txt", "b/skip.log"} {
+		os.WriteFile(filepath.Join(root, name), []byte("x\n"), 0644)
+	}
+
+	var st WalkStats
+	var got []string
+	WalkSequential([]string{root}, WalkOptions{Globs: []string{"!*.log"}, Stats: &st},
+		func(e FileEntry) { got = append(got, e.Path) },
+		func(err error) { t.Errorf("walk error: %v", err) })
+
+	if len(got) != 4 {
+		t.Fatalf("got %d files %v, want 4", len(got), got)
+	}
+	// Depth-first: everything under a directory is visited before its
+	// next sibling directory.
+	pos := make(map[string]int)
+	for i, p := range got {
+		rel, _ := filepath.Rel(root, p)
+		pos[rel] = i
+	}
+	xa, ya, zb := pos["a/x.txt"], pos["a/deep/y.txt"], pos["b/z.txt"]
+	if (xa < zb) != (ya < zb) {
+		t.Errorf("subtree a/ interleaved with b/: %v", got)
+	}
+	if st.Dirs != 4 || st.Files != 4 || st.SkippedGlob != 1 {
+		t.Errorf("stats = %+v", st)
+	}
+}
+
+func TestWalkIncludeGlobDescends(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "src", "gen"), 0755)
+	os.Mkdir(filepath.Join(root, "vendor"), 0755)
+	for _, name := range []string{"main.go", "README.md", "src/a.go", "src/gen/b.go", "src/gen/b.txt", "vendor/c.go"} {
+		os.WriteFile(filepath.Join(root, name), []byte("x\n"), 0644)
+	}
+
+	var got []string
+	WalkSequential([]string{root}, WalkOptions{Recursive: true, Globs: []string{"*.go", "!vendor"}},
+		func(e FileEntry) {
+			rel, _ := filepath.Rel(root, e.Path)
+			got = append(got, rel)
+		},
+		func(err error) { t.Errorf("walk error: %v", err) })
+	sort.Strings(got)
+	if want := []string{"main.go", "src/a.go", "src/gen/b.go"}; strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestWalkHiddenPolicy(t *testing.T) {
+	root := t.TempDir()
+	for _, d := range []string{".cache", ".github", ".git"} {
+		os.Mkdir(filepath.Join(root, d), 0755)
+	}
+	for _, name := range []string{"main.go", ".env", ".cache/blob", ".github/ci.yml", ".git/HEAD"} {
+		os.WriteFile(filepath.Join(root, name), []byte("x\n"), 0644)
+	}
+
+	tests := []struct {
+		name string
+		opts WalkOptions
+		want []string
+	}{
+		{"default", WalkOptions{}, []string{"main.go"}},
+		{"hidden", WalkOptions{Hidden: true}, []string{".cache/blob", ".env", ".github/ci.yml", "main.go"}},
+		{"files only", WalkOptions{HiddenFiles: true}, []string{".env", "main.go"}},
+		{"dirs only", WalkOptions{HiddenDirs: true}, []string{".cache/blob", ".github/ci.yml", "main.go"}},
+		{"glob", WalkOptions{HiddenGlobs: []string{".github"}}, []string{".github/ci.yml", "main.go"}},
+		{"glob never reaches .git", WalkOptions{HiddenGlobs: []string{".git*"}}, []string{".github/ci.yml", "main.go"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			WalkSequential([]string{root}, tt.opts,
+				func(e FileEntry) {
+					rel, _ := filepath.Rel(root, e.Path)
+					got = append(got, rel)
+				},
+				func(err error) { t.Errorf("walk error: %v", err) })
+			sort.Strings(got)
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("files = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWalkRepoBoundary(t *testing.T) {
+	root := t.TempDir()
+	for _, d := range []string{".git", "src", "vendor/clone/.git", "vendor/mod"} {
+		os.MkdirAll(filepath.Join(root, d), 0755)
+	}
+	for _, name := range []string{"main.go", "src/a.go", "vendor/clone/b.go", "vendor/mod/c.go"} {
+		os.WriteFile(filepath.Join(root, name), []byte("x\n"), 0644)
+	}
+	os.WriteFile(filepath.Join(root, "vendor/mod/.git"), []byte("gitdir: ../../.git/modules/mod\n"), 0644)
+
+	tests := []struct {
+		name    string
+		repos   RepoBoundary
+		want    []string
+		skipped int
+	}{
+		{"descend", DescendRepos, []string{"main.go", "src/a.go", "vendor/clone/b.go", "vendor/mod/c.go"}, 0},
+		{"submodules", StopAtSubmodules, []string{"main.go", "src/a.go", "vendor/clone/b.go"}, 1},
+		{"repos", StopAtRepos, []string{"main.go", "src/a.go"}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var st WalkStats
+			fileCh, errCh := Walk([]string{root}, WalkOptions{Recursive: true, Repos: tt.repos, Stats: &st})
+			go func() {
+				for err := range errCh {
+					t.Errorf("walk error: %v", err)
+				}
+			}()
+			var got []string
+			for e := range fileCh {
+				rel, _ := filepath.Rel(root, e.Path)
+				got = append(got, rel)
+			}
+			sort.Strings(got)
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("files = %v, want %v", got, tt.want)
+			}
+			if st.SkippedRepos != tt.skipped {
+				t.Errorf("SkippedRepos = %d, want %d", st.SkippedRepos, tt.skipped)
+			}
+
+			// The root is walked even though it is a repository itself.
+			got = got[:0]
+			WalkSequential([]string{filepath.Join(root, "vendor/clone")}, WalkOptions{Repos: tt.repos},
+				func(e FileEntry) { got = append(got, filepath.Base(e.Path)) },
+				func(err error) { t.Errorf("walk error: %v", err) })
+			if len(got) != 1 || got[0] != "b.go" {
+				t.Errorf("walking a repository root: files = %v", got)
+			}
+		})
+	}
+}
+
+func TestWalkCanonical(t *testing.T) {
+	base := t.TempDir()
+	// The temporary directory may itself be reached through a symlink.
+	base, _ = filepath.EvalSymlinks(base)
+	root := filepath.Join(base, "tree")
+	os.MkdirAll(filepath.Join(root, "src"), 0755)
+	os.WriteFile(filepath.Join(root, "src/a.go"), []byte("x\n"), 0644)
+	os.WriteFile(filepath.Join(base, "outside.go"), []byte("x\n"), 0644)
+	os.Symlink("src", filepath.Join(root, "alias"))
+	os.Symlink("src/a.go", filepath.Join(root, "b.go"))
+	os.Symlink("../outside.go", filepath.Join(root, "c.go"))
+
+	var st WalkStats
+	fileCh, errCh := Walk([]string{root, filepath.Join(root, "alias/../src")}, WalkOptions{
+		Recursive:      true,
+		FollowSymlinks: true,
+		Canonical:      NewCanonical(),
+		Stats:          &st,
+	})
+	go func() {
+		for err := range errCh {
+			t.Errorf("walk error: %v", err)
+		}
+	}()
+	var got []string
+	for e := range fileCh {
+		got = append(got, e.Path)
+	}
+	sort.Strings(got)
+	want := []string{filepath.Join(base, "outside.go"), filepath.Join(root, "src/a.go")}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("files = %v, want %v", got, want)
+	}
+	// a.go is reached as src/a.go, alias/a.go, b.go and through the second root.
+	if st.SkippedDups != 3 || st.Files != 2 {
+		t.Errorf("Files = %d, SkippedDups = %d, want 2 and 3", st.Files, st.SkippedDups)
+	}
+}
+
+func TestWalkRootSpecs(t *testing.T) {
+	base := t.TempDir()
+	for _, d := range []string{"a", "b", "c"} {
+		os.Mkdir(filepath.Join(base, d), 0755)
+		for _, name := range []string{"main.go", ".env", "app.log"} {
+			os.WriteFile(filepath.Join(base, d, name), []byte("x\n"), 0644)
+		}
+	}
+	roots := []string{filepath.Join(base, "a")}
+	opts := WalkOptions{
+		Recursive: true,
+		Globs:     []string{"!*.go"},
+		Roots: []RootSpec{
+			{Path: filepath.Join(base, "b"), Options: WalkOptions{Hidden: true}},
+			{Path: filepath.Join(base, "c"), Label: "gamma", Options: WalkOptions{Globs: []string{"!*.log"}}},
+		},
+	}
+	want := "a/app.log b/.env b/app.log b/main.go c/main.go"
+	// Roots are labeled by their path unless the spec names them.
+	labels := map[string]string{"a": roots[0], "b": filepath.Join(base, "b"), "c": "gamma"}
+
+	var got []string
+	WalkSequential(roots, opts,
+		func(e FileEntry) {
+			rel, _ := filepath.Rel(base, e.Path)
+			got = append(got, rel)
+			if dir := filepath.Dir(rel); e.Root != labels[dir] {
+				t.Errorf("%s: Root = %q, want %q", rel, e.Root, labels[dir])
+			}
+		},
+		func(err error) { t.Errorf("walk error: %v", err) })
+	sort.Strings(got)
+	if strings.Join(got, " ") != want {
+		t.Errorf("sequential files = %v, want %s", got, want)
+	}
+
+	got = got[:0]
+	files, errs := Walk(roots, opts)
+	for e := range files {
+		rel, _ := filepath.Rel(base, e.Path)
+		got = append(got, rel)
+		if dir := filepath.Dir(rel); e.Root != labels[dir] {
+			t.Errorf("%s: Root = %q, want %q", rel, e.Root, labels[dir])
+		}
+	}
+	for err := range errs {
+		t.Errorf("walk error: %v", err)
+	}
+	sort.Strings(got)
+	if strings.Join(got, " ") != want {
+		t.Errorf("parallel files = %v, want %s", got, want)
+	}
+
+	e, err := Explain(filepath.Join(base, "b", ".env"), roots, opts)
+	if err != nil || !e.Included {
+		t.Errorf("Explain(b/.env) = %v, %v; want included by b's options", e, err)
+	}
+}
+
+func TestWalkDirectories(t *testing.T) {
+	root := t.TempDir()
+	os.Mkdir(filepath.Join(root, "sub"), 0755)
+	for _, name := range []string{"a.txt", "b.log", "sub/c.txt"} {
+		os.WriteFile(filepath.Join(root, name), []byte("x\n"), 0644)
+	}
+	file := filepath.Join(root, "a.txt")
+
+	tests := []struct {
+		name     string
+		dirs     DirAction
+		want     []string
+		wantErrs int
+	}{
+		{"warn", DirWarn, []string{"a.txt"}, 1},
+		{"skip", DirSkip, []string{"a.txt"}, 0},
+		{"read", DirRead, []string{"a.txt", "a.txt"}, 0}, // file arg, then the dir's non-.log files
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fileCh, errCh := Walk([]string{file, root}, WalkOptions{
+				Directories: tt.dirs,
+				Globs:       []string{"!*.log"},
+			})
+			errs := 0
+			done := make(chan struct{})
+			go func() {
+				for range errCh {
+					errs++
+				}
+				close(done)
+			}()
+			var got []string
+			for e := range fileCh {
+				got = append(got, filepath.Base(e.Path))
+			}
+			<-done
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("files = %v, want %v", got, tt.want)
+			}
+			if errs != tt.wantErrs {
+				t.Errorf("errors = %d, want %d", errs, tt.wantErrs)
+			}
+		})
+	}
+}
+
+func TestWalkCancel(t *testing.T) {
+	root := t.TempDir()
+	for i := range 20 {
+		dir := filepath.Join(root, strings.Repeat("d", i+1))
+		os.Mkdir(dir, 0755)
+		for j := range 50 {
+			os.WriteFile(filepath.Join(dir, strings.Repeat("f", j+1)), []byte("x\n"), 0644)
+		}
+	}
+
+	cancel := make(chan struct{})
+	var got int
+	WalkSequential([]string{root}, WalkOptions{Cancel: cancel},
+		func(e FileEntry) {
+			got++
+			if got == 3 {
+				close(cancel)
+			}
+		},
+		func(err error) { t.Errorf("walk error: %v", err) })
+	if got != 3 {
+		t.Errorf("sequential walk visited %d files after cancel, want 3", got)
+	}
+
+	// A parallel walk canceled before it starts reads no directory.
+	fileCh, errCh := Walk([]string{root}, WalkOptions{Recursive: true, Cancel: cancel})
+	go func() {
+		for range errCh {
+		}
+	}()
+	n := 0
+	for range fileCh {
+		n++
+	}
+	if n != 0 {
+		t.Errorf("canceled walk emitted %d files, want 0", n)
+	}
+}
+
+func TestWalkBounded(t *testing.T) {
+	root := t.TempDir()
+	files := 0
+	for i := range 6 {
+		dir := filepath.Join(root, fmt.Sprint("d", i))
+		for j := range 4 {
+			sub := filepath.Join(dir, fmt.Sprint("s", j))
+			os.MkdirAll(sub, 0755)
+			for k := range 5 {
+				os.WriteFile(filepath.Join(sub, fmt.Sprint("f", k)), []byte("x\n"), 0644)
+				files++
+			}
+		}
+	}
+
+	defer func(n int) { maxQueuedDirs = n }(maxQueuedDirs)
+	maxQueuedDirs = 2
+
+	const limit = 3
+	inFlight := NewInFlight(limit)
+	var st WalkStats
+	fileCh, errCh := Walk([]string{root}, WalkOptions{Recursive: true, Stats: &st, InFlight: inFlight})
+	go func() {
+		for err := range errCh {
+			t.Errorf("walk error: %v", err)
+		}
+	}()
+
+	// Hold on to files the way a slow search would, finishing one only
+	// after the walker had the chance to run ahead.
+	var held []FileEntry
+	n := 0
+	for e := range fileCh {
+		n++
+		held = append(held, e)
+		if len(held) > limit {
+			t.Fatalf("%d files in flight, limit %d", len(held), limit)
+		}
+		if len(held) == limit {
+			time.Sleep(time.Millisecond)
+			held = held[1:]
+			inFlight.Done()
+		}
+	}
+	if n != files {
+		t.Errorf("walked %d files, want %d", n, files)
+	}
+	if st.PeakInFlight > limit || st.Paused == 0 {
+		t.Errorf("peak in flight %d, %d pauses; want at most %d and some pauses", st.PeakInFlight, st.Paused, limit)
+	}
+	if st.PeakQueuedDirs > maxQueuedDirs || st.DepthFirstDirs == 0 {
+		t.Errorf("peak queue %d, %d dirs depth-first; want at most %d queued and some depth-first", st.PeakQueuedDirs, st.DepthFirstDirs, maxQueuedDirs)
+	}
+	if st.Dirs != 1+6+24 {
+		t.Errorf("walked %d dirs, want %d", st.Dirs, 1+6+24)
+	}
+}
+
+func TestPrioritize(t *testing.T) {
+	root := t.TempDir()
+	now := time.Now()
+	files := []struct {
+		name string
+		size int
+		age  time.Duration
+	}{
+		{"a", 300, 3 * time.Hour},
+		{"b", 100, 1 * time.Hour},
+		{"c", 200, 2 * time.Hour},
+		{"d", 100, 4 * time.Hour},
+	}
+	for _, f := range files {
+		p := filepath.Join(root, f.name)
+		os.WriteFile(p, make([]byte, f.size), 0644)
+		os.Chtimes(p, now, now.Add(-f.age))
+	}
+
+	order := func(p Priority, window int) string {
+		in := make(chan FileEntry, len(files))
+		for _, f := range files {
+			in <- FileEntry{Path: filepath.Join(root, f.name)}
+		}
+		close(in)
+		var got []string
+		for e := range Prioritize(in, p, window) {
+			got = append(got, filepath.Base(e.Path))
+		}
+		return strings.Join(got, "")
+	}
+
+	for _, tt := range []struct {
+		p      Priority
+		window int
+		want   string
+	}{
+		{PriorityWalk, 10, "abcd"},
+		{PrioritySmallest, 10, "bdca"}, // ties keep walk order
+		{PriorityRecent, 10, "bcad"},
+		{PrioritySmallest, 2, "bcda"}, // a stays held while smaller files pass it
+		{PrioritySmallest, 1, "abcd"},
+	} {
+		if got := order(tt.p, tt.window); got != tt.want {
+			t.Errorf("priority %d, window %d: got %s, want %s", tt.p, tt.window, got, tt.want)
+		}
+	}
+}
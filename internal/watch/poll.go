@@ -0,0 +1,72 @@
+package watch
+
+import "golang.org/x/sys/unix"
+
+// Poller tracks appended content of a fixed set of files by re-reading
+// them on demand, without inotify. It suits short-lived waits, such as a
+// script waiting for a log line, where setting up a Watcher costs more
+// than a few fstat calls per interval.
+type Poller struct {
+	paths []string
+	files map[string]polledFile
+}
+
+type polledFile struct {
+	ino    uint64
+	offset int64
+}
+
+// NewPoller starts tracking paths at their current end, so only content
+// appended afterwards is returned. A path that does not exist yet is read
+// from its start once it appears.
+func NewPoller(paths []string) *Poller {
+	p := &Poller{paths: paths, files: make(map[string]polledFile, len(paths))}
+	for _, path := range paths {
+		var st unix.Stat_t
+		if unix.Stat(path, &st) == nil {
+			p.files[path] = polledFile{ino: st.Ino, offset: st.Size}
+		}
+	}
+	return p
+}
+
+// Paths returns the polled paths, in the order given.
+func (p *Poller) Paths() []string {
+	return p.paths
+}
+
+// ReadNew returns the content appended to path since the last call. A file
+// that was replaced (new inode) or truncated is read from the start. A
+// missing file yields no data and no error.
+func (p *Poller) ReadNew(path string) ([]byte, error) {
+	fd, err := openRead(path)
+	if err == unix.ENOENT {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer unix.Close(fd)
+
+	var st unix.Stat_t
+	if err := unix.Fstat(fd, &st); err != nil {
+		return nil, err
+	}
+
+	f := p.files[path]
+	if f.ino != st.Ino || st.Size < f.offset {
+		f = polledFile{ino: st.Ino}
+	}
+	if st.Size == f.offset {
+		p.files[path] = f
+		return nil, nil
+	}
+
+	data, err := readRange(fd, f.offset, st.Size)
+	if err != nil {
+		return nil, err
+	}
+	f.offset += int64(len(data))
+	p.files[path] = f
+	return data, nil
+}
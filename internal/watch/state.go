@@ -0,0 +1,102 @@
+package watch
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// State records how far each watched file has been read, so a restarted
+// watcher resumes where the previous run stopped instead of skipping what
+// was appended in between or re-reading what was already processed.
+//
+// The file is plain text, one file per line: inode, offset and path,
+// separated by tabs. The inode detects a file replaced by log rotation,
+// which is then read from the start.
+type State struct {
+	path  string
+	files map[string]fileState
+}
+
+type fileState struct {
+	ino    uint64
+	offset int64
+}
+
+// LoadState reads the state file at path. A missing file yields an empty
+// state, written on the first Save.
+func LoadState(path string) (*State, error) {
+	s := &State{path: path, files: make(map[string]fileState)}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		fields := strings.SplitN(sc.Text(), "\t", 3)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("%s:%d: malformed entry", path, n)
+		}
+		ino, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: bad inode: %w", path, n, err)
+		}
+		off, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil || off < 0 {
+			return nil, fmt.Errorf("%s:%d: bad offset %q", path, n, fields[1])
+		}
+		s.files[fields[2]] = fileState{ino: ino, offset: off}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// resume returns the saved offset for path if it still refers to the same
+// file (inode ino, at least offset bytes long).
+func (s *State) resume(path string, ino uint64, size int64) (int64, bool) {
+	fs, ok := s.files[path]
+	if !ok || fs.ino != ino || fs.offset > size {
+		return 0, false
+	}
+	return fs.offset, true
+}
+
+func (s *State) record(path string, ino uint64, offset int64) {
+	s.files[path] = fileState{ino: ino, offset: offset}
+}
+
+// Save writes the state file, replacing it atomically so a crash never
+// leaves it half-written.
+func (s *State) Save() error {
+	var b strings.Builder
+	for path, fs := range s.files {
+		fmt.Fprintf(&b, "%d\t%d\t%s\n", fs.ino, fs.offset, path)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".gogrep-state-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.WriteString(b.String())
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
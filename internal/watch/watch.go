@@ -1,10 +1,11 @@
 package watch
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
-	"os"
 	"path/filepath"
+	"sort"
 
 	"golang.org/x/sys/unix"
 )
@@ -32,6 +33,9 @@ type Watcher struct {
 	watches   map[int]string   // wd -> path
 	offsets   map[string]int64 // path -> last read offset
 	done      chan struct{}
+
+	state  *State // if set, offsets resume from and are recorded into it
+	replay bool   // start files at offset 0 instead of their current end
 }
 
 // New creates a new inotify-based file watcher.
@@ -67,6 +71,15 @@ func New() (*Watcher, error) {
 	}, nil
 }
 
+// UseState makes the watcher resume files at the offsets saved in s and
+// record new offsets into it; the caller saves s once output for the read
+// data is written. With replay set, files already present are read from
+// the start instead. Call before Add.
+func (w *Watcher) UseState(s *State, replay bool) {
+	w.state = s
+	w.replay = replay
+}
+
 // Add adds a path to watch. For directories, watches for new/modified files.
 // For files, watches for modifications and moves (log rotation).
 func (w *Watcher) Add(path string) error {
@@ -84,15 +97,38 @@ func (w *Watcher) Add(path string) error {
 
 	w.watches[wd] = absPath
 
-	// Initialize offset for files
-	info, err := os.Stat(absPath)
-	if err == nil && !info.IsDir() {
-		w.offsets[absPath] = info.Size()
+	// Initialize offset for files: resume from saved state, else start at
+	// the current end so only new content is searched.
+	var stat unix.Stat_t
+	if err := unix.Stat(absPath, &stat); err == nil && stat.Mode&unix.S_IFMT != unix.S_IFDIR {
+		off := stat.Size
+		if w.replay {
+			off = 0
+		} else if w.state != nil {
+			if saved, ok := w.state.resume(absPath, stat.Ino, stat.Size); ok {
+				off = saved
+			} else if _, known := w.state.files[absPath]; known {
+				off = 0 // replaced or truncated while we were not watching
+			}
+		}
+		w.offsets[absPath] = off
 	}
 
 	return nil
 }
 
+// Files returns the watched regular files, sorted. After Add, files with a
+// resumed or replayed offset may hold unread data; callers drain them with
+// ReadNew before waiting for events.
+func (w *Watcher) Files() []string {
+	files := make([]string, 0, len(w.offsets))
+	for path := range w.offsets {
+		files = append(files, path)
+	}
+	sort.Strings(files)
+	return files
+}
+
 // Events returns a channel of file events. Blocks until Close() is called.
 func (w *Watcher) Events() <-chan Event {
 	ch := make(chan Event, 64)
@@ -196,21 +232,29 @@ func (w *Watcher) parseEvents(buf []byte, ch chan<- Event) {
 // ReadNew reads new content appended to a file since the last read.
 // Returns the new bytes and updates the tracked offset.
 func (w *Watcher) ReadNew(path string) ([]byte, error) {
-	fd, err := unix.Open(path, unix.O_RDONLY|unix.O_NOATIME, 0)
+	data, _, err := w.ReadNewAt(path)
+	return data, err
+}
+
+// ReadNewAt is ReadNew that also returns the file offset the data starts
+// at, which is 0 when a truncated file is read again from the start.
+func (w *Watcher) ReadNewAt(path string) ([]byte, int64, error) {
+	fd, err := openRead(path)
 	if err != nil {
-		fd, err = unix.Open(path, unix.O_RDONLY, 0)
-		if err != nil {
-			return nil, err
-		}
+		return nil, 0, err
 	}
 	defer unix.Close(fd)
 
 	var stat unix.Stat_t
 	if err := unix.Fstat(fd, &stat); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
-	lastOffset := w.offsets[path]
+	lastOffset, ok := w.offsets[path]
+	if !ok && w.state != nil {
+		// A file in a watched directory seen for the first time this run.
+		lastOffset, _ = w.state.resume(path, stat.Ino, stat.Size)
+	}
 	newSize := stat.Size
 
 	if newSize <= lastOffset {
@@ -219,25 +263,70 @@ func (w *Watcher) ReadNew(path string) ([]byte, error) {
 			w.offsets[path] = 0
 			lastOffset = 0
 		} else {
-			return nil, nil
+			return nil, 0, nil
 		}
 	}
 
-	toRead := int(newSize - lastOffset)
-	if toRead == 0 {
-		return nil, nil
+	if newSize == lastOffset {
+		return nil, 0, nil
 	}
 
-	buf := make([]byte, toRead)
-	n, err := unix.Pread(fd, buf, lastOffset)
+	data, err := readRange(fd, lastOffset, newSize)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+
+	w.offsets[path] = lastOffset + int64(len(data))
+	if w.state != nil {
+		w.state.record(path, stat.Ino, w.offsets[path])
 	}
+	return data, lastOffset, nil
+}
+
+// openRead opens path read-only, with O_NOATIME where permitted.
+func openRead(path string) (int, error) {
+	fd, err := unix.Open(path, unix.O_RDONLY|unix.O_NOATIME, 0)
+	if err != nil {
+		return unix.Open(path, unix.O_RDONLY, 0)
+	}
+	return fd, nil
+}
 
-	w.offsets[path] = lastOffset + int64(n)
+// readRange reads bytes [from, to) of fd; fewer if the file shrank.
+func readRange(fd int, from, to int64) ([]byte, error) {
+	buf := make([]byte, to-from)
+	n, err := unix.Pread(fd, buf, from)
+	if err != nil {
+		return nil, err
+	}
 	return buf[:n], nil
 }
 
+// CountLines returns the number of newlines in the first n bytes of path,
+// the line number a watch of the file continues from.
+func CountLines(path string, n int64) (int, error) {
+	fd, err := openRead(path)
+	if err != nil {
+		return 0, err
+	}
+	defer unix.Close(fd)
+
+	buf := make([]byte, 1<<20)
+	lines := 0
+	for off := int64(0); off < n; {
+		k, err := unix.Pread(fd, buf[:min(int64(len(buf)), n-off)], off)
+		if err != nil {
+			return 0, err
+		}
+		if k == 0 {
+			break
+		}
+		lines += bytes.Count(buf[:k], []byte{'\n'})
+		off += int64(k)
+	}
+	return lines, nil
+}
+
 // Close stops the watcher and releases resources.
 func (w *Watcher) Close() error {
 	close(w.done)
@@ -214,3 +214,136 @@ func TestParseEvents(t *testing.T) {
 		t.Error("no event received")
 	}
 }
+
+func TestWatcher_StateResume(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	statePath := filepath.Join(dir, "state")
+	if err := os.WriteFile(path, []byte("old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(replay bool) (*Watcher, *State) {
+		t.Helper()
+		st, err := LoadState(statePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w, err := New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.UseState(st, replay)
+		if err := w.Add(path); err != nil {
+			t.Fatal(err)
+		}
+		return w, st
+	}
+	appendFile := func(s string) {
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString(s)
+		f.Close()
+	}
+
+	// First run: starts at the end, reads one append, saves.
+	w, st := run(false)
+	appendFile("first\n")
+	if data, _ := w.ReadNew(path); string(data) != "first\n" {
+		t.Fatalf("first run read %q", data)
+	}
+	if err := st.Save(); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	// Appended while down: the next run picks up exactly that.
+	appendFile("while down\n")
+	w, _ = run(false)
+	if got := w.Files(); len(got) != 1 || got[0] != path {
+		t.Fatalf("Files() = %v", got)
+	}
+	if data, _ := w.ReadNew(path); string(data) != "while down\n" {
+		t.Errorf("resumed read %q, want %q", data, "while down\n")
+	}
+	w.Close()
+
+	// Replay ignores the saved offset.
+	w, _ = run(true)
+	if data, _ := w.ReadNew(path); string(data) != "old\nfirst\nwhile down\n" {
+		t.Errorf("replay read %q", data)
+	}
+	w.Close()
+
+	// A rotated file (new inode) is read from the start.
+	os.Remove(path)
+	os.WriteFile(path, []byte("rotated\n"), 0644)
+	w, _ = run(false)
+	if data, _ := w.ReadNew(path); string(data) != "rotated\n" {
+		t.Errorf("rotated read %q, want %q", data, "rotated\n")
+	}
+	w.Close()
+}
+
+func TestLoadState_Malformed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state")
+	os.WriteFile(path, []byte("not a state line\n"), 0644)
+	if _, err := LoadState(path); err == nil {
+		t.Error("LoadState accepted a malformed file")
+	}
+}
+
+func TestPoller_ReadNew(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "app.log")
+	later := filepath.Join(dir, "later.log")
+	os.WriteFile(logPath, []byte("old\n"), 0644)
+
+	p := NewPoller([]string{logPath, later})
+	read := func(path string) string {
+		t.Helper()
+		data, err := p.ReadNew(path)
+		if err != nil {
+			t.Fatalf("ReadNew(%s): %v", path, err)
+		}
+		return string(data)
+	}
+
+	if got := read(logPath); got != "" {
+		t.Errorf("existing content returned: %q", got)
+	}
+	if got := read(later); got != "" {
+		t.Errorf("missing file: %q", got)
+	}
+
+	f, _ := os.OpenFile(logPath, os.O_APPEND|os.O_WRONLY, 0)
+	f.WriteString("ready\n")
+	f.Close()
+	if got := read(logPath); got != "ready\n" {
+		t.Errorf("appended: got %q", got)
+	}
+	if got := read(logPath); got != "" {
+		t.Errorf("second read: got %q", got)
+	}
+
+	// A file created after the start is read from its beginning.
+	os.WriteFile(later, []byte("first\n"), 0644)
+	if got := read(later); got != "first\n" {
+		t.Errorf("new file: got %q", got)
+	}
+
+	// Rotation: a new file under the same name starts over.
+	os.Rename(logPath, logPath+".1")
+	os.WriteFile(logPath, []byte("rotated\nfile\n"), 0644)
+	if got := read(logPath); got != "rotated\nfile\n" {
+		t.Errorf("rotated: got %q", got)
+	}
+
+	// Truncation starts over too.
+	os.WriteFile(logPath, []byte("x\n"), 0644)
+	if got := read(logPath); got != "x\n" {
+		t.Errorf("truncated: got %q", got)
+	}
+}